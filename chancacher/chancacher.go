@@ -12,7 +12,6 @@
 package chancacher
 
 import (
-	"encoding/gob"
 	"errors"
 	"fmt"
 	"io"
@@ -20,6 +19,7 @@ import (
 	"os"
 	"path/filepath"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gofrs/flock"
@@ -27,6 +27,7 @@ import (
 
 var (
 	ErrInvalidCachePath = errors.New("Invalid cache path")
+	ErrCacheLocked      = errors.New("Cache is locked by another process")
 )
 
 // The maximum channel depth, which is also used when the channel depth is set
@@ -34,20 +35,30 @@ var (
 // without a clean way to triage. It's best to just enforce a sensible maximum.
 const MaxDepth = 1000000
 
+// countFile holds the item count saved by Commit
+const countFile = "count"
+
 // A ChanCacher is a pipeline of channels with a variable-sized internal
-// buffer. The buffer can also cache to disk. The user is expected to connect
-// ChanCacher.In and ChanCacher.Out.
-type ChanCacher struct {
-	In      chan interface{}
-	Out     chan interface{}
+// buffer that moves arbitrary values and caches them to disk with gob.
+type ChanCacher = TypedChanCacher[interface{}]
+
+// A TypedChanCacher is a pipeline of channels with a variable-sized internal
+// buffer. The buffer can also cache to disk using the provided codec. The user
+// is expected to connect TypedChanCacher.In and TypedChanCacher.Out.
+type TypedChanCacher[T any] struct {
+	In      chan T
+	Out     chan T
 	runDone bool
 	maxSize int
 
 	cachePath      string
 	cache          bool
+	codec          Codec[T]
+	count          int64 // items in the cache files
+	countErr       error // decode error hit while counting recovered cache files
 	cacheR         *fileCounter
 	cacheW         *fileCounter
-	cacheEnc       *gob.Encoder
+	cacheEnc       Encoder[T]
 	cacheModified  bool
 	cacheLock      sync.Mutex
 	cacheReading   bool
@@ -73,6 +84,15 @@ type ChanCacher struct {
 // way, you can recover data sent to disk on a crash or previous use of
 // Commit().
 func NewChanCacher(maxDepth int, cachePath string, maxSize int) (*ChanCacher, error) {
+	return NewTypedChanCacher[interface{}](maxDepth, cachePath, maxSize, GobCodec[interface{}]{})
+}
+
+// NewTypedChanCacher creates a ChanCacher that moves values of type T and
+// encodes them to the backing files with codec, see NewChanCacher. Commit
+// saves the item count next to the cache files so a cleanly committed cache
+// is not decoded on startup, cache files left behind by a crash are decoded
+// to count them.
+func NewTypedChanCacher[T any](maxDepth int, cachePath string, maxSize int, codec Codec[T]) (*TypedChanCacher[T], error) {
 	if cachePath != "" {
 		if fi, err := os.Stat(cachePath); err != nil {
 			if !os.IsNotExist(err) {
@@ -89,11 +109,12 @@ func NewChanCacher(maxDepth int, cachePath string, maxSize int) (*ChanCacher, er
 	if maxDepth == -1 || maxDepth > MaxDepth {
 		maxDepth = MaxDepth
 	}
-	c := &ChanCacher{
-		In:          make(chan interface{}),
-		Out:         make(chan interface{}, maxDepth),
+	c := &TypedChanCacher[T]{
+		In:          make(chan T),
+		Out:         make(chan T, maxDepth),
 		cachePath:   cachePath,
 		cache:       cachePath != "",
+		codec:       codec,
 		cachePaused: make(chan bool),
 		cacheDone:   make(chan bool),
 		cacheAck:    make(chan bool),
@@ -141,13 +162,18 @@ func NewChanCacher(maxDepth int, cachePath string, maxSize int) (*ChanCacher, er
 		// if only one file has data in it, just shuffle the files
 		// around. If both have data, merge. If neither have data, no
 		// action is needed.
+		// a saved count is only trusted if the files have not changed since
+		// it was written, it is removed either way so a crash can't reuse it
+		saved, counted := readCount(c.cachePath, sizeA+sizeB)
+		os.Remove(filepath.Join(c.cachePath, countFile))
+
 		if sizeB != 0 && sizeA == 0 {
 			err := os.Rename(b, a)
 			if err != nil {
 				return nil, err
 			}
 		} else if sizeB != 0 && sizeA != 0 {
-			err := merge(a, b)
+			err := merge(a, b, codec)
 			if err != nil {
 				return nil, err
 			}
@@ -181,7 +207,7 @@ func NewChanCacher(maxDepth int, cachePath string, maxSize int) (*ChanCacher, er
 			return nil, err
 		}
 
-		c.cacheEnc = gob.NewEncoder(c.cacheW)
+		c.cacheEnc = codec.NewEncoder(c.cacheW)
 
 		// if the write cache data data in it already (recover), then
 		// mark the cache as modified.
@@ -193,6 +219,24 @@ func NewChanCacher(maxDepth int, cachePath string, maxSize int) (*ChanCacher, er
 			c.cacheModified = true
 		}
 
+		// count what is waiting to be replayed, a corrupt tail ends the
+		// count the same way it ends replay
+		if counted {
+			c.count = saved
+		} else {
+			for _, f := range []*os.File{r, w} {
+				if err = walkFile(f, codec, func(T) error {
+					c.count++
+					return nil
+				}); err != nil && c.countErr == nil {
+					c.countErr = fmt.Errorf("%s: %w", f.Name(), err)
+				}
+				if _, err = f.Seek(0, 0); err != nil {
+					return nil, err
+				}
+			}
+		}
+
 		go c.cacheHandler()
 	}
 	go c.run()
@@ -203,7 +247,7 @@ func NewChanCacher(maxDepth int, cachePath string, maxSize int) (*ChanCacher, er
 // we block on reads from in. Optionally, we redirect input to a backing store
 // with gob, and continue reading from in indefinitely. When the backing store
 // is enabled, we end up plumbing in->cache->out.
-func (c *ChanCacher) run() {
+func (c *TypedChanCacher[T]) run() {
 	for v := range c.In {
 		select {
 		case c.Out <- v:
@@ -249,22 +293,23 @@ func (c *ChanCacher) run() {
 	close(c.Out)
 }
 
-func (c *ChanCacher) cacheHandler() {
+func (c *TypedChanCacher[T]) cacheHandler() {
 	// the main cache loop. We read from R, putting data into out directly
 	// until R is drained. Once R is drained, wait for W to have data and
 	// for run() to signal that we can swap buffers.
 	c.cacheReading = true
 	for {
 		var err error
+		var v T
 
-		dec := gob.NewDecoder(c.cacheR)
-		var v interface{}
+		dec := c.codec.NewDecoder(c.cacheR)
 		for {
-			err = dec.Decode(&v)
+			v, err = dec.Decode()
 			if err != nil {
 				break
 			}
-			if v == nil {
+			atomic.AddInt64(&c.count, -1)
+			if isNil(v) {
 				continue
 			}
 
@@ -301,15 +346,15 @@ func (c *ChanCacher) cacheHandler() {
 		c.cacheLock.Lock()
 		c.cacheR, c.cacheW = c.cacheW, c.cacheR
 		c.cacheR.Seek(0, 0)
-		c.cacheEnc = gob.NewEncoder(c.cacheW)
+		c.cacheEnc = c.codec.NewEncoder(c.cacheW)
 		c.cacheModified = false
 		c.cacheReading = true
 		c.cacheLock.Unlock()
 	}
 }
 
-func (c *ChanCacher) cacheValue(v interface{}) {
-	if v == nil {
+func (c *TypedChanCacher[T]) cacheValue(v T) {
+	if isNil(v) {
 		return
 	}
 	for c.maxSize != 0 && c.Size() >= c.maxSize {
@@ -318,25 +363,27 @@ func (c *ChanCacher) cacheValue(v interface{}) {
 
 	c.cacheLock.Lock()
 	defer c.cacheLock.Unlock()
-	err := c.cacheEnc.Encode(&v)
+	err := c.cacheEnc.Encode(v)
 	if err != nil {
 		// TODO: log
+		return
 	}
+	atomic.AddInt64(&c.count, 1)
 	c.cacheModified = true
 }
 
 // Return if the cache has outstanding data not written to the output channel.
-func (c *ChanCacher) CacheHasData() bool {
+func (c *TypedChanCacher[T]) CacheHasData() bool {
 	return c.cacheModified || c.cacheReading
 }
 
 // Returns the number of elements on the internal buffer.
-func (c *ChanCacher) BufferSize() int {
+func (c *TypedChanCacher[T]) BufferSize() int {
 	return len(c.Out)
 }
 
 // Enable a stopped cache.
-func (c *ChanCacher) CacheStart() {
+func (c *TypedChanCacher[T]) CacheStart() {
 	if !c.cache {
 		return
 	}
@@ -352,7 +399,7 @@ func (c *ChanCacher) CacheStart() {
 // Stop a running cache. Calling Stop() will prevent the ChanCacher from
 // writing any new data to the backing file, but will not stop it from reading
 // (draining) the cache to the output channel.
-func (c *ChanCacher) CacheStop() {
+func (c *TypedChanCacher[T]) CacheStop() {
 	if !c.cache {
 		return
 	}
@@ -370,7 +417,7 @@ func (c *ChanCacher) CacheStop() {
 // probably don't want to use Drain(), but instead close ChanCacher.In and wait
 // for the ChanCacher.Out to close, which does carry guarantees that the
 // internal buffers and cache are fully drained.
-func (c *ChanCacher) Drain() {
+func (c *TypedChanCacher[T]) Drain() {
 	for len(c.Out) != 0 {
 		time.Sleep(100 * time.Millisecond)
 	}
@@ -393,7 +440,7 @@ func (c *ChanCacher) Drain() {
 // Once Commit() is called, draining the cache cannot be restarted, though
 // writing to the cache will still work. Commit should only be used for teardown
 // scenarios.
-func (c *ChanCacher) Commit() {
+func (c *TypedChanCacher[T]) Commit() {
 	if !c.cache {
 		c.cacheCommitted = true
 		return
@@ -408,21 +455,55 @@ func (c *ChanCacher) Commit() {
 		case <-c.cacheAck:
 			readerStopped = true
 		case v := <-c.Out:
-			if v != nil {
-				c.cacheValue(v)
-			}
+			c.cacheValue(v)
 		}
 	}
 
 	c.cacheR.Sync()
 	c.cacheW.Sync()
+	var size int64
+	for _, f := range []*fileCounter{c.cacheR, c.cacheW} {
+		if fi, err := f.Stat(); err == nil {
+			size += fi.Size()
+		}
+	}
 	c.cacheR.Close()
 	c.cacheW.Close()
+	writeCount(c.cachePath, int64(c.Count()), size)
 
 	c.cacheCommitted = true
 }
 
-func (c *ChanCacher) finishCache() {
+// readCount loads the item count saved by Commit, ok is false if there is no
+// saved count or the cache files are not the size they were when it was saved.
+func readCount(cachePath string, size int64) (count int64, ok bool) {
+	b, err := os.ReadFile(filepath.Join(cachePath, countFile))
+	if err != nil {
+		return
+	}
+	var sz int64
+	if n, err := fmt.Sscanf(string(b), "%d %d", &count, &sz); err != nil || n != 2 || sz != size || count < 0 {
+		return 0, false
+	}
+	return count, true
+}
+
+// writeCount saves the item count and total size of the cache files, failures
+// are ignored and just mean the files are counted the next time they are opened.
+func writeCount(cachePath string, count, size int64) {
+	p := filepath.Join(cachePath, countFile)
+	if err := os.WriteFile(p+".tmp", []byte(fmt.Sprintf("%d %d\n", count, size)), 0640); err == nil {
+		os.Rename(p+".tmp", p)
+	}
+}
+
+// RecoveryError returns the decode error that stopped the count of recovered
+// cache files, replay stops at the same point so the remainder of the file is lost.
+func (c *TypedChanCacher[T]) RecoveryError() error {
+	return c.countErr
+}
+
+func (c *TypedChanCacher[T]) finishCache() {
 	c.cacheLock.Lock()
 	defer c.cacheLock.Unlock()
 
@@ -434,13 +515,19 @@ func (c *ChanCacher) finishCache() {
 
 // Returns the number of bytes committed to disk. This does not include data in
 // the in-memory buffer.
-func (c *ChanCacher) Size() int {
+func (c *TypedChanCacher[T]) Size() int {
 	return c.cacheR.Count() + c.cacheW.Count()
 }
 
-// Merge two gob encoded files into a single file. Paths a and b are specified,
+// Count returns the number of items committed to disk and not yet replayed.
+// Like Size, this does not include the in-memory buffer.
+func (c *TypedChanCacher[T]) Count() int {
+	return int(atomic.LoadInt64(&c.count))
+}
+
+// Merge two encoded files into a single file. Paths a and b are specified,
 // with the resulting file in a.
-func merge(a, b string) error {
+func merge[T any](a, b string, codec Codec[T]) error {
 	fa, err := os.Open(a)
 	if err != nil {
 		return err
@@ -460,43 +547,17 @@ func merge(a, b string) error {
 	defer t.Close()
 	defer os.Remove(t.Name())
 
-	enc := gob.NewEncoder(t)
-
-	adec := gob.NewDecoder(fa)
-	var v interface{}
-	for {
-		err = adec.Decode(&v)
-		if err != nil {
-			if err != io.EOF {
-				return err
-			}
-			break
-		}
-		if v == nil {
-			continue
-		}
-		err = enc.Encode(&v)
-		if err != nil {
-			return err
+	enc := codec.NewEncoder(t)
+	copyValues := func(v T) error {
+		if isNil(v) {
+			return nil
 		}
+		return enc.Encode(v)
 	}
-
-	bdec := gob.NewDecoder(fb)
-	for {
-		err = bdec.Decode(&v)
-		if err != nil {
-			if err != io.EOF {
-				return err
-			}
-			break
-		}
-		if v == nil {
-			continue
-		}
-		err = enc.Encode(&v)
-		if err != nil {
-			return err
-		}
+	if err = walkFile(fa, codec, copyValues); err != nil {
+		return err
+	} else if err = walkFile(fb, codec, copyValues); err != nil {
+		return err
 	}
 
 	// remove a, b
@@ -0,0 +1,178 @@
+/*************************************************************************
+ * Copyright 2024 Gravwell, Inc. All rights reserved.
+ * Contact: <legal@gravwell.io>
+ *
+ * This software may be modified and distributed under the terms of the
+ * BSD 2-clause license. See the LICENSE file for details.
+ **************************************************************************/
+
+package chancacher
+
+import (
+	"bufio"
+	"encoding/gob"
+	"io"
+	"reflect"
+
+	"github.com/gravwell/gravwell/v3/ingest/entry"
+)
+
+// An Encoder writes a stream of values to a cache file.
+type Encoder[T any] interface {
+	Encode(T) error
+}
+
+// A Decoder reads a stream of values from a cache file, Decode returns
+// io.EOF when the stream is exhausted.
+type Decoder[T any] interface {
+	Decode() (T, error)
+}
+
+// A Codec creates encoders and decoders for cache files. Each encoder
+// writes a self contained stream that is read back by a single decoder.
+type Codec[T any] interface {
+	NewEncoder(io.Writer) Encoder[T]
+	NewDecoder(io.Reader) Decoder[T]
+}
+
+// GobCodec encodes values with encoding/gob. Interface types must have
+// their concrete types registered with gob.
+type GobCodec[T any] struct{}
+
+type gobEncoder[T any] struct {
+	enc *gob.Encoder
+}
+
+type gobDecoder[T any] struct {
+	dec *gob.Decoder
+}
+
+func (GobCodec[T]) NewEncoder(w io.Writer) Encoder[T] {
+	return gobEncoder[T]{enc: gob.NewEncoder(w)}
+}
+
+func (GobCodec[T]) NewDecoder(r io.Reader) Decoder[T] {
+	return gobDecoder[T]{dec: gob.NewDecoder(r)}
+}
+
+func (e gobEncoder[T]) Encode(v T) error {
+	//encode through a pointer so interface values carry their type
+	return e.enc.Encode(&v)
+}
+
+func (d gobDecoder[T]) Decode() (v T, err error) {
+	err = d.dec.Decode(&v)
+	return
+}
+
+// EntryCodec encodes entries with the native entry encoding, which is
+// considerably smaller and faster than gob.
+type EntryCodec struct{}
+
+type entryEncoder struct {
+	w    io.Writer
+	buff []byte
+}
+
+type entryDecoder struct {
+	r *bufio.Reader
+}
+
+func (EntryCodec) NewEncoder(w io.Writer) Encoder[*entry.Entry] {
+	return &entryEncoder{w: w}
+}
+
+func (EntryCodec) NewDecoder(r io.Reader) Decoder[*entry.Entry] {
+	return entryDecoder{r: bufio.NewReader(r)}
+}
+
+func (e *entryEncoder) Encode(ent *entry.Entry) (err error) {
+	var n int
+	//encode into a single buffer so a value is written with one call
+	if sz := int(ent.Size()); cap(e.buff) < sz {
+		e.buff = make([]byte, sz)
+	} else {
+		e.buff = e.buff[:sz]
+	}
+	if n, err = ent.Encode(e.buff); err == nil {
+		_, err = e.w.Write(e.buff[:n])
+	}
+	return
+}
+
+func (d entryDecoder) Decode() (ent *entry.Entry, err error) {
+	if _, err = d.r.Peek(1); err != nil {
+		return //clean EOF between entries
+	}
+	ent = new(entry.Entry)
+	if err = ent.DecodeReader(d.r); err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return
+}
+
+// ColumnarCodec encodes blocks of entries in the compressed columnar entry
+// format, each value is written as a single block. Repetitive entries cache
+// much smaller than with EntryCodec at the cost of compressing every block.
+// Empty blocks are not written.
+type ColumnarCodec struct{}
+
+type columnarEncoder struct {
+	w *entry.ColumnarWriter
+}
+
+type columnarDecoder struct {
+	r *entry.ColumnarReader
+}
+
+func (ColumnarCodec) NewEncoder(w io.Writer) Encoder[[]*entry.Entry] {
+	return columnarEncoder{w: entry.NewColumnarWriter(w)}
+}
+
+func (ColumnarCodec) NewDecoder(r io.Reader) Decoder[[]*entry.Entry] {
+	return columnarDecoder{r: entry.NewColumnarReader(r)}
+}
+
+func (e columnarEncoder) Encode(ents []*entry.Entry) (err error) {
+	if len(ents) == 0 {
+		return
+	}
+	//flush every block, the cache file may be closed without warning
+	if err = e.w.Write(ents); err == nil {
+		err = e.w.Flush()
+	}
+	return
+}
+
+func (d columnarDecoder) Decode() ([]*entry.Entry, error) {
+	return d.r.Read()
+}
+
+// walkFile decodes every value in f, stopping at the end of the stream or
+// the first error.
+func walkFile[T any](f io.Reader, codec Codec[T], fn func(T) error) error {
+	dec := codec.NewDecoder(f)
+	for {
+		v, err := dec.Decode()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		} else if err = fn(v); err != nil {
+			return err
+		}
+	}
+}
+
+// isNil reports if v is nil, nil values are never written to the cache.
+func isNil[T any](v T) bool {
+	rv := reflect.ValueOf(any(v))
+	if !rv.IsValid() {
+		return true
+	}
+	switch rv.Kind() {
+	case reflect.Pointer, reflect.Map, reflect.Slice, reflect.Interface, reflect.Chan, reflect.Func:
+		return rv.IsNil()
+	}
+	return false
+}
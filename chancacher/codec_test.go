@@ -0,0 +1,283 @@
+/*************************************************************************
+ * Copyright 2024 Gravwell, Inc. All rights reserved.
+ * Contact: <legal@gravwell.io>
+ *
+ * This software may be modified and distributed under the terms of the
+ * BSD 2-clause license. See the LICENSE file for details.
+ **************************************************************************/
+
+package chancacher
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gravwell/gravwell/v3/ingest/entry"
+)
+
+func makeTestEntry(i int) *entry.Entry {
+	e := &entry.Entry{
+		Data: []byte(fmt.Sprintf("%d", i)),
+		SRC:  net.ParseIP("10.0.0.1").To4(),
+		TS:   entry.UnixTime(int64(1700000000+i), 0),
+		Tag:  entry.EntryTag(i % 3),
+	}
+	e.AddEnumeratedValueEx("index", i)
+	return e
+}
+
+func TestEntryCodec(t *testing.T) {
+	var bb bytes.Buffer
+	enc := EntryCodec{}.NewEncoder(&bb)
+	for i := 0; i < 100; i++ {
+		if err := enc.Encode(makeTestEntry(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	full := bb.Len()
+	dec := EntryCodec{}.NewDecoder(&bb)
+	for i := 0; i < 100; i++ {
+		ent, err := dec.Decode()
+		if err != nil {
+			t.Fatal(err)
+		} else if string(ent.Data) != fmt.Sprintf("%d", i) || ent.TS.Sec != makeTestEntry(i).TS.Sec {
+			t.Fatalf("bad entry %d: %+v", i, ent)
+		} else if v, ok := ent.GetEnumeratedValue("index"); !ok || v.(int64) != int64(i) {
+			t.Fatalf("bad index on %d: %v", i, v)
+		}
+	}
+	if _, err := dec.Decode(); err != io.EOF {
+		t.Fatalf("expected EOF: %v", err)
+	}
+
+	//a torn tail is an error rather than a clean end
+	bb.Reset()
+	enc = EntryCodec{}.NewEncoder(&bb)
+	enc.Encode(makeTestEntry(1))
+	dec = EntryCodec{}.NewDecoder(bytes.NewReader(bb.Bytes()[:bb.Len()-3]))
+	if _, err := dec.Decode(); err == nil || err == io.EOF {
+		t.Fatalf("truncated entry decoded: %v", err)
+	}
+	if full == 0 {
+		t.Fatal("nothing encoded")
+	}
+}
+
+func TestTypedCacheEntries(t *testing.T) {
+	dir := t.TempDir()
+	c, err := NewTypedChanCacher[*entry.Entry](2, dir, 0, EntryCodec{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 100; i++ {
+		select {
+		case c.In <- makeTestEntry(i):
+		case <-time.After(DEFAULT_TIMEOUT):
+			t.Fatal("channel write should not block")
+		}
+	}
+	//nil values are dropped
+	c.In <- nil
+	close(c.In)
+	c.Commit()
+	<-c.Out
+
+	if c, err = NewTypedChanCacher[*entry.Entry](2, dir, 0, EntryCodec{}); err != nil {
+		t.Fatal(err)
+	}
+	if n := c.Count(); n != 100 {
+		t.Fatalf("bad recovered count %d", n)
+	}
+	results := make(map[int]int)
+	for i := 0; i < 100; i++ {
+		select {
+		case ent := <-c.Out:
+			if ent == nil {
+				t.Fatal("nil result!")
+			}
+			idx, ok := ent.GetEnumeratedValue("index")
+			if !ok {
+				t.Fatalf("Didn't get enumerated value index: %+v", ent)
+			}
+			results[int(idx.(int64))]++
+		case <-time.After(5 * DEFAULT_TIMEOUT):
+			t.Fatalf("channel blocked after %d reads!", i)
+		}
+	}
+	for i := 0; i < 100; i++ {
+		if results[i] != 1 {
+			t.Errorf("mismatched count: %v: %v", i, results[i])
+		}
+	}
+	if n := c.Count(); n != 0 {
+		t.Fatalf("bad count after replay %d", n)
+	}
+}
+
+func TestColumnarCodec(t *testing.T) {
+	var bb bytes.Buffer
+	enc := ColumnarCodec{}.NewEncoder(&bb)
+	for i := 0; i < 10; i++ {
+		var blk []*entry.Entry
+		for j := 0; j < 10; j++ {
+			blk = append(blk, makeTestEntry(i*10+j))
+		}
+		if err := enc.Encode(blk); err != nil {
+			t.Fatal(err)
+		}
+	}
+	//empty blocks are skipped rather than written
+	if err := enc.Encode(nil); err != nil {
+		t.Fatal(err)
+	}
+	full := bb.Bytes()
+	dec := ColumnarCodec{}.NewDecoder(bytes.NewReader(full))
+	for i := 0; i < 10; i++ {
+		blk, err := dec.Decode()
+		if err != nil {
+			t.Fatal(err)
+		} else if len(blk) != 10 {
+			t.Fatalf("bad block size %d", len(blk))
+		}
+		for j, ent := range blk {
+			if v, ok := ent.GetEnumeratedValue("index"); !ok || v.(int64) != int64(i*10+j) {
+				t.Fatalf("bad index on %d/%d: %v", i, j, v)
+			}
+		}
+	}
+	if _, err := dec.Decode(); err != io.EOF {
+		t.Fatalf("expected EOF: %v", err)
+	}
+
+	dec = ColumnarCodec{}.NewDecoder(bytes.NewReader(full[:len(full)-3]))
+	var err error
+	for err == nil {
+		_, err = dec.Decode()
+	}
+	if err == io.EOF {
+		t.Fatal("truncated block decoded")
+	}
+}
+
+func TestTypedCacheColumnar(t *testing.T) {
+	dir := t.TempDir()
+	c, err := NewTypedChanCacher[[]*entry.Entry](2, dir, 0, ColumnarCodec{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		blk := []*entry.Entry{makeTestEntry(i * 2), makeTestEntry(i*2 + 1)}
+		select {
+		case c.In <- blk:
+		case <-time.After(DEFAULT_TIMEOUT):
+			t.Fatal("channel write should not block")
+		}
+	}
+	close(c.In)
+	c.Commit()
+	<-c.Out
+
+	if c, err = NewTypedChanCacher[[]*entry.Entry](2, dir, 0, ColumnarCodec{}); err != nil {
+		t.Fatal(err)
+	}
+	results := make(map[int]int)
+	for i := 0; i < 10; i++ {
+		select {
+		case blk := <-c.Out:
+			for _, ent := range blk {
+				idx, ok := ent.GetEnumeratedValue("index")
+				if !ok {
+					t.Fatalf("Didn't get enumerated value index: %+v", ent)
+				}
+				results[int(idx.(int64))]++
+			}
+		case <-time.After(5 * DEFAULT_TIMEOUT):
+			t.Fatalf("channel blocked after %d reads!", i)
+		}
+	}
+	for i := 0; i < 20; i++ {
+		if results[i] != 1 {
+			t.Errorf("mismatched count: %v: %v", i, results[i])
+		}
+	}
+}
+
+func commitTestEntries(t *testing.T, dir string, n int) {
+	t.Helper()
+	c, err := NewTypedChanCacher[*entry.Entry](2, dir, 0, EntryCodec{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < n; i++ {
+		c.In <- makeTestEntry(i)
+	}
+	close(c.In)
+	c.Commit()
+	<-c.Out
+}
+
+func drainTestCache(c *TypedChanCacher[*entry.Entry]) {
+	close(c.In)
+	c.Commit()
+	for range c.Out {
+	}
+}
+
+// cacheFileSizes returns the total size of the cache files and the path of one holding data
+func cacheFileSizes(dir string) (size int64, data string) {
+	for _, p := range cacheFiles(dir) {
+		if fi, err := os.Stat(p); err == nil {
+			size += fi.Size()
+			if fi.Size() > 0 {
+				data = p
+			}
+		}
+	}
+	return
+}
+
+func TestSavedCount(t *testing.T) {
+	dir := t.TempDir()
+	commitTestEntries(t, dir, 50)
+	size, _ := cacheFileSizes(dir)
+	if n, ok := readCount(dir, size); !ok || n != 50 {
+		t.Fatalf("bad saved count %d %v", n, ok)
+	}
+
+	//a saved count that matches the file sizes is trusted without decoding the files
+	writeCount(dir, 1234, size)
+	c, err := NewTypedChanCacher[*entry.Entry](0, dir, 0, EntryCodec{})
+	if err != nil {
+		t.Fatal(err)
+	} else if n := c.Count(); n != 1234 {
+		t.Fatalf("saved count was not used: %d", n)
+	} else if _, err = os.Stat(filepath.Join(dir, countFile)); !os.IsNotExist(err) {
+		t.Fatalf("saved count was not removed after it was loaded: %v", err)
+	}
+	drainTestCache(c)
+
+	//files that changed since the count was saved are decoded, and a corrupt tail is reported
+	dir = t.TempDir()
+	commitTestEntries(t, dir, 10)
+	_, data := cacheFileSizes(dir)
+	f, err := os.OpenFile(data, os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write([]byte{0xff, 0xff, 0xff})
+	f.Close()
+	if c, err = NewTypedChanCacher[*entry.Entry](0, dir, 0, EntryCodec{}); err != nil {
+		t.Fatal(err)
+	} else if n := c.Count(); n != 10 {
+		t.Fatalf("bad decoded count %d", n)
+	} else if c.RecoveryError() == nil {
+		t.Fatal("corrupt cache file was not reported")
+	}
+	drainTestCache(c)
+}
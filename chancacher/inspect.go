@@ -0,0 +1,185 @@
+/*************************************************************************
+ * Copyright 2024 Gravwell, Inc. All rights reserved.
+ * Contact: <legal@gravwell.io>
+ *
+ * This software may be modified and distributed under the terms of the
+ * BSD 2-clause license. See the LICENSE file for details.
+ **************************************************************************/
+
+package chancacher
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/gofrs/flock"
+)
+
+// CacheInfo describes the contents of a cache directory.
+type CacheInfo[T any] struct {
+	Count  int   // items waiting to be replayed
+	Bytes  int64 // bytes on disk across both cache files
+	Oldest T     // oldest item, or the first item replayed if no ordering is given
+	Newest T     // newest item, or the last item replayed if no ordering is given
+}
+
+// cacheFiles returns the cache files in the order they are replayed
+func cacheFiles(cachePath string) []string {
+	return []string{filepath.Join(cachePath, "cache_a"), filepath.Join(cachePath, "cache_b")}
+}
+
+// lockCache takes the cache lock so offline tools cannot modify a cache in use
+func lockCache(cachePath string) (l *flock.Flock, err error) {
+	var locked bool
+	if fi, err := os.Stat(cachePath); err != nil {
+		return nil, err
+	} else if !fi.IsDir() {
+		return nil, ErrInvalidCachePath
+	}
+	l = flock.New(filepath.Join(cachePath, "lock"))
+	if locked, err = l.TryLock(); err != nil {
+		return nil, err
+	} else if !locked {
+		return nil, ErrCacheLocked
+	}
+	return
+}
+
+// Walk calls fn on every item in a cache directory in replay order. The
+// cache must not be in use, walking stops on the first error.
+func Walk[T any](cachePath string, codec Codec[T], fn func(T) error) (err error) {
+	var l *flock.Flock
+	if l, err = lockCache(cachePath); err != nil {
+		return
+	}
+	defer l.Unlock()
+	return walkCache(cachePath, codec, fn)
+}
+
+func walkCache[T any](cachePath string, codec Codec[T], fn func(T) error) (err error) {
+	for _, p := range cacheFiles(cachePath) {
+		var f *os.File
+		if f, err = os.Open(p); err != nil {
+			if os.IsNotExist(err) {
+				err = nil
+				continue
+			}
+			return
+		}
+		err = walkFile(f, codec, func(v T) error {
+			if isNil(v) {
+				return nil
+			}
+			return fn(v)
+		})
+		f.Close()
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+// Inspect counts the items in a cache directory that is not in use. If older is
+// provided it is used to find the oldest and newest items, otherwise they are the
+// first and last items that would be replayed.
+func Inspect[T any](cachePath string, codec Codec[T], older func(a, b T) bool) (ci CacheInfo[T], err error) {
+	for _, p := range cacheFiles(cachePath) {
+		if fi, lerr := os.Stat(p); lerr == nil {
+			ci.Bytes += fi.Size()
+		}
+	}
+	err = Walk(cachePath, codec, func(v T) error {
+		if ci.Count == 0 {
+			ci.Oldest, ci.Newest = v, v
+		} else if older == nil {
+			ci.Newest = v
+		} else if older(v, ci.Oldest) {
+			ci.Oldest = v
+		} else if older(ci.Newest, v) {
+			ci.Newest = v
+		}
+		ci.Count++
+		return nil
+	})
+	return
+}
+
+// Rewrite filters the items in a cache directory that is not in use, each item is replaced
+// by the value filter returns and dropped if it returns false.  Additional items are appended
+// after the kept items. The result is left in a single cache file, ready to be replayed.
+func Rewrite[T any](cachePath string, codec Codec[T], filter func(T) (T, bool), add []T) (kept, dropped int, err error) {
+	var l *flock.Flock
+	var t *os.File
+	var fi os.FileInfo
+	var added int
+	if l, err = lockCache(cachePath); err != nil {
+		return
+	}
+	defer l.Unlock()
+	if t, err = ioutil.TempFile(cachePath, "merge"); err != nil {
+		return
+	}
+	defer os.Remove(t.Name())
+	enc := codec.NewEncoder(t)
+	if err = walkCache(cachePath, codec, func(v T) error {
+		if filter != nil {
+			var ok bool
+			if v, ok = filter(v); !ok || isNil(v) {
+				dropped++
+				return nil
+			}
+		}
+		kept++
+		return enc.Encode(v)
+	}); err != nil {
+		t.Close()
+		return
+	}
+	for _, v := range add {
+		if isNil(v) {
+			continue
+		} else if err = enc.Encode(v); err != nil {
+			t.Close()
+			return
+		}
+		added++
+	}
+	if err = t.Sync(); err != nil {
+		t.Close()
+		return
+	} else if fi, err = t.Stat(); err != nil {
+		t.Close()
+		return
+	} else if err = t.Close(); err != nil {
+		return
+	}
+	files := cacheFiles(cachePath)
+	if err = os.Rename(t.Name(), files[0]); err != nil {
+		return
+	} else if err = os.Remove(files[1]); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return
+	}
+	writeCount(cachePath, int64(kept+added), fi.Size())
+	err = nil
+	return
+}
+
+// Truncate drops every item in a cache directory that is not in use.
+func Truncate(cachePath string) (err error) {
+	var l *flock.Flock
+	if l, err = lockCache(cachePath); err != nil {
+		return
+	}
+	defer l.Unlock()
+	for _, p := range cacheFiles(cachePath) {
+		if err = os.Truncate(p, 0); err != nil && !os.IsNotExist(err) {
+			return
+		}
+	}
+	writeCount(cachePath, 0, 0)
+	err = nil
+	return
+}
@@ -0,0 +1,106 @@
+/*************************************************************************
+ * Copyright 2024 Gravwell, Inc. All rights reserved.
+ * Contact: <legal@gravwell.io>
+ *
+ * This software may be modified and distributed under the terms of the
+ * BSD 2-clause license. See the LICENSE file for details.
+ **************************************************************************/
+
+package chancacher
+
+import (
+	"testing"
+
+	"github.com/gravwell/gravwell/v3/ingest/entry"
+)
+
+// fillEntryCache commits cnt entries to a cache directory, newest first
+func fillEntryCache(t *testing.T, dir string, cnt int) {
+	t.Helper()
+	c, err := NewTypedChanCacher[*entry.Entry](0, dir, 0, EntryCodec{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := cnt - 1; i >= 0; i-- {
+		c.In <- makeTestEntry(i)
+	}
+	close(c.In)
+	c.Commit()
+	<-c.Out
+}
+
+func entryOlder(a, b *entry.Entry) bool {
+	return a.TS.Before(b.TS)
+}
+
+func TestInspect(t *testing.T) {
+	dir := t.TempDir()
+	fillEntryCache(t, dir, 50)
+
+	ci, err := Inspect[*entry.Entry](dir, EntryCodec{}, entryOlder)
+	if err != nil {
+		t.Fatal(err)
+	} else if ci.Count != 50 || ci.Bytes == 0 {
+		t.Fatalf("bad cache info %d %d", ci.Count, ci.Bytes)
+	} else if string(ci.Oldest.Data) != `0` || string(ci.Newest.Data) != `49` {
+		t.Fatalf("bad oldest/newest %s %s", ci.Oldest.Data, ci.Newest.Data)
+	}
+	//without an ordering oldest and newest follow replay order
+	if ci, err = Inspect[*entry.Entry](dir, EntryCodec{}, nil); err != nil {
+		t.Fatal(err)
+	} else if string(ci.Oldest.Data) != `49` || string(ci.Newest.Data) != `0` {
+		t.Fatalf("bad first/last %s %s", ci.Oldest.Data, ci.Newest.Data)
+	}
+
+	//a live cache cannot be inspected
+	c, err := NewTypedChanCacher[*entry.Entry](0, dir, 0, EntryCodec{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = Inspect[*entry.Entry](dir, EntryCodec{}, nil); err != ErrCacheLocked {
+		t.Fatalf("locked cache inspected: %v", err)
+	}
+	close(c.In)
+	c.Commit()
+	<-c.Out
+}
+
+func TestRewriteTruncate(t *testing.T) {
+	dir := t.TempDir()
+	fillEntryCache(t, dir, 50)
+
+	cutoff := makeTestEntry(20).TS
+	kept, dropped, err := Rewrite[*entry.Entry](dir, EntryCodec{}, func(ent *entry.Entry) (*entry.Entry, bool) {
+		return ent, !ent.TS.Before(cutoff)
+	}, []*entry.Entry{makeTestEntry(100), nil})
+	if err != nil {
+		t.Fatal(err)
+	} else if kept != 30 || dropped != 20 {
+		t.Fatalf("bad rewrite %d %d", kept, dropped)
+	}
+	ci, err := Inspect[*entry.Entry](dir, EntryCodec{}, entryOlder)
+	if err != nil {
+		t.Fatal(err)
+	} else if ci.Count != 31 || string(ci.Oldest.Data) != `20` || string(ci.Newest.Data) != `100` {
+		t.Fatalf("bad rewritten cache %d %s %s", ci.Count, ci.Oldest.Data, ci.Newest.Data)
+	}
+
+	//the rewritten cache replays normally
+	c, err := NewTypedChanCacher[*entry.Entry](0, dir, 0, EntryCodec{})
+	if err != nil {
+		t.Fatal(err)
+	} else if c.Count() != 31 {
+		t.Fatalf("bad replay count %d", c.Count())
+	}
+	close(c.In)
+	c.Commit()
+	<-c.Out
+
+	if err = Truncate(dir); err != nil {
+		t.Fatal(err)
+	} else if ci, err = Inspect[*entry.Entry](dir, EntryCodec{}, nil); err != nil {
+		t.Fatal(err)
+	} else if ci.Count != 0 || ci.Bytes != 0 {
+		t.Fatalf("cache not truncated %d %d", ci.Count, ci.Bytes)
+	}
+}
@@ -52,6 +52,7 @@ type BuilderConfig struct {
 	MaxVersion   types.CanonicalVersion
 	Dependencies []types.KitDependency
 	ConfigMacros []types.KitConfigMacro
+	Changelog    []ChangelogEntry
 }
 
 // NewBuilder creates a new Builder object. It takes a kit configuration (BuilderConfig)
@@ -70,6 +71,7 @@ func NewBuilder(cfg BuilderConfig, fout io.WriteCloser) (pb *Builder, err error)
 		MaxVersion:   cfg.MaxVersion,
 		Dependencies: cfg.Dependencies,
 		ConfigMacros: cfg.ConfigMacros,
+		Changelog:    cfg.Changelog,
 	}
 	return &Builder{
 		fout:     fout,
@@ -144,14 +146,17 @@ func (pb *Builder) Close() (err error) {
 func (pb *Builder) WriteManifest(sig []byte) (err error) {
 	//encode the manifest as JSON with tab indention
 	var bts []byte
+	if bts, err = pb.manifest.Marshal(); err != nil {
+		return
+	}
+	return pb.writeManifest(bts, sig)
+}
+
+func (pb *Builder) writeManifest(bts, sig []byte) (err error) {
 	hdr := tar.Header{
 		Typeflag: tar.TypeReg,
 		Mode:     0660,
 	}
-
-	if bts, err = pb.manifest.Marshal(); err != nil {
-		return
-	}
 	if sig != nil && len(sig) > 0 {
 		hdr.Name = ManifestSigName
 		hdr.Size = int64(len(sig))
@@ -18,6 +18,7 @@ import (
 	"fmt"
 	"io"
 	"strings"
+	"time"
 
 	"github.com/gravwell/gravwell/v3/client/types"
 
@@ -102,6 +103,16 @@ type Manifest struct {
 	Items        []Item
 	Dependencies []types.KitDependency
 	ConfigMacros []types.KitConfigMacro
+	Changelog    []ChangelogEntry `json:",omitempty"`
+}
+
+// ChangelogEntry records the items which changed in a version of the kit.
+type ChangelogEntry struct {
+	Version  uint
+	Date     time.Time
+	Added    []string `json:",omitempty"`
+	Removed  []string `json:",omitempty"`
+	Modified []string `json:",omitempty"`
 }
 
 // Item describes a single object within the kit. Note that it does not contain the actual body
@@ -0,0 +1,208 @@
+/*************************************************************************
+ * Copyright 2024 Gravwell, Inc. All rights reserved.
+ * Contact: <legal@gravwell.io>
+ *
+ * This software may be modified and distributed under the terms of the
+ * BSD 2-clause license. See the LICENSE file for details.
+ **************************************************************************/
+
+package kits
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	KeyTypeEd25519 = `ed25519`
+	KeyTypeRSA     = `rsa`
+
+	rsaKeyBits = 3072
+
+	privateKeyPEMType = `PRIVATE KEY`
+	publicKeyPEMType  = `PUBLIC KEY`
+)
+
+var (
+	ErrUnsupportedKey = errors.New("Unsupported signing key, keys must be Ed25519 or RSA")
+	ErrNoTrustedKeys  = errors.New("No trusted public keys")
+)
+
+// GenerateSigningKey creates a new kit signing key of the given type (ed25519 or rsa)
+// and returns the PKCS#8 private key and PKIX public key, both PEM encoded.
+func GenerateSigningKey(keyType string) (priv, pub []byte, err error) {
+	var key crypto.Signer
+	switch strings.ToLower(keyType) {
+	case KeyTypeEd25519, ``:
+		_, key, err = ed25519.GenerateKey(rand.Reader)
+	case KeyTypeRSA:
+		key, err = rsa.GenerateKey(rand.Reader, rsaKeyBits)
+	default:
+		err = fmt.Errorf("%w - unknown key type %q", ErrUnsupportedKey, keyType)
+	}
+	if err != nil {
+		return
+	}
+	var pkcs8, pkix []byte
+	if pkcs8, err = x509.MarshalPKCS8PrivateKey(key); err != nil {
+		return
+	} else if pkix, err = x509.MarshalPKIXPublicKey(key.Public()); err != nil {
+		return
+	}
+	priv = pem.EncodeToMemory(&pem.Block{Type: privateKeyPEMType, Bytes: pkcs8})
+	pub = pem.EncodeToMemory(&pem.Block{Type: publicKeyPEMType, Bytes: pkix})
+	return
+}
+
+// ParseSigningKey decodes a PEM encoded Ed25519 or RSA private key.
+func ParseSigningKey(b []byte) (key crypto.Signer, err error) {
+	blk, _ := pem.Decode(b)
+	if blk == nil {
+		return nil, errors.New("No PEM encoded private key found")
+	}
+	var k interface{}
+	switch blk.Type {
+	case privateKeyPEMType:
+		k, err = x509.ParsePKCS8PrivateKey(blk.Bytes)
+	case `RSA PRIVATE KEY`:
+		k, err = x509.ParsePKCS1PrivateKey(blk.Bytes)
+	default:
+		err = fmt.Errorf("%w - unexpected PEM block %q", ErrUnsupportedKey, blk.Type)
+	}
+	if err != nil {
+		return
+	}
+	switch x := k.(type) {
+	case ed25519.PrivateKey:
+		key = x
+	case *rsa.PrivateKey:
+		key = x
+	default:
+		err = ErrUnsupportedKey
+	}
+	return
+}
+
+// ParsePublicKey decodes a PEM encoded Ed25519 or RSA public key.
+func ParsePublicKey(b []byte) (key crypto.PublicKey, err error) {
+	blk, _ := pem.Decode(b)
+	if blk == nil {
+		return nil, errors.New("No PEM encoded public key found")
+	}
+	switch blk.Type {
+	case publicKeyPEMType:
+		key, err = x509.ParsePKIXPublicKey(blk.Bytes)
+	case `RSA PUBLIC KEY`:
+		key, err = x509.ParsePKCS1PublicKey(blk.Bytes)
+	default:
+		err = fmt.Errorf("%w - unexpected PEM block %q", ErrUnsupportedKey, blk.Type)
+	}
+	if err != nil {
+		return
+	}
+	switch key.(type) {
+	case ed25519.PublicKey, *rsa.PublicKey:
+	default:
+		key, err = nil, ErrUnsupportedKey
+	}
+	return
+}
+
+// LoadTrustStore reads every PEM encoded public key in a directory, files that do
+// not hold a public key are skipped.
+func LoadTrustStore(dir string) (keys []crypto.PublicKey, err error) {
+	var ents []os.DirEntry
+	if ents, err = os.ReadDir(dir); err != nil {
+		return
+	}
+	for _, ent := range ents {
+		if ent.IsDir() {
+			continue
+		}
+		var b []byte
+		if b, err = os.ReadFile(filepath.Join(dir, ent.Name())); err != nil {
+			return
+		}
+		if key, lerr := ParsePublicKey(b); lerr == nil {
+			keys = append(keys, key)
+		}
+	}
+	if len(keys) == 0 {
+		err = fmt.Errorf("%w in %q", ErrNoTrustedKeys, dir)
+	}
+	return
+}
+
+// SignManifest signs an encoded manifest. Ed25519 keys sign the manifest directly,
+// RSA keys sign its SHA-256 digest with PKCS#1 v1.5.
+func SignManifest(manifest []byte, key crypto.Signer) ([]byte, error) {
+	switch key.(type) {
+	case ed25519.PrivateKey:
+		return key.Sign(rand.Reader, manifest, crypto.Hash(0))
+	case *rsa.PrivateKey:
+		h := sha256.Sum256(manifest)
+		return key.Sign(rand.Reader, h[:], crypto.SHA256)
+	}
+	return nil, ErrUnsupportedKey
+}
+
+// VerifyManifest checks a manifest signature against a single public key.
+func VerifyManifest(manifest, sig []byte, key crypto.PublicKey) error {
+	if len(sig) == 0 {
+		return ErrMissingSignature
+	}
+	switch k := key.(type) {
+	case ed25519.PublicKey:
+		if !ed25519.Verify(k, manifest, sig) {
+			return ErrInvalidSignature
+		}
+		return nil
+	case *rsa.PublicKey:
+		h := sha256.Sum256(manifest)
+		if rsa.VerifyPKCS1v15(k, crypto.SHA256, h[:], sig) != nil {
+			return ErrInvalidSignature
+		}
+		return nil
+	}
+	return ErrUnsupportedKey
+}
+
+// NewSigVerifier returns a SigVerificationFunc that accepts a manifest signed by any
+// of the given public keys. Unsigned kits fail with ErrMissingSignature.
+func NewSigVerifier(keys ...crypto.PublicKey) SigVerificationFunc {
+	return func(manifest, sig []byte) error {
+		if len(keys) == 0 {
+			return ErrNoTrustedKeys
+		} else if len(sig) == 0 {
+			return ErrMissingSignature
+		}
+		for _, k := range keys {
+			if VerifyManifest(manifest, sig, k) == nil {
+				return nil
+			}
+		}
+		return fmt.Errorf("%w: signature does not match any of the %d trusted keys", ErrInvalidSignature, len(keys))
+	}
+}
+
+// WriteSignedManifest encodes the manifest, signs it with key, and writes both to
+// the archive. Like WriteManifest it should be the last thing called before Close.
+func (pb *Builder) WriteSignedManifest(key crypto.Signer) (err error) {
+	var bts, sig []byte
+	if bts, err = pb.manifest.Marshal(); err != nil {
+		return
+	} else if sig, err = SignManifest(bts, key); err != nil {
+		return
+	}
+	return pb.writeManifest(bts, sig)
+}
@@ -0,0 +1,132 @@
+/*************************************************************************
+ * Copyright 2024 Gravwell, Inc. All rights reserved.
+ * Contact: <legal@gravwell.io>
+ *
+ * This software may be modified and distributed under the terms of the
+ * BSD 2-clause license. See the LICENSE file for details.
+ **************************************************************************/
+
+package kits
+
+import (
+	"crypto"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gravwell/gravwell/v3/ingesters/utils"
+)
+
+func genKeys(t *testing.T, tp string) (crypto.Signer, crypto.PublicKey, []byte) {
+	t.Helper()
+	priv, pub, err := GenerateSigningKey(tp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sk, err := ParseSigningKey(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pk, err := ParsePublicKey(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sk, pk, pub
+}
+
+func TestSignManifest(t *testing.T) {
+	m := []byte(`{"ID":"io.gravwell.test"}`)
+	for _, tp := range []string{KeyTypeEd25519, KeyTypeRSA} {
+		sk, pk, _ := genKeys(t, tp)
+		_, other, _ := genKeys(t, tp)
+		sig, err := SignManifest(m, sk)
+		if err != nil {
+			t.Fatal(tp, err)
+		}
+		if err = VerifyManifest(m, sig, pk); err != nil {
+			t.Fatal(tp, err)
+		}
+		if err = VerifyManifest(append(m, ' '), sig, pk); !errors.Is(err, ErrInvalidSignature) {
+			t.Fatal(tp, "modified manifest passed verification", err)
+		}
+		if err = NewSigVerifier(other)(m, sig); !errors.Is(err, ErrInvalidSignature) {
+			t.Fatal(tp, "untrusted key passed verification", err)
+		}
+		if err = NewSigVerifier(other, pk)(m, sig); err != nil {
+			t.Fatal(tp, err)
+		}
+		if err = NewSigVerifier(pk)(m, nil); !errors.Is(err, ErrMissingSignature) {
+			t.Fatal(tp, "missing signature passed verification", err)
+		}
+	}
+	if _, _, err := GenerateSigningKey(`dsa`); !errors.Is(err, ErrUnsupportedKey) {
+		t.Fatal("bad key type accepted", err)
+	}
+}
+
+func TestBuilderSignedManifest(t *testing.T) {
+	sk, _, pub := genKeys(t, KeyTypeEd25519)
+	ts := t.TempDir()
+	if err := ioutil.WriteFile(filepath.Join(ts, `test.pub`), pub, 0644); err != nil {
+		t.Fatal(err)
+	} else if err = ioutil.WriteFile(filepath.Join(ts, `README`), []byte(`not a key`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	keys, err := LoadTrustStore(ts)
+	if err != nil {
+		t.Fatal(err)
+	} else if len(keys) != 1 {
+		t.Fatalf("bad trust store key count %d", len(keys))
+	}
+
+	tf, err := ioutil.TempFile(t.TempDir(), `kit`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pb, err := NewBuilder(defCfg, tf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = pb.Add(`test1`, Resource, []byte(`hello`)); err != nil {
+		pb.Abort()
+		t.Fatal(err)
+	}
+	if err = pb.WriteSignedManifest(sk); err != nil {
+		pb.Abort()
+		t.Fatal(err)
+	}
+	if err = pb.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	fin, err := utils.OpenFileReader(tf.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fin.Close()
+	pr, err := NewReader(fin, NewSigVerifier(keys...))
+	if err != nil {
+		t.Fatal(err)
+	} else if err = pr.Verify(); err != nil {
+		t.Fatal(err)
+	}
+	if signed, err := pr.Signed(); err != nil || !signed {
+		t.Fatal("kit failed signature verification", signed, err)
+	}
+
+	//a kit signed by an unknown key is not trusted
+	_, other, _ := genKeys(t, KeyTypeEd25519)
+	if pr, err = NewReader(fin, NewSigVerifier(other)); err != nil {
+		t.Fatal(err)
+	} else if err = pr.Verify(); err != nil {
+		t.Fatal(err)
+	}
+	if signed, err := pr.Signed(); err == nil || signed {
+		t.Fatal("untrusted kit passed signature verification")
+	}
+	if _, err = LoadTrustStore(filepath.Join(ts, `missing`)); !os.IsNotExist(err) {
+		t.Fatal("missing trust store did not fail", err)
+	}
+}
@@ -68,6 +68,10 @@ type LogHandlerConfig struct {
 	TimeFormat              config.CustomTimeFormat
 	AttachFilename          bool
 	Trim                    bool // run trim space on entries
+	MaxFutureSkew           time.Duration
+	MaxPastAge              time.Duration
+	SkewPolicy              string           // see timegrinder.SkewPolicy, flagged entries get a timestamp_skew value
+	Pool                    *entry.EntryPool // optional, lines are copied into pooled entries
 }
 
 type logWriter interface {
@@ -86,6 +90,9 @@ func NewLogHandler(cfg LogHandlerConfig, w logWriter) (*LogHandler, error) {
 	if !cfg.IgnoreTS {
 		tcfg := timegrinder.Config{
 			EnableLeftMostSeed: true,
+			MaxFutureSkew:      cfg.MaxFutureSkew,
+			MaxPastAge:         cfg.MaxPastAge,
+			SkewPolicy:         timegrinder.SkewPolicy(cfg.SkewPolicy),
 		}
 		if tg, err = timegrinder.NewTimeGrinder(tcfg); err != nil {
 			return nil, err
@@ -149,6 +156,7 @@ func (lh *LogHandler) HandleLog(b []byte, catchts time.Time, fname string) error
 	}
 	var ok bool
 	var ts time.Time
+	var skew timegrinder.Skew
 	var err error
 
 	if lh.Trim {
@@ -165,7 +173,7 @@ func (lh *LogHandler) HandleLog(b []byte, catchts time.Time, fname string) error
 	}
 
 	if !lh.IgnoreTS {
-		ts, ok, err = lh.tg.Extract(b)
+		ts, ok, skew, err = lh.tg.ExtractSkew(b)
 		if err != nil {
 			lh.Logger.Error("catastrophic timegrinder failure", log.KVErr(err))
 			return err
@@ -177,17 +185,27 @@ func (lh *LogHandler) HandleLog(b []byte, catchts time.Time, fname string) error
 	if lh.Debugger != nil {
 		lh.Debugger("GOT %s %s\n", ts.Format(time.RFC3339), string(b))
 	}
-	ent := &entry.Entry{
-		SRC:  lh.Src,
-		TS:   entry.FromStandard(ts),
-		Tag:  lh.LogHandlerConfig.Tag,
-		Data: b,
+	var ent *entry.Entry
+	if lh.Pool != nil {
+		ent = lh.Pool.GetData(len(b))
+		copy(ent.Data, b)
+	} else {
+		ent = &entry.Entry{Data: b}
 	}
+	ent.SRC = lh.Src
+	ent.TS = entry.FromStandard(ts)
+	ent.Tag = lh.LogHandlerConfig.Tag
 	if lh.AttachFilename {
 		ent.AddEnumeratedValue(entry.EnumeratedValue{
 			Name:  evFilenameName,
 			Value: entry.StringEnumDataTail(fname),
 		})
 	}
+	if ok && skew != timegrinder.SkewNone {
+		ent.AddEnumeratedValue(entry.EnumeratedValue{
+			Name:  timegrinder.SkewFlagName,
+			Value: entry.StringEnumData(skew.String()),
+		})
+	}
 	return lh.w.ProcessContext(ent, lh.LogHandlerConfig.Ctx)
 }
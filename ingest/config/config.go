@@ -130,6 +130,7 @@ type TimeFormat struct {
 	Format           string
 	Regex            string
 	Extraction_Regex string
+	Locale           string
 }
 
 type CustomTimeFormat map[string]*TimeFormat
@@ -484,6 +485,7 @@ func (ctf CustomTimeFormat) Validate() (err error) {
 			Format:           v.Format,
 			Regex:            v.Regex,
 			Extraction_Regex: v.Extraction_Regex,
+			Locale:           v.Locale,
 		}
 		if err = cf.Validate(); err != nil {
 			return
@@ -508,6 +510,7 @@ func (ctf CustomTimeFormat) LoadFormats(tg *timegrinder.TimeGrinder) (err error)
 			Format:           v.Format,
 			Regex:            v.Regex,
 			Extraction_Regex: v.Extraction_Regex,
+			Locale:           v.Locale,
 		}
 		if p, err = timegrinder.NewCustomProcessor(cf); err != nil {
 			return
@@ -0,0 +1,399 @@
+/*************************************************************************
+ * Copyright 2024 Gravwell, Inc. All rights reserved.
+ * Contact: <legal@gravwell.io>
+ *
+ * This software may be modified and distributed under the terms of the
+ * BSD 2-clause license. See the LICENSE file for details.
+ **************************************************************************/
+
+package entry
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"math"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// CanonicalVersion is the version of the canonical JSON and CBOR entry schema.
+// Decoders reject documents carrying any other version.
+const CanonicalVersion = 1
+
+const (
+	canonicalBase64 = `base64`
+)
+
+var (
+	ErrCanonicalVersion      = errors.New("unsupported canonical entry version")
+	ErrInvalidCanonicalEntry = errors.New("invalid canonical entry")
+	ErrInvalidCanonicalValue = errors.New("invalid canonical enumerated value")
+)
+
+// evTypeNames are the stable type names used by the canonical schema, they are
+// indexed by the enumerated data type ID and must never be changed.
+var evTypeNames = [...]string{
+	typeByteSlice: `bytes`,
+	typeBool:      `bool`,
+	typeByte:      `byte`,
+	typeInt8:      `int8`,
+	typeInt16:     `int16`,
+	typeUint16:    `uint16`,
+	typeInt32:     `int32`,
+	typeUint32:    `uint32`,
+	typeInt64:     `int64`,
+	typeUint64:    `uint64`,
+	typeFloat32:   `float32`,
+	typeFloat64:   `float64`,
+	typeUnicode:   `string`,
+	typeMAC:       `mac`,
+	typeIP:        `ip`,
+	typeTS:        `timestamp`,
+	typeDuration:  `duration`,
+}
+
+// TypeName returns the canonical name of the enumerated data type, an empty string is returned for unknown types.
+func (ev EnumeratedData) TypeName() string {
+	if int(ev.evtype) < len(evTypeNames) {
+		return evTypeNames[ev.evtype]
+	}
+	return ``
+}
+
+func evTypeFromName(name string) (uint8, bool) {
+	for i, v := range evTypeNames {
+		if v != `` && v == name {
+			return uint8(i), true
+		}
+	}
+	return 0, false
+}
+
+type canonicalEntry struct {
+	Version int               `json:"v"`
+	TS      Timestamp         `json:"ts"`
+	Tag     EntryTag          `json:"tag"`
+	TagName string            `json:"tag_name,omitempty"`
+	SRC     string            `json:"src,omitempty"`
+	Data    []byte            `json:"data"`
+	EVs     []EnumeratedValue `json:"evs,omitempty"`
+}
+
+type canonicalEV struct {
+	Name  string          `json:"name"`
+	Type  string          `json:"type"`
+	Value json.RawMessage `json:"value"`
+	Enc   string          `json:"enc,omitempty"`
+}
+
+// MarshalCanonicalJSON encodes the entry using the versioned canonical JSON schema.
+// Enumerated values carry their type so the entry can be decoded with no loss.
+func (ent *Entry) MarshalCanonicalJSON() ([]byte, error) {
+	return ent.MarshalCanonicalJSONTag(``)
+}
+
+// MarshalCanonicalJSONTag encodes the entry using the canonical JSON schema and includes
+// the tag name in the optional "tag_name" field.  Tag IDs are only meaningful to the
+// ingester that negotiated them, anything leaving the ingester should carry the name.
+func (ent *Entry) MarshalCanonicalJSONTag(tagName string) ([]byte, error) {
+	ce := canonicalEntry{
+		Version: CanonicalVersion,
+		TS:      ent.TS,
+		Tag:     ent.Tag,
+		TagName: tagName,
+		Data:    ent.Data,
+		EVs:     ent.EVB.Values(),
+	}
+	if len(ent.SRC) > 0 {
+		var err error
+		if ce.SRC, err = canonicalIP(ent.SRC); err != nil {
+			return nil, err
+		}
+	}
+	return json.Marshal(ce)
+}
+
+// UnmarshalCanonicalJSON decodes an entry produced by MarshalCanonicalJSON, the entry is completely overwritten.
+func (ent *Entry) UnmarshalCanonicalJSON(b []byte) (err error) {
+	_, err = ent.UnmarshalCanonicalJSONTag(b)
+	return
+}
+
+// UnmarshalCanonicalJSONTag decodes a canonical JSON entry and returns the tag name if the
+// document carries one, the entry is completely overwritten.
+func (ent *Entry) UnmarshalCanonicalJSONTag(b []byte) (tagName string, err error) {
+	var ce canonicalEntry
+	if err = json.Unmarshal(b, &ce); err != nil {
+		return
+	} else if ce.Version != CanonicalVersion {
+		err = ErrCanonicalVersion
+		return
+	} else if len(ce.Data) > int(MaxDataSize) || len(ce.EVs) > MaxEvBlockCount {
+		err = ErrInvalidCanonicalEntry
+		return
+	}
+	nent := Entry{
+		TS:   ce.TS,
+		Tag:  ce.Tag,
+		Data: ce.Data,
+	}
+	if ce.SRC != `` {
+		if nent.SRC, err = parseCanonicalIP(ce.SRC); err != nil {
+			return
+		}
+	}
+	if err = nent.AddEnumeratedValues(ce.EVs); err != nil {
+		return
+	}
+	*ent = nent
+	tagName = ce.TagName
+	return
+}
+
+// MarshalJSON encodes the enumerated value as a typed canonical JSON object.
+func (ev EnumeratedValue) MarshalJSON() ([]byte, error) {
+	if !ev.Valid() {
+		return nil, ErrInvalid
+	}
+	cev := canonicalEV{
+		Name: ev.Name,
+		Type: ev.Value.TypeName(),
+	}
+	var err error
+	if cev.Value, cev.Enc, err = ev.Value.jsonValue(); err != nil {
+		return nil, err
+	}
+	return json.Marshal(cev)
+}
+
+// UnmarshalJSON decodes a typed canonical JSON object into the enumerated value.
+func (ev *EnumeratedValue) UnmarshalJSON(b []byte) (err error) {
+	var cev canonicalEV
+	var ed EnumeratedData
+	if err = json.Unmarshal(b, &cev); err != nil {
+		return
+	} else if l := len(cev.Name); l == 0 || l > MaxEvNameLength {
+		return ErrInvalidName
+	} else if ed, err = enumeratedDataFromJSON(cev.Type, cev.Value, cev.Enc); err != nil {
+		return
+	}
+	ev.Name = cev.Name
+	ev.Value = ed
+	return
+}
+
+func (ev EnumeratedData) jsonValue() (v []byte, enc string, err error) {
+	switch ev.evtype {
+	case typeBool, typeByte, typeInt8, typeInt16, typeUint16, typeInt32, typeUint32, typeInt64, typeUint64:
+		//the stringer emits exact decimal values for all integer widths
+		v = []byte(ev.String())
+	case typeDuration:
+		v = strconv.AppendInt(nil, int64(binary.LittleEndian.Uint64(ev.data)), 10)
+	case typeFloat32:
+		v = jsonFloat(float64(math.Float32frombits(binary.LittleEndian.Uint32(ev.data))), 32)
+	case typeFloat64:
+		v = jsonFloat(math.Float64frombits(binary.LittleEndian.Uint64(ev.data)), 64)
+	case typeUnicode:
+		if utf8.Valid(ev.data) {
+			v, err = json.Marshal(string(ev.data))
+		} else {
+			//JSON strings cannot carry invalid UTF-8 without mangling it
+			enc = canonicalBase64
+			v, err = json.Marshal(ev.data)
+		}
+	case typeByteSlice:
+		v, err = json.Marshal(ev.data)
+	case typeMAC:
+		v, err = json.Marshal(net.HardwareAddr(ev.data).String())
+	case typeIP:
+		var s string
+		if s, err = canonicalIP(ev.data); err == nil {
+			v, err = json.Marshal(s)
+		}
+	case typeTS:
+		var ts Timestamp
+		ts.Decode(ev.data)
+		v, err = ts.MarshalJSON()
+	default:
+		err = ErrInvalidEnumeratedData
+	}
+	return
+}
+
+func enumeratedDataFromJSON(name string, v json.RawMessage, enc string) (ed EnumeratedData, err error) {
+	evtype, ok := evTypeFromName(name)
+	if !ok {
+		err = ErrUnknownType
+		return
+	} else if enc != `` && (enc != canonicalBase64 || evtype != typeUnicode) {
+		err = ErrInvalidCanonicalValue
+		return
+	}
+	s := string(v)
+	switch evtype {
+	case typeBool:
+		var b bool
+		if err = strictUnmarshal(v, &b); err == nil {
+			ed = BoolEnumData(b)
+		}
+	case typeByte:
+		var x uint64
+		if x, err = strconv.ParseUint(s, 10, 8); err == nil {
+			ed = ByteEnumData(byte(x))
+		}
+	case typeUint16:
+		var x uint64
+		if x, err = strconv.ParseUint(s, 10, 16); err == nil {
+			ed = Uint16EnumData(uint16(x))
+		}
+	case typeUint32:
+		var x uint64
+		if x, err = strconv.ParseUint(s, 10, 32); err == nil {
+			ed = Uint32EnumData(uint32(x))
+		}
+	case typeUint64:
+		var x uint64
+		if x, err = strconv.ParseUint(s, 10, 64); err == nil {
+			ed = Uint64EnumData(x)
+		}
+	case typeInt8:
+		var x int64
+		if x, err = strconv.ParseInt(s, 10, 8); err == nil {
+			ed = Int8EnumData(int8(x))
+		}
+	case typeInt16:
+		var x int64
+		if x, err = strconv.ParseInt(s, 10, 16); err == nil {
+			ed = Int16EnumData(int16(x))
+		}
+	case typeInt32:
+		var x int64
+		if x, err = strconv.ParseInt(s, 10, 32); err == nil {
+			ed = Int32EnumData(int32(x))
+		}
+	case typeInt64:
+		var x int64
+		if x, err = strconv.ParseInt(s, 10, 64); err == nil {
+			ed = Int64EnumData(x)
+		}
+	case typeDuration:
+		var x int64
+		if x, err = strconv.ParseInt(s, 10, 64); err == nil {
+			ed = DurationEnumData(time.Duration(x))
+		}
+	case typeFloat32:
+		var f float64
+		if f, err = parseJSONFloat(v, 32); err == nil {
+			ed = Float32EnumData(float32(f))
+		}
+	case typeFloat64:
+		var f float64
+		if f, err = parseJSONFloat(v, 64); err == nil {
+			ed = Float64EnumData(f)
+		}
+	case typeUnicode:
+		if enc == canonicalBase64 {
+			var b []byte
+			if err = strictUnmarshal(v, &b); err == nil {
+				ed = EnumeratedData{data: b, evtype: typeUnicode}
+			}
+		} else {
+			var str string
+			if err = strictUnmarshal(v, &str); err == nil {
+				ed = StringEnumData(str)
+			}
+		}
+	case typeByteSlice:
+		var b []byte
+		if err = strictUnmarshal(v, &b); err == nil {
+			ed = SliceEnumData(b)
+		}
+	case typeMAC:
+		var str string
+		var b []byte
+		if err = strictUnmarshal(v, &str); err == nil {
+			if b, err = hex.DecodeString(strings.ReplaceAll(str, `:`, ``)); err == nil {
+				ed = MACEnumData(b)
+			}
+		}
+	case typeIP:
+		var str string
+		var ip net.IP
+		if err = strictUnmarshal(v, &str); err == nil {
+			if ip, err = parseCanonicalIP(str); err == nil {
+				ed = IPEnumData(ip)
+			}
+		}
+	case typeTS:
+		var ts Timestamp
+		if err = strictUnmarshal(v, &ts); err == nil {
+			ed = TSEnumData(ts)
+		}
+	}
+	if err != nil {
+		err = ErrInvalidCanonicalValue
+	} else if !ed.Valid() {
+		err = ErrInvalidEnumeratedData
+	}
+	return
+}
+
+// strictUnmarshal refuses JSON nulls, which the standard library silently accepts for every type
+func strictUnmarshal(v json.RawMessage, dst interface{}) error {
+	if bytes.Equal(bytes.TrimSpace(v), []byte(`null`)) {
+		return ErrInvalidCanonicalValue
+	}
+	return json.Unmarshal(v, dst)
+}
+
+// jsonFloat encodes floats with the shortest exact representation, values JSON
+// cannot express as numbers are quoted.
+func jsonFloat(f float64, bits int) []byte {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return strconv.AppendQuote(nil, strconv.FormatFloat(f, 'g', -1, bits))
+	}
+	return strconv.AppendFloat(nil, f, 'g', -1, bits)
+}
+
+func parseJSONFloat(v json.RawMessage, bits int) (float64, error) {
+	s := string(v)
+	if len(s) > 0 && s[0] == '"' {
+		var err error
+		if s, err = strconv.Unquote(s); err != nil {
+			return 0, err
+		} else if s != `NaN` && s != `+Inf` && s != `-Inf` {
+			return 0, ErrInvalidCanonicalValue
+		}
+	}
+	return strconv.ParseFloat(s, bits)
+}
+
+// canonicalIP renders an address so that both the 4 and 16 byte forms survive a round trip,
+// IPv4 mapped addresses stored in 16 bytes keep their IPv6 prefix.
+func canonicalIP(ip net.IP) (string, error) {
+	switch len(ip) {
+	case net.IPv4len:
+		return ip.String(), nil
+	case net.IPv6len:
+		if ip4 := ip.To4(); ip4 != nil {
+			return `::ffff:` + ip4.String(), nil
+		}
+		return ip.String(), nil
+	}
+	return ``, ErrInvalidCanonicalValue
+}
+
+func parseCanonicalIP(s string) (ip net.IP, err error) {
+	if ip = net.ParseIP(s); ip == nil {
+		err = ErrInvalidCanonicalValue
+	} else if !strings.Contains(s, `:`) {
+		ip = ip.To4()
+	}
+	return
+}
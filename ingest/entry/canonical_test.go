@@ -0,0 +1,238 @@
+/*************************************************************************
+ * Copyright 2024 Gravwell, Inc. All rights reserved.
+ * Contact: <legal@gravwell.io>
+ *
+ * This software may be modified and distributed under the terms of the
+ * BSD 2-clause license. See the LICENSE file for details.
+ **************************************************************************/
+
+package entry
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"net"
+	"testing"
+	"time"
+)
+
+func canonicalTestEntry(t testing.TB) *Entry {
+	ent := &Entry{
+		TS:   UnixTime(1700000000, 123456789),
+		SRC:  net.ParseIP(`fe80::1`),
+		Tag:  1234,
+		Data: []byte("hello canonical world"),
+	}
+	if err := addAllEvs(ent); err != nil {
+		t.Fatal(err)
+	}
+	evs := []EnumeratedValue{
+		{Name: `nan`, Value: Float64EnumData(math.NaN())},
+		{Name: `inf32`, Value: Float32EnumData(float32(math.Inf(-1)))},
+		{Name: `tiny`, Value: Float32EnumData(math.SmallestNonzeroFloat32)},
+		{Name: `maxu64`, Value: Uint64EnumData(math.MaxUint64)},
+		{Name: `mini64`, Value: Int64EnumData(math.MinInt64)},
+		{Name: `badutf8`, Value: StringEnumData("\xff\xfe bad")},
+		{Name: `mapped`, Value: IPEnumData(net.ParseIP(`10.1.2.3`))},
+		{Name: `ip4`, Value: IPEnumData(net.ParseIP(`10.1.2.3`).To4())},
+		{Name: `emptymac`, Value: MACEnumData(nil)},
+		{Name: `longmac`, Value: MACEnumData(net.HardwareAddr{1, 2, 3, 4, 5, 6, 7, 8, 9, 10})},
+		{Name: `negdur`, Value: DurationEnumData(-1500 * time.Millisecond)},
+		{Name: `emptystr`, Value: StringEnumData(``)},
+	}
+	if err := ent.AddEnumeratedValues(evs); err != nil {
+		t.Fatal(err)
+	}
+	return ent
+}
+
+func compareCanonical(t *testing.T, a, b *Entry) {
+	t.Helper()
+	if err := compareEntry(a, b); err != nil {
+		t.Fatal(err)
+	} else if !bytes.Equal(a.SRC, b.SRC) {
+		t.Fatalf("source changed %v(%d) != %v(%d)", a.SRC, len(a.SRC), b.SRC, len(b.SRC))
+	} else if err = a.EVB.Compare(b.EVB); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCanonicalJSON(t *testing.T) {
+	ent := canonicalTestEntry(t)
+	b, err := ent.MarshalCanonicalJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out Entry
+	if err = out.UnmarshalCanonicalJSON(b); err != nil {
+		t.Fatal(err)
+	}
+	compareCanonical(t, ent, &out)
+
+	//re-encoding the decoded entry must be byte identical
+	b2, err := out.MarshalCanonicalJSON()
+	if err != nil {
+		t.Fatal(err)
+	} else if !bytes.Equal(b, b2) {
+		t.Fatalf("re-encoding changed document:\n%s\n%s", b, b2)
+	}
+
+	//v4 entry sources stay 4 bytes and nil sources are omitted
+	ent = &Entry{TS: UnixTime(1, 0), SRC: net.ParseIP(`192.168.1.1`).To4(), Tag: 2}
+	if b, err = ent.MarshalCanonicalJSON(); err != nil {
+		t.Fatal(err)
+	} else if err = out.UnmarshalCanonicalJSON(b); err != nil {
+		t.Fatal(err)
+	}
+	compareCanonical(t, ent, &out)
+	ent.SRC = nil
+	if b, err = ent.MarshalCanonicalJSON(); err != nil {
+		t.Fatal(err)
+	} else if bytes.Contains(b, []byte(`"src"`)) {
+		t.Fatalf("nil source was encoded: %s", b)
+	}
+}
+
+func TestCanonicalJSONSchema(t *testing.T) {
+	ent := &Entry{
+		TS:   UnixTime(1700000000, 5),
+		SRC:  net.ParseIP(`10.0.0.1`).To4(),
+		Tag:  3,
+		Data: []byte(`hi`),
+	}
+	ent.AddEnumeratedValue(EnumeratedValue{Name: `port`, Value: Uint16EnumData(443)})
+	ent.AddEnumeratedValue(EnumeratedValue{Name: `mac`, Value: MACEnumData(net.HardwareAddr{0xde, 0xad, 0xbe, 0xef, 0, 1})})
+	ent.AddEnumeratedValue(EnumeratedValue{Name: `took`, Value: DurationEnumData(time.Second)})
+	ent.AddEnumeratedValue(EnumeratedValue{Name: `f`, Value: Float32EnumData(0.1)})
+	const want = `{"v":1,"ts":"2023-11-14T22:13:20.000000005Z","tag":3,"src":"10.0.0.1","data":"aGk=","evs":[` +
+		`{"name":"port","type":"uint16","value":443},` +
+		`{"name":"mac","type":"mac","value":"de:ad:be:ef:00:01"},` +
+		`{"name":"took","type":"duration","value":1000000000},` +
+		`{"name":"f","type":"float32","value":0.1}]}`
+	b, err := ent.MarshalCanonicalJSON()
+	if err != nil {
+		t.Fatal(err)
+	} else if string(b) != want {
+		t.Fatalf("schema changed:\n%s\n%s", b, want)
+	}
+}
+
+func TestCanonicalJSONInvalid(t *testing.T) {
+	var ent Entry
+	bad := []string{
+		`{"ts":"2023-11-14T22:13:20Z","tag":1,"data":null}`,
+		`{"v":2,"ts":"2023-11-14T22:13:20Z","tag":1,"data":null}`,
+		`{"v":1,"ts":"2023-11-14T22:13:20Z","tag":1,"src":"not an ip","data":null}`,
+		`{"v":1,"tag":1,"evs":[{"name":"x","type":"int8","value":128}]}`,
+		`{"v":1,"tag":1,"evs":[{"name":"x","type":"uint16","value":-1}]}`,
+		`{"v":1,"tag":1,"evs":[{"name":"x","type":"int64","value":"5"}]}`,
+		`{"v":1,"tag":1,"evs":[{"name":"x","type":"float32","value":"pi"}]}`,
+		`{"v":1,"tag":1,"evs":[{"name":"x","type":"float32","value":1e300}]}`,
+		`{"v":1,"tag":1,"evs":[{"name":"x","type":"bool","value":null}]}`,
+		`{"v":1,"tag":1,"evs":[{"name":"x","type":"complex","value":1}]}`,
+		`{"v":1,"tag":1,"evs":[{"name":"x","type":"bytes","value":"AA==","enc":"base64"}]}`,
+		`{"v":1,"tag":1,"evs":[{"name":"x","type":"mac","value":"de:ad:be"}]}`,
+		`{"v":1,"tag":1,"evs":[{"name":"","type":"bool","value":true}]}`,
+	}
+	for _, v := range bad {
+		if err := ent.UnmarshalCanonicalJSON([]byte(v)); err == nil {
+			t.Fatalf("invalid document decoded: %s", v)
+		}
+	}
+	//invalid EVs cannot be encoded
+	if _, err := json.Marshal(EnumeratedValue{Name: `x`}); err == nil {
+		t.Fatal("invalid EV encoded")
+	}
+}
+
+func TestCanonicalCBOR(t *testing.T) {
+	ent := canonicalTestEntry(t)
+	b, err := ent.MarshalCBOR()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out Entry
+	if err = out.UnmarshalCBOR(b); err != nil {
+		t.Fatal(err)
+	}
+	compareCanonical(t, ent, &out)
+	b2, err := out.MarshalCBOR()
+	if err != nil {
+		t.Fatal(err)
+	} else if !bytes.Equal(b, b2) {
+		t.Fatal("re-encoding changed document")
+	}
+
+	for i := 0; i < len(b); i++ {
+		if err = out.UnmarshalCBOR(b[:i]); err == nil {
+			t.Fatalf("truncated document at %d decoded", i)
+		}
+	}
+	if err = out.UnmarshalCBOR(append(b, 0)); err == nil {
+		t.Fatal("trailing bytes decoded")
+	}
+
+	//{"v": 2}
+	if err = out.UnmarshalCBOR([]byte{0xa1, 0x61, 'v', 0x02}); err != ErrCanonicalVersion {
+		t.Fatalf("bad version did not fail: %v", err)
+	}
+	//{"v": 1} with a non-shortest integer head
+	if err = out.UnmarshalCBOR([]byte{0xa1, 0x61, 'v', 0x18, 0x01}); err == nil {
+		t.Fatal("non-canonical integer decoded")
+	}
+}
+
+func TestCanonicalCBORValues(t *testing.T) {
+	tests := []struct {
+		ev   EnumeratedValue
+		want []byte
+	}{
+		{EnumeratedValue{Name: `a`, Value: BoolEnumData(true)}, []byte{0xf5}},
+		{EnumeratedValue{Name: `a`, Value: Int16EnumData(-500)}, []byte{0x39, 0x01, 0xf3}},
+		{EnumeratedValue{Name: `a`, Value: Uint32EnumData(24)}, []byte{0x18, 0x18}},
+		{EnumeratedValue{Name: `a`, Value: Float64EnumData(1.5)}, []byte{0xfb, 0x3f, 0xf8, 0, 0, 0, 0, 0, 0}},
+		{EnumeratedValue{Name: `a`, Value: IPEnumData(net.IP{1, 2, 3, 4})}, []byte{0x44, 1, 2, 3, 4}},
+		{EnumeratedValue{Name: `a`, Value: TSEnumData(UnixTime(-1, 10))}, []byte{0x82, 0x20, 0x0a}},
+	}
+	prefix := []byte{0xa3, 0x64, 'n', 'a', 'm', 'e', 0x61, 'a', 0x64, 't', 'y', 'p', 'e'}
+	for _, tt := range tests {
+		b, err := tt.ev.MarshalCBOR()
+		if err != nil {
+			t.Fatal(err)
+		}
+		tn := tt.ev.Value.TypeName()
+		want := append(append(append([]byte{}, prefix...), byte(0x60+len(tn))), tn...)
+		want = append(append(want, 0x65, 'v', 'a', 'l', 'u', 'e'), tt.want...)
+		if !bytes.Equal(b, want) {
+			t.Fatalf("bad %s encoding: %x != %x", tn, b, want)
+		}
+		var ev EnumeratedValue
+		if err = ev.UnmarshalCBOR(b); err != nil {
+			t.Fatal(err)
+		} else if err = ev.Compare(tt.ev); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func FuzzCanonicalCBOR(f *testing.F) {
+	b, err := canonicalTestEntry(f).MarshalCBOR()
+	if err != nil {
+		f.Fatal(err)
+	}
+	f.Add(b)
+	f.Fuzz(func(t *testing.T, b []byte) {
+		var ent Entry
+		if err := ent.UnmarshalCBOR(b); err != nil {
+			t.Log(err)
+			return
+		}
+		//anything that decodes must encode back to the same bytes
+		if nb, err := ent.MarshalCBOR(); err != nil {
+			t.Fatal(err)
+		} else if !bytes.Equal(nb, b) {
+			t.Fatalf("non-canonical document decoded: %x", b)
+		}
+	})
+}
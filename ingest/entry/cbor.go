@@ -0,0 +1,458 @@
+/*************************************************************************
+ * Copyright 2024 Gravwell, Inc. All rights reserved.
+ * Contact: <legal@gravwell.io>
+ *
+ * This software may be modified and distributed under the terms of the
+ * BSD 2-clause license. See the LICENSE file for details.
+ **************************************************************************/
+
+package entry
+
+import (
+	"encoding/binary"
+	"math"
+	"net"
+	"time"
+)
+
+// The CBOR form of the canonical schema is a deterministic encoding (RFC 8949 section 4.2):
+// definite lengths, shortest integer heads, and map keys in encoded byte order.
+// Only the subset of CBOR needed by the schema is implemented.
+//
+// Entry:            {"v": 1, "ts": [unix sec, nsec], "evs": [ev...], "src": bytes, "tag": uint, "data": bytes}
+// Enumerated value: {"name": text, "type": text, "value": any}
+//
+// "evs" and "src" are omitted when empty, integer and duration values are CBOR integers,
+// floats keep their declared width, IPs and MACs are byte strings, and timestamps use the [unix sec, nsec] pair.
+// The optional "tag_name" field of the JSON form is not carried in CBOR.
+
+const (
+	cborUint   byte = 0 << 5
+	cborNegInt byte = 1 << 5
+	cborBytes  byte = 2 << 5
+	cborText   byte = 3 << 5
+	cborArray  byte = 4 << 5
+	cborMap    byte = 5 << 5
+	cborSimple byte = 7 << 5
+
+	cborFalse   byte = 0xf4
+	cborTrue    byte = 0xf5
+	cborFloat32 byte = 0xfa
+	cborFloat64 byte = 0xfb
+
+	cborMajorMask byte = 0xe0
+	cborInfoMask  byte = 0x1f
+)
+
+// MarshalCBOR encodes the entry using the versioned canonical CBOR schema.
+func (ent *Entry) MarshalCBOR() (b []byte, err error) {
+	evs := ent.EVB.Values()
+	fields := uint64(4)
+	if len(evs) > 0 {
+		fields++
+	}
+	if len(ent.SRC) > 0 {
+		if l := len(ent.SRC); l != net.IPv4len && l != net.IPv6len {
+			return nil, ErrInvalidCanonicalEntry
+		}
+		fields++
+	}
+	b = make([]byte, 0, 32+len(ent.Data)+int(ent.EVB.Size()))
+	b = cborAppendHead(b, cborMap, fields)
+	b = cborAppendText(b, `v`)
+	b = cborAppendHead(b, cborUint, CanonicalVersion)
+	b = cborAppendText(b, `ts`)
+	b = cborAppendTimestamp(b, ent.TS)
+	if len(evs) > 0 {
+		b = cborAppendText(b, `evs`)
+		b = cborAppendHead(b, cborArray, uint64(len(evs)))
+		for _, ev := range evs {
+			if b, err = ev.appendCBOR(b); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if len(ent.SRC) > 0 {
+		b = cborAppendText(b, `src`)
+		b = cborAppendBytes(b, cborBytes, ent.SRC)
+	}
+	b = cborAppendText(b, `tag`)
+	b = cborAppendHead(b, cborUint, uint64(ent.Tag))
+	b = cborAppendText(b, `data`)
+	b = cborAppendBytes(b, cborBytes, ent.Data)
+	return
+}
+
+// UnmarshalCBOR decodes an entry produced by MarshalCBOR, the entry is completely overwritten.
+// The entry data and enumerated values reference the provided buffer.
+func (ent *Entry) UnmarshalCBOR(b []byte) error {
+	r := cborReader{b: b}
+	nent, err := r.entry()
+	if err != nil {
+		return err
+	} else if len(r.b) != 0 {
+		return ErrInvalidCanonicalEntry
+	}
+	*ent = nent
+	return nil
+}
+
+// MarshalCBOR encodes the enumerated value as a typed canonical CBOR map.
+func (ev EnumeratedValue) MarshalCBOR() ([]byte, error) {
+	return ev.appendCBOR(nil)
+}
+
+// UnmarshalCBOR decodes a typed canonical CBOR map into the enumerated value.
+func (ev *EnumeratedValue) UnmarshalCBOR(b []byte) error {
+	r := cborReader{b: b}
+	nev, err := r.ev()
+	if err != nil {
+		return err
+	} else if len(r.b) != 0 {
+		return ErrInvalidCanonicalValue
+	}
+	*ev = nev
+	return nil
+}
+
+func (ev EnumeratedValue) appendCBOR(b []byte) ([]byte, error) {
+	if !ev.Valid() {
+		return nil, ErrInvalid
+	}
+	b = cborAppendHead(b, cborMap, 3)
+	b = cborAppendText(b, `name`)
+	b = cborAppendText(b, ev.Name)
+	b = cborAppendText(b, `type`)
+	b = cborAppendText(b, ev.Value.TypeName())
+	b = cborAppendText(b, `value`)
+	d := ev.Value.data
+	switch ev.Value.evtype {
+	case typeBool:
+		if d[0] != 0 {
+			b = append(b, cborTrue)
+		} else {
+			b = append(b, cborFalse)
+		}
+	case typeByte:
+		b = cborAppendHead(b, cborUint, uint64(d[0]))
+	case typeUint16:
+		b = cborAppendHead(b, cborUint, uint64(binary.LittleEndian.Uint16(d)))
+	case typeUint32:
+		b = cborAppendHead(b, cborUint, uint64(binary.LittleEndian.Uint32(d)))
+	case typeUint64:
+		b = cborAppendHead(b, cborUint, binary.LittleEndian.Uint64(d))
+	case typeInt8:
+		b = cborAppendInt(b, int64(int8(d[0])))
+	case typeInt16:
+		b = cborAppendInt(b, int64(int16(binary.LittleEndian.Uint16(d))))
+	case typeInt32:
+		b = cborAppendInt(b, int64(int32(binary.LittleEndian.Uint32(d))))
+	case typeInt64, typeDuration:
+		b = cborAppendInt(b, int64(binary.LittleEndian.Uint64(d)))
+	case typeFloat32:
+		b = append(b, cborFloat32)
+		b = binary.BigEndian.AppendUint32(b, binary.LittleEndian.Uint32(d))
+	case typeFloat64:
+		b = append(b, cborFloat64)
+		b = binary.BigEndian.AppendUint64(b, binary.LittleEndian.Uint64(d))
+	case typeUnicode:
+		b = cborAppendBytes(b, cborText, d)
+	case typeByteSlice, typeMAC, typeIP:
+		b = cborAppendBytes(b, cborBytes, d)
+	case typeTS:
+		var ts Timestamp
+		ts.Decode(d)
+		b = cborAppendTimestamp(b, ts)
+	}
+	return b, nil
+}
+
+func cborAppendHead(b []byte, major byte, v uint64) []byte {
+	switch {
+	case v < 24:
+		return append(b, major|byte(v))
+	case v <= math.MaxUint8:
+		return append(b, major|24, byte(v))
+	case v <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(b, major|25), uint16(v))
+	case v <= math.MaxUint32:
+		return binary.BigEndian.AppendUint32(append(b, major|26), uint32(v))
+	}
+	return binary.BigEndian.AppendUint64(append(b, major|27), v)
+}
+
+func cborAppendInt(b []byte, v int64) []byte {
+	if v < 0 {
+		return cborAppendHead(b, cborNegInt, uint64(-(v + 1)))
+	}
+	return cborAppendHead(b, cborUint, uint64(v))
+}
+
+func cborAppendBytes(b []byte, major byte, v []byte) []byte {
+	return append(cborAppendHead(b, major, uint64(len(v))), v...)
+}
+
+func cborAppendText(b []byte, v string) []byte {
+	return append(cborAppendHead(b, cborText, uint64(len(v))), v...)
+}
+
+func cborAppendTimestamp(b []byte, ts Timestamp) []byte {
+	b = cborAppendHead(b, cborArray, 2)
+	b = cborAppendInt(b, ts.Sec-unixToInternal)
+	return cborAppendInt(b, ts.Nsec)
+}
+
+// cborReader is a strict decoder for the canonical subset, the first error sticks
+// and all subsequent reads return zero values.
+type cborReader struct {
+	b   []byte
+	err error
+}
+
+func (r *cborReader) fail() {
+	if r.err == nil {
+		r.err = ErrInvalidCanonicalEntry
+	}
+	r.b = nil
+}
+
+// head reads an item header, non-shortest and indefinite length encodings are rejected.
+func (r *cborReader) head() (major byte, v uint64) {
+	if r.err != nil || len(r.b) == 0 {
+		r.fail()
+		return
+	}
+	major = r.b[0] & cborMajorMask
+	info := r.b[0] & cborInfoMask
+	r.b = r.b[1:]
+	var min uint64
+	switch {
+	case info < 24:
+		return major, uint64(info)
+	case info == 24 && len(r.b) >= 1:
+		v, r.b, min = uint64(r.b[0]), r.b[1:], 24
+	case info == 25 && len(r.b) >= 2:
+		v, r.b, min = uint64(binary.BigEndian.Uint16(r.b)), r.b[2:], math.MaxUint8+1
+	case info == 26 && len(r.b) >= 4:
+		v, r.b, min = uint64(binary.BigEndian.Uint32(r.b)), r.b[4:], math.MaxUint16+1
+	case info == 27 && len(r.b) >= 8:
+		v, r.b, min = binary.BigEndian.Uint64(r.b), r.b[8:], math.MaxUint32+1
+	default:
+		r.fail()
+		return
+	}
+	//floats are fixed width and exempt from the shortest form rule
+	if major != cborSimple && v < min {
+		r.fail()
+	}
+	return
+}
+
+func (r *cborReader) expect(major byte) uint64 {
+	m, v := r.head()
+	if m != major {
+		r.fail()
+		return 0
+	}
+	return v
+}
+
+func (r *cborReader) int(min, max int64) (v int64) {
+	switch m, x := r.head(); m {
+	case cborUint:
+		if x > math.MaxInt64 {
+			r.fail()
+			return 0
+		}
+		v = int64(x)
+	case cborNegInt:
+		if x > math.MaxInt64 {
+			r.fail()
+			return 0
+		}
+		v = -1 - int64(x)
+	default:
+		r.fail()
+		return 0
+	}
+	if v < min || v > max {
+		r.fail()
+		return 0
+	}
+	return
+}
+
+func (r *cborReader) uint(max uint64) uint64 {
+	if v := r.expect(cborUint); v <= max {
+		return v
+	}
+	r.fail()
+	return 0
+}
+
+func (r *cborReader) bytes(major byte, max int) (v []byte) {
+	l := r.expect(major)
+	if r.err != nil {
+		return nil
+	} else if l > uint64(len(r.b)) || l > uint64(max) {
+		r.fail()
+		return nil
+	}
+	v, r.b = r.b[:l:l], r.b[l:]
+	return
+}
+
+func (r *cborReader) text(max int) string {
+	return string(r.bytes(cborText, max))
+}
+
+// timestamp reads a [unix sec, nsec] pair, maxNsec bounds the nanosecond field for
+// enumerated values which only have 32 bits to store it.
+func (r *cborReader) timestamp(minNsec, maxNsec int64) (ts Timestamp) {
+	if r.expect(cborArray) != 2 {
+		r.fail()
+		return
+	}
+	ts.Sec = r.int(math.MinInt64, math.MaxInt64) + unixToInternal
+	ts.Nsec = r.int(minNsec, maxNsec)
+	return
+}
+
+func (r *cborReader) entry() (ent Entry, err error) {
+	var version uint64
+	var evs []EnumeratedValue
+	cnt := r.expect(cborMap)
+	if cnt > 6 {
+		r.fail()
+	}
+	//keys must be unique and in canonical order, v, ts, tag, and data are required
+	last := -1
+	var seen [6]bool
+	for i := uint64(0); i < cnt && r.err == nil; i++ {
+		var idx int
+		switch r.text(4) {
+		case `v`:
+			idx = 0
+			version = r.uint(math.MaxUint32)
+		case `ts`:
+			idx = 1
+			ent.TS = r.timestamp(math.MinInt64, math.MaxInt64)
+		case `evs`:
+			idx = 2
+			n := r.expect(cborArray)
+			if n > MaxEvBlockCount || n > uint64(len(r.b)) {
+				r.fail()
+				break
+			}
+			evs = make([]EnumeratedValue, 0, n)
+			for j := uint64(0); j < n && r.err == nil; j++ {
+				var ev EnumeratedValue
+				if ev, err = r.ev(); err != nil {
+					return
+				}
+				evs = append(evs, ev)
+			}
+		case `src`:
+			idx = 3
+			if ent.SRC = net.IP(r.bytes(cborBytes, net.IPv6len)); len(ent.SRC) != net.IPv4len && len(ent.SRC) != net.IPv6len {
+				r.fail()
+			}
+		case `tag`:
+			idx = 4
+			ent.Tag = EntryTag(r.uint(math.MaxUint16))
+		case `data`:
+			idx = 5
+			ent.Data = r.bytes(cborBytes, int(MaxDataSize))
+		default:
+			r.fail()
+		}
+		if idx <= last {
+			r.fail()
+		}
+		last = idx
+		seen[idx] = true
+	}
+	if r.err != nil {
+		err = r.err
+	} else if !seen[0] || version != CanonicalVersion {
+		err = ErrCanonicalVersion
+	} else if !seen[1] || !seen[4] || !seen[5] {
+		err = ErrInvalidCanonicalEntry
+	} else {
+		err = ent.AddEnumeratedValues(evs)
+	}
+	return
+}
+
+func (r *cborReader) ev() (ev EnumeratedValue, err error) {
+	if r.expect(cborMap) != 3 || r.text(4) != `name` {
+		r.fail()
+	} else if ev.Name = r.text(MaxEvNameLength); len(ev.Name) == 0 {
+		r.fail()
+	} else if r.text(4) != `type` {
+		r.fail()
+	}
+	evtype, ok := evTypeFromName(r.text(16))
+	if !ok || r.text(5) != `value` {
+		r.fail()
+	}
+	if r.err != nil {
+		err = ErrInvalidCanonicalValue
+		return
+	}
+	switch evtype {
+	case typeBool:
+		switch m, v := r.head(); {
+		case m == cborSimple && v == uint64(cborFalse&cborInfoMask):
+			ev.Value = BoolEnumData(false)
+		case m == cborSimple && v == uint64(cborTrue&cborInfoMask):
+			ev.Value = BoolEnumData(true)
+		default:
+			r.fail()
+		}
+	case typeByte:
+		ev.Value = ByteEnumData(byte(r.uint(math.MaxUint8)))
+	case typeUint16:
+		ev.Value = Uint16EnumData(uint16(r.uint(math.MaxUint16)))
+	case typeUint32:
+		ev.Value = Uint32EnumData(uint32(r.uint(math.MaxUint32)))
+	case typeUint64:
+		ev.Value = Uint64EnumData(r.uint(math.MaxUint64))
+	case typeInt8:
+		ev.Value = Int8EnumData(int8(r.int(math.MinInt8, math.MaxInt8)))
+	case typeInt16:
+		ev.Value = Int16EnumData(int16(r.int(math.MinInt16, math.MaxInt16)))
+	case typeInt32:
+		ev.Value = Int32EnumData(int32(r.int(math.MinInt32, math.MaxInt32)))
+	case typeInt64:
+		ev.Value = Int64EnumData(r.int(math.MinInt64, math.MaxInt64))
+	case typeDuration:
+		ev.Value = DurationEnumData(time.Duration(r.int(math.MinInt64, math.MaxInt64)))
+	case typeFloat32:
+		if len(r.b) == 0 || r.b[0] != cborFloat32 {
+			r.fail()
+			break
+		}
+		_, v := r.head()
+		ev.Value = Float32EnumData(math.Float32frombits(uint32(v)))
+	case typeFloat64:
+		if len(r.b) == 0 || r.b[0] != cborFloat64 {
+			r.fail()
+			break
+		}
+		_, v := r.head()
+		ev.Value = Float64EnumData(math.Float64frombits(v))
+	case typeUnicode:
+		ev.Value = EnumeratedData{data: r.bytes(cborText, MaxEvDataLength), evtype: typeUnicode}
+	case typeByteSlice, typeMAC, typeIP:
+		ev.Value = EnumeratedData{data: r.bytes(cborBytes, MaxEvDataLength), evtype: evtype}
+	case typeTS:
+		ev.Value = TSEnumData(r.timestamp(0, math.MaxUint32))
+	}
+	if r.err != nil {
+		err = ErrInvalidCanonicalValue
+	} else if !ev.Valid() {
+		err = ErrInvalidEnumeratedData
+	}
+	return
+}
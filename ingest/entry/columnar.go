@@ -0,0 +1,403 @@
+/*************************************************************************
+ * Copyright 2024 Gravwell, Inc. All rights reserved.
+ * Contact: <legal@gravwell.io>
+ *
+ * This software may be modified and distributed under the terms of the
+ * BSD 2-clause license. See the LICENSE file for details.
+ **************************************************************************/
+
+package entry
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+/*
+A columnar block stores a set of entries as independently compressed columns:
+
+	magic "GWCB" (4 bytes)
+	version (1 byte)
+	entry count (uvarint)
+	column table, for each column: raw size (uvarint), compressed size (uvarint)
+	column payloads
+
+The columns are:
+
+	timestamps - zigzag delta encoded seconds followed by nanoseconds, both varints
+	tags       - dictionary of tags followed by a dictionary index per entry
+	sources    - dictionary of sources followed by a dictionary index per entry
+	sizes      - data length and enumerated value block length per entry
+	data       - entry data, back to back
+	evs        - encoded enumerated value blocks, back to back
+
+Repetitive logs compress far better this way than as back to back encoded entries
+because similar values sit next to each other.
+*/
+
+const (
+	columnarVersion   byte = 1
+	columnarColumns        = 6
+	columnarMagicSize      = 4
+)
+
+const (
+	colTimestamps = iota
+	colTags
+	colSources
+	colSizes
+	colData
+	colEVs
+)
+
+var (
+	columnarMagic = [columnarMagicSize]byte{'G', 'W', 'C', 'B'}
+
+	ErrInvalidColumnarBlock = errors.New("Buffer is not a valid columnar entry block")
+	ErrColumnarVersion      = errors.New("Unsupported columnar entry block version")
+
+	zstdEncOnce sync.Once
+	zstdEnc     *zstd.Encoder
+	zstdDecOnce sync.Once
+	zstdDec     *zstd.Decoder
+)
+
+func columnarEncoder() *zstd.Encoder {
+	zstdEncOnce.Do(func() {
+		zstdEnc, _ = zstd.NewWriter(nil, zstd.WithEncoderConcurrency(1))
+	})
+	return zstdEnc
+}
+
+func columnarDecoder() *zstd.Decoder {
+	zstdDecOnce.Do(func() {
+		zstdDec, _ = zstd.NewReader(nil, zstd.WithDecoderConcurrency(0), zstd.WithDecoderMaxMemory(maxEntryBlockSize))
+	})
+	return zstdDec
+}
+
+// EncodeColumnar encodes the entries held by the EntryBlock into a single compressed
+// columnar block, with timestamps, tags, sources, sizes, data, and enumerated values
+// each stored as a separately compressed column.
+func (eb *EntryBlock) EncodeColumnar() ([]byte, error) {
+	if eb == nil || len(eb.entries) == 0 {
+		return nil, ErrInvalidEntryBlock
+	}
+	return EncodeColumnar(eb.entries)
+}
+
+// DecodeColumnar decodes a columnar block produced by EncodeColumnar into the EntryBlock.
+func (eb *EntryBlock) DecodeColumnar(b []byte) error {
+	ents, err := DecodeColumnar(b)
+	if err != nil {
+		return err
+	}
+	for _, e := range ents {
+		eb.Add(e)
+	}
+	return nil
+}
+
+// EncodeColumnar encodes a set of entries into a compressed columnar block.
+// Nil entries are skipped.
+func EncodeColumnar(ents []*Entry) ([]byte, error) {
+	var cols [columnarColumns][]byte
+	var count int
+	var lastSec int64
+	tags := map[EntryTag]uint64{}
+	var tagIdx []uint64
+	var tagDict []EntryTag
+	srcs := map[string]uint64{}
+	var srcIdx []uint64
+	var srcDict []net.IP
+	var rawSize uint64
+
+	for _, e := range ents {
+		if e == nil {
+			continue
+		}
+		count++
+		cols[colTimestamps] = binary.AppendVarint(cols[colTimestamps], e.TS.Sec-lastSec)
+		cols[colTimestamps] = binary.AppendUvarint(cols[colTimestamps], uint64(e.TS.Nsec))
+		lastSec = e.TS.Sec
+
+		idx, ok := tags[e.Tag]
+		if !ok {
+			idx = uint64(len(tagDict))
+			tags[e.Tag] = idx
+			tagDict = append(tagDict, e.Tag)
+		}
+		tagIdx = append(tagIdx, idx)
+
+		if idx, ok = srcs[string(e.SRC)]; !ok {
+			idx = uint64(len(srcDict))
+			srcs[string(e.SRC)] = idx
+			srcDict = append(srcDict, e.SRC)
+		}
+		srcIdx = append(srcIdx, idx)
+
+		var evs []byte
+		if e.EVB.Populated() {
+			var err error
+			if evs, err = e.EVB.Encode(); err != nil {
+				return nil, err
+			}
+		}
+		cols[colSizes] = binary.AppendUvarint(cols[colSizes], uint64(len(e.Data)))
+		cols[colSizes] = binary.AppendUvarint(cols[colSizes], uint64(len(evs)))
+		cols[colData] = append(cols[colData], e.Data...)
+		cols[colEVs] = append(cols[colEVs], evs...)
+		if rawSize += e.Size(); rawSize > maxEntryBlockSize {
+			return nil, ErrBlockTooLarge
+		}
+	}
+	if count == 0 {
+		return nil, ErrInvalidEntryBlock
+	}
+
+	cols[colTags] = binary.AppendUvarint(cols[colTags], uint64(len(tagDict)))
+	for _, t := range tagDict {
+		cols[colTags] = binary.AppendUvarint(cols[colTags], uint64(t))
+	}
+	for _, v := range tagIdx {
+		cols[colTags] = binary.AppendUvarint(cols[colTags], v)
+	}
+	cols[colSources] = binary.AppendUvarint(cols[colSources], uint64(len(srcDict)))
+	for _, s := range srcDict {
+		cols[colSources] = binary.AppendUvarint(cols[colSources], uint64(len(s)))
+		cols[colSources] = append(cols[colSources], s...)
+	}
+	for _, v := range srcIdx {
+		cols[colSources] = binary.AppendUvarint(cols[colSources], v)
+	}
+
+	//build the header and compress each column
+	enc := columnarEncoder()
+	var comp [columnarColumns][]byte
+	hdr := append([]byte(nil), columnarMagic[:]...)
+	hdr = append(hdr, columnarVersion)
+	hdr = binary.AppendUvarint(hdr, uint64(count))
+	var total int
+	for i := range cols {
+		if len(cols[i]) > 0 {
+			comp[i] = enc.EncodeAll(cols[i], nil)
+		}
+		hdr = binary.AppendUvarint(hdr, uint64(len(cols[i])))
+		hdr = binary.AppendUvarint(hdr, uint64(len(comp[i])))
+		total += len(comp[i])
+	}
+	out := make([]byte, 0, len(hdr)+total)
+	out = append(out, hdr...)
+	for i := range comp {
+		out = append(out, comp[i]...)
+	}
+	return out, nil
+}
+
+// DecodeColumnar decodes a compressed columnar block into a set of entries.
+// Entry data and enumerated values are copied out of the buffer.
+func DecodeColumnar(b []byte) ([]*Entry, error) {
+	if len(b) < columnarMagicSize+1 || [columnarMagicSize]byte(b[:columnarMagicSize]) != columnarMagic {
+		return nil, ErrInvalidColumnarBlock
+	} else if b[columnarMagicSize] != columnarVersion {
+		return nil, ErrColumnarVersion
+	}
+	cr := columnReader{b: b[columnarMagicSize+1:]}
+	count := cr.uvarint()
+	var raw, comp [columnarColumns]uint64
+	var total uint64
+	for i := 0; i < columnarColumns; i++ {
+		raw[i], comp[i] = cr.uvarint(), cr.uvarint()
+		total += raw[i]
+	}
+	//every entry takes at least one byte of timestamp column
+	if cr.err != nil || total > maxEntryBlockSize || count > raw[colTimestamps] {
+		return nil, ErrInvalidColumnarBlock
+	}
+
+	//decompress each column
+	dec := columnarDecoder()
+	var cols [columnarColumns]columnReader
+	for i := 0; i < columnarColumns; i++ {
+		p := cr.bytes(comp[i])
+		if cr.err != nil {
+			return nil, ErrInvalidColumnarBlock
+		} else if len(p) == 0 {
+			if raw[i] != 0 {
+				return nil, ErrInvalidColumnarBlock
+			}
+			continue
+		}
+		v, err := dec.DecodeAll(p, make([]byte, 0, raw[i]))
+		if err != nil {
+			return nil, err
+		} else if uint64(len(v)) != raw[i] {
+			return nil, ErrInvalidColumnarBlock
+		}
+		cols[i].b = v
+	}
+	if len(cr.b) != 0 {
+		return nil, ErrPartialDecode
+	}
+
+	tagCount := cols[colTags].uvarint()
+	if tagCount > uint64(len(cols[colTags].b)) {
+		return nil, ErrInvalidColumnarBlock
+	}
+	tagDict := make([]EntryTag, tagCount)
+	for i := range tagDict {
+		tagDict[i] = EntryTag(cols[colTags].uvarint())
+	}
+	srcCount := cols[colSources].uvarint()
+	if srcCount > uint64(len(cols[colSources].b)) {
+		return nil, ErrInvalidColumnarBlock
+	}
+	srcDict := make([]net.IP, srcCount)
+	for i := range srcDict {
+		if s := cols[colSources].bytes(cols[colSources].uvarint()); len(s) > 0 {
+			srcDict[i] = net.IP(s)
+		}
+	}
+
+	ents := make([]*Entry, 0, count)
+	entBuff := make([]Entry, count)
+	var sec int64
+	for i := range entBuff {
+		ent := &entBuff[i]
+		sec += cols[colTimestamps].varint()
+		ent.TS = Timestamp{Sec: sec, Nsec: int64(cols[colTimestamps].uvarint())}
+		if t := cols[colTags].uvarint(); t < uint64(len(tagDict)) {
+			ent.Tag = tagDict[t]
+		} else {
+			return nil, ErrInvalidColumnarBlock
+		}
+		if s := cols[colSources].uvarint(); s < uint64(len(srcDict)) {
+			ent.SRC = srcDict[s]
+		} else {
+			return nil, ErrInvalidColumnarBlock
+		}
+		dlen, evlen := cols[colSizes].uvarint(), cols[colSizes].uvarint()
+		ent.Data = cols[colData].bytes(dlen)
+		if evlen > 0 {
+			evs := cols[colEVs].bytes(evlen)
+			if n, err := ent.EVB.DecodeAlt(evs); err != nil {
+				return nil, err
+			} else if n != len(evs) {
+				return nil, ErrInvalidColumnarBlock
+			}
+		}
+		ents = append(ents, ent)
+	}
+	for i := range cols {
+		if cols[i].err != nil || len(cols[i].b) != 0 {
+			return nil, ErrInvalidColumnarBlock
+		}
+	}
+	return ents, nil
+}
+
+// columnReader walks a column, recording the first error so callers can check once at the end
+type columnReader struct {
+	b   []byte
+	err error
+}
+
+func (cr *columnReader) uvarint() uint64 {
+	v, n := binary.Uvarint(cr.b)
+	if n <= 0 {
+		cr.fail()
+		return 0
+	}
+	cr.b = cr.b[n:]
+	return v
+}
+
+func (cr *columnReader) varint() int64 {
+	v, n := binary.Varint(cr.b)
+	if n <= 0 {
+		cr.fail()
+		return 0
+	}
+	cr.b = cr.b[n:]
+	return v
+}
+
+func (cr *columnReader) bytes(n uint64) (r []byte) {
+	if n > uint64(len(cr.b)) {
+		cr.fail()
+		return nil
+	}
+	r, cr.b = cr.b[:n:n], cr.b[n:]
+	return
+}
+
+func (cr *columnReader) fail() {
+	if cr.err == nil {
+		cr.err = ErrInvalidColumnarBlock
+	}
+	cr.b = nil
+}
+
+// ColumnarWriter writes columnar blocks to a stream, each block is prefixed with its size.
+// This is suitable for cache and export files.
+type ColumnarWriter struct {
+	w   *bufio.Writer
+	hdr [binary.MaxVarintLen64]byte
+}
+
+// NewColumnarWriter creates a writer that emits columnar blocks to w.
+func NewColumnarWriter(w io.Writer) *ColumnarWriter {
+	return &ColumnarWriter{w: bufio.NewWriter(w)}
+}
+
+// Write encodes a set of entries as a single columnar block.
+func (cw *ColumnarWriter) Write(ents []*Entry) error {
+	b, err := EncodeColumnar(ents)
+	if err != nil {
+		return err
+	}
+	n := binary.PutUvarint(cw.hdr[:], uint64(len(b)))
+	if _, err = cw.w.Write(cw.hdr[:n]); err == nil {
+		_, err = cw.w.Write(b)
+	}
+	return err
+}
+
+// Flush writes any buffered data to the underlying writer.
+func (cw *ColumnarWriter) Flush() error {
+	return cw.w.Flush()
+}
+
+// ColumnarReader reads blocks written by a ColumnarWriter.
+type ColumnarReader struct {
+	r *bufio.Reader
+}
+
+// NewColumnarReader creates a reader for a stream of columnar blocks.
+func NewColumnarReader(r io.Reader) *ColumnarReader {
+	return &ColumnarReader{r: bufio.NewReader(r)}
+}
+
+// Read decodes the next block, io.EOF is returned once the stream is exhausted.
+func (cr *ColumnarReader) Read() ([]*Entry, error) {
+	sz, err := binary.ReadUvarint(cr.r)
+	if err != nil {
+		return nil, err
+	} else if sz > maxEntryBlockSize {
+		return nil, ErrBlockTooLarge
+	}
+	b := make([]byte, sz)
+	if _, err = io.ReadFull(cr.r, b); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return DecodeColumnar(b)
+}
@@ -0,0 +1,181 @@
+/*************************************************************************
+ * Copyright 2024 Gravwell, Inc. All rights reserved.
+ * Contact: <legal@gravwell.io>
+ *
+ * This software may be modified and distributed under the terms of the
+ * BSD 2-clause license. See the LICENSE file for details.
+ **************************************************************************/
+
+package entry
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+// genLogEntries builds a set of repetitive syslog style entries
+func genLogEntries(cnt int) (ents []*Entry) {
+	base := FromStandard(time.Date(2024, 6, 15, 12, 0, 0, 0, time.UTC))
+	srcs := []net.IP{net.ParseIP(`10.0.0.1`).To4(), net.ParseIP(`10.0.0.2`).To4(), source, nil}
+	for i := 0; i < cnt; i++ {
+		ts := base
+		ts.Sec += int64(i / 10)
+		ts.Nsec = int64(i%10) * 1000
+		ents = append(ents, &Entry{
+			TS:  ts,
+			SRC: srcs[i%len(srcs)],
+			Tag: EntryTag(i % 3),
+			Data: []byte(fmt.Sprintf("<134>Jun 15 12:%02d:%02d web%02d nginx[%d]: 10.1.%d.%d - - \"GET /api/v1/items/%d HTTP/1.1\" 200 %d",
+				(i/600)%60, (i/10)%60, i%4, 1000+i%7, i%8, i%200, i%50, 512+i%100)),
+		})
+	}
+	return
+}
+
+func checkColumnarEntries(t *testing.T, a, b []*Entry) {
+	t.Helper()
+	if len(a) != len(b) {
+		t.Fatalf("entry count mismatch %d != %d", len(a), len(b))
+	}
+	for i := range a {
+		if err := compareEntry(a[i], b[i]); err != nil {
+			t.Fatalf("entry %d: %v", i, err)
+		} else if len(a[i].SRC) != len(b[i].SRC) {
+			t.Fatalf("entry %d source length changed %d != %d", i, len(a[i].SRC), len(b[i].SRC))
+		} else if err = a[i].EVB.Compare(b[i].EVB); err != nil {
+			t.Fatalf("entry %d: %v", i, err)
+		}
+	}
+}
+
+func TestColumnarRoundTrip(t *testing.T) {
+	ents := genLogEntries(1000)
+	for i := 0; i < len(ents); i += 7 {
+		if err := addAllEvs(ents[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	//timestamps that go backwards and empty data must survive
+	ents[5].TS.Sec -= 1000
+	ents[6].Data = nil
+
+	b, err := EncodeColumnar(append(ents, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := DecodeColumnar(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkColumnarEntries(t, ents, got)
+
+	eb := NewEntryBlock(ents, 0)
+	if b, err = eb.EncodeColumnar(); err != nil {
+		t.Fatal(err)
+	}
+	var eb2 EntryBlock
+	if err = eb2.DecodeColumnar(b); err != nil {
+		t.Fatal(err)
+	} else if eb2.Size() != eb.Size() || eb2.Key() != eb.Key() {
+		t.Fatalf("block mismatch: %d/%d %d/%d", eb2.Size(), eb.Size(), eb2.Key(), eb.Key())
+	}
+	checkColumnarEntries(t, eb.Entries(), eb2.Entries())
+
+	if _, err = EncodeColumnar(nil); err != ErrInvalidEntryBlock {
+		t.Fatalf("empty set did not fail: %v", err)
+	}
+}
+
+func TestColumnarCompression(t *testing.T) {
+	eb := NewEntryBlock(genLogEntries(10000), 0)
+	eb.key = eb.entries[0].TS.Sec
+	raw, err := eb.Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	col, err := eb.EncodeColumnar()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ratio := float64(len(raw)) / float64(len(col)); ratio < 4 {
+		t.Fatalf("columnar block is only %.2fx smaller (%d vs %d)", ratio, len(col), len(raw))
+	}
+}
+
+func TestColumnarCorrupt(t *testing.T) {
+	b, err := EncodeColumnar(genLogEntries(100))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < len(b); i++ {
+		if _, err = DecodeColumnar(b[:i]); err == nil {
+			t.Fatalf("truncated block at %d decoded", i)
+		}
+	}
+	bad := append([]byte(nil), b...)
+	bad[columnarMagicSize] = 99
+	if _, err = DecodeColumnar(bad); err != ErrColumnarVersion {
+		t.Fatalf("bad version did not fail: %v", err)
+	}
+	if _, err = DecodeColumnar(append(b, 0)); err == nil {
+		t.Fatal("trailing bytes decoded")
+	}
+}
+
+func TestColumnarStream(t *testing.T) {
+	var bb bytes.Buffer
+	cw := NewColumnarWriter(&bb)
+	sets := [][]*Entry{genLogEntries(10), genLogEntries(500), genLogEntries(1)}
+	for _, set := range sets {
+		if err := cw.Write(set); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := cw.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	cr := NewColumnarReader(&bb)
+	for _, set := range sets {
+		got, err := cr.Read()
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkColumnarEntries(t, set, got)
+	}
+	if _, err := cr.Read(); err != io.EOF {
+		t.Fatalf("expected EOF: %v", err)
+	}
+}
+
+func FuzzColumnarDecode(f *testing.F) {
+	for _, n := range []int{1, 10, 100} {
+		ents := genLogEntries(n)
+		if err := addAllEvs(ents[0]); err != nil {
+			f.Fatal(err)
+		}
+		b, err := EncodeColumnar(ents)
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(b)
+	}
+	f.Fuzz(func(t *testing.T, b []byte) {
+		if _, err := DecodeColumnar(b); err != nil {
+			t.Log(err)
+		}
+	})
+}
+
+func BenchmarkColumnarEncode(b *testing.B) {
+	ents := genLogEntries(10000)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := EncodeColumnar(ents); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
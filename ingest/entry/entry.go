@@ -48,6 +48,7 @@ type Entry struct {
 	Tag  EntryTag
 	Data []byte
 	EVB  EVBlock
+	ref  *poolRef //set on entries from an EntryPool or borrowing memory from one
 }
 
 func init() {
@@ -535,13 +536,12 @@ func (ent *Entry) DecodeReader(rdr io.Reader) error {
 	if n <= 0 || n > (int(MaxDataSize)-ENTRY_HEADER_SIZE) {
 		return ErrInvalidHeader
 	}
-	ent.Data = make([]byte, n)
+	ent.Data = ent.Buffer(n)
 	if err := readAll(rdr, ent.Data); err != nil {
 		return err
 	}
 	if hasEvs {
-		_, err := ent.EVB.DecodeReader(rdr)
-		return err
+		return ent.decodeEVsReader(rdr)
 	} else {
 		ent.EVB.Reset()
 	}
@@ -550,8 +550,7 @@ func (ent *Entry) DecodeReader(rdr io.Reader) error {
 
 // ReadEVs is a deprecated function, use DecodeReader instead.
 func (ent *Entry) ReadEVs(rdr io.Reader) error {
-	_, err := ent.EVB.DecodeReader(rdr)
-	return err
+	return ent.decodeEVsReader(rdr)
 }
 
 // MarshallBytes implements a gob encoder, the function is deprecated.
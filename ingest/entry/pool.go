@@ -0,0 +1,224 @@
+/*************************************************************************
+ * Copyright 2024 Gravwell, Inc. All rights reserved.
+ * Contact: <legal@gravwell.io>
+ *
+ * This software may be modified and distributed under the terms of the
+ * BSD 2-clause license. See the LICENSE file for details.
+ **************************************************************************/
+
+package entry
+
+import (
+	"io"
+	"math/bits"
+	"sync"
+	"sync/atomic"
+)
+
+const (
+	minPoolBufferShift = 6  // 64 bytes
+	maxPoolBufferShift = 20 // 1MB, larger buffers are allocated directly and left to the GC
+	poolBufferClasses  = maxPoolBufferShift - minPoolBufferShift + 1
+)
+
+// EntryPool is an opt-in allocator that recycles entries and the buffers holding their data and
+// enumerated values.  Entries handed out by a pool are reference counted: the holder of an entry
+// owns one reference and must call Release when done with it, anything that keeps an entry
+// beyond the call it was handed in (including shallow copies of the Entry struct) must call Retain first.
+//
+// Release, Retain, and Borrow are no-ops on entries that did not come from a pool, so code that
+// honors the API works unchanged with regular entries.  Forgetting to release a pooled entry is
+// safe, it is simply collected by the GC; releasing it too early is not.
+type EntryPool struct {
+	ents sync.Pool
+	bufs [poolBufferClasses]sync.Pool
+
+	gets      uint64
+	puts      uint64
+	bufGets   uint64
+	bufMisses uint64
+}
+
+// PoolStats are counters describing how well an EntryPool is recycling memory.
+type PoolStats struct {
+	Gets         uint64 // entries handed out
+	Puts         uint64 // entries returned to the pool
+	BufferGets   uint64 // pooled buffers handed out
+	BufferMisses uint64 // pooled buffers that had to be allocated
+	Outstanding  int64  // entries handed out but not yet released
+}
+
+// poolRef carries the reference count and owned memory for a pooled entry.
+// Entries that are not from a pool but borrow memory from one get a poolRef with a nil pool.
+type poolRef struct {
+	pool    *EntryPool
+	refs    int32
+	bufs    []*[]byte
+	parents []*Entry
+}
+
+// NewEntryPool creates an empty entry pool, pools are safe for concurrent use.
+func NewEntryPool() *EntryPool {
+	return &EntryPool{}
+}
+
+// Get returns an empty entry holding a single reference.
+func (p *EntryPool) Get() (ent *Entry) {
+	atomic.AddUint64(&p.gets, 1)
+	if v := p.ents.Get(); v != nil {
+		ent = v.(*Entry)
+	} else {
+		ent = &Entry{ref: &poolRef{pool: p}}
+	}
+	atomic.StoreInt32(&ent.ref.refs, 1)
+	return
+}
+
+// GetData returns an entry whose Data is a pooled buffer of length sz.
+func (p *EntryPool) GetData(sz int) (ent *Entry) {
+	ent = p.Get()
+	ent.Data = ent.Buffer(sz)
+	return
+}
+
+// Stats returns a snapshot of the pool counters.
+func (p *EntryPool) Stats() (s PoolStats) {
+	s.Gets = atomic.LoadUint64(&p.gets)
+	s.Puts = atomic.LoadUint64(&p.puts)
+	s.BufferGets = atomic.LoadUint64(&p.bufGets)
+	s.BufferMisses = atomic.LoadUint64(&p.bufMisses)
+	s.Outstanding = int64(s.Gets - s.Puts)
+	return
+}
+
+func (p *EntryPool) getBuffer(sz int) *[]byte {
+	c := bufferClass(sz)
+	if c < 0 {
+		return nil
+	}
+	atomic.AddUint64(&p.bufGets, 1)
+	if v := p.bufs[c].Get(); v != nil {
+		return v.(*[]byte)
+	}
+	atomic.AddUint64(&p.bufMisses, 1)
+	b := make([]byte, 1<<(c+minPoolBufferShift))
+	return &b
+}
+
+func (p *EntryPool) putBuffer(b *[]byte) {
+	if c := bufferClass(cap(*b)); c >= 0 && cap(*b) == 1<<(c+minPoolBufferShift) {
+		*b = (*b)[:cap(*b)]
+		p.bufs[c].Put(b)
+	}
+}
+
+// bufferClass returns the size class able to hold sz bytes, or -1 if sz is too large to pool.
+func bufferClass(sz int) int {
+	if sz > 1<<maxPoolBufferShift {
+		return -1
+	} else if sz <= 1<<minPoolBufferShift {
+		return 0
+	}
+	return bits.Len(uint(sz-1)) - minPoolBufferShift
+}
+
+// Pooled returns true if the entry came from an EntryPool.
+func (ent *Entry) Pooled() bool {
+	return ent != nil && ent.ref != nil && ent.ref.pool != nil
+}
+
+// Buffer returns a byte slice of length sz that is owned by the entry and recycled when the entry
+// is released.  Entries that are not pooled, and requests too large to pool, get a regular allocation.
+func (ent *Entry) Buffer(sz int) []byte {
+	if !ent.Pooled() {
+		return make([]byte, sz)
+	}
+	b := ent.ref.pool.getBuffer(sz)
+	if b == nil {
+		return make([]byte, sz)
+	}
+	ent.ref.bufs = append(ent.ref.bufs, b)
+	return (*b)[:sz]
+}
+
+// Retain adds a reference to a pooled entry.
+func (ent *Entry) Retain() {
+	if ent != nil && ent.ref != nil {
+		atomic.AddInt32(&ent.ref.refs, 1)
+	}
+}
+
+// Release drops a reference to a pooled entry, the entry and its buffers are recycled when the last
+// reference is released.  The entry must not be touched after its final release.
+func (ent *Entry) Release() {
+	if ent == nil || ent.ref == nil {
+		return
+	}
+	r := ent.ref
+	if n := atomic.AddInt32(&r.refs, -1); n > 0 {
+		return
+	} else if n < 0 {
+		panic("entry: pooled entry released too many times")
+	}
+	for i, p := range r.parents {
+		p.Release()
+		r.parents[i] = nil
+	}
+	r.parents = r.parents[:0]
+	if r.pool == nil {
+		return
+	}
+	for i, b := range r.bufs {
+		r.pool.putBuffer(b)
+		r.bufs[i] = nil
+	}
+	r.bufs = r.bufs[:0]
+	*ent = Entry{ref: r}
+	atomic.AddUint64(&r.pool.puts, 1)
+	r.pool.ents.Put(ent)
+}
+
+// Borrow records that ent references memory owned by parent, typically because ent was split out of
+// the parent's data.  The parent is kept alive until ent is released.
+func (ent *Entry) Borrow(parent *Entry) {
+	if ent == nil || parent == nil || parent == ent || parent.ref == nil {
+		return
+	}
+	parent.Retain()
+	if ent.ref == nil {
+		ent.ref = &poolRef{refs: 1}
+	}
+	ent.ref.parents = append(ent.ref.parents, parent)
+}
+
+// ReleaseSet releases every entry in the set.
+func ReleaseSet(ents []*Entry) {
+	for _, ent := range ents {
+		ent.Release()
+	}
+}
+
+// decodeEVsReader reads an enumerated value block, pooled entries decode into a buffer they own
+// so that the values do not require individual allocations.
+func (ent *Entry) decodeEVsReader(rdr io.Reader) (err error) {
+	if !ent.Pooled() {
+		_, err = ent.EVB.DecodeReader(rdr)
+		return
+	}
+	var hdr [EVBlockHeaderLen]byte
+	var h EVBlockHeader
+	if err = readAll(rdr, hdr[:]); err != nil {
+		return
+	} else if h, err = DecodeEVBlockHeader(hdr[:]); err != nil {
+		return
+	} else if h.Size < EVBlockHeaderLen {
+		return ErrEnumeratedValueBlockCorrupt
+	}
+	b := ent.Buffer(int(h.Size))
+	copy(b, hdr[:])
+	if err = readAll(rdr, b[EVBlockHeaderLen:]); err != nil {
+		return
+	}
+	_, err = ent.EVB.DecodeAlt(b)
+	return
+}
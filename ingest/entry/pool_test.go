@@ -0,0 +1,165 @@
+/*************************************************************************
+ * Copyright 2024 Gravwell, Inc. All rights reserved.
+ * Contact: <legal@gravwell.io>
+ *
+ * This software may be modified and distributed under the terms of the
+ * BSD 2-clause license. See the LICENSE file for details.
+ **************************************************************************/
+
+package entry
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestPoolRefCount(t *testing.T) {
+	p := NewEntryPool()
+	ent := p.GetData(100)
+	if !ent.Pooled() || len(ent.Data) != 100 {
+		t.Fatalf("bad pooled entry: %v %d", ent.Pooled(), len(ent.Data))
+	}
+	ent.Retain()
+	ent.Release()
+	if s := p.Stats(); s.Outstanding != 1 {
+		t.Fatalf("entry released early: %+v", s)
+	}
+	ent.Release()
+	if s := p.Stats(); s.Outstanding != 0 || s.Gets != 1 || s.Puts != 1 || s.BufferGets != 1 {
+		t.Fatalf("bad stats: %+v", s)
+	}
+
+	//regular entries are unaffected
+	var reg Entry
+	reg.Retain()
+	reg.Release()
+	reg.Release()
+	if reg.Pooled() {
+		t.Fatal("regular entry claims to be pooled")
+	}
+}
+
+func TestPoolBorrow(t *testing.T) {
+	p := NewEntryPool()
+	parent := p.GetData(16)
+	copy(parent.Data, "child and parent")
+	child := &Entry{Data: parent.Data[:5]}
+	child.Borrow(parent)
+	parent.Release()
+	if s := p.Stats(); s.Outstanding != 1 {
+		t.Fatalf("parent released while borrowed: %+v", s)
+	} else if string(child.Data) != `child` {
+		t.Fatalf("child data changed: %q", child.Data)
+	}
+	child.Release()
+	if s := p.Stats(); s.Outstanding != 0 {
+		t.Fatalf("parent not released with child: %+v", s)
+	}
+}
+
+func TestPoolOverRelease(t *testing.T) {
+	p := NewEntryPool()
+	ent := p.Get()
+	ent.Release()
+	defer func() {
+		if recover() == nil {
+			t.Fatal("over release did not panic")
+		}
+	}()
+	ent.Release()
+}
+
+func TestPoolBufferClass(t *testing.T) {
+	tests := []struct {
+		sz, class int
+	}{
+		{0, 0}, {1, 0}, {64, 0}, {65, 1}, {128, 1}, {129, 2},
+		{1 << 20, poolBufferClasses - 1}, {1<<20 + 1, -1},
+	}
+	for _, tt := range tests {
+		if c := bufferClass(tt.sz); c != tt.class {
+			t.Fatalf("bad class for %d: %d != %d", tt.sz, c, tt.class)
+		}
+	}
+	//oversized buffers are still handed out, just not pooled
+	p := NewEntryPool()
+	ent := p.GetData(2 << 20)
+	if len(ent.Data) != 2<<20 {
+		t.Fatalf("bad oversized buffer %d", len(ent.Data))
+	} else if s := p.Stats(); s.BufferGets != 0 {
+		t.Fatalf("oversized buffer came from the pool: %+v", s)
+	}
+	ent.Release()
+}
+
+func TestPoolDecodeReader(t *testing.T) {
+	p := NewEntryPool()
+	var bb bytes.Buffer
+	var orig []Entry
+	for i := 0; i < 100; i++ {
+		ent, err := genRandomEntry()
+		if err != nil {
+			t.Fatal(err)
+		} else if err = addAllEvs(&ent); err != nil {
+			t.Fatal(err)
+		} else if _, err = ent.EncodeWriter(&bb); err != nil {
+			t.Fatal(err)
+		}
+		orig = append(orig, ent)
+	}
+	for i := range orig {
+		ent := p.Get()
+		if err := ent.DecodeReader(&bb); err != nil {
+			t.Fatal(err)
+		} else if err = compareEntry(&orig[i], ent); err != nil {
+			t.Fatal(err)
+		} else if err = orig[i].EVB.Compare(ent.EVB); err != nil {
+			t.Fatal(err)
+		}
+		ent.Release()
+	}
+	s := p.Stats()
+	if s.Outstanding != 0 {
+		t.Fatalf("entries outstanding: %+v", s)
+	} else if s.BufferMisses >= s.BufferGets {
+		t.Fatalf("buffers were not reused: %+v", s)
+	}
+}
+
+func benchmarkDecodeReader(b *testing.B, p *EntryPool) {
+	ent, err := genRandomEntry()
+	if err != nil {
+		b.Fatal(err)
+	} else if err = addAllEvs(&ent); err != nil {
+		b.Fatal(err)
+	}
+	var bb bytes.Buffer
+	if _, err = ent.EncodeWriter(&bb); err != nil {
+		b.Fatal(err)
+	}
+	raw := bb.Bytes()
+	rdr := bytes.NewReader(raw)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		rdr.Reset(raw)
+		var e *Entry
+		if p != nil {
+			e = p.Get()
+		} else {
+			e = &Entry{}
+		}
+		if err = e.DecodeReader(rdr); err != nil {
+			b.Fatal(err)
+		}
+		e.Release()
+	}
+}
+
+func BenchmarkDecodeReader(b *testing.B) {
+	benchmarkDecodeReader(b, nil)
+}
+
+func BenchmarkDecodeReaderPooled(b *testing.B) {
+	benchmarkDecodeReader(b, NewEntryPool())
+}
@@ -115,7 +115,11 @@ func (ecb *entryConfBuffer) Confirm(id entrySendID) error {
 	if ec.EntryID != id {
 		return ecb.popUnalligned(id)
 	}
-	_, err := ecb.popHead()
+	ent, err := ecb.popHead()
+	if err == nil {
+		//the indexer has the entry, pooled entries can be recycled
+		ent.Release()
+	}
 	return err
 }
 
@@ -161,7 +165,10 @@ func (ecb *entryConfBuffer) popUnalligned(id entrySendID) error {
 	var curr, next int
 	//simple sanity check in case we are popping the head
 	if ecb.buff[ecb.head] != nil && ecb.buff[ecb.head].EntryID == id {
-		_, err := ecb.popHead()
+		ent, err := ecb.popHead()
+		if err == nil {
+			ent.Release()
+		}
 		return err
 	}
 	//not the head, so go do the hard work
@@ -175,6 +182,7 @@ func (ecb *entryConfBuffer) popUnalligned(id entrySendID) error {
 		//found the ID, so remove it and shift forward
 		//if this hits we ARE going to return
 		if ecb.buff[i].EntryID == id {
+			ecb.buff[i].Ent.Release()
 			//remove the ID from the list
 			for ; i < ecb.count; i++ {
 				if i == ecb.capacity {
@@ -81,6 +81,7 @@ type EntryReader struct {
 	//entCache is used to allocate entries in blocks to relieve some pressure on the allocator and GC
 	entCache    []entry.Entry
 	entCacheIdx int
+	pool        *entry.EntryPool //when set entries come from the pool instead of entCache
 	opCount     uint64
 	lastCount   uint64
 	timeout     time.Duration
@@ -128,6 +129,15 @@ func NewEntryReaderEx(cfg EntryReaderWriterConfig) (*EntryReader, error) {
 	}, nil
 }
 
+// SetEntryPool makes the reader hand out entries and data buffers from the provided pool.
+// Callers must Release every entry returned by Read once they are done with it.
+// A nil pool restores the default allocator.
+func (er *EntryReader) SetEntryPool(p *entry.EntryPool) {
+	er.mtx.Lock()
+	er.pool = p
+	er.mtx.Unlock()
+}
+
 // SetTagManager gives a handle on the instantiator's tag management system.
 // If this is not set, tags cannot be negotiated on the fly
 func (er *EntryReader) SetTagManager(tm TagManager) {
@@ -292,28 +302,36 @@ func (er *EntryReader) read() (*entry.Entry, error) {
 		sz     uint32
 		id     entrySendID
 		hasEvs bool
+		ent    *entry.Entry
 	)
-	if er.entCacheIdx >= len(er.entCache) {
-		er.entCache = make([]entry.Entry, entCacheRechargeSize)
-		er.entCacheIdx = 0
+	if er.pool != nil {
+		ent = er.pool.Get()
+	} else {
+		if er.entCacheIdx >= len(er.entCache) {
+			er.entCache = make([]entry.Entry, entCacheRechargeSize)
+			er.entCacheIdx = 0
+		}
+		ent = &er.entCache[er.entCacheIdx]
 	}
-	ent := &er.entCache[er.entCacheIdx]
 
 	if err = er.fillHeader(ent, &id, &sz, &hasEvs); err != nil {
+		ent.Release()
 		return nil, err
 	}
-	ent.Data = make([]byte, sz)
-	if _, err = io.ReadFull(er.bIO, ent.Data); err != nil {
-		return nil, err
-	} else if hasEvs {
-		if err = ent.ReadEVs(er.bIO); err != nil {
-			return nil, err
-		}
+	ent.Data = ent.Buffer(int(sz))
+	if _, err = io.ReadFull(er.bIO, ent.Data); err == nil && hasEvs {
+		err = ent.ReadEVs(er.bIO)
+	}
+	if err == nil {
+		err = er.throwAck(id)
 	}
-	if err = er.throwAck(id); err != nil {
+	if err != nil {
+		ent.Release()
 		return nil, err
 	}
-	er.entCacheIdx++
+	if er.pool == nil {
+		er.entCacheIdx++
+	}
 	return ent, nil
 }
 
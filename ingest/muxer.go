@@ -284,6 +284,12 @@ func newIngestMuxer(c MuxerConfig) (*IngestMuxer, error) {
 		if err != nil {
 			return nil, err
 		}
+		for _, cc := range []*chancacher.ChanCacher{cache, bcache} {
+			if err := cc.RecoveryError(); err != nil {
+				c.Logger.Warn("cache recovery stopped at a corrupt item, the rest of the cache file will not be replayed",
+					log.KV("path", c.CachePath), log.KVErr(err))
+			}
+		}
 	} else {
 		cache, err = chancacher.NewChanCacher(c.CacheDepth, "", 0)
 		if err != nil {
@@ -900,6 +906,8 @@ func (im *IngestMuxer) GetTag(tag string) (tg entry.EntryTag, err error) {
 // WriteEntry puts an entry into the queue to be sent out by the first available
 // entry writer routine, if all routines are dead, THIS WILL BLOCK once the
 // channel fills up.  We figure this is a natural "wait" mechanism
+// A successful write hands the caller's reference on a pooled entry to the muxer,
+// it is released once the indexer acknowledges the entry.
 func (im *IngestMuxer) WriteEntry(e *entry.Entry) error {
 	if e == nil {
 		return nil
@@ -1185,6 +1193,7 @@ inputLoop:
 				// If the ingest muxer has no idea what this tag is, drop it and notify
 				if name, ok := im.LookupTag(e.Tag); !ok {
 					im.Error("Got entry tagged with completely unknown intermediate tag, dropping it", log.KV("tagvalue", e.Tag), log.KV("ingester", im.name), log.KV("ingesteruuid", im.uuid))
+					e.Release()
 					continue inputLoop
 				} else {
 					im.Info("Got entry with new tag, need to renegotiate connection", log.KV("tag", name), log.KV("tagvalue", e.Tag), log.KV("ingester", im.name), log.KV("ingesteruuid", im.uuid))
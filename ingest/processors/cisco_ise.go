@@ -175,6 +175,9 @@ func (p *CiscoISE) Process(ents []*entry.Entry) ([]*entry.Entry, error) {
 	for _, v := range ents {
 		if ent, err := p.processEnt(v); ent != nil && err == nil {
 			rset = append(rset, ent)
+		} else if !p.Enable_Multipart_Reassembly {
+			//the reassembler may still be holding the entry
+			v.Release()
 		}
 	}
 
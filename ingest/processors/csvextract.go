@@ -0,0 +1,519 @@
+/*************************************************************************
+ * Copyright 2024 Gravwell, Inc. All rights reserved.
+ * Contact: <legal@gravwell.io>
+ *
+ * This software may be modified and distributed under the terms of the
+ * BSD 2-clause license. See the LICENSE file for details.
+ **************************************************************************/
+
+package processors
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gravwell/gravwell/v3/ingest/config"
+	"github.com/gravwell/gravwell/v3/ingest/entry"
+	"github.com/gravwell/gravwell/v3/timegrinder"
+)
+
+const (
+	CSVExtractProcessor = `csvextract`
+
+	CSVHeaderStatic = `static` // columns come from the Columns config
+	CSVHeaderLine   = `header` // the first line from each source names the columns
+	CSVHeaderFields = `fields` // columns come from #fields lines, as written by Zeek
+
+	csvFieldsPrefix = `#fields`
+
+	defaultCSVHeaderTimeout = time.Hour
+	defaultCSVMaxSources    = 4096
+
+	csvTypeString   = `string`
+	csvTypeInt      = `int`
+	csvTypeUint     = `uint`
+	csvTypeFloat    = `float`
+	csvTypeBool     = `bool`
+	csvTypeIP       = `ip`
+	csvTypeTS       = `timestamp`
+	csvTypeDuration = `duration`
+)
+
+var (
+	ErrCSVMissingColumns = errors.New("Columns are required when Header-Mode is static")
+	ErrCSVInvalidChar    = errors.New("Delimiter and Comment must be a single character")
+	ErrCSVTimestampCol   = errors.New("Timestamp-Column is not a static column")
+	ErrCSVInvalidLimit   = errors.New("Header-Timeout and Max-Sources must be positive")
+
+	csvTypes = []string{csvTypeString, csvTypeInt, csvTypeUint, csvTypeFloat, csvTypeBool, csvTypeIP, csvTypeTS, csvTypeDuration}
+)
+
+type CSVExtractConfig struct {
+	Delimiter             string   // single character, "tab" and "\t" are accepted, defaults to ","
+	Disable_Quotes        bool     // split on the delimiter without honoring quotes
+	Lazy_Quotes           bool     // allow quotes in unquoted fields
+	Comment               string   // lines starting with this character are dropped
+	Trim_Space            bool     // trim white space around values
+	Header_Mode           string   // static, header, or fields.  Defaults to static if Columns is set, otherwise header
+	Columns               []string // column names, each value may be a comma separated list
+	Types                 []string // column:type coercions for attached values
+	Null_Value            []string // values treated as missing, defaults to - and (empty) in fields mode
+	Attach                []string // columns to attach as enumerated values, defaults to all columns
+	Skip_Attach           bool     // do not attach any enumerated values
+	Timestamp_Column      string   // set the entry timestamp from this column
+	Timestamp_Format      string   // optional timegrinder format override for Timestamp-Column
+	Assume_Local_Timezone bool
+	Emit_JSON             bool   // replace the entry data with a JSON object of the typed columns
+	Drop_Misses           bool   // drop lines that do not parse or do not match the column count
+	Header_Timeout        string // forget columns learned from a source that has been idle this long, defaults to 1h
+	Max_Sources           int    // maximum number of sources with learned columns, defaults to 4096
+}
+
+func CSVExtractLoadConfig(vc *config.VariableConfig) (c CSVExtractConfig, err error) {
+	if err = vc.MapTo(&c); err == nil {
+		_, err = c.validate()
+	}
+	return
+}
+
+type csvParams struct {
+	delim   rune
+	comment rune
+	mode    string
+	columns []string
+	types   map[string]string
+	nulls   map[string]bool
+	attach  map[string]bool
+	timeout time.Duration
+	maxSrc  int
+}
+
+func csvChar(v string, def rune) (r rune, err error) {
+	switch strings.ToLower(v) {
+	case ``:
+		r = def
+	case `tab`, `\t`:
+		r = '\t'
+	case `space`:
+		r = ' '
+	default:
+		if utf8.RuneCountInString(v) != 1 {
+			err = ErrCSVInvalidChar
+			return
+		}
+		r, _ = utf8.DecodeRuneInString(v)
+	}
+	return
+}
+
+func splitColumns(vals []string) (r []string) {
+	for _, v := range vals {
+		for _, c := range strings.Split(v, `,`) {
+			if c = strings.TrimSpace(c); c != `` {
+				r = append(r, c)
+			}
+		}
+	}
+	return
+}
+
+func (c *CSVExtractConfig) validate() (p csvParams, err error) {
+	if p.delim, err = csvChar(c.Delimiter, ','); err != nil {
+		return
+	} else if p.comment, err = csvChar(c.Comment, 0); err != nil {
+		return
+	} else if p.delim == p.comment || p.delim == '"' || p.delim == '\n' || p.delim == '\r' {
+		err = fmt.Errorf("Invalid Delimiter %q", c.Delimiter)
+		return
+	}
+	p.columns = splitColumns(c.Columns)
+	switch p.mode = strings.ToLower(strings.TrimSpace(c.Header_Mode)); p.mode {
+	case ``:
+		if p.mode = CSVHeaderLine; len(p.columns) > 0 {
+			p.mode = CSVHeaderStatic
+		}
+	case CSVHeaderStatic:
+		if len(p.columns) == 0 {
+			err = ErrCSVMissingColumns
+			return
+		}
+	case CSVHeaderLine:
+	case CSVHeaderFields:
+		if p.comment == 0 {
+			p.comment = '#'
+		}
+	default:
+		err = fmt.Errorf("Unknown Header-Mode %q", c.Header_Mode)
+		return
+	}
+	if p.mode == CSVHeaderStatic && c.Timestamp_Column != `` && stringInSet(c.Timestamp_Column, p.columns) == -1 {
+		err = ErrCSVTimestampCol
+		return
+	}
+
+	p.types = map[string]string{}
+	for _, t := range c.Types {
+		idx := strings.LastIndex(t, `:`)
+		if idx <= 0 {
+			err = fmt.Errorf("Invalid Types value %q, must be column:type", t)
+			return
+		}
+		col := strings.TrimSpace(t[:idx])
+		tp := strings.ToLower(strings.TrimSpace(t[idx+1:]))
+		if stringInSet(tp, csvTypes) == -1 {
+			err = fmt.Errorf("Unknown type %q for column %s, must be one of %s", tp, col, strings.Join(csvTypes, ", "))
+			return
+		}
+		p.types[col] = tp
+	}
+
+	p.nulls = map[string]bool{}
+	if len(c.Null_Value) == 0 && p.mode == CSVHeaderFields {
+		p.nulls[`-`], p.nulls[`(empty)`] = true, true
+	}
+	for _, v := range c.Null_Value {
+		p.nulls[v] = true
+	}
+	if len(c.Attach) > 0 {
+		p.attach = map[string]bool{}
+		for _, v := range splitColumns(c.Attach) {
+			p.attach[v] = true
+		}
+	}
+	p.timeout = defaultCSVHeaderTimeout
+	if c.Header_Timeout != `` {
+		if p.timeout, err = time.ParseDuration(c.Header_Timeout); err != nil {
+			err = fmt.Errorf("Invalid Header-Timeout %q: %w", c.Header_Timeout, err)
+			return
+		}
+	}
+	if p.maxSrc = c.Max_Sources; p.maxSrc == 0 {
+		p.maxSrc = defaultCSVMaxSources
+	}
+	if p.timeout <= 0 || p.maxSrc < 0 {
+		err = ErrCSVInvalidLimit
+		return
+	}
+	if c.Timestamp_Format != `` {
+		err = timegrinder.ValidateFormatOverride(c.Timestamp_Format)
+	}
+	return
+}
+
+func (p csvParams) hasType(tp string) bool {
+	for _, v := range p.types {
+		if v == tp {
+			return true
+		}
+	}
+	return false
+}
+
+// csvHeader holds the columns learned from a single source and tag
+type csvHeader struct {
+	cols []string
+	last time.Time
+}
+
+// CSVExtract parses delimited lines into typed enumerated values and optionally JSON.
+// Columns learned in header and fields mode are kept per source and tag, sources that
+// go quiet for the Header-Timeout are forgotten and the number of sources is capped.
+type CSVExtract struct {
+	nocloser
+	CSVExtractConfig
+	csvParams
+	tg      *timegrinder.TimeGrinder
+	learned map[string]*csvHeader
+	now     func() time.Time
+}
+
+func NewCSVExtract(cfg CSVExtractConfig) (*CSVExtract, error) {
+	ce := &CSVExtract{now: time.Now}
+	if err := ce.init(cfg); err != nil {
+		return nil, err
+	}
+	return ce, nil
+}
+
+func (ce *CSVExtract) Config(v interface{}) (err error) {
+	if v == nil {
+		err = ErrNilConfig
+	} else if cfg, ok := v.(CSVExtractConfig); ok {
+		err = ce.init(cfg)
+	} else {
+		err = fmt.Errorf("Invalid configuration, unknown type type %T", v)
+	}
+	return
+}
+
+func (ce *CSVExtract) init(cfg CSVExtractConfig) (err error) {
+	var p csvParams
+	var tg *timegrinder.TimeGrinder
+	if p, err = cfg.validate(); err != nil {
+		return
+	}
+	if cfg.Timestamp_Column != `` || p.hasType(csvTypeTS) {
+		if tg, err = timegrinder.New(timegrinder.Config{FormatOverride: cfg.Timestamp_Format}); err != nil {
+			return
+		}
+		if cfg.Assume_Local_Timezone {
+			tg.SetLocalTime()
+		}
+	}
+	ce.CSVExtractConfig, ce.csvParams, ce.tg = cfg, p, tg
+	ce.learned = map[string]*csvHeader{}
+	return
+}
+
+func (ce *CSVExtract) Process(ents []*entry.Entry) (rset []*entry.Entry, err error) {
+	if len(ents) == 0 {
+		return
+	}
+	rset = ents[:0]
+	now := ce.now()
+	for _, ent := range ents {
+		if ent == nil {
+			continue
+		} else if r := ce.processItem(ent, now); r != nil {
+			rset = append(rset, r)
+		} else {
+			ent.Release()
+		}
+	}
+	return
+}
+
+func (ce *CSVExtract) processItem(ent *entry.Entry, now time.Time) *entry.Entry {
+	line := bytes.TrimRight(ent.Data, "\r\n")
+	if len(line) == 0 {
+		return ce.miss(ent)
+	}
+	key := sourceTagKey(ent)
+	if ce.comment != 0 && bytes.HasPrefix(line, []byte(string(ce.comment))) {
+		if ce.mode == CSVHeaderFields && bytes.HasPrefix(line, []byte(csvFieldsPrefix)) {
+			hdr := bytes.TrimPrefix(line[len(csvFieldsPrefix):], []byte(string(ce.delim)))
+			if vals, err := ce.split(hdr); err == nil {
+				ce.learn(key, cleanColumns(vals), now)
+			}
+		}
+		return nil //comments and headers are never data
+	}
+	vals, err := ce.split(line)
+	if err != nil {
+		return ce.miss(ent)
+	}
+	cols := ce.columns
+	if ce.mode != CSVHeaderStatic {
+		h, ok := ce.learned[key]
+		if !ok {
+			if ce.mode == CSVHeaderLine {
+				ce.learn(key, cleanColumns(vals), now)
+				return nil
+			}
+			return ce.miss(ent) //no #fields line seen yet
+		}
+		h.last = now
+		if cols = h.cols; ce.mode == CSVHeaderLine && sameColumns(cols, vals) {
+			return nil //repeated header, the sender probably started a new file
+		}
+	}
+	if len(vals) != len(cols) {
+		return ce.miss(ent)
+	}
+	ce.apply(ent, cols, vals)
+	return ent
+}
+
+// learn sets the columns for a source, evicting the least recently seen source when full
+func (ce *CSVExtract) learn(key string, cols []string, now time.Time) {
+	if h, ok := ce.learned[key]; ok {
+		h.cols, h.last = cols, now
+		return
+	}
+	if len(ce.learned) >= ce.maxSrc {
+		var oldest string
+		var last time.Time
+		for k, h := range ce.learned {
+			if oldest == `` || h.last.Before(last) {
+				oldest, last = k, h.last
+			}
+		}
+		delete(ce.learned, oldest)
+	}
+	ce.learned[key] = &csvHeader{cols: cols, last: now}
+}
+
+// Expire forgets columns learned from sources that have been idle for the header timeout,
+// CSVExtract never holds entries so nothing is returned
+func (ce *CSVExtract) Expire(now time.Time) []*entry.Entry {
+	for k, h := range ce.learned {
+		if now.Sub(h.last) >= ce.timeout {
+			delete(ce.learned, k)
+		}
+	}
+	return nil
+}
+
+func (ce *CSVExtract) miss(ent *entry.Entry) *entry.Entry {
+	if ce.Drop_Misses {
+		return nil
+	}
+	return ent
+}
+
+func (ce *CSVExtract) split(line []byte) (vals []string, err error) {
+	if ce.Disable_Quotes {
+		vals = strings.Split(string(line), string(ce.delim))
+	} else {
+		r := csv.NewReader(bytes.NewReader(line))
+		r.Comma = ce.delim
+		r.FieldsPerRecord = -1
+		r.LazyQuotes = ce.Lazy_Quotes
+		r.TrimLeadingSpace = ce.Trim_Space
+		if vals, err = r.Read(); err != nil {
+			return
+		}
+	}
+	if ce.Trim_Space {
+		for i := range vals {
+			vals[i] = strings.TrimSpace(vals[i])
+		}
+	}
+	return
+}
+
+func (ce *CSVExtract) apply(ent *entry.Entry, cols, vals []string) {
+	var obj []csvValue
+	for i, col := range cols {
+		v := vals[i]
+		if v == `` || ce.nulls[v] {
+			continue
+		}
+		if col == ce.Timestamp_Column {
+			if ts, ok, err := ce.tg.Extract([]byte(v)); err == nil && ok {
+				ent.TS = entry.FromStandard(ts)
+			}
+		}
+		tv := ce.coerce(col, v)
+		if !ce.Skip_Attach && (ce.attach == nil || ce.attach[col]) {
+			if ed, err := entry.InferEnumeratedData(tv); err == nil {
+				ent.AddEnumeratedValue(entry.EnumeratedValue{Name: col, Value: ed})
+			}
+		}
+		if ce.Emit_JSON {
+			obj = append(obj, csvValue{name: col, val: tv})
+		}
+	}
+	if ce.Emit_JSON {
+		if b, err := marshalCSVObject(obj); err == nil {
+			ent.Data = b
+		}
+	}
+}
+
+// coerce converts a value to its configured type, values that fail conversion stay strings
+func (ce *CSVExtract) coerce(col, v string) interface{} {
+	switch ce.types[col] {
+	case csvTypeInt:
+		if x, err := strconv.ParseInt(v, 10, 64); err == nil {
+			return x
+		}
+	case csvTypeUint:
+		if x, err := strconv.ParseUint(v, 10, 64); err == nil {
+			return x
+		}
+	case csvTypeFloat:
+		if x, err := strconv.ParseFloat(v, 64); err == nil {
+			return x
+		}
+	case csvTypeBool:
+		switch strings.ToLower(v) {
+		case `t`, `true`, `1`, `yes`, `y`:
+			return true
+		case `f`, `false`, `0`, `no`, `n`:
+			return false
+		}
+	case csvTypeIP:
+		if x := net.ParseIP(v); x != nil {
+			return x
+		}
+	case csvTypeTS:
+		if ts, ok, err := ce.tg.Extract([]byte(v)); err == nil && ok {
+			return entry.FromStandard(ts)
+		}
+	case csvTypeDuration:
+		if x, err := time.ParseDuration(v); err == nil {
+			return x
+		} else if f, err := strconv.ParseFloat(v, 64); err == nil {
+			//zeek writes durations as fractional seconds
+			return time.Duration(f * float64(time.Second))
+		}
+	}
+	return v
+}
+
+type csvValue struct {
+	name string
+	val  interface{}
+}
+
+// marshalCSVObject writes a JSON object with keys in column order
+func marshalCSVObject(vals []csvValue) ([]byte, error) {
+	bb := bytes.NewBuffer(nil)
+	bb.WriteByte('{')
+	for i, v := range vals {
+		if i > 0 {
+			bb.WriteByte(',')
+		}
+		k, err := json.Marshal(v.name)
+		if err != nil {
+			return nil, err
+		}
+		bb.Write(k)
+		bb.WriteByte(':')
+		var jv interface{} = v.val
+		switch x := v.val.(type) {
+		case net.IP:
+			jv = x.String()
+		case entry.Timestamp:
+			jv = x.StandardTime().UTC().Format(time.RFC3339Nano)
+		case time.Duration:
+			jv = x.String()
+		}
+		val, err := json.Marshal(jv)
+		if err != nil {
+			return nil, err
+		}
+		bb.Write(val)
+	}
+	bb.WriteByte('}')
+	return bb.Bytes(), nil
+}
+
+func cleanColumns(vals []string) (r []string) {
+	r = make([]string, 0, len(vals))
+	for _, v := range vals {
+		r = append(r, strings.TrimSpace(v))
+	}
+	return
+}
+
+func sameColumns(cols, vals []string) bool {
+	if len(cols) != len(vals) {
+		return false
+	}
+	for i := range cols {
+		if cols[i] != strings.TrimSpace(vals[i]) {
+			return false
+		}
+	}
+	return true
+}
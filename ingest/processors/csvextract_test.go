@@ -0,0 +1,208 @@
+/*************************************************************************
+ * Copyright 2024 Gravwell, Inc. All rights reserved.
+ * Contact: <legal@gravwell.io>
+ *
+ * This software may be modified and distributed under the terms of the
+ * BSD 2-clause license. See the LICENSE file for details.
+ **************************************************************************/
+
+package processors
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/gravwell/gravwell/v3/ingest/config"
+	"github.com/gravwell/gravwell/v3/ingest/entry"
+)
+
+func TestCSVExtractConfig(t *testing.T) {
+	b := []byte(`
+	[preprocessor "csv"]
+		type = csvextract
+		Delimiter = tab
+		Header-Mode = fields
+		Types = "ts:timestamp"
+		Types = "id.orig_p:uint"
+		Timestamp-Column = ts
+		Emit-JSON = true
+	`)
+	tc := struct {
+		Preprocessor ProcessorConfig
+	}{}
+	if err := config.LoadConfigBytes(&tc, b); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := CSVExtractLoadConfig(tc.Preprocessor[`csv`])
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := cfg.validate()
+	if err != nil {
+		t.Fatal(err)
+	} else if p.delim != '\t' || p.comment != '#' || p.mode != CSVHeaderFields || len(p.types) != 2 || !p.nulls[`-`] {
+		t.Fatalf("bad config: %+v", p)
+	}
+
+	bad := []CSVExtractConfig{
+		CSVExtractConfig{Delimiter: `::`},
+		CSVExtractConfig{Delimiter: `"`},
+		CSVExtractConfig{Comment: `,`},
+		CSVExtractConfig{Header_Mode: CSVHeaderStatic},
+		CSVExtractConfig{Header_Mode: `magic`},
+		CSVExtractConfig{Columns: []string{`a,b`}, Timestamp_Column: `c`},
+		CSVExtractConfig{Columns: []string{`a,b`}, Types: []string{`a`}},
+		CSVExtractConfig{Columns: []string{`a,b`}, Types: []string{`a:complex`}},
+	}
+	for i, c := range bad {
+		if _, err := c.validate(); err == nil {
+			t.Fatalf("bad config %d did not fail", i)
+		}
+	}
+}
+
+func TestCSVExtractStatic(t *testing.T) {
+	ce, err := NewCSVExtract(CSVExtractConfig{
+		Columns:          []string{`time,src`, `count`, `ok`, `note`},
+		Types:            []string{`src:ip`, `count:int`, `ok:bool`},
+		Timestamp_Column: `time`,
+		Comment:          `#`,
+		Trim_Space:       true,
+		Drop_Misses:      true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ents := []*entry.Entry{
+		&entry.Entry{Data: []byte(`2024-02-03T04:05:06Z, 10.0.0.1, 42, true, "hello, world"`)},
+		&entry.Entry{Data: []byte(`# a comment`)},
+		&entry.Entry{Data: []byte(`too,few`)},
+		&entry.Entry{Data: []byte(`2024-02-03T04:05:07Z,10.0.0.2,many,nope,`)},
+	}
+	r, err := ce.Process(ents)
+	if err != nil {
+		t.Fatal(err)
+	} else if len(r) != 2 {
+		t.Fatalf("bad result count %d", len(r))
+	}
+	checkEV(t, r[0], `src`, net.ParseIP(`10.0.0.1`))
+	checkEV(t, r[0], `count`, int64(42))
+	checkEV(t, r[0], `ok`, true)
+	checkEV(t, r[0], `note`, `hello, world`)
+	if !r[0].TS.StandardTime().Equal(time.Date(2024, 2, 3, 4, 5, 6, 0, time.UTC)) {
+		t.Fatalf("bad timestamp %v", r[0].TS)
+	}
+	//values that fail coercion stay strings and empty values are skipped
+	checkEV(t, r[1], `count`, `many`)
+	checkEV(t, r[1], `ok`, `nope`)
+	if _, ok := r[1].GetEnumeratedValue(`note`); ok {
+		t.Fatal("empty value was attached")
+	}
+}
+
+func TestCSVExtractHeader(t *testing.T) {
+	ce, err := NewCSVExtract(CSVExtractConfig{
+		Types:     []string{`n:float`},
+		Attach:    []string{`name`},
+		Emit_JSON: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := lineEntries(`1.1.1.1`, 0, `name,n`, `alice,1.5`, `name,n`, `bob,2`)
+	b := lineEntries(`2.2.2.2`, 0, `n,name`, `3,carol`)
+	r, err := ce.Process([]*entry.Entry{a[0], b[0], a[1], b[1], a[2], a[3]})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkEvents(t, r, `{"name":"alice","n":1.5}`, `{"n":3,"name":"carol"}`, `{"name":"bob","n":2}`)
+	checkEV(t, r[1], `name`, `carol`)
+	if _, ok := r[1].GetEnumeratedValue(`n`); ok {
+		t.Fatal("got unrequested attachment")
+	}
+}
+
+func TestCSVExtractZeek(t *testing.T) {
+	ce, err := NewCSVExtract(CSVExtractConfig{
+		Delimiter:        `\t`,
+		Header_Mode:      CSVHeaderFields,
+		Disable_Quotes:   true,
+		Types:            []string{`ts:timestamp`, `id.orig_h:ip`, `id.orig_p:uint`, `duration:duration`},
+		Timestamp_Column: `ts`,
+		Skip_Attach:      true,
+		Emit_JSON:        true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ents := lineEntries(`1.1.1.1`, 0,
+		"1.1.1.1\tbefore fields",
+		"#separator \\x09",
+		"#fields\tts\tuid\tid.orig_h\tid.orig_p\tduration\tservice",
+		"#types\ttime\tstring\taddr\tport\tinterval\tstring",
+		"1136214245.000000\tCabc\t10.0.0.1\t53\t0.5\t-",
+		"1136214246.000000\tC\"q\"\t10.0.0.2\t80\t1.25\thttp",
+	)
+	r, err := ce.Process(ents)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkEvents(t, r,
+		"1.1.1.1\tbefore fields",
+		`{"ts":"2006-01-02T15:04:05Z","uid":"Cabc","id.orig_h":"10.0.0.1","id.orig_p":53,"duration":"500ms"}`,
+		`{"ts":"2006-01-02T15:04:06Z","uid":"C\"q\"","id.orig_h":"10.0.0.2","id.orig_p":80,"duration":"1.25s","service":"http"}`,
+	)
+	if r[1].EVB.Count() != 0 {
+		t.Fatal("Skip-Attach attached values")
+	} else if !r[2].TS.StandardTime().Equal(time.Unix(1136214246, 0)) {
+		t.Fatalf("bad timestamp %v", r[2].TS)
+	}
+}
+
+func TestCSVExtractExpire(t *testing.T) {
+	ce, err := NewCSVExtract(CSVExtractConfig{Header_Timeout: `1m`, Max_Sources: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	ce.now = func() time.Time { return now }
+	a := lineEntries(`1.1.1.1`, 0, `a`, `1`, `2`)
+	b := lineEntries(`2.2.2.2`, 0, `b`, `1`)
+	c := lineEntries(`3.3.3.3`, 0, `c`, `1`)
+	if _, err = ce.Process([]*entry.Entry{a[0], b[0]}); err != nil {
+		t.Fatal(err)
+	}
+	now = now.Add(time.Second)
+	if _, err = ce.Process([]*entry.Entry{a[1]}); err != nil {
+		t.Fatal(err)
+	}
+	//a third source evicts b, it was seen least recently
+	if _, err = ce.Process([]*entry.Entry{c[0]}); err != nil {
+		t.Fatal(err)
+	}
+	if len(ce.learned) != 2 || ce.learned[sourceTagKey(b[1])] != nil {
+		t.Fatalf("source was not evicted: %d", len(ce.learned))
+	}
+	//b relearns its header from the next line
+	if r, _ := ce.Process([]*entry.Entry{b[1]}); len(r) != 0 {
+		t.Fatalf("evicted source line was not treated as a header")
+	}
+
+	now = now.Add(30 * time.Second)
+	if _, err = ce.Process([]*entry.Entry{a[2]}); err != nil {
+		t.Fatal(err)
+	}
+	now = now.Add(45 * time.Second)
+	if r := ce.Expire(now); r != nil {
+		t.Fatalf("Expire returned entries")
+	} else if len(ce.learned) != 1 || ce.learned[sourceTagKey(a[0])] == nil {
+		t.Fatalf("idle sources were not expired: %d", len(ce.learned))
+	}
+
+	for _, cfg := range []CSVExtractConfig{{Header_Timeout: `-1s`}, {Header_Timeout: `soon`}, {Max_Sources: -1}} {
+		if _, err := NewCSVExtract(cfg); err == nil {
+			t.Errorf("bad limits %+v passed validation", cfg)
+		}
+	}
+}
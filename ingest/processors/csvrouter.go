@@ -94,8 +94,10 @@ func (cr *CSVRouter) Process(ents []*entry.Entry) (rset []*entry.Entry, err erro
 	for _, ent := range ents {
 		if ent == nil {
 			continue
-		} else if ent = cr.processItem(ent); ent != nil {
-			rset = append(rset, ent)
+		} else if r := cr.processItem(ent); r != nil {
+			rset = append(rset, r)
+		} else {
+			ent.Release()
 		}
 	}
 	return
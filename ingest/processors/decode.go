@@ -0,0 +1,481 @@
+/*************************************************************************
+ * Copyright 2024 Gravwell, Inc. All rights reserved.
+ * Contact: <legal@gravwell.io>
+ *
+ * This software may be modified and distributed under the terms of the
+ * BSD 2-clause license. See the LICENSE file for details.
+ **************************************************************************/
+
+package processors
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bufbuild/protocompile"
+	"github.com/gravwell/gravwell/v3/ingest/config"
+	"github.com/gravwell/gravwell/v3/ingest/entry"
+	"github.com/linkedin/goavro/v2"
+	"github.com/vmihailenco/msgpack/v5"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+const (
+	DecodeProcessor = `decode`
+
+	DecodeProtobuf = `protobuf`
+	DecodeAvro     = `avro`
+	DecodeMsgpack  = `msgpack`
+
+	confluentMagic     = 0
+	confluentHeaderLen = 5 //magic byte and a big endian schema ID
+
+	protoSourceExt = `.proto`
+	avroSchemaExt  = `.avsc`
+)
+
+var (
+	ErrDecodeUnknownFormat  = errors.New("Format must be one of protobuf, avro, or msgpack")
+	ErrDecodeSchemaSource   = errors.New("Exactly one of Schema-File or Schema-Directory is required")
+	ErrDecodeMsgpackSchema  = errors.New("msgpack does not use schemas or framing")
+	ErrDecodeAvroMultiFile  = errors.New("avro supports a single Schema-File")
+	ErrDecodeMissingMessage = errors.New("Message-Type is required with a protobuf Schema-File")
+	ErrDecodeBadFraming     = errors.New("payload does not have a valid schema registry header")
+
+	decodeFormats = []string{DecodeProtobuf, DecodeAvro, DecodeMsgpack}
+)
+
+type DecodeConfig struct {
+	Format            string   // protobuf, avro, or msgpack
+	Schema_File       []string // .proto sources, protobuf descriptor sets, or an Avro schema
+	Import_Path       []string // directories searched for .proto imports
+	Message_Type      string   // fully qualified protobuf message name
+	Confluent_Framing bool     // payloads start with a magic byte and schema ID
+	Schema_Directory  string   // resolve framed schema IDs from <id>.proto or <id>.avsc files, implies Confluent-Framing
+	Drop_Misses       bool     // drop entries that fail to decode
+}
+
+func DecodeLoadConfig(vc *config.VariableConfig) (c DecodeConfig, err error) {
+	if err = vc.MapTo(&c); err == nil {
+		_, err = c.validate()
+	}
+	return
+}
+
+func (c *DecodeConfig) validate() (format string, err error) {
+	if format = strings.ToLower(strings.TrimSpace(c.Format)); stringInSet(format, decodeFormats) == -1 {
+		err = ErrDecodeUnknownFormat
+		return
+	}
+	if format == DecodeMsgpack {
+		if len(c.Schema_File) > 0 || c.Schema_Directory != `` || c.Confluent_Framing {
+			err = ErrDecodeMsgpackSchema
+		}
+		return
+	}
+	if (len(c.Schema_File) == 0) == (c.Schema_Directory == ``) {
+		err = ErrDecodeSchemaSource
+		return
+	}
+	if c.Schema_Directory != `` {
+		var fi os.FileInfo
+		if fi, err = os.Stat(c.Schema_Directory); err != nil {
+			return
+		} else if !fi.IsDir() {
+			err = fmt.Errorf("Schema-Directory %s is not a directory", c.Schema_Directory)
+		}
+		return
+	}
+	if format == DecodeAvro && len(c.Schema_File) > 1 {
+		err = ErrDecodeAvroMultiFile
+	} else if format == DecodeProtobuf && c.Message_Type == `` {
+		err = ErrDecodeMissingMessage
+	}
+	return
+}
+
+// payloadDecoder converts a single binary payload to JSON
+type payloadDecoder interface {
+	decode([]byte) ([]byte, error)
+}
+
+// Decode converts Protobuf, Avro, and MessagePack payloads into JSON
+type Decode struct {
+	nocloser
+	DecodeConfig
+	format   string
+	dec      payloadDecoder //static schema decoder, nil when using a schema directory
+	registry *schemaDirectory
+}
+
+func NewDecode(cfg DecodeConfig) (*Decode, error) {
+	d := &Decode{}
+	if err := d.init(cfg); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+func (d *Decode) Config(v interface{}) (err error) {
+	if v == nil {
+		err = ErrNilConfig
+	} else if cfg, ok := v.(DecodeConfig); ok {
+		err = d.init(cfg)
+	} else {
+		err = fmt.Errorf("Invalid configuration, unknown type type %T", v)
+	}
+	return
+}
+
+func (d *Decode) init(cfg DecodeConfig) (err error) {
+	var format string
+	var dec payloadDecoder
+	var reg *schemaDirectory
+	if format, err = cfg.validate(); err != nil {
+		return
+	}
+	switch {
+	case format == DecodeMsgpack:
+		dec = msgpackDecoder{}
+	case cfg.Schema_Directory != ``:
+		reg = newSchemaDirectory(cfg.Schema_Directory, format, cfg.Import_Path)
+	case format == DecodeAvro:
+		dec, err = loadAvroDecoder(cfg.Schema_File[0])
+	case format == DecodeProtobuf:
+		dec, err = loadProtoDecoder(cfg.Schema_File, cfg.Import_Path, cfg.Message_Type)
+	}
+	if err != nil {
+		return
+	}
+	d.DecodeConfig, d.format, d.dec, d.registry = cfg, format, dec, reg
+	return
+}
+
+func (d *Decode) Process(ents []*entry.Entry) (rset []*entry.Entry, err error) {
+	if len(ents) == 0 {
+		return
+	}
+	rset = ents[:0]
+	for _, ent := range ents {
+		if ent == nil {
+			continue
+		}
+		if b, err := d.decode(ent.Data); err == nil {
+			ent.Data = b
+		} else if d.Drop_Misses {
+			ent.Release()
+			continue
+		}
+		rset = append(rset, ent)
+	}
+	return
+}
+
+func (d *Decode) decode(b []byte) ([]byte, error) {
+	if d.registry != nil {
+		return d.registry.decode(b)
+	}
+	if d.Confluent_Framing {
+		//the schema is static so the ID is ignored
+		_, rest, err := splitConfluentHeader(b)
+		if err != nil {
+			return nil, err
+		}
+		if d.format == DecodeProtobuf {
+			//Message-Type names the message, so the indexes are skipped
+			if _, rest, err = splitProtoIndexes(rest); err != nil {
+				return nil, err
+			}
+		}
+		b = rest
+	}
+	return d.dec.decode(b)
+}
+
+// splitConfluentHeader removes the magic byte and schema ID used by Confluent style schema registries
+func splitConfluentHeader(b []byte) (id uint32, rest []byte, err error) {
+	if len(b) < confluentHeaderLen || b[0] != confluentMagic {
+		err = ErrDecodeBadFraming
+		return
+	}
+	id = binary.BigEndian.Uint32(b[1:confluentHeaderLen])
+	rest = b[confluentHeaderLen:]
+	return
+}
+
+// splitProtoIndexes removes the message index path that follows the schema ID on protobuf payloads.
+// The path is a zigzag varint count followed by that many zigzag varints, a count of zero means [0].
+func splitProtoIndexes(b []byte) (idx []int, rest []byte, err error) {
+	cnt, n := binary.Varint(b)
+	if n <= 0 || cnt < 0 || cnt > int64(len(b)) {
+		err = ErrDecodeBadFraming
+		return
+	}
+	b = b[n:]
+	if cnt == 0 {
+		return []int{0}, b, nil
+	}
+	for i := int64(0); i < cnt; i++ {
+		v, n := binary.Varint(b)
+		if n <= 0 || v < 0 {
+			err = ErrDecodeBadFraming
+			return
+		}
+		idx = append(idx, int(v))
+		b = b[n:]
+	}
+	rest = b
+	return
+}
+
+type protoDecoder struct {
+	md protoreflect.MessageDescriptor
+}
+
+var protoJSON = protojson.MarshalOptions{UseProtoNames: true}
+
+func (pd protoDecoder) decode(b []byte) ([]byte, error) {
+	msg := dynamicpb.NewMessage(pd.md)
+	if err := proto.Unmarshal(b, msg); err != nil {
+		return nil, err
+	}
+	return protoJSON.Marshal(msg)
+}
+
+// loadProtoFiles compiles .proto sources or reads protobuf descriptor sets, returning the files in the order given
+func loadProtoFiles(pths, imports []string) (fds []protoreflect.FileDescriptor, err error) {
+	for _, pth := range pths {
+		var fd protoreflect.FileDescriptor
+		if strings.EqualFold(filepath.Ext(pth), protoSourceExt) {
+			fd, err = compileProtoFile(pth, imports)
+		} else {
+			fd, err = readDescriptorSet(pth)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("Failed to load protobuf schema %s: %w", pth, err)
+		}
+		fds = append(fds, fd)
+	}
+	return
+}
+
+func compileProtoFile(pth string, imports []string) (protoreflect.FileDescriptor, error) {
+	c := protocompile.Compiler{
+		Resolver: protocompile.WithStandardImports(&protocompile.SourceResolver{
+			ImportPaths: append([]string{filepath.Dir(pth)}, imports...),
+		}),
+	}
+	fs, err := c.Compile(context.Background(), filepath.Base(pth))
+	if err != nil {
+		return nil, err
+	}
+	return fs[0], nil
+}
+
+// readDescriptorSet loads a FileDescriptorSet as written by protoc --descriptor_set_out --include_imports.
+// The last file in the set is the one that was compiled, everything before it is a dependency.
+func readDescriptorSet(pth string) (protoreflect.FileDescriptor, error) {
+	b, err := os.ReadFile(pth)
+	if err != nil {
+		return nil, err
+	}
+	var set descriptorpb.FileDescriptorSet
+	if err = proto.Unmarshal(b, &set); err != nil {
+		return nil, err
+	} else if len(set.File) == 0 {
+		return nil, errors.New("empty descriptor set")
+	}
+	files, err := protodesc.NewFiles(&set)
+	if err != nil {
+		return nil, err
+	}
+	return files.FindFileByPath(set.File[len(set.File)-1].GetName())
+}
+
+func loadProtoDecoder(pths, imports []string, msgType string) (payloadDecoder, error) {
+	fds, err := loadProtoFiles(pths, imports)
+	if err != nil {
+		return nil, err
+	}
+	name := protoreflect.FullName(strings.TrimPrefix(msgType, `.`))
+	for _, fd := range fds {
+		if md := findProtoMessage(fd.Messages(), name); md != nil {
+			return protoDecoder{md: md}, nil
+		}
+	}
+	return nil, fmt.Errorf("Message-Type %s not found", msgType)
+}
+
+func findProtoMessage(mds protoreflect.MessageDescriptors, name protoreflect.FullName) protoreflect.MessageDescriptor {
+	for i := 0; i < mds.Len(); i++ {
+		md := mds.Get(i)
+		if md.FullName() == name {
+			return md
+		} else if r := findProtoMessage(md.Messages(), name); r != nil {
+			return r
+		}
+	}
+	return nil
+}
+
+// protoMessageByIndex walks a registry message index path, the first index selects a
+// top level message and each following index selects a nested message
+func protoMessageByIndex(fd protoreflect.FileDescriptor, idx []int) (md protoreflect.MessageDescriptor, err error) {
+	mds := fd.Messages()
+	for _, i := range idx {
+		if i >= mds.Len() {
+			err = fmt.Errorf("message index %v out of range in %s", idx, fd.Path())
+			return
+		}
+		md = mds.Get(i)
+		mds = md.Messages()
+	}
+	return
+}
+
+type avroDecoder struct {
+	codec *goavro.Codec
+}
+
+func loadAvroDecoder(pth string) (payloadDecoder, error) {
+	b, err := os.ReadFile(pth)
+	if err != nil {
+		return nil, err
+	}
+	//the standard JSON codec writes unions as plain values so JSON paths stay simple
+	codec, err := goavro.NewCodecForStandardJSONFull(string(b))
+	if err != nil {
+		return nil, fmt.Errorf("Failed to load avro schema %s: %w", pth, err)
+	}
+	return avroDecoder{codec: codec}, nil
+}
+
+func (ad avroDecoder) decode(b []byte) ([]byte, error) {
+	native, rest, err := ad.codec.NativeFromBinary(b)
+	if err != nil {
+		return nil, err
+	} else if len(rest) != 0 {
+		return nil, fmt.Errorf("%d trailing bytes after avro record", len(rest))
+	}
+	return ad.codec.TextualFromNative(nil, native)
+}
+
+type msgpackDecoder struct{}
+
+func (msgpackDecoder) decode(b []byte) ([]byte, error) {
+	//msgpack allows any key type, so maps are decoded untyped and fixed up for JSON
+	dec := msgpack.NewDecoder(bytes.NewReader(b))
+	dec.SetMapDecoder(func(d *msgpack.Decoder) (interface{}, error) {
+		return d.DecodeUntypedMap()
+	})
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	return json.Marshal(jsonSafe(v))
+}
+
+// jsonSafe converts maps with non-string keys into maps JSON can encode
+func jsonSafe(v interface{}) interface{} {
+	switch x := v.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(x))
+		for k, vv := range x {
+			m[fmt.Sprint(k)] = jsonSafe(vv)
+		}
+		return m
+	case []interface{}:
+		for i := range x {
+			x[i] = jsonSafe(x[i])
+		}
+	}
+	return v
+}
+
+// schemaDirectory resolves schema registry IDs to schema files in a local directory.
+// Schemas are loaded on first use, IDs without a schema are retried after the reload interval.
+type schemaDirectory struct {
+	dir     string
+	format  string
+	imports []string
+	schemas map[uint32]*registrySchema
+}
+
+type registrySchema struct {
+	avro   payloadDecoder
+	proto  protoreflect.FileDescriptor
+	msgs   map[string]protoDecoder //decoders keyed by message index path
+	err    error
+	loaded time.Time
+}
+
+func newSchemaDirectory(dir, format string, imports []string) *schemaDirectory {
+	return &schemaDirectory{
+		dir:     dir,
+		format:  format,
+		imports: imports,
+		schemas: map[uint32]*registrySchema{},
+	}
+}
+
+func (sd *schemaDirectory) decode(b []byte) ([]byte, error) {
+	id, rest, err := splitConfluentHeader(b)
+	if err != nil {
+		return nil, err
+	}
+	s := sd.schema(id, time.Now())
+	if s.err != nil {
+		return nil, s.err
+	}
+	if s.avro != nil {
+		return s.avro.decode(rest)
+	}
+	idx, rest, err := splitProtoIndexes(rest)
+	if err != nil {
+		return nil, err
+	}
+	key := fmt.Sprint(idx)
+	pd, ok := s.msgs[key]
+	if !ok {
+		md, err := protoMessageByIndex(s.proto, idx)
+		if err != nil {
+			return nil, err
+		}
+		pd = protoDecoder{md: md}
+		s.msgs[key] = pd
+	}
+	return pd.decode(rest)
+}
+
+func (sd *schemaDirectory) schema(id uint32, now time.Time) *registrySchema {
+	if s, ok := sd.schemas[id]; ok && (s.err == nil || now.Sub(s.loaded) < defaultReloadInterval) {
+		return s
+	}
+	s := &registrySchema{loaded: now}
+	name := strconv.FormatUint(uint64(id), 10)
+	if sd.format == DecodeAvro {
+		s.avro, s.err = loadAvroDecoder(filepath.Join(sd.dir, name+avroSchemaExt))
+	} else {
+		var fds []protoreflect.FileDescriptor
+		if fds, s.err = loadProtoFiles([]string{filepath.Join(sd.dir, name+protoSourceExt)}, sd.imports); s.err == nil {
+			s.proto = fds[0]
+			s.msgs = map[string]protoDecoder{}
+		}
+	}
+	sd.schemas[id] = s
+	return s
+}
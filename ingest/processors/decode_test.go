@@ -0,0 +1,294 @@
+/*************************************************************************
+ * Copyright 2024 Gravwell, Inc. All rights reserved.
+ * Contact: <legal@gravwell.io>
+ *
+ * This software may be modified and distributed under the terms of the
+ * BSD 2-clause license. See the LICENSE file for details.
+ **************************************************************************/
+
+package processors
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/gravwell/gravwell/v3/ingest/config"
+	"github.com/gravwell/gravwell/v3/ingest/entry"
+	"github.com/linkedin/goavro/v2"
+	"github.com/vmihailenco/msgpack/v5"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+const (
+	testProto = `syntax = "proto3";
+package test;
+
+message Flow {
+	string src = 1;
+	uint32 port = 2;
+	repeated string tags = 3;
+	message Meta {
+		bool ok = 1;
+	}
+	Meta meta = 4;
+}
+
+message Other {
+	int64 id = 1;
+}
+`
+	testAvroSchema = `{
+	"type": "record",
+	"name": "Flow",
+	"fields": [
+		{"name": "src", "type": "string"},
+		{"name": "port", "type": "int"},
+		{"name": "user", "type": ["null", "string"], "default": null}
+	]
+}`
+)
+
+func writeTestFile(t *testing.T, dir, name, content string) string {
+	t.Helper()
+	pth := filepath.Join(dir, name)
+	if err := os.WriteFile(pth, []byte(content), 0640); err != nil {
+		t.Fatal(err)
+	}
+	return pth
+}
+
+func confluentFrame(id uint32, idx []int64, payload []byte) []byte {
+	b := []byte{confluentMagic, 0, 0, 0, 0}
+	binary.BigEndian.PutUint32(b[1:], id)
+	if idx != nil {
+		b = binary.AppendVarint(b, int64(len(idx)))
+		for _, v := range idx {
+			b = binary.AppendVarint(b, v)
+		}
+	}
+	return append(b, payload...)
+}
+
+// checkJSONEvents compares entry data as JSON, protojson output is not byte stable
+func checkJSONEvents(t *testing.T, ents []*entry.Entry, events ...string) {
+	t.Helper()
+	if len(ents) != len(events) {
+		t.Fatalf("bad event count %d != %d", len(ents), len(events))
+	}
+	for i := range ents {
+		var got, want interface{}
+		if err := json.Unmarshal(ents[i].Data, &got); err != nil {
+			t.Fatalf("event %d is not JSON: %v %q", i, err, ents[i].Data)
+		} else if err = json.Unmarshal([]byte(events[i]), &want); err != nil {
+			t.Fatal(err)
+		} else if !reflect.DeepEqual(got, want) {
+			t.Fatalf("bad event %d:\n%s\n!=\n%s", i, ents[i].Data, events[i])
+		}
+	}
+}
+
+// testFlowPayload builds an encoded test.Flow message from the compiled test schema
+func testFlowPayload(t *testing.T, pth string) []byte {
+	t.Helper()
+	fds, err := loadProtoFiles([]string{pth}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	md := fds[0].Messages().ByName(`Flow`)
+	msg := dynamicpb.NewMessage(md)
+	msg.Set(md.Fields().ByName(`src`), protoreflect.ValueOf(`10.0.0.1`))
+	msg.Set(md.Fields().ByName(`port`), protoreflect.ValueOf(uint32(443)))
+	meta := dynamicpb.NewMessage(md.Messages().ByName(`Meta`))
+	meta.Set(meta.Descriptor().Fields().ByName(`ok`), protoreflect.ValueOf(true))
+	msg.Set(md.Fields().ByName(`meta`), protoreflect.ValueOf(meta))
+	b, err := proto.Marshal(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestDecodeConfig(t *testing.T) {
+	dir := t.TempDir()
+	pth := writeTestFile(t, dir, `flow.proto`, testProto)
+	b := []byte(`
+	[preprocessor "dec"]
+		type = decode
+		Format = protobuf
+		Schema-File = "` + pth + `"
+		Message-Type = test.Flow
+		Confluent-Framing = true
+	`)
+	tc := struct {
+		Preprocessor ProcessorConfig
+	}{}
+	if err := config.LoadConfigBytes(&tc, b); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := DecodeLoadConfig(tc.Preprocessor[`dec`])
+	if err != nil {
+		t.Fatal(err)
+	} else if _, err = NewDecode(cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	bad := []DecodeConfig{
+		DecodeConfig{},
+		DecodeConfig{Format: `thrift`},
+		DecodeConfig{Format: DecodeMsgpack, Confluent_Framing: true},
+		DecodeConfig{Format: DecodeAvro},
+		DecodeConfig{Format: DecodeAvro, Schema_File: []string{`a`, `b`}},
+		DecodeConfig{Format: DecodeProtobuf, Schema_File: []string{pth}},
+		DecodeConfig{Format: DecodeProtobuf, Schema_File: []string{pth}, Schema_Directory: dir},
+		DecodeConfig{Format: DecodeProtobuf, Schema_Directory: pth},
+	}
+	for i, c := range bad {
+		if _, err := c.validate(); err == nil {
+			t.Fatalf("bad config %d did not fail", i)
+		}
+	}
+	if _, err := NewDecode(DecodeConfig{Format: DecodeProtobuf, Schema_File: []string{pth}, Message_Type: `test.Missing`}); err == nil {
+		t.Fatal("missing message type did not fail")
+	}
+}
+
+func TestDecodeProtobuf(t *testing.T) {
+	dir := t.TempDir()
+	pth := writeTestFile(t, dir, `flow.proto`, testProto)
+	payload := testFlowPayload(t, pth)
+	want := `{"src":"10.0.0.1","port":443,"meta":{"ok":true}}`
+
+	d, err := NewDecode(DecodeConfig{Format: DecodeProtobuf, Schema_File: []string{pth}, Message_Type: `test.Flow`, Drop_Misses: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := d.Process([]*entry.Entry{
+		&entry.Entry{Data: payload},
+		&entry.Entry{Data: []byte{0xff, 0xff, 0xff}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkJSONEvents(t, r, want)
+
+	//descriptor sets written by protoc load the same way
+	fds, err := loadProtoFiles([]string{pth}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	set := &descriptorpb.FileDescriptorSet{File: []*descriptorpb.FileDescriptorProto{protodesc.ToFileDescriptorProto(fds[0])}}
+	b, err := proto.Marshal(set)
+	if err != nil {
+		t.Fatal(err)
+	}
+	setPath := writeTestFile(t, dir, `flow.protoset`, string(b))
+	if d, err = NewDecode(DecodeConfig{Format: DecodeProtobuf, Schema_File: []string{setPath}, Message_Type: `test.Flow`, Confluent_Framing: true}); err != nil {
+		t.Fatal(err)
+	}
+	if r, err = d.Process([]*entry.Entry{&entry.Entry{Data: confluentFrame(7, []int64{}, payload)}}); err != nil {
+		t.Fatal(err)
+	}
+	checkJSONEvents(t, r, want)
+}
+
+func TestDecodeAvro(t *testing.T) {
+	dir := t.TempDir()
+	pth := writeTestFile(t, dir, `flow.avsc`, testAvroSchema)
+	codec, err := goavro.NewCodec(testAvroSchema)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, err := codec.BinaryFromNative(nil, map[string]interface{}{`src`: `10.0.0.1`, `port`: 53, `user`: goavro.Union(`string`, `bob`)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := codec.BinaryFromNative(nil, map[string]interface{}{`src`: `10.0.0.2`, `port`: 80, `user`: nil})
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, err := NewDecode(DecodeConfig{Format: DecodeAvro, Schema_File: []string{pth}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	bad := &entry.Entry{Data: []byte(`not avro`)}
+	r, err := d.Process([]*entry.Entry{&entry.Entry{Data: a}, bad, &entry.Entry{Data: b}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkEvents(t, r[1:2], `not avro`) //misses pass through untouched
+	checkJSONEvents(t, []*entry.Entry{r[0], r[2]},
+		`{"src":"10.0.0.1","port":53,"user":"bob"}`,
+		`{"src":"10.0.0.2","port":80,"user":null}`)
+}
+
+func TestDecodeMsgpack(t *testing.T) {
+	b, err := msgpack.Marshal(map[string]interface{}{
+		`src`:  `10.0.0.1`,
+		`n`:    42,
+		`tags`: []string{`a`, `b`},
+		`sub`:  map[int]string{1: `one`},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, err := NewDecode(DecodeConfig{Format: DecodeMsgpack})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := d.Process([]*entry.Entry{&entry.Entry{Data: b}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkJSONEvents(t, r, `{"src":"10.0.0.1","n":42,"tags":["a","b"],"sub":{"1":"one"}}`)
+}
+
+func TestDecodeSchemaDirectory(t *testing.T) {
+	dir := t.TempDir()
+	pth := writeTestFile(t, dir, `3.proto`, testProto)
+	payload := testFlowPayload(t, pth)
+
+	d, err := NewDecode(DecodeConfig{Format: DecodeProtobuf, Schema_Directory: dir, Drop_Misses: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	meta := []byte{0x08, 0x01}  //Meta{ok: true}
+	other := []byte{0x08, 0x2a} //Other{id: 42}
+	r, err := d.Process([]*entry.Entry{
+		&entry.Entry{Data: confluentFrame(3, []int64{}, payload)},
+		&entry.Entry{Data: confluentFrame(3, []int64{0, 0}, meta)},
+		&entry.Entry{Data: confluentFrame(3, []int64{1}, other)},
+		&entry.Entry{Data: confluentFrame(4, []int64{}, payload)}, //unknown schema
+		&entry.Entry{Data: confluentFrame(3, []int64{5}, other)},  //bad index
+		&entry.Entry{Data: payload},                               //missing header
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkJSONEvents(t, r, `{"src":"10.0.0.1","port":443,"meta":{"ok":true}}`, `{"ok":true}`, `{"id":"42"}`)
+
+	adir := t.TempDir()
+	writeTestFile(t, adir, `12.avsc`, testAvroSchema)
+	codec, err := goavro.NewCodec(testAvroSchema)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := codec.BinaryFromNative(nil, map[string]interface{}{`src`: `10.0.0.1`, `port`: 53, `user`: nil})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d, err = NewDecode(DecodeConfig{Format: DecodeAvro, Schema_Directory: adir}); err != nil {
+		t.Fatal(err)
+	}
+	if r, err = d.Process([]*entry.Entry{&entry.Entry{Data: confluentFrame(12, nil, b)}}); err != nil {
+		t.Fatal(err)
+	}
+	checkJSONEvents(t, r, `{"src":"10.0.0.1","port":53,"user":null}`)
+}
@@ -51,5 +51,6 @@ func (gd *Drop) Config(v interface{}) (err error) {
 }
 
 func (gd *Drop) Process(ent []*entry.Entry) (rset []*entry.Entry, err error) {
+	entry.ReleaseSet(ent)
 	return
 }
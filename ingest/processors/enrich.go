@@ -0,0 +1,440 @@
+/*************************************************************************
+ * Copyright 2024 Gravwell, Inc. All rights reserved.
+ * Contact: <legal@gravwell.io>
+ *
+ * This software may be modified and distributed under the terms of the
+ * BSD 2-clause license. See the LICENSE file for details.
+ **************************************************************************/
+
+package processors
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/asergeyev/nradix"
+	"github.com/buger/jsonparser"
+	"github.com/gravwell/gravwell/v3/ingest/config"
+	"github.com/gravwell/gravwell/v3/ingest/entry"
+)
+
+const (
+	EnrichProcessor = `enrich`
+
+	EnrichFormatCSV     = `csv`
+	EnrichFormatIPExist = `ipexist`
+)
+
+var (
+	ErrMissingLookupFile   = errors.New("Lookup-File is required")
+	ErrEnrichKeySources    = errors.New("Only one of Source-IP, JSON-Path, or Regex may be specified")
+	ErrEnrichRegexCapture  = errors.New("Regex must contain exactly one capture group")
+	ErrEnrichMissingFlag   = errors.New("ipexist lookups require Flag-Name")
+	ErrEnrichIPExistAttach = errors.New("ipexist lookups cannot Attach columns")
+	ErrEnrichNothingToAdd  = errors.New("Lookup table has no columns to attach and Flag-Name is not set")
+	ErrEnrichEmptyHeader   = errors.New("Lookup table is missing a header")
+)
+
+type EnrichConfig struct {
+	Lookup_File      string
+	Format           string   // csv (default) or ipexist
+	Key_Column       string   // csv only, defaults to the first column
+	Attach           []string // csv only, columns to attach, defaults to every column other than the key
+	Column_Prefix    string   // prefix added to attached column names
+	Flag_Name        string   // attach a boolean EV with this name indicating if the key was found
+	Source_IP        bool     // use the entry source as the key, this is the default
+	JSON_Path        string   // extract the key from a JSON entry
+	Regex            string   // extract the key with a single capture group
+	Case_Insensitive bool
+	Reload_Interval  string // how often to check the lookup file for changes, defaults to 10s, 0 disables
+	Drop_Misses      bool
+}
+
+func EnrichLoadConfig(vc *config.VariableConfig) (c EnrichConfig, err error) {
+	if err = vc.MapTo(&c); err == nil {
+		_, err = c.validate()
+	}
+	return
+}
+
+type enrichParams struct {
+	format string
+	keys   []string
+	rx     *regexp.Regexp
+	reload time.Duration
+}
+
+func (c *EnrichConfig) validate() (p enrichParams, err error) {
+	if c.Lookup_File = strings.TrimSpace(c.Lookup_File); c.Lookup_File == `` {
+		err = ErrMissingLookupFile
+		return
+	}
+	switch p.format = strings.ToLower(strings.TrimSpace(c.Format)); p.format {
+	case ``:
+		p.format = EnrichFormatCSV
+	case EnrichFormatCSV:
+	case EnrichFormatIPExist:
+		if c.Flag_Name == `` {
+			err = ErrEnrichMissingFlag
+			return
+		} else if len(c.Attach) > 0 || c.Key_Column != `` {
+			err = ErrEnrichIPExistAttach
+			return
+		}
+	default:
+		err = fmt.Errorf("Unknown Format %q", c.Format)
+		return
+	}
+
+	var srcs int
+	if c.Source_IP {
+		srcs++
+	}
+	if c.JSON_Path != `` {
+		if p.keys = unquoteFields(splitRespectQuotes(c.JSON_Path, dotSplitter)); len(p.keys) == 0 {
+			err = fmt.Errorf("Invalid JSON-Path %q", c.JSON_Path)
+			return
+		}
+		srcs++
+	}
+	if c.Regex != `` {
+		if p.rx, err = regexp.Compile(c.Regex); err != nil {
+			return
+		} else if p.rx.NumSubexp() != 1 {
+			err = ErrEnrichRegexCapture
+			return
+		}
+		srcs++
+	}
+	if srcs > 1 {
+		err = ErrEnrichKeySources
+		return
+	}
+	p.reload, err = parseReloadInterval(c.Reload_Interval)
+	return
+}
+
+// enrichTable is a loaded lookup file, row is the set of values to attach
+type enrichTable interface {
+	lookup(key string, ip net.IP) (row []string, ok bool)
+	columns() []string
+	close()
+}
+
+// Enrich attaches values from a lookup table to entries based on a key extracted from each entry
+type Enrich struct {
+	EnrichConfig
+	enrichParams
+	mtx       sync.Mutex
+	tbl       enrichTable
+	stamp     fileStamp
+	names     []string //EV names for the table columns
+	lastCheck time.Time
+}
+
+func NewEnrich(cfg EnrichConfig) (e *Enrich, err error) {
+	var p enrichParams
+	if p, err = cfg.validate(); err != nil {
+		return
+	}
+	ne := &Enrich{
+		EnrichConfig: cfg,
+		enrichParams: p,
+		lastCheck:    time.Now(),
+	}
+	if err = ne.load(); err != nil {
+		return
+	}
+	e = ne
+	return
+}
+
+func (e *Enrich) Config(v interface{}) (err error) {
+	if v == nil {
+		err = ErrNilConfig
+	} else if cfg, ok := v.(EnrichConfig); ok {
+		var ne *Enrich
+		if ne, err = NewEnrich(cfg); err == nil {
+			e.mtx.Lock()
+			if e.tbl != nil {
+				e.tbl.close()
+			}
+			e.EnrichConfig, e.enrichParams = ne.EnrichConfig, ne.enrichParams
+			e.tbl, e.stamp, e.names, e.lastCheck = ne.tbl, ne.stamp, ne.names, ne.lastCheck
+			e.mtx.Unlock()
+		}
+	} else {
+		err = fmt.Errorf("Invalid configuration, unknown type type %T", v)
+	}
+	return
+}
+
+func (e *Enrich) Flush() []*entry.Entry {
+	return nil
+}
+
+func (e *Enrich) Close() error {
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+	if e.tbl != nil {
+		e.tbl.close()
+		e.tbl = nil
+	}
+	return nil
+}
+
+// load reads the lookup file and swaps it in, on failure the existing table is left alone
+func (e *Enrich) load() (err error) {
+	var fi os.FileInfo
+	var tbl enrichTable
+	if fi, err = os.Stat(e.Lookup_File); err != nil {
+		return
+	}
+	switch e.format {
+	case EnrichFormatIPExist:
+		tbl, err = loadIPExistTable(e.Lookup_File)
+	default:
+		tbl, err = loadCSVTable(e.Lookup_File, e.Key_Column, e.Attach, e.Case_Insensitive)
+	}
+	if err != nil {
+		err = fmt.Errorf("Failed to load %s: %w", e.Lookup_File, err)
+		return
+	}
+	cols := tbl.columns()
+	if len(cols) == 0 && e.Flag_Name == `` {
+		tbl.close()
+		err = ErrEnrichNothingToAdd
+		return
+	}
+	names := make([]string, 0, len(cols))
+	for _, c := range cols {
+		names = append(names, e.Column_Prefix+c)
+	}
+	if e.tbl != nil {
+		e.tbl.close()
+	}
+	e.tbl, e.names, e.stamp = tbl, names, newFileStamp(e.Lookup_File, fi)
+	return
+}
+
+// checkReload reloads the lookup file if it changed, the caller must hold the lock
+func (e *Enrich) checkReload(now time.Time) {
+	if e.reload == 0 || now.Sub(e.lastCheck) < e.reload {
+		return
+	}
+	e.lastCheck = now
+	if e.stamp.changed() {
+		e.load() //failures keep the existing table
+	}
+}
+
+func (e *Enrich) Process(ents []*entry.Entry) (rset []*entry.Entry, err error) {
+	if len(ents) == 0 {
+		return
+	}
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+	if e.tbl == nil {
+		return nil, ErrNotReady
+	}
+	e.checkReload(time.Now())
+	rset = ents[:0]
+	for _, ent := range ents {
+		if ent == nil {
+			continue
+		}
+		if e.processEntry(ent) || !e.Drop_Misses {
+			rset = append(rset, ent)
+		} else {
+			ent.Release()
+		}
+	}
+	return
+}
+
+func (e *Enrich) processEntry(ent *entry.Entry) (hit bool) {
+	key, ip, ok := e.extract(ent)
+	if !ok {
+		return
+	}
+	var row []string
+	row, hit = e.tbl.lookup(key, ip)
+	if e.Flag_Name != `` {
+		ent.AddEnumeratedValue(entry.EnumeratedValue{Name: e.Flag_Name, Value: entry.BoolEnumData(hit)})
+	}
+	for i, v := range row {
+		if i < len(e.names) {
+			ent.AddEnumeratedValue(entry.EnumeratedValue{Name: e.names[i], Value: entry.StringEnumData(v)})
+		}
+	}
+	return
+}
+
+func (e *Enrich) extract(ent *entry.Entry) (key string, ip net.IP, ok bool) {
+	switch {
+	case e.keys != nil:
+		var v []byte
+		var err error
+		if v, _, _, err = jsonparser.Get(ent.Data, e.keys...); err != nil {
+			return
+		}
+		key = string(v)
+	case e.rx != nil:
+		mtchs := e.rx.FindSubmatch(ent.Data)
+		if len(mtchs) != 2 || mtchs[1] == nil {
+			return
+		}
+		key = string(mtchs[1])
+	default:
+		if ent.SRC == nil {
+			return
+		}
+		ip = ent.SRC
+		key, ok = ip.String(), true
+		return
+	}
+	key = strings.TrimSpace(key)
+	ip = net.ParseIP(key)
+	ok = key != ``
+	return
+}
+
+type csvTable struct {
+	cols []string
+	rows [][]string
+	exct map[string]int
+	tree *nradix.Tree
+	ci   bool
+}
+
+// loadCSVTable loads a CSV lookup table with a header.  Keys that are IPs are normalized and
+// keys that are CIDRs are matched against IP keys.  The first occurrence of a key wins.
+func loadCSVTable(pth, keyCol string, attach []string, ci bool) (ct *csvTable, err error) {
+	var fin *os.File
+	if fin, err = os.Open(pth); err != nil {
+		return
+	}
+	defer fin.Close()
+	rdr := csv.NewReader(fin)
+	rdr.Comment = '#'
+	rdr.TrimLeadingSpace = true
+	var hdr []string
+	if hdr, err = rdr.Read(); err != nil {
+		if err == io.EOF {
+			err = ErrEnrichEmptyHeader
+		}
+		return
+	}
+	for i := range hdr {
+		hdr[i] = strings.TrimSpace(hdr[i])
+	}
+	kidx := 0
+	if keyCol = strings.TrimSpace(keyCol); keyCol != `` {
+		if kidx = stringInSet(keyCol, hdr); kidx == -1 {
+			err = fmt.Errorf("Key-Column %q is not in the header", keyCol)
+			return
+		}
+	}
+	var idxs []int
+	if len(attach) == 0 {
+		for i := range hdr {
+			if i != kidx {
+				idxs = append(idxs, i)
+			}
+		}
+	} else {
+		for _, a := range attach {
+			idx := stringInSet(strings.TrimSpace(a), hdr)
+			if idx == -1 {
+				err = fmt.Errorf("Attach column %q is not in the header", a)
+				return
+			}
+			idxs = append(idxs, idx)
+		}
+	}
+	ct = &csvTable{
+		exct: map[string]int{},
+		ci:   ci,
+	}
+	for _, idx := range idxs {
+		ct.cols = append(ct.cols, hdr[idx])
+	}
+	var rec []string
+	for {
+		if rec, err = rdr.Read(); err != nil {
+			if err == io.EOF {
+				err = nil
+				break
+			}
+			ct = nil
+			return
+		}
+		row := make([]string, 0, len(idxs))
+		for _, idx := range idxs {
+			row = append(row, rec[idx])
+		}
+		if err = ct.add(strings.TrimSpace(rec[kidx]), row); err != nil {
+			ct = nil
+			return
+		}
+	}
+	return
+}
+
+func (ct *csvTable) add(key string, row []string) (err error) {
+	if ct.ci {
+		key = strings.ToLower(key)
+	}
+	if _, _, lerr := net.ParseCIDR(key); lerr == nil {
+		if ct.tree == nil {
+			ct.tree = nradix.NewTree(32)
+		}
+		ct.rows = append(ct.rows, row)
+		if err = ct.tree.AddCIDR(key, len(ct.rows)-1); err == nradix.ErrNodeBusy {
+			err = nil //duplicate, first one wins
+		}
+		return
+	} else if ip := net.ParseIP(key); ip != nil {
+		key = ip.String()
+	}
+	if _, ok := ct.exct[key]; !ok {
+		ct.rows = append(ct.rows, row)
+		ct.exct[key] = len(ct.rows) - 1
+	}
+	return
+}
+
+func (ct *csvTable) lookup(key string, ip net.IP) (row []string, ok bool) {
+	if ip != nil {
+		key = ip.String()
+	} else if ct.ci {
+		key = strings.ToLower(key)
+	}
+	var idx int
+	if idx, ok = ct.exct[key]; ok {
+		row = ct.rows[idx]
+		return
+	}
+	if ip != nil && ct.tree != nil {
+		if v, err := ct.tree.FindCIDR(key); err == nil && v != nil {
+			if idx, ok = v.(int); ok {
+				row = ct.rows[idx]
+			}
+		}
+	}
+	return
+}
+
+func (ct *csvTable) columns() []string {
+	return ct.cols
+}
+
+func (ct *csvTable) close() {}
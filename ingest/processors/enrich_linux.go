@@ -0,0 +1,49 @@
+/*************************************************************************
+ * Copyright 2024 Gravwell, Inc. All rights reserved.
+ * Contact: <legal@gravwell.io>
+ *
+ * This software may be modified and distributed under the terms of the
+ * BSD 2-clause license. See the LICENSE file for details.
+ **************************************************************************/
+
+package processors
+
+import (
+	"net"
+	"os"
+
+	"github.com/gravwell/gravwell/v3/ipexist"
+)
+
+type ipexistTable struct {
+	bm *ipexist.IpBitMap
+}
+
+func loadIPExistTable(pth string) (t enrichTable, err error) {
+	var fin *os.File
+	var bm *ipexist.IpBitMap
+	if fin, err = os.Open(pth); err != nil {
+		return
+	}
+	defer fin.Close()
+	if bm, err = ipexist.LoadIPBitMap(fin); err == nil {
+		t = &ipexistTable{bm: bm}
+	}
+	return
+}
+
+func (t *ipexistTable) lookup(key string, ip net.IP) (row []string, ok bool) {
+	if ip != nil {
+		//anything that is not an IP is an error, which is a miss
+		ok, _ = t.bm.IPExists(ip)
+	}
+	return
+}
+
+func (t *ipexistTable) columns() []string {
+	return nil
+}
+
+func (t *ipexistTable) close() {
+	t.bm.Close()
+}
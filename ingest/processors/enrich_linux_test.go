@@ -0,0 +1,64 @@
+/*************************************************************************
+ * Copyright 2024 Gravwell, Inc. All rights reserved.
+ * Contact: <legal@gravwell.io>
+ *
+ * This software may be modified and distributed under the terms of the
+ * BSD 2-clause license. See the LICENSE file for details.
+ **************************************************************************/
+
+package processors
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gravwell/gravwell/v3/ingest/entry"
+	"github.com/gravwell/gravwell/v3/ipexist"
+)
+
+func TestEnrichIPExist(t *testing.T) {
+	pth := filepath.Join(t.TempDir(), `bad.ipx`)
+	bm := ipexist.NewIPBitMap()
+	for _, v := range []string{`1.2.3.4`, `8.8.8.8`} {
+		if err := bm.AddIP(net.ParseIP(v)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	fout, err := os.Create(pth)
+	if err != nil {
+		t.Fatal(err)
+	} else if err = bm.Encode(fout); err != nil {
+		t.Fatal(err)
+	} else if err = fout.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	e, err := NewEnrich(EnrichConfig{
+		Lookup_File: pth,
+		Format:      EnrichFormatIPExist,
+		Flag_Name:   `threat`,
+		Regex:       `dst=(\S+)`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer e.Close()
+	ents := []*entry.Entry{
+		&entry.Entry{Data: []byte(`dst=8.8.8.8`)},
+		&entry.Entry{Data: []byte(`dst=8.8.4.4`)},
+		&entry.Entry{Data: []byte(`dst=::1`)},
+		&entry.Entry{Data: []byte(`dst=notanip`)},
+	}
+	r, err := e.Process(ents)
+	if err != nil {
+		t.Fatal(err)
+	} else if len(r) != 4 {
+		t.Fatalf("bad result count %d", len(r))
+	}
+	checkEV(t, r[0], `threat`, true)
+	checkEV(t, r[1], `threat`, false)
+	checkEV(t, r[2], `threat`, false)
+	checkEV(t, r[3], `threat`, false)
+}
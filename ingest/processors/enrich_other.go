@@ -0,0 +1,24 @@
+//go:build !linux
+// +build !linux
+
+/*************************************************************************
+ * Copyright 2024 Gravwell, Inc. All rights reserved.
+ * Contact: <legal@gravwell.io>
+ *
+ * This software may be modified and distributed under the terms of the
+ * BSD 2-clause license. See the LICENSE file for details.
+ **************************************************************************/
+
+package processors
+
+import (
+	"errors"
+)
+
+var (
+	ErrIPExistNotSupported = errors.New("ipexist lookup files are only supported on Linux")
+)
+
+func loadIPExistTable(pth string) (enrichTable, error) {
+	return nil, ErrIPExistNotSupported
+}
@@ -0,0 +1,218 @@
+/*************************************************************************
+ * Copyright 2024 Gravwell, Inc. All rights reserved.
+ * Contact: <legal@gravwell.io>
+ *
+ * This software may be modified and distributed under the terms of the
+ * BSD 2-clause license. See the LICENSE file for details.
+ **************************************************************************/
+
+package processors
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gravwell/gravwell/v3/ingest/config"
+	"github.com/gravwell/gravwell/v3/ingest/entry"
+)
+
+const testEnrichCSV = `ip,owner,severity
+# comments are ignored
+10.0.0.1,alice,low
+10.1.0.0/16,lab,medium
+dead::beef,bob,high
+10.0.0.1,duplicate,ignored
+`
+
+func writeEnrichFile(t *testing.T, content string) string {
+	pth := filepath.Join(t.TempDir(), `lookup.csv`)
+	if err := os.WriteFile(pth, []byte(content), 0640); err != nil {
+		t.Fatal(err)
+	}
+	return pth
+}
+
+func TestEnrichConfig(t *testing.T) {
+	b := []byte(`
+	[preprocessor "intel"]
+		type = enrich
+		Lookup-File = /tmp/intel.csv
+		JSON-Path = "client.ip"
+		Attach = owner
+		Flag-Name = threat
+		Reload-Interval = 30s
+	`)
+	tc := struct {
+		Preprocessor ProcessorConfig
+	}{}
+	if err := config.LoadConfigBytes(&tc, b); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := EnrichLoadConfig(tc.Preprocessor[`intel`])
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := cfg.validate()
+	if err != nil {
+		t.Fatal(err)
+	} else if p.format != EnrichFormatCSV || len(p.keys) != 2 || p.reload != 30*time.Second {
+		t.Fatalf("bad config: %+v", p)
+	}
+
+	bad := []EnrichConfig{
+		EnrichConfig{},
+		EnrichConfig{Lookup_File: `x`, Format: `xml`},
+		EnrichConfig{Lookup_File: `x`, Format: EnrichFormatIPExist},
+		EnrichConfig{Lookup_File: `x`, Format: EnrichFormatIPExist, Flag_Name: `x`, Attach: []string{`a`}},
+		EnrichConfig{Lookup_File: `x`, Source_IP: true, JSON_Path: `a.b`},
+		EnrichConfig{Lookup_File: `x`, Regex: `(a)(b)`},
+		EnrichConfig{Lookup_File: `x`, Regex: `ab`},
+		EnrichConfig{Lookup_File: `x`, Reload_Interval: `soon`},
+	}
+	for i, c := range bad {
+		if _, err := c.validate(); err == nil {
+			t.Fatalf("bad config %d did not fail", i)
+		}
+	}
+
+	//columns must exist
+	pth := writeEnrichFile(t, testEnrichCSV)
+	if _, err := NewEnrich(EnrichConfig{Lookup_File: pth, Key_Column: `nope`}); err == nil {
+		t.Fatal("missing key column did not fail")
+	} else if _, err = NewEnrich(EnrichConfig{Lookup_File: pth, Attach: []string{`nope`}}); err == nil {
+		t.Fatal("missing attach column did not fail")
+	}
+}
+
+func TestEnrichSource(t *testing.T) {
+	pth := writeEnrichFile(t, testEnrichCSV)
+	e, err := NewEnrich(EnrichConfig{
+		Lookup_File:   pth,
+		Column_Prefix: `intel_`,
+		Flag_Name:     `threat`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer e.Close()
+	ents := []*entry.Entry{
+		&entry.Entry{SRC: net.ParseIP(`10.0.0.1`)},
+		&entry.Entry{SRC: net.ParseIP(`10.1.2.3`)},
+		&entry.Entry{SRC: net.ParseIP(`dead:0::beef`)},
+		&entry.Entry{SRC: net.ParseIP(`192.168.1.1`)},
+	}
+	r, err := e.Process(ents)
+	if err != nil {
+		t.Fatal(err)
+	} else if len(r) != 4 {
+		t.Fatalf("bad result count %d", len(r))
+	}
+	checkEV(t, r[0], `intel_owner`, `alice`)
+	checkEV(t, r[0], `intel_severity`, `low`)
+	checkEV(t, r[0], `threat`, true)
+	checkEV(t, r[1], `intel_owner`, `lab`)
+	checkEV(t, r[2], `intel_severity`, `high`)
+	checkEV(t, r[3], `threat`, false)
+	if _, ok := r[3].GetEnumeratedValue(`intel_owner`); ok {
+		t.Fatal("miss got columns")
+	}
+
+	e.Drop_Misses = true
+	ents = []*entry.Entry{
+		&entry.Entry{SRC: net.ParseIP(`192.168.1.1`)},
+		&entry.Entry{SRC: net.ParseIP(`10.1.0.1`)},
+	}
+	if r, err = e.Process(ents); err != nil {
+		t.Fatal(err)
+	} else if len(r) != 1 {
+		t.Fatalf("bad result count %d", len(r))
+	}
+	checkEV(t, r[0], `intel_owner`, `lab`)
+}
+
+func TestEnrichExtract(t *testing.T) {
+	pth := writeEnrichFile(t, "user,dept,title\nAlice,eng,dev\nbob,ops,admin\n")
+	e, err := NewEnrich(EnrichConfig{
+		Lookup_File:      pth,
+		JSON_Path:        `who.name`,
+		Attach:           []string{`dept`},
+		Case_Insensitive: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer e.Close()
+	ents := []*entry.Entry{
+		&entry.Entry{Data: []byte(`{"who":{"name":"alice"}}`)},
+		&entry.Entry{Data: []byte(`{"who":{"name":"BOB"}}`)},
+		&entry.Entry{Data: []byte(`not json`)},
+	}
+	r, err := e.Process(ents)
+	if err != nil {
+		t.Fatal(err)
+	} else if len(r) != 3 {
+		t.Fatalf("bad result count %d", len(r))
+	}
+	checkEV(t, r[0], `dept`, `eng`)
+	checkEV(t, r[1], `dept`, `ops`)
+	if _, ok := r[1].GetEnumeratedValue(`title`); ok {
+		t.Fatal("got unrequested column")
+	} else if r[2].EVB.Count() != 0 {
+		t.Fatal("non-JSON entry got EVs")
+	}
+
+	e, err = NewEnrich(EnrichConfig{
+		Lookup_File: pth,
+		Regex:       `user=(\S+)`,
+		Key_Column:  `dept`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer e.Close()
+	ent := &entry.Entry{Data: []byte(`action=login user=ops`)}
+	if _, err = e.Process([]*entry.Entry{ent}); err != nil {
+		t.Fatal(err)
+	}
+	checkEV(t, ent, `user`, `bob`)
+	checkEV(t, ent, `title`, `admin`)
+}
+
+func TestEnrichReload(t *testing.T) {
+	pth := writeEnrichFile(t, "ip,owner\n10.0.0.1,alice\n")
+	e, err := NewEnrich(EnrichConfig{Lookup_File: pth})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer e.Close()
+	process := func(owner string) {
+		t.Helper()
+		ent := &entry.Entry{SRC: net.ParseIP(`10.0.0.1`)}
+		if _, err := e.Process([]*entry.Entry{ent}); err != nil {
+			t.Fatal(err)
+		}
+		checkEV(t, ent, `owner`, owner)
+	}
+	process(`alice`)
+
+	if err = os.WriteFile(pth, []byte("ip,owner\n10.0.0.1,carol\n"), 0640); err != nil {
+		t.Fatal(err)
+	}
+	future := time.Now().Add(time.Hour)
+	if err = os.Chtimes(pth, future, future); err != nil {
+		t.Fatal(err)
+	}
+	process(`alice`)
+	e.lastCheck = time.Time{}
+	process(`carol`)
+
+	//broken files keep the existing table
+	if err = os.WriteFile(pth, []byte("ip,owner\n10.0.0.1\n"), 0640); err != nil {
+		t.Fatal(err)
+	}
+	e.lastCheck = time.Time{}
+	process(`carol`)
+}
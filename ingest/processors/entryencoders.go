@@ -10,7 +10,6 @@ package processors
 
 import (
 	"bufio"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
@@ -58,8 +57,8 @@ func (tt *tagTrans) TagName(tag entry.EntryTag) (s string) {
 	return
 }
 
+// jsonEncoder writes entries as canonical JSON, one per line, with the tag name attached
 type jsonEncoder struct {
-	*json.Encoder
 	wtr  io.Writer
 	bwtr *bufio.Writer
 	tt   *tagTrans
@@ -71,18 +70,12 @@ func newJSONEncoder(wtr io.Writer, tgr Tagger) (*jsonEncoder, error) {
 	}
 	bwtr := bufio.NewWriter(wtr)
 	return &jsonEncoder{
-		Encoder: json.NewEncoder(bwtr),
-		wtr:     wtr,
-		bwtr:    bwtr,
-		tt:      newTagTrans(tgr),
+		wtr:  wtr,
+		bwtr: bwtr,
+		tt:   newTagTrans(tgr),
 	}, nil
 }
 
-type tagStringEntry struct {
-	*entry.Entry
-	Tag string
-}
-
 // Encode will throw an empty JSON object rather than nothing on nil entries
 func (je *jsonEncoder) Encode(ent *entry.Entry) (err error) {
 	if ent == nil {
@@ -90,11 +83,10 @@ func (je *jsonEncoder) Encode(ent *entry.Entry) (err error) {
 			return
 		}
 	} else {
-		tse := tagStringEntry{
-			Entry: ent,
-			Tag:   je.tt.TagName(ent.Tag),
-		}
-		if err = je.Encoder.Encode(tse); err != nil {
+		var b []byte
+		if b, err = ent.MarshalCanonicalJSONTag(je.tt.TagName(ent.Tag)); err != nil {
+			return
+		} else if _, err = je.bwtr.Write(append(b, '\n')); err != nil {
 			return
 		}
 	}
@@ -105,7 +97,6 @@ func (je *jsonEncoder) Encode(ent *entry.Entry) (err error) {
 func (je *jsonEncoder) Reset(wtr io.Writer) {
 	je.wtr = wtr
 	je.bwtr.Reset(wtr)
-	je.Encoder = json.NewEncoder(je.bwtr)
 }
 
 type rawEncoder struct {
@@ -0,0 +1,68 @@
+/*************************************************************************
+ * Copyright 2024 Gravwell, Inc. All rights reserved.
+ * Contact: <legal@gravwell.io>
+ *
+ * This software may be modified and distributed under the terms of the
+ * BSD 2-clause license. See the LICENSE file for details.
+ **************************************************************************/
+
+package processors
+
+import (
+	"bufio"
+	"bytes"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/gravwell/gravwell/v3/ingest/entry"
+)
+
+func TestJSONEncoderCanonical(t *testing.T) {
+	tgr := &testTagger{}
+	tag, _ := tgr.NegotiateTag(`foo`)
+	ent := &entry.Entry{
+		TS:   entry.FromStandard(time.Date(2024, 1, 2, 3, 4, 5, 6, time.UTC)),
+		SRC:  net.ParseIP(`10.0.0.1`),
+		Tag:  tag,
+		Data: []byte(`hello`),
+	}
+	ent.AddEnumeratedValueEx(`ip`, net.ParseIP(`192.168.1.1`))
+	ent.AddEnumeratedValueEx(`port`, uint16(443))
+	ent.AddEnumeratedValueEx(`dur`, time.Second)
+
+	var bb bytes.Buffer
+	enc, err := newJSONEncoder(&bb, tgr)
+	if err != nil {
+		t.Fatal(err)
+	} else if err = enc.Encode(ent); err != nil {
+		t.Fatal(err)
+	} else if err = enc.Encode(nil); err != nil {
+		t.Fatal(err)
+	}
+
+	sc := bufio.NewScanner(&bb)
+	if !sc.Scan() {
+		t.Fatal("missing encoded entry")
+	}
+	var got entry.Entry
+	name, err := got.UnmarshalCanonicalJSONTag(sc.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	} else if name != `foo` {
+		t.Fatalf("bad tag name %q", name)
+	} else if !got.TS.Equal(ent.TS) || !got.SRC.Equal(ent.SRC) || string(got.Data) != `hello` {
+		t.Fatalf("bad entry %+v", got)
+	}
+	//enumerated values keep their types
+	if v, ok := got.GetEnumeratedValue(`port`); !ok || v != uint16(443) {
+		t.Fatalf("bad port %T %v", v, v)
+	} else if v, ok = got.GetEnumeratedValue(`dur`); !ok || v != time.Second {
+		t.Fatalf("bad duration %T %v", v, v)
+	} else if v, ok = got.GetEnumeratedValue(`ip`); !ok || !v.(net.IP).Equal(net.ParseIP(`192.168.1.1`)) {
+		t.Fatalf("bad ip %T %v", v, v)
+	}
+	if !sc.Scan() || sc.Text() != `{}` {
+		t.Fatalf("nil entry was not encoded as an empty object: %q", sc.Text())
+	}
+}
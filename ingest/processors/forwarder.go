@@ -163,18 +163,24 @@ func (nf *Forwarder) Process(ents []*entry.Entry) ([]*entry.Entry, error) {
 	return ents, nil
 }
 
+// the entry continues down the processor chain while it waits to be sent,
+// so queued entries hold their own reference
 func (nf *Forwarder) blockingProcess(ent *entry.Entry) {
+	ent.Retain()
 	select {
 	case <-nf.abrt: //aborted on close
+		ent.Release()
 	case nf.ch <- ent:
 	}
 	return
 }
 
 func (nf *Forwarder) nonblockingProcess(ent *entry.Entry) {
+	ent.Retain()
 	select {
 	case nf.ch <- ent:
 	default: //if we can't write, sorry, ROLL ON!
+		ent.Release()
 	}
 	return
 }
@@ -287,7 +293,9 @@ func (nf *Forwarder) routine(conn net.Conn) {
 	}
 
 	for ent, ok := nf.getEnt(); ok == true; ent, ok = nf.getEnt() {
-		if conn, nf.err = nf.sendEntry(ent, conn); nf.err != nil {
+		conn, nf.err = nf.sendEntry(ent, conn)
+		ent.Release()
+		if nf.err != nil {
 			break
 		}
 	}
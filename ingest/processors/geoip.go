@@ -0,0 +1,498 @@
+/*************************************************************************
+ * Copyright 2024 Gravwell, Inc. All rights reserved.
+ * Contact: <legal@gravwell.io>
+ *
+ * This software may be modified and distributed under the terms of the
+ * BSD 2-clause license. See the LICENSE file for details.
+ **************************************************************************/
+
+package processors
+
+import (
+	"container/list"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/buger/jsonparser"
+	"github.com/gravwell/gravwell/v3/ingest/config"
+	"github.com/gravwell/gravwell/v3/ingest/entry"
+	"github.com/oschwald/maxminddb-golang"
+)
+
+const (
+	GeoIPProcessor = `geoip`
+
+	geoipDefaultCacheSize  = 4096
+	geoipDefaultLanguage   = `en`
+	geoipSrcName           = `src`
+	geoipMaxDatabaseSize   = 1024 * 1024 * 1024
+	geoipAttachCountry     = `country`
+	geoipAttachCountryName = `country_name`
+	geoipAttachCity        = `city`
+	geoipAttachLat         = `lat`
+	geoipAttachLong        = `long`
+	geoipAttachASN         = `asn`
+	geoipAttachASOrg       = `asorg`
+)
+
+var (
+	ErrMissingDatabase   = errors.New("At least one Database is required")
+	ErrGeoIPNoExtraction = errors.New("Regex must contain at least one named capture group")
+
+	geoipAttachments = []string{
+		geoipAttachCountry,
+		geoipAttachCountryName,
+		geoipAttachCity,
+		geoipAttachLat,
+		geoipAttachLong,
+		geoipAttachASN,
+		geoipAttachASOrg,
+	}
+)
+
+type GeoIPConfig struct {
+	Database        []string // MaxMind format database files, City/Country and ASN databases may be combined
+	Source_IP       bool     // look up the entry source, this is the default if no other extractions are given
+	JSON_Path       []string // dotted paths to IPs in JSON entries
+	Regex           string   // regular expression with named capture groups extracting IPs
+	Attach          []string // set of enrichments to attach, defaults to all of them
+	Language        string   // language for country and city names, defaults to en
+	Cache_Size      int      // number of lookups to cache, defaults to 4096, a negative value disables the cache
+	Reload_Interval string   // how often to check the database files for changes, defaults to 10s, 0 disables
+	Drop_Misses     bool     // drop entries where no IP resolved to anything
+}
+
+func GeoIPLoadConfig(vc *config.VariableConfig) (c GeoIPConfig, err error) {
+	if err = vc.MapTo(&c); err == nil {
+		_, err = c.validate()
+	}
+	return
+}
+
+type geoipExtraction struct {
+	name string   // prefix used for attached EVs
+	keys []string // JSON path
+	idx  int      // regex submatch index
+}
+
+type geoipParams struct {
+	rx      *regexp.Regexp
+	src     bool
+	jsn     []geoipExtraction
+	rxs     []geoipExtraction
+	attach  map[string]bool
+	reload  time.Duration
+	lang    string
+	cacheSz int
+	dbPaths []string
+}
+
+func (c *GeoIPConfig) validate() (p geoipParams, err error) {
+	if len(c.Database) == 0 {
+		err = ErrMissingDatabase
+		return
+	}
+	for _, db := range c.Database {
+		if db = strings.TrimSpace(db); db == `` {
+			err = ErrMissingDatabase
+			return
+		}
+		p.dbPaths = append(p.dbPaths, db)
+	}
+	p.src = c.Source_IP
+	for _, pth := range c.JSON_Path {
+		if pth = strings.TrimSpace(pth); pth == `` {
+			continue
+		}
+		keys := unquoteFields(splitRespectQuotes(pth, dotSplitter))
+		if len(keys) == 0 {
+			err = fmt.Errorf("Invalid JSON-Path %q", pth)
+			return
+		}
+		p.jsn = append(p.jsn, geoipExtraction{name: keys[len(keys)-1], keys: keys})
+	}
+	if c.Regex != `` {
+		if p.rx, err = regexp.Compile(c.Regex); err != nil {
+			return
+		}
+		for i, n := range p.rx.SubexpNames() {
+			if n != `` {
+				p.rxs = append(p.rxs, geoipExtraction{name: n, idx: i})
+			}
+		}
+		if len(p.rxs) == 0 {
+			err = ErrGeoIPNoExtraction
+			return
+		}
+	}
+	if !p.src && len(p.jsn) == 0 && len(p.rxs) == 0 {
+		p.src = true
+	}
+
+	p.attach = map[string]bool{}
+	if len(c.Attach) == 0 {
+		for _, a := range geoipAttachments {
+			p.attach[a] = true
+		}
+	} else {
+		for _, a := range c.Attach {
+			a = strings.ToLower(strings.TrimSpace(a))
+			if stringInSet(a, geoipAttachments) == -1 {
+				err = fmt.Errorf("Unknown Attach value %q, must be one of %s", a, strings.Join(geoipAttachments, ", "))
+				return
+			}
+			p.attach[a] = true
+		}
+	}
+
+	if p.lang = strings.TrimSpace(c.Language); p.lang == `` {
+		p.lang = geoipDefaultLanguage
+	}
+	if p.cacheSz = c.Cache_Size; p.cacheSz == 0 {
+		p.cacheSz = geoipDefaultCacheSize
+	} else if p.cacheSz < 0 {
+		p.cacheSz = 0
+	}
+	p.reload, err = parseReloadInterval(c.Reload_Interval)
+	return
+}
+
+// geoipRecord covers the fields we use from both the City/Country and ASN databases
+type geoipRecord struct {
+	Country struct {
+		ISOCode string            `maxminddb:"iso_code"`
+		Names   map[string]string `maxminddb:"names"`
+	} `maxminddb:"country"`
+	City struct {
+		Names map[string]string `maxminddb:"names"`
+	} `maxminddb:"city"`
+	Location struct {
+		Latitude  *float64 `maxminddb:"latitude"`
+		Longitude *float64 `maxminddb:"longitude"`
+	} `maxminddb:"location"`
+	ASN   uint32 `maxminddb:"autonomous_system_number"`
+	ASOrg string `maxminddb:"autonomous_system_organization"`
+}
+
+// geoipResult is a resolved lookup, ok is false if no database knew about the address
+type geoipResult struct {
+	ok          bool
+	country     string
+	countryName string
+	city        string
+	hasLoc      bool
+	lat         float64
+	long        float64
+	asn         uint32
+	asorg       string
+}
+
+type geoipDB struct {
+	fileStamp
+	rdr *maxminddb.Reader
+}
+
+// GeoIP enriches entries with geographic and ASN information from MaxMind format databases
+type GeoIP struct {
+	GeoIPConfig
+	geoipParams
+	mtx       sync.Mutex
+	dbs       []*geoipDB
+	cache     *geoipCache
+	lastCheck time.Time
+}
+
+func NewGeoIP(cfg GeoIPConfig) (g *GeoIP, err error) {
+	var p geoipParams
+	if p, err = cfg.validate(); err != nil {
+		return
+	}
+	ng := &GeoIP{
+		GeoIPConfig: cfg,
+		geoipParams: p,
+		cache:       newGeoIPCache(p.cacheSz),
+		lastCheck:   time.Now(),
+	}
+	for _, pth := range p.dbPaths {
+		db := &geoipDB{fileStamp: fileStamp{path: pth}}
+		if err = db.load(); err != nil {
+			ng.closeDatabases()
+			return
+		}
+		ng.dbs = append(ng.dbs, db)
+	}
+	g = ng
+	return
+}
+
+func (g *GeoIP) Config(v interface{}) (err error) {
+	if v == nil {
+		err = ErrNilConfig
+	} else if cfg, ok := v.(GeoIPConfig); ok {
+		var ng *GeoIP
+		if ng, err = NewGeoIP(cfg); err == nil {
+			g.mtx.Lock()
+			g.closeDatabases()
+			g.GeoIPConfig, g.geoipParams = ng.GeoIPConfig, ng.geoipParams
+			g.dbs, g.cache, g.lastCheck = ng.dbs, ng.cache, ng.lastCheck
+			g.mtx.Unlock()
+		}
+	} else {
+		err = fmt.Errorf("Invalid configuration, unknown type type %T", v)
+	}
+	return
+}
+
+func (g *GeoIP) Flush() []*entry.Entry {
+	return nil
+}
+
+func (g *GeoIP) Close() error {
+	g.mtx.Lock()
+	defer g.mtx.Unlock()
+	g.closeDatabases()
+	return nil
+}
+
+func (g *GeoIP) closeDatabases() {
+	for _, db := range g.dbs {
+		if db.rdr != nil {
+			db.rdr.Close()
+			db.rdr = nil
+		}
+	}
+	g.dbs = nil
+}
+
+func (g *GeoIP) Process(ents []*entry.Entry) (rset []*entry.Entry, err error) {
+	if len(ents) == 0 {
+		return
+	}
+	g.mtx.Lock()
+	defer g.mtx.Unlock()
+	g.checkReload(time.Now())
+	rset = ents[:0]
+	for _, ent := range ents {
+		if ent == nil {
+			continue
+		}
+		if g.processEntry(ent) || !g.Drop_Misses {
+			rset = append(rset, ent)
+		} else {
+			ent.Release()
+		}
+	}
+	return
+}
+
+// processEntry attaches enrichments for every extracted IP, returning true if anything resolved
+func (g *GeoIP) processEntry(ent *entry.Entry) (hit bool) {
+	if g.src && ent.SRC != nil {
+		hit = g.enrich(ent, geoipSrcName, ent.SRC, false) || hit
+	}
+	for _, x := range g.jsn {
+		if v, _, _, err := jsonparser.Get(ent.Data, x.keys...); err == nil {
+			if ip := net.ParseIP(string(v)); ip != nil {
+				hit = g.enrich(ent, x.name, ip, true) || hit
+			}
+		}
+	}
+	if g.rx != nil {
+		if mtchs := g.rx.FindSubmatch(ent.Data); mtchs != nil {
+			for _, x := range g.rxs {
+				if x.idx < len(mtchs) && mtchs[x.idx] != nil {
+					if ip := net.ParseIP(string(mtchs[x.idx])); ip != nil {
+						hit = g.enrich(ent, x.name, ip, true) || hit
+					}
+				}
+			}
+		}
+	}
+	return
+}
+
+func (g *GeoIP) enrich(ent *entry.Entry, name string, ip net.IP, attachIP bool) bool {
+	if attachIP {
+		g.addEV(ent, name, entry.IPEnumData(ip))
+	}
+	r := g.lookup(ip)
+	if !r.ok {
+		return false
+	}
+	if g.attach[geoipAttachCountry] && r.country != `` {
+		g.addEV(ent, name+`_`+geoipAttachCountry, entry.StringEnumData(r.country))
+	}
+	if g.attach[geoipAttachCountryName] && r.countryName != `` {
+		g.addEV(ent, name+`_`+geoipAttachCountryName, entry.StringEnumData(r.countryName))
+	}
+	if g.attach[geoipAttachCity] && r.city != `` {
+		g.addEV(ent, name+`_`+geoipAttachCity, entry.StringEnumData(r.city))
+	}
+	if r.hasLoc {
+		if g.attach[geoipAttachLat] {
+			g.addEV(ent, name+`_`+geoipAttachLat, entry.Float64EnumData(r.lat))
+		}
+		if g.attach[geoipAttachLong] {
+			g.addEV(ent, name+`_`+geoipAttachLong, entry.Float64EnumData(r.long))
+		}
+	}
+	if g.attach[geoipAttachASN] && r.asn != 0 {
+		g.addEV(ent, name+`_`+geoipAttachASN, entry.Uint32EnumData(r.asn))
+	}
+	if g.attach[geoipAttachASOrg] && r.asorg != `` {
+		g.addEV(ent, name+`_`+geoipAttachASOrg, entry.StringEnumData(r.asorg))
+	}
+	return true
+}
+
+func (g *GeoIP) addEV(ent *entry.Entry, name string, v entry.EnumeratedData) {
+	ent.AddEnumeratedValue(entry.EnumeratedValue{Name: name, Value: v})
+}
+
+func (g *GeoIP) lookup(ip net.IP) (r geoipResult) {
+	key := string(ip.To16())
+	var ok bool
+	if r, ok = g.cache.get(key); ok {
+		return
+	}
+	for _, db := range g.dbs {
+		if db.rdr == nil {
+			continue
+		}
+		var rec geoipRecord
+		//IPv6 lookups against IPv4 only databases are errors, those are just misses
+		if err := db.rdr.Lookup(ip, &rec); err != nil {
+			continue
+		}
+		r.merge(rec, g.lang)
+	}
+	g.cache.add(key, r)
+	return
+}
+
+func (r *geoipResult) merge(rec geoipRecord, lang string) {
+	if r.country == `` && rec.Country.ISOCode != `` {
+		r.country, r.ok = rec.Country.ISOCode, true
+	}
+	if r.countryName == `` {
+		if n := rec.Country.Names[lang]; n != `` {
+			r.countryName, r.ok = n, true
+		}
+	}
+	if r.city == `` {
+		if n := rec.City.Names[lang]; n != `` {
+			r.city, r.ok = n, true
+		}
+	}
+	if !r.hasLoc && rec.Location.Latitude != nil && rec.Location.Longitude != nil {
+		r.lat, r.long = *rec.Location.Latitude, *rec.Location.Longitude
+		r.hasLoc, r.ok = true, true
+	}
+	if r.asn == 0 && rec.ASN != 0 {
+		r.asn, r.ok = rec.ASN, true
+	}
+	if r.asorg == `` && rec.ASOrg != `` {
+		r.asorg, r.ok = rec.ASOrg, true
+	}
+}
+
+// checkReload reopens any database file that changed on disk, the caller must hold the lock.
+// A database that fails to load keeps serving the previous version.
+func (g *GeoIP) checkReload(now time.Time) {
+	if g.reload == 0 || now.Sub(g.lastCheck) < g.reload {
+		return
+	}
+	g.lastCheck = now
+	var changed bool
+	for _, db := range g.dbs {
+		if db.changed() {
+			if err := db.load(); err == nil {
+				changed = true
+			}
+		}
+	}
+	if changed {
+		g.cache.purge()
+	}
+}
+
+// load reads the entire database into memory so that replacing the file underneath
+// us cannot fault a mapping
+func (db *geoipDB) load() (err error) {
+	var fi os.FileInfo
+	var buff []byte
+	var rdr *maxminddb.Reader
+	if fi, err = os.Stat(db.path); err != nil {
+		return
+	} else if fi.Size() > geoipMaxDatabaseSize {
+		err = fmt.Errorf("GeoIP database %s is too large: %d > %d", db.path, fi.Size(), geoipMaxDatabaseSize)
+		return
+	} else if buff, err = os.ReadFile(db.path); err != nil {
+		return
+	} else if rdr, err = maxminddb.FromBytes(buff); err != nil {
+		err = fmt.Errorf("Failed to load GeoIP database %s: %w", db.path, err)
+		return
+	}
+	if db.rdr != nil {
+		db.rdr.Close()
+	}
+	db.rdr, db.fileStamp = rdr, newFileStamp(db.path, fi)
+	return
+}
+
+// geoipCache is a simple LRU cache of lookup results, a zero sized cache caches nothing
+type geoipCache struct {
+	max int
+	lst *list.List
+	mp  map[string]*list.Element
+}
+
+type geoipCacheItem struct {
+	key string
+	r   geoipResult
+}
+
+func newGeoIPCache(max int) *geoipCache {
+	return &geoipCache{
+		max: max,
+		lst: list.New(),
+		mp:  map[string]*list.Element{},
+	}
+}
+
+func (c *geoipCache) get(key string) (r geoipResult, ok bool) {
+	var el *list.Element
+	if el, ok = c.mp[key]; ok {
+		c.lst.MoveToFront(el)
+		r = el.Value.(*geoipCacheItem).r
+	}
+	return
+}
+
+func (c *geoipCache) add(key string, r geoipResult) {
+	if c.max <= 0 {
+		return
+	}
+	if el, ok := c.mp[key]; ok {
+		el.Value.(*geoipCacheItem).r = r
+		c.lst.MoveToFront(el)
+		return
+	}
+	c.mp[key] = c.lst.PushFront(&geoipCacheItem{key: key, r: r})
+	for c.lst.Len() > c.max {
+		el := c.lst.Back()
+		c.lst.Remove(el)
+		delete(c.mp, el.Value.(*geoipCacheItem).key)
+	}
+}
+
+func (c *geoipCache) purge() {
+	c.lst.Init()
+	c.mp = map[string]*list.Element{}
+}
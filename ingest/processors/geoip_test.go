@@ -0,0 +1,352 @@
+/*************************************************************************
+ * Copyright 2024 Gravwell, Inc. All rights reserved.
+ * Contact: <legal@gravwell.io>
+ *
+ * This software may be modified and distributed under the terms of the
+ * BSD 2-clause license. See the LICENSE file for details.
+ **************************************************************************/
+
+package processors
+
+import (
+	"encoding/binary"
+	"math"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/gravwell/gravwell/v3/ingest/config"
+	"github.com/gravwell/gravwell/v3/ingest/entry"
+)
+
+type mmdbNetwork struct {
+	cidr string
+	data map[string]interface{}
+}
+
+// writeTestMMDB writes a minimal IPv4 MaxMind DB with 24 bit records
+func writeTestMMDB(t *testing.T, pth string, nets []mmdbNetwork) {
+	const empty = -1
+	type node struct {
+		rec [2]int // >= 0 is a node, empty, or < -1 is a data index encoded as -2-idx
+	}
+	nodes := []node{{rec: [2]int{empty, empty}}}
+	var data []byte
+	for _, n := range nets {
+		_, ipn, err := net.ParseCIDR(n.cidr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ones, _ := ipn.Mask.Size()
+		ip := binary.BigEndian.Uint32(ipn.IP.To4())
+		dataIdx := -2 - len(data)
+		data = append(data, mmdbEncode(n.data)...)
+		cur := 0
+		for i := 0; i < ones; i++ {
+			bit := (ip >> (31 - i)) & 1
+			if i == ones-1 {
+				nodes[cur].rec[bit] = dataIdx
+				break
+			}
+			if nodes[cur].rec[bit] < 0 {
+				nodes = append(nodes, node{rec: [2]int{empty, empty}})
+				nodes[cur].rec[bit] = len(nodes) - 1
+			}
+			cur = nodes[cur].rec[bit]
+		}
+	}
+	cnt := len(nodes)
+	var out []byte
+	for _, n := range nodes {
+		for _, r := range n.rec {
+			var v int
+			if r >= 0 {
+				v = r
+			} else if r == empty {
+				v = cnt
+			} else {
+				v = cnt + 16 + (-2 - r)
+			}
+			out = append(out, byte(v>>16), byte(v>>8), byte(v))
+		}
+	}
+	out = append(out, make([]byte, 16)...)
+	out = append(out, data...)
+	out = append(out, []byte("\xAB\xCD\xEFMaxMind.com")...)
+	out = append(out, mmdbEncode(map[string]interface{}{
+		`node_count`:                  uint32(cnt),
+		`record_size`:                 uint16(24),
+		`ip_version`:                  uint16(4),
+		`binary_format_major_version`: uint16(2),
+		`binary_format_minor_version`: uint16(0),
+		`database_type`:               `Test`,
+		`languages`:                   []string{`en`},
+	})...)
+	if err := os.WriteFile(pth, out, 0640); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func mmdbCtrl(tp, sz int) (r []byte) {
+	var ext []byte
+	if tp > 7 {
+		ext = []byte{byte(tp - 7)}
+		tp = 0
+	}
+	if sz < 29 {
+		r = append([]byte{byte(tp<<5 | sz)}, ext...)
+	} else {
+		r = append([]byte{byte(tp<<5 | 29)}, ext...)
+		r = append(r, byte(sz-29))
+	}
+	return
+}
+
+func mmdbEncode(v interface{}) (r []byte) {
+	switch x := v.(type) {
+	case string:
+		r = append(mmdbCtrl(2, len(x)), x...)
+	case float64:
+		r = binary.BigEndian.AppendUint64(mmdbCtrl(3, 8), math.Float64bits(x))
+	case uint16:
+		r = binary.BigEndian.AppendUint16(mmdbCtrl(5, 2), x)
+	case uint32:
+		r = binary.BigEndian.AppendUint32(mmdbCtrl(6, 4), x)
+	case []string:
+		r = mmdbCtrl(11, len(x))
+		for _, s := range x {
+			r = append(r, mmdbEncode(s)...)
+		}
+	case map[string]interface{}:
+		var keys []string
+		for k := range x {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		r = mmdbCtrl(7, len(x))
+		for _, k := range keys {
+			r = append(r, mmdbEncode(k)...)
+			r = append(r, mmdbEncode(x[k])...)
+		}
+	default:
+		panic("unsupported type")
+	}
+	return
+}
+
+func cityRecord(country, name, city string, lat, long float64) map[string]interface{} {
+	return map[string]interface{}{
+		`country`: map[string]interface{}{
+			`iso_code`: country,
+			`names`:    map[string]interface{}{`en`: name},
+		},
+		`city`: map[string]interface{}{
+			`names`: map[string]interface{}{`en`: city},
+		},
+		`location`: map[string]interface{}{
+			`latitude`:  lat,
+			`longitude`: long,
+		},
+	}
+}
+
+func geoipTestDBs(t *testing.T) (city, asn string) {
+	dir := t.TempDir()
+	city = filepath.Join(dir, `city.mmdb`)
+	asn = filepath.Join(dir, `asn.mmdb`)
+	writeTestMMDB(t, city, []mmdbNetwork{
+		{cidr: `1.2.3.0/24`, data: cityRecord(`US`, `United States`, `Boise`, 43.6, -116.2)},
+		{cidr: `5.6.0.0/16`, data: cityRecord(`DE`, `Germany`, `Berlin`, 52.5, 13.4)},
+	})
+	writeTestMMDB(t, asn, []mmdbNetwork{
+		{cidr: `1.2.0.0/16`, data: map[string]interface{}{
+			`autonomous_system_number`:       uint32(64500),
+			`autonomous_system_organization`: `Example Networks`,
+		}},
+	})
+	return
+}
+
+func checkEV(t *testing.T, ent *entry.Entry, name string, val interface{}) {
+	t.Helper()
+	v, ok := ent.GetEnumeratedValue(name)
+	if !ok {
+		t.Fatalf("missing EV %s", name)
+	} else if ip, ok := val.(net.IP); ok {
+		if vip, ok := v.(net.IP); !ok || !vip.Equal(ip) {
+			t.Fatalf("bad EV %s: %v != %v", name, v, val)
+		}
+	} else if v != val {
+		t.Fatalf("bad EV %s: %v(%T) != %v(%T)", name, v, v, val, val)
+	}
+}
+
+func TestGeoIPConfig(t *testing.T) {
+	b := []byte(`
+	[preprocessor "geo"]
+		type = geoip
+		Database = /tmp/city.mmdb
+		Database = /tmp/asn.mmdb
+		JSON-Path = "client.ip"
+		Attach = country
+		Attach = asn
+		Reload-Interval = 1m
+	`)
+	tc := struct {
+		Preprocessor ProcessorConfig
+	}{}
+	if err := config.LoadConfigBytes(&tc, b); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := GeoIPLoadConfig(tc.Preprocessor[`geo`])
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := cfg.validate()
+	if err != nil {
+		t.Fatal(err)
+	} else if len(p.dbPaths) != 2 || len(p.jsn) != 1 || p.src || len(p.attach) != 2 || p.reload != time.Minute {
+		t.Fatalf("bad config: %+v", p)
+	}
+
+	bad := []GeoIPConfig{
+		GeoIPConfig{},
+		GeoIPConfig{Database: []string{` `}},
+		GeoIPConfig{Database: []string{`x`}, Regex: `\d+`},
+		GeoIPConfig{Database: []string{`x`}, Attach: []string{`foo`}},
+		GeoIPConfig{Database: []string{`x`}, Reload_Interval: `-1s`},
+	}
+	for i, c := range bad {
+		if _, err := c.validate(); err == nil {
+			t.Fatalf("bad config %d did not fail", i)
+		}
+	}
+}
+
+func TestGeoIPProcess(t *testing.T) {
+	city, asn := geoipTestDBs(t)
+	g, err := NewGeoIP(GeoIPConfig{
+		Database:  []string{city, asn},
+		Source_IP: true,
+		JSON_Path: []string{`client.ip`},
+		Regex:     `dst=(?P<dst>\S+)`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer g.Close()
+	ents := []*entry.Entry{
+		&entry.Entry{SRC: net.ParseIP(`1.2.3.4`), Data: []byte(`{"client":{"ip":"5.6.7.8"}} dst=1.2.200.1`)},
+		&entry.Entry{SRC: net.ParseIP(`9.9.9.9`), Data: []byte(`nothing here`)},
+	}
+	r, err := g.Process(ents)
+	if err != nil {
+		t.Fatal(err)
+	} else if len(r) != 2 {
+		t.Fatalf("bad result count %d", len(r))
+	}
+	ent := r[0]
+	checkEV(t, ent, `src_country`, `US`)
+	checkEV(t, ent, `src_country_name`, `United States`)
+	checkEV(t, ent, `src_city`, `Boise`)
+	checkEV(t, ent, `src_lat`, 43.6)
+	checkEV(t, ent, `src_long`, -116.2)
+	checkEV(t, ent, `src_asn`, uint32(64500))
+	checkEV(t, ent, `src_asorg`, `Example Networks`)
+	checkEV(t, ent, `ip`, net.ParseIP(`5.6.7.8`))
+	checkEV(t, ent, `ip_city`, `Berlin`)
+	checkEV(t, ent, `dst`, net.ParseIP(`1.2.200.1`))
+	checkEV(t, ent, `dst_asn`, uint32(64500))
+	if _, ok := ent.GetEnumeratedValue(`dst_city`); ok {
+		t.Fatal("dst should only have ASN info")
+	}
+	if _, ok := ent.GetEnumeratedValue(`ip_asn`); ok {
+		t.Fatal("ip should not have ASN info")
+	}
+	if r[1].EVB.Count() != 0 {
+		t.Fatalf("miss got EVs: %d", r[1].EVB.Count())
+	}
+
+	//misses get dropped
+	g.Drop_Misses = true
+	ents = []*entry.Entry{
+		&entry.Entry{SRC: net.ParseIP(`9.9.9.9`)},
+		&entry.Entry{SRC: net.ParseIP(`5.6.1.1`)},
+		&entry.Entry{SRC: net.ParseIP(`::1`)},
+	}
+	if r, err = g.Process(ents); err != nil {
+		t.Fatal(err)
+	} else if len(r) != 1 {
+		t.Fatalf("bad result count %d", len(r))
+	}
+	checkEV(t, r[0], `src_country`, `DE`)
+}
+
+func TestGeoIPReload(t *testing.T) {
+	city, _ := geoipTestDBs(t)
+	g, err := NewGeoIP(GeoIPConfig{
+		Database: []string{city},
+		Attach:   []string{`city`},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer g.Close()
+	process := func(city string) {
+		t.Helper()
+		ent := &entry.Entry{SRC: net.ParseIP(`1.2.3.4`)}
+		if _, err := g.Process([]*entry.Entry{ent}); err != nil {
+			t.Fatal(err)
+		}
+		checkEV(t, ent, `src_city`, city)
+		if _, ok := ent.GetEnumeratedValue(`src_country`); ok {
+			t.Fatal("got unrequested attachment")
+		}
+	}
+	process(`Boise`)
+
+	//replace the database, it isn't picked up until the reload interval expires
+	writeTestMMDB(t, city, []mmdbNetwork{
+		{cidr: `1.2.3.0/24`, data: cityRecord(`US`, `United States`, `Spokane`, 47.6, -117.4)},
+	})
+	future := time.Now().Add(time.Hour)
+	if err := os.Chtimes(city, future, future); err != nil {
+		t.Fatal(err)
+	}
+	process(`Boise`)
+	g.lastCheck = time.Time{}
+	process(`Spokane`)
+
+	//a broken database keeps the old one running
+	if err := os.WriteFile(city, []byte(`garbage`), 0640); err != nil {
+		t.Fatal(err)
+	}
+	g.lastCheck = time.Time{}
+	process(`Spokane`)
+}
+
+func TestGeoIPCache(t *testing.T) {
+	c := newGeoIPCache(2)
+	c.add(`a`, geoipResult{city: `a`})
+	c.add(`b`, geoipResult{city: `b`})
+	if _, ok := c.get(`a`); !ok {
+		t.Fatal("missing a")
+	}
+	c.add(`c`, geoipResult{city: `c`})
+	if _, ok := c.get(`b`); ok {
+		t.Fatal("b was not evicted")
+	} else if r, ok := c.get(`a`); !ok || r.city != `a` {
+		t.Fatal("a was evicted")
+	}
+	c.purge()
+	if _, ok := c.get(`a`); ok {
+		t.Fatal("purge failed")
+	}
+	c = newGeoIPCache(0)
+	if c.add(`a`, geoipResult{}); len(c.mp) != 0 {
+		t.Fatal("zero sized cache stored an item")
+	}
+}
@@ -147,7 +147,11 @@ func (gf *GravwellForwarder) Process(ents []*entry.Entry) (r []*entry.Entry, err
 				}
 			}
 			if err == nil {
-				err = gf.mxr.WriteEntry(&lent)
+				//the copy shares any pooled buffers, the second muxer gets its own reference
+				ent.Retain()
+				if err = gf.mxr.WriteEntry(&lent); err != nil {
+					ent.Release()
+				}
 			}
 		}
 	}
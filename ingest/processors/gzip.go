@@ -105,6 +105,8 @@ func (gd *GzipDecompressor) Process(ents []*entry.Entry) ([]*entry.Entry, error)
 	for _, v := range ents {
 		if ent, err := gd.procEnt(v); err == nil && ent != nil {
 			rset = append(rset, ent)
+		} else {
+			v.Release()
 		}
 	}
 	return rset, nil
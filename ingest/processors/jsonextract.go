@@ -109,8 +109,10 @@ func (je *JsonExtractor) Process(ents []*entry.Entry) (rset []*entry.Entry, err
 	for _, ent := range ents {
 		if ent == nil {
 			continue
-		} else if ent = je.processItem(ent); ent != nil {
-			rset = append(rset, ent)
+		} else if r := je.processItem(ent); r != nil {
+			rset = append(rset, r)
+		} else {
+			ent.Release()
 		}
 	}
 	return
@@ -147,8 +147,10 @@ func (j *JsonFilter) Process(ents []*entry.Entry) (rset []*entry.Entry, err erro
 		if ent == nil {
 			continue
 		}
-		if ent = j.processItem(ent); ent != nil {
-			rset = append(rset, ent)
+		if r := j.processItem(ent); r != nil {
+			rset = append(rset, r)
+		} else {
+			ent.Release()
 		}
 	}
 	return
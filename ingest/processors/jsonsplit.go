@@ -141,9 +141,9 @@ func (je *JsonArraySplitter) Process(ents []*entry.Entry) ([]*entry.Entry, error
 			continue
 		}
 		if set, err := je.processItem(ent); err != nil {
-			continue
-		} else if len(set) > 0 {
-			r = append(r, set...)
+			ent.Release()
+		} else {
+			r = appendDerived(r, set, ent)
 		}
 	}
 	return r, nil
@@ -0,0 +1,247 @@
+/*************************************************************************
+ * Copyright 2024 Gravwell, Inc. All rights reserved.
+ * Contact: <legal@gravwell.io>
+ *
+ * This software may be modified and distributed under the terms of the
+ * BSD 2-clause license. See the LICENSE file for details.
+ **************************************************************************/
+
+package processors
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gravwell/gravwell/v3/ingest/config"
+	"github.com/gravwell/gravwell/v3/ingest/entry"
+)
+
+const (
+	MultilineProcessor = `multiline`
+
+	defaultMultilineMaxLines = 500
+	defaultMultilineMaxBytes = 1024 * 1024
+	defaultMultilineTimeout  = 2 * time.Second
+	multilineSeparator       = '\n'
+)
+
+var (
+	ErrMultilinePattern     = errors.New("Exactly one of Start-Pattern or Continuation-Pattern is required")
+	ErrMultilineInvalidMax  = errors.New("Max-Lines and Max-Bytes must be positive")
+	ErrMultilineInvalidTime = errors.New("Flush-Timeout must be positive")
+)
+
+type MultilineConfig struct {
+	Start_Pattern        string // lines matching this start a new event
+	Continuation_Pattern string // lines matching this are appended to the previous event
+	Negate               bool   // invert the pattern match
+	Max_Lines            int    // maximum lines in an event, defaults to 500
+	Max_Bytes            string // maximum event size, defaults to 1MB
+	Flush_Timeout        string // how long an incomplete event is held without new lines, defaults to 2s
+}
+
+func MultilineLoadConfig(vc *config.VariableConfig) (c MultilineConfig, err error) {
+	if err = vc.MapTo(&c); err == nil {
+		_, err = c.validate()
+	}
+	return
+}
+
+type multilineParams struct {
+	rx       *regexp.Regexp
+	start    bool //rx matches the start of an event
+	maxLines int
+	maxBytes int
+	timeout  time.Duration
+}
+
+func (c *MultilineConfig) validate() (p multilineParams, err error) {
+	if (c.Start_Pattern == ``) == (c.Continuation_Pattern == ``) {
+		err = ErrMultilinePattern
+		return
+	}
+	if c.Start_Pattern != `` {
+		p.start = true
+		if p.rx, err = regexp.Compile(c.Start_Pattern); err != nil {
+			err = fmt.Errorf("Invalid Start-Pattern: %w", err)
+			return
+		}
+	} else if p.rx, err = regexp.Compile(c.Continuation_Pattern); err != nil {
+		err = fmt.Errorf("Invalid Continuation-Pattern: %w", err)
+		return
+	}
+	if p.maxLines = c.Max_Lines; p.maxLines == 0 {
+		p.maxLines = defaultMultilineMaxLines
+	}
+	p.maxBytes = defaultMultilineMaxBytes
+	if c.Max_Bytes != `` {
+		if p.maxBytes, err = parseDataSize(c.Max_Bytes); err != nil {
+			err = fmt.Errorf("Invalid Max-Bytes %q: %w", c.Max_Bytes, err)
+			return
+		}
+	}
+	if p.maxLines < 0 || p.maxBytes <= 0 {
+		err = ErrMultilineInvalidMax
+		return
+	}
+	p.timeout = defaultMultilineTimeout
+	if c.Flush_Timeout != `` {
+		if p.timeout, err = time.ParseDuration(c.Flush_Timeout); err != nil {
+			err = fmt.Errorf("Invalid Flush-Timeout %q: %w", c.Flush_Timeout, err)
+			return
+		} else if p.timeout <= 0 {
+			err = ErrMultilineInvalidTime
+			return
+		}
+	}
+	return
+}
+
+// multilineGroup is an event being assembled for a single source and tag
+type multilineGroup struct {
+	ent   *entry.Entry
+	lines int
+	seq   uint64 //order the group was started, used to keep flushes deterministic
+	last  time.Time
+}
+
+// Multiline joins lines into multiline events such as stack traces.  Lines are grouped
+// by source and tag so that interleaved senders do not mix.
+type Multiline struct {
+	MultilineConfig
+	multilineParams
+	mtx    sync.Mutex
+	groups map[string]*multilineGroup
+	seq    uint64
+	now    func() time.Time
+}
+
+func NewMultiline(cfg MultilineConfig) (*Multiline, error) {
+	p, err := cfg.validate()
+	if err != nil {
+		return nil, err
+	}
+	return &Multiline{
+		MultilineConfig: cfg,
+		multilineParams: p,
+		groups:          map[string]*multilineGroup{},
+		now:             time.Now,
+	}, nil
+}
+
+func (m *Multiline) Config(v interface{}) (err error) {
+	if v == nil {
+		err = ErrNilConfig
+	} else if cfg, ok := v.(MultilineConfig); ok {
+		var p multilineParams
+		if p, err = cfg.validate(); err == nil {
+			m.mtx.Lock()
+			m.MultilineConfig, m.multilineParams = cfg, p
+			m.mtx.Unlock()
+		}
+	} else {
+		err = fmt.Errorf("Invalid configuration, unknown type type %T", v)
+	}
+	return
+}
+
+func (m *Multiline) Process(ents []*entry.Entry) (rset []*entry.Entry, err error) {
+	if len(ents) == 0 {
+		return
+	}
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	now := m.now()
+	//we can't reuse the incoming slice, held entries would be overwritten
+	for _, ent := range ents {
+		if ent == nil {
+			continue
+		}
+		if done := m.processEntry(ent, now); done != nil {
+			rset = append(rset, done)
+		}
+	}
+	return
+}
+
+// processEntry adds a line to its group, returning an event if one was completed
+func (m *Multiline) processEntry(ent *entry.Entry, now time.Time) (done *entry.Entry) {
+	key := sourceTagKey(ent)
+	g, ok := m.groups[key]
+	if !ok || g.ent == nil {
+		m.seq++
+		m.groups[key] = &multilineGroup{ent: ent, lines: 1, seq: m.seq, last: now}
+		return
+	}
+	if m.startsEvent(ent.Data) || g.lines >= m.maxLines || len(g.ent.Data)+1+len(ent.Data) > m.maxBytes {
+		done = g.ent
+		m.seq++
+		g.ent, g.lines, g.seq = ent, 1, m.seq
+	} else {
+		//copy on the first append so we never write into a buffer the entry shares
+		if g.lines == 1 {
+			g.ent.Data = append(make([]byte, 0, len(g.ent.Data)+1+len(ent.Data)), g.ent.Data...)
+		}
+		g.ent.Data = append(append(g.ent.Data, multilineSeparator), ent.Data...)
+		g.lines++
+		ent.Release()
+	}
+	g.last = now
+	return
+}
+
+func (m *Multiline) startsEvent(line []byte) bool {
+	match := m.rx.Match(line) != m.Negate
+	if m.start {
+		return match
+	}
+	return !match //continuation lines extend the event, everything else starts one
+}
+
+// sourceTagKey builds a map key from the entry source and tag for processors that keep state per sender
+func sourceTagKey(ent *entry.Entry) string {
+	b := make([]byte, 2, 2+len(ent.SRC))
+	b[0], b[1] = byte(ent.Tag>>8), byte(ent.Tag)
+	return string(append(b, ent.SRC...))
+}
+
+// Expire returns events that have not seen a new line within the flush timeout
+func (m *Multiline) Expire(now time.Time) []*entry.Entry {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	return m.release(func(g *multilineGroup) bool {
+		return now.Sub(g.last) >= m.timeout
+	})
+}
+
+// Flush returns every event currently being assembled
+func (m *Multiline) Flush() []*entry.Entry {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	return m.release(nil)
+}
+
+func (m *Multiline) release(filter func(*multilineGroup) bool) (r []*entry.Entry) {
+	var gs []*multilineGroup
+	for k, g := range m.groups {
+		if filter == nil || filter(g) {
+			if g.ent != nil {
+				gs = append(gs, g)
+			}
+			delete(m.groups, k)
+		}
+	}
+	sort.Slice(gs, func(i, j int) bool { return gs[i].seq < gs[j].seq })
+	for _, g := range gs {
+		r = append(r, g.ent)
+	}
+	return
+}
+
+func (m *Multiline) Close() error {
+	return nil
+}
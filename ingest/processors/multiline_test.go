@@ -0,0 +1,226 @@
+/*************************************************************************
+ * Copyright 2024 Gravwell, Inc. All rights reserved.
+ * Contact: <legal@gravwell.io>
+ *
+ * This software may be modified and distributed under the terms of the
+ * BSD 2-clause license. See the LICENSE file for details.
+ **************************************************************************/
+
+package processors
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gravwell/gravwell/v3/ingest/config"
+	"github.com/gravwell/gravwell/v3/ingest/entry"
+)
+
+func lineEntries(src string, tag entry.EntryTag, lines ...string) (r []*entry.Entry) {
+	for _, l := range lines {
+		r = append(r, &entry.Entry{
+			SRC:  net.ParseIP(src),
+			Tag:  tag,
+			Data: []byte(l),
+		})
+	}
+	return
+}
+
+func checkEvents(t *testing.T, ents []*entry.Entry, events ...string) {
+	t.Helper()
+	if len(ents) != len(events) {
+		t.Fatalf("bad event count %d != %d", len(ents), len(events))
+	}
+	for i := range ents {
+		if string(ents[i].Data) != events[i] {
+			t.Fatalf("bad event %d:\n%q\n!=\n%q", i, ents[i].Data, events[i])
+		}
+	}
+}
+
+func TestMultilineConfig(t *testing.T) {
+	b := []byte(`
+	[preprocessor "ml"]
+		type = multiline
+		Start-Pattern = "^\\d{4}-\\d{2}-\\d{2}"
+		Max-Lines = 10
+		Max-Bytes = 4KB
+		Flush-Timeout = 5s
+	`)
+	tc := struct {
+		Preprocessor ProcessorConfig
+	}{}
+	if err := config.LoadConfigBytes(&tc, b); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := MultilineLoadConfig(tc.Preprocessor[`ml`])
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := cfg.validate()
+	if err != nil {
+		t.Fatal(err)
+	} else if !p.start || p.maxLines != 10 || p.maxBytes != 4096 || p.timeout != 5*time.Second {
+		t.Fatalf("bad config: %+v", p)
+	}
+	bad := []MultilineConfig{
+		MultilineConfig{},
+		MultilineConfig{Start_Pattern: `a`, Continuation_Pattern: `b`},
+		MultilineConfig{Start_Pattern: `(`},
+		MultilineConfig{Start_Pattern: `a`, Max_Lines: -1},
+		MultilineConfig{Start_Pattern: `a`, Max_Bytes: `lots`},
+		MultilineConfig{Start_Pattern: `a`, Flush_Timeout: `0s`},
+	}
+	for i, c := range bad {
+		if _, err := c.validate(); err == nil {
+			t.Fatalf("bad config %d did not fail", i)
+		}
+	}
+}
+
+func TestMultilineStartPattern(t *testing.T) {
+	m, err := NewMultiline(MultilineConfig{Start_Pattern: `^\d{4}-`})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ents := lineEntries(`1.1.1.1`, 0,
+		`2024-01-01 ERROR boom`,
+		`java.lang.NullPointerException`,
+		`    at foo.Bar(Bar.java:10)`,
+		`2024-01-01 INFO ok`,
+	)
+	r, err := m.Process(ents)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkEvents(t, r, "2024-01-01 ERROR boom\njava.lang.NullPointerException\n    at foo.Bar(Bar.java:10)")
+	//continuation lines must not have been modified
+	if string(ents[1].Data) != `java.lang.NullPointerException` {
+		t.Fatalf("continuation line was modified: %q", ents[1].Data)
+	}
+	checkEvents(t, m.Flush(), `2024-01-01 INFO ok`)
+	if ents := m.Flush(); len(ents) != 0 {
+		t.Fatal("flush did not empty groups")
+	}
+}
+
+func TestMultilineContinuation(t *testing.T) {
+	//indented lines continue the previous event
+	m, err := NewMultiline(MultilineConfig{Continuation_Pattern: `^\s`})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := m.Process(lineEntries(`1.1.1.1`, 0, `a`, ` b`, ` c`, `d`, `e`, ` f`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkEvents(t, r, "a\n b\n c", `d`)
+	checkEvents(t, m.Flush(), "e\n f")
+
+	//negated, every line that does not start with a bracket continues the previous
+	if m, err = NewMultiline(MultilineConfig{Continuation_Pattern: `^\[`, Negate: true}); err != nil {
+		t.Fatal(err)
+	}
+	if r, err = m.Process(lineEntries(`1.1.1.1`, 0, `[1] x`, `y`, `[2] z`)); err != nil {
+		t.Fatal(err)
+	}
+	checkEvents(t, r, "[1] x\ny")
+	checkEvents(t, m.Flush(), `[2] z`)
+}
+
+func TestMultilineInterleaved(t *testing.T) {
+	m, err := NewMultiline(MultilineConfig{Start_Pattern: `^START`})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ents []*entry.Entry
+	a := lineEntries(`1.1.1.1`, 0, `START a`, `a1`, `a2`)
+	b := lineEntries(`2.2.2.2`, 0, `START b`, `b1`)
+	c := lineEntries(`1.1.1.1`, 1, `START c`, `c1`)
+	for i := 0; i < 3; i++ {
+		for _, set := range [][]*entry.Entry{a, b, c} {
+			if i < len(set) {
+				ents = append(ents, set[i])
+			}
+		}
+	}
+	r, err := m.Process(ents)
+	if err != nil {
+		t.Fatal(err)
+	} else if len(r) != 0 {
+		t.Fatalf("got early events: %d", len(r))
+	}
+	checkEvents(t, m.Flush(), "START a\na1\na2", "START b\nb1", "START c\nc1")
+}
+
+func TestMultilineLimits(t *testing.T) {
+	m, err := NewMultiline(MultilineConfig{Start_Pattern: `^START`, Max_Lines: 3, Max_Bytes: `16B`})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := m.Process(lineEntries(`1.1.1.1`, 0, `START`, `1`, `2`, `3`, `4`, `START`, strings.Repeat(`x`, 12)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkEvents(t, r, "START\n1\n2", "3\n4", "START")
+	checkEvents(t, m.Flush(), strings.Repeat(`x`, 12))
+}
+
+func TestMultilineExpire(t *testing.T) {
+	m, err := NewMultiline(MultilineConfig{Start_Pattern: `^START`, Flush_Timeout: `1s`})
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	m.now = func() time.Time { return now }
+	if _, err = m.Process(lineEntries(`1.1.1.1`, 0, `START a`, `a1`)); err != nil {
+		t.Fatal(err)
+	}
+	now = now.Add(500 * time.Millisecond)
+	if _, err = m.Process(lineEntries(`2.2.2.2`, 0, `START b`)); err != nil {
+		t.Fatal(err)
+	}
+	if r := m.Expire(now.Add(time.Millisecond)); len(r) != 0 {
+		t.Fatal("expired early")
+	}
+	checkEvents(t, m.Expire(now.Add(600*time.Millisecond)), "START a\na1")
+	checkEvents(t, m.Expire(now.Add(time.Second)), "START b")
+}
+
+func TestMultilineProcessorSet(t *testing.T) {
+	m, err := NewMultiline(MultilineConfig{Start_Pattern: `^START`, Flush_Timeout: `100ms`})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var tw testWriter
+	pr := NewProcessorSet(&tw)
+	pr.AddProcessor(m)
+	for _, ent := range lineEntries(`1.1.1.1`, 0, `START a`, `a1`) {
+		if err = pr.Process(ent); err != nil {
+			t.Fatal(err)
+		}
+	}
+	//the expiration routine should push the event out without any new lines
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		pr.Lock()
+		cnt := len(tw.ents)
+		pr.Unlock()
+		if cnt > 0 {
+			break
+		} else if time.Now().After(deadline) {
+			t.Fatal("event was never expired")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err = pr.Process(lineEntries(`1.1.1.1`, 0, `START b`)[0]); err != nil {
+		t.Fatal(err)
+	}
+	if err = pr.Close(); err != nil {
+		t.Fatal(err)
+	}
+	checkEvents(t, tw.ents, "START a\na1", "START b")
+}
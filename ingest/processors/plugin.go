@@ -24,12 +24,14 @@ import (
 	"github.com/gravwell/gravwell/v3/ingest/config"
 	"github.com/gravwell/gravwell/v3/ingest/entry"
 	"github.com/gravwell/gravwell/v3/ingest/processors/plugin"
+	"github.com/gravwell/gravwell/v3/ingest/processors/wasm"
 	"github.com/open2b/scriggo"
 )
 
 const (
 	PluginProcessor     string = `plugin`
 	PluginEngineScriggo string = `scriggo`
+	PluginEngineWasm    string = `wasm`
 
 	defaultEngine     string = PluginEngineScriggo
 	maxPluginFileSize int64  = 1024 * 1024 * 32 //32MB is crazy and useful in case we want to allow static binary plugins
@@ -39,6 +41,7 @@ const (
 var (
 	ErrNoPlugins     = errors.New("No plugins provided in Plugin-Path")
 	ErrDuplicateFile = errors.New("dupclicate plugin file")
+	ErrWasmMultiFile = errors.New("wasm plugins must be a single module")
 )
 
 // PluginData implements the fs.FS interface
@@ -50,6 +53,8 @@ type PluginConfig struct {
 	Plugin_Path   []string               //path to the plugin files (this may support multifile plugins later
 	Plugin_Engine string                 // defaults to scriggo
 	Debug         bool                   // defaults to false
+	Max_Memory    int                    // wasm only, maximum plugin memory in MB
+	Call_Timeout  string                 // wasm only, maximum duration of a single call into the plugin
 	vc            *config.VariableConfig // we keep a handle on the variable to config to pass to the underlying plugin script
 	pd            PluginData
 	// all other config items are dynamic and passed to the underlying plugin
@@ -72,6 +77,14 @@ func (pc *PluginConfig) validate() (err error) {
 	case ``: //deafult
 		pc.Plugin_Engine = PluginEngineScriggo
 	case PluginEngineScriggo: //this is fine
+	case PluginEngineWasm:
+		if len(pc.Plugin_Path) > 1 {
+			err = ErrWasmMultiFile
+			return
+		}
+		if _, err = pc.wasmConfig(); err != nil {
+			return
+		}
 	default:
 		err = fmt.Errorf("Unknown plugin engine %q", pc.Plugin_Engine)
 		return
@@ -94,13 +107,37 @@ func (pc *PluginConfig) validate() (err error) {
 
 }
 
+func (pc *PluginConfig) wasmConfig() (wc wasm.Config, err error) {
+	if pc.Max_Memory < 0 {
+		err = fmt.Errorf("Invalid Max-Memory %d", pc.Max_Memory)
+		return
+	}
+	wc.MemoryLimit = uint64(pc.Max_Memory) * 1024 * 1024
+	if pc.Call_Timeout != `` {
+		if wc.CallTimeout, err = time.ParseDuration(pc.Call_Timeout); err != nil {
+			err = fmt.Errorf("Invalid Call-Timeout %q: %w", pc.Call_Timeout, err)
+			return
+		} else if wc.CallTimeout <= 0 {
+			err = fmt.Errorf("Invalid Call-Timeout %q", pc.Call_Timeout)
+			return
+		}
+	}
+	wc.Debug = pc.Debug
+	return
+}
+
 type Plugin struct {
 	PluginConfig
 	pp *plugin.PluginProgram
+	wp *wasm.Program
 }
 
 func NewPluginProcessor(cfg PluginConfig, tg Tagger) (p *Plugin, err error) {
-	if err = cfg.validate(); err == nil {
+	if err = cfg.validate(); err != nil {
+		return
+	} else if cfg.Plugin_Engine == PluginEngineWasm {
+		return newWasmPluginProcessor(cfg, tg)
+	} else {
 		var pp *plugin.PluginProgram
 		if pp, err = plugin.NewPlugin(cfg.pd, cfg.Debug); err == nil {
 			if err = pp.Run(registerTimeout); err == nil {
@@ -121,28 +158,68 @@ func NewPluginProcessor(cfg PluginConfig, tg Tagger) (p *Plugin, err error) {
 	return
 }
 
+func newWasmPluginProcessor(cfg PluginConfig, tg Tagger) (p *Plugin, err error) {
+	var wc wasm.Config
+	if wc, err = cfg.wasmConfig(); err != nil {
+		return
+	}
+	content, ok := cfg.pd.Files[filepath.Base(cfg.Plugin_Path[0])]
+	if !ok {
+		err = ErrNoPlugins
+		return
+	}
+	var wp *wasm.Program
+	if wp, err = wasm.NewProgram(content, wc); err != nil {
+		return
+	}
+	var vc wasm.ConfigMap
+	if cfg.vc != nil {
+		vc = cfg.vc
+	}
+	if err = wp.Config(vc, tg); err != nil {
+		wp.Close()
+		return
+	}
+	p = &Plugin{
+		PluginConfig: cfg,
+		wp:           wp,
+	}
+	return
+}
+
 func (p *Plugin) Close() (err error) {
-	if p == nil || p.pp == nil {
+	if p == nil {
 		err = ErrNotReady
-	} else {
+	} else if p.wp != nil {
+		err = p.wp.Close()
+	} else if p.pp != nil {
 		err = p.pp.Close()
+	} else {
+		err = ErrNotReady
 	}
 	return
 }
 
 func (p *Plugin) Flush() []*entry.Entry {
-	if p == nil || p.pp == nil {
+	if p == nil {
 		return nil
+	} else if p.wp != nil {
+		return p.wp.Flush()
+	} else if p.pp != nil {
+		return p.pp.Flush()
 	}
-	return p.pp.Flush()
+	return nil
 }
 
 func (p *Plugin) Process(ents []*entry.Entry) ([]*entry.Entry, error) {
-	if p == nil || p.pp == nil {
+	if p == nil {
 		return nil, ErrNotReady
+	} else if p.wp != nil {
+		return p.wp.Process(ents)
+	} else if p.pp != nil {
+		return p.pp.Process(ents)
 	}
-	return p.pp.Process(ents)
-
+	return nil, ErrNotReady
 }
 
 func (pd PluginData) count() int {
@@ -19,6 +19,7 @@ import (
 	"fmt"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/gravwell/gravwell/v3/ingest/config"
 	"github.com/gravwell/gravwell/v3/ingest/entry"
@@ -27,6 +28,9 @@ import (
 const (
 	preProcSectName string = `preprocessor`
 	preProcTypeName string = `type`
+
+	// expireCheckInterval is how often a ProcessorSet asks Expirers for entries they are done holding
+	expireCheckInterval = 250 * time.Millisecond
 )
 
 var (
@@ -41,8 +45,10 @@ var (
 
 type ProcessorSet struct {
 	sync.Mutex
-	wtr entWriter
-	set []Processor
+	wtr     entWriter
+	set     []Processor
+	expDone chan struct{}
+	expWg   sync.WaitGroup
 }
 
 type ProcessorConfig map[string]*config.VariableConfig
@@ -54,6 +60,15 @@ type Processor interface {
 	Close() error //give the processor a chance to tidy up
 }
 
+// Expirer is implemented by processors that hold entries across calls to Process and
+// must release them after a timeout even if no new entries arrive.  A ProcessorSet
+// containing an Expirer periodically calls Expire and pushes the returned entries through
+// the rest of the chain the same way flushed entries are handled on Close.
+// Flush must still return everything the processor is holding.
+type Expirer interface {
+	Expire(now time.Time) []*entry.Entry
+}
+
 func CheckProcessor(id string) error {
 	id = strings.TrimSpace(strings.ToLower(id))
 	switch id {
@@ -75,6 +90,11 @@ func CheckProcessor(id string) error {
 	case VpcProcessor:
 	case CorelightProcessor:
 	case SyslogRouterProcessor:
+	case GeoIPProcessor:
+	case EnrichProcessor:
+	case MultilineProcessor:
+	case CSVExtractProcessor:
+	case DecodeProcessor:
 	default:
 		return checkProcessorOS(id)
 	}
@@ -140,6 +160,16 @@ func ProcessorLoadConfig(vc *config.VariableConfig) (cfg interface{}, err error)
 		cfg, err = CorelightLoadConfig(vc)
 	case SyslogRouterProcessor:
 		cfg, err = SyslogRouterLoadConfig(vc)
+	case GeoIPProcessor:
+		cfg, err = GeoIPLoadConfig(vc)
+	case EnrichProcessor:
+		cfg, err = EnrichLoadConfig(vc)
+	case MultilineProcessor:
+		cfg, err = MultilineLoadConfig(vc)
+	case CSVExtractProcessor:
+		cfg, err = CSVExtractLoadConfig(vc)
+	case DecodeProcessor:
+		cfg, err = DecodeLoadConfig(vc)
 	default:
 		cfg, err = processorLoadConfigOS(vc)
 	}
@@ -297,6 +327,36 @@ func newProcessor(vc *config.VariableConfig, tgr Tagger) (p Processor, err error
 			return
 		}
 		p, err = NewSyslogRouter(cfg, tgr)
+	case GeoIPProcessor:
+		var cfg GeoIPConfig
+		if cfg, err = GeoIPLoadConfig(vc); err != nil {
+			return
+		}
+		p, err = NewGeoIP(cfg)
+	case EnrichProcessor:
+		var cfg EnrichConfig
+		if cfg, err = EnrichLoadConfig(vc); err != nil {
+			return
+		}
+		p, err = NewEnrich(cfg)
+	case MultilineProcessor:
+		var cfg MultilineConfig
+		if cfg, err = MultilineLoadConfig(vc); err != nil {
+			return
+		}
+		p, err = NewMultiline(cfg)
+	case CSVExtractProcessor:
+		var cfg CSVExtractConfig
+		if cfg, err = CSVExtractLoadConfig(vc); err != nil {
+			return
+		}
+		p, err = NewCSVExtract(cfg)
+	case DecodeProcessor:
+		var cfg DecodeConfig
+		if cfg, err = DecodeLoadConfig(vc); err != nil {
+			return
+		}
+		p, err = NewDecode(cfg)
 	default:
 		p, err = newProcessorOS(vc, tgr)
 	}
@@ -319,6 +379,65 @@ func (pr *ProcessorSet) AddProcessor(p Processor) {
 	pr.Lock()
 	defer pr.Unlock()
 	pr.set = append(pr.set, p)
+	if _, ok := p.(Expirer); ok {
+		pr.startExpirer()
+	}
+}
+
+// startExpirer kicks off the routine that services Expirers, the caller must hold the lock
+func (pr *ProcessorSet) startExpirer() {
+	if pr.expDone != nil {
+		return
+	}
+	pr.expDone = make(chan struct{})
+	pr.expWg.Add(1)
+	go pr.expireRoutine(pr.expDone)
+}
+
+// stopExpirer stops the expiration routine, the caller must NOT hold the lock
+func (pr *ProcessorSet) stopExpirer() {
+	pr.Lock()
+	done := pr.expDone
+	pr.expDone = nil
+	pr.Unlock()
+	if done != nil {
+		close(done)
+		pr.expWg.Wait()
+	}
+}
+
+func (pr *ProcessorSet) expireRoutine(done chan struct{}) {
+	defer pr.expWg.Done()
+	tckr := time.NewTicker(expireCheckInterval)
+	defer tckr.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case now := <-tckr.C:
+			pr.Lock()
+			pr.expire(now)
+			pr.Unlock()
+		}
+	}
+}
+
+// expire pushes expired entries through the remainder of the chain, the caller must hold the lock.
+// Write errors are dropped, they only happen when the writer is shutting down and Close
+// will flush anything still held.
+func (pr *ProcessorSet) expire(now time.Time) {
+	if pr.wtr == nil {
+		return
+	}
+	for i, v := range pr.set {
+		if e, ok := v.(Expirer); ok {
+			if ents := e.Expire(now); len(ents) > 0 {
+				if ents, err := pr.processItemsOnFlush(pr.set[i+1:], ents); err == nil && len(ents) > 0 {
+					pr.writeSet(ents)
+				}
+			}
+		}
+	}
 }
 
 func (pr *ProcessorSet) Process(ent *entry.Entry) (err error) {
@@ -402,14 +521,18 @@ func (pr *ProcessorSet) ProcessBatchContext(ents []*entry.Entry, ctx context.Con
 }
 
 func (pr *ProcessorSet) writeSet(ents []*entry.Entry) error {
-	if len(ents) == 1 {
+	if len(ents) == 0 {
+		return nil //everything was dropped or is being held
+	} else if len(ents) == 1 {
 		return pr.wtr.WriteEntry(ents[0])
 	}
 	return pr.wtr.WriteBatch(ents)
 }
 
 func (pr *ProcessorSet) writeSetContext(ents []*entry.Entry, ctx context.Context) error {
-	if len(ents) == 1 {
+	if len(ents) == 0 {
+		return nil
+	} else if len(ents) == 1 {
 		return pr.wtr.WriteEntryContext(ctx, ents[0])
 	}
 	return pr.wtr.WriteBatchContext(ctx, ents)
@@ -448,6 +571,7 @@ func (pr *ProcessorSet) processItemsOnFlush(prs []Processor, ents []*entry.Entry
 // This function DOES NOT close the ingest muxer handle.
 // It is ONLY for shutting down preprocessors
 func (pr *ProcessorSet) Close() (err error) {
+	pr.stopExpirer()
 	for i, v := range pr.set {
 		if v != nil {
 			if ents := v.Flush(); len(ents) > 0 {
@@ -467,6 +591,50 @@ func (pr *ProcessorSet) Close() (err error) {
 	return
 }
 
+// Reload atomically replaces the processors in the set with the processors held by npr.
+// Callers holding a pointer to pr keep using it; the outgoing processors are flushed
+// through the remainder of the old chain and closed before Reload returns.
+// npr is emptied and must not be used after the call.
+func (pr *ProcessorSet) Reload(npr *ProcessorSet) (err error) {
+	if pr == nil || npr == nil {
+		return ErrNotReady
+	}
+	npr.stopExpirer()
+	npr.Lock()
+	nset := npr.set
+	npr.set = nil
+	npr.Unlock()
+
+	pr.Lock()
+	old := pr.set
+	pr.set = nset
+	for _, p := range nset {
+		if _, ok := p.(Expirer); ok {
+			pr.startExpirer()
+			break
+		}
+	}
+	for i, v := range old {
+		if v == nil {
+			continue
+		}
+		if ents := v.Flush(); len(ents) > 0 {
+			if ents, lerr := pr.processItemsOnFlush(old[i+1:], ents); lerr != nil {
+				err = addError(lerr, err)
+			} else if len(ents) > 0 {
+				if lerr := pr.writeSet(ents); lerr != nil {
+					err = addError(lerr, err)
+				}
+			}
+		}
+		if lerr := v.Close(); lerr != nil {
+			err = addError(lerr, err)
+		}
+	}
+	pr.Unlock()
+	return
+}
+
 func addError(nerr, err error) error {
 	if nerr == nil {
 		return err
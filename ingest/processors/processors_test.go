@@ -163,6 +163,48 @@ func TestMultiProcessorSet(t *testing.T) {
 	return
 }
 
+func TestReloadProcessorSet(t *testing.T) {
+	var tw testWriter
+	ps := NewProcessorSet(&tw)
+	p, err := NewGzipDecompressor(GzipDecompressorConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ps.AddProcessor(p)
+
+	ent := entry.Entry{
+		TS:  entry.Now(),
+		SRC: net.ParseIP("192.168.1.1"),
+	}
+	if ent.Data, err = gzipCompress([]byte("Hello")); err != nil {
+		t.Fatal(err)
+	}
+	if err = ps.Process(&ent); err != nil {
+		t.Fatal(err)
+	} else if len(tw.ents) != 1 || string(tw.ents[0].Data) != "Hello" {
+		t.Fatal("bad output before reload")
+	}
+
+	//swap in an empty set, entries should pass through untouched using the original writer
+	if err = ps.Reload(NewProcessorSet(nil)); err != nil {
+		t.Fatal(err)
+	}
+	compressed, err := gzipCompress([]byte("Hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ent.Data = compressed
+	if err = ps.Process(&ent); err != nil {
+		t.Fatal(err)
+	} else if len(tw.ents) != 2 || !bytes.Equal(tw.ents[1].Data, compressed) {
+		t.Fatal("bad output after reload")
+	}
+
+	if err = ps.Reload(nil); err != ErrNotReady {
+		t.Fatalf("failed to catch nil reload: %v", err)
+	}
+}
+
 func gzipCompressVal(x string) (r []byte, err error) {
 	bwtr := bytes.NewBuffer(nil)
 	gzw := gzip.NewWriter(bwtr)
@@ -150,10 +150,13 @@ func (re *RegexExtractor) Process(ents []*entry.Entry) (rset []*entry.Entry, err
 	}
 	rset = ents[:0]
 	for _, ent := range ents {
-		if ent, err = re.processEntry(ent); err != nil {
+		var r *entry.Entry
+		if r, err = re.processEntry(ent); err != nil {
 			return
-		} else if ent != nil {
-			rset = append(rset, ent)
+		} else if r != nil {
+			rset = append(rset, r)
+		} else {
+			ent.Release()
 		}
 	}
 	return
@@ -109,8 +109,10 @@ func (rr *RegexRouter) Process(ents []*entry.Entry) (rset []*entry.Entry, err er
 	for _, ent := range ents {
 		if ent == nil {
 			continue
-		} else if ent = rr.processItem(ent); ent != nil {
-			rset = append(rset, ent)
+		} else if r := rr.processItem(ent); r != nil {
+			rset = append(rset, r)
+		} else {
+			ent.Release()
 		}
 	}
 	return
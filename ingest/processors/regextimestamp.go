@@ -127,10 +127,13 @@ func (rt *RegexTimestamp) Process(ents []*entry.Entry) (rset []*entry.Entry, err
 		if ent == nil {
 			continue
 		}
-		if ent, err = rt.processItem(ent); err != nil {
+		var r *entry.Entry
+		if r, err = rt.processItem(ent); err != nil {
 			return
-		} else if ent != nil {
-			rset = append(rset, ent)
+		} else if r != nil {
+			rset = append(rset, r)
+		} else {
+			ent.Release()
 		}
 	}
 	return
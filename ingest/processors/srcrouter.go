@@ -103,8 +103,10 @@ func (sr *SrcRouter) Process(ents []*entry.Entry) (rset []*entry.Entry, err erro
 	for _, ent := range ents {
 		if ent == nil {
 			continue
-		} else if ent = sr.processItem(ent); ent != nil {
-			rset = append(rset, ent)
+		} else if r := sr.processItem(ent); r != nil {
+			rset = append(rset, r)
+		} else {
+			ent.Release()
 		}
 	}
 	return
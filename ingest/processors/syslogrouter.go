@@ -109,12 +109,15 @@ func (sr *SyslogRouter) Process(ents []*entry.Entry) (rset []*entry.Entry, err e
 		if parts == nil {
 			if !sr.Drop_Misses {
 				rset = append(rset, ent)
+			} else {
+				ent.Release()
 			}
 			continue
 		}
 		//got a good crack, process it
 		if tag, err := sr.processEntry(ent, parts); err != nil {
 			if sr.Drop_Misses {
+				ent.Release()
 				continue
 			}
 		} else {
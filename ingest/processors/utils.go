@@ -9,9 +9,18 @@
 package processors
 
 import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/gravwell/gravwell/v3/ingest/entry"
 	"github.com/inhies/go-bytesize"
 )
 
+const (
+	defaultReloadInterval = 10 * time.Second
+)
+
 func parseDataSize(v string) (s int, err error) {
 	var bs bytesize.ByteSize
 	if bs, err = bytesize.Parse(v); err == nil {
@@ -19,3 +28,59 @@ func parseDataSize(v string) (s int, err error) {
 	}
 	return
 }
+
+// parseReloadInterval parses how often file backed processors check their files for changes,
+// an empty value gets the default and zero disables reloading
+func parseReloadInterval(v string) (d time.Duration, err error) {
+	if v == `` {
+		d = defaultReloadInterval
+	} else if d, err = time.ParseDuration(v); err != nil {
+		err = fmt.Errorf("Invalid Reload-Interval %q: %w", v, err)
+	} else if d < 0 {
+		err = fmt.Errorf("Invalid Reload-Interval %q", v)
+	}
+	return
+}
+
+// fileStamp tracks the modification time and size of a file so that processors
+// backed by files on disk can tell when to reload them
+type fileStamp struct {
+	path string
+	mod  time.Time
+	size int64
+}
+
+func newFileStamp(pth string, fi os.FileInfo) fileStamp {
+	return fileStamp{
+		path: pth,
+		mod:  fi.ModTime(),
+		size: fi.Size(),
+	}
+}
+
+// changed returns true if the file looks different than when it was stamped, files that
+// cannot be read are treated as unchanged as they are probably in the middle of being replaced
+func (fs fileStamp) changed() bool {
+	fi, err := os.Stat(fs.path)
+	if err != nil {
+		return false
+	}
+	return !fi.ModTime().Equal(fs.mod) || fi.Size() != fs.size
+}
+
+// appendDerived adds entries split out of parent to the set.  The derived entries may reference
+// the parent's memory, so each one borrows the parent and the caller's reference is released.
+func appendDerived(set, derived []*entry.Entry, parent *entry.Entry) []*entry.Entry {
+	var passthrough bool
+	for _, d := range derived {
+		if d == parent {
+			passthrough = true
+		} else {
+			d.Borrow(parent)
+		}
+	}
+	if !passthrough {
+		parent.Release()
+	}
+	return append(set, derived...)
+}
@@ -94,9 +94,9 @@ func (p *Vpc) Process(ents []*entry.Entry) ([]*entry.Entry, error) {
 			continue
 		}
 		if set, err := p.processItem(ent); err != nil {
-			continue
-		} else if len(set) > 0 {
-			r = append(r, set...)
+			ent.Release()
+		} else {
+			r = appendDerived(r, set, ent)
 		}
 	}
 	return r, nil
@@ -0,0 +1,299 @@
+/*************************************************************************
+ * Copyright 2024 Gravwell, Inc. All rights reserved.
+ * Contact: <legal@gravwell.io>
+ *
+ * This software may be modified and distributed under the terms of the
+ * BSD 2-clause license. See the LICENSE file for details.
+ **************************************************************************/
+
+package wasm
+
+import (
+	"context"
+	"fmt"
+	"net"
+
+	"github.com/gravwell/gravwell/v3/ingest/entry"
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/api"
+)
+
+const (
+	// every host function that can fail returns hostErr, lengths and tags are never negative
+	hostErr int32 = -1
+)
+
+// hostModule builds the "gravwell" import module.
+//
+// Buffers are always owned by the plugin, functions that hand data to the plugin take a
+// pointer and capacity, copy as much as fits, and return the full length so that the plugin
+// can grow its buffer and call again.
+func (p *Program) hostModule() wazero.HostModuleBuilder {
+	hmb := p.rt.NewHostModuleBuilder(HostModuleName)
+	export := func(name string, fn interface{}) {
+		hmb = hmb.NewFunctionBuilder().WithFunc(fn).Export(name)
+	}
+	export(`data_len`, p.dataLen)
+	export(`data_read`, p.dataRead)
+	export(`data_write`, p.dataWrite)
+	export(`tag_get`, p.tagGet)
+	export(`tag_set`, p.tagSet)
+	export(`tag_negotiate`, p.tagNegotiate)
+	export(`tag_lookup`, p.tagLookup)
+	export(`ts_get`, p.tsGet)
+	export(`ts_set`, p.tsSet)
+	export(`src_read`, p.srcRead)
+	export(`src_write`, p.srcWrite)
+	export(`ev_read`, p.evRead)
+	export(`ev_write_string`, p.evWriteString)
+	export(`ev_write_int`, p.evWriteInt)
+	export(`ev_write_float`, p.evWriteFloat)
+	export(`ev_write_ip`, p.evWriteIP)
+	export(`config_read`, p.configRead)
+	export(`log`, p.log)
+	return hmb
+}
+
+func readBuff(m api.Module, ptr, sz uint32) (b []byte, ok bool) {
+	if sz == 0 {
+		ok = true
+		return
+	}
+	return m.Memory().Read(ptr, sz)
+}
+
+func readString(m api.Module, ptr, sz uint32) (s string, ok bool) {
+	var b []byte
+	if b, ok = readBuff(m, ptr, sz); ok {
+		s = string(b)
+	}
+	return
+}
+
+// writeBuff copies as much of v as will fit into the plugin buffer and returns the full length
+func writeBuff(m api.Module, ptr, sz uint32, v []byte) int32 {
+	n := uint32(len(v))
+	if n > sz {
+		n = sz
+	}
+	if n > 0 && !m.Memory().Write(ptr, v[:n]) {
+		return hostErr
+	}
+	return int32(len(v))
+}
+
+func (p *Program) fail(format string, args ...interface{}) int32 {
+	if p.err == nil {
+		p.err = fmt.Errorf(format, args...)
+	}
+	return hostErr
+}
+
+func (p *Program) dataLen(ctx context.Context, m api.Module) int32 {
+	if p.cur == nil {
+		return hostErr
+	}
+	return int32(len(p.cur.Data))
+}
+
+func (p *Program) dataRead(ctx context.Context, m api.Module, ptr, sz uint32) int32 {
+	if p.cur == nil {
+		return hostErr
+	}
+	return writeBuff(m, ptr, sz, p.cur.Data)
+}
+
+func (p *Program) dataWrite(ctx context.Context, m api.Module, ptr, sz uint32) int32 {
+	if p.cur == nil {
+		return hostErr
+	}
+	b, ok := readBuff(m, ptr, sz)
+	if !ok {
+		return p.fail("data_write out of bounds %d:%d", ptr, sz)
+	}
+	//the memory view belongs to the plugin, copy it out
+	p.cur.Data = append([]byte(nil), b...)
+	return 0
+}
+
+func (p *Program) tagGet(ctx context.Context, m api.Module) int32 {
+	if p.cur == nil {
+		return hostErr
+	}
+	return int32(p.cur.Tag)
+}
+
+func (p *Program) tagSet(ctx context.Context, m api.Module, tag uint32) int32 {
+	if p.cur == nil || tag > 0xffff {
+		return hostErr
+	} else if p.tg != nil {
+		if _, ok := p.tg.LookupTag(entry.EntryTag(tag)); !ok {
+			return hostErr
+		}
+	}
+	p.cur.Tag = entry.EntryTag(tag)
+	return 0
+}
+
+func (p *Program) tagNegotiate(ctx context.Context, m api.Module, ptr, sz uint32) int32 {
+	name, ok := readString(m, ptr, sz)
+	if !ok {
+		return p.fail("tag_negotiate out of bounds %d:%d", ptr, sz)
+	} else if p.tg == nil {
+		return hostErr
+	}
+	tag, err := p.tg.NegotiateTag(name)
+	if err != nil {
+		return hostErr
+	}
+	return int32(tag)
+}
+
+func (p *Program) tagLookup(ctx context.Context, m api.Module, tag, ptr, sz uint32) int32 {
+	if p.tg == nil || tag > 0xffff {
+		return hostErr
+	}
+	name, ok := p.tg.LookupTag(entry.EntryTag(tag))
+	if !ok {
+		return hostErr
+	}
+	return writeBuff(m, ptr, sz, []byte(name))
+}
+
+func (p *Program) tsGet(ctx context.Context, m api.Module) int64 {
+	if p.cur == nil {
+		return 0
+	}
+	return p.cur.TS.StandardTime().UnixNano()
+}
+
+func (p *Program) tsSet(ctx context.Context, m api.Module, ns int64) int32 {
+	if p.cur == nil {
+		return hostErr
+	}
+	p.cur.TS = entry.UnixTime(ns/1e9, ns%1e9)
+	return 0
+}
+
+func (p *Program) srcRead(ctx context.Context, m api.Module, ptr, sz uint32) int32 {
+	if p.cur == nil {
+		return hostErr
+	} else if len(p.cur.SRC) == 0 {
+		return 0
+	}
+	return writeBuff(m, ptr, sz, []byte(p.cur.SRC.String()))
+}
+
+func (p *Program) srcWrite(ctx context.Context, m api.Module, ptr, sz uint32) int32 {
+	if p.cur == nil {
+		return hostErr
+	}
+	s, ok := readString(m, ptr, sz)
+	if !ok {
+		return p.fail("src_write out of bounds %d:%d", ptr, sz)
+	}
+	ip := net.ParseIP(s)
+	if ip == nil {
+		return hostErr
+	}
+	p.cur.SRC = ip
+	return 0
+}
+
+func (p *Program) evRead(ctx context.Context, m api.Module, nptr, nsz, ptr, sz uint32) int32 {
+	if p.cur == nil {
+		return hostErr
+	}
+	name, ok := readString(m, nptr, nsz)
+	if !ok {
+		return p.fail("ev_read out of bounds %d:%d", nptr, nsz)
+	}
+	ev, ok := p.cur.EVB.Get(name)
+	if !ok {
+		return hostErr
+	}
+	return writeBuff(m, ptr, sz, []byte(ev.Value.String()))
+}
+
+func (p *Program) addEV(name string, ed entry.EnumeratedData) int32 {
+	if err := p.cur.AddEnumeratedValue(entry.EnumeratedValue{Name: name, Value: ed}); err != nil {
+		return hostErr
+	}
+	return 0
+}
+
+func (p *Program) evWriteString(ctx context.Context, m api.Module, nptr, nsz, ptr, sz uint32) int32 {
+	if p.cur == nil {
+		return hostErr
+	}
+	name, ok := readString(m, nptr, nsz)
+	if !ok {
+		return p.fail("ev_write_string out of bounds %d:%d", nptr, nsz)
+	}
+	val, ok := readString(m, ptr, sz)
+	if !ok {
+		return p.fail("ev_write_string out of bounds %d:%d", ptr, sz)
+	}
+	return p.addEV(name, entry.StringEnumData(val))
+}
+
+func (p *Program) evWriteInt(ctx context.Context, m api.Module, nptr, nsz uint32, v int64) int32 {
+	if p.cur == nil {
+		return hostErr
+	}
+	name, ok := readString(m, nptr, nsz)
+	if !ok {
+		return p.fail("ev_write_int out of bounds %d:%d", nptr, nsz)
+	}
+	return p.addEV(name, entry.Int64EnumData(v))
+}
+
+func (p *Program) evWriteFloat(ctx context.Context, m api.Module, nptr, nsz uint32, v float64) int32 {
+	if p.cur == nil {
+		return hostErr
+	}
+	name, ok := readString(m, nptr, nsz)
+	if !ok {
+		return p.fail("ev_write_float out of bounds %d:%d", nptr, nsz)
+	}
+	return p.addEV(name, entry.Float64EnumData(v))
+}
+
+func (p *Program) evWriteIP(ctx context.Context, m api.Module, nptr, nsz, ptr, sz uint32) int32 {
+	if p.cur == nil {
+		return hostErr
+	}
+	name, ok := readString(m, nptr, nsz)
+	if !ok {
+		return p.fail("ev_write_ip out of bounds %d:%d", nptr, nsz)
+	}
+	val, ok := readString(m, ptr, sz)
+	if !ok {
+		return p.fail("ev_write_ip out of bounds %d:%d", ptr, sz)
+	}
+	ip := net.ParseIP(val)
+	if ip == nil {
+		return hostErr
+	}
+	return p.addEV(name, entry.IPEnumData(ip))
+}
+
+func (p *Program) configRead(ctx context.Context, m api.Module, nptr, nsz, ptr, sz uint32) int32 {
+	name, ok := readString(m, nptr, nsz)
+	if !ok {
+		return p.fail("config_read out of bounds %d:%d", nptr, nsz)
+	} else if p.vc == nil {
+		return hostErr
+	}
+	val, err := p.vc.GetString(name)
+	if err != nil {
+		return hostErr
+	}
+	return writeBuff(m, ptr, sz, []byte(val))
+}
+
+func (p *Program) log(ctx context.Context, m api.Module, ptr, sz uint32) {
+	if s, ok := readString(m, ptr, sz); ok {
+		fmt.Fprintln(p.out, s)
+	}
+}
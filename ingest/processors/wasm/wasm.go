@@ -0,0 +1,313 @@
+/*************************************************************************
+ * Copyright 2024 Gravwell, Inc. All rights reserved.
+ * Contact: <legal@gravwell.io>
+ *
+ * This software may be modified and distributed under the terms of the
+ * BSD 2-clause license. See the LICENSE file for details.
+ **************************************************************************/
+
+// Package wasm implements a WebAssembly engine for ingest plugins.
+//
+// Plugins are compiled WebAssembly modules, they can be written in any language that
+// targets wasm32 (Rust, TinyGo, AssemblyScript, etc.).  The host exposes a small set of
+// functions in the "gravwell" import module that operate on the entry currently being
+// processed, negotiate tags, read plugin configuration values, and get or set enumerated
+// values.  Every call into the plugin is bounded by a timeout and the plugin linear memory
+// is bounded by a page limit.  A call that runs away is terminated and returns an error
+// rather than stalling the ingester, the plugin is then instantiated again from scratch
+// (any state it held in linear memory is lost) so later calls keep working.
+//
+// See the README in this directory for the full host ABI.
+package wasm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/gravwell/gravwell/v3/ingest/entry"
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/api"
+	"github.com/tetratelabs/wazero/imports/wasi_snapshot_preview1"
+)
+
+const (
+	HostModuleName     string = `gravwell`
+	ProcessFuncName    string = `gw_process`
+	ConfigFuncName     string = `gw_config`
+	CloseFuncName      string = `gw_close`
+	InitializeFuncName string = `_initialize`
+
+	// return codes from gw_process
+	ResultKeep int32 = 0
+	ResultDrop int32 = 1
+
+	DefaultMemoryLimit uint64        = 64 * 1024 * 1024
+	DefaultCallTimeout time.Duration = time.Second
+
+	pageSize       uint64 = 64 * 1024
+	maxMemoryPages uint64 = 65536
+)
+
+var (
+	ErrInvalidModule    = errors.New("invalid wasm module")
+	ErrNotReady         = errors.New("not ready")
+	ErrMissingProcess   = errors.New("wasm module does not export " + ProcessFuncName)
+	ErrPluginTerminated = errors.New("wasm plugin was terminated")
+)
+
+// ConfigMap is the subset of a config.VariableConfig the host needs to hand
+// configuration values to plugins.
+type ConfigMap interface {
+	GetString(string) (string, error)
+}
+
+// Tagger is a copy of the interface in processors, we can't import processors due to import cycles
+type Tagger interface {
+	NegotiateTag(name string) (entry.EntryTag, error)
+	LookupTag(entry.EntryTag) (string, bool)
+	KnownTags() []string
+}
+
+// Config controls the resources handed to a plugin
+type Config struct {
+	MemoryLimit uint64        // maximum linear memory size in bytes
+	CallTimeout time.Duration // maximum time for any single call into the plugin
+	Debug       bool          // route plugin stdout/stderr and log calls to stdout
+}
+
+type Program struct {
+	sync.Mutex
+	cfg     Config
+	ctx     context.Context
+	cancel  context.CancelFunc
+	rt      wazero.Runtime
+	cm      wazero.CompiledModule
+	mcfg    wazero.ModuleConfig
+	mod     api.Module
+	process api.Function
+	close   api.Function
+	vc      ConfigMap
+	tg      Tagger
+	cfgd    bool // Config has been called, gw_config is called again on restart
+	restart bool // a restart is in progress
+	out     io.Writer
+
+	// state for the entry currently being processed
+	cur *entry.Entry
+	err error
+}
+
+// NewProgram compiles and instantiates a plugin module
+func NewProgram(content []byte, cfg Config) (p *Program, err error) {
+	if len(content) == 0 {
+		err = ErrInvalidModule
+		return
+	}
+	if cfg.MemoryLimit == 0 {
+		cfg.MemoryLimit = DefaultMemoryLimit
+	}
+	if cfg.CallTimeout <= 0 {
+		cfg.CallTimeout = DefaultCallTimeout
+	}
+	pages := cfg.MemoryLimit / pageSize
+	if pages == 0 {
+		pages = 1
+	} else if pages > maxMemoryPages {
+		pages = maxMemoryPages
+	}
+	pt := &Program{
+		cfg: cfg,
+		out: io.Discard,
+	}
+	if cfg.Debug {
+		pt.out = os.Stdout
+	}
+	pt.ctx, pt.cancel = context.WithCancel(context.Background())
+	rcfg := wazero.NewRuntimeConfig().WithMemoryLimitPages(uint32(pages)).WithCloseOnContextDone(true)
+	pt.rt = wazero.NewRuntimeWithConfig(pt.ctx, rcfg)
+	defer func() {
+		if err != nil {
+			pt.rt.Close(pt.ctx)
+			pt.cancel()
+		}
+	}()
+
+	//WASI is provided so that toolchains which assume it (TinyGo, Rust wasm32-wasi) work out of the box
+	if _, err = wasi_snapshot_preview1.Instantiate(pt.ctx, pt.rt); err != nil {
+		return
+	} else if _, err = pt.hostModule().Instantiate(pt.ctx); err != nil {
+		return
+	}
+	if pt.cm, err = pt.rt.CompileModule(pt.ctx, content); err != nil {
+		err = fmt.Errorf("%w: %v", ErrInvalidModule, err)
+		return
+	}
+	pt.mcfg = wazero.NewModuleConfig().
+		WithName(`plugin`).
+		WithStartFunctions(InitializeFuncName).
+		WithStdout(pt.out).
+		WithStderr(pt.out)
+	if err = pt.instantiate(); err != nil {
+		return
+	}
+	p = pt
+	return
+}
+
+// instantiate creates a fresh instance of the compiled plugin
+func (p *Program) instantiate() (err error) {
+	var mod api.Module
+	ctx, cancel := context.WithTimeout(p.ctx, p.cfg.CallTimeout)
+	mod, err = p.rt.InstantiateModule(ctx, p.cm, p.mcfg)
+	cancel()
+	if err != nil {
+		return
+	}
+	if p.process = mod.ExportedFunction(ProcessFuncName); p.process == nil {
+		mod.Close(p.ctx)
+		return ErrMissingProcess
+	}
+	p.close = mod.ExportedFunction(CloseFuncName)
+	p.mod = mod
+	return
+}
+
+// reinstantiate replaces a plugin instance that was terminated by a timeout and calls
+// gw_config again if the plugin was already configured
+func (p *Program) reinstantiate() (err error) {
+	p.restart = true
+	defer func() { p.restart = false }()
+	if err = p.instantiate(); err != nil {
+		return fmt.Errorf("%w: failed to restart plugin: %v", ErrPluginTerminated, err)
+	} else if p.cfgd {
+		err = p.configure()
+	}
+	return
+}
+
+// Config hands the configuration and tagger to the plugin and calls gw_config if the plugin exports it
+func (p *Program) Config(vc ConfigMap, tg Tagger) (err error) {
+	if p == nil || p.mod == nil {
+		return ErrNotReady
+	}
+	p.Lock()
+	defer p.Unlock()
+	p.vc, p.tg, p.cfgd = vc, tg, true
+	if p.mod.IsClosed() {
+		return p.reinstantiate()
+	}
+	return p.configure()
+}
+
+func (p *Program) configure() (err error) {
+	if fn := p.mod.ExportedFunction(ConfigFuncName); fn != nil {
+		var rc int32
+		if rc, err = p.call(ConfigFuncName); err == nil && rc != 0 {
+			err = fmt.Errorf("%s returned %d", ConfigFuncName, rc)
+		}
+	}
+	return
+}
+
+// Process hands each entry to the plugin, entries the plugin asks to drop are removed from the set
+func (p *Program) Process(ents []*entry.Entry) (r []*entry.Entry, err error) {
+	if p == nil || p.mod == nil {
+		return nil, ErrNotReady
+	}
+	p.Lock()
+	defer p.Unlock()
+	r = ents[:0]
+	for _, ent := range ents {
+		if ent == nil {
+			continue
+		}
+		var rc int32
+		p.cur, p.err = ent, nil
+		rc, err = p.call(ProcessFuncName)
+		p.cur = nil
+		if err == nil && p.err != nil {
+			err = p.err
+		}
+		if err != nil {
+			r = nil
+			return
+		}
+		switch rc {
+		case ResultKeep:
+			r = append(r, ent)
+		case ResultDrop:
+		default:
+			err = fmt.Errorf("%s returned %d", ProcessFuncName, rc)
+			r = nil
+			return
+		}
+	}
+	return
+}
+
+// Flush is a no-op, wasm plugins handle one entry at a time and cannot hold entries
+func (p *Program) Flush() []*entry.Entry {
+	return nil
+}
+
+func (p *Program) Close() (err error) {
+	if p == nil || p.rt == nil {
+		return ErrNotReady
+	}
+	p.Lock()
+	defer p.Unlock()
+	if p.mod == nil {
+		return //already closed
+	}
+	if p.close != nil && !p.mod.IsClosed() {
+		_, err = p.call(CloseFuncName)
+	}
+	if lerr := p.rt.Close(p.ctx); lerr != nil && err == nil {
+		err = lerr
+	}
+	p.cancel()
+	p.mod = nil
+	return
+}
+
+// call invokes a plugin function that takes no parameters and returns a single i32.
+// The call is bounded by the configured timeout, a call that times out terminates the
+// plugin instance and the next call instantiates the plugin again.
+func (p *Program) call(name string) (rc int32, err error) {
+	if p.mod.IsClosed() {
+		if p.restart {
+			//gw_config timed out during a restart, try again on the next call
+			err = ErrPluginTerminated
+			return
+		} else if err = p.reinstantiate(); err != nil {
+			return
+		}
+	}
+	var fn api.Function
+	switch name {
+	case ProcessFuncName:
+		fn = p.process
+	case CloseFuncName:
+		fn = p.close
+	default:
+		fn = p.mod.ExportedFunction(name)
+	}
+	ctx, cancel := context.WithTimeout(p.ctx, p.cfg.CallTimeout)
+	defer cancel()
+	var res []uint64
+	if res, err = fn.Call(ctx); err != nil {
+		if ctx.Err() != nil {
+			err = fmt.Errorf("%w: call exceeded %v", ErrPluginTerminated, p.cfg.CallTimeout)
+		}
+		return
+	}
+	if len(res) > 0 {
+		rc = int32(uint32(res[0]))
+	}
+	return
+}
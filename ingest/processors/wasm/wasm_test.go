@@ -0,0 +1,199 @@
+/*************************************************************************
+ * Copyright 2024 Gravwell, Inc. All rights reserved.
+ * Contact: <legal@gravwell.io>
+ *
+ * This software may be modified and distributed under the terms of the
+ * BSD 2-clause license. See the LICENSE file for details.
+ **************************************************************************/
+
+package wasm
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/gravwell/gravwell/v3/ingest/entry"
+)
+
+// the test modules are assembled by hand so the tests do not need a wasm toolchain
+
+var wasmHeader = []byte{0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00}
+
+func wasmSection(id byte, body ...[]byte) []byte {
+	var b []byte
+	for _, v := range body {
+		b = append(b, v...)
+	}
+	return append([]byte{id, byte(len(b))}, b...)
+}
+
+func wasmName(s string) []byte {
+	return append([]byte{byte(len(s))}, s...)
+}
+
+func wasmCode(body ...byte) []byte {
+	body = append([]byte{0x00}, body...) //no locals
+	return append([]byte{byte(len(body))}, body...)
+}
+
+// keepDropModule sets an EV named "n" to the data length and drops empty entries
+func keepDropModule(export string) []byte {
+	mod := append([]byte{}, wasmHeader...)
+	mod = append(mod, wasmSection(0x01, []byte{0x02,
+		0x60, 0x00, 0x01, 0x7f, // () -> i32
+		0x60, 0x03, 0x7f, 0x7f, 0x7e, 0x01, 0x7f, // (i32, i32, i64) -> i32
+	})...)
+	mod = append(mod, wasmSection(0x02, []byte{0x02},
+		wasmName(HostModuleName), wasmName(`data_len`), []byte{0x00, 0x00},
+		wasmName(HostModuleName), wasmName(`ev_write_int`), []byte{0x00, 0x01},
+	)...)
+	mod = append(mod, wasmSection(0x03, []byte{0x01, 0x00})...)
+	mod = append(mod, wasmSection(0x05, []byte{0x01, 0x00, 0x01})...)
+	mod = append(mod, wasmSection(0x07, []byte{0x02},
+		wasmName(export), []byte{0x00, 0x02},
+		wasmName(`memory`), []byte{0x02, 0x00},
+	)...)
+	mod = append(mod, wasmSection(0x0a, []byte{0x01}, wasmCode(
+		0x41, 0x00, // i32.const 0
+		0x41, 0x01, // i32.const 1
+		0x10, 0x00, // call data_len
+		0xad,       // i64.extend_i32_u
+		0x10, 0x01, // call ev_write_int
+		0x1a,       // drop
+		0x10, 0x00, // call data_len
+		0x45, // i32.eqz
+		0x0b,
+	))...)
+	mod = append(mod, wasmSection(0x0b, []byte{0x01, 0x00, 0x41, 0x00, 0x0b, 0x01, 'n'})...)
+	return mod
+}
+
+// spinModule never returns from gw_process
+func spinModule() []byte {
+	mod := append([]byte{}, wasmHeader...)
+	mod = append(mod, wasmSection(0x01, []byte{0x01, 0x60, 0x00, 0x01, 0x7f})...)
+	mod = append(mod, wasmSection(0x03, []byte{0x01, 0x00})...)
+	mod = append(mod, wasmSection(0x07, []byte{0x01}, wasmName(ProcessFuncName), []byte{0x00, 0x00})...)
+	mod = append(mod, wasmSection(0x0a, []byte{0x01}, wasmCode(
+		0x03, 0x40, // loop
+		0x0c, 0x00, // br 0
+		0x0b, // end
+		0x00, // unreachable
+		0x0b,
+	))...)
+	return mod
+}
+
+// spinEmptyModule never returns from gw_process when the entry has no data and keeps everything else
+func spinEmptyModule() []byte {
+	mod := append([]byte{}, wasmHeader...)
+	mod = append(mod, wasmSection(0x01, []byte{0x01, 0x60, 0x00, 0x01, 0x7f})...)
+	mod = append(mod, wasmSection(0x02, []byte{0x01},
+		wasmName(HostModuleName), wasmName(`data_len`), []byte{0x00, 0x00},
+	)...)
+	mod = append(mod, wasmSection(0x03, []byte{0x01, 0x00})...)
+	mod = append(mod, wasmSection(0x05, []byte{0x01, 0x00, 0x01})...)
+	mod = append(mod, wasmSection(0x07, []byte{0x02},
+		wasmName(ProcessFuncName), []byte{0x00, 0x01},
+		wasmName(`memory`), []byte{0x02, 0x00},
+	)...)
+	mod = append(mod, wasmSection(0x0a, []byte{0x01}, wasmCode(
+		0x10, 0x00, // call data_len
+		0x45,       // i32.eqz
+		0x04, 0x40, // if
+		0x03, 0x40, // loop
+		0x0c, 0x00, // br 0
+		0x0b,       // end
+		0x0b,       // end
+		0x41, 0x00, // i32.const 0
+		0x0b,
+	))...)
+	return mod
+}
+
+func TestKeepDrop(t *testing.T) {
+	p, err := NewProgram(keepDropModule(ProcessFuncName), Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	if err = p.Config(nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	ents := []*entry.Entry{
+		&entry.Entry{Data: []byte(`hello`)},
+		&entry.Entry{},
+		&entry.Entry{Data: []byte(`hi`)},
+	}
+	r, err := p.Process(ents)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(r) != 2 {
+		t.Fatalf("invalid result count: %d != 2", len(r))
+	}
+	for _, ent := range r {
+		ev, ok := ent.GetEnumeratedValue(`n`)
+		if !ok {
+			t.Fatal("missing EV")
+		} else if v, ok := ev.(int64); !ok || v != int64(len(ent.Data)) {
+			t.Fatalf("bad EV value: %v", ev)
+		}
+	}
+	if err = p.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = p.Process(ents); err != ErrNotReady {
+		t.Fatalf("process after close did not fail: %v", err)
+	}
+}
+
+func TestMissingProcess(t *testing.T) {
+	if _, err := NewProgram(keepDropModule(`nope`), Config{}); err != ErrMissingProcess {
+		t.Fatalf("bad error: %v", err)
+	}
+	if _, err := NewProgram([]byte(`not wasm`), Config{}); !errors.Is(err, ErrInvalidModule) {
+		t.Fatalf("bad error: %v", err)
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	p, err := NewProgram(spinModule(), Config{CallTimeout: 50 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	ents := []*entry.Entry{&entry.Entry{Data: []byte(`spin`)}}
+	if _, err = p.Process(ents); !errors.Is(err, ErrPluginTerminated) {
+		t.Fatalf("runaway plugin was not terminated: %v", err)
+	}
+	//the plugin is terminated again on every call, it never wedges the processor
+	if _, err = p.Process(ents); !errors.Is(err, ErrPluginTerminated) {
+		t.Fatalf("restarted plugin was not terminated: %v", err)
+	}
+}
+
+func TestTimeoutRestart(t *testing.T) {
+	p, err := NewProgram(spinEmptyModule(), Config{CallTimeout: 50 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	if err = p.Config(nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = p.Process([]*entry.Entry{&entry.Entry{}}); !errors.Is(err, ErrPluginTerminated) {
+		t.Fatalf("runaway plugin was not terminated: %v", err)
+	}
+	//the next call gets a fresh instance
+	r, err := p.Process([]*entry.Entry{&entry.Entry{Data: []byte(`hello`)}})
+	if err != nil {
+		t.Fatalf("plugin was not restarted after a timeout: %v", err)
+	} else if len(r) != 1 {
+		t.Fatalf("invalid result count: %d != 1", len(r))
+	}
+	if err = p.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -11,7 +11,6 @@ package main
 import (
 	"bytes"
 	"context"
-	"crypto/tls"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -21,7 +20,6 @@ import (
 	"strings"
 	"sync"
 
-	"github.com/gravwell/gravwell/v3/ingest"
 	"github.com/gravwell/gravwell/v3/ingest/config"
 	"github.com/gravwell/gravwell/v3/ingest/entry"
 	"github.com/gravwell/gravwell/v3/ingest/log"
@@ -40,7 +38,7 @@ type jsonHandlerConfig struct {
 	setLocalTime     bool
 	timezoneOverride string
 	src              net.IP
-	wg               *sync.WaitGroup
+	wg               waiter
 	formatOverride   string
 	flds             []string
 	proc             *processors.ProcessorSet
@@ -50,131 +48,86 @@ type jsonHandlerConfig struct {
 	disableCompact   bool
 }
 
-func startJSONListeners(cfg *cfgType, igst *ingest.IngestMuxer, wg *sync.WaitGroup, f *flusher, ctx context.Context) error {
-	var err error
-	//short circuit out on empty
-	if len(cfg.JSONListener) == 0 {
-		return nil
-	}
-
+func startJSONListeners(cfg *cfgType, igst relayMuxer, wg *sync.WaitGroup, f *flusher, ctx context.Context) error {
 	for k, v := range cfg.JSONListener {
 		if err := v.Validate(); err != nil {
 			return fmt.Errorf("JSONListener %s configuration is invalid: %w", k, err)
 		}
-		jhc := jsonHandlerConfig{
-			name:             k,
-			wg:               wg,
-			tags:             map[string]entry.EntryTag{},
-			ignoreTimestamps: v.Ignore_Timestamps,
-			setLocalTime:     v.Assume_Local_Timezone,
-			timezoneOverride: v.Timezone_Override,
-			ctx:              ctx,
-			formatOverride:   v.Timestamp_Format_Override,
-			timeFormats:      cfg.TimeFormat,
-			maxObjectSize:    int64(v.Max_Object_Size),
-			disableCompact:   v.Disable_Compact,
-		}
-		if jhc.proc, err = cfg.Preprocessor.ProcessorSet(igst, v.Preprocessor); err != nil {
-			lg.Fatal("preprocessor error", log.KVErr(err))
-		}
-		f.Add(jhc.proc)
-		if jhc.flds, err = v.GetJsonFields(); err != nil {
-			return err
-		}
-		if v.Source_Override != `` {
-			jhc.src = net.ParseIP(v.Source_Override)
-			if jhc.src == nil {
-				return fmt.Errorf("JSONListener %v invalid source override \"%s\"", k, v.Source_Override)
-			}
-		} else if cfg.Source_Override != `` {
-			// global override
-			jhc.src = net.ParseIP(cfg.Source_Override)
-			if jhc.src == nil {
-				return fmt.Errorf("global source override \"%s\" is invalid", cfg.Source_Override)
-			}
-		}
-		//resolve the default tag
-		if jhc.defTag, err = igst.GetTag(v.Default_Tag); err != nil {
+		if err := startListener(cfg, jsonListenerKind, k, v.Preprocessor, igst, wg, f, ctx); err != nil {
 			return err
 		}
+	}
+	debugout("Started %d json listeners\n", len(cfg.JSONListener))
+	return nil
+}
 
-		//resolve all the other tags
-		tms, err := v.TagMatchers()
-		if err != nil {
-			return err
+// prepJSONListener validates a JSON listener and builds its handler configuration
+func prepJSONListener(cfg *cfgType, ll *liveListener, igst relayMuxer, ctx context.Context) (pl *pendingListener, err error) {
+	k := ll.name
+	v, ok := cfg.JSONListener[k]
+	if !ok {
+		return nil, fmt.Errorf("JSONListener %v is not defined", k)
+	} else if err = v.Validate(); err != nil {
+		return nil, fmt.Errorf("JSONListener %s configuration is invalid: %w", k, err)
+	}
+	jhc := &jsonHandlerConfig{
+		name:             k,
+		wg:               ll.wg,
+		tags:             map[string]entry.EntryTag{},
+		ignoreTimestamps: v.Ignore_Timestamps,
+		setLocalTime:     v.Assume_Local_Timezone,
+		timezoneOverride: v.Timezone_Override,
+		proc:             ll.proc,
+		ctx:              ctx,
+		formatOverride:   v.Timestamp_Format_Override,
+		timeFormats:      cfg.TimeFormat,
+		maxObjectSize:    int64(v.Max_Object_Size),
+		disableCompact:   v.Disable_Compact,
+	}
+	if jhc.flds, err = v.GetJsonFields(); err != nil {
+		return
+	}
+	if v.Source_Override != `` {
+		jhc.src = net.ParseIP(v.Source_Override)
+		if jhc.src == nil {
+			return nil, fmt.Errorf("JSONListener %v invalid source override \"%s\"", k, v.Source_Override)
 		}
-		for _, tm := range tms {
-			tg, err := igst.GetTag(tm.Tag)
-			if err != nil {
-				return err
-			}
-			jhc.tags[tm.Value] = tg
+	} else if cfg.Source_Override != `` {
+		// global override
+		jhc.src = net.ParseIP(cfg.Source_Override)
+		if jhc.src == nil {
+			return nil, fmt.Errorf("global source override \"%s\" is invalid", cfg.Source_Override)
 		}
+	}
+	//resolve the default tag
+	if jhc.defTag, err = igst.GetTag(v.Default_Tag); err != nil {
+		return
+	}
 
-		tp, str, err := translateBindType(v.Bind_String)
+	//resolve all the other tags
+	tms, err := v.TagMatchers()
+	if err != nil {
+		return
+	}
+	for _, tm := range tms {
+		tg, err := igst.GetTag(tm.Tag)
 		if err != nil {
-			lg.FatalCode(0, "invalid bind", log.KV("bindstring", v.Bind_String), log.KVErr(err))
+			return nil, err
 		}
-
-		if tp.TCP() {
-			//get the socket
-			addr, err := net.ResolveTCPAddr("tcp", str)
-			if err != nil {
-				return fmt.Errorf("%s Bind-String \"%s\" is invalid: %v\n", k, v.Bind_String, err)
-			}
-			l, err := net.ListenTCP("tcp", addr)
-			if err != nil {
-				return fmt.Errorf("%s Failed to listen on \"%s\": %v\n", k, addr, err)
-			}
-			connID := addConn(l)
-			//start the acceptor
-			wg.Add(1)
-			go jsonAcceptor(l, connID, igst, jhc, tp)
-		} else if tp.TLS() {
-			config := &tls.Config{
-				MinVersion: tls.VersionTLS12,
-			}
-
-			config.Certificates = make([]tls.Certificate, 1)
-			config.Certificates[0], err = tls.LoadX509KeyPair(v.Cert_File, v.Key_File)
-			if err != nil {
-				lg.Fatal("failed to load certificate", log.KV("certfile", v.Cert_File), log.KV("keyfile", v.Key_File), log.KVErr(err))
-			}
-			//get the socket
-			addr, err := net.ResolveTCPAddr("tcp", str)
-			if err != nil {
-				lg.FatalCode(0, "invalid Bind-String", log.KV("bindstring", v.Bind_String), log.KV("jsonlistener", k), log.KVErr(err))
-			}
-			l, err := tls.Listen("tcp", addr.String(), config)
-			if err != nil {
-				lg.FatalCode(0, "failed to listen via TLS", log.KV("address", addr), log.KV("jsonlistener", k), log.KVErr(err))
-			}
-			connID := addConn(l)
-			//start the acceptor
-			wg.Add(1)
-			go jsonAcceptor(l, connID, igst, jhc, tp)
-		} else if tp.UDP() {
-			addr, err := net.ResolveUDPAddr(tp.String(), str)
-			if err != nil {
-				lg.FatalCode(0, "invalid Bind-String", log.KV("bindstring", v.Bind_String), log.KV("listener", k), log.KVErr(err))
-			}
-			l, err := net.ListenUDP(tp.String(), addr)
-			if err != nil {
-				lg.FatalCode(0, "failed to listen via udp", log.KV("address", addr), log.KV("listener", k), log.KVErr(err))
-			}
-			connID := addConn(l)
-			wg.Add(1)
-			go jsonAcceptorUDP(l, connID, igst, jhc)
-
-		}
-
+		jhc.tags[tm.Value] = tg
 	}
-	debugout("Started %d json listeners\n", len(cfg.JSONListener))
-	return nil
+	if _, err = newTimegrinder(jhc.ignoreTimestamps, jhc.setLocalTime, jhc.timezoneOverride, jhc.formatOverride, jhc.timeFormats); err != nil {
+		return nil, fmt.Errorf("%s %w", k, err)
+	}
+	if pl, err = newPendingListener(jsonListenerKind, k, v.baseConfig); err != nil {
+		return nil, err
+	}
+	pl.hcfg = jhc
+	return
 }
 
-func jsonAcceptor(lst net.Listener, id int, igst *ingest.IngestMuxer, cfg jsonHandlerConfig, tp bindType) {
-	defer cfg.wg.Done()
+func jsonAcceptor(lst net.Listener, id int, ll *liveListener, tp bindType) {
+	defer ll.wg.Done()
 	defer delConn(id)
 	defer lst.Close()
 	var failCount int
@@ -192,48 +145,26 @@ func jsonAcceptor(lst net.Listener, id int, igst *ingest.IngestMuxer, cfg jsonHa
 			}
 			continue
 		}
+		//new connections get whatever configuration is current
+		cfg := *ll.jsonConfig()
 		debugout("Accepted %v connection from %s in json mode\n", tp.String(), conn.RemoteAddr())
 		lg.Info("accepted connection", log.KV("address", conn.RemoteAddr()), log.KV("readertype", `json`), log.KV("mode", tp), log.KV("listener", cfg.name))
 		failCount = 0
-		go jsonConnHandler(conn, cfg, igst)
+		cfg.wg.Add(1)
+		go jsonConnHandler(conn, cfg)
 	}
 	return
 }
 
-func jsonAcceptorUDP(conn *net.UDPConn, id int, igst *ingest.IngestMuxer, cfg jsonHandlerConfig) {
-	defer cfg.wg.Done()
+func jsonAcceptorUDP(conn *net.UDPConn, id int, ll *liveListener) {
+	defer ll.wg.Done()
 	defer delConn(id)
 	defer conn.Close()
 
 	buff := make([]byte, 16*1024) //local buffer that should be big enough for even the largest UDP packets
-	tcfg := timegrinder.Config{
-		EnableLeftMostSeed: true,
-	}
-	tg, err := timegrinder.NewTimeGrinder(tcfg)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Failed to get a handle on the timegrinder: %v\n", err)
-		return
-	} else if err = cfg.timeFormats.LoadFormats(tg); err != nil {
-		fmt.Fprintf(os.Stderr, "Failed to load custom time formats: %v\n", err)
-		return
-	}
-	if cfg.setLocalTime {
-		tg.SetLocalTime()
-	}
-	if cfg.timezoneOverride != `` {
-		err = tg.SetTimezone(cfg.timezoneOverride)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "Failed to set timezone to %v: %v\n", cfg.timezoneOverride, err)
-			return
-		}
-	}
-	if cfg.formatOverride != `` {
-		if err = tg.SetFormatOverride(cfg.formatOverride); err != nil {
-			lg.Error("Failed to load format override", log.KV("override", cfg.formatOverride), log.KVErr(err))
-			return
-		}
-	}
-	ll := log.NewLoggerWithKV(lg, log.KV("json-listener", cfg.name))
+	var cfg *jsonHandlerConfig
+	var tg *timegrinder.TimeGrinder
+	var kvl *log.KVLogger
 	for {
 		n, raddr, err := conn.ReadFromUDP(buff)
 		if err != nil {
@@ -248,20 +179,28 @@ func jsonAcceptorUDP(conn *net.UDPConn, id int, igst *ingest.IngestMuxer, cfg js
 		if n > len(buff) {
 			continue
 		}
+		//pick up configuration reloads between packets
+		if nc := ll.jsonConfig(); nc != cfg {
+			if tg, err = newTimegrinder(nc.ignoreTimestamps, nc.setLocalTime, nc.timezoneOverride, nc.formatOverride, nc.timeFormats); err != nil {
+				lg.Error("failed to build timegrinder", log.KV("listener", nc.name), log.KVErr(err))
+				return
+			}
+			// get a local logger up that will always add some more info
+			kvl = log.NewLoggerWithKV(lg, log.KV("json-listener", nc.name))
+			cfg = nc
+		}
 		var rip net.IP
 		if cfg.src == nil {
 			rip = raddr.IP
 		} else {
 			rip = cfg.src
 		}
-		// get a local logger up that will always add some more info
-		handleJSONStream(bytes.NewReader(buff[0:]), cfg, rip, tg, ll)
+		handleJSONStream(bytes.NewReader(buff[0:]), *cfg, rip, tg, kvl)
 	}
 
 }
 
-func jsonConnHandler(c net.Conn, cfg jsonHandlerConfig, igst *ingest.IngestMuxer) {
-	cfg.wg.Add(1)
+func jsonConnHandler(c net.Conn, cfg jsonHandlerConfig) {
 	id := addConn(c)
 	defer cfg.wg.Done()
 	defer delConn(id)
@@ -20,8 +20,9 @@ import (
 	"github.com/gravwell/gravwell/v3/timegrinder"
 )
 
+var lineSep = []byte("\n")
+
 func lineConnHandlerTCP(c net.Conn, cfg handlerConfig) {
-	cfg.wg.Add(1)
 	id := addConn(c)
 	defer cfg.wg.Done()
 	defer delConn(id)
@@ -98,71 +99,19 @@ func lineConnHandlerTCP(c net.Conn, cfg handlerConfig) {
 	}
 }
 
-func lineConnHandlerUDP(c *net.UDPConn, cfg handlerConfig) {
-	sp := []byte("\n")
-	buff := make([]byte, 16*1024) //local buffer that should be big enough for even the largest UDP packets
-	tcfg := timegrinder.Config{
-		EnableLeftMostSeed: true,
-	}
-	tg, err := timegrinder.NewTimeGrinder(tcfg)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Failed to get a handle on the timegrinder: %v\n", err)
-		return
-	} else if err = cfg.timeFormats.LoadFormats(tg); err != nil {
-		fmt.Fprintf(os.Stderr, "Failed to load custom time formats: %v\n", err)
-		return
-	}
-	if cfg.setLocalTime {
-		tg.SetLocalTime()
-	}
-	if cfg.timezoneOverride != `` {
-		err = tg.SetTimezone(cfg.timezoneOverride)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "Failed to set timezone to %v: %v\n", cfg.timezoneOverride, err)
-			return
-		}
-	}
-	if cfg.formatOverride != `` {
-		if err = tg.SetFormatOverride(cfg.formatOverride); err != nil {
-			lg.Error("Failed to load format override", log.KV("override", cfg.formatOverride), log.KVErr(err))
-			return
-		}
-	}
-
-	for {
-		var rip net.IP
-		n, raddr, err := c.ReadFromUDP(buff)
-		if err != nil {
-			break
-		}
-		if n == 0 {
-			continue
-		}
-		if raddr == nil {
+// handleLinePacket ingests each line in a UDP packet
+func handleLinePacket(buff []byte, rip net.IP, cfg *handlerConfig, tg *timegrinder.TimeGrinder) error {
+	for _, ln := range bytes.Split(buff, lineSep) {
+		ln = bytes.Trim(ln, "\n\r\t ")
+		if len(ln) == 0 {
 			continue
 		}
-		if n > len(buff) {
-			continue
-		}
-		if cfg.src == nil {
-			rip = raddr.IP
-		} else {
-			rip = cfg.src
-		}
-
-		lns := bytes.Split(buff[:n], sp)
-		for _, ln := range lns {
-			ln = bytes.Trim(ln, "\n\r\t ")
-			if len(ln) == 0 {
-				continue
-			}
-			//because we are using and reusing a local buffer, we have to copy the bytes when handing in
-			if ent, err := handleLog(append([]byte(nil), ln...), rip, cfg.ignoreTimestamps, cfg.tag, tg); err != nil {
-				return
-			} else if err = cfg.proc.ProcessContext(ent, cfg.ctx); err != nil {
-				return
-			}
+		//because we are using and reusing a local buffer, we have to copy the bytes when handing in
+		if ent, err := handleLog(append([]byte(nil), ln...), rip, cfg.ignoreTimestamps, cfg.tag, tg); err != nil {
+			return err
+		} else if err = cfg.proc.ProcessContext(ent, cfg.ctx); err != nil {
+			return err
 		}
 	}
-
+	return nil
 }
@@ -100,10 +100,22 @@ func main() {
 		return
 	}
 
+	rr := &relayReloader{
+		cfg:  cfg,
+		igst: igst,
+		wg:   wg,
+		f:    &flshr,
+		ctx:  ctx,
+	}
+	if err := ib.EnableReload(igst, rr); err != nil {
+		lg.Error("failed to enable configuration reloading", log.KVErr(err))
+	}
+
 	lg.Info("Ingester running")
 
-	//listen for signals so we can close gracefully
-	utils.WaitForQuit()
+	//listen for signals so we can close gracefully, SIGHUP reloads the configuration
+	utils.WaitForQuitNoHangup()
+	ib.DisableReload()
 	ib.AnnounceShutdown()
 	debugout("Closing %d connections\n", connCount())
 	lg.Info("Closing active connections", log.KV("ingesteruuid", id), log.KV("active", connCount()))
@@ -162,6 +174,21 @@ func (f *flusher) Add(c io.Closer) {
 	f.Unlock()
 }
 
+// Remove drops c from the set without closing it, ok is false if c was not in the set
+// because it was never added or the flusher has already been closed.
+func (f *flusher) Remove(c io.Closer) (ok bool) {
+	f.Lock()
+	for i, v := range f.set {
+		if v == c {
+			f.set = append(f.set[:i], f.set[i+1:]...)
+			ok = true
+			break
+		}
+	}
+	f.Unlock()
+	return
+}
+
 func (f *flusher) Close() (err error) {
 	f.Lock()
 	for _, v := range f.set {
@@ -169,6 +196,7 @@ func (f *flusher) Close() (err error) {
 			err = addError(lerr, err)
 		}
 	}
+	f.set = nil
 	f.Unlock()
 	return
 }
@@ -12,17 +12,14 @@ import (
 	"bufio"
 	"bytes"
 	"context"
-	"crypto/tls"
 	"fmt"
 	"io"
 	"net"
-	"os"
 	"regexp"
 	"strings"
 	"sync"
 	"time"
 
-	"github.com/gravwell/gravwell/v3/ingest"
 	"github.com/gravwell/gravwell/v3/ingest/config"
 	"github.com/gravwell/gravwell/v3/ingest/entry"
 	"github.com/gravwell/gravwell/v3/ingest/log"
@@ -41,7 +38,7 @@ type regexHandlerConfig struct {
 	setLocalTime     bool
 	timezoneOverride string
 	src              net.IP
-	wg               *sync.WaitGroup
+	wg               waiter
 	formatOverride   string
 	proc             *processors.ProcessorSet
 	ctx              context.Context
@@ -51,114 +48,68 @@ type regexHandlerConfig struct {
 	maxBuffer        int
 }
 
-func startRegexListeners(cfg *cfgType, igst *ingest.IngestMuxer, wg *sync.WaitGroup, f *flusher, ctx context.Context) error {
-	var err error
-	//short circuit out on empty
-	if len(cfg.RegexListener) == 0 {
-		return nil
-	}
-
+func startRegexListeners(cfg *cfgType, igst relayMuxer, wg *sync.WaitGroup, f *flusher, ctx context.Context) error {
 	for k, v := range cfg.RegexListener {
-		rhc := regexHandlerConfig{
-			name:             k,
-			wg:               wg,
-			ignoreTimestamps: v.Ignore_Timestamps,
-			setLocalTime:     v.Assume_Local_Timezone,
-			timezoneOverride: v.Timezone_Override,
-			ctx:              ctx,
-			formatOverride:   v.Timestamp_Format_Override,
-			timeFormats:      cfg.TimeFormat,
-			regex:            v.Regex,
-			trimWhitespace:   v.Trim_Whitespace,
-			maxBuffer:        v.Max_Buffer,
-		}
-		if rhc.proc, err = cfg.Preprocessor.ProcessorSet(igst, v.Preprocessor); err != nil {
-			lg.Fatal("preprocessor error", log.KVErr(err))
-		}
-		f.Add(rhc.proc)
-		if _, err = regexp.Compile(v.Regex); err != nil {
-			return err
-		}
-		if v.Source_Override != `` {
-			rhc.src = net.ParseIP(v.Source_Override)
-			if rhc.src == nil {
-				return fmt.Errorf("RegexListener %v invalid source override \"%s\"", k, v.Source_Override)
-			}
-		} else if cfg.Source_Override != `` {
-			// global override
-			rhc.src = net.ParseIP(cfg.Source_Override)
-			if rhc.src == nil {
-				return fmt.Errorf("global source override \"%s\" is invalid", cfg.Source_Override)
-			}
-		}
-		//resolve default tag
-		if rhc.defTag, err = igst.GetTag(v.Tag_Name); err != nil {
+		if err := startListener(cfg, regexListenerKind, k, v.Preprocessor, igst, wg, f, ctx); err != nil {
 			return err
 		}
+	}
+	debugout("Started %d regex listeners\n", len(cfg.RegexListener))
+	return nil
+}
 
-		tp, str, err := translateBindType(v.Bind_String)
-		if err != nil {
-			lg.FatalCode(0, "invalid bind", log.KV("bindstring", v.Bind_String), log.KVErr(err))
+// prepRegexListener validates a regex listener and builds its handler configuration
+func prepRegexListener(cfg *cfgType, ll *liveListener, igst relayMuxer, ctx context.Context) (pl *pendingListener, err error) {
+	k := ll.name
+	v, ok := cfg.RegexListener[k]
+	if !ok {
+		return nil, fmt.Errorf("RegexListener %v is not defined", k)
+	}
+	rhc := &regexHandlerConfig{
+		name:             k,
+		wg:               ll.wg,
+		ignoreTimestamps: v.Ignore_Timestamps,
+		setLocalTime:     v.Assume_Local_Timezone,
+		timezoneOverride: v.Timezone_Override,
+		proc:             ll.proc,
+		ctx:              ctx,
+		formatOverride:   v.Timestamp_Format_Override,
+		timeFormats:      cfg.TimeFormat,
+		regex:            v.Regex,
+		trimWhitespace:   v.Trim_Whitespace,
+		maxBuffer:        v.Max_Buffer,
+	}
+	if _, err = regexp.Compile(v.Regex); err != nil {
+		return
+	}
+	if v.Source_Override != `` {
+		rhc.src = net.ParseIP(v.Source_Override)
+		if rhc.src == nil {
+			return nil, fmt.Errorf("RegexListener %v invalid source override \"%s\"", k, v.Source_Override)
 		}
-
-		if tp.TCP() {
-			//get the socket
-			addr, err := net.ResolveTCPAddr("tcp", str)
-			if err != nil {
-				return fmt.Errorf("%s Bind-String \"%s\" is invalid: %v\n", k, v.Bind_String, err)
-			}
-			l, err := net.ListenTCP("tcp", addr)
-			if err != nil {
-				return fmt.Errorf("%s Failed to listen on \"%s\": %v\n", k, addr, err)
-			}
-			connID := addConn(l)
-			//start the acceptor
-			wg.Add(1)
-			go regexAcceptor(l, connID, igst, rhc, tp)
-		} else if tp.TLS() {
-			config := &tls.Config{
-				MinVersion: tls.VersionTLS12,
-			}
-
-			config.Certificates = make([]tls.Certificate, 1)
-			config.Certificates[0], err = tls.LoadX509KeyPair(v.Cert_File, v.Key_File)
-			if err != nil {
-				lg.Fatal("failed to load certificate", log.KV("certfile", v.Cert_File), log.KV("keyfile", v.Key_File), log.KVErr(err))
-			}
-			//get the socket
-			addr, err := net.ResolveTCPAddr("tcp", str)
-			if err != nil {
-				lg.FatalCode(0, "invalid Bind-String", log.KV("bindstring", v.Bind_String), log.KV("regexlistener", k), log.KVErr(err))
-			}
-			l, err := tls.Listen("tcp", addr.String(), config)
-			if err != nil {
-				lg.FatalCode(0, "failed to listen via TLS", log.KV("address", addr), log.KV("regexlistener", k), log.KVErr(err))
-			}
-			connID := addConn(l)
-			//start the acceptor
-			wg.Add(1)
-			go regexAcceptor(l, connID, igst, rhc, tp)
-		} else if tp.UDP() {
-			addr, err := net.ResolveUDPAddr(`udp`, str)
-			if err != nil {
-				lg.FatalCode(0, "invalid Bind-String", log.KV("bindstring", v.Bind_String), log.KV("listener", k), log.KVErr(err))
-			}
-			l, err := net.ListenUDP(`udp`, addr)
-			if err != nil {
-				lg.FatalCode(0, "failed to listen via udp", log.KV("address", addr), log.KV("listener", k), log.KVErr(err))
-			}
-			connID := addConn(l)
-			wg.Add(1)
-			go regexAcceptorUDP(l, connID, rhc, igst)
+	} else if cfg.Source_Override != `` {
+		// global override
+		rhc.src = net.ParseIP(cfg.Source_Override)
+		if rhc.src == nil {
+			return nil, fmt.Errorf("global source override \"%s\" is invalid", cfg.Source_Override)
 		}
-
 	}
-	debugout("Started %d regex listeners\n", len(cfg.RegexListener))
-	return nil
+	//resolve default tag
+	if rhc.defTag, err = igst.GetTag(v.Tag_Name); err != nil {
+		return
+	}
+	if _, err = newTimegrinder(rhc.ignoreTimestamps, rhc.setLocalTime, rhc.timezoneOverride, rhc.formatOverride, rhc.timeFormats); err != nil {
+		return nil, fmt.Errorf("%s %w", k, err)
+	}
+	if pl, err = newPendingListener(regexListenerKind, k, v.baseConfig); err != nil {
+		return nil, err
+	}
+	pl.hcfg = rhc
+	return
 }
 
-func regexAcceptor(lst net.Listener, id int, igst *ingest.IngestMuxer, cfg regexHandlerConfig, tp bindType) {
-	defer cfg.wg.Done()
+func regexAcceptor(lst net.Listener, id int, ll *liveListener, tp bindType) {
+	defer ll.wg.Done()
 	defer delConn(id)
 	defer lst.Close()
 	var failCount int
@@ -176,61 +127,26 @@ func regexAcceptor(lst net.Listener, id int, igst *ingest.IngestMuxer, cfg regex
 			}
 			continue
 		}
+		//new connections get whatever configuration is current
+		cfg := *ll.regexConfig()
 		debugout("Accepted %v connection from %s in regex mode\n", tp.String(), conn.RemoteAddr())
 		lg.Info("accepted connection", log.KV("address", conn.RemoteAddr()), log.KV("readertype", `regex`), log.KV("mode", tp), log.KV("listener", cfg.name))
 		failCount = 0
-		go regexConnHandler(conn, cfg, igst)
+		cfg.wg.Add(1)
+		go regexConnHandler(conn, cfg)
 	}
 	return
 }
 
-func regexAcceptorUDP(conn *net.UDPConn, id int, cfg regexHandlerConfig, igst *ingest.IngestMuxer) {
-	defer cfg.wg.Done()
+func regexAcceptorUDP(conn *net.UDPConn, id int, ll *liveListener) {
+	defer ll.wg.Done()
 	defer delConn(id)
 	defer conn.Close()
 
 	buff := make([]byte, 16*1024) //local buffer that should be big enough for even the largest UDP packets
-	tcfg := timegrinder.Config{
-		EnableLeftMostSeed: true,
-	}
-	tg, err := timegrinder.NewTimeGrinder(tcfg)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Failed to get a handle on the timegrinder: %v\n", err)
-		return
-	} else if err = cfg.timeFormats.LoadFormats(tg); err != nil {
-		fmt.Fprintf(os.Stderr, "Failed to load custom time formats: %v\n", err)
-		return
-	}
-	if cfg.setLocalTime {
-		tg.SetLocalTime()
-	}
-	if cfg.timezoneOverride != `` {
-		err = tg.SetTimezone(cfg.timezoneOverride)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "Failed to set timezone to %v: %v\n", cfg.timezoneOverride, err)
-			return
-		}
-	}
-	if cfg.formatOverride != `` {
-		if err = tg.SetFormatOverride(cfg.formatOverride); err != nil {
-			lg.Error("Failed to load format override", log.KV("override", cfg.formatOverride), log.KVErr(err))
-			return
-		}
-	}
-	regex, err := regexp.Compile(cfg.regex)
-	if err != nil {
-		// will never happen (we always check the regex first)
-		return
-	}
-	rs := regexState{
-		rx:          regex,
-		prefixIndex: regex.SubexpIndex("prefix"),
-		suffixIndex: regex.SubexpIndex("suffix"),
-	}
-	if cfg.maxBuffer == 0 {
-		cfg.maxBuffer = DefaultMaxBuffer
-	}
-
+	var cfg *regexHandlerConfig
+	var tg *timegrinder.TimeGrinder
+	var rs regexState
 	for {
 		var rip net.IP
 		n, raddr, err := conn.ReadFromUDP(buff)
@@ -246,18 +162,39 @@ func regexAcceptorUDP(conn *net.UDPConn, id int, cfg regexHandlerConfig, igst *i
 		if n > len(buff) {
 			continue
 		}
+		//pick up configuration reloads between packets
+		if nc := ll.regexConfig(); nc != cfg {
+			if tg, err = newTimegrinder(nc.ignoreTimestamps, nc.setLocalTime, nc.timezoneOverride, nc.formatOverride, nc.timeFormats); err != nil {
+				lg.Error("failed to build timegrinder", log.KV("listener", nc.name), log.KVErr(err))
+				return
+			}
+			regex, err := regexp.Compile(nc.regex)
+			if err != nil {
+				// will never happen (we always check the regex first)
+				return
+			}
+			rs = regexState{
+				rx:          regex,
+				prefixIndex: regex.SubexpIndex("prefix"),
+				suffixIndex: regex.SubexpIndex("suffix"),
+			}
+			cfg = nc
+		}
 		if cfg.src == nil {
 			rip = raddr.IP
 		} else {
 			rip = cfg.src
 		}
-		regexLoop(bytes.NewReader(buff[:n]), cfg, rip, rs, tg)
+		rcfg := *cfg
+		if rcfg.maxBuffer == 0 {
+			rcfg.maxBuffer = DefaultMaxBuffer
+		}
+		regexLoop(bytes.NewReader(buff[:n]), rcfg, rip, rs, tg)
 	}
 
 }
 
-func regexConnHandler(c net.Conn, cfg regexHandlerConfig, igst *ingest.IngestMuxer) {
-	cfg.wg.Add(1)
+func regexConnHandler(c net.Conn, cfg regexHandlerConfig) {
 	id := addConn(c)
 	defer cfg.wg.Done()
 	defer delConn(id)
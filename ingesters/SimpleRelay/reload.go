@@ -0,0 +1,531 @@
+/*************************************************************************
+ * Copyright 2024 Gravwell, Inc. All rights reserved.
+ * Contact: <legal@gravwell.io>
+ *
+ * This software may be modified and distributed under the terms of the
+ * BSD 2-clause license. See the LICENSE file for details.
+ **************************************************************************/
+
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"reflect"
+	"sync"
+	"sync/atomic"
+
+	"github.com/gravwell/gravwell/v3/ingest/config"
+	"github.com/gravwell/gravwell/v3/ingest/entry"
+	"github.com/gravwell/gravwell/v3/ingest/log"
+	"github.com/gravwell/gravwell/v3/ingest/processors"
+)
+
+const (
+	simpleListenerKind = `Listener`
+	regexListenerKind  = `RegexListener`
+	jsonListenerKind   = `JSONListener`
+)
+
+var (
+	liveListeners = map[string]*liveListener{}
+)
+
+// relayMuxer is the part of the ingest muxer that listeners are built against
+type relayMuxer interface {
+	processors.Tagger
+	GetTag(string) (entry.EntryTag, error)
+	WriteEntry(*entry.Entry) error
+	WriteEntryContext(context.Context, *entry.Entry) error
+	WriteBatch([]*entry.Entry) error
+	WriteBatchContext(context.Context, []*entry.Entry) error
+}
+
+// waiter is satisfied by sync.WaitGroup and listenerGroup
+type waiter interface {
+	Add(int)
+	Done()
+}
+
+// listenerGroup tracks the acceptor and connections belonging to a single listener,
+// everything added to it is also added to the global wait group used at shutdown.
+type listenerGroup struct {
+	sync.WaitGroup
+	global *sync.WaitGroup
+}
+
+func (g *listenerGroup) Add(n int) {
+	g.global.Add(n)
+	g.WaitGroup.Add(n)
+}
+
+func (g *listenerGroup) Done() {
+	g.WaitGroup.Done()
+	g.global.Done()
+}
+
+// liveListener is a configured listener that is running.  Its socket may be replaced on
+// reload, but the preprocessor set and wait group stay with the listener for its lifetime.
+// The handler configuration is swapped in place so that tag, parsing, and timestamp changes
+// do not require a new socket; acceptors pick it up on the next connection or packet.
+type liveListener struct {
+	kind    string
+	name    string
+	proc    *processors.ProcessorSet
+	wg      *listenerGroup
+	hcfg    atomic.Value // *handlerConfig, *regexHandlerConfig, or *jsonHandlerConfig
+	connID  int          // protected by mtx
+	bindKey string       // protected by mtx
+}
+
+func newLiveListener(kind, name string, proc *processors.ProcessorSet, wg *sync.WaitGroup) *liveListener {
+	return &liveListener{
+		kind: kind,
+		name: name,
+		proc: proc,
+		wg:   &listenerGroup{global: wg},
+	}
+}
+
+func listenerKey(kind, name string) string {
+	return kind + `/` + name
+}
+
+// trackListener records a listener so that a reload can find it again
+func trackListener(ll *liveListener) {
+	mtx.Lock()
+	liveListeners[listenerKey(ll.kind, ll.name)] = ll
+	mtx.Unlock()
+}
+
+func getListener(kind, name string) (ll *liveListener, ok bool) {
+	mtx.Lock()
+	ll, ok = liveListeners[listenerKey(kind, name)]
+	mtx.Unlock()
+	return
+}
+
+func (ll *liveListener) handlerConfig() *handlerConfig {
+	v, _ := ll.hcfg.Load().(*handlerConfig)
+	return v
+}
+
+func (ll *liveListener) regexConfig() *regexHandlerConfig {
+	v, _ := ll.hcfg.Load().(*regexHandlerConfig)
+	return v
+}
+
+func (ll *liveListener) jsonConfig() *jsonHandlerConfig {
+	v, _ := ll.hcfg.Load().(*jsonHandlerConfig)
+	return v
+}
+
+// start hands a bound socket to the listener and fires up its acceptor
+func (ll *liveListener) start(pl *pendingListener, igst relayMuxer) {
+	ll.hcfg.Store(pl.hcfg)
+	connID := addConn(pl.sock)
+	mtx.Lock()
+	ll.connID = connID
+	ll.bindKey = pl.bindKey()
+	mtx.Unlock()
+	ll.wg.Add(1)
+	if conn, ok := pl.sock.(*net.UDPConn); ok {
+		switch ll.kind {
+		case simpleListenerKind:
+			go acceptorUDP(conn, connID, ll)
+		case regexListenerKind:
+			go regexAcceptorUDP(conn, connID, ll)
+		case jsonListenerKind:
+			go jsonAcceptorUDP(conn, connID, ll)
+		}
+		return
+	}
+	lst := pl.sock.(net.Listener)
+	switch ll.kind {
+	case simpleListenerKind:
+		go acceptor(lst, connID, ll, pl.tp)
+	case regexListenerKind:
+		go regexAcceptor(lst, connID, ll, pl.tp)
+	case jsonListenerKind:
+		go jsonAcceptor(lst, connID, ll, pl.tp)
+	}
+}
+
+// closeSocket closes the listening socket, connections that are already established
+// keep running with the configuration they were accepted under
+func (ll *liveListener) closeSocket() {
+	mtx.Lock()
+	c := connClosers[ll.connID]
+	mtx.Unlock()
+	if c != nil {
+		c.Close()
+	}
+}
+
+func (ll *liveListener) getBindKey() (key string) {
+	mtx.Lock()
+	key = ll.bindKey
+	mtx.Unlock()
+	return
+}
+
+// retire forgets a listener whose socket has been closed.  Its preprocessors are flushed,
+// closed, and removed from the flusher once the connections it accepted have finished.
+func (ll *liveListener) retire(f *flusher) {
+	mtx.Lock()
+	delete(liveListeners, listenerKey(ll.kind, ll.name))
+	mtx.Unlock()
+	go func() {
+		ll.wg.Wait()
+		//if the flusher no longer has the set we are shutting down and it was already closed
+		if f.Remove(ll.proc) {
+			if err := ll.proc.Close(); err != nil {
+				lg.Error("failed to close preprocessors", log.KV("listener", ll.name), log.KVErr(err))
+			}
+		}
+	}()
+}
+
+// pendingListener is a listener configuration that has been fully validated, bind opens
+// its socket and liveListener.start begins serving it.
+type pendingListener struct {
+	kind    string
+	name    string
+	tp      bindType
+	tcpAddr *net.TCPAddr
+	udpAddr *net.UDPAddr
+	tlsCfg  *tls.Config
+	hcfg    interface{}
+	sock    closer
+}
+
+// newPendingListener resolves the bind string and loads any TLS certificate without opening a socket
+func newPendingListener(kind, name string, v baseConfig) (pl *pendingListener, err error) {
+	var str string
+	pl = &pendingListener{kind: kind, name: name}
+	if pl.tp, str, err = translateBindType(v.Bind_String); err != nil {
+		return nil, fmt.Errorf("%s invalid bind %v: %w", name, v.Bind_String, err)
+	}
+	if pl.tp.UDP() {
+		if pl.udpAddr, err = net.ResolveUDPAddr(pl.tp.String(), str); err != nil {
+			return nil, fmt.Errorf("%s invalid Bind-String %v: %w", name, v.Bind_String, err)
+		}
+		return
+	}
+	network := pl.tp.String()
+	if pl.tp.TLS() {
+		network = `tcp`
+		pl.tlsCfg = &tls.Config{
+			MinVersion:   tls.VersionTLS12,
+			Certificates: make([]tls.Certificate, 1),
+		}
+		if pl.tlsCfg.Certificates[0], err = tls.LoadX509KeyPair(v.Cert_File, v.Key_File); err != nil {
+			return nil, fmt.Errorf("%s failed to load certificate %v: %w", name, v.Cert_File, err)
+		}
+	}
+	if pl.tcpAddr, err = net.ResolveTCPAddr(network, str); err != nil {
+		return nil, fmt.Errorf("%s invalid Bind-String %v: %w", name, v.Bind_String, err)
+	}
+	return
+}
+
+// bind opens the socket for the listener
+func (pl *pendingListener) bind() (err error) {
+	switch {
+	case pl.tp.UDP():
+		var l *net.UDPConn
+		if l, err = net.ListenUDP(pl.tp.String(), pl.udpAddr); err != nil {
+			return fmt.Errorf("%s failed to listen via udp %v: %w", pl.name, pl.udpAddr, err)
+		}
+		pl.sock = l
+	case pl.tp.TLS():
+		var l net.Listener
+		if l, err = tls.Listen("tcp", pl.tcpAddr.String(), pl.tlsCfg); err != nil {
+			return fmt.Errorf("%s failed to listen via TLS %v: %w", pl.name, pl.tcpAddr, err)
+		}
+		pl.sock = l
+	default:
+		var l *net.TCPListener
+		if l, err = net.ListenTCP(pl.tp.String(), pl.tcpAddr); err != nil {
+			return fmt.Errorf("%s failed to listen on %v: %w", pl.name, pl.tcpAddr, err)
+		}
+		pl.sock = l
+	}
+	return
+}
+
+// abort closes a socket that was bound but never started
+func (pl *pendingListener) abort() {
+	if pl != nil && pl.sock != nil {
+		pl.sock.Close()
+		pl.sock = nil
+	}
+}
+
+// bindKey identifies the port a listener holds, two listeners with the same key cannot be bound at once
+func (pl *pendingListener) bindKey() string {
+	if pl.tp.UDP() {
+		return fmt.Sprintf("udp/%d", pl.udpAddr.Port)
+	}
+	return fmt.Sprintf("tcp/%d", pl.tcpAddr.Port)
+}
+
+// prepListener validates a listener from cfg and builds its handler configuration around
+// the preprocessor set and wait group of ll
+func prepListener(cfg *cfgType, ll *liveListener, igst relayMuxer, ctx context.Context) (*pendingListener, error) {
+	switch ll.kind {
+	case simpleListenerKind:
+		return prepSimpleListener(cfg, ll, igst, ctx)
+	case regexListenerKind:
+		return prepRegexListener(cfg, ll, igst, ctx)
+	case jsonListenerKind:
+		return prepJSONListener(cfg, ll, igst, ctx)
+	}
+	return nil, fmt.Errorf("unknown listener type %q", ll.kind)
+}
+
+// startListener builds, binds, and starts a single listener at startup
+func startListener(cfg *cfgType, kind, name string, chain []string, igst relayMuxer, wg *sync.WaitGroup, f *flusher, ctx context.Context) (err error) {
+	var proc *processors.ProcessorSet
+	var pl *pendingListener
+	if proc, err = cfg.Preprocessor.ProcessorSet(igst, chain); err != nil {
+		return fmt.Errorf("%s preprocessor error: %w", name, err)
+	}
+	f.Add(proc)
+	ll := newLiveListener(kind, name, proc, wg)
+	if pl, err = prepListener(cfg, ll, igst, ctx); err != nil {
+		return
+	} else if err = pl.bind(); err != nil {
+		return
+	}
+	trackListener(ll)
+	ll.start(pl, igst)
+	return
+}
+
+// relayReloader applies configuration reloads to the running listeners.
+//
+// Listeners whose bind settings (Bind-String, Cert-File, and Key-File) are unchanged keep
+// their sockets, everything else about them is swapped into the running listener and a
+// changed preprocessor chain is reloaded in place.  Listeners with new bind settings and
+// new listeners get new sockets, which are bound before any old socket is closed, unless
+// they need a port that a replaced or removed listener is giving up.  If any socket cannot be
+// bound, the new sockets are closed, any old sockets are restored, and the running
+// configuration is left as it was.
+type relayReloader struct {
+	sync.Mutex
+	cfg  *cfgType
+	igst relayMuxer
+	wg   *sync.WaitGroup
+	f    *flusher
+	ctx  context.Context
+}
+
+// configuredListener is a listener as it appears in a configuration
+type configuredListener struct {
+	kind string
+	name string
+	base baseConfig
+}
+
+func configuredListeners(cfg *cfgType) map[string]configuredListener {
+	r := make(map[string]configuredListener, len(cfg.Listener)+len(cfg.RegexListener)+len(cfg.JSONListener))
+	for k, v := range cfg.Listener {
+		r[listenerKey(simpleListenerKind, k)] = configuredListener{kind: simpleListenerKind, name: k, base: v.baseConfig}
+	}
+	for k, v := range cfg.RegexListener {
+		r[listenerKey(regexListenerKind, k)] = configuredListener{kind: regexListenerKind, name: k, base: v.baseConfig}
+	}
+	for k, v := range cfg.JSONListener {
+		r[listenerKey(jsonListenerKind, k)] = configuredListener{kind: jsonListenerKind, name: k, base: v.baseConfig}
+	}
+	return r
+}
+
+type listenerPlan struct {
+	ll     *liveListener
+	fresh  bool                     // ll is a new listener that is not tracked yet
+	rebind bool                     // the listener needs a new socket
+	swap   *processors.ProcessorSet // replacement preprocessor chain
+	pl     *pendingListener
+}
+
+func (rr *relayReloader) Reload(obj interface{}) (err error) {
+	ncfg, ok := obj.(*cfgType)
+	if !ok || ncfg == nil {
+		return fmt.Errorf("invalid configuration type %T", obj)
+	}
+	rr.Lock()
+	defer rr.Unlock()
+
+	olds := configuredListeners(rr.cfg)
+	news := configuredListeners(ncfg)
+
+	//build and validate everything before touching anything that is running
+	var plans []*listenerPlan
+	defer func() {
+		if err == nil {
+			return
+		}
+		for _, p := range plans {
+			p.pl.abort()
+			if p.swap != nil {
+				p.swap.Close()
+			}
+			if p.fresh {
+				p.ll.proc.Close()
+			}
+		}
+	}()
+	for key, nl := range news {
+		p := &listenerPlan{}
+		ol, existed := olds[key]
+		ll, live := getListener(nl.kind, nl.name)
+		if existed && live {
+			p.ll = ll
+			p.rebind = !sameBind(ol.base, nl.base)
+			if chainChanged(rr.cfg.Preprocessor, ncfg.Preprocessor, ol.base.Preprocessor, nl.base.Preprocessor) {
+				if p.swap, err = ncfg.Preprocessor.ProcessorSet(rr.igst, nl.base.Preprocessor); err != nil {
+					return fmt.Errorf("%s %s preprocessor error: %w", nl.kind, nl.name, err)
+				}
+			}
+		} else {
+			var proc *processors.ProcessorSet
+			if proc, err = ncfg.Preprocessor.ProcessorSet(rr.igst, nl.base.Preprocessor); err != nil {
+				return fmt.Errorf("%s %s preprocessor error: %w", nl.kind, nl.name, err)
+			}
+			p.ll = newLiveListener(nl.kind, nl.name, proc, rr.wg)
+			p.fresh, p.rebind = true, true
+		}
+		plans = append(plans, p)
+		if p.pl, err = prepListener(ncfg, p.ll, rr.igst, rr.ctx); err != nil {
+			return
+		}
+	}
+
+	//everything that is giving up its socket
+	var closing []*liveListener
+	var removed []*liveListener
+	releasing := map[string]bool{}
+	for key, ol := range olds {
+		if _, ok := news[key]; ok {
+			continue
+		}
+		if ll, live := getListener(ol.kind, ol.name); live {
+			closing = append(closing, ll)
+			removed = append(removed, ll)
+		}
+	}
+	for _, p := range plans {
+		if p.rebind && !p.fresh {
+			closing = append(closing, p.ll)
+		}
+	}
+	for _, ll := range closing {
+		releasing[ll.getBindKey()] = true
+	}
+
+	//bind new sockets while the old ones are still up, anything that needs a port
+	//being given up has to wait until the old socket is closed
+	var deferred []*listenerPlan
+	for _, p := range plans {
+		if !p.rebind {
+			continue
+		} else if releasing[p.pl.bindKey()] {
+			deferred = append(deferred, p)
+		} else if err = p.pl.bind(); err != nil {
+			return
+		}
+	}
+	for _, ll := range closing {
+		ll.closeSocket()
+	}
+	for _, p := range deferred {
+		if err = p.pl.bind(); err != nil {
+			for _, p := range plans {
+				p.pl.abort()
+			}
+			rr.restore(closing)
+			return
+		}
+	}
+
+	//everything is bound, switch over
+	for _, p := range plans {
+		if p.swap != nil {
+			if lerr := p.ll.proc.Reload(p.swap); lerr != nil {
+				lg.Error("failed to flush replaced preprocessors", log.KV("listener", p.ll.name), log.KVErr(lerr))
+			}
+			lg.Info("reloaded preprocessors", log.KV("listener", p.ll.name), log.KV("type", p.ll.kind))
+		}
+		if p.fresh {
+			rr.f.Add(p.ll.proc)
+			trackListener(p.ll)
+		}
+		if p.rebind {
+			p.ll.start(p.pl, rr.igst)
+			lg.Info("started listener", log.KV("listener", p.ll.name), log.KV("type", p.ll.kind))
+		} else {
+			p.ll.hcfg.Store(p.pl.hcfg)
+		}
+	}
+	for _, ll := range removed {
+		ll.retire(rr.f)
+		lg.Info("closed listener", log.KV("listener", ll.name), log.KV("type", ll.kind))
+	}
+	rr.cfg = ncfg
+	return
+}
+
+// restore puts the sockets for the running configuration back after a failed reload
+func (rr *relayReloader) restore(lls []*liveListener) {
+	for _, ll := range lls {
+		pl, err := prepListener(rr.cfg, ll, rr.igst, rr.ctx)
+		if err == nil {
+			err = pl.bind()
+		}
+		if err != nil {
+			lg.Error("failed to restore listener", log.KV("listener", ll.name), log.KV("type", ll.kind), log.KVErr(err))
+			continue
+		}
+		ll.start(pl, rr.igst)
+	}
+}
+
+// sameBind checks if a listener can keep its socket, only the bind string (which includes
+// the protocol) and TLS certificate matter, everything else is swapped into the running listener
+func sameBind(a, b baseConfig) bool {
+	return a.Bind_String == b.Bind_String && a.Cert_File == b.Cert_File && a.Key_File == b.Key_File
+}
+
+// chainChanged checks if the ordered set of preprocessors or any of their configs changed
+func chainChanged(apc, bpc processors.ProcessorConfig, a, b []string) bool {
+	if !reflect.DeepEqual(a, b) {
+		return true
+	}
+	for _, n := range a {
+		if !sameVariableConfig(apc[n], bpc[n]) {
+			return true
+		}
+	}
+	return false
+}
+
+func sameVariableConfig(a, b *config.VariableConfig) bool {
+	if a == nil || b == nil {
+		return a == b
+	} else if len(a.Vals) != len(b.Vals) {
+		return false
+	}
+	for k, v := range a.Vals {
+		ov, ok := b.Vals[k]
+		if !ok || (v == nil) != (ov == nil) {
+			return false
+		} else if v != nil && !reflect.DeepEqual(*v, *ov) {
+			return false
+		}
+	}
+	return true
+}
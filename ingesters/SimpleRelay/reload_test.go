@@ -0,0 +1,391 @@
+/*************************************************************************
+ * Copyright 2024 Gravwell, Inc. All rights reserved.
+ * Contact: <legal@gravwell.io>
+ *
+ * This software may be modified and distributed under the terms of the
+ * BSD 2-clause license. See the LICENSE file for details.
+ **************************************************************************/
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gravwell/gravwell/v3/ingest/entry"
+	"github.com/gravwell/gravwell/v3/ingest/log"
+)
+
+const (
+	reloadBaseConfig = `
+[Global]
+Ingest-Secret = IngestSecrets
+Cleartext-Backend-target=127.0.0.1:4023
+
+[Listener "syslog"]
+	Bind-String = "127.0.0.1:7777"
+	Tag-Name = syslog
+	Preprocessor = route
+
+[Preprocessor "route"]
+	Type = regexrouter
+	Regex = "(?P<app>[a-z]+)"
+	Route-Extraction = app
+	Route = sshd:ssh
+`
+	reloadChainConfig = `
+[Global]
+Ingest-Secret = IngestSecrets
+Cleartext-Backend-target=127.0.0.1:4023
+
+[Listener "syslog"]
+	Bind-String = "127.0.0.1:7777"
+	Tag-Name = syslog
+	Preprocessor = route
+
+[Preprocessor "route"]
+	Type = regexrouter
+	Regex = "(?P<app>[a-z]+)"
+	Route-Extraction = app
+	Route = sshd:ssh
+	Route = sudo:auth
+`
+	reloadBindConfig = `
+[Global]
+Ingest-Secret = IngestSecrets
+Cleartext-Backend-target=127.0.0.1:4023
+
+[Listener "syslog"]
+	Bind-String = "127.0.0.1:7778"
+	Tag-Name = syslog
+	Preprocessor = route
+
+[Preprocessor "route"]
+	Type = regexrouter
+	Regex = "(?P<app>[a-z]+)"
+	Route-Extraction = app
+	Route = sshd:ssh
+`
+)
+
+func loadReloadConfig(t *testing.T, v string) *cfgType {
+	p, err := dropConfig(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := GetConfig(p, ``)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cfg
+}
+
+func TestReloadComparisons(t *testing.T) {
+	base := loadReloadConfig(t, reloadBaseConfig)
+	same := loadReloadConfig(t, reloadBaseConfig)
+	chain := loadReloadConfig(t, reloadChainConfig)
+	bind := loadReloadConfig(t, reloadBindConfig)
+
+	a := base.Listener[`syslog`]
+	if !sameBind(a.baseConfig, same.Listener[`syslog`].baseConfig) {
+		t.Fatal("identical listeners do not match")
+	} else if chainChanged(base.Preprocessor, same.Preprocessor, a.Preprocessor, same.Listener[`syslog`].Preprocessor) {
+		t.Fatal("identical preprocessor chains flagged as changed")
+	}
+
+	if !sameBind(a.baseConfig, chain.Listener[`syslog`].baseConfig) {
+		t.Fatal("preprocessor changes flagged as a bind change")
+	} else if !chainChanged(base.Preprocessor, chain.Preprocessor, a.Preprocessor, chain.Listener[`syslog`].Preprocessor) {
+		t.Fatal("failed to catch changed preprocessor config")
+	}
+
+	if sameBind(a.baseConfig, bind.Listener[`syslog`].baseConfig) {
+		t.Fatal("failed to catch bind change")
+	}
+
+	b := *a
+	b.Tag_Name = `other`
+	b.Timezone_Override = `America/Denver`
+	b.Reader_Type = `rfc5424`
+	if !sameBind(a.baseConfig, b.baseConfig) {
+		t.Fatal("tag and timestamp changes flagged as a bind change")
+	}
+	b = *a
+	b.Cert_File = `/tmp/cert.pem`
+	if sameBind(a.baseConfig, b.baseConfig) {
+		t.Fatal("failed to catch certificate change")
+	}
+}
+
+const reloadLiveConfig = `
+[Global]
+Ingest-Secret = IngestSecrets
+Cleartext-Backend-target=127.0.0.1:4023
+
+[Listener "tcp"]
+	Bind-String = "tcp://127.0.0.1:%d"
+	Tag-Name = %s
+
+[Listener "udp"]
+	Bind-String = "udp://127.0.0.1:%d"
+	Tag-Name = %s
+`
+
+// testMuxer stands in for the ingest muxer, every entry written lands on ents
+type testMuxer struct {
+	sync.Mutex
+	tags []string
+	ents chan *entry.Entry
+}
+
+func (m *testMuxer) NegotiateTag(name string) (entry.EntryTag, error) {
+	m.Lock()
+	defer m.Unlock()
+	for i, v := range m.tags {
+		if v == name {
+			return entry.EntryTag(i), nil
+		}
+	}
+	m.tags = append(m.tags, name)
+	return entry.EntryTag(len(m.tags) - 1), nil
+}
+
+func (m *testMuxer) GetTag(name string) (entry.EntryTag, error) { return m.NegotiateTag(name) }
+
+func (m *testMuxer) LookupTag(tg entry.EntryTag) (string, bool) {
+	m.Lock()
+	defer m.Unlock()
+	if int(tg) < len(m.tags) {
+		return m.tags[tg], true
+	}
+	return ``, false
+}
+
+func (m *testMuxer) KnownTags() []string {
+	m.Lock()
+	defer m.Unlock()
+	return append([]string(nil), m.tags...)
+}
+
+func (m *testMuxer) WriteEntry(ent *entry.Entry) error {
+	m.ents <- ent
+	return nil
+}
+
+func (m *testMuxer) WriteEntryContext(ctx context.Context, ent *entry.Entry) error {
+	return m.WriteEntry(ent)
+}
+
+func (m *testMuxer) WriteBatch(ents []*entry.Entry) error {
+	for _, ent := range ents {
+		m.WriteEntry(ent)
+	}
+	return nil
+}
+
+func (m *testMuxer) WriteBatchContext(ctx context.Context, ents []*entry.Entry) error {
+	return m.WriteBatch(ents)
+}
+
+func (m *testMuxer) expect(t *testing.T, tag string) {
+	t.Helper()
+	select {
+	case ent := <-m.ents:
+		if name, _ := m.LookupTag(ent.Tag); name != tag {
+			t.Fatalf("got entry tagged %q, expected %q", name, tag)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timed out waiting for a %q entry", tag)
+	}
+}
+
+func freePort(t *testing.T) int {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port
+}
+
+func liveConfig(t *testing.T, tcpPort, udpPort int, tag string) *cfgType {
+	return loadReloadConfig(t, fmt.Sprintf(reloadLiveConfig, tcpPort, tag, udpPort, tag))
+}
+
+func startReloadTest(t *testing.T, cfg *cfgType) (*relayReloader, *testMuxer) {
+	lg = log.NewDiscardLogger()
+	mtx.Lock()
+	connClosers = map[int]closer{}
+	liveListeners = map[string]*liveListener{}
+	mtx.Unlock()
+	m := &testMuxer{ents: make(chan *entry.Entry, 16)}
+	rr := &relayReloader{
+		cfg:  cfg,
+		igst: m,
+		wg:   &sync.WaitGroup{},
+		f:    &flusher{},
+		ctx:  context.Background(),
+	}
+	if err := startSimpleListeners(cfg, m, rr.wg, rr.f, rr.ctx); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		mtx.Lock()
+		for _, c := range connClosers {
+			c.Close()
+		}
+		mtx.Unlock()
+		rr.wg.Wait()
+	})
+	return rr, m
+}
+
+func sendLine(t *testing.T, network string, port int) {
+	t.Helper()
+	c, err := net.Dial(network, fmt.Sprintf("127.0.0.1:%d", port))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if _, err = c.Write([]byte("hello\n")); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func connIDs() map[string]int {
+	mtx.Lock()
+	defer mtx.Unlock()
+	r := map[string]int{}
+	for k, v := range liveListeners {
+		r[k] = v.connID
+	}
+	return r
+}
+
+func TestReloadSwapsSettings(t *testing.T) {
+	tcpPort, udpPort := freePort(t), freePort(t)
+	rr, m := startReloadTest(t, liveConfig(t, tcpPort, udpPort, `foo`))
+	sendLine(t, "udp", udpPort)
+	m.expect(t, `foo`)
+	before := connIDs()
+
+	//a tag change must not touch the sockets
+	if err := rr.Reload(liveConfig(t, tcpPort, udpPort, `bar`)); err != nil {
+		t.Fatal(err)
+	}
+	if after := connIDs(); fmt.Sprint(after) != fmt.Sprint(before) {
+		t.Fatalf("sockets were replaced: %v -> %v", before, after)
+	}
+	sendLine(t, "udp", udpPort)
+	m.expect(t, `bar`)
+	sendLine(t, "tcp", tcpPort)
+	m.expect(t, `bar`)
+}
+
+func TestReloadBindFailure(t *testing.T) {
+	tcpPort, udpPort := freePort(t), freePort(t)
+	orig := liveConfig(t, tcpPort, udpPort, `foo`)
+	rr, m := startReloadTest(t, orig)
+	before := connIDs()
+
+	//occupy the port the new config wants
+	busy, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer busy.Close()
+	busyPort := busy.Addr().(*net.TCPAddr).Port
+	if err = rr.Reload(liveConfig(t, busyPort, udpPort, `bar`)); err == nil {
+		t.Fatal("reload onto a busy port succeeded")
+	}
+	if rr.cfg != orig {
+		t.Fatal("failed reload replaced the running configuration")
+	} else if after := connIDs(); fmt.Sprint(after) != fmt.Sprint(before) {
+		t.Fatalf("failed reload replaced sockets: %v -> %v", before, after)
+	}
+	//the old listeners are still up and still running the old settings
+	sendLine(t, "tcp", tcpPort)
+	m.expect(t, `foo`)
+	sendLine(t, "udp", udpPort)
+	m.expect(t, `foo`)
+	if n := len(rr.f.set); n != 2 {
+		t.Fatalf("flusher holds %d preprocessor sets after a failed reload, expected 2", n)
+	}
+}
+
+func TestReloadRebind(t *testing.T) {
+	tcpPort, udpPort := freePort(t), freePort(t)
+	rr, m := startReloadTest(t, liveConfig(t, tcpPort, udpPort, `foo`))
+	ll, _ := getListener(simpleListenerKind, `tcp`)
+
+	newPort := freePort(t)
+	if err := rr.Reload(liveConfig(t, newPort, udpPort, `foo`)); err != nil {
+		t.Fatal(err)
+	}
+	if nll, ok := getListener(simpleListenerKind, `tcp`); !ok || nll != ll {
+		t.Fatal("rebound listener lost its preprocessors")
+	}
+	sendLine(t, "tcp", newPort)
+	m.expect(t, `foo`)
+	if c, err := net.Dial("tcp", fmt.Sprintf("127.0.0.1:%d", tcpPort)); err == nil {
+		c.Close()
+		t.Fatal("old socket is still open")
+	}
+	if n := len(rr.f.set); n != 2 {
+		t.Fatalf("flusher holds %d preprocessor sets, expected 2", n)
+	}
+}
+
+func TestReloadRemove(t *testing.T) {
+	tcpPort, udpPort := freePort(t), freePort(t)
+	rr, _ := startReloadTest(t, liveConfig(t, tcpPort, udpPort, `foo`))
+	ll, _ := getListener(simpleListenerKind, `udp`)
+
+	ncfg := liveConfig(t, tcpPort, udpPort, `foo`)
+	delete(ncfg.Listener, `udp`)
+	if err := rr.Reload(ncfg); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := getListener(simpleListenerKind, `udp`); ok {
+		t.Fatal("removed listener is still tracked")
+	}
+	//the removed set is dropped from the flusher once its acceptor exits
+	for i := 0; ; i++ {
+		rr.f.Lock()
+		n := len(rr.f.set)
+		found := false
+		for _, v := range rr.f.set {
+			found = found || v == ll.proc
+		}
+		rr.f.Unlock()
+		if n == 1 && !found {
+			break
+		} else if i > 100 {
+			t.Fatalf("removed preprocessor set was not released, flusher holds %d", n)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestReloadSamePort(t *testing.T) {
+	tcpPort, udpPort := freePort(t), freePort(t)
+	rr, m := startReloadTest(t, liveConfig(t, tcpPort, udpPort, `foo`))
+	before := connIDs()
+
+	//a new bind string on the same port can only be bound once the old socket is closed
+	ncfg := liveConfig(t, tcpPort, udpPort, `foo`)
+	ncfg.Listener[`tcp`].Bind_String = fmt.Sprintf("tcp://0.0.0.0:%d", tcpPort)
+	if err := rr.Reload(ncfg); err != nil {
+		t.Fatal(err)
+	}
+	after := connIDs()
+	if k := listenerKey(simpleListenerKind, `tcp`); after[k] == before[k] {
+		t.Fatal("listener was not rebound")
+	}
+	sendLine(t, "tcp", tcpPort)
+	m.expect(t, `foo`)
+}
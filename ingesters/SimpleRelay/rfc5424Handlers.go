@@ -24,7 +24,6 @@ import (
 )
 
 func rfc5424ConnHandlerTCP(c net.Conn, cfg handlerConfig) {
-	cfg.wg.Add(1)
 	id := addConn(c)
 	defer cfg.wg.Done()
 	defer delConn(id)
@@ -133,61 +132,6 @@ func dropPriority(buff []byte) []byte {
 	return buff
 }
 
-func rfc5424ConnHandlerUDP(c *net.UDPConn, cfg handlerConfig) {
-	buff := make([]byte, 16*1024) //local buffer that should be big enough for even the largest UDP packets
-	tcfg := timegrinder.Config{
-		EnableLeftMostSeed: true,
-	}
-	tg, err := timegrinder.NewTimeGrinder(tcfg)
-	if err != nil {
-		lg.Error("Failed to get a handle on the timegrinder", log.KVErr(err))
-		return
-	} else if err = cfg.timeFormats.LoadFormats(tg); err != nil {
-		lg.Error("Failed to load custom time formats", log.KVErr(err))
-		return
-	}
-
-	if cfg.setLocalTime {
-		tg.SetLocalTime()
-	}
-	if cfg.timezoneOverride != `` {
-		err = tg.SetTimezone(cfg.timezoneOverride)
-		if err != nil {
-			lg.Error("Failed to load timezeone override", log.KV("override", cfg.timezoneOverride), log.KVErr(err))
-			return
-		}
-	}
-	if cfg.formatOverride != `` {
-		if err = tg.SetFormatOverride(cfg.formatOverride); err != nil {
-			lg.Error("Failed to load format override", log.KV("override", cfg.formatOverride), log.KVErr(err))
-			return
-		}
-	}
-
-	var rip net.IP
-	for {
-		n, raddr, err := c.ReadFromUDP(buff)
-		if err != nil {
-			break
-		}
-		if n > 0 {
-			if raddr == nil {
-				continue
-			}
-			if n > len(buff) {
-				continue
-			}
-			if cfg.src == nil {
-				rip = raddr.IP
-			} else {
-				rip = cfg.src
-			}
-			handleRFC5424Packet(append([]byte(nil), buff[:n]...), rip, cfg.ignoreTimestamps, cfg.dropPriority, cfg.tag, tg, cfg.proc, cfg.ctx)
-		}
-	}
-
-}
-
 // we can be very very fast on this one by just manually scanning the buffer
 func handleRFC5424Packet(buff []byte, ip net.IP, ignoreTS, dropPrio bool, tag entry.EntryTag, tg *timegrinder.TimeGrinder, proc *processors.ProcessorSet, ctx context.Context) {
 	var idx []int
@@ -58,7 +58,6 @@ func findGoodRFC6587Header(b []byte) (number, start, end int) {
 }
 
 func rfc6587ConnHandlerTCP(c net.Conn, cfg handlerConfig) {
-	cfg.wg.Add(1)
 	id := addConn(c)
 	defer cfg.wg.Done()
 	defer delConn(id)
@@ -10,14 +10,12 @@ package main
 
 import (
 	"context"
-	"crypto/tls"
 	"fmt"
 	"net"
 	"strings"
 	"sync"
 	"time"
 
-	"github.com/gravwell/gravwell/v3/ingest"
 	"github.com/gravwell/gravwell/v3/ingest/config"
 	"github.com/gravwell/gravwell/v3/ingest/entry"
 	"github.com/gravwell/gravwell/v3/ingest/log"
@@ -44,123 +42,111 @@ type handlerConfig struct {
 	dropPriority     bool
 	timezoneOverride string
 	src              net.IP
-	wg               *sync.WaitGroup
+	wg               waiter
 	formatOverride   string
 	proc             *processors.ProcessorSet
 	ctx              context.Context
 	timeFormats      config.CustomTimeFormat
 }
 
-func startSimpleListeners(cfg *cfgType, igst *ingest.IngestMuxer, wg *sync.WaitGroup, f *flusher, ctx context.Context) error {
-	//short circuit out on empty
-	if len(cfg.Listener) == 0 {
-		return nil
-	}
-
+func startSimpleListeners(cfg *cfgType, igst relayMuxer, wg *sync.WaitGroup, f *flusher, ctx context.Context) error {
 	//fire up our simple backends
 	for k, v := range cfg.Listener {
-		var src net.IP
-		if v.Source_Override != `` {
-			src = net.ParseIP(v.Source_Override)
-			if src == nil {
-				return fmt.Errorf("Listener %v invalid source override \"%s\"", k, v.Source_Override)
-			}
-		} else if cfg.Source_Override != `` {
-			// global override
-			src = net.ParseIP(cfg.Source_Override)
-			if src == nil {
-				return fmt.Errorf("global source override \"%s\" is invalid", cfg.Source_Override)
-			}
-		}
-		//get the tag for this listener
-		tag, err := igst.GetTag(v.Tag_Name)
-		if err != nil {
-			lg.Fatal("failed to resolve tag", log.KV("tag", v.Tag_Name), log.KVErr(err))
-		}
-		tp, str, err := translateBindType(v.Bind_String)
-		if err != nil {
-			lg.FatalCode(0, "invalid bind", log.KV("bindstring", v.Bind_String), log.KVErr(err))
+		if err := startListener(cfg, simpleListenerKind, k, v.Preprocessor, igst, wg, f, ctx); err != nil {
+			return err
 		}
-		lrt, err := translateReaderType(v.Reader_Type)
-		if err != nil {
-			lg.FatalCode(0, "invalid reader type", log.KV("readertype", v.Reader_Type), log.KVErr(err))
-		}
-		hcfg := handlerConfig{
-			name:             k,
-			tag:              tag,
-			lrt:              lrt,
-			ignoreTimestamps: v.Ignore_Timestamps,
-			setLocalTime:     v.Assume_Local_Timezone,
-			dropPriority:     v.Drop_Priority,
-			timezoneOverride: v.Timezone_Override,
-			src:              src,
-			wg:               wg,
-			formatOverride:   v.Timestamp_Format_Override,
-			ctx:              ctx,
-			timeFormats:      cfg.TimeFormat,
+	}
+	debugout("Started %d listeners\n", len(cfg.Listener))
+	return nil
+}
+
+// prepSimpleListener validates a simple listener and builds its handler configuration
+func prepSimpleListener(cfg *cfgType, ll *liveListener, igst relayMuxer, ctx context.Context) (pl *pendingListener, err error) {
+	k := ll.name
+	v, ok := cfg.Listener[k]
+	if !ok {
+		return nil, fmt.Errorf("Listener %v is not defined", k)
+	}
+	var src net.IP
+	if v.Source_Override != `` {
+		src = net.ParseIP(v.Source_Override)
+		if src == nil {
+			return nil, fmt.Errorf("Listener %v invalid source override \"%s\"", k, v.Source_Override)
 		}
-		if hcfg.proc, err = cfg.Preprocessor.ProcessorSet(igst, v.Preprocessor); err != nil {
-			lg.Fatal("preprocessor error", log.KVErr(err))
+	} else if cfg.Source_Override != `` {
+		// global override
+		src = net.ParseIP(cfg.Source_Override)
+		if src == nil {
+			return nil, fmt.Errorf("global source override \"%s\" is invalid", cfg.Source_Override)
 		}
-		f.Add(hcfg.proc)
-		if tp.TCP() {
-			//get the socket
-			addr, err := net.ResolveTCPAddr(tp.String(), str)
-			if err != nil {
-				return fmt.Errorf("%s Bind-String \"%s\" is invalid: %v\n", k, v.Bind_String, err)
-			}
-			l, err := net.ListenTCP(tp.String(), addr)
-			if err != nil {
-				return fmt.Errorf("%s Failed to listen on \"%s\": %v\n", k, addr, err)
-			}
-			connID := addConn(l)
-			//start the acceptor
-			wg.Add(1)
-			go acceptor(l, connID, igst, hcfg, tp)
-		} else if tp.TLS() {
-			config := &tls.Config{
-				MinVersion: tls.VersionTLS12,
-			}
+	}
+	//get the tag for this listener
+	tag, err := igst.GetTag(v.Tag_Name)
+	if err != nil {
+		return nil, fmt.Errorf("%s failed to resolve tag %v: %w", k, v.Tag_Name, err)
+	}
+	lrt, err := translateReaderType(v.Reader_Type)
+	if err != nil {
+		return nil, fmt.Errorf("%s invalid reader type %v: %w", k, v.Reader_Type, err)
+	}
+	hcfg := &handlerConfig{
+		name:             k,
+		tag:              tag,
+		lrt:              lrt,
+		ignoreTimestamps: v.Ignore_Timestamps,
+		setLocalTime:     v.Assume_Local_Timezone,
+		dropPriority:     v.Drop_Priority,
+		timezoneOverride: v.Timezone_Override,
+		src:              src,
+		wg:               ll.wg,
+		formatOverride:   v.Timestamp_Format_Override,
+		proc:             ll.proc,
+		ctx:              ctx,
+		timeFormats:      cfg.TimeFormat,
+	}
+	if _, err = newTimegrinder(hcfg.ignoreTimestamps, hcfg.setLocalTime, hcfg.timezoneOverride, hcfg.formatOverride, hcfg.timeFormats); err != nil {
+		return nil, fmt.Errorf("%s %w", k, err)
+	}
+	if pl, err = newPendingListener(simpleListenerKind, k, v.baseConfig); err != nil {
+		return nil, err
+	}
+	pl.hcfg = hcfg
+	return
+}
 
-			config.Certificates = make([]tls.Certificate, 1)
-			config.Certificates[0], err = tls.LoadX509KeyPair(v.Cert_File, v.Key_File)
-			if err != nil {
-				lg.FatalCode(0, "failed to load certificate", log.KV("certfile", v.Cert_File), log.KV("keyfile", v.Key_File), log.KVErr(err))
-			}
-			//get the socket
-			addr, err := net.ResolveTCPAddr("tcp", str)
-			if err != nil {
-				lg.FatalCode(0, "invalid Bind-String", log.KV("bindstring", v.Bind_String), log.KV("listener", k), log.KVErr(err))
-			}
-			l, err := tls.Listen("tcp", addr.String(), config)
-			if err != nil {
-				lg.FatalCode(0, "failed to listen via TLS", log.KV("address", addr), log.KV("listener", k), log.KVErr(err))
-			}
-			connID := addConn(l)
-			//start the acceptor
-			wg.Add(1)
-			go acceptor(l, connID, igst, hcfg, tp)
-		} else if tp.UDP() {
-			addr, err := net.ResolveUDPAddr(tp.String(), str)
-			if err != nil {
-				lg.FatalCode(0, "invalid Bind-String", log.KV("bindstring", v.Bind_String), log.KV("listener", k), log.KVErr(err))
-			}
-			l, err := net.ListenUDP(tp.String(), addr)
-			if err != nil {
-				lg.FatalCode(0, "failed to listen via udp", log.KV("address", addr), log.KV("listener", k), log.KVErr(err))
-			}
-			connID := addConn(l)
-			wg.Add(1)
-			go acceptorUDP(l, connID, hcfg, igst)
+// newTimegrinder builds a timegrinder with the timestamp settings shared by every listener type,
+// tg is nil if timestamps are ignored.
+func newTimegrinder(ignore, setLocal bool, tz, override string, tf config.CustomTimeFormat) (tg *timegrinder.TimeGrinder, err error) {
+	if ignore {
+		return
+	}
+	tcfg := timegrinder.Config{
+		EnableLeftMostSeed: true,
+	}
+	if tg, err = timegrinder.NewTimeGrinder(tcfg); err != nil {
+		return nil, fmt.Errorf("failed to get a handle on the timegrinder: %w", err)
+	} else if err = tf.LoadFormats(tg); err != nil {
+		return nil, fmt.Errorf("failed to load custom time formats: %w", err)
+	}
+	if setLocal {
+		tg.SetLocalTime()
+	}
+	if tz != `` {
+		if err = tg.SetTimezone(tz); err != nil {
+			return nil, fmt.Errorf("failed to set timezone to %v: %w", tz, err)
 		}
 	}
-	debugout("Started %d listeners\n", len(cfg.Listener))
-	return nil
+	if override != `` {
+		if err = tg.SetFormatOverride(override); err != nil {
+			return nil, fmt.Errorf("failed to load format override %v: %w", override, err)
+		}
+	}
+	return
 }
 
-func acceptor(lst net.Listener, id int, igst *ingest.IngestMuxer, cfg handlerConfig, tp bindType) {
+func acceptor(lst net.Listener, id int, ll *liveListener, tp bindType) {
 	var failCount int
-	defer cfg.wg.Done()
+	defer ll.wg.Done()
 	defer delConn(id)
 	defer lst.Close()
 	for {
@@ -177,36 +163,69 @@ func acceptor(lst net.Listener, id int, igst *ingest.IngestMuxer, cfg handlerCon
 			}
 			continue
 		}
+		//new connections get whatever configuration is current
+		cfg := *ll.handlerConfig()
 		debugout("Accepted %v connection from %s in %v mode\n", conn.RemoteAddr(), cfg.lrt, tp.String())
 		lg.Info("accepted connection", log.KV("address", conn.RemoteAddr()), log.KV("readertype", cfg.lrt), log.KV("mode", tp), log.KV("listener", cfg.name))
 		failCount = 0
 		switch cfg.lrt {
 		case lineReader:
+			cfg.wg.Add(1)
 			go lineConnHandlerTCP(conn, cfg)
 		case rfc5424Reader:
+			cfg.wg.Add(1)
 			go rfc5424ConnHandlerTCP(conn, cfg)
 		case rfc6587Reader:
+			cfg.wg.Add(1)
 			go rfc6587ConnHandlerTCP(conn, cfg)
 		default:
+			conn.Close()
 			lg.Error("invalid reader type", log.KV("readertype", cfg.lrt))
 			return
 		}
 	}
 }
 
-func acceptorUDP(conn *net.UDPConn, id int, cfg handlerConfig, igst *ingest.IngestMuxer) {
-	defer cfg.wg.Done()
+func acceptorUDP(conn *net.UDPConn, id int, ll *liveListener) {
+	defer ll.wg.Done()
 	defer delConn(id)
 	defer conn.Close()
+	buff := make([]byte, 16*1024) //local buffer that should be big enough for even the largest UDP packets
+	var cfg *handlerConfig
+	var tg *timegrinder.TimeGrinder
 	//read packets off
-	switch cfg.lrt {
-	case lineReader:
-		lineConnHandlerUDP(conn, cfg)
-	case rfc5424Reader:
-		rfc5424ConnHandlerUDP(conn, cfg)
-	default:
-		lg.Error("invalid reader type", log.KV("readertype", cfg.lrt))
-		return
+	for {
+		n, raddr, err := conn.ReadFromUDP(buff)
+		if err != nil {
+			break
+		}
+		if n == 0 || raddr == nil || n > len(buff) {
+			continue
+		}
+		//pick up configuration reloads between packets
+		if nc := ll.handlerConfig(); nc != cfg {
+			if tg, err = newTimegrinder(nc.ignoreTimestamps, nc.setLocalTime, nc.timezoneOverride, nc.formatOverride, nc.timeFormats); err != nil {
+				lg.Error("failed to build timegrinder", log.KV("listener", nc.name), log.KVErr(err))
+				return
+			}
+			cfg = nc
+		}
+		rip := cfg.src
+		if rip == nil {
+			rip = raddr.IP
+		}
+		switch cfg.lrt {
+		case lineReader:
+			err = handleLinePacket(buff[:n], rip, cfg, tg)
+		case rfc5424Reader:
+			handleRFC5424Packet(append([]byte(nil), buff[:n]...), rip, cfg.ignoreTimestamps, cfg.dropPriority, cfg.tag, tg, cfg.proc, cfg.ctx)
+		default:
+			lg.Error("invalid reader type", log.KV("readertype", cfg.lrt))
+			return
+		}
+		if err != nil {
+			return
+		}
 	}
 }
 
@@ -60,9 +60,12 @@ type IngesterBase struct {
 	IngesterBaseConfig
 	Verbose bool
 	Logger  *log.Logger
-	Cfg     interface{}
+	Cfg     interface{} // the configuration loaded at startup, see Config once reloading is enabled
 	id      uuid.UUID
 	sm      *utils.StatsManager
+	confLoc string
+	confDir string
+	rl      *reloader
 }
 
 func Init(ibc IngesterBaseConfig) (ib IngesterBase, err error) {
@@ -100,6 +103,7 @@ func Init(ibc IngesterBaseConfig) (ib IngesterBase, err error) {
 	}
 	ib.Logger.SetAppname(ibc.AppName)
 	ib.Verbose = *verbose
+	ib.confLoc, ib.confDir = *confLoc, *confdLoc
 	debug.SetTraceback("all")
 
 	//now try to call getConfig and extract the base ingester configuration
@@ -280,31 +284,31 @@ func (ib *IngesterBase) validateUUID(cfg config.IngestConfig, loc string) (err e
 	}
 
 	//attempt to find and populate the Cfg item
-	if err = ib.writebackUUID(id); err != nil {
+	if err = writebackUUID(ib.Cfg, id); err != nil {
 		err = fmt.Errorf("failed to populate UUID in %T %w", ib.Cfg, err)
 	}
 
 	return
 }
 
-func (ib *IngesterBase) writebackUUID(id uuid.UUID) (err error) {
+func writebackUUID(obj interface{}, id uuid.UUID) (err error) {
 	//first check that we have good pointers
-	if ib == nil || ib.Cfg == nil {
+	if obj == nil {
 		err = errors.New("ingester base pointers are bad")
 		return
 	}
 
 	//now make sure the Cfg we were handed is actually something we can write to
-	v := reflect.ValueOf(ib.Cfg)
+	v := reflect.ValueOf(obj)
 	if v.Type().Kind() != reflect.Ptr {
-		err = fmt.Errorf("Config value %T is not a pointer", ib.Cfg)
+		err = fmt.Errorf("Config value %T is not a pointer", obj)
 		return
 	}
 
 	//ok, make sure whatever it is pointing to is a struct
 	rv := v.Elem()
 	if rv.Type().Kind() != reflect.Struct {
-		err = fmt.Errorf("type %T does not point to a struct (%T)", ib.Cfg, rv.Interface())
+		err = fmt.Errorf("type %T does not point to a struct (%T)", obj, rv.Interface())
 		return
 	}
 
@@ -331,7 +335,7 @@ func (ib *IngesterBase) writebackUUID(id uuid.UUID) (err error) {
 		sv = ssv
 	}
 	if sv.CanSet() == false {
-		err = fmt.Errorf("Cannot set Ingester_UUID field in type %T", ib.Cfg)
+		err = fmt.Errorf("Cannot set Ingester_UUID field in type %T", obj)
 		return
 	} else if sv.Kind() != reflect.String {
 		err = fmt.Errorf("Cannot set Ingester_UUID, type %T is not a string", sv.Interface())
@@ -0,0 +1,298 @@
+/*************************************************************************
+ * Copyright 2024 Gravwell, Inc. All rights reserved.
+ * Contact: <legal@gravwell.io>
+ *
+ * This software may be modified and distributed under the terms of the
+ * BSD 2-clause license. See the LICENSE file for details.
+ **************************************************************************/
+
+package base
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/google/uuid"
+	"github.com/gravwell/gravwell/v3/ingest"
+	"github.com/gravwell/gravwell/v3/ingest/config"
+	"github.com/gravwell/gravwell/v3/ingest/entry"
+	"github.com/gravwell/gravwell/v3/ingest/log"
+)
+
+const (
+	// reloadSettleTime is how long we wait after the last config file change before
+	// reloading, editors and config management tools tend to write files in pieces.
+	reloadSettleTime = time.Second
+	overlayExt       = `.conf`
+)
+
+var (
+	ErrReloadActive         = errors.New("configuration reload is already enabled")
+	ErrReloadNotActive      = errors.New("configuration reload is not enabled")
+	ErrGlobalRequiresReboot = errors.New("changes to the Global backend settings require a restart")
+)
+
+// Reloader is implemented by ingesters that can apply a new configuration without restarting.
+//
+// Reload is handed the freshly loaded and verified configuration object, the same type
+// produced by IngesterBaseConfig.GetConfigFunc.  Any tags the new configuration declares
+// have already been negotiated on the muxer when Reload is called.  Implementations should
+// build everything they need (ProcessorSets, handlers, listeners) before swapping anything
+// in so that a failed reload leaves the running configuration untouched.  Returning an error
+// rejects the new configuration.
+type Reloader interface {
+	Reload(cfg interface{}) error
+}
+
+// reloadMuxer is the part of the ingest muxer used when applying a reload
+type reloadMuxer interface {
+	NegotiateTag(string) (entry.EntryTag, error)
+	SetRawConfiguration(interface{}) error
+}
+
+type reloader struct {
+	sync.Mutex
+	igst  reloadMuxer
+	r     Reloader
+	cur   atomic.Value // the running configuration
+	hup   chan os.Signal
+	wtchr *fsnotify.Watcher
+	done  chan struct{}
+	wg    sync.WaitGroup
+}
+
+// EnableReload starts watching for SIGHUP and changes to the configuration file and overlay
+// directory. When either fires the configuration is reloaded, verified, new tags are negotiated
+// on igst and the new configuration is handed to r.
+//
+// Ingesters that enable reloading must not treat SIGHUP as a quit signal, use
+// utils.WaitForQuitNoHangup instead of utils.WaitForQuit.
+func (ib *IngesterBase) EnableReload(igst *ingest.IngestMuxer, r Reloader) (err error) {
+	if ib == nil || ib.Cfg == nil || ib.Logger == nil {
+		return ErrNotReady
+	} else if igst == nil || r == nil {
+		return ErrInvalidParameter
+	}
+	return ib.enableReload(igst, r)
+}
+
+func (ib *IngesterBase) enableReload(igst reloadMuxer, r Reloader) (err error) {
+	if ib.rl != nil {
+		return ErrReloadActive
+	}
+	rl := &reloader{
+		igst: igst,
+		r:    r,
+		hup:  make(chan os.Signal, 1),
+		done: make(chan struct{}),
+	}
+	rl.cur.Store(ib.Cfg)
+	if rl.wtchr, err = fsnotify.NewWatcher(); err != nil {
+		return
+	}
+	if ib.confLoc != `` {
+		//watch the directory, not the file, so that we see files being replaced
+		if err = rl.wtchr.Add(filepath.Dir(ib.confLoc)); err != nil {
+			rl.wtchr.Close()
+			return
+		}
+	}
+	if ib.confDir != `` {
+		if fi, lerr := os.Stat(ib.confDir); lerr == nil && fi.IsDir() {
+			if err = rl.wtchr.Add(ib.confDir); err != nil {
+				rl.wtchr.Close()
+				return
+			}
+		}
+	}
+	signal.Notify(rl.hup, syscall.SIGHUP)
+	ib.rl = rl
+	rl.wg.Add(1)
+	go ib.reloadRoutine(rl)
+	return
+}
+
+// DisableReload stops watching for SIGHUP and configuration file changes
+func (ib *IngesterBase) DisableReload() (err error) {
+	if ib == nil || ib.rl == nil {
+		return ErrReloadNotActive
+	}
+	rl := ib.rl
+	signal.Stop(rl.hup)
+	close(rl.done)
+	err = rl.wtchr.Close()
+	rl.wg.Wait()
+	//the reload routine is gone, hand the running configuration back to Cfg
+	ib.Cfg = rl.cur.Load()
+	ib.rl = nil
+	return
+}
+
+// Config returns the running configuration.  While reloading is enabled Cfg keeps the
+// configuration the ingester started with, anything that needs to see reloaded values from
+// a different goroutine must use Config.
+func (ib *IngesterBase) Config() interface{} {
+	if ib.rl != nil {
+		return ib.rl.cur.Load()
+	}
+	return ib.Cfg
+}
+
+// Reload immediately reloads the configuration, EnableReload must have been called.
+func (ib *IngesterBase) Reload() error {
+	if ib == nil || ib.rl == nil {
+		return ErrReloadNotActive
+	}
+	return ib.reload(ib.rl)
+}
+
+func (ib *IngesterBase) reloadRoutine(rl *reloader) {
+	defer rl.wg.Done()
+	tmr := time.NewTimer(reloadSettleTime)
+	tmr.Stop()
+	defer tmr.Stop()
+	for {
+		select {
+		case <-rl.done:
+			return
+		case <-rl.hup:
+			ib.Logger.Info("received SIGHUP, reloading configuration")
+			ib.doReload(rl)
+		case evt, ok := <-rl.wtchr.Events:
+			if !ok {
+				return
+			}
+			if ib.isConfigFile(evt.Name) {
+				tmr.Reset(reloadSettleTime)
+			}
+		case err, ok := <-rl.wtchr.Errors:
+			if !ok {
+				return
+			}
+			ib.Logger.Warn("configuration file watcher error", log.KVErr(err))
+		case <-tmr.C:
+			ib.Logger.Info("configuration changed on disk, reloading configuration")
+			ib.doReload(rl)
+		}
+	}
+}
+
+func (ib *IngesterBase) doReload(rl *reloader) {
+	if err := ib.reload(rl); err != nil {
+		ib.Logger.Error("configuration reload failed, continuing with existing configuration", log.KVErr(err))
+		return
+	}
+	ib.Logger.Info("configuration reloaded")
+}
+
+func (ib *IngesterBase) isConfigFile(pth string) bool {
+	pth = filepath.Clean(pth)
+	if ib.confLoc != `` && pth == filepath.Clean(ib.confLoc) {
+		return true
+	}
+	return ib.confDir != `` && filepath.Dir(pth) == filepath.Clean(ib.confDir) && filepath.Ext(pth) == overlayExt
+}
+
+func (ib *IngesterBase) reload(rl *reloader) (err error) {
+	rl.Lock()
+	defer rl.Unlock()
+
+	var obj interface{}
+	var ch cfgHelper
+	if obj, ch, err = ib.getConfig(ib.confLoc, ib.confDir); err != nil {
+		return
+	} else if err = verifyConfig(obj); err != nil {
+		return
+	}
+	cur := rl.cur.Load()
+	och, ok := cur.(cfgHelper)
+	if !ok {
+		return fmt.Errorf("Config type %T does not implement the helper interface", cur)
+	}
+	cfg := ch.IngestBaseConfig()
+	if err = checkGlobalReload(och.IngestBaseConfig(), cfg); err != nil {
+		return
+	}
+	//configs that lost their UUID keep the one we are running with
+	if _, ok := cfg.IngesterUUID(); !ok && ib.id != uuid.Nil {
+		if err = writebackUUID(obj, ib.id); err != nil {
+			return
+		}
+	}
+
+	var tags []string
+	if tags, err = ch.Tags(); err != nil {
+		err = fmt.Errorf("Failed to get tags %w", err)
+		return
+	}
+	for _, tag := range tags {
+		if _, err = rl.igst.NegotiateTag(tag); err != nil {
+			err = fmt.Errorf("Failed to negotiate tag %q %w", tag, err)
+			return
+		}
+	}
+
+	if err = rl.r.Reload(obj); err != nil {
+		return
+	}
+	rl.cur.Store(obj)
+	if err = rl.igst.SetRawConfiguration(obj); err != nil {
+		ib.Logger.Warn("failed to set configuration for ingester state messages", log.KVErr(err))
+		err = nil
+	}
+	return
+}
+
+// muxerSettings is the set of global values consumed when the muxer is built,
+// changing any of them requires a restart
+type muxerSettings struct {
+	Targets     []string
+	Secret      string
+	Stream      config.IngestStreamConfig
+	SkipVerify  bool
+	RateLimit   string
+	Label       string
+	CacheDepth  int
+	CacheMode   string
+	CachePath   string
+	CacheSize   int
+	LogOverride string
+}
+
+func getMuxerSettings(cfg config.IngestConfig) (ms muxerSettings, err error) {
+	if ms.Targets, err = cfg.Targets(); err != nil {
+		return
+	}
+	ms.Secret = cfg.Secret()
+	ms.Stream = cfg.IngestStreamConfig
+	ms.SkipVerify = cfg.InsecureSkipTLSVerification()
+	ms.RateLimit = cfg.Rate_Limit
+	ms.Label = cfg.Label
+	ms.CacheDepth = cfg.Cache_Depth
+	ms.CacheMode = cfg.Cache_Mode
+	ms.CachePath = cfg.Ingest_Cache_Path
+	ms.CacheSize = cfg.Max_Ingest_Cache
+	ms.LogOverride = cfg.Log_Source_Override
+	return
+}
+
+func checkGlobalReload(orig, ncfg config.IngestConfig) (err error) {
+	var a, b muxerSettings
+	if a, err = getMuxerSettings(orig); err != nil {
+		return
+	} else if b, err = getMuxerSettings(ncfg); err != nil {
+		return
+	} else if !reflect.DeepEqual(a, b) {
+		err = ErrGlobalRequiresReboot
+	}
+	return
+}
@@ -0,0 +1,250 @@
+/*************************************************************************
+ * Copyright 2024 Gravwell, Inc. All rights reserved.
+ * Contact: <legal@gravwell.io>
+ *
+ * This software may be modified and distributed under the terms of the
+ * BSD 2-clause license. See the LICENSE file for details.
+ **************************************************************************/
+
+package base
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/gravwell/gravwell/v3/ingest/attach"
+	"github.com/gravwell/gravwell/v3/ingest/config"
+	"github.com/gravwell/gravwell/v3/ingest/entry"
+	"github.com/gravwell/gravwell/v3/ingest/log"
+)
+
+const testReloadConfig = `
+[Global]
+Ingest-Secret = IngestSecrets
+Cleartext-Backend-Target = 127.0.0.1:4023
+Label = %s
+Log-Level = %s
+
+[Test]
+Tag = %s
+`
+
+type testCfg struct {
+	Global config.IngestConfig
+	Test   struct {
+		Tag string
+	}
+}
+
+func getTestConfig(p string) (*testCfg, error) {
+	var c testCfg
+	if err := config.LoadConfigFile(&c, p); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+func (c *testCfg) Verify() error                         { return c.Global.Verify() }
+func (c *testCfg) Tags() ([]string, error)               { return []string{c.Test.Tag}, nil }
+func (c *testCfg) IngestBaseConfig() config.IngestConfig { return c.Global }
+func (c *testCfg) AttachConfig() attach.AttachConfig     { return attach.AttachConfig{} }
+
+type testMuxer struct {
+	sync.Mutex
+	tags []string
+}
+
+func (m *testMuxer) NegotiateTag(name string) (entry.EntryTag, error) {
+	m.Lock()
+	m.tags = append(m.tags, name)
+	m.Unlock()
+	return entry.EntryTag(len(m.tags)), nil
+}
+
+func (m *testMuxer) SetRawConfiguration(interface{}) error { return nil }
+
+type testReloader struct {
+	fail error
+	cfgs chan *testCfg
+}
+
+func (tr *testReloader) Reload(obj interface{}) error {
+	if tr.fail != nil {
+		return tr.fail
+	}
+	tr.cfgs <- obj.(*testCfg)
+	return nil
+}
+
+func (tr *testReloader) wait(t *testing.T, tag string, timeout time.Duration) {
+	t.Helper()
+	select {
+	case c := <-tr.cfgs:
+		if c.Test.Tag != tag {
+			t.Fatalf("reloaded tag %q, expected %q", c.Test.Tag, tag)
+		}
+	case <-time.After(timeout):
+		t.Fatalf("timed out waiting for the %q reload", tag)
+	}
+}
+
+func writeTestConfig(t *testing.T, pth, label, level, tag string) {
+	t.Helper()
+	if err := os.WriteFile(pth, []byte(fmt.Sprintf(testReloadConfig, label, level, tag)), 0640); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// newTestBase builds an IngesterBase around a config file in a temporary directory,
+// watch enables the SIGHUP and file watcher routine
+func newTestBase(t *testing.T, watch bool) (*IngesterBase, *testReloader, string) {
+	dir := t.TempDir()
+	pth := filepath.Join(dir, `test.conf`)
+	writeTestConfig(t, pth, `a`, `INFO`, `foo`)
+	ib := &IngesterBase{
+		IngesterBaseConfig: IngesterBaseConfig{
+			IngesterName:  `test`,
+			AppName:       `test`,
+			GetConfigFunc: getTestConfig,
+		},
+		Logger:  log.NewDiscardLogger(),
+		confLoc: pth,
+		confDir: filepath.Join(dir, `test.conf.d`),
+	}
+	var err error
+	if ib.Cfg, _, err = ib.getConfig(ib.confLoc, ib.confDir); err != nil {
+		t.Fatal(err)
+	} else if err = verifyConfig(ib.Cfg); err != nil {
+		t.Fatal(err)
+	}
+	tr := &testReloader{cfgs: make(chan *testCfg, 4)}
+	if !watch {
+		ib.rl = &reloader{igst: &testMuxer{}, r: tr}
+		ib.rl.cur.Store(ib.Cfg)
+	} else if err = ib.enableReload(&testMuxer{}, tr); err != nil {
+		t.Fatal(err)
+	} else {
+		t.Cleanup(func() { ib.DisableReload() })
+	}
+	return ib, tr, pth
+}
+
+func TestCheckGlobalReload(t *testing.T) {
+	base := config.IngestConfig{
+		Ingest_Secret:            `secret`,
+		Cleartext_Backend_Target: []string{`127.0.0.1:4023`},
+		Log_Level:                `INFO`,
+	}
+	if err := checkGlobalReload(base, base); err != nil {
+		t.Fatalf("identical globals rejected: %v", err)
+	}
+	ok := base
+	ok.Log_Level = `ERROR`
+	ok.Log_File = `/tmp/test.log`
+	if err := checkGlobalReload(base, ok); err != nil {
+		t.Fatalf("non-muxer change rejected: %v", err)
+	}
+
+	changes := map[string]func(*config.IngestConfig){
+		`target`:    func(c *config.IngestConfig) { c.Cleartext_Backend_Target = []string{`127.0.0.2:4023`} },
+		`secret`:    func(c *config.IngestConfig) { c.Ingest_Secret = `other` },
+		`label`:     func(c *config.IngestConfig) { c.Label = `other` },
+		`cache`:     func(c *config.IngestConfig) { c.Cache_Mode = `always` },
+		`ratelimit`: func(c *config.IngestConfig) { c.Rate_Limit = `1mbit` },
+		`tls`:       func(c *config.IngestConfig) { c.Insecure_Skip_TLS_Verify = true },
+	}
+	for name, fn := range changes {
+		nc := base
+		fn(&nc)
+		if err := checkGlobalReload(base, nc); !errors.Is(err, ErrGlobalRequiresReboot) {
+			t.Errorf("%s change returned %v", name, err)
+		}
+	}
+}
+
+func TestIsConfigFile(t *testing.T) {
+	ib := &IngesterBase{
+		confLoc: `/opt/gravwell/etc/test.conf`,
+		confDir: `/opt/gravwell/etc/test.conf.d`,
+	}
+	tests := map[string]bool{
+		`/opt/gravwell/etc/test.conf`:                true,
+		`/opt/gravwell/etc/./test.conf`:              true,
+		`/opt/gravwell/etc/test.conf.d/a.conf`:       true,
+		`/opt/gravwell/etc/test.conf.d/a.conf.swp`:   false,
+		`/opt/gravwell/etc/test.conf.d/sub/a.conf`:   false,
+		`/opt/gravwell/etc/other.conf`:               false,
+		`/opt/gravwell/etc/test.conf~`:               false,
+		`/opt/gravwell/etc/test.conf.d`:              false,
+		`/opt/gravwell/etc/test.conf.d/.hidden.conf`: true,
+	}
+	for pth, want := range tests {
+		if got := ib.isConfigFile(pth); got != want {
+			t.Errorf("isConfigFile(%q) = %v, expected %v", pth, got, want)
+		}
+	}
+	ib.confDir = ``
+	if ib.isConfigFile(`/a.conf`) {
+		t.Error("matched an overlay with no overlay directory")
+	}
+}
+
+func TestReloadWatcher(t *testing.T) {
+	ib, tr, pth := newTestBase(t, true)
+	writeTestConfig(t, pth, `a`, `ERROR`, `bar`)
+	tr.wait(t, `bar`, 5*reloadSettleTime)
+	//the accessor must see the new config, Cfg keeps the startup config
+	if c := ib.Config().(*testCfg); c.Test.Tag != `bar` {
+		t.Fatalf("Config returned tag %q after reload", c.Test.Tag)
+	} else if c = ib.Cfg.(*testCfg); c.Test.Tag != `foo` {
+		t.Fatalf("Cfg was modified by the reload routine")
+	}
+}
+
+func TestReloadRejected(t *testing.T) {
+	ib, tr, pth := newTestBase(t, false)
+
+	//global muxer changes never reach the reloader
+	writeTestConfig(t, pth, `b`, `INFO`, `bar`)
+	if err := ib.Reload(); !errors.Is(err, ErrGlobalRequiresReboot) {
+		t.Fatalf("label change returned %v", err)
+	}
+
+	//a reloader error keeps the running config
+	tr.fail = errors.New("nope")
+	writeTestConfig(t, pth, `a`, `INFO`, `baz`)
+	if err := ib.Reload(); err != tr.fail {
+		t.Fatalf("reloader error was not returned: %v", err)
+	}
+	if c := ib.Config().(*testCfg); c.Test.Tag != `foo` {
+		t.Fatalf("rejected config was installed: %q", c.Test.Tag)
+	}
+}
+
+func TestReloadSIGHUP(t *testing.T) {
+	if runtime.GOOS == `windows` {
+		t.Skip("no SIGHUP on windows")
+	}
+	ib, tr, pth := newTestBase(t, true)
+	writeTestConfig(t, pth, `a`, `INFO`, `bar`)
+	p, err := os.FindProcess(os.Getpid())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = p.Signal(syscall.SIGHUP); err != nil {
+		t.Fatal(err)
+	}
+	//the watcher waits for the settle time, the signal does not
+	tr.wait(t, `bar`, reloadSettleTime/2)
+	ib.DisableReload()
+	if c := ib.Cfg.(*testCfg); c.Test.Tag != `bar` {
+		t.Fatalf("DisableReload did not publish the running config to Cfg, got %q", c.Test.Tag)
+	}
+}
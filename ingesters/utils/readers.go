@@ -196,17 +196,32 @@ func (je jsonEntry) src() (src net.IP) {
 	return
 }
 
+// canonicalProbe picks out the schema version, only canonical entries carry one
+type canonicalProbe struct {
+	Version *int `json:"v"`
+}
+
+// ReadEntry decodes the next entry, both the canonical entry schema and the
+// search download format are accepted
 func (j *JSONReader) ReadEntry() (ent *entry.Entry, err error) {
+	var raw json.RawMessage
+	var probe canonicalProbe
 	var jent jsonEntry
 	var tag entry.EntryTag
 	j.cnt++
-	if err = j.rdr.Decode(&jent); err != nil {
+	if err = j.rdr.Decode(&raw); err != nil {
 		if err == io.EOF {
 			return
 		}
 		err = fmt.Errorf("Failed to decode json on row %d: %v", j.cnt, err)
 		return
 	}
+	if err = json.Unmarshal(raw, &probe); err == nil && probe.Version != nil {
+		return j.readCanonical(raw)
+	} else if err = json.Unmarshal(raw, &jent); err != nil {
+		err = fmt.Errorf("Failed to decode json on row %d: %v", j.cnt, err)
+		return
+	}
 	if tag, err = j.GetTag(jent.Tag); err != nil {
 		err = fmt.Errorf("%v on row %d", err, j.cnt)
 		return
@@ -242,6 +257,26 @@ func (j *JSONReader) ReadEntry() (ent *entry.Entry, err error) {
 	return
 }
 
+// readCanonical decodes a canonical entry, tags are resolved by the tag name
+// because tag IDs are only meaningful to the ingester that wrote the entry
+func (j *JSONReader) readCanonical(raw json.RawMessage) (ent *entry.Entry, err error) {
+	var name string
+	ent = new(entry.Entry)
+	if name, err = ent.UnmarshalCanonicalJSONTag(raw); err != nil {
+		ent = nil
+		err = fmt.Errorf("Failed to decode canonical entry on row %d: %v", j.cnt, err)
+		return
+	} else if ent.Tag, err = j.GetTag(name); err != nil {
+		ent = nil
+		err = fmt.Errorf("%v on row %d", err, j.cnt)
+		return
+	}
+	if j.disableEVs {
+		ent.ClearEnumeratedValues()
+	}
+	return
+}
+
 type ReimportReader interface {
 	ReadEntry() (*entry.Entry, error)
 	OverrideTags(tg entry.EntryTag)
@@ -0,0 +1,104 @@
+/*************************************************************************
+ * Copyright 2024 Gravwell, Inc. All rights reserved.
+ * Contact: <legal@gravwell.io>
+ *
+ * This software may be modified and distributed under the terms of the
+ * BSD 2-clause license. See the LICENSE file for details.
+ **************************************************************************/
+
+package utils
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/gravwell/gravwell/v3/ingest/entry"
+)
+
+type testTagHandler struct {
+	tags     map[string]entry.EntryTag
+	override bool
+	tag      entry.EntryTag
+}
+
+func (th *testTagHandler) OverrideTags(tg entry.EntryTag) {
+	th.override, th.tag = true, tg
+}
+
+func (th *testTagHandler) GetTag(name string) (entry.EntryTag, error) {
+	if th.override {
+		return th.tag, nil
+	}
+	if tg, ok := th.tags[name]; ok {
+		return tg, nil
+	}
+	tg := entry.EntryTag(len(th.tags) + 1)
+	th.tags[name] = tg
+	return tg, nil
+}
+
+func TestJSONReaderFormats(t *testing.T) {
+	ts := time.Date(2024, 1, 2, 3, 4, 5, 6, time.UTC)
+	ent := &entry.Entry{
+		TS:   entry.FromStandard(ts),
+		SRC:  net.ParseIP(`10.0.0.1`),
+		Tag:  entry.EntryTag(99), //tag IDs from the writer are ignored
+		Data: []byte(`canonical`),
+	}
+	ent.AddEnumeratedValueEx(`port`, uint16(443))
+	b, err := ent.MarshalCanonicalJSONTag(`foo`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var bb bytes.Buffer
+	bb.Write(b)
+	bb.WriteString("\n")
+	bb.WriteString(`{"TS":"2024-01-02T03:04:05.000000006Z","SRC":"10.0.0.2","Tag":"bar","Data":"bGVnYWN5"}` + "\n")
+
+	th := &testTagHandler{tags: map[string]entry.EntryTag{}}
+	jr, err := NewJSONReader(&bb, th)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := jr.ReadEntry()
+	if err != nil {
+		t.Fatal(err)
+	} else if string(got.Data) != `canonical` || got.Tag != th.tags[`foo`] || !got.TS.StandardTime().Equal(ts) {
+		t.Fatalf("bad canonical entry %+v", got)
+	} else if v, ok := got.GetEnumeratedValue(`port`); !ok || v != uint16(443) {
+		t.Fatalf("canonical enumerated value lost its type: %T %v", v, v)
+	}
+	if got, err = jr.ReadEntry(); err != nil {
+		t.Fatal(err)
+	} else if string(got.Data) != `legacy` || got.Tag != th.tags[`bar`] || !got.SRC.Equal(net.ParseIP(`10.0.0.2`)) {
+		t.Fatalf("bad legacy entry %+v", got)
+	}
+	if _, err = jr.ReadEntry(); err != io.EOF {
+		t.Fatalf("expected EOF, got %v", err)
+	}
+
+	//canonical entries honor DisableEVs and tag overrides
+	bb.Reset()
+	bb.Write(b)
+	if jr, err = NewJSONReader(&bb, th); err != nil {
+		t.Fatal(err)
+	}
+	jr.DisableEVs()
+	jr.OverrideTags(7)
+	if got, err = jr.ReadEntry(); err != nil {
+		t.Fatal(err)
+	} else if got.Tag != 7 || got.EVB.Count() != 0 {
+		t.Fatalf("bad overridden entry %+v", got)
+	}
+
+	bb.Reset()
+	bb.WriteString(`{"v":2,"tag":1,"data":""}`)
+	if jr, err = NewJSONReader(&bb, th); err != nil {
+		t.Fatal(err)
+	} else if _, err = jr.ReadEntry(); err == nil {
+		t.Fatal("unsupported canonical version was accepted")
+	}
+}
@@ -34,3 +34,17 @@ func GetQuitChannel() chan os.Signal {
 	signal.Notify(quitSig, syscall.SIGHUP, syscall.SIGINT, syscall.SIGQUIT, syscall.SIGKILL, syscall.SIGTERM)
 	return quitSig
 }
+
+// WaitForQuitNoHangup waits until it receives one of the following signals:
+// SIGINT, SIGQUIT, SIGTERM
+// SIGHUP is not treated as a quit signal, ingesters that reload their configuration
+// on SIGHUP should use this instead of WaitForQuit.
+// It returns the received signal.
+func WaitForQuitNoHangup() (r os.Signal) {
+	quitSig := make(chan os.Signal, 1)
+	defer close(quitSig)
+	signal.Notify(quitSig, syscall.SIGINT, syscall.SIGQUIT, syscall.SIGKILL, syscall.SIGTERM)
+	r = <-quitSig
+	signal.Stop(quitSig)
+	return
+}
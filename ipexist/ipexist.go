@@ -9,6 +9,7 @@
 package ipexist
 
 import (
+	"bytes"
 	"compress/flate"
 	"encoding/binary"
 	"errors"
@@ -27,20 +28,27 @@ const (
 
 var (
 	ErrInvalidIPv4       = errors.New("Invalid IPv4 Address")
+	ErrInvalidIP         = errors.New("Invalid IP Address")
+	ErrInvalidCIDR       = errors.New("Invalid CIDR range")
 	ErrInvalidBaseOffset = errors.New("Invalid IPv4 base offset, potential corruption")
 	ErrNotMmapBacked     = errors.New("IPBitMap is not backed by a memory map")
 )
 
 var (
 	compV1Header = []byte{0x49, 0x50, 0x76, 0x34, 0x46, 0x4c, 0x54, 0x31} //IPv4FLT1
+	compV2Header = []byte{0x49, 0x50, 0x76, 0x36, 0x46, 0x4c, 0x54, 0x32} //IPv6FLT2
 )
 
 type slash16bitmap [1024]uint64
 
+// IpBitMap is a set of IPv4 and IPv6 addresses.  IPv4 addresses (including IPv4 mapped IPv6 addresses)
+// are held in /16 bitmaps, which may be memory mapped.  IPv6 addresses are held in a sparse prefix trie
+// which always lives on the heap.
 type IpBitMap struct {
 	maxOffset     uint16
 	bitmapOffsets [0xffff]uint16
 	bitmaps       []slash16bitmap
+	v6            v6set
 	mmapBacked    bool
 	mm            mmapBacker
 }
@@ -85,6 +93,7 @@ func LoadIPBitMapMemoryMapped(r io.Reader, p string) (*IpBitMap, error) {
 
 func (ipbm *IpBitMap) Close() (err error) {
 	ipbm.bitmaps = nil
+	ipbm.v6.root = nil
 	for i := 0; i < 0xffff; i++ {
 		ipbm.bitmapOffsets[i] = 0
 	}
@@ -97,10 +106,15 @@ func (ipbm *IpBitMap) Close() (err error) {
 
 func (ipbm *IpBitMap) AddIP(ip net.IP) (err error) {
 	if ip == nil {
-		err = ErrInvalidIPv4
+		err = ErrInvalidIP
 		return
-	} else if ip = ip.To4(); len(ip) != 4 {
-		err = ErrInvalidIPv4
+	} else if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+	} else if len(ip) == net.IPv6len {
+		ipbm.v6.add(newV6addr(ip), 128)
+		return
+	} else {
+		err = ErrInvalidIP
 		return
 	}
 	//read the upper 2 octets
@@ -130,10 +144,15 @@ func (ipbm *IpBitMap) AddIP(ip net.IP) (err error) {
 
 func (ipbm *IpBitMap) RemoveIP(ip net.IP) (err error) {
 	if ip == nil {
-		err = ErrInvalidIPv4
+		err = ErrInvalidIP
+		return
+	} else if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+	} else if len(ip) == net.IPv6len {
+		ipbm.v6.remove(newV6addr(ip), 128)
 		return
-	} else if ip = ip.To4(); len(ip) != 4 {
-		err = ErrInvalidIPv4
+	} else {
+		err = ErrInvalidIP
 		return
 	}
 	//read the upper 2 octets
@@ -146,8 +165,13 @@ func (ipbm *IpBitMap) RemoveIP(ip net.IP) (err error) {
 	off := ipbm.bitmapOffsets[upper]
 
 	// we're cool if it doesn't exist
-	if off == 0 || off == 0xffff || off > ipbm.maxOffset {
+	if off == 0 || off > ipbm.maxOffset && off != 0xffff {
 		return
+	} else if off == 0xffff {
+		//the entire /16 is set, break it out into a bitmap
+		if off, err = ipbm.fillNewBitmap(upper); err != nil {
+			return
+		}
 	}
 
 	ipbm.bitmaps[off-1].clear(lower)
@@ -156,10 +180,15 @@ func (ipbm *IpBitMap) RemoveIP(ip net.IP) (err error) {
 
 func (ipbm *IpBitMap) IPExists(ip net.IP) (ok bool, err error) {
 	if ip == nil {
-		err = ErrInvalidIPv4
+		err = ErrInvalidIP
 		return
-	} else if ip = ip.To4(); len(ip) != 4 {
-		err = ErrInvalidIPv4
+	} else if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+	} else if len(ip) == net.IPv6len {
+		ok = ipbm.v6.contains(newV6addr(ip))
+		return
+	} else {
+		err = ErrInvalidIP
 		return
 	}
 	//read the upper 2 octets
@@ -182,6 +211,140 @@ func (ipbm *IpBitMap) IPExists(ip net.IP) (ok bool, err error) {
 	return
 }
 
+// AddCIDR adds every address in the range, IPv4 ranges covering a /16 or more are marked
+// as full without allocating bitmaps.
+func (ipbm *IpBitMap) AddCIDR(n *net.IPNet) (err error) {
+	var first, last uint32
+	if a, plen, v4, ok := splitCIDR(n); !ok {
+		err = ErrInvalidCIDR
+	} else if !v4 {
+		ipbm.v6.add(a, plen)
+	} else if first, last = v4Range(a, plen); plen <= 16 {
+		for upper := first >> 16; upper <= last>>16 && upper != 0xffff; upper++ {
+			ipbm.fillSlash16(uint16(upper))
+		}
+	} else {
+		err = ipbm.setRange(uint16(first>>16), uint16(first), uint16(last))
+	}
+	return
+}
+
+// RemoveCIDR removes every address in the range.
+func (ipbm *IpBitMap) RemoveCIDR(n *net.IPNet) (err error) {
+	var first, last uint32
+	if a, plen, v4, ok := splitCIDR(n); !ok {
+		err = ErrInvalidCIDR
+	} else if !v4 {
+		ipbm.v6.remove(a, plen)
+	} else if first, last = v4Range(a, plen); plen <= 16 {
+		for upper := first >> 16; upper <= last>>16 && upper != 0xffff; upper++ {
+			ipbm.clearSlash16(uint16(upper))
+		}
+	} else {
+		err = ipbm.clearRange(uint16(first>>16), uint16(first), uint16(last))
+	}
+	return
+}
+
+// splitCIDR normalizes a network into an address and prefix length, IPv4 and IPv4 mapped
+// networks are reported as v4 with a prefix length relative to the 32 bit address.
+func splitCIDR(n *net.IPNet) (a v6addr, plen uint8, v4 bool, ok bool) {
+	if n == nil {
+		return
+	}
+	ones, bits := n.Mask.Size()
+	ip := n.IP.To16()
+	if ip == nil || (bits != 32 && bits != 128) {
+		return
+	}
+	if bits == 32 {
+		if n.IP.To4() == nil {
+			return
+		}
+		ones += 96
+	}
+	a = newV6addr(ip).mask(uint8(ones))
+	plen = uint8(ones)
+	if n.IP.To4() != nil && ones >= 96 {
+		v4 = true
+		plen -= 96
+	}
+	ok = true
+	return
+}
+
+// v4Range returns the first and last address of an IPv4 prefix held in the lower bits of a
+func v4Range(a v6addr, plen uint8) (first, last uint32) {
+	first = uint32(a[1])
+	last = first | uint32(uint64(0xffffffff)>>plen)
+	return
+}
+
+// fillSlash16 marks an entire /16 as set, existing bitmaps are filled so they are not orphaned
+func (ipbm *IpBitMap) fillSlash16(upper uint16) {
+	if off := ipbm.bitmapOffsets[upper]; off == 0 {
+		ipbm.bitmapOffsets[upper] = 0xffff
+	} else if off != 0xffff && off <= ipbm.maxOffset {
+		ipbm.bitmaps[off-1].fill()
+	}
+}
+
+// clearSlash16 removes an entire /16, existing bitmaps are zeroed and kept for reuse
+func (ipbm *IpBitMap) clearSlash16(upper uint16) {
+	if off := ipbm.bitmapOffsets[upper]; off == 0xffff {
+		ipbm.bitmapOffsets[upper] = 0
+	} else if off != 0 && off <= ipbm.maxOffset {
+		ipbm.bitmaps[off-1] = slash16bitmap{}
+	}
+}
+
+func (ipbm *IpBitMap) setRange(upper, lo, hi uint16) (err error) {
+	if upper == 0xffff {
+		return // we do not support broadcast
+	}
+	off := ipbm.bitmapOffsets[upper]
+	if off == 0xffff {
+		return
+	} else if off == 0 {
+		if off, err = ipbm.addNewBitmap(); err != nil {
+			return
+		}
+		ipbm.bitmapOffsets[upper] = off
+	} else if off > ipbm.maxOffset {
+		return ErrInvalidBaseOffset
+	}
+	ipbm.bitmaps[off-1].setRange(lo, hi)
+	return
+}
+
+func (ipbm *IpBitMap) clearRange(upper, lo, hi uint16) (err error) {
+	if upper == 0xffff {
+		return // we do not support broadcast
+	}
+	off := ipbm.bitmapOffsets[upper]
+	if off == 0 {
+		return
+	} else if off == 0xffff {
+		if off, err = ipbm.fillNewBitmap(upper); err != nil {
+			return
+		}
+	} else if off > ipbm.maxOffset {
+		return ErrInvalidBaseOffset
+	}
+	ipbm.bitmaps[off-1].clearRange(lo, hi)
+	return
+}
+
+// fillNewBitmap replaces a full /16 marker with a bitmap that has every bit set
+func (ipbm *IpBitMap) fillNewBitmap(upper uint16) (off uint16, err error) {
+	if off, err = ipbm.addNewBitmap(); err != nil {
+		return
+	}
+	ipbm.bitmaps[off-1].fill()
+	ipbm.bitmapOffsets[upper] = off
+	return
+}
+
 func (ipbm *IpBitMap) addNewBitmap() (off uint16, err error) {
 	if len(ipbm.bitmaps) >= maxMaps {
 		err = errors.New("Maps exhausted")
@@ -201,8 +364,13 @@ func (ipbm *IpBitMap) addNewBitmap() (off uint16, err error) {
 
 func (ipbm *IpBitMap) Encode(w io.Writer) (err error) {
 	var fw *flate.Writer
+	//sets without IPv6 addresses keep the original format so older readers can load them
+	hdr := compV1Header
+	if !ipbm.v6.empty() {
+		hdr = compV2Header
+	}
 	//write the header
-	if err = writeAll(w, compV1Header); err != nil {
+	if err = writeAll(w, hdr); err != nil {
 		return
 	}
 	//write the bitmap slice count
@@ -227,6 +395,12 @@ func (ipbm *IpBitMap) Encode(w io.Writer) (err error) {
 			return
 		}
 	}
+	//write the IPv6 prefixes
+	if !ipbm.v6.empty() {
+		if err = ipbm.v6.encode(fw); err != nil {
+			return
+		}
+	}
 	if err = fw.Flush(); err != nil {
 		return
 	}
@@ -237,7 +411,7 @@ func (ipbm *IpBitMap) Encode(w io.Writer) (err error) {
 func CheckDecodeHeader(r io.Reader) (err error) {
 	var cnt uint64
 	//write the header
-	if err = checkHeader(r); err != nil {
+	if _, err = checkHeader(r); err != nil {
 		return
 	}
 	//get the slice count
@@ -253,8 +427,9 @@ func CheckDecodeHeader(r io.Reader) (err error) {
 func (ipbm *IpBitMap) Decode(r io.Reader) (err error) {
 	var fr io.ReadCloser
 	var cnt uint64
+	var hasV6 bool
 	//write the header
-	if err = checkHeader(r); err != nil {
+	if hasV6, err = checkHeader(r); err != nil {
 		return
 	}
 	//get the slice count
@@ -289,8 +464,13 @@ func (ipbm *IpBitMap) Decode(r io.Reader) (err error) {
 
 	if len(ipbm.bitmaps) != int(cnt) {
 		err = errors.New("bitmaps are corrupt")
+		return
 	}
-	return nil
+	ipbm.v6.root = nil
+	if hasV6 {
+		err = ipbm.v6.decode(fr)
+	}
+	return
 }
 
 // addMmapBackedBitmap will extend the memory mapped file and get the
@@ -353,8 +533,44 @@ func (b *slash16bitmap) clear(v uint16) {
 	//get the bit offset into the field
 	boff := uint64(1 << (v & 0x3f))
 
-	//set the bit
-	b[v>>6] ^= boff
+	//clear the bit
+	b[v>>6] &^= boff
+}
+
+// rangeMasks returns the word indexes and masks covering the inclusive range lo through hi
+func rangeMasks(lo, hi uint16) (lw, hw int, lm, hm uint64) {
+	lw, hw = int(lo>>6), int(hi>>6)
+	lm = ^uint64(0) << (lo & 0x3f)
+	hm = ^uint64(0) >> (63 - (hi & 0x3f))
+	if lw == hw {
+		lm &= hm
+		hm = lm
+	}
+	return
+}
+
+func (b *slash16bitmap) setRange(lo, hi uint16) {
+	lw, hw, lm, hm := rangeMasks(lo, hi)
+	b[lw] |= lm
+	for i := lw + 1; i < hw; i++ {
+		b[i] = ^uint64(0)
+	}
+	b[hw] |= hm
+}
+
+func (b *slash16bitmap) clearRange(lo, hi uint16) {
+	lw, hw, lm, hm := rangeMasks(lo, hi)
+	b[lw] &^= lm
+	for i := lw + 1; i < hw; i++ {
+		b[i] = 0
+	}
+	b[hw] &^= hm
+}
+
+func (b *slash16bitmap) fill() {
+	for i := range b {
+		b[i] = ^uint64(0)
+	}
 }
 
 func (b *slash16bitmap) isset(v uint16) bool {
@@ -376,19 +592,20 @@ func writeAll(w io.Writer, b []byte) (err error) {
 	return
 }
 
-func checkHeader(r io.Reader) (err error) {
+// checkHeader validates the header and reports whether an IPv6 section follows the bitmaps
+func checkHeader(r io.Reader) (hasV6 bool, err error) {
 	var n int
 	x := make([]byte, len(compV1Header))
 	if n, err = r.Read(x); err != nil {
 		return
 	} else if n != len(x) {
-		return errors.New("failed header read")
+		err = errors.New("failed header read")
+		return
 	}
-	for i := range x {
-		if x[i] != compV1Header[i] {
-			err = errors.New("Bad header")
-			break
-		}
+	if bytes.Equal(x, compV2Header) {
+		hasV6 = true
+	} else if !bytes.Equal(x, compV1Header) {
+		err = errors.New("Bad header")
 	}
 	return
 }
@@ -9,6 +9,7 @@
 package ipexist
 
 import (
+	"bytes"
 	"io/ioutil"
 	"log"
 	"net"
@@ -486,3 +487,164 @@ func getTempFileName() (s string, err error) {
 	err = f.Close()
 	return
 }
+
+func TestClearUnset(t *testing.T) {
+	var b slash16bitmap
+	b.clear(100)
+	if b.isset(100) {
+		t.Fatal("clearing an unset bit set it")
+	}
+	b.setRange(3, 200)
+	for i := uint16(0); i < 300; i++ {
+		if b.isset(i) != (i >= 3 && i <= 200) {
+			t.Fatal("bad range bit", i)
+		}
+	}
+	b.clearRange(64, 127)
+	for i := uint16(0); i < 300; i++ {
+		if b.isset(i) != (i >= 3 && i <= 200 && (i < 64 || i > 127)) {
+			t.Fatal("bad cleared range bit", i)
+		}
+	}
+	b.setRange(0xffff, 0xffff)
+	if !b.isset(0xffff) || b.isset(0xfffe) {
+		t.Fatal("bad top bit")
+	}
+}
+
+func mustCIDR(t *testing.T, s string) *net.IPNet {
+	t.Helper()
+	_, n, err := net.ParseCIDR(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func checkExists(t *testing.T, bm *IpBitMap, ips map[string]bool) {
+	t.Helper()
+	for s, want := range ips {
+		if ok, err := bm.IPExists(net.ParseIP(s)); err != nil {
+			t.Fatal(err)
+		} else if ok != want {
+			t.Fatalf("%s: %v != %v", s, ok, want)
+		}
+	}
+}
+
+func TestCIDR(t *testing.T) {
+	bm := NewIPBitMap()
+	for _, v := range []string{`10.0.0.0/8`, `192.168.1.0/24`, `172.16.5.4/31`, `2001:db8::/32`, `::ffff:1.2.3.0/120`} {
+		if err := bm.AddCIDR(mustCIDR(t, v)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(bm.bitmaps) != 3 {
+		t.Fatalf("full /16 ranges allocated bitmaps: %d", len(bm.bitmaps))
+	}
+	ips := map[string]bool{
+		`10.0.0.0`: true, `10.255.255.255`: true, `11.0.0.0`: false,
+		`192.168.1.200`: true, `192.168.2.1`: false,
+		`172.16.5.4`: true, `172.16.5.5`: true, `172.16.5.6`: false,
+		`1.2.3.255`: true, `1.2.4.0`: false,
+		`2001:db8:1::1`: true, `2001:db9::1`: false,
+	}
+	checkExists(t, bm, ips)
+
+	//punch holes in full and partial ranges
+	for _, v := range []string{`10.1.2.0/23`, `192.168.1.64/26`, `2001:db8:1::/48`} {
+		if err := bm.RemoveCIDR(mustCIDR(t, v)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := bm.RemoveIP(net.ParseIP(`10.9.9.9`)); err != nil {
+		t.Fatal(err)
+	}
+	ips[`10.1.2.1`], ips[`10.1.3.255`], ips[`10.1.4.0`], ips[`10.1.1.255`] = false, false, true, true
+	ips[`10.9.9.9`], ips[`10.9.9.8`] = false, true
+	ips[`192.168.1.64`], ips[`192.168.1.127`], ips[`192.168.1.128`] = false, false, true
+	ips[`2001:db8:1::1`], ips[`2001:db8:2::1`] = false, true
+	checkExists(t, bm, ips)
+
+	//encode and decode with the v6 section
+	var bb bytes.Buffer
+	if err := bm.Encode(&bb); err != nil {
+		t.Fatal(err)
+	} else if !bytes.HasPrefix(bb.Bytes(), compV2Header) {
+		t.Fatal("IPv6 set encoded with the wrong header")
+	}
+	if err := CheckDecodeHeader(bytes.NewReader(bb.Bytes())); err != nil {
+		t.Fatal(err)
+	}
+	nbm, err := LoadIPBitMap(&bb)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkExists(t, nbm, ips)
+
+	//removing everything empties the set
+	if err = nbm.RemoveCIDR(mustCIDR(t, `0.0.0.0/0`)); err != nil {
+		t.Fatal(err)
+	} else if err = nbm.RemoveCIDR(mustCIDR(t, `::/0`)); err != nil {
+		t.Fatal(err)
+	}
+	for s := range ips {
+		ips[s] = false
+	}
+	checkExists(t, nbm, ips)
+
+	if err = bm.AddCIDR(nil); err != ErrInvalidCIDR {
+		t.Fatalf("nil CIDR did not fail: %v", err)
+	} else if err = bm.AddIP(net.IP{1, 2, 3}); err != ErrInvalidIP {
+		t.Fatalf("bad IP did not fail: %v", err)
+	}
+}
+
+func TestIPv4OnlyHeader(t *testing.T) {
+	bm := NewIPBitMap()
+	if err := bm.AddCIDR(mustCIDR(t, `10.0.0.0/24`)); err != nil {
+		t.Fatal(err)
+	}
+	var bb bytes.Buffer
+	if err := bm.Encode(&bb); err != nil {
+		t.Fatal(err)
+	} else if !bytes.HasPrefix(bb.Bytes(), compV1Header) {
+		t.Fatal("IPv4 only set did not keep the original header")
+	}
+}
+
+func TestCIDRMemoryMapped(t *testing.T) {
+	mmn, err := getTempFileName()
+	if err != nil {
+		t.Fatal(err)
+	}
+	bm, err := NewIPBitMapMemoryMapped(mmn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, v := range []string{`10.0.0.0/15`, `10.0.0.0/23`, `fe80::/64`} {
+		if err = bm.AddCIDR(mustCIDR(t, v)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = bm.RemoveCIDR(mustCIDR(t, `10.1.0.0/24`)); err != nil {
+		t.Fatal(err)
+	}
+	ips := map[string]bool{`10.0.1.1`: true, `10.1.0.1`: false, `10.1.1.1`: true, `fe80::5`: true}
+	checkExists(t, bm, ips)
+	var bb bytes.Buffer
+	if err = bm.Encode(&bb); err != nil {
+		t.Fatal(err)
+	} else if err = bm.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if mmn, err = getTempFileName(); err != nil {
+		t.Fatal(err)
+	} else if bm, err = LoadIPBitMapMemoryMapped(&bb, mmn); err != nil {
+		t.Fatal(err)
+	}
+	checkExists(t, bm, ips)
+	if err = bm.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
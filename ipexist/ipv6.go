@@ -0,0 +1,242 @@
+/*************************************************************************
+ * Copyright 2024 Gravwell, Inc. All rights reserved.
+ * Contact: <legal@gravwell.io>
+ *
+ * This software may be modified and distributed under the terms of the
+ * BSD 2-clause license. See the LICENSE file for details.
+ **************************************************************************/
+
+package ipexist
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"math/bits"
+	"net"
+)
+
+const (
+	v6PrefixEncSize = 17 //16 byte address and a prefix length
+	maxV6Prefixes   = 0x10000000
+)
+
+var (
+	ErrInvalidV6Prefixes = errors.New("Invalid IPv6 prefix set, potential corruption")
+)
+
+// v6addr is a 128 bit address stored as upper and lower halves
+type v6addr [2]uint64
+
+// v6node is a node in a path compressed binary trie of IPv6 prefixes.
+// Full nodes mean the entire prefix is in the set and never have children,
+// other nodes are branch points and always have two children.
+type v6node struct {
+	addr  v6addr
+	plen  uint8
+	full  bool
+	child [2]*v6node
+}
+
+// v6set is a sparse set of IPv6 prefixes, overlapping and adjacent prefixes are merged
+type v6set struct {
+	root *v6node
+}
+
+func newV6addr(ip net.IP) (a v6addr) {
+	a[0] = binary.BigEndian.Uint64(ip[0:8])
+	a[1] = binary.BigEndian.Uint64(ip[8:16])
+	return
+}
+
+func (a v6addr) IP() net.IP {
+	ip := make(net.IP, net.IPv6len)
+	binary.BigEndian.PutUint64(ip[0:8], a[0])
+	binary.BigEndian.PutUint64(ip[8:16], a[1])
+	return ip
+}
+
+// bit returns the bit at position i, counting from the most significant bit
+func (a v6addr) bit(i uint8) int {
+	return int(a[i>>6]>>(63-(i&63))) & 1
+}
+
+// mask zeros everything past the first plen bits
+func (a v6addr) mask(plen uint8) v6addr {
+	if plen == 0 {
+		return v6addr{}
+	} else if plen < 64 {
+		return v6addr{a[0] &^ (^uint64(0) >> plen), 0}
+	} else if plen < 128 {
+		return v6addr{a[0], a[1] &^ (^uint64(0) >> (plen - 64))}
+	}
+	return a
+}
+
+// with returns the address with bit i set to v
+func (a v6addr) with(i uint8, v int) v6addr {
+	m := uint64(1) << (63 - (i & 63))
+	if v == 0 {
+		a[i>>6] &^= m
+	} else {
+		a[i>>6] |= m
+	}
+	return a
+}
+
+// commonPrefix returns the number of leading bits a and b share, up to max
+func commonPrefix(a, b v6addr, max uint8) (l uint8) {
+	if x := a[0] ^ b[0]; x != 0 {
+		l = uint8(bits.LeadingZeros64(x))
+	} else {
+		l = 64 + uint8(bits.LeadingZeros64(a[1]^b[1]))
+	}
+	if l > max {
+		l = max
+	}
+	return
+}
+
+func minPlen(a, b uint8) uint8 {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func (s *v6set) add(a v6addr, plen uint8) {
+	s.root = v6insert(s.root, a.mask(plen), plen)
+}
+
+func (s *v6set) remove(a v6addr, plen uint8) {
+	s.root = v6remove(s.root, a.mask(plen), plen)
+}
+
+func (s *v6set) contains(a v6addr) bool {
+	for n := s.root; n != nil; {
+		if commonPrefix(n.addr, a, n.plen) != n.plen {
+			return false
+		} else if n.full {
+			return true
+		}
+		n = n.child[a.bit(n.plen)]
+	}
+	return false
+}
+
+func (s *v6set) empty() bool {
+	return s.root == nil
+}
+
+// walk calls fn on every full prefix in address order
+func (s *v6set) walk(fn func(a v6addr, plen uint8) error) error {
+	return v6walk(s.root, fn)
+}
+
+func v6walk(n *v6node, fn func(a v6addr, plen uint8) error) (err error) {
+	if n == nil {
+		return
+	} else if n.full {
+		return fn(n.addr, n.plen)
+	} else if err = v6walk(n.child[0], fn); err == nil {
+		err = v6walk(n.child[1], fn)
+	}
+	return
+}
+
+func v6insert(n *v6node, a v6addr, plen uint8) *v6node {
+	if n == nil {
+		return &v6node{addr: a, plen: plen, full: true}
+	}
+	cpl := commonPrefix(n.addr, a, minPlen(n.plen, plen))
+	if cpl == plen {
+		//the new prefix covers this node entirely
+		return &v6node{addr: a, plen: plen, full: true}
+	} else if cpl == n.plen {
+		//this node covers the new prefix
+		if !n.full {
+			b := a.bit(n.plen)
+			n.child[b] = v6insert(n.child[b], a, plen)
+			v6merge(n)
+		}
+		return n
+	}
+	//the prefixes diverge, add a branch point
+	br := &v6node{addr: a.mask(cpl), plen: cpl}
+	br.child[a.bit(cpl)] = &v6node{addr: a, plen: plen, full: true}
+	br.child[n.addr.bit(cpl)] = n
+	v6merge(br)
+	return br
+}
+
+func v6remove(n *v6node, a v6addr, plen uint8) *v6node {
+	if n == nil {
+		return nil
+	}
+	cpl := commonPrefix(n.addr, a, minPlen(n.plen, plen))
+	if cpl < minPlen(n.plen, plen) {
+		return n //disjoint
+	} else if plen <= n.plen {
+		return nil //the removed prefix covers this node
+	}
+	b := a.bit(n.plen)
+	if n.full {
+		//split the node into halves and remove from the half holding the prefix
+		n.full = false
+		n.child[b] = &v6node{addr: n.addr.with(n.plen, b), plen: n.plen + 1, full: true}
+		n.child[b^1] = &v6node{addr: n.addr.with(n.plen, b^1), plen: n.plen + 1, full: true}
+	}
+	n.child[b] = v6remove(n.child[b], a, plen)
+	if n.child[b] == nil {
+		return n.child[b^1]
+	}
+	return n
+}
+
+// v6merge collapses a branch whose two halves are both full
+func v6merge(n *v6node) {
+	l, r := n.child[0], n.child[1]
+	if l != nil && r != nil && l.full && r.full && l.plen == n.plen+1 && r.plen == n.plen+1 {
+		n.full = true
+		n.child[0], n.child[1] = nil, nil
+	}
+}
+
+// encode writes the prefix count followed by each prefix and its length
+func (s *v6set) encode(w io.Writer) (err error) {
+	var cnt uint64
+	s.walk(func(v6addr, uint8) error {
+		cnt++
+		return nil
+	})
+	if err = binary.Write(w, binary.LittleEndian, cnt); err != nil {
+		return
+	}
+	buff := make([]byte, v6PrefixEncSize)
+	return s.walk(func(a v6addr, plen uint8) error {
+		binary.BigEndian.PutUint64(buff[0:8], a[0])
+		binary.BigEndian.PutUint64(buff[8:16], a[1])
+		buff[16] = plen
+		return writeAll(w, buff)
+	})
+}
+
+func (s *v6set) decode(r io.Reader) (err error) {
+	var cnt uint64
+	if err = binary.Read(r, binary.LittleEndian, &cnt); err != nil {
+		return
+	} else if cnt > maxV6Prefixes {
+		return ErrInvalidV6Prefixes
+	}
+	s.root = nil
+	buff := make([]byte, v6PrefixEncSize)
+	for i := uint64(0); i < cnt; i++ {
+		if _, err = io.ReadFull(r, buff); err != nil {
+			return
+		} else if buff[16] > 128 {
+			return ErrInvalidV6Prefixes
+		}
+		s.add(v6addr{binary.BigEndian.Uint64(buff[0:8]), binary.BigEndian.Uint64(buff[8:16])}, buff[16])
+	}
+	return
+}
@@ -0,0 +1,106 @@
+/*************************************************************************
+ * Copyright 2024 Gravwell, Inc. All rights reserved.
+ * Contact: <legal@gravwell.io>
+ *
+ * This software may be modified and distributed under the terms of the
+ * BSD 2-clause license. See the LICENSE file for details.
+ **************************************************************************/
+
+package ipexist
+
+import (
+	"bytes"
+	"math/rand"
+	"net"
+	"testing"
+)
+
+// TestV6Trie checks random adds and removes over a /120 against a brute force set
+func TestV6Trie(t *testing.T) {
+	base := newV6addr(net.ParseIP(`2001:db8::`))
+	rng := rand.New(rand.NewSource(42))
+	var s v6set
+	var ref [256]bool
+	for i := 0; i < 5000; i++ {
+		plen := uint8(120 + rng.Intn(9))
+		a := base
+		a[1] |= uint64(rng.Intn(256))
+		a = a.mask(plen)
+		add := rng.Intn(3) != 0
+		if add {
+			s.add(a, plen)
+		} else {
+			s.remove(a, plen)
+		}
+		for j := uint64(0); j < 1<<(128-plen); j++ {
+			ref[(a[1]&0xff)+j] = add
+		}
+		if i%50 != 0 {
+			continue
+		}
+		for j := range ref {
+			x := base
+			x[1] |= uint64(j)
+			if s.contains(x) != ref[j] {
+				t.Fatalf("step %d: address %d mismatch %v != %v", i, j, s.contains(x), ref[j])
+			}
+		}
+	}
+
+	//filling the whole range must merge down to a single prefix
+	s.add(base, 120)
+	var cnt int
+	s.walk(func(a v6addr, plen uint8) error {
+		if a != base || plen != 120 {
+			t.Fatalf("bad merged prefix %v/%d", a.IP(), plen)
+		}
+		cnt++
+		return nil
+	})
+	if cnt != 1 {
+		t.Fatalf("bad prefix count %d", cnt)
+	}
+	s.remove(base, 0)
+	if !s.empty() {
+		t.Fatal("set not empty")
+	}
+}
+
+func TestV6EncodeDecode(t *testing.T) {
+	var s, s2 v6set
+	for _, v := range []string{`2001:db8::/32`, `fe80::1/128`, `2001:db9:1::/48`, `::/127`} {
+		_, n, err := net.ParseCIDR(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ones, _ := n.Mask.Size()
+		s.add(newV6addr(n.IP), uint8(ones))
+	}
+	var bb bytes.Buffer
+	if err := s.encode(&bb); err != nil {
+		t.Fatal(err)
+	}
+	enc := append([]byte(nil), bb.Bytes()...)
+	if err := s2.decode(&bb); err != nil {
+		t.Fatal(err)
+	}
+	if err := s2.encode(&bb); err != nil {
+		t.Fatal(err)
+	} else if !bytes.Equal(enc, bb.Bytes()) {
+		t.Fatal("re-encoded set changed")
+	}
+	for _, v := range []string{`2001:db8:ffff::1`, `fe80::1`, `2001:db9:1:2::3`, `::1`} {
+		if !s2.contains(newV6addr(net.ParseIP(v))) {
+			t.Fatalf("%s missing", v)
+		}
+	}
+	if s2.contains(newV6addr(net.ParseIP(`fe80::2`))) {
+		t.Fatal("fe80::2 found")
+	}
+
+	//bad prefix lengths are rejected
+	enc[len(enc)-1] = 129
+	if err := s2.decode(bytes.NewReader(enc)); err != ErrInvalidV6Prefixes {
+		t.Fatalf("bad prefix length decoded: %v", err)
+	}
+}
@@ -0,0 +1,299 @@
+/*************************************************************************
+ * Copyright 2024 Gravwell, Inc. All rights reserved.
+ * Contact: <legal@gravwell.io>
+ *
+ * This software may be modified and distributed under the terms of the
+ * BSD 2-clause license. See the LICENSE file for details.
+ **************************************************************************/
+
+package ipexist
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"math/big"
+	"math/bits"
+	"net"
+	"strings"
+)
+
+const (
+	slash16Empty = iota
+	slash16Full
+	slash16Partial
+)
+
+// Stats describes the contents of a set.
+type Stats struct {
+	IPv4Addresses uint64   // IPv4 members
+	IPv6Addresses *big.Int // IPv6 members, this can exceed 64 bits
+	IPv6Prefixes  uint64   // merged IPv6 prefixes held in the trie
+	Bitmaps       int      // allocated /16 bitmaps
+	FullSlash16   int      // /16 ranges marked full without a bitmap
+}
+
+// slash16 returns the state of a /16 and its bitmap if it has one
+func (ipbm *IpBitMap) slash16(upper uint16) (state int, bm *slash16bitmap) {
+	off := ipbm.bitmapOffsets[upper]
+	if off == 0xffff {
+		state = slash16Full
+	} else if off != 0 && off <= ipbm.maxOffset {
+		state = slash16Partial
+		bm = &ipbm.bitmaps[off-1]
+	}
+	return
+}
+
+// Clone returns a heap backed copy of the set, the source may be memory mapped.
+func (ipbm *IpBitMap) Clone() *IpBitMap {
+	x := NewIPBitMap()
+	x.Union(ipbm)
+	return x
+}
+
+// Union adds every member of other to the set.
+func (ipbm *IpBitMap) Union(other *IpBitMap) (err error) {
+	for upper := 0; upper < 0xffff; upper++ {
+		ost, obm := other.slash16(uint16(upper))
+		if ost == slash16Empty {
+			continue
+		} else if ost == slash16Full {
+			ipbm.fillSlash16(uint16(upper))
+			continue
+		}
+		st, bm := ipbm.slash16(uint16(upper))
+		if st == slash16Full {
+			continue
+		} else if st == slash16Empty {
+			if bm, err = ipbm.newSlash16Bitmap(uint16(upper)); err != nil {
+				return
+			}
+		}
+		for i := range bm {
+			bm[i] |= obm[i]
+		}
+	}
+	other.v6.walk(func(a v6addr, plen uint8) error {
+		ipbm.v6.add(a, plen)
+		return nil
+	})
+	return
+}
+
+// Intersect removes every member of the set that is not in other.
+func (ipbm *IpBitMap) Intersect(other *IpBitMap) (err error) {
+	for upper := 0; upper < 0xffff; upper++ {
+		st, bm := ipbm.slash16(uint16(upper))
+		if st == slash16Empty {
+			continue
+		}
+		ost, obm := other.slash16(uint16(upper))
+		if ost == slash16Full {
+			continue
+		} else if ost == slash16Empty {
+			ipbm.clearSlash16(uint16(upper))
+			continue
+		}
+		if st == slash16Full {
+			if bm, err = ipbm.fullSlash16Bitmap(uint16(upper)); err != nil {
+				return
+			}
+		}
+		for i := range bm {
+			bm[i] &= obm[i]
+		}
+	}
+	//A & B == A - (A - B)
+	var diff v6set
+	ipbm.v6.walk(func(a v6addr, plen uint8) error {
+		diff.add(a, plen)
+		return nil
+	})
+	other.v6.walk(func(a v6addr, plen uint8) error {
+		diff.remove(a, plen)
+		return nil
+	})
+	diff.walk(func(a v6addr, plen uint8) error {
+		ipbm.v6.remove(a, plen)
+		return nil
+	})
+	return
+}
+
+// Difference removes every member of other from the set.
+func (ipbm *IpBitMap) Difference(other *IpBitMap) (err error) {
+	for upper := 0; upper < 0xffff; upper++ {
+		ost, obm := other.slash16(uint16(upper))
+		if ost == slash16Empty {
+			continue
+		} else if ost == slash16Full {
+			ipbm.clearSlash16(uint16(upper))
+			continue
+		}
+		st, bm := ipbm.slash16(uint16(upper))
+		if st == slash16Empty {
+			continue
+		} else if st == slash16Full {
+			if bm, err = ipbm.fullSlash16Bitmap(uint16(upper)); err != nil {
+				return
+			}
+		}
+		for i := range bm {
+			bm[i] &^= obm[i]
+		}
+	}
+	other.v6.walk(func(a v6addr, plen uint8) error {
+		ipbm.v6.remove(a, plen)
+		return nil
+	})
+	return
+}
+
+func (ipbm *IpBitMap) newSlash16Bitmap(upper uint16) (bm *slash16bitmap, err error) {
+	var off uint16
+	if off, err = ipbm.addNewBitmap(); err == nil {
+		ipbm.bitmapOffsets[upper] = off
+		bm = &ipbm.bitmaps[off-1]
+	}
+	return
+}
+
+func (ipbm *IpBitMap) fullSlash16Bitmap(upper uint16) (bm *slash16bitmap, err error) {
+	var off uint16
+	if off, err = ipbm.fillNewBitmap(upper); err == nil {
+		bm = &ipbm.bitmaps[off-1]
+	}
+	return
+}
+
+// Stats counts the members of the set.
+func (ipbm *IpBitMap) Stats() (s Stats) {
+	s.Bitmaps = len(ipbm.bitmaps)
+	for upper := 0; upper < 0xffff; upper++ {
+		switch st, bm := ipbm.slash16(uint16(upper)); st {
+		case slash16Full:
+			s.FullSlash16++
+			s.IPv4Addresses += 0x10000
+		case slash16Partial:
+			for _, w := range bm {
+				s.IPv4Addresses += uint64(bits.OnesCount64(w))
+			}
+		}
+	}
+	s.IPv6Addresses = new(big.Int)
+	ipbm.v6.walk(func(a v6addr, plen uint8) error {
+		s.IPv6Prefixes++
+		s.IPv6Addresses.Add(s.IPv6Addresses, new(big.Int).Lsh(big.NewInt(1), uint(128-plen)))
+		return nil
+	})
+	return
+}
+
+// WalkIPv4 calls fn on every IPv4 member in address order, iteration stops on the first error.
+func (ipbm *IpBitMap) WalkIPv4(fn func(net.IP) error) error {
+	return ipbm.walkV4Ranges(func(first, last uint32) (err error) {
+		for v := uint64(first); v <= uint64(last) && err == nil; v++ {
+			ip := make(net.IP, net.IPv4len)
+			binary.BigEndian.PutUint32(ip, uint32(v))
+			err = fn(ip)
+		}
+		return
+	})
+}
+
+// WalkCIDR calls fn with the smallest set of CIDR ranges covering the members, IPv4 ranges
+// come first and each family is in address order.  Iteration stops on the first error.
+func (ipbm *IpBitMap) WalkCIDR(fn func(*net.IPNet) error) (err error) {
+	err = ipbm.walkV4Ranges(func(first, last uint32) (err error) {
+		for v := uint64(first); v <= uint64(last) && err == nil; {
+			//largest aligned block starting at v that fits in the range
+			sz := uint(bits.TrailingZeros32(uint32(v)))
+			if v == 0 {
+				sz = 32
+			}
+			for (v + (1 << sz) - 1) > uint64(last) {
+				sz--
+			}
+			ip := make(net.IP, net.IPv4len)
+			binary.BigEndian.PutUint32(ip, uint32(v))
+			err = fn(&net.IPNet{IP: ip, Mask: net.CIDRMask(32-int(sz), 32)})
+			v += 1 << sz
+		}
+		return
+	})
+	if err != nil {
+		return
+	}
+	return ipbm.v6.walk(func(a v6addr, plen uint8) error {
+		return fn(&net.IPNet{IP: a.IP(), Mask: net.CIDRMask(int(plen), 128)})
+	})
+}
+
+// walkV4Ranges calls fn with each inclusive run of consecutive IPv4 members
+func (ipbm *IpBitMap) walkV4Ranges(fn func(first, last uint32) error) (err error) {
+	var open bool
+	var first, last uint32
+	extend := func(lo, hi uint32) (err error) {
+		if open && lo == last+1 {
+			last = hi
+			return
+		} else if open {
+			err = fn(first, last)
+		}
+		first, last, open = lo, hi, true
+		return
+	}
+	for upper := uint32(0); upper < 0xffff && err == nil; upper++ {
+		st, bm := ipbm.slash16(uint16(upper))
+		base := upper << 16
+		if st == slash16Full {
+			err = extend(base, base|0xffff)
+			continue
+		} else if st == slash16Empty {
+			continue
+		}
+		for i, w := range bm {
+			for w != 0 && err == nil {
+				//find the next run of set bits in the word
+				lo := uint32(bits.TrailingZeros64(w))
+				run := uint32(bits.TrailingZeros64(^(w >> lo)))
+				if lo+run < 64 {
+					w &^= ((uint64(1) << run) - 1) << lo
+				} else {
+					w = 0
+				}
+				wb := base | uint32(i)<<6
+				err = extend(wb|lo, wb|(lo+run-1))
+			}
+		}
+	}
+	if err == nil && open {
+		err = fn(first, last)
+	}
+	return
+}
+
+// AddText adds every IP address and CIDR range in r, one per line.  Quotes and surrounding
+// whitespace are trimmed, lines that are neither are skipped.
+func (ipbm *IpBitMap) AddText(r io.Reader) (ips, ranges int, err error) {
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		s := strings.TrimSpace(strings.Trim(sc.Text(), "\r\"'"))
+		if strings.Contains(s, "/") {
+			if _, n, lerr := net.ParseCIDR(s); lerr == nil {
+				if err = ipbm.AddCIDR(n); err != nil {
+					return
+				}
+				ranges++
+			}
+		} else if ip := net.ParseIP(s); ip != nil {
+			if err = ipbm.AddIP(ip); err != nil {
+				return
+			}
+			ips++
+		}
+	}
+	err = sc.Err()
+	return
+}
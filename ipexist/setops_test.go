@@ -0,0 +1,120 @@
+/*************************************************************************
+ * Copyright 2024 Gravwell, Inc. All rights reserved.
+ * Contact: <legal@gravwell.io>
+ *
+ * This software may be modified and distributed under the terms of the
+ * BSD 2-clause license. See the LICENSE file for details.
+ **************************************************************************/
+
+package ipexist
+
+import (
+	"math/big"
+	"net"
+	"strings"
+	"testing"
+)
+
+func textSet(t *testing.T, s string) *IpBitMap {
+	t.Helper()
+	bm := NewIPBitMap()
+	if _, _, err := bm.AddText(strings.NewReader(s)); err != nil {
+		t.Fatal(err)
+	}
+	return bm
+}
+
+func cidrs(t *testing.T, bm *IpBitMap) (r []string) {
+	t.Helper()
+	if err := bm.WalkCIDR(func(n *net.IPNet) error {
+		r = append(r, n.String())
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	return
+}
+
+func checkCIDRs(t *testing.T, bm *IpBitMap, want ...string) {
+	t.Helper()
+	if got := cidrs(t, bm); strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Fatalf("bad ranges:\n%v\n%v", got, want)
+	}
+}
+
+func TestSetAlgebra(t *testing.T) {
+	a := textSet(t, "10.0.0.0/15\n1.2.3.4\n\"1.2.3.5\"\n2001:db8::/32\nnot an ip\n")
+	b := textSet(t, "10.1.0.0/16\n10.0.0.128/25\n1.2.3.5\n9.9.9.9\n2001:db8:1::/48\nfe80::1\n")
+
+	u := a.Clone()
+	if err := u.Union(b); err != nil {
+		t.Fatal(err)
+	}
+	checkCIDRs(t, u, `1.2.3.4/31`, `9.9.9.9/32`, `10.0.0.0/15`, `2001:db8::/32`, `fe80::1/128`)
+
+	i := a.Clone()
+	if err := i.Intersect(b); err != nil {
+		t.Fatal(err)
+	}
+	checkCIDRs(t, i, `1.2.3.5/32`, `10.0.0.128/25`, `10.1.0.0/16`, `2001:db8:1::/48`)
+
+	d := a.Clone()
+	if err := d.Difference(b); err != nil {
+		t.Fatal(err)
+	}
+	checkCIDRs(t, d, `1.2.3.4/32`, `10.0.0.0/25`, `10.0.1.0/24`, `10.0.2.0/23`, `10.0.4.0/22`,
+		`10.0.8.0/21`, `10.0.16.0/20`, `10.0.32.0/19`, `10.0.64.0/18`, `10.0.128.0/17`,
+		`2001:db8::/48`, `2001:db8:2::/47`, `2001:db8:4::/46`, `2001:db8:8::/45`, `2001:db8:10::/44`,
+		`2001:db8:20::/43`, `2001:db8:40::/42`, `2001:db8:80::/41`, `2001:db8:100::/40`, `2001:db8:200::/39`,
+		`2001:db8:400::/38`, `2001:db8:800::/37`, `2001:db8:1000::/36`, `2001:db8:2000::/35`,
+		`2001:db8:4000::/34`, `2001:db8:8000::/33`)
+
+	//the source sets are untouched
+	checkCIDRs(t, a, `1.2.3.4/31`, `10.0.0.0/15`, `2001:db8::/32`)
+
+	s := a.Stats()
+	if s.IPv4Addresses != 2+0x20000 || s.FullSlash16 != 2 || s.IPv6Prefixes != 1 {
+		t.Fatalf("bad stats %+v", s)
+	} else if s.IPv6Addresses.Cmp(new(big.Int).Lsh(big.NewInt(1), 96)) != 0 {
+		t.Fatalf("bad IPv6 count %v", s.IPv6Addresses)
+	}
+}
+
+func TestSetAlgebraMemoryMapped(t *testing.T) {
+	mmn, err := getTempFileName()
+	if err != nil {
+		t.Fatal(err)
+	}
+	bm, err := NewIPBitMapMemoryMapped(mmn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bm.Close()
+	if err = bm.Union(textSet(t, "192.168.0.0/16\n172.16.1.1\n172.17.1.1\n")); err != nil {
+		t.Fatal(err)
+	} else if err = bm.Difference(textSet(t, "192.168.100.0/24\n")); err != nil {
+		t.Fatal(err)
+	} else if err = bm.Intersect(textSet(t, "192.168.0.0/17\n172.16.0.0/16\n")); err != nil {
+		t.Fatal(err)
+	}
+	checkCIDRs(t, bm, `172.16.1.1/32`, `192.168.0.0/18`, `192.168.64.0/19`, `192.168.96.0/22`,
+		`192.168.101.0/24`, `192.168.102.0/23`, `192.168.104.0/21`, `192.168.112.0/20`)
+}
+
+func TestWalkIPv4(t *testing.T) {
+	bm := textSet(t, "10.0.0.62/31\n10.0.0.64/30\n10.0.1.0\n10.0.255.255\n10.1.0.0\n")
+	var got []string
+	if err := bm.WalkIPv4(func(ip net.IP) error {
+		got = append(got, ip.String())
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	want := `10.0.0.62,10.0.0.63,10.0.0.64,10.0.0.65,10.0.0.66,10.0.0.67,10.0.1.0,10.0.255.255,10.1.0.0`
+	if strings.Join(got, ",") != want {
+		t.Fatalf("bad members: %v", got)
+	}
+	//adjacent runs crossing words and /16 boundaries are merged
+	checkCIDRs(t, bm, `10.0.0.62/31`, `10.0.0.64/30`, `10.0.1.0/32`, `10.0.255.255/32`, `10.1.0.0/32`)
+	checkCIDRs(t, textSet(t, "0.0.0.0/1\n128.0.0.0/2\n"), `0.0.0.0/1`, `128.0.0.0/2`)
+}
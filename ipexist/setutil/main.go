@@ -0,0 +1,195 @@
+/*************************************************************************
+ * Copyright 2024 Gravwell, Inc. All rights reserved.
+ * Contact: <legal@gravwell.io>
+ *
+ * This software may be modified and distributed under the terms of the
+ * BSD 2-clause license. See the LICENSE file for details.
+ **************************************************************************/
+
+// setutil merges, compares, and dumps ipexist sets.  Inputs may be encoded sets
+// or text feeds holding one IP address or CIDR range per line.
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+
+	"github.com/gravwell/gravwell/v3/ipexist"
+)
+
+func main() {
+	if len(os.Args) < 2 {
+		showHelp(os.Args[0])
+		os.Exit(-1)
+	}
+	var err error
+	switch os.Args[1] {
+	case `merge`:
+		err = combine(os.Args[2:], (*ipexist.IpBitMap).Union)
+	case `intersect`:
+		err = combine(os.Args[2:], (*ipexist.IpBitMap).Intersect)
+	case `subtract`:
+		err = combine(os.Args[2:], (*ipexist.IpBitMap).Difference)
+	case `diff`:
+		err = diff(os.Args[2:])
+	case `dump`:
+		err = dump(os.Args[2:])
+	case `stats`:
+		err = stats(os.Args[2:])
+	case `help`, `-h`, `-help`, `--help`:
+		showHelp(os.Args[0])
+		return
+	default:
+		fmt.Printf("Invalid action %q\n", os.Args[1])
+		showHelp(os.Args[0])
+		os.Exit(-1)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s failed - %v\n", os.Args[1], err)
+		os.Exit(-1)
+	}
+}
+
+func showHelp(app string) {
+	fmt.Printf("%s <action> [options] <input files>\n", app)
+	fmt.Printf("\nActions:\n")
+	fmt.Printf("\tmerge -o <output> <inputs>\tunion of all inputs\n")
+	fmt.Printf("\tintersect -o <output> <inputs>\tmembers present in every input\n")
+	fmt.Printf("\tsubtract -o <output> <base> <inputs>\tmembers of base not in any other input\n")
+	fmt.Printf("\tdiff <old> <new>\tprint added (+) and removed (-) CIDR ranges\n")
+	fmt.Printf("\tdump <input>\tprint the members as CIDR ranges\n")
+	fmt.Printf("\tstats <inputs>\tprint member counts\n")
+	fmt.Printf("\nInputs may be encoded sets or text files with one IP or CIDR per line\n")
+	fmt.Printf("\nExample: %s merge -o blocklist.ipe feed1.txt feed2.txt old.ipe\n", app)
+	fmt.Printf("Example: %s diff yesterday.ipe today.ipe\n", app)
+}
+
+// combine folds every input into the first with op and writes the result
+func combine(args []string, op func(*ipexist.IpBitMap, *ipexist.IpBitMap) error) (err error) {
+	var set *ipexist.IpBitMap
+	fs := flag.NewFlagSet(`combine`, flag.ExitOnError)
+	out := fs.String("o", "", "Output file")
+	fs.Parse(args)
+	if *out == `` {
+		return fmt.Errorf("missing output file, specify something for -o")
+	} else if fs.NArg() == 0 {
+		return fmt.Errorf("no input files")
+	}
+	for i, p := range fs.Args() {
+		var x *ipexist.IpBitMap
+		if x, err = loadSet(p); err != nil {
+			return
+		} else if i == 0 {
+			set = x
+		} else if err = op(set, x); err != nil {
+			return fmt.Errorf("failed to combine %q %w", p, err)
+		}
+	}
+	return writeSet(*out, set)
+}
+
+func diff(args []string) (err error) {
+	var old, cur *ipexist.IpBitMap
+	if len(args) != 2 {
+		return fmt.Errorf("diff requires an old and new set")
+	} else if old, err = loadSet(args[0]); err != nil {
+		return
+	} else if cur, err = loadSet(args[1]); err != nil {
+		return
+	}
+	added := cur.Clone()
+	removed := old.Clone()
+	if err = added.Difference(old); err != nil {
+		return
+	} else if err = removed.Difference(cur); err != nil {
+		return
+	}
+	w := bufio.NewWriter(os.Stdout)
+	if err = writeCIDRs(w, `+`, added); err != nil {
+		return
+	} else if err = writeCIDRs(w, `-`, removed); err != nil {
+		return
+	} else if err = w.Flush(); err != nil {
+		return
+	}
+	as, rs := added.Stats(), removed.Stats()
+	fmt.Fprintf(os.Stderr, "added %d IPv4 %v IPv6, removed %d IPv4 %v IPv6\n",
+		as.IPv4Addresses, as.IPv6Addresses, rs.IPv4Addresses, rs.IPv6Addresses)
+	return
+}
+
+func dump(args []string) (err error) {
+	var set *ipexist.IpBitMap
+	if len(args) != 1 {
+		return fmt.Errorf("dump requires a single input")
+	} else if set, err = loadSet(args[0]); err != nil {
+		return
+	}
+	w := bufio.NewWriter(os.Stdout)
+	if err = writeCIDRs(w, ``, set); err == nil {
+		err = w.Flush()
+	}
+	return
+}
+
+func stats(args []string) (err error) {
+	if len(args) == 0 {
+		return fmt.Errorf("no input files")
+	}
+	for _, p := range args {
+		var set *ipexist.IpBitMap
+		if set, err = loadSet(p); err != nil {
+			return
+		}
+		s := set.Stats()
+		fmt.Printf("%s: %d IPv4 addresses (%d bitmaps, %d full /16s), %v IPv6 addresses in %d prefixes\n",
+			p, s.IPv4Addresses, s.Bitmaps, s.FullSlash16, s.IPv6Addresses, s.IPv6Prefixes)
+	}
+	return
+}
+
+func writeCIDRs(w io.Writer, prefix string, set *ipexist.IpBitMap) error {
+	return set.WalkCIDR(func(n *net.IPNet) (err error) {
+		_, err = fmt.Fprintf(w, "%s%s\n", prefix, n)
+		return
+	})
+}
+
+// loadSet reads an encoded set, or falls back to parsing the file as a text feed
+func loadSet(p string) (set *ipexist.IpBitMap, err error) {
+	var fin *os.File
+	if fin, err = os.Open(p); err != nil {
+		return nil, fmt.Errorf("failed to open %q %w", p, err)
+	}
+	defer fin.Close()
+	encoded := ipexist.CheckDecodeHeader(fin) == nil
+	if _, err = fin.Seek(0, io.SeekStart); err != nil {
+		return
+	}
+	if encoded {
+		if set, err = ipexist.LoadIPBitMap(fin); err != nil {
+			err = fmt.Errorf("failed to decode %q %w", p, err)
+		}
+		return
+	}
+	set = ipexist.NewIPBitMap()
+	if _, _, err = set.AddText(fin); err != nil {
+		err = fmt.Errorf("failed to read %q %w", p, err)
+	}
+	return
+}
+
+func writeSet(p string, set *ipexist.IpBitMap) (err error) {
+	var fout *os.File
+	if fout, err = os.Create(p); err != nil {
+		return fmt.Errorf("failed to create output file %q - %w", p, err)
+	} else if err = set.Encode(fout); err != nil {
+		fout.Close()
+		return fmt.Errorf("failed to encode %q - %w", p, err)
+	}
+	return fout.Close()
+}
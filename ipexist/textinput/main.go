@@ -9,13 +9,9 @@
 package main
 
 import (
-	"bufio"
 	"flag"
-	"io"
 	"log"
-	"net"
 	"os"
-	"strings"
 
 	"github.com/gravwell/gravwell/v3/ipexist"
 )
@@ -52,28 +48,12 @@ func main() {
 
 	ipb := ipexist.NewIPBitMap()
 
-	r := bufio.NewReader(fin)
-	var cnt int
-	for {
-		s, err := r.ReadString('\n')
-		if err != nil {
-			if err == io.EOF {
-				err = nil
-			}
-			break
-		}
-		s = strings.TrimSpace(strings.Trim(s, "\n\r\"'"))
-		if ip := net.ParseIP(s); ip != nil {
-			if ip = ip.To4(); ip != nil {
-				if err := ipb.AddIP(ip); err != nil {
-					log.Fatalf("Failed to add %s: %v\n", ip, err)
-				}
-				cnt++
-			}
-		}
+	cnt, rcnt, err := ipb.AddText(fin)
+	if err != nil {
+		log.Fatalf("Failed to read %s: %v\n", *fIn, err)
 	}
 	if err = ipb.Encode(fout); err != nil {
 		log.Fatalf("Failied to encode output file: %v\n", err)
 	}
-	log.Printf("Processed %d IPs\n", cnt)
+	log.Printf("Processed %d IPs and %d CIDR ranges\n", cnt, rcnt)
 }
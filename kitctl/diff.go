@@ -0,0 +1,397 @@
+/*************************************************************************
+ * Copyright 2024 Gravwell, Inc. All rights reserved.
+ * Contact: <legal@gravwell.io>
+ *
+ * This software may be modified and distributed under the terms of the
+ * BSD 2-clause license. See the LICENSE file for details.
+ **************************************************************************/
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"reflect"
+	"sort"
+	"time"
+
+	"github.com/gravwell/gravwell/v3/client/types"
+	"github.com/gravwell/gravwell/v3/client/types/kits"
+)
+
+const (
+	changeAdded    = "added"
+	changeRemoved  = "removed"
+	changeModified = "modified"
+
+	maxDiffValue = 80
+)
+
+type itemKey struct {
+	Type kits.ItemType
+	Name string
+}
+
+// kitSide is one side of a diff, either a kit file or an unpacked kit directory.
+type kitSide struct {
+	mf    kits.Manifest
+	items map[itemKey]interface{}
+	dir   string
+}
+
+// jsonChange is a single changed value within an item.
+type jsonChange struct {
+	Path string
+	Old  interface{} `json:",omitempty"`
+	New  interface{} `json:",omitempty"`
+}
+
+type itemChange struct {
+	Type    string
+	Name    string
+	Change  string
+	Changes []jsonChange `json:",omitempty"`
+}
+
+// diffReport is the result of comparing two kits, it is emitted as JSON with the -json flag.
+type diffReport struct {
+	ID               string
+	OldVersion       uint
+	NewVersion       uint
+	SuggestedVersion uint
+	Manifest         []jsonChange
+	Items            []itemChange
+}
+
+func (d *diffReport) changed() bool {
+	return len(d.Manifest) > 0 || len(d.Items) > 0
+}
+
+// the "diff" command compares two versions of a kit, the new version may be an unpacked kit
+// directory. With -apply the suggested version and a changelog entry are written to the
+// new kit's MANIFEST.
+func diffKit(args []string) {
+	if len(args) != 2 {
+		fmt.Printf("Usage: kitctl [-json] [-apply] diff <old kitfile> <new kitfile|dir>\n")
+		return
+	}
+	old, err := loadKitSide(args[0])
+	if err != nil {
+		log.Fatal(err)
+	}
+	nw, err := loadKitSide(args[1])
+	if err != nil {
+		log.Fatal(err)
+	}
+	d := diffKits(old, nw)
+	if *fJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "	")
+		err = enc.Encode(d)
+	} else {
+		err = d.write(os.Stdout)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	if *fApply {
+		if nw.dir == "" {
+			log.Fatalf("-apply requires the new kit to be an unpacked directory")
+		} else if !d.changed() {
+			log.Printf("No changes to apply")
+			return
+		}
+		mf := nw.mf
+		mf.Version = d.SuggestedVersion
+		addChangelog(&mf, d.changelog(time.Now()))
+		if err := writeManifestDir(nw.dir, mf); err != nil {
+			log.Fatal(err)
+		}
+		log.Printf("Set version %d and updated changelog in %v", mf.Version, nw.dir)
+	}
+}
+
+// loadKitSide reads every item of a kit file or unpacked kit directory
+func loadKitSide(p string) (ks kitSide, err error) {
+	var fi os.FileInfo
+	if fi, err = os.Stat(p); err != nil {
+		return
+	}
+	ks.items = map[itemKey]interface{}{}
+	if fi.IsDir() {
+		ks.dir = p
+		if ks.mf, err = readManifestDir(p); err != nil {
+			return
+		}
+		for _, itm := range ks.mf.Items {
+			var obj interface{}
+			var bts []byte
+			if obj, err = readItem(p, itm); err != nil {
+				return
+			} else if b, ok := obj.([]byte); ok {
+				bts = b
+			} else if bts, err = json.Marshal(obj); err != nil {
+				return
+			}
+			if ks.items[itemKey{itm.Type, itm.Name}], err = normalizeItem(itm.Type, bts); err != nil {
+				err = fmt.Errorf("Could not decode %v %v: %v", itm.Type.String(), itm.Name, err)
+				return
+			}
+		}
+		return
+	}
+
+	var rdr *kits.Reader
+	if rdr, err = openKit(p); err != nil {
+		return
+	} else if ks.mf, err = rdr.Manifest(); err != nil {
+		return
+	}
+	err = rdr.Process(func(name string, tp kits.ItemType, hash [sha256.Size]byte, r io.Reader) error {
+		bts, err := ioutil.ReadAll(r)
+		if err != nil {
+			return err
+		}
+		if ks.items[itemKey{tp, name}], err = normalizeItem(tp, bts); err != nil {
+			return fmt.Errorf("Could not decode %v %v: %v", tp.String(), name, err)
+		}
+		return nil
+	})
+	return
+}
+
+// normalizeItem decodes a packed item into its type and back out to generic JSON values
+// so items from kit files and directories compare the same way.
+func normalizeItem(tp kits.ItemType, bts []byte) (v interface{}, err error) {
+	var obj interface{}
+	switch tp {
+	case kits.Resource:
+		obj = &kits.PackedResource{}
+	case kits.Macro:
+		obj = &kits.PackedMacro{}
+	case kits.ScheduledSearch:
+		obj = &kits.PackedScheduledSearch{}
+	case kits.Dashboard:
+		obj = &kits.PackedDashboard{}
+	case kits.Template:
+		obj = &types.PackedUserTemplate{}
+	case kits.Pivot:
+		obj = &types.PackedPivot{}
+	case kits.Extractor:
+		obj = &types.AXDefinition{}
+	case kits.File:
+		obj = &types.UserFile{}
+	case kits.SearchLibrary:
+		obj = &types.WireSearchLibrary{}
+	case kits.Playbook:
+		obj = &types.Playbook{}
+	case kits.Alert:
+		obj = &types.AlertDefinition{}
+	case kits.License:
+		return string(bts), nil
+	default:
+		return nil, fmt.Errorf("unknown item type %v", tp)
+	}
+	if err = json.Unmarshal(bts, obj); err != nil {
+		return
+	} else if bts, err = json.Marshal(obj); err != nil {
+		return
+	}
+	err = json.Unmarshal(bts, &v)
+	return
+}
+
+// structuralDiff reports if modified items of the given type list their individual changes
+func structuralDiff(tp kits.ItemType) bool {
+	return tp == kits.Dashboard || tp == kits.Template || tp == kits.ScheduledSearch
+}
+
+func diffKits(old, nw kitSide) (d diffReport) {
+	d.ID = nw.mf.ID
+	d.OldVersion, d.NewVersion = old.mf.Version, nw.mf.Version
+	d.Manifest = []jsonChange{}
+	d.Items = []itemChange{}
+
+	// compare everything in the manifest except the items and the version history
+	strip := func(mf kits.Manifest) (v interface{}) {
+		mf.Items, mf.Version, mf.Changelog = nil, 0, nil
+		if b, err := json.Marshal(mf); err == nil {
+			json.Unmarshal(b, &v)
+		}
+		return
+	}
+	jsonDiff("", strip(old.mf), strip(nw.mf), &d.Manifest)
+
+	keys := make([]itemKey, 0, len(old.items)+len(nw.items))
+	for k := range old.items {
+		keys = append(keys, k)
+	}
+	for k := range nw.items {
+		if _, ok := old.items[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].Type != keys[j].Type {
+			return keys[i].Type < keys[j].Type
+		}
+		return keys[i].Name < keys[j].Name
+	})
+	for _, k := range keys {
+		a, inOld := old.items[k]
+		b, inNew := nw.items[k]
+		ic := itemChange{Type: k.Type.String(), Name: k.Name}
+		if !inOld {
+			ic.Change = changeAdded
+		} else if !inNew {
+			ic.Change = changeRemoved
+		} else if !reflect.DeepEqual(a, b) {
+			ic.Change = changeModified
+			if structuralDiff(k.Type) {
+				jsonDiff("", a, b, &ic.Changes)
+			}
+		} else {
+			continue
+		}
+		d.Items = append(d.Items, ic)
+	}
+
+	// any change requires a newer kit version
+	d.SuggestedVersion = d.NewVersion
+	if d.changed() && d.NewVersion <= d.OldVersion {
+		d.SuggestedVersion = d.OldVersion + 1
+	}
+	return
+}
+
+// jsonDiff appends the paths which differ between two decoded JSON values
+func jsonDiff(path string, a, b interface{}, out *[]jsonChange) {
+	switch x := a.(type) {
+	case map[string]interface{}:
+		if y, ok := b.(map[string]interface{}); ok {
+			keys := make([]string, 0, len(x)+len(y))
+			for k := range x {
+				keys = append(keys, k)
+			}
+			for k := range y {
+				if _, ok := x[k]; !ok {
+					keys = append(keys, k)
+				}
+			}
+			sort.Strings(keys)
+			for _, k := range keys {
+				p := k
+				if path != "" {
+					p = path + "." + k
+				}
+				jsonDiff(p, x[k], y[k], out)
+			}
+			return
+		}
+	case []interface{}:
+		if y, ok := b.([]interface{}); ok {
+			for i := 0; i < len(x) || i < len(y); i++ {
+				p := fmt.Sprintf("%s[%d]", path, i)
+				if i >= len(x) {
+					*out = append(*out, jsonChange{Path: p, New: y[i]})
+				} else if i >= len(y) {
+					*out = append(*out, jsonChange{Path: p, Old: x[i]})
+				} else {
+					jsonDiff(p, x[i], y[i], out)
+				}
+			}
+			return
+		}
+	}
+	if !reflect.DeepEqual(a, b) {
+		*out = append(*out, jsonChange{Path: path, Old: a, New: b})
+	}
+}
+
+func diffValue(v interface{}) string {
+	if v == nil {
+		return "<none>"
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprintf("%v", v)
+	}
+	if s := string(b); len(s) > maxDiffValue {
+		return s[:maxDiffValue] + "..."
+	}
+	return string(b)
+}
+
+func (d *diffReport) write(w io.Writer) error {
+	fmt.Fprintf(w, "%v: version %d -> %d\n", d.ID, d.OldVersion, d.NewVersion)
+	if len(d.Manifest) > 0 {
+		fmt.Fprintf(w, "manifest\n")
+		for _, c := range d.Manifest {
+			fmt.Fprintf(w, "	%v: %v -> %v\n", c.Path, diffValue(c.Old), diffValue(c.New))
+		}
+	}
+	var last string
+	for _, ic := range d.Items {
+		if ic.Type != last {
+			fmt.Fprintf(w, "%v\n", ic.Type)
+			last = ic.Type
+		}
+		var mark string
+		switch ic.Change {
+		case changeAdded:
+			mark = "+"
+		case changeRemoved:
+			mark = "-"
+		default:
+			mark = "~"
+		}
+		fmt.Fprintf(w, "	%v %v\n", mark, ic.Name)
+		for _, c := range ic.Changes {
+			fmt.Fprintf(w, "		%v: %v -> %v\n", c.Path, diffValue(c.Old), diffValue(c.New))
+		}
+	}
+	var err error
+	if !d.changed() {
+		_, err = fmt.Fprintf(w, "no changes\n")
+	} else if d.SuggestedVersion != d.NewVersion {
+		_, err = fmt.Fprintf(w, "version %d is not newer than %d, suggest version %d\n", d.NewVersion, d.OldVersion, d.SuggestedVersion)
+	}
+	return err
+}
+
+// changelog builds a changelog entry for the suggested version
+func (d *diffReport) changelog(now time.Time) (ce kits.ChangelogEntry) {
+	ce.Version = d.SuggestedVersion
+	ce.Date = now.UTC().Truncate(time.Second)
+	if len(d.Manifest) > 0 {
+		ce.Modified = append(ce.Modified, "manifest")
+	}
+	for _, ic := range d.Items {
+		label := ic.Type + " " + ic.Name
+		switch ic.Change {
+		case changeAdded:
+			ce.Added = append(ce.Added, label)
+		case changeRemoved:
+			ce.Removed = append(ce.Removed, label)
+		default:
+			ce.Modified = append(ce.Modified, label)
+		}
+	}
+	return
+}
+
+// addChangelog adds an entry to the manifest changelog, replacing any entry for the same version
+func addChangelog(mf *kits.Manifest, ce kits.ChangelogEntry) {
+	for i := range mf.Changelog {
+		if mf.Changelog[i].Version == ce.Version {
+			mf.Changelog[i] = ce
+			return
+		}
+	}
+	mf.Changelog = append(mf.Changelog, ce)
+}
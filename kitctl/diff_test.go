@@ -0,0 +1,95 @@
+/*************************************************************************
+ * Copyright 2024 Gravwell, Inc. All rights reserved.
+ * Contact: <legal@gravwell.io>
+ *
+ * This software may be modified and distributed under the terms of the
+ * BSD 2-clause license. See the LICENSE file for details.
+ **************************************************************************/
+
+package main
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/gravwell/gravwell/v3/client/types/kits"
+)
+
+func TestDiffKits(t *testing.T) {
+	dash := func(q string) interface{} {
+		v, err := normalizeItem(kits.Dashboard, []byte(`{"Name":"d","Data":{"searches":[{"query":"`+q+`"}]}}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return v
+	}
+	old := kitSide{
+		mf: kits.Manifest{ID: `io.test`, Version: 3, Desc: `old`},
+		items: map[itemKey]interface{}{
+			{kits.Dashboard, `d`}:   dash(`tag=a`),
+			{kits.Macro, `GONE`}:    map[string]interface{}{},
+			{kits.License, `BSD-2`}: `license`,
+		},
+	}
+	nw := kitSide{
+		mf: kits.Manifest{ID: `io.test`, Version: 3, Desc: `new`},
+		items: map[itemKey]interface{}{
+			{kits.Dashboard, `d`}:   dash(`tag=b`),
+			{kits.Macro, `NEW`}:     map[string]interface{}{},
+			{kits.License, `BSD-2`}: `license`,
+		},
+	}
+	d := diffKits(old, nw)
+	if d.SuggestedVersion != 4 {
+		t.Fatalf("bad suggested version %d", d.SuggestedVersion)
+	} else if len(d.Manifest) != 1 || d.Manifest[0].Path != `Desc` {
+		t.Fatalf("bad manifest changes %+v", d.Manifest)
+	} else if len(d.Items) != 3 {
+		t.Fatalf("bad item changes %+v", d.Items)
+	}
+	if ic := d.Items[0]; ic.Change != changeModified || len(ic.Changes) != 1 || ic.Changes[0].Path != `Data.searches[0].query` {
+		t.Fatalf("bad dashboard change %+v", ic)
+	}
+	if d.Items[1].Name != `GONE` || d.Items[1].Change != changeRemoved || d.Items[2].Name != `NEW` || d.Items[2].Change != changeAdded {
+		t.Fatalf("bad macro changes %+v", d.Items[1:])
+	}
+
+	// applying twice for the same version replaces the entry
+	mf := nw.mf
+	addChangelog(&mf, d.changelog(time.Now()))
+	addChangelog(&mf, d.changelog(time.Now()))
+	if len(mf.Changelog) != 1 {
+		t.Fatalf("bad changelog %+v", mf.Changelog)
+	}
+	ce := mf.Changelog[0]
+	if ce.Version != 4 || len(ce.Added) != 1 || len(ce.Removed) != 1 || len(ce.Modified) != 2 {
+		t.Fatalf("bad changelog entry %+v", ce)
+	}
+
+	// a kit which was already bumped keeps its version
+	nw.mf.Version = 7
+	if d = diffKits(old, nw); d.SuggestedVersion != 7 {
+		t.Fatalf("bad suggested version %d", d.SuggestedVersion)
+	}
+	if d = diffKits(old, old); d.changed() || d.SuggestedVersion != 3 {
+		t.Fatalf("unchanged kit reported changes %+v", d)
+	}
+}
+
+func TestJSONDiff(t *testing.T) {
+	var a, b interface{}
+	json.Unmarshal([]byte(`{"x":1,"y":[1,2,3],"z":{"q":"a"}}`), &a)
+	json.Unmarshal([]byte(`{"x":1,"y":[1,5],"z":{"q":"a","r":true}}`), &b)
+	var out []jsonChange
+	jsonDiff("", a, b, &out)
+	want := []string{`y[1]`, `y[2]`, `z.r`}
+	if len(out) != len(want) {
+		t.Fatalf("bad changes %+v", out)
+	}
+	for i := range want {
+		if out[i].Path != want[i] {
+			t.Fatalf("bad change %d %+v", i, out[i])
+		}
+	}
+}
@@ -0,0 +1,549 @@
+/*************************************************************************
+ * Copyright 2024 Gravwell, Inc. All rights reserved.
+ * Contact: <legal@gravwell.io>
+ *
+ * This software may be modified and distributed under the terms of the
+ * BSD 2-clause license. See the LICENSE file for details.
+ **************************************************************************/
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gravwell/gravwell/v3/client/types"
+	"github.com/gravwell/gravwell/v3/client/types/kits"
+
+	"github.com/google/uuid"
+)
+
+const (
+	lintError   = "error"
+	lintWarning = "warning"
+)
+
+var (
+	// every item type which is unpacked into its own directory
+	lintItemTypes = []kits.ItemType{
+		kits.Resource, kits.ScheduledSearch, kits.Dashboard, kits.Extractor,
+		kits.Pivot, kits.Template, kits.File, kits.Macro, kits.SearchLibrary,
+		kits.License, kits.Playbook, kits.Alert,
+	}
+
+	macroRef = regexp.MustCompile(`\$([A-Z][A-Z0-9_-]*)`)
+
+	cronDescriptors = map[string]bool{
+		"@yearly": true, "@annually": true, "@monthly": true, "@weekly": true,
+		"@daily": true, "@midnight": true, "@hourly": true,
+	}
+)
+
+// lintFinding is a single problem found in the kit.
+type lintFinding struct {
+	Severity string
+	Check    string
+	Item     string `json:",omitempty"`
+	Message  string
+}
+
+// lintReport is the result of linting a kit, it is emitted as JSON with the -json flag.
+type lintReport struct {
+	ID       string
+	Version  uint
+	Errors   int
+	Warnings int
+	Findings []lintFinding
+}
+
+func (r *lintReport) add(sev, check, item, format string, args ...interface{}) {
+	r.Findings = append(r.Findings, lintFinding{
+		Severity: sev,
+		Check:    check,
+		Item:     item,
+		Message:  fmt.Sprintf(format, args...),
+	})
+	if sev == lintError {
+		r.Errors++
+	} else {
+		r.Warnings++
+	}
+}
+
+func (r *lintReport) write(w io.Writer, asJSON bool) error {
+	if asJSON {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "	")
+		return enc.Encode(r)
+	}
+	for _, f := range r.Findings {
+		if f.Item != "" {
+			fmt.Fprintf(w, "%s [%s] %s: %s\n", f.Severity, f.Check, f.Item, f.Message)
+		} else {
+			fmt.Fprintf(w, "%s [%s] %s\n", f.Severity, f.Check, f.Message)
+		}
+	}
+	_, err := fmt.Fprintf(w, "%d errors, %d warnings\n", r.Errors, r.Warnings)
+	return err
+}
+
+// the "lint" command checks the unpacked kit in the current directory without packing it.
+// It exits with a non-zero status if any errors are found, warnings do not fail the lint.
+func lintKit(args []string) {
+	wd, err := os.Getwd()
+	if err != nil {
+		log.Fatalf("Couldn't figure out working directory: %v", err)
+	}
+	mf, err := readManifest()
+	if err != nil {
+		log.Fatal(err)
+	}
+	var target types.CanonicalVersion
+	if *fGravwellVersion != "" {
+		if target, err = types.ParseCanonicalVersion(*fGravwellVersion); err != nil {
+			log.Fatalf("Invalid -gravwell-version %q: %v", *fGravwellVersion, err)
+		}
+	}
+
+	var deps map[string]kits.Manifest
+	if *fDeps != "" {
+		if deps, err = loadDependencies(*fDeps); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	r := lint(wd, mf, target, deps)
+	if err := r.write(os.Stdout, *fJSON); err != nil {
+		log.Fatal(err)
+	}
+	if r.Errors > 0 {
+		os.Exit(1)
+	}
+}
+
+// loadDependencies reads the manifest of every kit in dir, keyed by kit ID. Entries
+// may be kit files or unpacked kit directories, anything else is skipped.
+func loadDependencies(dir string) (map[string]kits.Manifest, error) {
+	ents, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("Couldn't read dependency directory: %v", err)
+	}
+	deps := map[string]kits.Manifest{}
+	for _, ent := range ents {
+		p := filepath.Join(dir, ent.Name())
+		var mf kits.Manifest
+		if ent.IsDir() {
+			if mf, err = readManifestDir(p); err != nil {
+				log.Printf("Skipping %v: %v", p, err)
+				continue
+			}
+		} else {
+			rdr, err := openKit(p)
+			if err != nil {
+				log.Printf("Skipping %v: %v", p, err)
+				continue
+			}
+			if mf, err = rdr.Manifest(); err != nil {
+				return nil, fmt.Errorf("Couldn't read manifest of %v: %v", p, err)
+			}
+		}
+		if cur, ok := deps[mf.ID]; !ok || mf.Version > cur.Version {
+			deps[mf.ID] = mf
+		}
+	}
+	return deps, nil
+}
+
+// lint runs every check against the kit in wd and returns the findings. Dependency
+// versions are only checked if deps is not nil.
+func lint(wd string, mf kits.Manifest, target types.CanonicalVersion, deps map[string]kits.Manifest) (r lintReport) {
+	r.ID, r.Version = mf.ID, mf.Version
+	r.Findings = []lintFinding{}
+	lintManifest(&r, mf, target, deps)
+	objs := lintItems(&r, wd, mf)
+	lintContents(&r, mf, objs)
+	return
+}
+
+func itemLabel(itm kits.Item) string {
+	return fmt.Sprintf("%v %v", itm.Type.String(), itm.Name)
+}
+
+func lintManifest(r *lintReport, mf kits.Manifest, target types.CanonicalVersion, deps map[string]kits.Manifest) {
+	if mf.ID == "" {
+		r.add(lintError, "manifest", "", "kit ID is not set")
+	}
+	if mf.Name == "" {
+		r.add(lintError, "manifest", "", "kit name is not set")
+	}
+
+	// version bounds, a kit must be installable on its own minimum version
+	if mf.MinVersion.Enabled() && mf.MaxVersion.Enabled() {
+		if err := mf.CompatibleVersion(mf.MinVersion); err != nil {
+			r.add(lintError, "version", "", "maximum version %v is below minimum version %v", mf.MaxVersion, mf.MinVersion)
+		}
+	}
+	if target.Enabled() {
+		if err := mf.CompatibleVersion(target); err != nil {
+			r.add(lintError, "version", "", "not compatible with Gravwell %v: %v", target, err)
+		}
+	}
+
+	// dependencies
+	seen := map[string]bool{}
+	for _, d := range mf.Dependencies {
+		if d.ID == "" {
+			r.add(lintError, "dependency", "", "dependency has an empty kit ID")
+			continue
+		} else if d.ID == mf.ID {
+			r.add(lintError, "dependency", d.ID, "kit depends on itself")
+		} else if seen[d.ID] {
+			r.add(lintError, "dependency", d.ID, "duplicate dependency")
+		}
+		if d.MinVersion == 0 {
+			r.add(lintWarning, "dependency", d.ID, "no minimum kit version")
+		}
+		seen[d.ID] = true
+		if deps != nil {
+			lintDependency(r, mf, d, deps, target)
+		}
+	}
+
+	// config macro definitions
+	cms := map[string]bool{}
+	for _, cm := range mf.ConfigMacros {
+		if cm.MacroName == "" {
+			r.add(lintError, "configmacro", "", "config macro has an empty name")
+			continue
+		} else if err := types.CheckMacroName(cm.MacroName); err != nil {
+			r.add(lintError, "configmacro", cm.MacroName, "%v", err)
+		}
+		if cms[cm.MacroName] {
+			r.add(lintError, "configmacro", cm.MacroName, "duplicate config macro")
+		}
+		if t := strings.ToUpper(cm.Type); t != "TAG" && t != "OTHER" {
+			r.add(lintError, "configmacro", cm.MacroName, "invalid type %q, must be TAG or OTHER", cm.Type)
+		}
+		cms[cm.MacroName] = true
+	}
+}
+
+// lintDependency checks that an available version of the dependency satisfies the
+// minimum kit version and installs on every Gravwell version the kit itself targets.
+func lintDependency(r *lintReport, mf kits.Manifest, d types.KitDependency, deps map[string]kits.Manifest, target types.CanonicalVersion) {
+	dm, ok := deps[d.ID]
+	if !ok {
+		r.add(lintWarning, "dependency", d.ID, "not found in the dependency directory, versions were not checked")
+		return
+	}
+	if dm.Version < d.MinVersion {
+		r.add(lintError, "dependency", d.ID, "requires version %d but only version %d is available", d.MinVersion, dm.Version)
+	}
+	for _, v := range []struct {
+		name string
+		ver  types.CanonicalVersion
+	}{{"minimum", mf.MinVersion}, {"maximum", mf.MaxVersion}, {"target", target}} {
+		if !v.ver.Enabled() {
+			continue
+		}
+		if err := dm.CompatibleVersion(v.ver); err != nil {
+			r.add(lintError, "dependency", d.ID, "version %d does not install on the %v Gravwell version %v: %v", dm.Version, v.name, v.ver, err)
+		}
+	}
+}
+
+// lintItems checks that every item in the manifest can be read and that every item
+// on disk is in the manifest. It returns the items which were read.
+func lintItems(r *lintReport, wd string, mf kits.Manifest) map[kits.Item]interface{} {
+	objs := make(map[kits.Item]interface{}, len(mf.Items))
+	seen := map[kits.ItemType]map[string]bool{}
+	for _, itm := range mf.Items {
+		if seen[itm.Type] == nil {
+			seen[itm.Type] = map[string]bool{}
+		}
+		if seen[itm.Type][itm.Name] {
+			r.add(lintError, "item", itemLabel(itm), "listed in the manifest more than once")
+			continue
+		}
+		seen[itm.Type][itm.Name] = true
+		obj, err := readItem(wd, itm)
+		if err != nil {
+			r.add(lintError, "item", itemLabel(itm), "%v", err)
+			continue
+		}
+		objs[itm] = obj
+	}
+
+	for _, tp := range lintItemTypes {
+		ents, err := os.ReadDir(filepath.Join(wd, itemDir(tp)))
+		if err != nil {
+			continue
+		}
+		for _, ent := range ents {
+			if ent.IsDir() {
+				continue
+			}
+			nm := strings.TrimSuffix(ent.Name(), filepath.Ext(ent.Name()))
+			if !seen[tp][nm] {
+				r.add(lintWarning, "item", filepath.Join(itemDir(tp), ent.Name()), "file is not referenced by the manifest and will not be packed")
+			}
+		}
+	}
+
+	for _, v := range []struct{ name, id string }{{"icon", mf.Icon}, {"cover", mf.Cover}, {"banner", mf.Banner}} {
+		if v.id != "" && !seen[kits.File][v.id] {
+			r.add(lintError, "item", "", "%v file %v is not in the kit", v.name, v.id)
+		}
+	}
+	return objs
+}
+
+// kitContents indexes the objects in a kit which other items may reference.
+type kitContents struct {
+	macros    map[string]bool
+	guids     map[string][]string
+	templates map[string]bool
+	pivots    map[string]bool
+	library   map[string]bool
+	scheduled map[string]bool
+}
+
+func (kc *kitContents) addGUID(id, label string, set map[string]bool) {
+	if id == "" || id == uuid.Nil.String() {
+		return
+	}
+	id = strings.ToLower(id)
+	kc.guids[id] = append(kc.guids[id], label)
+	if set != nil {
+		set[id] = true
+	}
+}
+
+func lintContents(r *lintReport, mf kits.Manifest, objs map[kits.Item]interface{}) {
+	kc := kitContents{
+		macros:    map[string]bool{},
+		guids:     map[string][]string{},
+		templates: map[string]bool{},
+		pivots:    map[string]bool{},
+		library:   map[string]bool{},
+		scheduled: map[string]bool{},
+	}
+	for _, cm := range mf.ConfigMacros {
+		kc.macros[cm.MacroName] = true
+	}
+
+	// walk items in manifest order so findings are stable
+	items := make([]kits.Item, 0, len(objs))
+	added := make(map[kits.Item]bool, len(objs))
+	for _, itm := range mf.Items {
+		if _, ok := objs[itm]; ok && !added[itm] {
+			items = append(items, itm)
+			added[itm] = true
+		}
+	}
+	for _, itm := range items {
+		label := itemLabel(itm)
+		switch x := objs[itm].(type) {
+		case kits.PackedMacro:
+			kc.macros[x.Name] = true
+		case kits.PackedScheduledSearch:
+			kc.addGUID(x.GUID.String(), label, kc.scheduled)
+		case kits.PackedDashboard:
+			kc.addGUID(x.UUID, label, nil)
+		case types.PackedUserTemplate:
+			kc.addGUID(x.UUID, label, kc.templates)
+		case types.PackedPivot:
+			kc.addGUID(x.UUID, label, kc.pivots)
+		case types.AXDefinition:
+			kc.addGUID(x.UUID.String(), label, nil)
+		case types.UserFile:
+			kc.addGUID(x.GUID.String(), label, nil)
+		case types.WireSearchLibrary:
+			kc.addGUID(x.GUID.String(), label, kc.library)
+		case types.Playbook:
+			kc.addGUID(x.GUID.String(), label, nil)
+		case types.AlertDefinition:
+			kc.addGUID(x.GUID.String(), label, nil)
+		}
+	}
+
+	ids := make([]string, 0, len(kc.guids))
+	for id, labels := range kc.guids {
+		if len(labels) > 1 {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		r.add(lintError, "guid", "", "GUID %v is shared by %v", id, strings.Join(kc.guids[id], ", "))
+	}
+
+	// macros may come from a dependency, so undefined macros only fail kits without any
+	undefined := lintError
+	if len(mf.Dependencies) > 0 {
+		undefined = lintWarning
+	}
+	checkMacros := func(label, query string) {
+		for _, m := range macroRef.FindAllStringSubmatch(query, -1) {
+			if !kc.macros[m[1]] {
+				r.add(undefined, "macro", label, "macro $%v is used but not defined in the kit", m[1])
+			}
+		}
+	}
+
+	for _, itm := range items {
+		label := itemLabel(itm)
+		switch x := objs[itm].(type) {
+		case kits.PackedMacro:
+			checkMacros(label, x.Expansion)
+		case kits.PackedScheduledSearch:
+			if err := x.Validate(); err != nil {
+				r.add(lintError, "schedule", label, "%v", err)
+			}
+			if x.Schedule != "" {
+				if err := checkCronSchedule(x.Schedule); err != nil {
+					r.add(lintError, "schedule", label, "invalid schedule %q: %v", x.Schedule, err)
+				}
+			}
+			checkMacros(label, x.SearchString)
+		case types.PackedUserTemplate:
+			checkMacros(label, x.Data.Query)
+		case types.WireSearchLibrary:
+			checkMacros(label, x.Query)
+		case kits.PackedDashboard:
+			var data interface{}
+			if err := json.Unmarshal(x.Data, &data); err != nil {
+				r.add(lintError, "reference", label, "invalid dashboard data: %v", err)
+				continue
+			}
+			lintDashboard(r, label, data, &kc, checkMacros)
+		}
+	}
+}
+
+// lintDashboard walks the dashboard definition checking the queries it runs and the
+// templates, saved queries, scheduled searches, and pivots it references.
+func lintDashboard(r *lintReport, label string, v interface{}, kc *kitContents, checkMacros func(string, string)) {
+	switch x := v.(type) {
+	case map[string]interface{}:
+		if q, ok := x["query"].(string); ok {
+			checkMacros(label, q)
+		}
+		if ref, ok := x["reference"].(map[string]interface{}); ok {
+			id, _ := ref["id"].(string)
+			tp, _ := ref["type"].(string)
+			var set map[string]bool
+			switch tp {
+			case "template":
+				set = kc.templates
+			case "savedQuery":
+				set = kc.library
+			case "scheduledSearch":
+				set = kc.scheduled
+			case "pivot", "actionable":
+				set = kc.pivots
+			}
+			if set != nil && id != "" && !set[strings.ToLower(id)] {
+				r.add(lintError, "reference", label, "references %v %v which is not in the kit", tp, id)
+			}
+		}
+		for _, vv := range x {
+			lintDashboard(r, label, vv, kc, checkMacros)
+		}
+	case []interface{}:
+		for _, vv := range x {
+			lintDashboard(r, label, vv, kc, checkMacros)
+		}
+	}
+}
+
+var cronFields = []struct {
+	name     string
+	min, max int
+	names    []string
+}{
+	{name: "minute", min: 0, max: 59},
+	{name: "hour", min: 0, max: 23},
+	{name: "day of month", min: 1, max: 31},
+	{name: "month", min: 1, max: 12, names: []string{"JAN", "FEB", "MAR", "APR", "MAY", "JUN", "JUL", "AUG", "SEP", "OCT", "NOV", "DEC"}},
+	{name: "day of week", min: 0, max: 7, names: []string{"SUN", "MON", "TUE", "WED", "THU", "FRI", "SAT"}},
+}
+
+// checkCronSchedule validates a standard five field cron schedule, or one of the
+// @hourly style descriptors.
+func checkCronSchedule(s string) error {
+	s = strings.TrimSpace(s)
+	if strings.HasPrefix(s, "@") {
+		if cronDescriptors[strings.ToLower(s)] {
+			return nil
+		}
+		return fmt.Errorf("unknown descriptor %v", s)
+	}
+	flds := strings.Fields(s)
+	if len(flds) != len(cronFields) {
+		return fmt.Errorf("expected %d fields, got %d", len(cronFields), len(flds))
+	}
+	for i, fld := range flds {
+		for _, term := range strings.Split(fld, ",") {
+			if err := checkCronTerm(term, i); err != nil {
+				return fmt.Errorf("%v field: %v", cronFields[i].name, err)
+			}
+		}
+	}
+	return nil
+}
+
+func checkCronTerm(term string, idx int) (err error) {
+	cf := cronFields[idx]
+	rng := term
+	if i := strings.Index(term, "/"); i >= 0 {
+		var step int
+		rng = term[:i]
+		if step, err = strconv.Atoi(term[i+1:]); err != nil || step <= 0 {
+			return fmt.Errorf("invalid step in %q", term)
+		}
+	}
+	if rng == "*" {
+		return nil
+	}
+	lo, hi := rng, rng
+	if i := strings.Index(rng, "-"); i >= 0 {
+		lo, hi = rng[:i], rng[i+1:]
+	}
+	var l, h int
+	if l, err = cronValue(lo, cf.min, cf.max, cf.names); err != nil {
+		return
+	} else if h, err = cronValue(hi, cf.min, cf.max, cf.names); err != nil {
+		return
+	} else if l > h {
+		return fmt.Errorf("range %q is backwards", rng)
+	}
+	return nil
+}
+
+func cronValue(s string, min, max int, names []string) (int, error) {
+	if s == "" {
+		return 0, errors.New("empty value")
+	}
+	for i, n := range names {
+		if strings.EqualFold(s, n) {
+			return i + min, nil
+		}
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid value %q", s)
+	} else if v < min || v > max {
+		return 0, fmt.Errorf("value %d out of range %d-%d", v, min, max)
+	}
+	return v, nil
+}
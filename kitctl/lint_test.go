@@ -0,0 +1,226 @@
+/*************************************************************************
+ * Copyright 2024 Gravwell, Inc. All rights reserved.
+ * Contact: <legal@gravwell.io>
+ *
+ * This software may be modified and distributed under the terms of the
+ * BSD 2-clause license. See the LICENSE file for details.
+ **************************************************************************/
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gravwell/gravwell/v3/client/types"
+	"github.com/gravwell/gravwell/v3/client/types/kits"
+)
+
+const (
+	lintGUIDShared    = `9a1c6a4e-0000-4000-8000-000000000001`
+	lintGUIDDashboard = `9a1c6a4e-0000-4000-8000-000000000002`
+	lintGUIDNoTmpl    = `9a1c6a4e-0000-4000-8000-000000000003`
+	lintGUIDNoPivot   = `9a1c6a4e-0000-4000-8000-000000000004`
+)
+
+// newLintFixture unpacks a kit with known problems into a temporary directory
+func newLintFixture(t *testing.T) (string, kits.Manifest) {
+	t.Helper()
+	dir := t.TempDir()
+	mf := kits.Manifest{
+		ID:      `io.gravwell.linttest`,
+		Name:    `Lint Test`,
+		Version: 2,
+		Items: []kits.Item{
+			{Name: `GOOD`, Type: kits.Macro},
+			{Name: `BAD`, Type: kits.Macro},
+			{Name: `tmpl`, Type: kits.Template},
+			{Name: `pivot`, Type: kits.Pivot},
+			{Name: `dash`, Type: kits.Dashboard},
+			{Name: `ghost`, Type: kits.Macro},
+		},
+	}
+	dash := `{"tiles":[
+		{"query":"tag=foo $GOOD","reference":{"id":"` + lintGUIDShared + `","type":"template"}},
+		{"reference":{"id":"` + lintGUIDNoTmpl + `","type":"template"}},
+		{"reference":{"id":"` + lintGUIDNoPivot + `","type":"pivot"}}
+	]}`
+	errs := []error{
+		writeManifestDir(dir, mf),
+		writeMacro(dir, kits.PackedMacro{Name: `GOOD`, Expansion: `tag=foo`}),
+		writeMacro(dir, kits.PackedMacro{Name: `BAD`, Expansion: `$GOOD $UNDEFINED`}),
+		writeTemplate(dir, `tmpl`, types.PackedUserTemplate{UUID: lintGUIDShared, Name: `tmpl`, Data: types.TemplateContents{Query: `tag=foo`}}),
+		genericWrite(dir, kits.Pivot, `pivot`, types.PackedPivot{UUID: lintGUIDShared, Name: `pivot`, Data: types.RawObject(`{}`)}),
+		writeDashboard(dir, `dash`, kits.PackedDashboard{UUID: lintGUIDDashboard, Name: `dash`, Data: types.RawObject(dash)}),
+		// not in the manifest
+		genericWrite(dir, kits.Pivot, `stray`, types.PackedPivot{Name: `stray`, Data: types.RawObject(`{}`)}),
+	}
+	for _, err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir, mf
+}
+
+type lintExpect struct {
+	sev, check, item, msg string
+}
+
+// checkFindings requires that the report contains exactly the expected findings
+func checkFindings(t *testing.T, r lintReport, exp []lintExpect) {
+	t.Helper()
+	used := make([]bool, len(r.Findings))
+	for _, e := range exp {
+		found := false
+		for i, f := range r.Findings {
+			if !used[i] && f.Severity == e.sev && f.Check == e.check && f.Item == e.item && strings.Contains(f.Message, e.msg) {
+				used[i], found = true, true
+				break
+			}
+		}
+		if !found {
+			t.Errorf("missing %s [%s] %s: %s", e.sev, e.check, e.item, e.msg)
+		}
+	}
+	for i, f := range r.Findings {
+		if !used[i] {
+			t.Errorf("unexpected %s [%s] %s: %s", f.Severity, f.Check, f.Item, f.Message)
+		}
+	}
+	var errs, warns int
+	for _, e := range exp {
+		if e.sev == lintError {
+			errs++
+		} else {
+			warns++
+		}
+	}
+	if r.Errors != errs || r.Warnings != warns {
+		t.Errorf("got %d errors and %d warnings, expected %d and %d", r.Errors, r.Warnings, errs, warns)
+	}
+}
+
+func TestLint(t *testing.T) {
+	dir, mf := newLintFixture(t)
+	r := lint(dir, mf, types.CanonicalVersion{}, nil)
+	if r.ID != mf.ID || r.Version != mf.Version {
+		t.Fatalf("bad report header %v %v", r.ID, r.Version)
+	}
+	checkFindings(t, r, []lintExpect{
+		{lintError, "item", "macro ghost", "Could not read"},
+		{lintWarning, "item", "pivot/stray.meta", "not referenced by the manifest"},
+		{lintError, "guid", "", "template tmpl, pivot pivot"},
+		{lintError, "macro", "macro BAD", "$UNDEFINED"},
+		{lintError, "reference", "dashboard dash", "template " + lintGUIDNoTmpl},
+		{lintError, "reference", "dashboard dash", "pivot " + lintGUIDNoPivot},
+	})
+}
+
+func TestLintDependencies(t *testing.T) {
+	dir, mf := newLintFixture(t)
+	var err error
+	if mf.MinVersion, err = types.ParseCanonicalVersion(`5.2.0`); err != nil {
+		t.Fatal(err)
+	}
+	target, err := types.ParseCanonicalVersion(`5.4.0`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mf.Dependencies = []types.KitDependency{
+		{ID: `io.gravwell.ok`, MinVersion: 3},
+		{ID: `io.gravwell.old`, MinVersion: 5},
+		{ID: `io.gravwell.newer`, MinVersion: 1},
+		{ID: `io.gravwell.missing`, MinVersion: 1},
+	}
+	newer, _ := types.ParseCanonicalVersion(`5.3.0`)
+	deps := map[string]kits.Manifest{
+		`io.gravwell.ok`:    {ID: `io.gravwell.ok`, Version: 3},
+		`io.gravwell.old`:   {ID: `io.gravwell.old`, Version: 4},
+		`io.gravwell.newer`: {ID: `io.gravwell.newer`, Version: 1, MinVersion: newer},
+	}
+	r := lint(dir, mf, target, deps)
+	checkFindings(t, r, []lintExpect{
+		{lintError, "item", "macro ghost", "Could not read"},
+		{lintWarning, "item", "pivot/stray.meta", "not referenced by the manifest"},
+		{lintError, "guid", "", "template tmpl, pivot pivot"},
+		// the macro may come from a dependency
+		{lintWarning, "macro", "macro BAD", "$UNDEFINED"},
+		{lintError, "reference", "dashboard dash", "template " + lintGUIDNoTmpl},
+		{lintError, "reference", "dashboard dash", "pivot " + lintGUIDNoPivot},
+		{lintError, "dependency", "io.gravwell.old", "requires version 5"},
+		{lintError, "dependency", "io.gravwell.newer", "minimum Gravwell version"},
+		{lintWarning, "dependency", "io.gravwell.missing", "not found"},
+	})
+
+	// without a dependency directory versions are not checked
+	r = lint(dir, mf, target, nil)
+	for _, f := range r.Findings {
+		if f.Check == "dependency" {
+			t.Errorf("unexpected dependency finding without dependencies: %v", f.Message)
+		}
+	}
+}
+
+func TestCheckCronSchedule(t *testing.T) {
+	good := []string{
+		`* * * * *`,
+		`*/5 * * * *`,
+		`0 0 1 1 0`,
+		`0,15,30,45 8-17 * * MON-FRI`,
+		`30 2 1-15/2 jan,jul sun`,
+		`0 0 * * 7`,
+		`@hourly`,
+		`@Daily`,
+	}
+	bad := []string{
+		``,
+		`* * * *`,
+		`* * * * * *`,
+		`60 * * * *`,
+		`* 24 * * *`,
+		`* * 0 * *`,
+		`* * * 13 *`,
+		`* * * * 8`,
+		`*/0 * * * *`,
+		`5-1 * * * *`,
+		`1- * * * *`,
+		`* * * FOO *`,
+		`@every 5m`,
+	}
+	for _, s := range good {
+		if err := checkCronSchedule(s); err != nil {
+			t.Errorf("%q rejected: %v", s, err)
+		}
+	}
+	for _, s := range bad {
+		if err := checkCronSchedule(s); err == nil {
+			t.Errorf("%q accepted", s)
+		}
+	}
+}
+
+func TestLoadDependencies(t *testing.T) {
+	dir := t.TempDir()
+	for i, v := range []uint{3, 5, 4} {
+		p := filepath.Join(dir, fmt.Sprintf("dep%d", i))
+		if err := os.Mkdir(p, 0755); err != nil {
+			t.Fatal(err)
+		} else if err = writeManifestDir(p, kits.Manifest{ID: `io.gravwell.dep`, Version: v}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// not a kit, skipped
+	if err := os.WriteFile(filepath.Join(dir, `README`), []byte(`hello`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	deps, err := loadDependencies(dir)
+	if err != nil {
+		t.Fatal(err)
+	} else if len(deps) != 1 || deps[`io.gravwell.dep`].Version != 5 {
+		t.Fatalf("expected the newest dependency version, got %+v", deps)
+	}
+}
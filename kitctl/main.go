@@ -21,7 +21,6 @@ import (
 
 	"github.com/gravwell/gravwell/v3/client/types"
 	"github.com/gravwell/gravwell/v3/client/types/kits"
-	"github.com/gravwell/gravwell/v3/ingesters/utils"
 )
 
 var (
@@ -34,6 +33,25 @@ var (
 
 	fDefaultValue = flag.String("default-value", "", "Default value")
 	fMacroType    = flag.String("macro-type", "", "Config macro type ('tag' or 'other')")
+
+	fSignKey    = flag.String("sign-key", "", "Private key used to sign the kit when packing")
+	fPubKey     = flag.String("pub-key", "", "Public key used to verify kit signatures")
+	fTrustStore = flag.String("trust-store", "", "Directory of trusted public keys, kits must be signed by one of them")
+	fKeyType    = flag.String("key-type", kits.KeyTypeEd25519, "Signing key type for keygen ('ed25519' or 'rsa')")
+
+	fJSON            = flag.Bool("json", false, "Emit machine-readable JSON output")
+	fGravwellVersion = flag.String("gravwell-version", "", "Gravwell version the kit must be compatible with when linting")
+	fDeps            = flag.String("deps", "", "Directory of dependency kits to check dependency versions against when linting")
+	fApply           = flag.Bool("apply", false, "Write the suggested version and a changelog entry to the new kit's MANIFEST when diffing")
+
+	fServer        = flag.String("server", "", "Address and port of the Gravwell webserver for deploy, pull, and status")
+	fUser          = flag.String("user", "", "Webserver username, the password is read from GRAVWELL_PASSWORD or prompted")
+	fInsecure      = flag.Bool("insecure", false, "Do NOT enforce webserver certificates, TLS operates in insecure mode")
+	fNoHTTPS       = flag.Bool("insecure-no-https", false, "Use insecure HTTP connection, passwords are shipped plaintext")
+	fConfigMacros  = flag.String("config-macros", "", "JSON file of config macro values to use when deploying")
+	fOverwrite     = flag.Bool("overwrite", false, "Overwrite existing items when deploying")
+	fGlobal        = flag.Bool("global", false, "Install the kit globally when deploying")
+	fAllowUnsigned = flag.Bool("allow-unsigned", false, "Allow installing unsigned kits when deploying")
 )
 
 func main() {
@@ -58,6 +76,27 @@ func main() {
 	case "import":
 		// Merge in the contents of another kit file
 		importKit(args[1:])
+	case "verify":
+		// Check a kit file's signature
+		verifyKit(args[1:])
+	case "keygen":
+		// Generate a kit signing key pair
+		keygen(args[1:])
+	case "lint":
+		// Check the kit in the current directory for problems
+		lintKit(args[1:])
+	case "diff":
+		// Compare two versions of a kit
+		diffKit(args[1:])
+	case "deploy":
+		// Upload and install a kit on a webserver
+		deployKit(args[1:])
+	case "pull":
+		// Rebuild the installed kit on a webserver and unpack it here
+		pullKit(args[1:])
+	case "status":
+		// Compare the local kit with the installed kit
+		kitStatusCmd(args[1:])
 	case "info":
 		// Information about the kit in the current directory
 		kitInfo(args[1:])
@@ -83,11 +122,18 @@ func main() {
 
 func help(args []string) {
 	fmt.Printf("Usage: kitctl [flags] <cmd> [arguments]\n\n")
-	fmt.Println("kitctl provides tools for working with a Gravwell kit managed inside a git repository. It unpacks a kit archive file into discrete files which can be more easily modified. Once modifications are done, it can re-pack the contents into an archive file again.\n")
+	fmt.Printf("kitctl provides tools for working with a Gravwell kit managed inside a git repository. It unpacks a kit archive file into discrete files which can be more easily modified. Once modifications are done, it can re-pack the contents into an archive file again.\n\n")
 	fmt.Printf("Commands:\n")
 	fmt.Println("	unpack <input file>: unpack a kit into the current directory")
 	fmt.Println("	pack <output file>: pack the current directory into a kit file")
 	fmt.Println("	import <input file>: include the contents of another kit into the already-unpacked kit in the current directory")
+	fmt.Println("	verify <input file>: check that a kit is signed by -pub-key or a key in -trust-store")
+	fmt.Println("	keygen <key file>: generate a signing key, the public key is written to <key file>.pub")
+	fmt.Println("	lint: check the kit in the current directory for problems, exits non-zero on errors")
+	fmt.Println("	diff <old file> <new file|dir>: compare two versions of a kit and suggest a version bump")
+	fmt.Println("	deploy [input file]: upload and install a kit on -server, packing the current directory if no file is given")
+	fmt.Println("	pull: build the kit on -server from its installed items and unpack it into the current directory")
+	fmt.Println("	status: compare the kit in the current directory with the version installed on -server")
 	fmt.Println("	info: prints information about the kit in the current directory")
 	fmt.Println("	init: starts a new kit from scratch in the current directory")
 	fmt.Println("	dep list: list the current kit's dependencies")
@@ -357,8 +403,12 @@ func packKit(args []string) {
 		fmt.Printf("Usage: kitctl pack <outfile>\n")
 		return
 	}
+	packDir(wd, args[0])
+}
 
-	mf, err := readManifest()
+// packDir packs the unpacked kit in wd into a kit file at out
+func packDir(wd, out string) {
+	mf, err := readManifestDir(wd)
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -374,128 +424,30 @@ func packKit(args []string) {
 		MaxVersion:   mf.MaxVersion,
 		Dependencies: mf.Dependencies,
 		ConfigMacros: mf.ConfigMacros,
+		Changelog:    mf.Changelog,
 	}
 
 	// Get builder
-	bldr, err := kits.NewBuilderFile(bc, args[0])
+	bldr, err := kits.NewBuilderFile(bc, out)
 	if err != nil {
 		log.Fatalf("Could not get builder: %v", err)
 	}
 
-	marshallAdd := func(itm kits.Item, obj interface{}) error {
-		bts, err := json.Marshal(obj)
-		if err != nil {
-			return fmt.Errorf("Could not marshal %v %v: %v", itm.Type.String(), itm.Name, err)
-		}
-		if err := bldr.Add(itm.Name, itm.Type, bts); err != nil {
-			return fmt.Errorf("Couldn't add %v %v: %v", itm.Type.String(), itm.Name, err)
-		}
-		return nil
-	}
-
 	// Walk each kit item in the manifest and add it
 	for _, itm := range mf.Items {
-		switch itm.Type {
-		// Some types have special "packed" versions
-		case kits.Resource:
-			pr, err := readResource(wd, itm.Name)
-			if err != nil {
-				log.Fatalf("Could not read resource %v: %v", itm.Name, err)
-			}
-			if err := marshallAdd(itm, pr); err != nil {
-				log.Fatal(err)
-			}
-		case kits.Macro:
-			pm, err := readMacro(wd, itm.Name)
-			if err != nil {
-				log.Fatalf("Could not read macro %v: %v", itm.Name, err)
-			}
-			if err := marshallAdd(itm, pm); err != nil {
-				log.Fatal(err)
-			}
-		case kits.ScheduledSearch:
-			x, err := readScheduledSearch(wd, itm.Name)
-			if err != nil {
-				log.Fatalf("Could not read scheduled search %v: %v", itm.Name, err)
-			}
-			if err := marshallAdd(itm, x); err != nil {
-				log.Fatal(err)
-			}
-		case kits.Dashboard:
-			x, err := readDashboard(wd, itm.Name)
-			if err != nil {
-				log.Fatalf("Could not read dashboard %v: %v", itm.Name, err)
-			}
-			if err := marshallAdd(itm, x); err != nil {
-				log.Fatal(err)
-			}
-		case kits.Template:
-			var x types.PackedUserTemplate
-			if x, err = readTemplate(wd, itm.Name); err != nil {
-				log.Fatalf("Could not read %v %v: %v", itm.Type.String(), itm.Name, err)
-			}
-			if err := marshallAdd(itm, x); err != nil {
-				log.Fatal(err)
-			}
-		case kits.Pivot:
-			var x types.PackedPivot
-			if err := genericRead(wd, itm, &x); err != nil {
-				log.Fatalf("Could not read %v %v: %v", itm.Type.String(), itm.Name, err)
-			}
-			if err := marshallAdd(itm, x); err != nil {
-				log.Fatal(err)
-			}
-		// Other types just ship as-is
-		case kits.Extractor:
-			var x types.AXDefinition
-			if x, err = readExtractor(wd, itm.Name); err != nil {
-				log.Fatalf("Could not read %v %v: %v", itm.Type.String(), itm.Name, err)
-			}
-			if err := marshallAdd(itm, x); err != nil {
-				log.Fatal(err)
-			}
-		case kits.File:
-			var x types.UserFile
-			if x, err = readUserFile(wd, itm.Name); err != nil {
-				log.Fatalf("Could not read %v %v: %v", itm.Type.String(), itm.Name, err)
-			}
-			if err := marshallAdd(itm, x); err != nil {
-				log.Fatal(err)
-			}
-		case kits.SearchLibrary:
-			var x types.WireSearchLibrary
-			if x, err = readSearchLibrary(wd, itm.Name); err != nil {
-				log.Fatalf("Could not read %v %v: %v", itm.Type.String(), itm.Name, err)
-			}
-			if err := marshallAdd(itm, x); err != nil {
-				log.Fatal(err)
-			}
-		case kits.Playbook:
-			var x types.Playbook
-			if x, err = readPlaybook(wd, itm.Name); err != nil {
-				log.Fatalf("Could not read %v %v: %v", itm.Type.String(), itm.Name, err)
-			}
-			if err := marshallAdd(itm, x); err != nil {
-				log.Fatal(err)
-			}
-		case kits.Alert:
-			var x types.AlertDefinition
-			if err = genericRead(wd, itm, &x); err != nil {
-				log.Fatalf("Could not read %v %v: %v", itm.Type.String(), itm.Name, err)
-			}
-			if err := marshallAdd(itm, x); err != nil {
-				log.Fatal(err)
-			}
-		case kits.License:
-			x, err := readLicense(wd, itm.Name)
-			if err != nil {
-				log.Fatalf("Could not read license %v: %v", itm.Name, err)
-			}
-			if err := bldr.Add(itm.Name, itm.Type, x); err != nil {
-				log.Fatalf("Couldn't add %v %v: %v", itm.Type.String(), itm.Name, err)
+		obj, err := readItem(wd, itm)
+		if err != nil {
+			log.Fatal(err)
+		}
+		// Licenses ship as-is, everything else is marshalled
+		bts, ok := obj.([]byte)
+		if !ok {
+			if bts, err = json.Marshal(obj); err != nil {
+				log.Fatalf("Could not marshal %v %v: %v", itm.Type.String(), itm.Name, err)
 			}
-		default:
-			log.Fatalf("Error parsing item %v, unknown item type %v", itm.Name, itm.Type)
+		}
+		if err := bldr.Add(itm.Name, itm.Type, bts); err != nil {
+			log.Fatalf("Couldn't add %v %v: %v", itm.Type.String(), itm.Name, err)
 		}
 	}
 
@@ -516,9 +468,19 @@ func packKit(args []string) {
 		}
 	}
 
-	if err = bldr.WriteManifest(nil); err != nil {
+	if *fSignKey != "" {
+		key, err := readSigningKey(*fSignKey)
+		if err != nil {
+			bldr.Abort()
+			log.Fatal(err)
+		}
+		if err = bldr.WriteSignedManifest(key); err != nil {
+			log.Fatalf("Could not write signed manifest: %v", err)
+		}
+	} else if err = bldr.WriteManifest(nil); err != nil {
 		log.Fatalf("Could not write manifest: %v", err)
-	} else if err = bldr.Close(); err != nil {
+	}
+	if err = bldr.Close(); err != nil {
 		log.Fatalf("Could not close builder: %v", err)
 	}
 }
@@ -542,19 +504,10 @@ func importKit(args []string) {
 		log.Fatal(err)
 	}
 
-	// Open the new file
-	fi, err := utils.OpenFileReader(args[0])
+	// Open and verify the new file
+	rdr, err := openKit(args[0])
 	if err != nil {
-		log.Fatalf("Could not open file %v: %v", args[0], err)
-	}
-
-	// Get reader
-	rdr, err := kits.NewReader(fi, nil)
-	if err != nil {
-		log.Fatalf("Could not get reader for kit file: %v", err)
-	}
-	if err := rdr.Verify(); err != nil {
-		log.Fatalf("Could not verify kit: %v", err)
+		log.Fatal(err)
 	}
 
 	// Copy out the MANIFEST file
@@ -610,6 +563,43 @@ macroLoop:
 	}
 }
 
+func verifyKit(args []string) {
+	if len(args) != 1 {
+		fmt.Printf("Usage: kitctl -pub-key <keyfile> verify <kitfile>\n")
+		return
+	}
+	if *fPubKey == "" && *fTrustStore == "" {
+		log.Fatalf("Must specify -pub-key or -trust-store to verify a kit")
+	}
+	rdr, err := openKit(args[0])
+	if err != nil {
+		log.Fatal(err)
+	}
+	mf, err := rdr.Manifest()
+	if err != nil {
+		log.Fatalf("Failed to read manifest: %v", err)
+	}
+	fmt.Printf("Kit %v version %v is signed by a trusted key\n", mf.ID, mf.Version)
+}
+
+func keygen(args []string) {
+	if len(args) != 1 {
+		fmt.Printf("Usage: kitctl [-key-type ed25519|rsa] keygen <keyfile>\n")
+		return
+	}
+	priv, pub, err := kits.GenerateSigningKey(*fKeyType)
+	if err != nil {
+		log.Fatalf("Could not generate key: %v", err)
+	}
+	if err := ioutil.WriteFile(args[0], priv, 0600); err != nil {
+		log.Fatalf("Could not write private key: %v", err)
+	}
+	if err := ioutil.WriteFile(args[0]+".pub", pub, 0644); err != nil {
+		log.Fatalf("Could not write public key: %v", err)
+	}
+	fmt.Printf("Wrote private key to %v and public key to %v.pub\n", args[0], args[0])
+}
+
 func unpackKit(args []string) {
 	// Figure out where we are
 	wd, err := os.Getwd()
@@ -622,18 +612,9 @@ func unpackKit(args []string) {
 		fmt.Printf("Usage: kitctl unpack <kitfile>\n")
 		return
 	}
-	fi, err := utils.OpenFileReader(args[0])
+	rdr, err := openKit(args[0])
 	if err != nil {
-		log.Fatalf("Could not open file %v: %v", args[0], err)
-	}
-
-	// Get reader
-	rdr, err := kits.NewReader(fi, nil)
-	if err != nil {
-		log.Fatalf("Could not get reader for kit file: %v", err)
-	}
-	if err := rdr.Verify(); err != nil {
-		log.Fatalf("Could not verify kit: %v", err)
+		log.Fatal(err)
 	}
 
 	// Copy out the MANIFEST file
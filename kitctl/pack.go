@@ -557,3 +557,55 @@ func genericRead(dir string, itm kits.Item, obj interface{}) (err error) {
 	}
 	return
 }
+
+// itemDir returns the directory holding items of the given type
+func itemDir(tp kits.ItemType) string {
+	if tp == kits.ScheduledSearch {
+		return "scheduled"
+	}
+	return tp.Ext()
+}
+
+// readItem reads a single kit item from disk in its packed form. Licenses are
+// returned as raw bytes, everything else as an object ready to be marshalled.
+func readItem(wd string, itm kits.Item) (obj interface{}, err error) {
+	switch itm.Type {
+	// Some types have special "packed" versions
+	case kits.Resource:
+		obj, err = readResource(wd, itm.Name)
+	case kits.Macro:
+		obj, err = readMacro(wd, itm.Name)
+	case kits.ScheduledSearch:
+		obj, err = readScheduledSearch(wd, itm.Name)
+	case kits.Dashboard:
+		obj, err = readDashboard(wd, itm.Name)
+	case kits.Template:
+		obj, err = readTemplate(wd, itm.Name)
+	case kits.Pivot:
+		var x types.PackedPivot
+		err = genericRead(wd, itm, &x)
+		obj = x
+	// Other types just ship as-is
+	case kits.Extractor:
+		obj, err = readExtractor(wd, itm.Name)
+	case kits.File:
+		obj, err = readUserFile(wd, itm.Name)
+	case kits.SearchLibrary:
+		obj, err = readSearchLibrary(wd, itm.Name)
+	case kits.Playbook:
+		obj, err = readPlaybook(wd, itm.Name)
+	case kits.Alert:
+		var x types.AlertDefinition
+		err = genericRead(wd, itm, &x)
+		obj = x
+	case kits.License:
+		obj, err = readLicense(wd, itm.Name)
+	default:
+		err = fmt.Errorf("Error parsing item %v, unknown item type %v", itm.Name, itm.Type)
+		return
+	}
+	if err != nil {
+		err = fmt.Errorf("Could not read %v %v: %v", itm.Type.String(), itm.Name, err)
+	}
+	return
+}
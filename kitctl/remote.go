@@ -0,0 +1,565 @@
+/*************************************************************************
+ * Copyright 2024 Gravwell, Inc. All rights reserved.
+ * Contact: <legal@gravwell.io>
+ *
+ * This software may be modified and distributed under the terms of the
+ * BSD 2-clause license. See the LICENSE file for details.
+ **************************************************************************/
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gravwell/gravwell/v3/client"
+	"github.com/gravwell/gravwell/v3/client/objlog"
+	"github.com/gravwell/gravwell/v3/client/types"
+	"github.com/gravwell/gravwell/v3/client/types/kits"
+	"github.com/gravwell/gravwell/v3/ingesters/utils"
+
+	"github.com/Bowery/prompt"
+	"github.com/google/uuid"
+)
+
+const (
+	apiTokenEnv = `GRAVWELL_API_TOKEN`
+	passwordEnv = `GRAVWELL_PASSWORD`
+
+	installTimeout = 5 * time.Minute
+)
+
+var (
+	// how often to check on a kit installation
+	installPoll = time.Second
+)
+
+// connect logs in to the webserver given by -server. An API token in the GRAVWELL_API_TOKEN
+// environment variable is preferred, otherwise the -user flag is used with a password from
+// GRAVWELL_PASSWORD or a prompt.
+func connect() (cli *client.Client, err error) {
+	if *fServer == "" {
+		return nil, errors.New("Must specify a webserver with -server")
+	}
+	objLogger, _ := objlog.NewNilLogger()
+	if cli, err = client.NewClient(*fServer, !*fInsecure, !*fNoHTTPS, objLogger); err != nil {
+		return nil, fmt.Errorf("Failed to create client: %v", err)
+	}
+	if token := os.Getenv(apiTokenEnv); token != "" {
+		if err = cli.LoginWithAPIToken(token); err != nil {
+			err = fmt.Errorf("API token login failed: %v", err)
+		}
+		return
+	}
+	user := *fUser
+	if user == "" {
+		if user, err = prompt.Basic("Username: ", true); err != nil {
+			return
+		}
+	}
+	pass, ok := os.LookupEnv(passwordEnv)
+	if !ok {
+		if pass, err = prompt.Password("Password: "); err != nil {
+			return
+		}
+	}
+	if err = cli.Login(user, pass); err != nil {
+		err = fmt.Errorf("Login failed: %v", err)
+	}
+	return
+}
+
+// installedKit returns the installed kit with the given ID, installed is false if
+// the kit is not installed.
+func installedKit(cli *client.Client, id string) (ks types.KitState, installed bool, err error) {
+	var states []types.IdKitState
+	if states, err = cli.ListKits(); err != nil {
+		return
+	}
+	for _, st := range states {
+		if st.ID == id && st.Installed {
+			return st.KitState, true, nil
+		}
+	}
+	return
+}
+
+// readConfigMacroValues loads a JSON object mapping config macro names to values
+func readConfigMacroValues(p string) (vals map[string]string, err error) {
+	var bts []byte
+	if bts, err = ioutil.ReadFile(p); err != nil {
+		return
+	} else if err = json.Unmarshal(bts, &vals); err != nil {
+		err = fmt.Errorf("Couldn't parse config macros %v: %v", p, err)
+	}
+	return
+}
+
+// the "deploy" command uploads a kit to the webserver and installs it. With no kit file the
+// kit in the current directory is packed and deployed.
+func deployKit(args []string) {
+	if len(args) > 1 {
+		fmt.Printf("Usage: kitctl -server <host> [-config-macros <file>] deploy [kitfile]\n")
+		return
+	}
+	var kitPath string
+	if len(args) == 1 {
+		kitPath = args[0]
+		// make sure it is a valid kit, and trusted if a trust store is configured
+		if _, err := openKit(kitPath); err != nil {
+			log.Fatal(err)
+		}
+	} else {
+		wd, err := os.Getwd()
+		if err != nil {
+			log.Fatalf("Couldn't figure out working directory: %v", err)
+		}
+		tdir, err := ioutil.TempDir("", "kitctl")
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer os.RemoveAll(tdir)
+		kitPath = filepath.Join(tdir, "deploy.kit")
+		packDir(wd, kitPath)
+	}
+	vals := map[string]string{}
+	if *fConfigMacros != "" {
+		var err error
+		if vals, err = readConfigMacroValues(*fConfigMacros); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	cli, err := connect()
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer cli.Close()
+
+	st, err := deploy(cli, kitPath, vals)
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("Installed %v version %v", st.ID, st.Version)
+}
+
+// deploy uploads and installs a kit, then waits for the installation to finish. The
+// staged kit is removed if it cannot be installed.
+func deploy(cli *client.Client, kitPath string, vals map[string]string) (st types.KitState, err error) {
+	if st, err = cli.UploadKit(kitPath); err != nil {
+		err = fmt.Errorf("Could not upload kit: %v", err)
+		return
+	}
+	log.Printf("Staged %v version %v as %v", st.ID, st.Version, st.UUID)
+	abort := func(err error) (types.KitState, error) {
+		if derr := cli.DeleteKit(st.UUID); derr != nil {
+			log.Printf("Failed to remove staged kit %v: %v", st.UUID, derr)
+		}
+		return st, err
+	}
+	if len(st.ConflictingItems) > 0 && !*fOverwrite {
+		for _, itm := range st.ConflictingItems {
+			log.Printf("Conflicts with existing %v %v", itm.Type, itm.Name)
+		}
+		return abort(fmt.Errorf("Kit would overwrite %d existing items, use -overwrite to replace them", len(st.ConflictingItems)))
+	}
+	for _, itm := range st.ModifiedItems {
+		log.Printf("Replacing %v %v which was modified since version %v was installed", itm.Type, itm.Name, itm.KitVersion)
+	}
+	if !st.Signed && !*fAllowUnsigned {
+		return abort(errors.New("Kit is not signed, use -allow-unsigned to install it"))
+	}
+
+	cfg, err := deployConfig(st, vals)
+	if err != nil {
+		return abort(err)
+	}
+	// remember the newest installation so we don't mistake an old status for ours
+	last, err := lastInstallID(cli)
+	if err != nil {
+		return abort(fmt.Errorf("Could not get kit installation statuses: %v", err))
+	}
+	if err = cli.InstallKit(st.UUID, cfg); err != nil {
+		return abort(fmt.Errorf("Could not install kit: %v", err))
+	}
+	if err = waitInstall(cli, last); err != nil {
+		err = fmt.Errorf("Kit installation failed: %v", err)
+	}
+	return
+}
+
+// deployConfig builds the installation config for a staged kit. Config macros take
+// their value from vals, then the staged value, then the default. Values for config
+// macros which the kit does not define are an error.
+func deployConfig(st types.KitState, vals map[string]string) (cfg types.KitConfig, err error) {
+	cfg = types.KitConfig{
+		OverwriteExisting: *fOverwrite,
+		Global:            *fGlobal,
+		AllowUnsigned:     *fAllowUnsigned,
+		ConfigMacros:      append([]types.KitConfigMacro(nil), st.ConfigMacros...),
+	}
+	used := make(map[string]bool, len(vals))
+	for i := range cfg.ConfigMacros {
+		cm := &cfg.ConfigMacros[i]
+		if v, ok := vals[cm.MacroName]; ok {
+			cm.Value = v
+			used[cm.MacroName] = true
+		} else if cm.Value == "" {
+			cm.Value = cm.DefaultValue
+		}
+	}
+	var unknown []string
+	for k := range vals {
+		if !used[k] {
+			unknown = append(unknown, k)
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		err = fmt.Errorf("Config macros %v are not defined by the kit", strings.Join(unknown, ", "))
+	}
+	return
+}
+
+// lastInstallID returns the ID of the newest kit installation, or -1 if there are none
+func lastInstallID(cli *client.Client) (int32, error) {
+	statuses, err := cli.KitStatuses()
+	if err != nil {
+		return 0, err
+	}
+	last := int32(-1)
+	for _, s := range statuses {
+		if s.InstallID > last {
+			last = s.InstallID
+		}
+	}
+	return last, nil
+}
+
+// waitInstall waits for the newest kit installation after the given install ID to complete
+func waitInstall(cli *client.Client, after int32) error {
+	deadline := time.Now().Add(installTimeout)
+	for time.Now().Before(deadline) {
+		statuses, err := cli.KitStatuses()
+		if err != nil {
+			return err
+		}
+		var last *types.InstallStatus
+		for i := range statuses {
+			if s := &statuses[i]; s.InstallID > after && (last == nil || s.InstallID > last.InstallID) {
+				last = s
+			}
+		}
+		if last != nil && last.Done {
+			if last.Error != "" {
+				return errors.New(last.Error)
+			}
+			return nil
+		}
+		time.Sleep(installPoll)
+	}
+	return errors.New("timed out waiting for installation")
+}
+
+// the "pull" command has the webserver build the kit from the items currently installed,
+// then downloads it and unpacks it over the current directory. Kit metadata, such as the
+// version and config macros, is kept from the local MANIFEST.
+func pullKit(args []string) {
+	wd, err := os.Getwd()
+	if err != nil {
+		log.Fatalf("Couldn't figure out working directory: %v", err)
+	}
+	mf, err := readManifest()
+	if err != nil {
+		log.Fatal(err)
+	}
+	cli, err := connect()
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer cli.Close()
+
+	if mf, err = pull(cli, wd, mf); err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("Pulled %d items from %v", len(mf.Items), *fServer)
+}
+
+// pull rebuilds the installed kit on the webserver and unpacks it into wd, removing
+// local items which are no longer in the kit. The updated manifest is written to wd
+// and returned.
+func pull(cli *client.Client, wd string, mf kits.Manifest) (kits.Manifest, error) {
+	st, ok, err := installedKit(cli, mf.ID)
+	if err != nil {
+		return mf, fmt.Errorf("Could not list kits: %v", err)
+	} else if !ok {
+		return mf, fmt.Errorf("Kit %v is not installed on %v", mf.ID, *fServer)
+	}
+	pbr, err := buildRequest(wd, mf, st)
+	if err != nil {
+		return mf, err
+	}
+	resp, err := cli.BuildKit(pbr)
+	if err != nil {
+		return mf, fmt.Errorf("Could not build kit: %v", err)
+	}
+	defer cli.DeleteBuildKit(resp.UUID)
+
+	tf, err := ioutil.TempFile("", "kitctl")
+	if err != nil {
+		return mf, err
+	}
+	defer os.Remove(tf.Name())
+	if err = downloadKit(cli, resp.UUID, tf); err != nil {
+		return mf, fmt.Errorf("Could not download kit: %v", err)
+	}
+
+	fi, err := utils.OpenFileReader(tf.Name())
+	if err != nil {
+		return mf, err
+	}
+	defer fi.Close()
+	rdr, err := kits.NewReader(fi, nil)
+	if err != nil {
+		return mf, fmt.Errorf("Could not get reader for kit file: %v", err)
+	} else if err = rdr.Verify(); err != nil {
+		return mf, fmt.Errorf("Could not verify kit: %v", err)
+	}
+	newmf, err := rdr.Manifest()
+	if err != nil {
+		return mf, fmt.Errorf("Failed to read manifest: %v", err)
+	}
+	if err = unpackKitItems(wd, rdr); err != nil {
+		return mf, err
+	}
+	if err = pruneItems(wd, newmf.Items); err != nil {
+		return mf, err
+	}
+	// take the item list from the server, everything else stays as it was
+	mf.Items = newmf.Items
+	if err = writeManifestDir(wd, mf); err != nil {
+		return mf, err
+	}
+	return mf, nil
+}
+
+// pruneItems removes item files in wd which do not belong to any of the given items,
+// so items deleted on the webserver do not linger in the unpacked kit.
+func pruneItems(wd string, items []kits.Item) error {
+	keep := map[kits.ItemType]map[string]bool{}
+	for _, itm := range items {
+		if keep[itm.Type] == nil {
+			keep[itm.Type] = map[string]bool{}
+		}
+		keep[itm.Type][itm.Name] = true
+	}
+	for _, tp := range lintItemTypes {
+		dir := filepath.Join(wd, itemDir(tp))
+		ents, err := os.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, ent := range ents {
+			if ent.IsDir() {
+				continue
+			}
+			if nm := strings.TrimSuffix(ent.Name(), filepath.Ext(ent.Name())); !keep[tp][nm] {
+				if err := os.Remove(filepath.Join(dir, ent.Name())); err != nil {
+					return err
+				}
+				log.Printf("Removed %v, it is no longer in the kit", filepath.Join(itemDir(tp), ent.Name()))
+			}
+		}
+	}
+	return nil
+}
+
+func downloadKit(cli *client.Client, id string, w io.WriteCloser) error {
+	resp, err := cli.KitDownloadRequest(id)
+	if err != nil {
+		w.Close()
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		w.Close()
+		return fmt.Errorf("Bad status %v", resp.Status)
+	}
+	if _, err = io.Copy(w, resp.Body); err != nil {
+		w.Close()
+		return err
+	}
+	return w.Close()
+}
+
+// buildRequest builds a request for the items in an installed kit. Licenses are not stored
+// on the webserver so they are embedded from the local copy.
+func buildRequest(wd string, mf kits.Manifest, st types.KitState) (pbr types.KitBuildRequest, err error) {
+	pbr = types.KitBuildRequest{
+		ID:           mf.ID,
+		Name:         mf.Name,
+		Description:  mf.Desc,
+		Readme:       mf.Readme,
+		Version:      mf.Version,
+		MinVersion:   mf.MinVersion,
+		MaxVersion:   mf.MaxVersion,
+		Icon:         st.Icon,
+		Banner:       st.Banner,
+		Cover:        st.Cover,
+		Dependencies: mf.Dependencies,
+		ConfigMacros: mf.ConfigMacros,
+	}
+	for _, itm := range st.Items {
+		var tp kits.ItemType
+		if tp, err = kits.TranslateType(itm.Type); err != nil {
+			return
+		}
+		if err = addBuildItem(wd, &pbr, tp, itm); err != nil {
+			err = fmt.Errorf("Could not add %v %v: %v", itm.Type, itm.Name, err)
+			return
+		}
+	}
+	return
+}
+
+func addBuildItem(wd string, pbr *types.KitBuildRequest, tp kits.ItemType, itm types.KitItem) (err error) {
+	var id uuid.UUID
+	var num uint64
+	switch tp {
+	case kits.Dashboard, kits.Macro:
+		num, err = strconv.ParseUint(itm.ID, 10, 64)
+	case kits.ScheduledSearch:
+		num, err = strconv.ParseUint(itm.ID, 10, 31)
+	case kits.License, kits.External:
+	default:
+		id, err = uuid.Parse(itm.ID)
+	}
+	if err != nil {
+		return fmt.Errorf("invalid ID %q", itm.ID)
+	}
+	switch tp {
+	case kits.Dashboard:
+		pbr.Dashboards = append(pbr.Dashboards, num)
+	case kits.Macro:
+		pbr.Macros = append(pbr.Macros, num)
+	case kits.ScheduledSearch:
+		var ss struct{ ScheduledType string }
+		json.Unmarshal(itm.AdditionalInfo, &ss)
+		if strings.EqualFold(ss.ScheduledType, "flow") {
+			pbr.Flows = append(pbr.Flows, int32(num))
+		} else {
+			pbr.ScheduledSearches = append(pbr.ScheduledSearches, int32(num))
+		}
+	case kits.Template:
+		pbr.Templates = append(pbr.Templates, id)
+	case kits.Pivot:
+		pbr.Pivots = append(pbr.Pivots, id)
+	case kits.Resource:
+		pbr.Resources = append(pbr.Resources, id.String())
+	case kits.Extractor:
+		pbr.Extractors = append(pbr.Extractors, id)
+	case kits.File:
+		pbr.Files = append(pbr.Files, id)
+	case kits.SearchLibrary:
+		pbr.SearchLibraries = append(pbr.SearchLibraries, id)
+	case kits.Playbook:
+		pbr.Playbooks = append(pbr.Playbooks, id)
+	case kits.Alert:
+		pbr.Alerts = append(pbr.Alerts, id)
+	case kits.License:
+		var b []byte
+		if b, err = readLicense(wd, itm.Name); err != nil {
+			return
+		}
+		pbr.EmbeddedItems = append(pbr.EmbeddedItems, types.KitEmbeddedItem{
+			KitItem: types.KitItem{Name: itm.Name, Type: itm.Type},
+			Content: b,
+		})
+	}
+	return
+}
+
+// kitStatus compares the local kit with the one installed on the webserver.
+type kitStatus struct {
+	ID               string
+	Server           string
+	LocalVersion     uint
+	Installed        bool
+	InstalledVersion uint      `json:",omitempty"`
+	InstallationTime time.Time `json:",omitempty"`
+	Status           string
+}
+
+// the "status" command compares the version of the kit in the current directory
+// with the version installed on the webserver.
+func kitStatusCmd(args []string) {
+	mf, err := readManifest()
+	if err != nil {
+		log.Fatal(err)
+	}
+	cli, err := connect()
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer cli.Close()
+	ks, err := getKitStatus(cli, mf)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if *fJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "	")
+		if err := enc.Encode(ks); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	fmt.Printf("•Kit ID: %v\n", ks.ID)
+	fmt.Printf("•Local version: %v\n", ks.LocalVersion)
+	if ks.Installed {
+		fmt.Printf("•Installed version: %v (installed %v)\n", ks.InstalledVersion, ks.InstallationTime.Format(time.RFC3339))
+	}
+	fmt.Printf("•Status: %v\n", ks.Status)
+}
+
+// getKitStatus compares the local kit with the version installed on the webserver
+func getKitStatus(cli *client.Client, mf kits.Manifest) (ks kitStatus, err error) {
+	st, ok, err := installedKit(cli, mf.ID)
+	if err != nil {
+		err = fmt.Errorf("Could not list kits: %v", err)
+		return
+	}
+	ks = kitStatus{
+		ID:           mf.ID,
+		Server:       *fServer,
+		LocalVersion: mf.Version,
+		Installed:    ok,
+	}
+	if ok {
+		ks.InstalledVersion = st.Version
+		ks.InstallationTime = st.InstallationTime
+	}
+	switch {
+	case !ok:
+		ks.Status = "not installed"
+	case st.Version < mf.Version:
+		ks.Status = "local is newer, deploy to update"
+	case st.Version > mf.Version:
+		ks.Status = "installed is newer, pull to update"
+	default:
+		ks.Status = "up to date"
+	}
+	return
+}
@@ -0,0 +1,384 @@
+/*************************************************************************
+ * Copyright 2024 Gravwell, Inc. All rights reserved.
+ * Contact: <legal@gravwell.io>
+ *
+ * This software may be modified and distributed under the terms of the
+ * BSD 2-clause license. See the LICENSE file for details.
+ **************************************************************************/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gravwell/gravwell/v3/client"
+	"github.com/gravwell/gravwell/v3/client/types"
+	"github.com/gravwell/gravwell/v3/client/types/kits"
+
+	"github.com/google/uuid"
+)
+
+const (
+	stubToken   = `testtoken`
+	stubStaged  = `staged-kit`
+	stubBuildID = `built-kit`
+)
+
+// kitServerStub is a minimal Gravwell webserver serving the kit APIs
+type kitServerStub struct {
+	sync.Mutex
+	t         *testing.T
+	installed []types.IdKitState
+	staged    types.KitState
+	statuses  []types.InstallStatus
+	kit       []byte // served as the built kit
+
+	installs []types.KitConfig
+	deleted  []string
+	builds   []types.KitBuildRequest
+}
+
+func newKitServerStub(t *testing.T) (*kitServerStub, *client.Client) {
+	ks := &kitServerStub{t: t}
+	srv := httptest.NewServer(ks)
+	t.Cleanup(srv.Close)
+
+	// connect reads the server from the flags
+	server, noHTTPS := *fServer, *fNoHTTPS
+	t.Cleanup(func() { *fServer, *fNoHTTPS = server, noHTTPS })
+	*fServer, *fNoHTTPS = strings.TrimPrefix(srv.URL, "http://"), true
+	t.Setenv(apiTokenEnv, stubToken)
+	cli, err := connect()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { cli.Close() })
+
+	poll := installPoll
+	installPoll = 10 * time.Millisecond
+	t.Cleanup(func() { installPoll = poll })
+	return ks, cli
+}
+
+func (ks *kitServerStub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ks.Lock()
+	defer ks.Unlock()
+	if r.Header.Get("Gravwell-Token") != stubToken {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	pth := r.URL.Path
+	switch {
+	case pth == "/api/testauth":
+	case r.Method == http.MethodGet && pth == "/api/kits":
+		json.NewEncoder(w).Encode(ks.installed)
+	case r.Method == http.MethodPost && pth == "/api/kits":
+		json.NewEncoder(w).Encode(ks.staged)
+	case r.Method == http.MethodGet && pth == "/api/kits/status":
+		json.NewEncoder(w).Encode(ks.statuses)
+		// the newest installation finishes after it has been seen once
+		for i := range ks.statuses {
+			ks.statuses[i].Done = true
+		}
+	case r.Method == http.MethodPut && pth == "/api/kits/"+stubStaged:
+		var cfg types.KitConfig
+		if err := json.NewDecoder(r.Body).Decode(&cfg); err != nil {
+			ks.t.Errorf("bad install config: %v", err)
+		}
+		ks.installs = append(ks.installs, cfg)
+		var id int32
+		for _, s := range ks.statuses {
+			if s.InstallID >= id {
+				id = s.InstallID + 1
+			}
+		}
+		ks.statuses = append(ks.statuses, types.InstallStatus{InstallID: id})
+	case r.Method == http.MethodDelete && pth == "/api/kits/"+stubStaged:
+		ks.deleted = append(ks.deleted, stubStaged)
+	case r.Method == http.MethodPost && pth == "/api/kits/build":
+		var pbr types.KitBuildRequest
+		if err := json.NewDecoder(r.Body).Decode(&pbr); err != nil {
+			ks.t.Errorf("bad build request: %v", err)
+		}
+		ks.builds = append(ks.builds, pbr)
+		json.NewEncoder(w).Encode(types.KitBuildResponse{UUID: stubBuildID, Size: int64(len(ks.kit))})
+	case r.Method == http.MethodGet && pth == "/api/kits/build/"+stubBuildID:
+		w.Write(ks.kit)
+	case r.Method == http.MethodDelete && pth == "/api/kits/build/"+stubBuildID:
+	default:
+		ks.t.Errorf("unexpected request %v %v", r.Method, r.URL)
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+// stubKitFile packs a kit with the given manifest and macros and returns the path
+func stubKitFile(t *testing.T, mf kits.Manifest, macros ...string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for _, m := range macros {
+		mf.Items = append(mf.Items, kits.Item{Name: m, Type: kits.Macro})
+		if err := writeMacro(dir, kits.PackedMacro{Name: m, Expansion: `tag=` + strings.ToLower(m)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := writeManifestDir(dir, mf); err != nil {
+		t.Fatal(err)
+	}
+	p := filepath.Join(t.TempDir(), "test.kit")
+	packDir(dir, p)
+	return p
+}
+
+func stubStagedKit() types.KitState {
+	return types.KitState{
+		ID:      `io.gravwell.remotetest`,
+		UUID:    stubStaged,
+		Version: 3,
+		ConfigMacros: []types.KitConfigMacro{
+			{MacroName: `KIT_TAG`, DefaultValue: `default`, Type: `TAG`},
+			{MacroName: `KIT_STAGED`, DefaultValue: `default`, Value: `staged`, Type: `OTHER`},
+			{MacroName: `KIT_DEFAULT`, DefaultValue: `default`, Type: `OTHER`},
+		},
+	}
+}
+
+func TestDeployConfigMacros(t *testing.T) {
+	ks, cli := newKitServerStub(t)
+	ks.staged = stubStagedKit()
+	ks.staged.Signed = true
+	// an earlier failed installation must not be mistaken for ours
+	ks.statuses = []types.InstallStatus{{InstallID: 4, Done: true, Error: `old failure`}}
+	kp := stubKitFile(t, kits.Manifest{ID: ks.staged.ID, Name: `Remote Test`, Version: 3})
+
+	st, err := deploy(cli, kp, map[string]string{`KIT_TAG`: `mytag`})
+	if err != nil {
+		t.Fatal(err)
+	} else if st.UUID != stubStaged {
+		t.Fatalf("bad staged kit %v", st.UUID)
+	}
+	if len(ks.installs) != 1 {
+		t.Fatalf("expected one installation, got %d", len(ks.installs))
+	}
+	cfg := ks.installs[0]
+	if cfg.AllowUnsigned {
+		t.Fatal("signed kit was installed with AllowUnsigned")
+	}
+	want := map[string]string{`KIT_TAG`: `mytag`, `KIT_STAGED`: `staged`, `KIT_DEFAULT`: `default`}
+	if len(cfg.ConfigMacros) != len(want) {
+		t.Fatalf("got %d config macros, expected %d", len(cfg.ConfigMacros), len(want))
+	}
+	for _, cm := range cfg.ConfigMacros {
+		if cm.Value != want[cm.MacroName] {
+			t.Errorf("config macro %v = %q, expected %q", cm.MacroName, cm.Value, want[cm.MacroName])
+		}
+	}
+	if ks.staged.ConfigMacros[0].Value != `` {
+		t.Fatal("deploy modified the staged kit's config macros")
+	}
+	if len(ks.deleted) != 0 {
+		t.Fatalf("installed kit was deleted")
+	}
+}
+
+func TestDeployRejected(t *testing.T) {
+	ks, cli := newKitServerStub(t)
+	ks.staged = stubStagedKit()
+	kp := stubKitFile(t, kits.Manifest{ID: ks.staged.ID, Name: `Remote Test`, Version: 3})
+
+	// unsigned kits need -allow-unsigned
+	if _, err := deploy(cli, kp, nil); err == nil || !strings.Contains(err.Error(), "allow-unsigned") {
+		t.Fatalf("unsigned kit was not rejected: %v", err)
+	}
+
+	*fAllowUnsigned = true
+	defer func() { *fAllowUnsigned = false }()
+	if _, err := deploy(cli, kp, map[string]string{`KIT_TAG`: `a`, `NOPE`: `b`, `ALSO_NOPE`: `c`}); err == nil {
+		t.Fatal("unknown config macros were accepted")
+	} else if !strings.Contains(err.Error(), "ALSO_NOPE, NOPE") {
+		t.Fatalf("error does not name the unknown config macros: %v", err)
+	}
+	if len(ks.installs) != 0 {
+		t.Fatalf("rejected kit was installed")
+	} else if len(ks.deleted) != 2 {
+		t.Fatalf("staged kit was deleted %d times, expected 2", len(ks.deleted))
+	}
+
+	// failures are reported and allowed once the flag is set
+	ks.staged.ConfigMacros = nil
+	ks.statuses = []types.InstallStatus{{InstallID: 7, Done: true}}
+	if _, err := deploy(cli, kp, nil); err != nil {
+		t.Fatal(err)
+	} else if !ks.installs[0].AllowUnsigned {
+		t.Fatal("-allow-unsigned was not passed to the webserver")
+	}
+}
+
+func TestWaitInstall(t *testing.T) {
+	ks, cli := newKitServerStub(t)
+	ks.statuses = []types.InstallStatus{
+		{InstallID: 1, Done: true},
+		{InstallID: 2, Done: true, Error: `old failure`},
+	}
+	last, err := lastInstallID(cli)
+	if err != nil {
+		t.Fatal(err)
+	} else if last != 2 {
+		t.Fatalf("last install ID %d, expected 2", last)
+	}
+	ks.statuses = append(ks.statuses, types.InstallStatus{InstallID: 3, Error: `new failure`})
+	if err := waitInstall(cli, last); err == nil || err.Error() != `new failure` {
+		t.Fatalf("expected the new installation's error, got %v", err)
+	}
+
+	ks.statuses = nil
+	if last, err = lastInstallID(cli); err != nil {
+		t.Fatal(err)
+	} else if last != -1 {
+		t.Fatalf("last install ID %d with no installations", last)
+	}
+	ks.statuses = []types.InstallStatus{{InstallID: 0}}
+	if err := waitInstall(cli, last); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestKitStatus(t *testing.T) {
+	ks, cli := newKitServerStub(t)
+	mf := kits.Manifest{ID: `io.gravwell.remotetest`, Version: 3}
+	tests := []struct {
+		installed []types.IdKitState
+		status    string
+	}{
+		{nil, "not installed"},
+		// staged but not installed
+		{[]types.IdKitState{{KitState: types.KitState{ID: mf.ID, Version: 3}}}, "not installed"},
+		{[]types.IdKitState{{KitState: types.KitState{ID: `io.gravwell.other`, Version: 3, Installed: true}}}, "not installed"},
+		{[]types.IdKitState{{KitState: types.KitState{ID: mf.ID, Version: 2, Installed: true}}}, "local is newer, deploy to update"},
+		{[]types.IdKitState{{KitState: types.KitState{ID: mf.ID, Version: 4, Installed: true}}}, "installed is newer, pull to update"},
+		{[]types.IdKitState{{KitState: types.KitState{ID: mf.ID, Version: 3, Installed: true}}}, "up to date"},
+	}
+	for i, tt := range tests {
+		ks.installed = tt.installed
+		st, err := getKitStatus(cli, mf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if st.Status != tt.status {
+			t.Errorf("%d: status %q, expected %q", i, st.Status, tt.status)
+		}
+		if st.Installed && st.InstalledVersion != tt.installed[0].Version {
+			t.Errorf("%d: installed version %d, expected %d", i, st.InstalledVersion, tt.installed[0].Version)
+		}
+	}
+}
+
+func TestBuildRequest(t *testing.T) {
+	tmpl := uuid.New()
+	pivot := uuid.New()
+	st := types.KitState{
+		Icon: `icon`,
+		Items: []types.KitItem{
+			{Name: `dash`, Type: `dashboard`, ID: `12`},
+			{Name: `MACRO`, Type: `macro`, ID: `7`},
+			{Name: `search`, Type: `scheduled search`, ID: `5`},
+			{Name: `flow`, Type: `scheduled search`, ID: `6`, AdditionalInfo: json.RawMessage(`{"ScheduledType":"flow"}`)},
+			{Name: `tmpl`, Type: `template`, ID: tmpl.String()},
+			{Name: `pivot`, Type: `pivot`, ID: pivot.String()},
+		},
+	}
+	mf := kits.Manifest{ID: `io.gravwell.remotetest`, Version: 3}
+	pbr, err := buildRequest(t.TempDir(), mf, st)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pbr.ID != mf.ID || pbr.Version != mf.Version || pbr.Icon != st.Icon {
+		t.Fatalf("bad kit metadata %+v", pbr)
+	}
+	if fmt.Sprint(pbr.Dashboards) != `[12]` || fmt.Sprint(pbr.Macros) != `[7]` ||
+		fmt.Sprint(pbr.ScheduledSearches) != `[5]` || fmt.Sprint(pbr.Flows) != `[6]` {
+		t.Fatalf("bad numeric IDs %v %v %v %v", pbr.Dashboards, pbr.Macros, pbr.ScheduledSearches, pbr.Flows)
+	}
+	if len(pbr.Templates) != 1 || pbr.Templates[0] != tmpl || len(pbr.Pivots) != 1 || pbr.Pivots[0] != pivot {
+		t.Fatalf("bad UUIDs %v %v", pbr.Templates, pbr.Pivots)
+	}
+
+	bad := []types.KitItem{
+		{Name: `dash`, Type: `dashboard`, ID: `abc`},
+		{Name: `dash`, Type: `dashboard`, ID: `-1`},
+		{Name: `MACRO`, Type: `macro`, ID: ``},
+		{Name: `search`, Type: `scheduled search`, ID: `2147483648`},
+		{Name: `tmpl`, Type: `template`, ID: `12`},
+		{Name: `what`, Type: `gizmo`, ID: `12`},
+	}
+	for _, itm := range bad {
+		st.Items = []types.KitItem{itm}
+		if _, err := buildRequest(t.TempDir(), mf, st); err == nil {
+			t.Errorf("%v ID %q was accepted", itm.Type, itm.ID)
+		}
+	}
+}
+
+func TestPull(t *testing.T) {
+	ks, cli := newKitServerStub(t)
+	mf := kits.Manifest{ID: `io.gravwell.remotetest`, Name: `Remote Test`, Version: 3}
+	ks.installed = []types.IdKitState{{KitState: types.KitState{ID: mf.ID, Version: 3, Installed: true,
+		Items: []types.KitItem{{Name: `KEEP`, Type: `macro`, ID: `1`}, {Name: `NEW`, Type: `macro`, ID: `2`}},
+	}}}
+	kp := stubKitFile(t, kits.Manifest{ID: mf.ID, Name: mf.Name, Version: 1}, `KEEP`, `NEW`)
+	var err error
+	if ks.kit, err = os.ReadFile(kp); err != nil {
+		t.Fatal(err)
+	}
+
+	// the local kit has an item which was deleted on the webserver
+	wd := t.TempDir()
+	for _, m := range []string{`KEEP`, `GONE`} {
+		mf.Items = append(mf.Items, kits.Item{Name: m, Type: kits.Macro})
+		if err := writeMacro(wd, kits.PackedMacro{Name: m, Expansion: `old`}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := writeManifestDir(wd, mf); err != nil {
+		t.Fatal(err)
+	}
+
+	newmf, err := pull(cli, wd, mf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ks.builds) != 1 || fmt.Sprint(ks.builds[0].Macros) != `[1 2]` {
+		t.Fatalf("bad build requests %+v", ks.builds)
+	}
+	if newmf.Version != 3 || len(newmf.Items) != 2 {
+		t.Fatalf("bad pulled manifest %+v", newmf)
+	}
+	if ondisk, err := readManifestDir(wd); err != nil {
+		t.Fatal(err)
+	} else if len(ondisk.Items) != 2 || ondisk.Version != 3 {
+		t.Fatalf("bad manifest written %+v", ondisk)
+	}
+	for _, f := range []string{`KEEP.meta`, `KEEP.expansion`, `NEW.meta`, `NEW.expansion`} {
+		if _, err := os.Stat(filepath.Join(wd, `macro`, f)); err != nil {
+			t.Errorf("missing %v: %v", f, err)
+		}
+	}
+	if pm, err := readMacro(wd, `KEEP`); err != nil {
+		t.Fatal(err)
+	} else if pm.Expansion != `tag=keep` {
+		t.Fatalf("KEEP was not updated: %q", pm.Expansion)
+	}
+	for _, f := range []string{`GONE.meta`, `GONE.expansion`} {
+		if _, err := os.Stat(filepath.Join(wd, `macro`, f)); !os.IsNotExist(err) {
+			t.Errorf("%v was not removed: %v", f, err)
+		}
+	}
+}
@@ -9,17 +9,25 @@
 package main
 
 import (
+	"crypto"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
+	"path/filepath"
 
 	"github.com/gravwell/gravwell/v3/client/types/kits"
+	"github.com/gravwell/gravwell/v3/ingesters/utils"
 )
 
 func readManifest() (kits.Manifest, error) {
+	return readManifestDir(".")
+}
+
+func readManifestDir(dir string) (kits.Manifest, error) {
 	// Get the manifest file
 	var mf kits.Manifest
-	mb, err := ioutil.ReadFile("MANIFEST")
+	mb, err := ioutil.ReadFile(filepath.Join(dir, "MANIFEST"))
 	if err != nil {
 		return mf, fmt.Errorf("Couldn't read MANIFEST: %v", err)
 	}
@@ -30,13 +38,86 @@ func readManifest() (kits.Manifest, error) {
 }
 
 func writeManifest(mf kits.Manifest) error {
+	return writeManifestDir(".", mf)
+}
+
+func writeManifestDir(dir string, mf kits.Manifest) error {
 	// And write the MANIFEST back out onto disk
 	mb, err := json.MarshalIndent(mf, "", "	")
 	if err != nil {
 		return fmt.Errorf("Failed to re-marshal MANIFEST: %v", err)
 	}
-	if err := ioutil.WriteFile("MANIFEST", mb, 0644); err != nil {
+	if err := ioutil.WriteFile(filepath.Join(dir, "MANIFEST"), mb, 0644); err != nil {
 		return fmt.Errorf("Failed to write-out MANIFEST file: %v", err)
 	}
 	return nil
 }
+
+func readSigningKey(p string) (crypto.Signer, error) {
+	b, err := ioutil.ReadFile(p)
+	if err != nil {
+		return nil, fmt.Errorf("Couldn't read signing key: %v", err)
+	}
+	key, err := kits.ParseSigningKey(b)
+	if err != nil {
+		return nil, fmt.Errorf("Couldn't parse signing key %v: %v", p, err)
+	}
+	return key, nil
+}
+
+// trustedKeys gathers the public keys given with the -pub-key and -trust-store flags
+func trustedKeys() (keys []crypto.PublicKey, err error) {
+	if *fPubKey != "" {
+		var b []byte
+		var key crypto.PublicKey
+		if b, err = ioutil.ReadFile(*fPubKey); err != nil {
+			return nil, fmt.Errorf("Couldn't read public key: %v", err)
+		} else if key, err = kits.ParsePublicKey(b); err != nil {
+			return nil, fmt.Errorf("Couldn't parse public key %v: %v", *fPubKey, err)
+		}
+		keys = append(keys, key)
+	}
+	if *fTrustStore != "" {
+		var ts []crypto.PublicKey
+		if ts, err = kits.LoadTrustStore(*fTrustStore); err != nil {
+			return nil, fmt.Errorf("Couldn't load trust store: %v", err)
+		}
+		keys = append(keys, ts...)
+	}
+	return
+}
+
+// openKit opens and verifies a kit file. If any trusted keys are configured the
+// kit must carry a signature from one of them.
+func openKit(p string) (*kits.Reader, error) {
+	var verify kits.SigVerificationFunc
+	keys, err := trustedKeys()
+	if err != nil {
+		return nil, err
+	} else if len(keys) > 0 {
+		verify = kits.NewSigVerifier(keys...)
+	}
+	fi, err := utils.OpenFileReader(p)
+	if err != nil {
+		return nil, fmt.Errorf("Could not open file %v: %v", p, err)
+	}
+	rdr, err := kits.NewReader(fi, verify)
+	if err != nil {
+		fi.Close()
+		return nil, fmt.Errorf("Could not get reader for kit file: %v", err)
+	}
+	if err := rdr.Verify(); err != nil {
+		fi.Close()
+		return nil, fmt.Errorf("Could not verify kit: %v", err)
+	}
+	if verify != nil {
+		if signed, err := rdr.Signed(); err != nil {
+			fi.Close()
+			return nil, fmt.Errorf("Kit signature check failed: %v", err)
+		} else if !signed {
+			fi.Close()
+			return nil, errors.New("Kit is not signed by a trusted key")
+		}
+	}
+	return rdr, nil
+}
@@ -29,11 +29,13 @@ type bindType int
 type readerType int
 
 type cfgReadType struct {
-	Global       global
-	Files        map[string]*files
-	Splunk       map[string]*splunk
-	Preprocessor processors.ProcessorConfig
-	TimeFormat   config.CustomTimeFormat
+	Global         global
+	Files          map[string]*files
+	Splunk         map[string]*splunk
+	Splunk_Mapping map[string]*splunkMapping
+	Elastic        map[string]*elastic
+	Preprocessor   processors.ProcessorConfig
+	TimeFormat     config.CustomTimeFormat
 }
 
 type global struct {
@@ -43,10 +45,12 @@ type global struct {
 
 type cfgType struct {
 	global
-	Files        map[string]*files
-	Splunk       map[string]*splunk
-	Preprocessor processors.ProcessorConfig
-	TimeFormat   config.CustomTimeFormat
+	Files          map[string]*files
+	Splunk         map[string]*splunk
+	Splunk_Mapping map[string]*splunkMapping
+	Elastic        map[string]*elastic
+	Preprocessor   processors.ProcessorConfig
+	TimeFormat     config.CustomTimeFormat
 }
 
 func GetConfig(path, overlayPath string) (*cfgType, error) {
@@ -57,11 +61,13 @@ func GetConfig(path, overlayPath string) (*cfgType, error) {
 		return nil, err
 	}
 	c := &cfgType{
-		global:       cr.Global,
-		Files:        cr.Files,
-		Splunk:       cr.Splunk,
-		Preprocessor: cr.Preprocessor,
-		TimeFormat:   cr.TimeFormat,
+		global:         cr.Global,
+		Files:          cr.Files,
+		Splunk:         cr.Splunk,
+		Splunk_Mapping: cr.Splunk_Mapping,
+		Elastic:        cr.Elastic,
+		Preprocessor:   cr.Preprocessor,
+		TimeFormat:     cr.TimeFormat,
 	}
 	if err := verifyConfig(c); err != nil {
 		return nil, err
@@ -84,8 +90,8 @@ func verifyConfig(c *cfgType) error {
 	if err := c.Verify(); err != nil {
 		return err
 	}
-	if len(c.Files) == 0 && len(c.Splunk) == 0 {
-		return errors.New("No Files or Splunk stanzas specified")
+	if len(c.Files) == 0 && len(c.Splunk) == 0 && len(c.Elastic) == 0 {
+		return errors.New("No Files, Splunk, or Elastic stanzas specified")
 	}
 	if err := c.Preprocessor.Validate(); err != nil {
 		return err
@@ -102,6 +108,24 @@ func verifyConfig(c *cfgType) error {
 			return fmt.Errorf("Splunk config %s failed %w", k, err)
 		}
 	}
+	seen := map[string]string{}
+	for k, v := range c.Splunk_Mapping {
+		if err := v.Validate(c.Preprocessor); err != nil {
+			return fmt.Errorf("Splunk-Mapping config %s failed %w", k, err)
+		} else if _, ok := c.Splunk[v.Splunk]; !ok {
+			return fmt.Errorf("Splunk-Mapping config %s references unknown Splunk config %q", k, v.Splunk)
+		}
+		key := fmt.Sprintf("%s,%s,%s", v.Splunk, v.Index, v.Sourcetype)
+		if other, ok := seen[key]; ok {
+			return fmt.Errorf("Splunk-Mapping configs %s and %s map the same index and sourcetype", other, k)
+		}
+		seen[key] = k
+	}
+	for k, v := range c.Elastic {
+		if err := v.Validate(c.Preprocessor); err != nil {
+			return fmt.Errorf("Elastic config %s failed %w", k, err)
+		}
+	}
 	return nil
 }
 
@@ -130,6 +154,18 @@ func (c *cfgType) Tags() ([]string, error) {
 			}
 		}
 	}
+	for _, v := range c.Elastic {
+		if tgs, err := v.Tags(); err != nil {
+			return tags, err
+		} else {
+			for _, tag := range tgs {
+				if _, ok := tagMp[tag]; !ok {
+					tags = append(tags, tag)
+					tagMp[tag] = true
+				}
+			}
+		}
+	}
 	sort.Strings(tags)
 	return tags, nil
 }
@@ -162,11 +198,33 @@ func (c *cfgType) getSplunkConn(splunkName string) (sc splunkConn, err error) {
 	return
 }
 
-func (c *cfgType) getSplunkPreprocessors(splunkName string, igst *ingest.IngestMuxer) (pproc *processors.ProcessorSet, err error) {
+// getSplunkMapping returns the mapping for an index and sourcetype on a Splunk server, mappings
+// which name the sourcetype take precedence over index wide mappings. A nil mapping is returned
+// if nothing matches.
+func (c *cfgType) getSplunkMapping(splunkName, index, sourcetype string) (m *splunkMapping) {
+	for _, v := range c.Splunk_Mapping {
+		if v == nil || !v.matches(splunkName, index, sourcetype) {
+			continue
+		}
+		if m == nil || v.Sourcetype != `` {
+			m = v
+		}
+	}
+	return
+}
+
+// getSplunkPreprocessors builds the preprocessor chain for a Splunk server, the mapping
+// preprocessors (if any) run ahead of those set on the Splunk config.
+func (c *cfgType) getSplunkPreprocessors(splunkName string, m *splunkMapping, igst *ingest.IngestMuxer) (pproc *processors.ProcessorSet, err error) {
 	for k, vv := range c.Splunk {
 		if k == splunkName {
+			var names []string
+			if m != nil {
+				names = append(names, m.Preprocessor...)
+			}
+			names = append(names, vv.Preprocessor...)
 			// get the ingester up and rolling
-			pproc, err = c.Preprocessor.ProcessorSet(igst, vv.Preprocessor)
+			pproc, err = c.Preprocessor.ProcessorSet(igst, names)
 			return
 		}
 	}
@@ -174,6 +232,33 @@ func (c *cfgType) getSplunkPreprocessors(splunkName string, igst *ingest.IngestM
 	return
 }
 
+func (c *cfgType) getElasticConfig(elasticName string) (e elastic, err error) {
+	if ep, ok := c.Elastic[elasticName]; !ok || ep == nil {
+		err = errors.New("Not found")
+	} else {
+		e = *ep
+	}
+	return
+}
+
+func (c *cfgType) getElasticConn(elasticName string) (ec elasticConn, err error) {
+	if vv, ok := c.Elastic[elasticName]; ok && vv != nil {
+		ec = newElasticConn(vv.Server, vv.Username, vv.Password, vv.API_Key)
+		return
+	}
+	err = errors.New("Not found")
+	return
+}
+
+func (c *cfgType) getElasticPreprocessors(elasticName string, igst *ingest.IngestMuxer) (pproc *processors.ProcessorSet, err error) {
+	if vv, ok := c.Elastic[elasticName]; ok && vv != nil {
+		pproc, err = c.Preprocessor.ProcessorSet(igst, vv.Preprocessor)
+		return
+	}
+	err = errors.New("Not found")
+	return
+}
+
 func (g *global) Verify() (err error) {
 	if err = g.IngestConfig.Verify(); err != nil {
 		return
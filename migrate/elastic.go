@@ -0,0 +1,401 @@
+/*************************************************************************
+ * Copyright 2024 Gravwell, Inc. All rights reserved.
+ * Contact: <legal@gravwell.io>
+ *
+ * This software may be modified and distributed under the terms of the
+ * BSD 2-clause license. See the LICENSE file for details.
+ **************************************************************************/
+
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gravwell/gravwell/v3/ingest"
+	"github.com/gravwell/gravwell/v3/ingest/entry"
+	"github.com/gravwell/gravwell/v3/ingest/log"
+	"github.com/gravwell/gravwell/v3/ingest/processors"
+)
+
+const (
+	elasticStateType string = `elastic`
+
+	defaultElasticTimestampField = `@timestamp`
+	defaultElasticBatchSize      = 1000
+	maxElasticBatchSize          = 10000 // the default index.max_result_window
+	defaultElasticSlice          = time.Hour
+)
+
+var (
+	elasticTracker *elasticStatusTracker = newElasticTracker()
+)
+
+type elastic struct {
+	Server                string   // the Elasticsearch or OpenSearch server, e.g. https://elastic.example.com:9200
+	Username              string   // basic auth user
+	Password              string   // basic auth password
+	API_Key               string   // an Elasticsearch API key, used instead of Username and Password
+	Index_To_Tag          []string // a mapping of index pattern to Gravwell tag
+	Timestamp_Field       string   // the date field used for time slices and entry timestamps, defaults to @timestamp
+	Search_Mode           string   // scroll (the default) or pit (point in time, Elasticsearch 7.12 and newer)
+	Batch_Size            int      // documents requested per page, defaults to 1000
+	Slice_Duration        string   // the time range migrated and checkpointed at once, defaults to 1h
+	Ingest_From_Unix_Time int      // a timestamp to use as the default start time for this server (default 1)
+	Ingest_To_Unix_Time   int      // a timestamp to use as the end time for this server (default 0, meaning "now")
+	Preprocessor          []string
+}
+
+func (e *elastic) Validate(procs processors.ProcessorConfig) (err error) {
+	if len(e.Server) == 0 {
+		return errors.New("No Elasticsearch server specified")
+	}
+	if e.API_Key != `` && e.Username != `` {
+		return errors.New("Cannot specify both API-Key and Username")
+	}
+	switch strings.ToLower(e.Search_Mode) {
+	case elasticSearchPIT, elasticSearchScroll, ``:
+		e.Search_Mode = strings.ToLower(e.Search_Mode)
+	default:
+		return fmt.Errorf("Invalid Search-Mode %q, must be %s or %s", e.Search_Mode, elasticSearchPIT, elasticSearchScroll)
+	}
+	if e.Batch_Size < 0 || e.Batch_Size > maxElasticBatchSize {
+		return fmt.Errorf("Invalid Batch-Size %d, must be between 1 and %d, or 0 for the default of %d", e.Batch_Size, maxElasticBatchSize, defaultElasticBatchSize)
+	}
+	if _, err = e.sliceDuration(); err != nil {
+		return
+	}
+	if _, err = e.ParseMappings(); err != nil {
+		return
+	}
+	if err = procs.CheckProcessors(e.Preprocessor); err != nil {
+		return fmt.Errorf("Elasticsearch preprocessor invalid: %v", err)
+	}
+	return
+}
+
+func (e *elastic) timestampField() string {
+	if e.Timestamp_Field == `` {
+		return defaultElasticTimestampField
+	}
+	return e.Timestamp_Field
+}
+
+func (e *elastic) batchSize() int {
+	if e.Batch_Size <= 0 {
+		return defaultElasticBatchSize
+	}
+	return e.Batch_Size
+}
+
+func (e *elastic) sliceDuration() (d time.Duration, err error) {
+	if e.Slice_Duration == `` {
+		return defaultElasticSlice, nil
+	}
+	if d, err = time.ParseDuration(e.Slice_Duration); err != nil {
+		err = fmt.Errorf("Invalid Slice-Duration %q: %v", e.Slice_Duration, err)
+	} else if d < time.Second {
+		err = fmt.Errorf("Invalid Slice-Duration %q, must be at least 1s", e.Slice_Duration)
+	}
+	return
+}
+
+func (e *elastic) startTime() time.Time {
+	if e.Ingest_From_Unix_Time <= 0 {
+		return time.Unix(1, 0)
+	}
+	return time.Unix(int64(e.Ingest_From_Unix_Time), 0)
+}
+
+func (e *elastic) endTime() time.Time {
+	if e.Ingest_To_Unix_Time <= 0 {
+		return time.Unix(0, 0)
+	}
+	return time.Unix(int64(e.Ingest_To_Unix_Time), 0)
+}
+
+func (e *elastic) ParseMappings() ([]ElasticToGravwell, error) {
+	var result []ElasticToGravwell
+	seen := map[string]bool{}
+	for _, x := range e.Index_To_Tag {
+		idx, tag, err := parseElasticMapping(x)
+		if err != nil {
+			return nil, err
+		} else if seen[idx] {
+			return nil, fmt.Errorf("duplicate index to tag mapping for %q", idx)
+		}
+		seen[idx] = true
+		result = append(result, ElasticToGravwell{Tag: tag, Index: idx, ConsumedUpTo: e.startTime()})
+	}
+	return result, nil
+}
+
+func parseElasticMapping(v string) (index, tag string, err error) {
+	var fields []string
+	dec := csv.NewReader(strings.NewReader(v))
+	dec.LazyQuotes = true
+	dec.TrimLeadingSpace = true
+	if fields, err = dec.Read(); err != nil {
+		return
+	} else if len(fields) != 2 {
+		err = fmt.Errorf("improper index to tag mapping %q, have %d fields need 2", v, len(fields))
+		return
+	}
+	if index = fields[0]; len(index) == 0 {
+		err = fmt.Errorf("missing index on tag mapping %q", v)
+		return
+	}
+	if tag = fields[1]; len(tag) == 0 {
+		err = fmt.Errorf("missing tag on tag mapping %q", v)
+		return
+	}
+	err = ingest.CheckTag(tag)
+	return
+}
+
+func (e *elastic) Tags() ([]string, error) {
+	var tags []string
+	if etg, err := e.ParseMappings(); err != nil {
+		return nil, err
+	} else {
+		for _, v := range etg {
+			tags = append(tags, v.Tag)
+		}
+	}
+	return tags, nil
+}
+
+// elasticStatusTracker keeps track of migration progress for each Elasticsearch config
+type elasticStatusTracker struct {
+	sync.Mutex
+	statusMap map[string]elasticStatus // maps elastic cfg name to status struct
+}
+
+func newElasticTracker() *elasticStatusTracker {
+	return &elasticStatusTracker{statusMap: map[string]elasticStatus{}}
+}
+
+func (t *elasticStatusTracker) GetStatus(name string) elasticStatus {
+	t.Lock()
+	defer t.Unlock()
+	if status, ok := t.statusMap[name]; ok {
+		return status
+	}
+	return newElasticStatus(name, ``)
+}
+
+func (t *elasticStatusTracker) GetAllStatuses() []elasticStatus {
+	t.Lock()
+	defer t.Unlock()
+	var r []elasticStatus
+	for _, v := range t.statusMap {
+		r = append(r, v)
+	}
+	return r
+}
+
+func (t *elasticStatusTracker) UpdateServer(name string, status elasticStatus) {
+	t.Lock()
+	defer t.Unlock()
+	t.statusMap[name] = status
+}
+
+func (t *elasticStatusTracker) Update(name string, progress ElasticToGravwell) {
+	t.Lock()
+	defer t.Unlock()
+	if status, ok := t.statusMap[name]; ok {
+		status.Update(progress)
+	}
+}
+
+// an elasticStatus keeps track of how much we've migrated from a given Elasticsearch server
+type elasticStatus struct {
+	Name     string // the config name
+	Server   string
+	Progress map[string]ElasticToGravwell
+}
+
+func newElasticStatus(name, server string) elasticStatus {
+	return elasticStatus{Name: name, Server: server, Progress: map[string]ElasticToGravwell{}}
+}
+
+func (s *elasticStatus) GetAll() []ElasticToGravwell {
+	var result []ElasticToGravwell
+	for _, v := range s.Progress {
+		result = append(result, v)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Index < result[j].Index
+	})
+	return result
+}
+
+func (s *elasticStatus) Lookup(index string) (ElasticToGravwell, error) {
+	if result, ok := s.Progress[index]; ok {
+		return result, nil
+	}
+	return ElasticToGravwell{}, ErrNotFound
+}
+
+func (s *elasticStatus) Update(progress ElasticToGravwell) {
+	s.Progress[progress.Index] = progress
+}
+
+// ElasticToGravwell represents migration progress for a single index pattern on an Elasticsearch server.
+type ElasticToGravwell struct {
+	Tag            string    // the gravwell tag
+	Index          string    // the Elasticsearch index pattern
+	ConsumedUpTo   time.Time // all data up until this time stamp (exclusive) has been migrated
+	ConsumeEndTime time.Time // read up to this time stamp. if zero, it'll read until now
+}
+
+func initializeElastic(cfg *cfgType, st *StateTracker) (err error) {
+	cached := newElasticTracker()
+	var obj elasticStatus
+	if err = st.GetStates(elasticStateType, &obj, func(val interface{}) error {
+		s, ok := val.(*elasticStatus)
+		if !ok {
+			return fmt.Errorf("invalid elastic status decode value %T", val)
+		} else if s == nil {
+			return fmt.Errorf("nil elastic status")
+		}
+		// copy the progress map, the decode target is reused for every state entry
+		status := newElasticStatus(s.Name, s.Server)
+		for _, v := range s.Progress {
+			status.Update(v)
+		}
+		cached.UpdateServer(s.Name, status)
+		*s = elasticStatus{}
+		return nil
+	}); err != nil {
+		return fmt.Errorf("Failed to decode elastic states %w", err)
+	}
+	for k, v := range cfg.Elastic {
+		status := newElasticStatus(k, v.Server)
+		c := cached.GetStatus(k)
+		mappings, err := v.ParseMappings()
+		if err != nil {
+			return err
+		}
+		for _, x := range mappings {
+			x.ConsumedUpTo = v.startTime()
+			x.ConsumeEndTime = v.endTime()
+			// resume from any previous progress, the tag always comes from the config
+			if p, err := c.Lookup(x.Index); err == nil {
+				x.ConsumedUpTo = p.ConsumedUpTo
+			}
+			status.Update(x)
+		}
+		elasticTracker.UpdateServer(k, status)
+	}
+	return nil
+}
+
+func elasticJob(cfgName string, progress ElasticToGravwell, cfg *cfgType, ctx context.Context, updateChan chan string) error {
+	lg.Infof("Ingesting index %v into tag %v\n", progress.Index, progress.Tag)
+	tag, err := igst.NegotiateTag(progress.Tag)
+	if err != nil {
+		return err
+	}
+	pproc, err := cfg.getElasticPreprocessors(cfgName, igst)
+	if err != nil {
+		return err
+	}
+	ec, err := cfg.getElasticConn(cfgName)
+	if err != nil {
+		return err
+	}
+	elasticConfig, err := cfg.getElasticConfig(cfgName)
+	if err != nil {
+		return err
+	}
+	slice, err := elasticConfig.sliceDuration()
+	if err != nil {
+		return err
+	}
+	tsField := elasticConfig.timestampField()
+
+	if progress.ConsumedUpTo == elasticConfig.startTime() {
+		// skip ahead to the first document
+		if t, ok, err := ec.MinTime(ctx, progress.Index, tsField); err != nil {
+			lg.Warn("could not determine actual start time of data, beginning at user-configured start time", log.KV("index", progress.Index), log.KVErr(err))
+		} else if ok && t.After(progress.ConsumedUpTo) {
+			lg.Infof("Fast-forwarding ingest job for index %v to actual beginning of data (%v)\n", progress.Index, t)
+			progress.ConsumedUpTo = t
+		}
+	}
+	progress.ConsumedUpTo = progress.ConsumedUpTo.Truncate(time.Second)
+	end := progress.ConsumeEndTime
+	if end.IsZero() || end.Unix() == 0 {
+		end = time.Now()
+	}
+	updateChan <- fmt.Sprintf("Job started, beginning at %v", progress.ConsumedUpTo)
+
+	var count, byteTotal, tsMisses uint64
+	lastTS := progress.ConsumedUpTo
+	cb := func(hit elasticHit) error {
+		ts, ok := hit.Timestamp(tsField)
+		if ok {
+			lastTS = ts
+		} else {
+			// just use whatever we saw last, so it's *close*
+			ts = lastTS
+			tsMisses++
+		}
+		ent := &entry.Entry{
+			TS:   entry.FromStandard(ts),
+			Tag:  tag,
+			Data: []byte(hit.Source),
+		}
+		if err := pproc.ProcessContext(ent, ctx); err != nil {
+			return err
+		}
+		count++
+		byteTotal += ent.Size()
+		return nil
+	}
+
+	mode := ec.SearchMode(ctx, elasticConfig.Search_Mode)
+	startTime := time.Now()
+	for i := 0; progress.ConsumedUpTo.Before(end); i++ {
+		if checkSig(ctx) {
+			return nil
+		}
+		sliceEnd := progress.ConsumedUpTo.Add(slice)
+		if sliceEnd.After(end) {
+			sliceEnd = end
+		}
+		if i%20 == 1 {
+			lg.Infof("Pulling %v from %v to %v\n", progress.Index, progress.ConsumedUpTo, sliceEnd)
+		}
+		if err := ec.Search(ctx, mode, progress.Index, tsField, progress.ConsumedUpTo, sliceEnd, elasticConfig.batchSize(), cb); err != nil {
+			if checkSig(ctx) {
+				// cancelled mid slice, the slice will be retried from the start next time
+				return nil
+			}
+			lg.Error("Error while exporting entries, cancelling job", log.KV("index", progress.Index), log.KV("tag", progress.Tag), log.KV("start", progress.ConsumedUpTo), log.KV("end", sliceEnd), log.KVErr(err))
+			return fmt.Errorf("entry retrieval returned an error: %w", err)
+		}
+		if tsMisses > 0 {
+			lg.Warn("documents missing the timestamp field were given the most recently seen timestamp", log.KV("index", progress.Index), log.KV("field", tsField), log.KV("count", tsMisses), log.KV("start", progress.ConsumedUpTo), log.KV("end", sliceEnd))
+			tsMisses = 0
+		}
+
+		progress.ConsumedUpTo = sliceEnd
+		elasticTracker.Update(cfgName, progress)
+		if *fParanoid {
+			status := elasticTracker.GetStatus(cfgName)
+			st.Add(elasticStateType, status)
+		}
+		elapsed := time.Since(startTime)
+		updateChan <- fmt.Sprintf("Migrated %d entries [%v/%v] up to %v", count, ingest.HumanEntryRate(count, elapsed), ingest.HumanRate(byteTotal, elapsed), progress.ConsumedUpTo)
+	}
+	lg.Info("job completed", log.KV("index", progress.Index), log.KV("tag", progress.Tag), log.KV("end", progress.ConsumedUpTo))
+	return nil
+}
@@ -0,0 +1,422 @@
+/*************************************************************************
+ * Copyright 2024 Gravwell, Inc. All rights reserved.
+ * Contact: <legal@gravwell.io>
+ *
+ * This software may be modified and distributed under the terms of the
+ * BSD 2-clause license. See the LICENSE file for details.
+ **************************************************************************/
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gravwell/gravwell/v3/ingest/processors"
+)
+
+const (
+	stubIndex   = `logs-*`
+	stubTSField = `@timestamp`
+	stubAPIKey  = `testkey`
+)
+
+// elasticStub is a minimal Elasticsearch that serves documents sorted by timestamp
+type elasticStub struct {
+	sync.Mutex
+	t       *testing.T
+	docs    []int64 // document timestamps in epoch millis, the _source holds the index
+	pits    map[string]bool
+	scrolls map[string][]int // open scroll ID to remaining document indexes
+	size    int              // scroll page size
+	nextID  int
+	version string // served as the version number
+	dist    string // served as the version distribution, OpenSearch sets it
+	modes   []string
+}
+
+func newElasticStub(t *testing.T, docs []int64) (*elasticStub, *httptest.Server) {
+	es := &elasticStub{t: t, docs: docs, pits: map[string]bool{}, scrolls: map[string][]int{}, version: `8.11.0`}
+	return es, httptest.NewServer(es)
+}
+
+type stubSearch struct {
+	Size  int `json:"size"`
+	Query struct {
+		Range map[string]struct {
+			Gte int64 `json:"gte"`
+			Lt  int64 `json:"lt"`
+		} `json:"range"`
+	} `json:"query"`
+	Pit struct {
+		ID string `json:"id"`
+	} `json:"pit"`
+	SearchAfter []int64         `json:"search_after"`
+	Sort        json.RawMessage `json:"sort"`
+	Aggs        json.RawMessage `json:"aggs"`
+	ScrollID    string          `json:"scroll_id"`
+	ID          string          `json:"id"`
+}
+
+func (es *elasticStub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	es.Lock()
+	defer es.Unlock()
+	if r.Header.Get("Authorization") != "ApiKey "+stubAPIKey {
+		w.WriteHeader(http.StatusUnauthorized)
+		fmt.Fprintf(w, `{"error":{"type":"security_exception","reason":"missing authentication credentials"},"status":401}`)
+		return
+	}
+	var req stubSearch
+	if r.Body != nil {
+		json.NewDecoder(r.Body).Decode(&req)
+	}
+	switch {
+	case r.Method == http.MethodGet && r.URL.Path == "/":
+		info := map[string]interface{}{"number": es.version}
+		if es.dist != `` {
+			info["distribution"] = es.dist
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"version": info})
+	case r.Method == http.MethodPost && r.URL.Path == "/"+stubIndex+"/_pit":
+		es.nextID++
+		id := fmt.Sprintf("pit%d", es.nextID)
+		es.pits[id] = true
+		json.NewEncoder(w).Encode(map[string]string{"id": id})
+	case r.Method == http.MethodDelete && r.URL.Path == "/_pit":
+		if !es.pits[req.ID] {
+			es.t.Errorf("closing unknown point in time %q", req.ID)
+		}
+		delete(es.pits, req.ID)
+	case r.Method == http.MethodPost && r.URL.Path == "/_search":
+		if !es.pits[req.Pit.ID] {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprintf(w, `{"error":{"type":"search_context_missing_exception","reason":"No search context found"}}`)
+			return
+		}
+		if !strings.Contains(string(req.Sort), `"_shard_doc"`) {
+			es.t.Errorf("point in time search without a tiebreaker: %s", req.Sort)
+		}
+		es.modes = append(es.modes, elasticSearchPIT)
+		// documents are sorted by timestamp then index, the tiebreaker
+		after, afterIdx := int64(-1), -1
+		if len(req.SearchAfter) == 2 {
+			after, afterIdx = req.SearchAfter[0], int(req.SearchAfter[1])
+		} else if req.SearchAfter != nil {
+			es.t.Errorf("bad search_after %v", req.SearchAfter)
+		}
+		idxs := es.match(req)
+		sort.Slice(idxs, func(a, b int) bool {
+			if es.docs[idxs[a]] != es.docs[idxs[b]] {
+				return es.docs[idxs[a]] < es.docs[idxs[b]]
+			}
+			return idxs[a] < idxs[b]
+		})
+		var page []int
+		for _, i := range idxs {
+			if (es.docs[i] > after || (es.docs[i] == after && i > afterIdx)) && len(page) < req.Size {
+				page = append(page, i)
+			}
+		}
+		es.writeHits(w, page, map[string]interface{}{"pit_id": req.Pit.ID})
+	case r.Method == http.MethodPost && r.URL.Path == "/"+stubIndex+"/_search":
+		if len(req.Aggs) > 0 {
+			var min interface{}
+			for _, ts := range es.docs {
+				if min == nil || float64(ts) < min.(float64) {
+					min = float64(ts)
+				}
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"hits":         map[string]interface{}{"hits": []interface{}{}},
+				"aggregations": map[string]interface{}{"min_ts": map[string]interface{}{"value": min}},
+			})
+			return
+		} else if r.URL.Query().Get("scroll") == `` {
+			es.t.Errorf("unexpected search without scroll")
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		es.modes = append(es.modes, elasticSearchScroll)
+		es.nextID++
+		id := fmt.Sprintf("scroll%d", es.nextID)
+		idxs := es.match(req)
+		es.scrolls[id] = idxs
+		es.size = req.Size
+		es.nextScroll(w, id, es.size)
+	case r.Method == http.MethodPost && r.URL.Path == "/_search/scroll":
+		if _, ok := es.scrolls[req.ScrollID]; !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		es.nextScroll(w, req.ScrollID, es.size)
+	case r.Method == http.MethodDelete && r.URL.Path == "/_search/scroll":
+		if _, ok := es.scrolls[req.ScrollID]; !ok {
+			es.t.Errorf("clearing unknown scroll %q", req.ScrollID)
+		}
+		delete(es.scrolls, req.ScrollID)
+	default:
+		es.t.Errorf("unexpected request %v %v", r.Method, r.URL)
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+// match returns the indexes of documents inside the range query
+func (es *elasticStub) match(req stubSearch) (idxs []int) {
+	rng, ok := req.Query.Range[stubTSField]
+	if !ok {
+		es.t.Errorf("search is missing a range on %v", stubTSField)
+		return
+	}
+	for i, ts := range es.docs {
+		if ts >= rng.Gte && ts < rng.Lt {
+			idxs = append(idxs, i)
+		}
+	}
+	return
+}
+
+func (es *elasticStub) nextScroll(w http.ResponseWriter, id string, size int) {
+	idxs := es.scrolls[id]
+	if len(idxs) > size {
+		idxs, es.scrolls[id] = idxs[:size], idxs[size:]
+	} else {
+		es.scrolls[id] = nil
+	}
+	es.writeHits(w, idxs, map[string]interface{}{"_scroll_id": id})
+}
+
+func (es *elasticStub) writeHits(w http.ResponseWriter, idxs []int, resp map[string]interface{}) {
+	hits := []interface{}{}
+	for _, i := range idxs {
+		hits = append(hits, map[string]interface{}{
+			"_index":  "logs-1",
+			"_id":     fmt.Sprintf("%d", i),
+			"_source": map[string]interface{}{"doc": i},
+			"fields":  map[string]interface{}{stubTSField: []string{fmt.Sprintf("%d", es.docs[i])}},
+			"sort":    []int64{es.docs[i], int64(i)},
+		})
+	}
+	resp["hits"] = map[string]interface{}{"hits": hits}
+	json.NewEncoder(w).Encode(resp)
+}
+
+func stubConn(srv *httptest.Server) elasticConn {
+	return elasticConn{BaseURL: srv.URL, APIKey: stubAPIKey, Client: srv.Client()}
+}
+
+func stubDocs() (docs []int64) {
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC).UnixMilli()
+	for i := int64(0); i < 7; i++ {
+		docs = append(docs, base+i*1000)
+	}
+	return
+}
+
+func TestElasticSearch(t *testing.T) {
+	docs := stubDocs()
+	for _, mode := range []string{elasticSearchPIT, elasticSearchScroll} {
+		es, srv := newElasticStub(t, docs)
+		ec := stubConn(srv)
+		start := time.UnixMilli(docs[1])
+		end := time.UnixMilli(docs[6]) // exclusive
+		var got []int64
+		err := ec.Search(context.Background(), mode, stubIndex, stubTSField, start, end, 2, func(hit elasticHit) error {
+			ts, ok := hit.Timestamp(stubTSField)
+			if !ok {
+				return fmt.Errorf("missing timestamp on %v", hit.ID)
+			}
+			var src struct{ Doc int }
+			if err := json.Unmarshal(hit.Source, &src); err != nil {
+				return err
+			} else if docs[src.Doc] != ts.UnixMilli() {
+				return fmt.Errorf("document %d has timestamp %v", src.Doc, ts)
+			}
+			got = append(got, ts.UnixMilli())
+			return nil
+		})
+		srv.Close()
+		if err != nil {
+			t.Fatalf("%s search failed: %v", mode, err)
+		}
+		if len(got) != 5 {
+			t.Fatalf("%s search returned %d documents, expected 5", mode, len(got))
+		}
+		for i := range got {
+			if got[i] != docs[i+1] {
+				t.Fatalf("%s search returned %v, expected %v", mode, got, docs[1:6])
+			}
+		}
+		if len(es.pits) != 0 || len(es.scrolls) != 0 {
+			t.Fatalf("%s search left open contexts: %v %v", mode, es.pits, es.scrolls)
+		}
+	}
+}
+
+// TestElasticSearchTiebreaker checks that documents sharing a timestamp across a page
+// boundary are neither skipped nor repeated
+func TestElasticSearchTiebreaker(t *testing.T) {
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC).UnixMilli()
+	docs := []int64{base, base + 1000, base + 1000, base + 1000, base + 1000, base + 2000}
+	for _, mode := range []string{elasticSearchPIT, elasticSearchScroll} {
+		es, srv := newElasticStub(t, docs)
+		ec := stubConn(srv)
+		seen := map[int]int{}
+		err := ec.Search(context.Background(), mode, stubIndex, stubTSField, time.UnixMilli(base), time.UnixMilli(base+3000), 2, func(hit elasticHit) error {
+			var src struct{ Doc int }
+			if err := json.Unmarshal(hit.Source, &src); err != nil {
+				return err
+			}
+			seen[src.Doc]++
+			return nil
+		})
+		srv.Close()
+		if err != nil {
+			t.Fatalf("%s search failed: %v", mode, err)
+		}
+		for i := range docs {
+			if seen[i] != 1 {
+				t.Fatalf("%s search returned document %d %d times", mode, i, seen[i])
+			}
+		}
+		if len(es.pits) != 0 || len(es.scrolls) != 0 {
+			t.Fatalf("%s search left open contexts: %v %v", mode, es.pits, es.scrolls)
+		}
+	}
+}
+
+func TestElasticSearchMode(t *testing.T) {
+	tests := []struct {
+		mode, version, dist string
+		want                string
+	}{
+		{``, `8.11.0`, ``, elasticSearchScroll},
+		{elasticSearchScroll, `8.11.0`, ``, elasticSearchScroll},
+		{elasticSearchPIT, `8.11.0`, ``, elasticSearchPIT},
+		{elasticSearchPIT, `7.12.0`, ``, elasticSearchPIT},
+		{elasticSearchPIT, `7.11.2`, ``, elasticSearchScroll},
+		{elasticSearchPIT, `6.8.0`, ``, elasticSearchScroll},
+		{elasticSearchPIT, `2.11.0`, `opensearch`, elasticSearchScroll},
+		{elasticSearchPIT, `garbage`, ``, elasticSearchScroll},
+	}
+	for _, tt := range tests {
+		es, srv := newElasticStub(t, stubDocs())
+		es.version, es.dist = tt.version, tt.dist
+		ec := stubConn(srv)
+		mode := ec.SearchMode(context.Background(), tt.mode)
+		if mode != tt.want {
+			t.Errorf("%q on %s %s resolved to %q, expected %q", tt.mode, tt.dist, tt.version, mode, tt.want)
+		}
+		err := ec.Search(context.Background(), mode, stubIndex, stubTSField, time.Unix(0, 0), time.Now(), 2, func(elasticHit) error { return nil })
+		srv.Close()
+		if err != nil {
+			t.Fatal(err)
+		} else if len(es.modes) == 0 || es.modes[0] != tt.want {
+			t.Errorf("%q on %s %s searched with %v", tt.mode, tt.dist, tt.version, es.modes)
+		}
+	}
+
+	// the version check needs cluster privileges, if it fails the configured mode is kept
+	_, srv := newElasticStub(t, nil)
+	ec := stubConn(srv)
+	ec.APIKey = `wrong`
+	if mode := ec.SearchMode(context.Background(), elasticSearchPIT); mode != elasticSearchPIT {
+		t.Errorf("failed version check resolved to %q", mode)
+	}
+	srv.Close()
+}
+
+func TestElasticSearchCallbackError(t *testing.T) {
+	es, srv := newElasticStub(t, stubDocs())
+	defer srv.Close()
+	ec := stubConn(srv)
+	errStop := fmt.Errorf("stop")
+	err := ec.Search(context.Background(), elasticSearchPIT, stubIndex, stubTSField, time.Unix(0, 0), time.Now(), 2, func(hit elasticHit) error {
+		return errStop
+	})
+	if err != errStop {
+		t.Fatalf("expected callback error, got %v", err)
+	} else if len(es.pits) != 0 {
+		t.Fatalf("point in time was not closed")
+	}
+}
+
+func TestElasticMinTime(t *testing.T) {
+	docs := stubDocs()
+	_, srv := newElasticStub(t, docs)
+	defer srv.Close()
+	ec := stubConn(srv)
+	ts, ok, err := ec.MinTime(context.Background(), stubIndex, stubTSField)
+	if err != nil {
+		t.Fatal(err)
+	} else if !ok || ts.UnixMilli() != docs[0] {
+		t.Fatalf("bad min time %v %v", ts, ok)
+	}
+}
+
+func TestElasticAuthError(t *testing.T) {
+	_, srv := newElasticStub(t, nil)
+	defer srv.Close()
+	ec := stubConn(srv)
+	ec.APIKey = ``
+	if _, _, err := ec.MinTime(context.Background(), stubIndex, stubTSField); err == nil {
+		t.Fatal("missing credentials did not fail")
+	} else if !strings.Contains(err.Error(), "security_exception") {
+		t.Fatalf("error does not include the Elasticsearch reason: %v", err)
+	}
+}
+
+func TestElasticBaseURL(t *testing.T) {
+	tests := map[string]string{
+		`elastic.example.com`:            `https://elastic.example.com:9200`,
+		`elastic.example.com:443`:        `https://elastic.example.com:443`,
+		`http://localhost:9200/`:         `http://localhost:9200`,
+		`https://opensearch.example.com`: `https://opensearch.example.com`,
+	}
+	for in, out := range tests {
+		if v := elasticBaseURL(in); v != out {
+			t.Errorf("%q became %q, expected %q", in, v, out)
+		}
+	}
+}
+
+func TestElasticConfig(t *testing.T) {
+	good := elastic{
+		Server:       `localhost`,
+		Index_To_Tag: []string{`logs-*,logs`, `"metrics-a,metrics-b",metrics`},
+	}
+	if err := good.Validate(processors.ProcessorConfig{}); err != nil {
+		t.Fatal(err)
+	} else if good.batchSize() != defaultElasticBatchSize {
+		t.Fatalf("unset Batch-Size became %d", good.batchSize())
+	}
+	if mps, err := good.ParseMappings(); err != nil {
+		t.Fatal(err)
+	} else if len(mps) != 2 || mps[1].Index != `metrics-a,metrics-b` || mps[1].Tag != `metrics` {
+		t.Fatalf("bad mappings %+v", mps)
+	}
+
+	bad := []elastic{
+		{},
+		{Server: `localhost`, Index_To_Tag: []string{`logs-*`}},
+		{Server: `localhost`, Index_To_Tag: []string{`logs-*,bad tag`}},
+		{Server: `localhost`, Index_To_Tag: []string{`logs-*,a`, `logs-*,b`}},
+		{Server: `localhost`, Search_Mode: `sql`},
+		{Server: `localhost`, Slice_Duration: `soon`},
+		{Server: `localhost`, Batch_Size: maxElasticBatchSize + 1},
+		{Server: `localhost`, Batch_Size: -1},
+		{Server: `localhost`, API_Key: `key`, Username: `user`},
+	}
+	for i, e := range bad {
+		if err := e.Validate(processors.ProcessorConfig{}); err == nil {
+			t.Errorf("bad config %d passed validation", i)
+		}
+	}
+}
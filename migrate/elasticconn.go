@@ -0,0 +1,343 @@
+/*************************************************************************
+ * Copyright 2024 Gravwell, Inc. All rights reserved.
+ * Contact: <legal@gravwell.io>
+ *
+ * This software may be modified and distributed under the terms of the
+ * BSD 2-clause license. See the LICENSE file for details.
+ **************************************************************************/
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gravwell/gravwell/v3/ingest/config"
+	"github.com/gravwell/gravwell/v3/ingest/log"
+)
+
+const (
+	defaultElasticPort = 9200
+	elasticKeepAlive   = `2m`
+
+	elasticSearchPIT    = `pit`    // point in time with search_after, Elasticsearch 7.12 and newer
+	elasticSearchScroll = `scroll` // the scroll API, supported by Elasticsearch and OpenSearch, the default
+
+	elasticDistOpenSearch = `opensearch`
+)
+
+var (
+	// the first Elasticsearch version with the _shard_doc tiebreaker used by point in time searches
+	elasticMinPITVersion = [2]int{7, 12}
+)
+
+type elasticConn struct {
+	BaseURL  string // e.g. "https://elastic.example.com:9200"
+	Username string
+	Password string
+	APIKey   string
+	Client   *http.Client
+}
+
+func newElasticConn(server, username, password, apiKey string) elasticConn {
+	tr := &http.Transport{
+		TLSClientConfig: &tls.Config{
+			InsecureSkipVerify: *fInsecureSkipTlsVerify,
+		}, // ignore expired SSL certificates
+	}
+	client := &http.Client{Transport: tr}
+	return elasticConn{
+		BaseURL:  elasticBaseURL(server),
+		Username: username,
+		Password: password,
+		APIKey:   apiKey,
+		Client:   client,
+	}
+}
+
+// elasticBaseURL turns a server into a URL, servers without a scheme default to https on port 9200
+func elasticBaseURL(server string) string {
+	if strings.Contains(server, "://") {
+		return strings.TrimRight(server, "/")
+	}
+	return fmt.Sprintf("https://%s", config.AppendDefaultPort(server, defaultElasticPort))
+}
+
+type elasticError struct {
+	Error struct {
+		Type   string `json:"type"`
+		Reason string `json:"reason"`
+	} `json:"error"`
+}
+
+type elasticHit struct {
+	Index  string                       `json:"_index"`
+	ID     string                       `json:"_id"`
+	Source json.RawMessage              `json:"_source"`
+	Fields map[string][]json.RawMessage `json:"fields"`
+	Sort   []json.RawMessage            `json:"sort"`
+}
+
+type elasticSearchResponse struct {
+	ScrollID string `json:"_scroll_id"`
+	PitID    string `json:"pit_id"`
+	Hits     struct {
+		Hits []elasticHit `json:"hits"`
+	} `json:"hits"`
+	Aggregations map[string]struct {
+		Value *float64 `json:"value"`
+	} `json:"aggregations"`
+}
+
+type elasticInfo struct {
+	Version struct {
+		Number       string `json:"number"`
+		Distribution string `json:"distribution"` // only set by OpenSearch
+	} `json:"version"`
+}
+
+type elasticCallback func(elasticHit) error
+
+// do sends a JSON request and decodes the JSON response into out, if out is non-nil
+func (c *elasticConn) do(ctx context.Context, method, pth string, body, out interface{}) (err error) {
+	var rdr io.Reader
+	if body != nil {
+		var b []byte
+		if b, err = json.Marshal(body); err != nil {
+			return
+		}
+		rdr = bytes.NewReader(b)
+	}
+	var req *http.Request
+	var resp *http.Response
+	if req, err = http.NewRequestWithContext(ctx, method, c.BaseURL+pth, rdr); err != nil {
+		return
+	}
+	if body != nil {
+		req.Header.Add("Content-Type", "application/json")
+	}
+	if c.APIKey != `` {
+		req.Header.Add("Authorization", fmt.Sprintf("ApiKey %s", c.APIKey))
+	} else if c.Username != `` {
+		req.SetBasicAuth(c.Username, c.Password)
+	}
+	if resp, err = c.Client.Do(req); err != nil {
+		return
+	}
+	defer resp.Body.Close()
+	var b []byte
+	if b, err = ioutil.ReadAll(resp.Body); err != nil {
+		return
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		var ee elasticError
+		if json.Unmarshal(b, &ee) == nil && ee.Error.Reason != `` {
+			return fmt.Errorf("%s: %s %s", resp.Status, ee.Error.Type, ee.Error.Reason)
+		}
+		return fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(b)))
+	}
+	if out != nil {
+		err = json.Unmarshal(b, out)
+	}
+	return
+}
+
+func elasticRangeQuery(field string, start, end time.Time) map[string]interface{} {
+	return map[string]interface{}{
+		"range": map[string]interface{}{
+			field: map[string]interface{}{
+				"gte":    start.UnixMilli(),
+				"lt":     end.UnixMilli(),
+				"format": "epoch_millis",
+			},
+		},
+	}
+}
+
+// MinTime returns the earliest value of the timestamp field in an index pattern,
+// ok is false if the index holds no documents.
+func (c *elasticConn) MinTime(ctx context.Context, index, field string) (t time.Time, ok bool, err error) {
+	req := map[string]interface{}{
+		"size": 0,
+		"aggs": map[string]interface{}{
+			"min_ts": map[string]interface{}{
+				"min": map[string]interface{}{"field": field},
+			},
+		},
+	}
+	var resp elasticSearchResponse
+	if err = c.do(ctx, http.MethodPost, fmt.Sprintf("/%s/_search", url.PathEscape(index)), req, &resp); err != nil {
+		return
+	}
+	if agg, exists := resp.Aggregations["min_ts"]; exists && agg.Value != nil {
+		t, ok = time.UnixMilli(int64(*agg.Value)).UTC(), true
+	}
+	return
+}
+
+// Info returns the server version, which tells Elasticsearch and OpenSearch apart
+func (c *elasticConn) Info(ctx context.Context) (info elasticInfo, err error) {
+	err = c.do(ctx, http.MethodGet, "/", nil, &info)
+	return
+}
+
+// pitSupported reports if the server supports point in time searches with the _shard_doc
+// tiebreaker. OpenSearch uses a different point in time API and is not supported.
+func (info elasticInfo) pitSupported() error {
+	if strings.EqualFold(info.Version.Distribution, elasticDistOpenSearch) {
+		return errors.New("OpenSearch does not support Elasticsearch point in time searches")
+	}
+	var major, minor int
+	if _, err := fmt.Sscanf(info.Version.Number, "%d.%d", &major, &minor); err != nil {
+		return fmt.Errorf("invalid Elasticsearch version %q", info.Version.Number)
+	}
+	if major < elasticMinPITVersion[0] || (major == elasticMinPITVersion[0] && minor < elasticMinPITVersion[1]) {
+		return fmt.Errorf("Elasticsearch %s is older than %d.%d", info.Version.Number, elasticMinPITVersion[0], elasticMinPITVersion[1])
+	}
+	return nil
+}
+
+// SearchMode resolves the configured search mode against the server, point in time
+// searches fall back to scroll if the server does not support them.
+func (c *elasticConn) SearchMode(ctx context.Context, mode string) string {
+	if mode != elasticSearchPIT {
+		return elasticSearchScroll
+	}
+	info, err := c.Info(ctx)
+	if err != nil {
+		lg.Warn("could not get the Elasticsearch version, assuming point in time searches are supported", log.KV("server", c.BaseURL), log.KVErr(err))
+		return mode
+	} else if err = info.pitSupported(); err != nil {
+		lg.Warn("point in time searches are not supported, using scroll", log.KV("server", c.BaseURL), log.KVErr(err))
+		return elasticSearchScroll
+	}
+	return mode
+}
+
+// Search walks every document in the index pattern with a timestamp in [start, end), in
+// batches of size documents. The callback is called once per document.
+func (c *elasticConn) Search(ctx context.Context, mode, index, field string, start, end time.Time, size int, cb elasticCallback) error {
+	switch mode {
+	case elasticSearchScroll, ``:
+		return c.searchScroll(ctx, index, field, start, end, size, cb)
+	case elasticSearchPIT:
+		return c.searchPIT(ctx, index, field, start, end, size, cb)
+	}
+	return fmt.Errorf("unknown search mode %q", mode)
+}
+
+// searchPIT pages through a point in time with search_after. The _shard_doc tiebreaker keeps
+// documents with the same timestamp from being skipped or repeated at page boundaries, it
+// requires Elasticsearch 7.12 or newer.
+func (c *elasticConn) searchPIT(ctx context.Context, index, field string, start, end time.Time, size int, cb elasticCallback) (err error) {
+	var pit struct {
+		ID string `json:"id"`
+	}
+	if err = c.do(ctx, http.MethodPost, fmt.Sprintf("/%s/_pit?keep_alive=%s", url.PathEscape(index), elasticKeepAlive), nil, &pit); err != nil {
+		return
+	} else if pit.ID == `` {
+		return errors.New("no point in time ID returned")
+	}
+	// Clean up on the way out, the job context may already be cancelled
+	defer func() {
+		if err := c.do(context.Background(), http.MethodDelete, "/_pit", map[string]string{"id": pit.ID}, nil); err != nil {
+			lg.Warn("failed to close Elasticsearch point in time", log.KV("index", index), log.KVErr(err))
+		}
+	}()
+
+	req := map[string]interface{}{
+		"size":             size,
+		"query":            elasticRangeQuery(field, start, end),
+		"pit":              map[string]string{"id": pit.ID, "keep_alive": elasticKeepAlive},
+		"sort":             []interface{}{map[string]string{field: "asc"}, map[string]string{"_shard_doc": "asc"}},
+		"docvalue_fields":  []interface{}{map[string]string{"field": field, "format": "epoch_millis"}},
+		"track_total_hits": false,
+	}
+	for {
+		var resp elasticSearchResponse
+		if err = c.do(ctx, http.MethodPost, "/_search", req, &resp); err != nil {
+			return
+		}
+		hits := resp.Hits.Hits
+		for i := range hits {
+			if err = cb(hits[i]); err != nil {
+				return
+			}
+		}
+		if len(hits) < size {
+			return
+		}
+		// the point in time ID may change between requests
+		if resp.PitID != `` {
+			pit.ID = resp.PitID
+			req["pit"] = map[string]string{"id": pit.ID, "keep_alive": elasticKeepAlive}
+		}
+		req["search_after"] = hits[len(hits)-1].Sort
+	}
+}
+
+func (c *elasticConn) searchScroll(ctx context.Context, index, field string, start, end time.Time, size int, cb elasticCallback) (err error) {
+	req := map[string]interface{}{
+		"size":            size,
+		"query":           elasticRangeQuery(field, start, end),
+		"sort":            []string{"_doc"},
+		"docvalue_fields": []interface{}{map[string]string{"field": field, "format": "epoch_millis"}},
+	}
+	var resp elasticSearchResponse
+	if err = c.do(ctx, http.MethodPost, fmt.Sprintf("/%s/_search?scroll=%s", url.PathEscape(index), elasticKeepAlive), req, &resp); err != nil {
+		return
+	}
+	scrollID := resp.ScrollID
+	defer func() {
+		if scrollID == `` {
+			return
+		}
+		if err := c.do(context.Background(), http.MethodDelete, "/_search/scroll", map[string]string{"scroll_id": scrollID}, nil); err != nil {
+			lg.Warn("failed to clear Elasticsearch scroll", log.KV("index", index), log.KVErr(err))
+		}
+	}()
+	for {
+		hits := resp.Hits.Hits
+		for i := range hits {
+			if err = cb(hits[i]); err != nil {
+				return
+			}
+		}
+		if len(hits) == 0 || scrollID == `` {
+			return
+		}
+		next := map[string]string{"scroll": elasticKeepAlive, "scroll_id": scrollID}
+		resp = elasticSearchResponse{}
+		if err = c.do(ctx, http.MethodPost, "/_search/scroll", next, &resp); err != nil {
+			return
+		}
+		if resp.ScrollID != `` {
+			scrollID = resp.ScrollID
+		}
+	}
+}
+
+// Timestamp returns the epoch_millis docvalue of the timestamp field requested in the search
+func (h elasticHit) Timestamp(field string) (t time.Time, ok bool) {
+	vals := h.Fields[field]
+	if len(vals) == 0 {
+		return
+	}
+	v := strings.Trim(strings.TrimSpace(string(vals[0])), `"`)
+	ms, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		return
+	}
+	return time.Unix(0, int64(ms*float64(time.Millisecond))), true
+}
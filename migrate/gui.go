@@ -185,6 +185,7 @@ func mainMenu() {
 	menu.Clear().SetTitle("Main Menu")
 	menu.AddItem("Files", "Import files from the disk", 'f', fileMenu)
 	menu.AddItem("Splunk", "Import data from Splunk", 's', splunkServerMenu)
+	menu.AddItem("Elastic", "Import data from Elasticsearch or OpenSearch", 'e', elasticServerMenu)
 	menu.AddItem("Quit", "", 'q', func() {
 		guiQuit()
 	})
@@ -400,6 +401,57 @@ func startMigrate(cfgName string, progress SplunkToGravwell) {
 	jobs.AddItem(j.IdString(), "Starting...", 0, nil)
 }
 
+func elasticServerMenu() {
+	menu.Clear().SetTitle("Select Elastic Server")
+	for k, v := range cfg.Elastic {
+		name := k
+		menu.AddItem(k, fmt.Sprintf("%v", v.Server), 0, func() {
+			elasticMigrateMenu(name)
+		})
+	}
+	menu.AddItem("Exit", "Previous menu", 'x', mainMenu)
+}
+
+func elasticMigrateMenu(cfgName string) {
+	status := elasticTracker.GetStatus(cfgName)
+	progresses := status.GetAll()
+	menu.Clear().SetTitle("Migrate elastic data")
+	menu.AddItem("Exit", "Previous menu", 'x', elasticServerMenu)
+	menu.AddItem("Refresh", "Update migration progress", 'r', func() { elasticMigrateMenu(cfgName) })
+	menu.AddItem("Start All", "Launch all jobs (use this with care!)", 0, func() {
+		for i := range progresses {
+			startElasticMigrate(cfgName, progresses[i])
+		}
+	})
+	menu.AddItem("", "", 0, nil)
+	for i := range progresses {
+		x := progresses[i]
+		f := func() {
+			startElasticMigrate(cfgName, x)
+		}
+		timeMsg := fmt.Sprintf("Starting from %v", x.ConsumedUpTo)
+		if !x.ConsumeEndTime.IsZero() && x.ConsumeEndTime.Unix() != 0 {
+			timeMsg = fmt.Sprintf("From %v to %v", x.ConsumedUpTo, x.ConsumeEndTime)
+		}
+		menu.AddItem(fmt.Sprintf("%s -> %s", x.Index, x.Tag), timeMsg, 0, f)
+	}
+}
+
+func startElasticMigrate(cfgName string, progress ElasticToGravwell) {
+	// always start from the latest checkpoint, the menu entry may be stale
+	status := elasticTracker.GetStatus(cfgName)
+	if p, err := status.Lookup(progress.Index); err == nil {
+		progress = p
+	}
+	j := jt.StartElasticJob(cfgName, progress)
+	if j == nil {
+		return
+	}
+	jobLock.Lock()
+	defer jobLock.Unlock()
+	jobs.AddItem(j.IdString(), "Starting...", 0, nil)
+}
+
 func toggleHelp() {
 	if !helpActive {
 		bigHelp := tview.NewTextView().SetChangedFunc(func() {
@@ -138,6 +138,32 @@ func (t *jobTracker) StartSplunkJob(cfgName string, progress SplunkToGravwell) *
 	return j
 }
 
+func (t *jobTracker) StartElasticJob(cfgName string, progress ElasticToGravwell) *job {
+	t.Lock()
+	defer t.Unlock()
+	key := fmt.Sprintf("elastic:%s:%s", cfgName, progress.Index)
+	if j, ok := t.jobs[key]; ok {
+		if !j.done {
+			return nil
+		}
+	}
+	ctx, cf := context.WithCancel(context.Background())
+	updateChan := make(chan string, 1000)
+	infostr := fmt.Sprintf("Elastic %s index %s", cfgName, progress.Index)
+	j := &job{cf: cf, updates: updateChan, id: t.id, name: infostr}
+	t.jobs[key] = j
+	t.id++
+	go func() {
+		err := elasticJob(cfgName, progress, t.cfg, ctx, updateChan)
+		if err != nil {
+			lg.Warnf("Job returned %v", err)
+			updateChan <- fmt.Sprintf("Job returned error: %v", err)
+		}
+		t.done(key)
+	}()
+	return j
+}
+
 func (t *jobTracker) done(key string) {
 	t.Lock()
 	defer t.Unlock()
@@ -27,7 +27,7 @@ var (
 	verbose   = flag.Bool("v", false, "Display verbose status updates to stdout")
 	ver       = flag.Bool("version", false, "Print the version information and exit")
 	status    = flag.Bool("status", false, "Print status updates and ingest rate")
-	fParanoid = flag.Bool("paranoid", false, "Update the state file every time Splunk grabs a chunk (this can lead to really big state files!)")
+	fParanoid = flag.Bool("paranoid", false, "Update the state file every time Splunk or Elastic grabs a chunk (this can lead to really big state files!)")
 	v         bool
 	lg        *log.Logger
 	src       net.IP
@@ -41,19 +41,20 @@ var (
 
 func init() {
 	v = true
+	lg = log.New(&discard{})
+	//lg.AddWriter(os.Stderr)
+	lg.SetAppname(appName)
+}
+
+func main() {
 	flag.Parse()
 	if *ver {
 		version.PrintVersion(os.Stdout)
 		ingest.PrintVersion(os.Stdout)
 		os.Exit(0)
 	}
-	lg = log.New(&discard{})
-	//lg.AddWriter(os.Stderr)
-	lg.SetAppname(appName)
 	validate.ValidateIngesterConfig(GetConfig, *confLoc, *confdLoc)
-}
 
-func main() {
 	// Make a local writer so we can write to the console if something goes wrong
 	llg := log.New(&discard{})
 	llg.AddWriter(os.Stderr)
@@ -102,6 +103,9 @@ func main() {
 	} else if stop {
 		return
 	}
+	if err := initializeElastic(cfg, st); err != nil {
+		llg.FatalCode(0, "Failed to initialize elastic", log.KVErr(err))
+	}
 
 	igst = getIngestConnection(cfg, lg)
 
@@ -111,6 +115,9 @@ func main() {
 	for _, v := range splunkTracker.GetAllStatuses() {
 		st.Add(splunkStateType, v)
 	}
+	for _, v := range elasticTracker.GetAllStatuses() {
+		st.Add(elasticStateType, v)
+	}
 
 	if err = igst.Close(); err != nil {
 		st.Close()
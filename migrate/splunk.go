@@ -13,7 +13,6 @@ import (
 	"encoding/csv"
 	"errors"
 	"fmt"
-	"math"
 	"sort"
 	"strconv"
 	"strings"
@@ -24,6 +23,7 @@ import (
 	"github.com/gravwell/gravwell/v3/ingest/entry"
 	"github.com/gravwell/gravwell/v3/ingest/log"
 	"github.com/gravwell/gravwell/v3/ingest/processors"
+	"github.com/gravwell/gravwell/v3/timegrinder"
 )
 
 const (
@@ -301,7 +301,8 @@ func splunkJob(cfgName string, progress SplunkToGravwell, cfg *cfgType, ctx cont
 	if err != nil {
 		return err
 	}
-	pproc, err := cfg.getSplunkPreprocessors(cfgName, igst)
+	mapping := cfg.getSplunkMapping(cfgName, progress.Index, progress.Sourcetype)
+	pproc, err := cfg.getSplunkPreprocessors(cfgName, mapping, igst)
 	if err != nil {
 		return err
 	}
@@ -313,6 +314,21 @@ func splunkJob(cfgName string, progress SplunkToGravwell, cfg *cfgType, ctx cont
 	if err != nil {
 		return err
 	}
+	tsField := mapping.timestampField()
+	attachFields := mapping.attachFields(splunkConfig.Disable_Intrinsics)
+	var tg *timegrinder.TimeGrinder
+	if tsField != splunkEpochName {
+		// a user specified timestamp field may not hold epoch times, fall back to timegrinder
+		if tg, err = timegrinder.New(timegrinder.Config{EnableLeftMostSeed: true}); err != nil {
+			return err
+		} else if err = cfg.TimeFormat.LoadFormats(tg); err != nil {
+			return err
+		} else if mapping.Timestamp_Format_Override != `` {
+			if err = tg.SetFormatOverride(mapping.Timestamp_Format_Override); err != nil {
+				return err
+			}
+		}
+	}
 	if progress.ConsumedUpTo == splunkConfig.startTime() {
 		// try to figure out when we should start
 		var indexes []splunkEntry
@@ -351,19 +367,28 @@ func splunkJob(cfgName string, progress SplunkToGravwell, cfg *cfgType, ctx cont
 		var ts time.Time
 		var data string
 		var ok bool
-		if x, ok := s["epoch_time"]; ok {
-			x = strings.Trim(strings.TrimSpace(x), `"`)
-			if f, err := strconv.ParseFloat(x, 64); err == nil {
-				sec, dec := math.Modf(f)
-				ts = time.Unix(int64(sec), int64(dec*(1e9)))
+		if x, ok := s[tsField]; ok {
+			if t, ok := parseEpoch(x); ok {
+				ts = t
+				lastTS = ts
+			} else if t, ok, err := extractTS(tg, x); ok {
+				ts = t
 				lastTS = ts
 			} else {
-				lg.Warn("Failed to parse timestamp", log.KV("epoch_time", x), log.KV("index", progress.Index), log.KV("sourcetype", progress.Sourcetype), log.KV("tag", progress.Tag), log.KVErr(err))
+				lg.Warn("Failed to parse timestamp", log.KV(tsField, x), log.KV("index", progress.Index), log.KV("sourcetype", progress.Sourcetype), log.KV("tag", progress.Tag), log.KVErr(err))
 				// just use whatever we saw last, so it's *close*
 				ts = lastTS
 			}
+		} else if x, ok := s[splunkEpochName]; ok && tsField != splunkEpochName {
+			// the configured timestamp field is missing, fall back to the Splunk timestamp
+			if t, ok := parseEpoch(x); ok {
+				ts = t
+				lastTS = ts
+			} else {
+				ts = lastTS
+			}
 		} else {
-			lg.Warn("No epoch_time field, using the most recently seen timestamp", log.KV("timestamp", x), log.KV("index", progress.Index), log.KV("sourcetype", progress.Sourcetype), log.KV("tag", progress.Tag))
+			lg.Warn("No timestamp field, using the most recently seen timestamp", log.KV("field", tsField), log.KV("index", progress.Index), log.KV("sourcetype", progress.Sourcetype), log.KV("tag", progress.Tag))
 			ts = lastTS
 		}
 		if data, ok = s["_raw"]; !ok {
@@ -379,14 +404,17 @@ func splunkJob(cfgName string, progress SplunkToGravwell, cfg *cfgType, ctx cont
 		// Now add in everything else, provided they've enabled it
 		for k, v := range s {
 			entSize += len(v)
-			if !splunkConfig.Disable_Intrinsics {
-				if k == "_raw" {
+			if attachFields {
+				if k == splunkRawField {
 					continue
 				}
 				// Trim space and quotes on the name, just to be sure
 				k = strings.TrimSpace(k)
 				k = strings.Trim(k, `"`)
-				ev, err := entry.NewEnumeratedValue(k, v)
+				if !mapping.allow(k) {
+					continue
+				}
+				ev, err := mapping.enumeratedValue(k, v)
 				if err != nil {
 					// we'll only warn once
 					warnCount, _ := evWarnings[k]
@@ -463,10 +491,7 @@ func splunkJob(cfgName string, progress SplunkToGravwell, cfg *cfgType, ctx cont
 
 		// run query with current earliest=ConsumedUpTo, latest=ConsumedUpTo+60m
 		oldCount := count
-		query := fmt.Sprintf("search index=\"%s\" sourcetype=\"%s\" | rename _time AS epoch_time | table *", progress.Index, progress.Sourcetype)
-		if splunkConfig.Disable_Intrinsics {
-			query = fmt.Sprintf("search index=\"%s\" sourcetype=\"%s\" | rename _time AS epoch_time | table epoch_time _raw", progress.Index, progress.Sourcetype)
-		}
+		query := mapping.query(progress.Index, progress.Sourcetype, splunkConfig.Disable_Intrinsics)
 		if err := sc.RunExportSearch(query, progress.ConsumedUpTo, end, true, expectedCount+100, cb); err != nil {
 			lg.Error("Error while exporting entries, cancelling job", log.KV("index", progress.Index), log.KV("sourcetype", progress.Sourcetype), log.KV("tag", progress.Tag), log.KV("start", progress.ConsumedUpTo), log.KV("end", end), log.KVErr(err))
 			return fmt.Errorf("entry retrieval query returned an error: %w", err)
@@ -0,0 +1,318 @@
+/*************************************************************************
+ * Copyright 2024 Gravwell, Inc. All rights reserved.
+ * Contact: <legal@gravwell.io>
+ *
+ * This software may be modified and distributed under the terms of the
+ * BSD 2-clause license. See the LICENSE file for details.
+ **************************************************************************/
+
+package main
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gravwell/gravwell/v3/ingest/entry"
+	"github.com/gravwell/gravwell/v3/ingest/processors"
+	"github.com/gravwell/gravwell/v3/timegrinder"
+)
+
+const (
+	splunkTimeField = `_time`
+	splunkRawField  = `_raw`
+	splunkEpochName = `epoch_time` // _time is renamed to this in the export query
+)
+
+const (
+	fieldTypeString   = `string`
+	fieldTypeInt      = `int`
+	fieldTypeUint     = `uint`
+	fieldTypeFloat    = `float`
+	fieldTypeBool     = `bool`
+	fieldTypeIP       = `ip`
+	fieldTypeMAC      = `mac`
+	fieldTypeTS       = `timestamp`
+	fieldTypeDuration = `duration`
+)
+
+// splunkMapping controls how entries from a single index (and optionally sourcetype) on a
+// Splunk server are converted to Gravwell entries.
+type splunkMapping struct {
+	Splunk                    string   // name of the Splunk stanza this mapping applies to
+	Index                     string   // the Splunk index
+	Sourcetype                string   // the Splunk sourcetype, if empty the mapping applies to every sourcetype in the index
+	Field                     []string // allow list of Splunk fields to attach as enumerated values, if empty all fields are attached
+	Rename                    []string // "splunk field,EV name" rename rules
+	Field_Type                []string // "splunk field,type" coercion rules
+	Timestamp_Field           string   // the Splunk field used as the entry timestamp, defaults to _time
+	Timestamp_Format_Override string   // timegrinder format for Timestamp-Field values which are not unix epoch times
+	Preprocessor              []string // preprocessors applied before the Splunk stanza preprocessors
+
+	renames map[string]string
+	types   map[string]string
+	allowed map[string]bool
+}
+
+func (m *splunkMapping) Validate(procs processors.ProcessorConfig) (err error) {
+	if m.Splunk == `` {
+		return errors.New("No Splunk stanza specified")
+	} else if m.Index == `` {
+		return errors.New("No Splunk index specified")
+	}
+	m.Timestamp_Field = strings.TrimSpace(m.Timestamp_Field)
+	if m.Timestamp_Field == splunkRawField {
+		return errors.New("_raw cannot be used as the timestamp field")
+	}
+	if m.Timestamp_Format_Override != `` {
+		if m.Timestamp_Field == `` || m.Timestamp_Field == splunkTimeField {
+			return errors.New("Timestamp-Format-Override requires a Timestamp-Field")
+		}
+		var tg *timegrinder.TimeGrinder
+		if tg, err = timegrinder.New(timegrinder.Config{}); err != nil {
+			return
+		} else if err = tg.SetFormatOverride(m.Timestamp_Format_Override); err != nil {
+			return fmt.Errorf("Invalid Timestamp-Format-Override %q: %v", m.Timestamp_Format_Override, err)
+		}
+	}
+
+	m.allowed = make(map[string]bool, len(m.Field))
+	for _, f := range m.Field {
+		if f = strings.TrimSpace(f); f == `` || f == splunkRawField {
+			return fmt.Errorf("Invalid field %q", f)
+		}
+		m.allowed[f] = true
+	}
+
+	m.renames = make(map[string]string, len(m.Rename))
+	for _, r := range m.Rename {
+		var from, to string
+		if from, to, err = parseFieldPair(r); err != nil {
+			return fmt.Errorf("Invalid Rename: %v", err)
+		} else if len(to) > entry.MaxEvNameLength {
+			return fmt.Errorf("Invalid Rename %q: name is too long", r)
+		} else if _, ok := m.renames[from]; ok {
+			return fmt.Errorf("Field %q is renamed more than once", from)
+		}
+		m.renames[from] = to
+	}
+
+	m.types = make(map[string]string, len(m.Field_Type))
+	for _, t := range m.Field_Type {
+		var name, tp string
+		if name, tp, err = parseFieldPair(t); err != nil {
+			return fmt.Errorf("Invalid Field-Type: %v", err)
+		}
+		tp = strings.ToLower(tp)
+		switch tp {
+		case fieldTypeString, fieldTypeInt, fieldTypeUint, fieldTypeFloat, fieldTypeBool,
+			fieldTypeIP, fieldTypeMAC, fieldTypeTS, fieldTypeDuration:
+		default:
+			return fmt.Errorf("Invalid Field-Type %q: unknown type %q", t, tp)
+		}
+		if _, ok := m.types[name]; ok {
+			return fmt.Errorf("Field %q has more than one type", name)
+		}
+		m.types[name] = tp
+	}
+
+	if err = procs.CheckProcessors(m.Preprocessor); err != nil {
+		return fmt.Errorf("Splunk-Mapping preprocessor invalid: %v", err)
+	}
+	return
+}
+
+// parseFieldPair splits a "a,b" config value
+func parseFieldPair(v string) (a, b string, err error) {
+	var fields []string
+	dec := csv.NewReader(strings.NewReader(v))
+	dec.LazyQuotes = true
+	dec.TrimLeadingSpace = true
+	if fields, err = dec.Read(); err != nil {
+		return
+	} else if len(fields) != 2 {
+		err = fmt.Errorf("%q has %d fields, need 2", v, len(fields))
+		return
+	}
+	a, b = strings.TrimSpace(fields[0]), strings.TrimSpace(fields[1])
+	if a == `` || b == `` {
+		err = fmt.Errorf("%q has an empty field", v)
+	}
+	return
+}
+
+// matches reports if the mapping applies to an index and sourcetype on the named Splunk server
+func (m *splunkMapping) matches(splunkName, index, sourcetype string) bool {
+	return m.Splunk == splunkName && m.Index == index && (m.Sourcetype == `` || m.Sourcetype == sourcetype)
+}
+
+// timestampField returns the name of the field holding the entry timestamp in the query results
+func (m *splunkMapping) timestampField() string {
+	if m == nil || m.Timestamp_Field == `` || m.Timestamp_Field == splunkTimeField {
+		return splunkEpochName
+	}
+	return m.Timestamp_Field
+}
+
+// attachFields reports if Splunk fields should be attached as enumerated values,
+// an explicit field allow list overrides Disable-Intrinsics on the Splunk stanza.
+func (m *splunkMapping) attachFields(disableIntrinsics bool) bool {
+	if m != nil && len(m.allowed) > 0 {
+		return true
+	}
+	return !disableIntrinsics
+}
+
+// allow reports if a Splunk field should be attached as an enumerated value
+func (m *splunkMapping) allow(name string) bool {
+	if m == nil || len(m.allowed) == 0 {
+		return true
+	}
+	return m.allowed[name]
+}
+
+// tableFields returns the fields requested by the export query, nil means every field.
+func (m *splunkMapping) tableFields(disableIntrinsics bool) []string {
+	if m.attachFields(disableIntrinsics) && (m == nil || len(m.allowed) == 0) {
+		return nil
+	}
+	flds := []string{splunkEpochName, splunkRawField}
+	if ts := m.timestampField(); ts != splunkEpochName {
+		flds = append(flds, ts)
+	}
+	if m != nil {
+		for _, f := range m.Field {
+			if f = strings.TrimSpace(f); f != splunkEpochName && f != m.timestampField() {
+				flds = append(flds, f)
+			}
+		}
+	}
+	return flds
+}
+
+// query builds the Splunk export search for an index and sourcetype
+func (m *splunkMapping) query(index, sourcetype string, disableIntrinsics bool) string {
+	table := `*`
+	if flds := m.tableFields(disableIntrinsics); flds != nil {
+		for i := range flds {
+			flds[i] = quoteField(flds[i])
+		}
+		table = strings.Join(flds, " ")
+	}
+	return fmt.Sprintf("search index=\"%s\" sourcetype=\"%s\" | rename %s AS %s | table %s", index, sourcetype, splunkTimeField, splunkEpochName, table)
+}
+
+// quoteField quotes Splunk field names which contain anything other than word characters
+func quoteField(f string) string {
+	for _, r := range f {
+		if !(r == '_' || r == '.' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9')) {
+			return strconv.Quote(f)
+		}
+	}
+	return f
+}
+
+// enumeratedValue converts a Splunk field to an enumerated value, applying any rename and type rules
+func (m *splunkMapping) enumeratedValue(name, value string) (ev entry.EnumeratedValue, err error) {
+	evName := name
+	tp := fieldTypeString
+	if m != nil {
+		if n, ok := m.renames[name]; ok {
+			evName = n
+		}
+		if t, ok := m.types[name]; ok {
+			tp = t
+		}
+	}
+	if len(evName) == 0 || len(evName) > entry.MaxEvNameLength {
+		err = entry.ErrInvalidName
+		return
+	}
+	ev.Name = evName
+	ev.Value, err = coerceField(tp, value)
+	return
+}
+
+// coerceField converts a Splunk field value to typed enumerated data
+func coerceField(tp, v string) (ed entry.EnumeratedData, err error) {
+	if tp != fieldTypeString {
+		v = strings.TrimSpace(v)
+	}
+	switch tp {
+	case fieldTypeInt:
+		var x int64
+		if x, err = strconv.ParseInt(v, 0, 64); err == nil {
+			ed = entry.Int64EnumData(x)
+		}
+	case fieldTypeUint:
+		var x uint64
+		if x, err = strconv.ParseUint(v, 0, 64); err == nil {
+			ed = entry.Uint64EnumData(x)
+		}
+	case fieldTypeFloat:
+		var x float64
+		if x, err = strconv.ParseFloat(v, 64); err == nil {
+			ed = entry.Float64EnumData(x)
+		}
+	case fieldTypeBool:
+		var x bool
+		if x, err = strconv.ParseBool(v); err == nil {
+			ed = entry.BoolEnumData(x)
+		}
+	case fieldTypeIP:
+		if ip := net.ParseIP(v); ip == nil {
+			err = fmt.Errorf("invalid IP %q", v)
+		} else {
+			if ip4 := ip.To4(); ip4 != nil {
+				ip = ip4
+			}
+			ed = entry.IPEnumData(ip)
+		}
+	case fieldTypeMAC:
+		var mac net.HardwareAddr
+		if mac, err = net.ParseMAC(v); err == nil {
+			ed = entry.MACEnumData(mac)
+		}
+	case fieldTypeTS:
+		if ts, ok := parseEpoch(v); ok {
+			ed = entry.TSEnumData(entry.FromStandard(ts))
+		} else if ts, err := time.Parse(time.RFC3339Nano, v); err == nil {
+			ed = entry.TSEnumData(entry.FromStandard(ts))
+		} else {
+			return ed, fmt.Errorf("invalid timestamp %q", v)
+		}
+	case fieldTypeDuration:
+		var d time.Duration
+		if d, err = time.ParseDuration(v); err == nil {
+			ed = entry.DurationEnumData(d)
+		}
+	default:
+		ed, err = entry.InferEnumeratedData(v)
+	}
+	return
+}
+
+// parseEpoch parses a unix epoch time with optional fractional seconds, the format Splunk uses for _time
+func parseEpoch(v string) (ts time.Time, ok bool) {
+	v = strings.Trim(strings.TrimSpace(v), `"`)
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		return
+	}
+	sec, dec := math.Modf(f)
+	return time.Unix(int64(sec), int64(dec*(1e9))), true
+}
+
+// extractTS parses a timestamp field value with timegrinder
+func extractTS(tg *timegrinder.TimeGrinder, v string) (ts time.Time, ok bool, err error) {
+	if tg == nil {
+		err = errors.New("not an epoch timestamp")
+		return
+	}
+	return tg.Extract([]byte(v))
+}
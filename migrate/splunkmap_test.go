@@ -0,0 +1,261 @@
+/*************************************************************************
+ * Copyright 2024 Gravwell, Inc. All rights reserved.
+ * Contact: <legal@gravwell.io>
+ *
+ * This software may be modified and distributed under the terms of the
+ * BSD 2-clause license. See the LICENSE file for details.
+ **************************************************************************/
+
+package main
+
+import (
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gravwell/gravwell/v3/ingest/entry"
+	"github.com/gravwell/gravwell/v3/ingest/processors"
+)
+
+func TestSplunkMappingValidate(t *testing.T) {
+	longName := strings.Repeat("a", entry.MaxEvNameLength+1)
+	tests := []struct {
+		name string
+		m    splunkMapping
+		ok   bool
+	}{
+		{`minimal`, splunkMapping{}, true},
+		{`no splunk`, splunkMapping{Splunk: ``}, false},
+		{`no index`, splunkMapping{Index: ``}, false},
+		{`raw timestamp`, splunkMapping{Timestamp_Field: `_raw`}, false},
+		{`raw timestamp spaces`, splunkMapping{Timestamp_Field: ` _raw `}, false},
+		{`timestamp field`, splunkMapping{Timestamp_Field: `event_time`}, true},
+		{`override`, splunkMapping{Timestamp_Field: `event_time`, Timestamp_Format_Override: `RFC3339`}, true},
+		{`override without field`, splunkMapping{Timestamp_Format_Override: `RFC3339`}, false},
+		{`override on _time`, splunkMapping{Timestamp_Field: `_time`, Timestamp_Format_Override: `RFC3339`}, false},
+		{`bad override`, splunkMapping{Timestamp_Field: `event_time`, Timestamp_Format_Override: `NOTAFORMAT`}, false},
+		{`fields`, splunkMapping{Field: []string{`src`, `dest port`}}, true},
+		{`raw field`, splunkMapping{Field: []string{`_raw`}}, false},
+		{`empty field`, splunkMapping{Field: []string{` `}}, false},
+		{`renames`, splunkMapping{Rename: []string{`src,src_ip`, `"a,b",ab`}}, true},
+		{`duplicate rename`, splunkMapping{Rename: []string{`src,src_ip`, `src,source`}}, false},
+		{`bad rename`, splunkMapping{Rename: []string{`src`}}, false},
+		{`long rename`, splunkMapping{Rename: []string{`src,` + longName}}, false},
+		{`types`, splunkMapping{Field_Type: []string{`src,IP`, `port,uint`, `took,duration`}}, true},
+		{`duplicate type`, splunkMapping{Field_Type: []string{`src,ip`, `src,string`}}, false},
+		{`unknown type`, splunkMapping{Field_Type: []string{`src,blob`}}, false},
+		{`bad type`, splunkMapping{Field_Type: []string{`src,ip,mac`}}, false},
+		{`missing preprocessor`, splunkMapping{Preprocessor: []string{`nope`}}, false},
+	}
+	for _, tt := range tests {
+		m := tt.m
+		if tt.name != `no splunk` {
+			m.Splunk = `splunk1`
+		}
+		if tt.name != `no index` {
+			m.Index = `main`
+		}
+		if err := m.Validate(processors.ProcessorConfig{}); (err == nil) != tt.ok {
+			t.Errorf("%s: Validate returned %v", tt.name, err)
+		}
+	}
+
+	m := splunkMapping{
+		Splunk:     `splunk1`,
+		Index:      `main`,
+		Field:      []string{` src `},
+		Rename:     []string{` src , src_ip `},
+		Field_Type: []string{`src,IP`},
+	}
+	if err := m.Validate(processors.ProcessorConfig{}); err != nil {
+		t.Fatal(err)
+	}
+	if !m.allowed[`src`] || m.renames[`src`] != `src_ip` || m.types[`src`] != fieldTypeIP {
+		t.Fatalf("bad parsed rules %v %v %v", m.allowed, m.renames, m.types)
+	}
+}
+
+func TestParseFieldPair(t *testing.T) {
+	good := map[string][2]string{
+		`a,b`:          {`a`, `b`},
+		` a , b `:      {`a`, `b`},
+		`"a,b",c`:      {`a,b`, `c`},
+		`a, "b c"`:     {`a`, `b c`},
+		`src.ip,float`: {`src.ip`, `float`},
+	}
+	for in, want := range good {
+		if a, b, err := parseFieldPair(in); err != nil {
+			t.Errorf("%q returned %v", in, err)
+		} else if a != want[0] || b != want[1] {
+			t.Errorf("%q parsed as %q %q, expected %q %q", in, a, b, want[0], want[1])
+		}
+	}
+	for _, in := range []string{``, `a`, `a,b,c`, `,b`, `a,`, `a, `, `" ",b`} {
+		if a, b, err := parseFieldPair(in); err == nil {
+			t.Errorf("%q was accepted as %q %q", in, a, b)
+		}
+	}
+}
+
+func TestCoerceField(t *testing.T) {
+	ts := time.Date(2024, 3, 1, 12, 30, 0, 500000000, time.UTC)
+	tests := []struct {
+		tp, v string
+		want  entry.EnumeratedData
+	}{
+		{fieldTypeString, ` 42 `, entry.StringEnumData(` 42 `)},
+		{fieldTypeInt, ` -42 `, entry.Int64EnumData(-42)},
+		{fieldTypeInt, `0x10`, entry.Int64EnumData(16)},
+		{fieldTypeUint, `42`, entry.Uint64EnumData(42)},
+		{fieldTypeUint, `18446744073709551615`, entry.Uint64EnumData(18446744073709551615)},
+		{fieldTypeFloat, `1.5`, entry.Float64EnumData(1.5)},
+		{fieldTypeFloat, `-2e3`, entry.Float64EnumData(-2000)},
+		{fieldTypeBool, `true`, entry.BoolEnumData(true)},
+		{fieldTypeBool, `0`, entry.BoolEnumData(false)},
+		{fieldTypeIP, `10.0.0.1`, entry.IPEnumData(net.IPv4(10, 0, 0, 1).To4())},
+		{fieldTypeIP, `::1`, entry.IPEnumData(net.IPv6loopback)},
+		{fieldTypeMAC, `00:11:22:aa:bb:cc`, entry.MACEnumData(net.HardwareAddr{0, 0x11, 0x22, 0xaa, 0xbb, 0xcc})},
+		{fieldTypeTS, `1709296200.5`, entry.TSEnumData(entry.FromStandard(ts))},
+		{fieldTypeTS, `2024-03-01T12:30:00.5Z`, entry.TSEnumData(entry.FromStandard(ts))},
+		{fieldTypeDuration, `1m30s`, entry.DurationEnumData(90 * time.Second)},
+	}
+	for _, tt := range tests {
+		ed, err := coerceField(tt.tp, tt.v)
+		if err != nil {
+			t.Errorf("%s %q returned %v", tt.tp, tt.v, err)
+		} else if !reflect.DeepEqual(ed, tt.want) {
+			t.Errorf("%s %q became %v, expected %v", tt.tp, tt.v, ed, tt.want)
+		}
+	}
+
+	bad := []struct{ tp, v string }{
+		{fieldTypeInt, `1.5`},
+		{fieldTypeInt, `9223372036854775808`},
+		{fieldTypeUint, `-1`},
+		{fieldTypeFloat, `fast`},
+		{fieldTypeBool, `yes`},
+		{fieldTypeIP, `10.0.0.256`},
+		{fieldTypeIP, ``},
+		{fieldTypeMAC, `00:11:22`},
+		{fieldTypeTS, `yesterday`},
+		{fieldTypeTS, `2024-03-01 12:30:00`},
+		{fieldTypeDuration, `90`},
+		{fieldTypeString, strings.Repeat("a", entry.MaxEvDataLength+1)},
+	}
+	for _, tt := range bad {
+		if ed, err := coerceField(tt.tp, tt.v); err == nil {
+			t.Errorf("%s %q was accepted as %v", tt.tp, tt.v, ed)
+		}
+	}
+}
+
+func TestEnumeratedValue(t *testing.T) {
+	m := splunkMapping{
+		Splunk:     `splunk1`,
+		Index:      `main`,
+		Rename:     []string{`src,src_ip`},
+		Field_Type: []string{`src,ip`, `count,uint`},
+	}
+	if err := m.Validate(processors.ProcessorConfig{}); err != nil {
+		t.Fatal(err)
+	}
+	if ev, err := m.enumeratedValue(`src`, `10.0.0.1`); err != nil {
+		t.Fatal(err)
+	} else if ev.Name != `src_ip` || !reflect.DeepEqual(ev.Value, entry.IPEnumData(net.IPv4(10, 0, 0, 1).To4())) {
+		t.Fatalf("bad renamed value %v", ev)
+	}
+	if _, err := m.enumeratedValue(`count`, `many`); err == nil {
+		t.Fatal("bad uint was accepted")
+	}
+	// no mapping, untyped fields are strings
+	var nm *splunkMapping
+	if ev, err := nm.enumeratedValue(`count`, `12`); err != nil {
+		t.Fatal(err)
+	} else if ev.Name != `count` || !reflect.DeepEqual(ev.Value, entry.StringEnumData(`12`)) {
+		t.Fatalf("bad unmapped value %v", ev)
+	}
+	if _, err := nm.enumeratedValue(strings.Repeat("a", entry.MaxEvNameLength+1), `x`); err == nil {
+		t.Fatal("long name was accepted")
+	}
+}
+
+func TestSplunkQuery(t *testing.T) {
+	const prefix = `search index="main" sourcetype="fw" | rename _time AS epoch_time | table `
+	tests := []struct {
+		name    string
+		m       *splunkMapping
+		disable bool
+		fields  []string
+		table   string
+	}{
+		{`no mapping`, nil, false, nil, `*`},
+		{`no mapping disabled`, nil, true, []string{`epoch_time`, `_raw`}, `epoch_time _raw`},
+		{`timestamp field`, &splunkMapping{Timestamp_Field: `event_time`}, false, nil, `*`},
+		{`timestamp field disabled`, &splunkMapping{Timestamp_Field: `event_time`}, true,
+			[]string{`epoch_time`, `_raw`, `event_time`}, `epoch_time _raw event_time`},
+		{`quoted timestamp field`, &splunkMapping{Timestamp_Field: `event time`}, true,
+			[]string{`epoch_time`, `_raw`, `event time`}, `epoch_time _raw "event time"`},
+		{`allow list`, &splunkMapping{Field: []string{`src.ip`, `dest-port`, `say "hi"`}}, false,
+			[]string{`epoch_time`, `_raw`, `src.ip`, `dest-port`, `say "hi"`}, `epoch_time _raw src.ip "dest-port" "say \"hi\""`},
+		// the allow list overrides Disable-Intrinsics
+		{`allow list disabled`, &splunkMapping{Field: []string{`src`}}, true,
+			[]string{`epoch_time`, `_raw`, `src`}, `epoch_time _raw src`},
+		// the timestamp field is only requested once
+		{`allow list timestamp`, &splunkMapping{Timestamp_Field: `event_time`, Field: []string{`event_time`, `epoch_time`, `src`}}, false,
+			[]string{`epoch_time`, `_raw`, `event_time`, `src`}, `epoch_time _raw event_time src`},
+	}
+	for _, tt := range tests {
+		if tt.m != nil {
+			tt.m.Splunk, tt.m.Index = `splunk1`, `main`
+			if err := tt.m.Validate(processors.ProcessorConfig{}); err != nil {
+				t.Fatalf("%s: %v", tt.name, err)
+			}
+		}
+		if flds := tt.m.tableFields(tt.disable); !reflect.DeepEqual(flds, tt.fields) {
+			t.Errorf("%s: table fields %q, expected %q", tt.name, flds, tt.fields)
+		}
+		if q := tt.m.query(`main`, `fw`, tt.disable); q != prefix+tt.table {
+			t.Errorf("%s: query %q, expected %q", tt.name, q, prefix+tt.table)
+		}
+	}
+}
+
+func TestGetSplunkMapping(t *testing.T) {
+	c := cfgType{Splunk_Mapping: map[string]*splunkMapping{
+		`index`:    {Splunk: `splunk1`, Index: `main`},
+		`fw`:       {Splunk: `splunk1`, Index: `main`, Sourcetype: `fw`},
+		`dns`:      {Splunk: `splunk1`, Index: `main`, Sourcetype: `dns`},
+		`other`:    {Splunk: `splunk2`, Index: `main`},
+		`nil`:      nil,
+		`fwsecond`: {Splunk: `splunk2`, Index: `main`, Sourcetype: `fw`},
+	}}
+	tests := []struct {
+		splunk, index, sourcetype string
+		want                      string
+	}{
+		{`splunk1`, `main`, `fw`, `fw`},
+		{`splunk1`, `main`, `dns`, `dns`},
+		{`splunk1`, `main`, `syslog`, `index`},
+		{`splunk1`, `other`, `fw`, ``},
+		{`splunk2`, `main`, `fw`, `fwsecond`},
+		{`splunk2`, `main`, `dns`, `other`},
+		{`splunk3`, `main`, `fw`, ``},
+	}
+	// map iteration order is random, so check a few times
+	for i := 0; i < 20; i++ {
+		for _, tt := range tests {
+			m := c.getSplunkMapping(tt.splunk, tt.index, tt.sourcetype)
+			var got string
+			for k, v := range c.Splunk_Mapping {
+				if v != nil && v == m {
+					got = k
+				}
+			}
+			if got != tt.want {
+				t.Fatalf("%s %s %s matched %q, expected %q", tt.splunk, tt.index, tt.sourcetype, got, tt.want)
+			}
+		}
+	}
+}
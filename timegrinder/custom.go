@@ -37,8 +37,12 @@ type CustomFormat struct {
 	// optional pre-extraction system that can go get the meat of a timestamp before actually trying to handle the timestamp
 	Extraction_Regex string
 
+	// optional locale (e.g. "fr") for month and weekday names in the format
+	Locale string
+
 	dateMissing bool // indicates that the extraction only gets time, so add date
 	yearMissing bool // indicates that the extraction doesn't set the year
+	locale      *Locale
 
 	pre preExtractor
 }
@@ -54,6 +58,8 @@ func (cf *CustomFormat) Validate() (err error) {
 		return ErrMissingName
 	} else if cf.Format == `` {
 		return ErrMissingFormat
+	} else if cf.locale, err = LookupLocale(cf.Locale); err != nil {
+		return
 	}
 
 	if cf.Regex != `` {
@@ -82,10 +88,16 @@ func (cf *CustomFormat) Validate() (err error) {
 		if t.Year() == 0 {
 			cf.yearMissing = true
 		}
-		// Try to match it
-		if _, _, ok := match(rx, nil, []byte(time.Now().Format(cf.Format))); !ok {
-			err = ErrRegexFormatMismatch
-			return
+		// Try to match it, a localized format may match the english or the locale names
+		now := time.Now().Format(cf.Format)
+		if _, _, ok := match(rx, nil, []byte(now)); !ok {
+			if cf.locale == nil {
+				err = ErrRegexFormatMismatch
+				return
+			} else if _, _, ok = match(rx, nil, []byte(cf.locale.localize(now))); !ok {
+				err = ErrRegexFormatMismatch
+				return
+			}
 		}
 	} else if cf.Extraction_Regex == `` {
 		// if we don't have a regex, then we MUST have a pre-extraction regex
@@ -116,7 +128,8 @@ func (cf CustomFormat) ExtractionRegex() string {
 
 type customProcessor struct {
 	CustomFormat
-	rx *regexp.Regexp
+	rx    *regexp.Regexp
+	kinds []nameKind //month and weekday names in the format, used with locales
 }
 
 func NewCustomProcessor(cf CustomFormat) (p Processor, err error) {
@@ -126,6 +139,7 @@ func NewCustomProcessor(cf CustomFormat) (p Processor, err error) {
 	if cf.Regex != `` {
 		cp := &customProcessor{
 			CustomFormat: cf,
+			kinds:        layoutNames(cf.Format),
 		}
 		if cp.rx, err = regexp.Compile(cf.Regex); err != nil {
 			return
@@ -137,6 +151,7 @@ func NewCustomProcessor(cf CustomFormat) (p Processor, err error) {
 			err = fmt.Errorf("Failed to find %s", cf.Format)
 			return
 		}
+		p, _ = NewLocaleProcessor(p, cf.locale)
 	}
 	if cf.pre.rx != nil {
 		cp := preExtractProcessor{
@@ -158,7 +173,12 @@ func (cp *customProcessor) Match(d []byte) (int, int, bool) {
 }
 
 func (cp *customProcessor) Extract(d []byte, loc *time.Location) (t time.Time, ok bool, offset int) {
-	if t, ok, offset = extract(cp.rx, nil, d, cp.CustomFormat.Format, loc); ok && cp.dateMissing {
+	if cp.locale != nil {
+		t, ok, offset = extractLocale(cp.rx, nil, d, cp.CustomFormat.Format, loc, cp.locale, cp.kinds)
+	} else {
+		t, ok, offset = extract(cp.rx, nil, d, cp.CustomFormat.Format, loc)
+	}
+	if ok && cp.dateMissing {
 		t = addDate(t)
 	}
 	//check if we need to set the year
@@ -168,6 +188,10 @@ func (cp *customProcessor) Extract(d []byte, loc *time.Location) (t time.Time, o
 	return
 }
 
+func (cp *customProcessor) yearless() bool {
+	return cp.yearMissing && !cp.dateMissing
+}
+
 func (cp *customProcessor) Name() string {
 	return cp.CustomFormat.Name
 }
@@ -0,0 +1,720 @@
+/*************************************************************************
+ * Copyright 2024 Gravwell, Inc. All rights reserved.
+ * Contact: <legal@gravwell.io>
+ *
+ * This software may be modified and distributed under the terms of the
+ * BSD 2-clause license. See the LICENSE file for details.
+ **************************************************************************/
+
+package timegrinder
+
+import (
+	"regexp"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+//the fastpath file contains hand written scanners for the most common formats.
+//Each scanner finds exactly what the format regular expression would find and the
+//layout elements parse it exactly as time.ParseInLocation would, without allocating.
+//The regular expression processor is embedded so it stays available as the reference.
+
+type fastProcessor struct {
+	processor
+	first   func(byte) bool           //bytes that can start a match
+	scan    func(d []byte, i int) int //end of a match starting at i, or -1
+	exclude func(tail []byte) bool    //mirrors trxpEx, applied to the data after the match
+	elems   []layoutElem              //the format broken into elements
+}
+
+func (fp *fastProcessor) find(d []byte) (start, end int, ok bool) {
+	for i := 0; i < len(d); i++ {
+		if !fp.first(d[i]) {
+			continue
+		}
+		if e := fp.scan(d, i); e >= 0 {
+			if fp.exclude != nil && fp.exclude(d[e:]) {
+				//the regex processor does not look for a later match either
+				return
+			}
+			return i, e, true
+		}
+	}
+	return
+}
+
+func (fp *fastProcessor) Extract(d []byte, loc *time.Location) (time.Time, bool, int) {
+	if len(d) < fp.min {
+		return time.Time{}, false, -1 //cannot possibly hit
+	}
+	start, end, ok := fp.find(d)
+	if !ok {
+		return time.Time{}, false, -1
+	}
+	t, ok := parseLayout(fp.elems, d[start:end], loc)
+	if !ok {
+		return time.Time{}, false, -1
+	}
+	return t, true, start
+}
+
+func (fp *fastProcessor) Match(d []byte) (int, int, bool) {
+	if len(d) < fp.min {
+		return -1, -1, false //cannot possibly hit
+	}
+	return fp.find(d)
+}
+
+func NewRFC3339Processor() *fastProcessor {
+	return &fastProcessor{
+		processor: *newRFC3339RegexProcessor(),
+		first:     isDigit,
+		scan: func(d []byte, i int) int {
+			if i = scanISODateTime(d, i, 'T'); i < 0 {
+				return -1
+			}
+			return scanByte(d, i, 'Z', '-', '+')
+		},
+		elems: []layoutElem{
+			elLongYear, lit('-'), elZeroMonth, lit('-'), elZeroDay, lit('T'),
+			elHour, lit(':'), elZeroMinute, lit(':'), elZeroSecond, elISO8601ColonTZ,
+		},
+	}
+}
+
+func NewRFC3339NanoProcessor() *fastProcessor {
+	return &fastProcessor{
+		processor: *newRFC3339NanoRegexProcessor(),
+		first:     isDigit,
+		scan: func(d []byte, i int) int {
+			if i = scanISODateTime(d, i, 'T'); i < 0 || i >= len(d) || d[i] == '\n' {
+				return -1
+			}
+			//the regex uses . between the seconds and the fraction, which is any rune
+			_, w := utf8.DecodeRune(d[i:])
+			if i = scanDigits(d, i+w, 1); i < 0 {
+				return -1
+			}
+			return scanByte(d, i, 'Z', '-', '+')
+		},
+		elems: []layoutElem{
+			elLongYear, lit('-'), elZeroMonth, lit('-'), elZeroDay, lit('T'),
+			elHour, lit(':'), elZeroMinute, lit(':'), elZeroSecond, elFracSecond9, elISO8601ColonTZ,
+		},
+	}
+}
+
+// scanSyslogFile covers both syslog file formats, which only differ by the colon in the offset
+func scanSyslogFile(d []byte, i int, colon bool) int {
+	if i = scanISODate(d, i, 'T'); i < 0 {
+		return -1
+	}
+	if i = scanTwoDigits(d, i, ':'); i < 0 {
+		return -1
+	} else if i = scanTwoDigits(d, i, ':'); i < 0 {
+		return -1
+	} else if i = scanDigits(d, i, 1); i < 0 {
+		return -1
+	}
+	if i < len(d) && d[i] == '.' {
+		i++
+	}
+	i = scanDigits(d, i, 0)
+	if i = scanByte(d, i, '-', '+'); i < 0 {
+		return -1
+	}
+	if colon {
+		if i = scanTwoDigits(d, i, ':'); i < 0 {
+			return -1
+		}
+		return scanDigits2(d, i)
+	} else if i = scanDigits2(d, i); i < 0 {
+		return -1
+	}
+	return scanDigits2(d, i)
+}
+
+func NewSyslogFileProcessor() *fastProcessor {
+	return &fastProcessor{
+		processor: *newSyslogFileRegexProcessor(),
+		first:     isDigit,
+		scan:      func(d []byte, i int) int { return scanSyslogFile(d, i, true) },
+		elems: []layoutElem{
+			elLongYear, lit('-'), elZeroMonth, lit('-'), elZeroDay, lit('T'),
+			elHour, lit(':'), elZeroMinute, lit(':'), elZeroSecond, elFracSecond9, elNumColonTZ,
+		},
+	}
+}
+
+func NewSyslogFileProcessorTZ2() *fastProcessor {
+	return &fastProcessor{
+		processor: *newSyslogFileTZ2RegexProcessor(),
+		first:     isDigit,
+		scan:      func(d []byte, i int) int { return scanSyslogFile(d, i, false) },
+		elems: []layoutElem{
+			elLongYear, lit('-'), elZeroMonth, lit('-'), elZeroDay, lit('T'),
+			elHour, lit(':'), elZeroMinute, lit(':'), elZeroSecond, elFracSecond9, elNumTZ,
+		},
+	}
+}
+
+func NewZonelessRFC3339() *fastProcessor {
+	return &fastProcessor{
+		processor: *newZonelessRFC3339RegexProcessor(),
+		first:     isDigit,
+		scan: func(d []byte, i int) int {
+			if i = scanISODateTime(d, i, 'T'); i < 0 {
+				return -1
+			}
+			for i < len(d) && d[i] == '.' {
+				i++
+			}
+			return scanDigits(d, i, 0)
+		},
+		exclude: func(tail []byte) bool {
+			return len(tail) > 0 && (tail[0] == 'Z' || tail[0] == '+' || tail[0] == '-')
+		},
+		elems: []layoutElem{
+			elLongYear, lit('-'), elZeroMonth, lit('-'), elZeroDay, lit('T'),
+			elHour, lit(':'), elZeroMinute, lit(':'), elZeroSecond, elFracSecond9,
+		},
+	}
+}
+
+func NewDPKGProcessor() *fastProcessor {
+	return &fastProcessor{
+		processor: *newDPKGRegexProcessor(),
+		first:     isDigit,
+		scan: func(d []byte, i int) int {
+			if i = scanISODate(d, i, 0); i < 0 || i >= len(d) || !isRegexSpace(d[i]) {
+				return -1
+			}
+			return scanClock(d, i+1)
+		},
+		elems: []layoutElem{
+			elLongYear, lit('-'), elZeroMonth, lit('-'), elZeroDay, elSpace,
+			elHour, lit(':'), elZeroMinute, lit(':'), elZeroSecond,
+		},
+	}
+}
+
+func NewNGINXProcessor() *fastProcessor {
+	return &fastProcessor{
+		processor: *newNGINXRegexProcessor(),
+		first:     isDigit,
+		scan: func(d []byte, i int) int {
+			if i = scanDigits4(d, i); i < 0 {
+				return -1
+			} else if i = scanByte(d, i, '/'); i < 0 {
+				return -1
+			} else if i = scanTwoDigits(d, i, '/'); i < 0 {
+				return -1
+			} else if i = scanDigits2(d, i); i < 0 {
+				return -1
+			} else if i = scanSpaces(d, i); i < 0 {
+				return -1
+			}
+			return scanClock(d, i)
+		},
+		elems: []layoutElem{
+			elLongYear, lit('/'), elZeroMonth, lit('/'), elZeroDay, elSpace,
+			elHour, lit(':'), elZeroMinute, lit(':'), elZeroSecond,
+		},
+	}
+}
+
+// scanApache handles the shared portion of the Apache formats, _2/Jan/2006:15:04:05
+func scanApache(d []byte, i int) int {
+	if i = scanDigits(d, i, 1); i < 0 {
+		return -1
+	}
+	//the regex is \d{1,2}/ so a third digit can never match
+	if i = scanByte(d, i, '/'); i < 0 {
+		return -1
+	} else if i = scanMonthName(d, i); i < 0 {
+		return -1
+	} else if i = scanByte(d, i, '/'); i < 0 {
+		return -1
+	} else if i = scanDigits4(d, i); i < 0 {
+		return -1
+	} else if i = scanByte(d, i, ':'); i < 0 {
+		return -1
+	}
+	return scanClock(d, i)
+}
+
+func apacheFirst(d []byte, i int) bool {
+	//a leading run of more than two digits cannot satisfy \d{1,2}/
+	return i+1 < len(d) && (d[i+1] == '/' || (isDigit(d[i+1]) && i+2 < len(d) && d[i+2] == '/'))
+}
+
+func NewApacheProcessor() *fastProcessor {
+	return &fastProcessor{
+		processor: *newApacheRegexProcessor(),
+		first:     isDigit,
+		scan: func(d []byte, i int) int {
+			if !apacheFirst(d, i) {
+				return -1
+			} else if i = scanApache(d, i); i < 0 || i >= len(d) || !isRegexSpace(d[i]) {
+				return -1
+			} else if i = scanByte(d, i+1, '-', '|', '+'); i < 0 {
+				return -1
+			}
+			return scanDigits4(d, i)
+		},
+		elems: []layoutElem{
+			elUnderDay, lit('/'), elMonth, lit('/'), elLongYear, lit(':'),
+			elHour, lit(':'), elZeroMinute, lit(':'), elZeroSecond, elSpace, elNumTZ,
+		},
+	}
+}
+
+func NewApacheNoTZProcessor() *fastProcessor {
+	return &fastProcessor{
+		processor: *newApacheNoTZRegexProcessor(),
+		first:     isDigit,
+		scan: func(d []byte, i int) int {
+			if !apacheFirst(d, i) {
+				return -1
+			}
+			return scanApache(d, i)
+		},
+		exclude: func(tail []byte) bool {
+			//^\s?[-+]{1}\d{4}
+			if len(tail) > 0 && isRegexSpace(tail[0]) {
+				if len(tail) > 1 && (tail[1] == '-' || tail[1] == '+') && scanDigits4(tail, 2) > 0 {
+					return true
+				}
+			}
+			return len(tail) > 0 && (tail[0] == '-' || tail[0] == '+') && scanDigits4(tail, 1) > 0
+		},
+		elems: []layoutElem{
+			elUnderDay, lit('/'), elMonth, lit('/'), elLongYear, lit(':'),
+			elHour, lit(':'), elZeroMinute, lit(':'), elZeroSecond,
+		},
+	}
+}
+
+func newSyslogFastProcessor() *fastProcessor {
+	return &fastProcessor{
+		processor: processor{
+			rxp:    regexp.MustCompile(SyslogRegex),
+			rxstr:  SyslogRegex,
+			format: SyslogFormat,
+			name:   Syslog.String(),
+			min:    len(SyslogFormat),
+		},
+		first: isMonthStart,
+		scan: func(d []byte, i int) int {
+			if i = scanMonthName(d, i); i < 0 {
+				return -1
+			} else if i = scanSpaces(d, i); i < 0 {
+				return -1
+			} else if i = scanDigits(d, i, 1); i < 0 {
+				return -1
+			} else if i = scanSpaces(d, i); i < 0 {
+				return -1
+			}
+			return scanClock(d, i)
+		},
+		elems: []layoutElem{
+			elMonth, elSpace, elUnderDay, elSpace,
+			elHour, lit(':'), elZeroMinute, lit(':'), elZeroSecond,
+		},
+	}
+}
+
+// scanner helpers, each takes the data and an offset and returns the offset after the match or -1
+
+func isDigit(c byte) bool {
+	return '0' <= c && c <= '9'
+}
+
+// isRegexSpace matches the regexp \s class
+func isRegexSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\f' || c == '\r'
+}
+
+func isMonthStart(c byte) bool {
+	switch c {
+	case 'J', 'F', 'M', 'A', 'S', 'O', 'N', 'D':
+		return true
+	}
+	return false
+}
+
+func isMonthRest(c byte) bool {
+	switch c {
+	case 'a', 'n', 'e', 'b', 'r', 'i', 'y', 'u', 'l', 'g', 'p', 'c', 't', 'o', 'v':
+		return true
+	}
+	return false
+}
+
+func scanByte(d []byte, i int, vals ...byte) int {
+	if i < 0 || i >= len(d) {
+		return -1
+	}
+	for _, v := range vals {
+		if d[i] == v {
+			return i + 1
+		}
+	}
+	return -1
+}
+
+// scanDigits consumes a run of digits, failing if there are fewer than min
+func scanDigits(d []byte, i, min int) int {
+	if i < 0 {
+		return -1
+	}
+	start := i
+	for i < len(d) && isDigit(d[i]) {
+		i++
+	}
+	if i-start < min {
+		return -1
+	}
+	return i
+}
+
+func scanDigits2(d []byte, i int) int {
+	if i < 0 || i+2 > len(d) || !isDigit(d[i]) || !isDigit(d[i+1]) {
+		return -1
+	}
+	return i + 2
+}
+
+func scanDigits4(d []byte, i int) int {
+	if i = scanDigits2(d, i); i < 0 {
+		return -1
+	}
+	return scanDigits2(d, i)
+}
+
+// scanTwoDigits consumes two digits followed by a separator
+func scanTwoDigits(d []byte, i int, sep byte) int {
+	if i = scanDigits2(d, i); i < 0 {
+		return -1
+	}
+	return scanByte(d, i, sep)
+}
+
+// scanSpaces consumes \s+
+func scanSpaces(d []byte, i int) int {
+	start := i
+	for i < len(d) && isRegexSpace(d[i]) {
+		i++
+	}
+	if i == start {
+		return -1
+	}
+	return i
+}
+
+func scanMonthName(d []byte, i int) int {
+	if i >= len(d) || !isMonthStart(d[i]) {
+		return -1
+	}
+	start := i
+	for i++; i < len(d) && isMonthRest(d[i]); i++ {
+	}
+	if i == start+1 {
+		return -1
+	}
+	return i
+}
+
+// scanClock consumes 15:04:05
+func scanClock(d []byte, i int) int {
+	if i = scanTwoDigits(d, i, ':'); i < 0 {
+		return -1
+	} else if i = scanTwoDigits(d, i, ':'); i < 0 {
+		return -1
+	}
+	return scanDigits2(d, i)
+}
+
+// scanISODate consumes 2006-01-02 and an optional trailing separator
+func scanISODate(d []byte, i int, sep byte) int {
+	if i = scanDigits4(d, i); i < 0 {
+		return -1
+	} else if i = scanByte(d, i, '-'); i < 0 {
+		return -1
+	} else if i = scanTwoDigits(d, i, '-'); i < 0 {
+		return -1
+	} else if i = scanDigits2(d, i); i < 0 || sep == 0 {
+		return i
+	}
+	return scanByte(d, i, sep)
+}
+
+// scanISODateTime consumes 2006-01-02T15:04:05
+func scanISODateTime(d []byte, i int, sep byte) int {
+	if i = scanISODate(d, i, sep); i < 0 {
+		return -1
+	}
+	return scanClock(d, i)
+}
+
+// layoutElem is a single element of a time layout, mirroring the std chunks used by the time package
+type layoutElem uint16
+
+const (
+	elLit layoutElem = iota << 8 //literal byte held in the low bits
+	elSpace
+	elLongYear
+	elZeroMonth
+	elMonth
+	elZeroDay
+	elUnderDay
+	elHour
+	elZeroMinute
+	elZeroSecond
+	elFracSecond9
+	elNumTZ
+	elNumColonTZ
+	elISO8601ColonTZ
+
+	elKindMask layoutElem = 0xff00
+)
+
+func lit(c byte) layoutElem {
+	return elLit | layoutElem(c)
+}
+
+var shortMonthNames = [...]string{`Jan`, `Feb`, `Mar`, `Apr`, `May`, `Jun`, `Jul`, `Aug`, `Sep`, `Oct`, `Nov`, `Dec`}
+
+// parseLayout parses a value using the same rules as time.ParseInLocation, but on bytes and without allocating
+func parseLayout(elems []layoutElem, v []byte, loc *time.Location) (t time.Time, ok bool) {
+	var (
+		year       int
+		month      int = -1
+		day        int = -1
+		hour       int
+		min        int
+		sec        int
+		nsec       int
+		utc        bool
+		zoneOffset int = -1
+	)
+	for k, el := range elems {
+		switch el & elKindMask {
+		case elLit:
+			if len(v) == 0 || v[0] != byte(el) {
+				return time.Time{}, false
+			}
+			v = v[1:]
+		case elSpace:
+			if len(v) > 0 && v[0] != ' ' {
+				return time.Time{}, false
+			}
+			v = cutspace(v)
+		case elLongYear:
+			if len(v) < 4 || !isDigit(v[0]) || !isDigit(v[1]) || !isDigit(v[2]) || !isDigit(v[3]) {
+				return time.Time{}, false
+			}
+			year = int(v[0]-'0')*1000 + int(v[1]-'0')*100 + int(v[2]-'0')*10 + int(v[3]-'0')
+			v = v[4:]
+		case elMonth:
+			if month = lookupMonth(v); month < 0 {
+				return time.Time{}, false
+			}
+			v = v[3:]
+		case elZeroMonth:
+			if month, v, ok = getnum(v, true); !ok || month <= 0 || month > 12 {
+				return time.Time{}, false
+			}
+		case elZeroDay, elUnderDay:
+			if el == elUnderDay && len(v) > 0 && v[0] == ' ' {
+				v = v[1:]
+			}
+			if day, v, ok = getnum(v, el == elZeroDay); !ok {
+				return time.Time{}, false
+			}
+		case elHour:
+			if hour, v, ok = getnum(v, false); !ok || hour >= 24 {
+				return time.Time{}, false
+			}
+		case elZeroMinute:
+			if min, v, ok = getnum(v, true); !ok || min >= 60 {
+				return time.Time{}, false
+			}
+		case elZeroSecond:
+			if sec, v, ok = getnum(v, true); !ok || sec >= 60 {
+				return time.Time{}, false
+			}
+			//a fraction is accepted even when the layout does not have one
+			if len(v) >= 2 && isCommaOrPeriod(v[0]) && isDigit(v[1]) && (k+1 >= len(elems) || elems[k+1] != elFracSecond9) {
+				n := 2
+				for n < len(v) && isDigit(v[n]) {
+					n++
+				}
+				nsec, v = parseNanoseconds(v, n), v[n:]
+			}
+		case elFracSecond9:
+			if len(v) < 2 || !isCommaOrPeriod(v[0]) || !isDigit(v[1]) {
+				break //fractional second omitted
+			}
+			n := 2
+			for n < len(v) && isDigit(v[n]) {
+				n++
+			}
+			nsec, v = parseNanoseconds(v, n), v[n:]
+		case elISO8601ColonTZ:
+			if len(v) >= 1 && v[0] == 'Z' {
+				v = v[1:]
+				utc = true
+				break
+			}
+			fallthrough
+		case elNumTZ, elNumColonTZ:
+			var hh, mm []byte
+			var sign byte
+			if el == elNumTZ {
+				if len(v) < 5 {
+					return time.Time{}, false
+				}
+				sign, hh, mm, v = v[0], v[1:3], v[3:5], v[5:]
+			} else {
+				if len(v) < 6 || v[3] != ':' {
+					return time.Time{}, false
+				}
+				sign, hh, mm, v = v[0], v[1:3], v[4:6], v[6:]
+			}
+			if !isDigit(hh[0]) || !isDigit(hh[1]) || !isDigit(mm[0]) || !isDigit(mm[1]) {
+				return time.Time{}, false
+			}
+			hr := int(hh[0]-'0')*10 + int(hh[1]-'0')
+			mn := int(mm[0]-'0')*10 + int(mm[1]-'0')
+			if hr > 24 || mn > 60 {
+				return time.Time{}, false
+			}
+			zoneOffset = (hr*60 + mn) * 60
+			switch sign {
+			case '+':
+			case '-':
+				zoneOffset = -zoneOffset
+			default:
+				return time.Time{}, false
+			}
+		}
+	}
+	if len(v) != 0 {
+		return time.Time{}, false //extra text
+	}
+	if month < 0 {
+		month = int(time.January)
+	}
+	if day < 0 {
+		day = 1
+	}
+	if day < 1 || day > daysIn(time.Month(month), year) {
+		return time.Time{}, false
+	}
+	if utc {
+		return time.Date(year, time.Month(month), day, hour, min, sec, nsec, time.UTC), true
+	} else if zoneOffset != -1 {
+		t = time.Date(year, time.Month(month), day, hour, min, sec, nsec, time.UTC).Add(-time.Duration(zoneOffset) * time.Second)
+		//use the location if it has the same offset at that time, just like the time package
+		if loc == nil {
+			loc = time.UTC //the time package treats a nil location as UTC for this lookup
+		}
+		if _, off := t.In(loc).Zone(); off == zoneOffset {
+			return t.In(loc), true
+		}
+		return t.In(fixedZone(zoneOffset)), true
+	}
+	return time.Date(year, time.Month(month), day, hour, min, sec, nsec, loc), true
+}
+
+// getnum parses one or two digits, fixed requires two
+func getnum(v []byte, fixed bool) (n int, rest []byte, ok bool) {
+	if len(v) == 0 || !isDigit(v[0]) {
+		return 0, v, false
+	}
+	if len(v) == 1 || !isDigit(v[1]) {
+		if fixed {
+			return 0, v, false
+		}
+		return int(v[0] - '0'), v[1:], true
+	}
+	return int(v[0]-'0')*10 + int(v[1]-'0'), v[2:], true
+}
+
+func isCommaOrPeriod(c byte) bool {
+	return c == '.' || c == ','
+}
+
+// parseNanoseconds parses the fraction in v[:n], which starts with the separator.  Digits beyond nanoseconds are ignored.
+func parseNanoseconds(v []byte, n int) (ns int) {
+	if n > 10 {
+		n = 10
+	}
+	for _, c := range v[1:n] {
+		ns = ns*10 + int(c-'0')
+	}
+	for i := n; i < 10; i++ {
+		ns *= 10
+	}
+	return
+}
+
+func cutspace(v []byte) []byte {
+	for len(v) > 0 && v[0] == ' ' {
+		v = v[1:]
+	}
+	return v
+}
+
+// lookupMonth matches a case insensitive three letter month name
+func lookupMonth(v []byte) int {
+	if len(v) < 3 {
+		return -1
+	}
+	for i, name := range shortMonthNames {
+		if v[0]|0x20 == name[0]|0x20 && v[1]|0x20 == name[1] && v[2]|0x20 == name[2] &&
+			isLetter(v[0]) && isLetter(v[1]) && isLetter(v[2]) {
+			return i + 1
+		}
+	}
+	return -1
+}
+
+func isLetter(c byte) bool {
+	c |= 0x20
+	return 'a' <= c && c <= 'z'
+}
+
+func daysIn(m time.Month, year int) int {
+	switch m {
+	case time.February:
+		if year%4 == 0 && (year%100 != 0 || year%400 == 0) {
+			return 29
+		}
+		return 28
+	case time.April, time.June, time.September, time.November:
+		return 30
+	}
+	return 31
+}
+
+var (
+	fixedZoneMtx sync.RWMutex
+	fixedZones   = map[int]*time.Location{}
+)
+
+// fixedZone returns a cached unnamed zone, matching what the time package creates for numeric offsets
+func fixedZone(offset int) (loc *time.Location) {
+	fixedZoneMtx.RLock()
+	loc = fixedZones[offset]
+	fixedZoneMtx.RUnlock()
+	if loc == nil {
+		loc = time.FixedZone(``, offset)
+		fixedZoneMtx.Lock()
+		fixedZones[offset] = loc
+		fixedZoneMtx.Unlock()
+	}
+	return
+}
@@ -0,0 +1,172 @@
+/*************************************************************************
+ * Copyright 2024 Gravwell, Inc. All rights reserved.
+ * Contact: <legal@gravwell.io>
+ *
+ * This software may be modified and distributed under the terms of the
+ * BSD 2-clause license. See the LICENSE file for details.
+ **************************************************************************/
+
+package timegrinder
+
+import (
+	"math/rand"
+	"testing"
+	"time"
+)
+
+const fastPathMutations = 20000
+
+// mutation alphabet, weighted toward bytes that matter to the formats
+var fastPathAlphabet = []byte("0123456789012345678901234567890123456789-:T Z+.,/|\t\nJanFebMarAprMayJunJulAugSepOctNovDecxyz\xff")
+
+func fastProcessors() []*fastProcessor {
+	return []*fastProcessor{
+		NewRFC3339Processor(),
+		NewRFC3339NanoProcessor(),
+		NewSyslogFileProcessor(),
+		NewSyslogFileProcessorTZ2(),
+		NewZonelessRFC3339(),
+		NewDPKGProcessor(),
+		NewNGINXProcessor(),
+		NewApacheProcessor(),
+		NewApacheNoTZProcessor(),
+		&NewSyslogProcessor().fastProcessor,
+	}
+}
+
+// fastPathSample formats a time with the processor format, fixing up layouts the regex does not cover
+func fastPathSample(fp *fastProcessor, ts time.Time) string {
+	switch fp.Name() {
+	case RFC3339.String(), RFC3339Nano.String():
+		return ts.UTC().Format(fp.Format())
+	}
+	return ts.Format(fp.Format())
+}
+
+func fastPathLocations(t testing.TB) []*time.Location {
+	ny, err := time.LoadLocation(`America/New_York`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return []*time.Location{time.UTC, ny, time.FixedZone(`test`, 9*60*60)}
+}
+
+func sameTime(a, b time.Time) bool {
+	an, ao := a.Zone()
+	bn, bo := b.Zone()
+	return a.Equal(b) && an == bn && ao == bo && a.Location().String() == b.Location().String()
+}
+
+// checkFastPath compares a fast path processor against the regular expression processor it embeds
+func checkFastPath(t testing.TB, fp *fastProcessor, d []byte, loc *time.Location) {
+	t.Helper()
+	ft, fok, foff := fp.Extract(d, loc)
+	rt, rok, roff := fp.processor.Extract(d, loc)
+	if fok != rok || foff != roff || (fok && !sameTime(ft, rt)) {
+		t.Fatalf("%s extraction mismatch on %q in %v\nfast:  %v %v %d\nregex: %v %v %d",
+			fp.Name(), d, loc, ft, fok, foff, rt, rok, roff)
+	}
+	fs, fe, fok := fp.Match(d)
+	rs, re, rok := fp.processor.Match(d)
+	if fok != rok || (fok && (fs != rs || fe != re)) {
+		t.Fatalf("%s match mismatch on %q\nfast:  %d %d %v\nregex: %d %d %v", fp.Name(), d, fs, fe, fok, rs, re, rok)
+	}
+}
+
+func mutate(r *rand.Rand, b []byte) []byte {
+	for n := r.Intn(4); n >= 0; n-- {
+		c := fastPathAlphabet[r.Intn(len(fastPathAlphabet))]
+		i := r.Intn(len(b) + 1)
+		switch r.Intn(3) {
+		case 0: //insert
+			b = append(b[:i], append([]byte{c}, b[i:]...)...)
+		case 1: //replace
+			if i < len(b) {
+				b[i] = c
+			}
+		case 2: //delete
+			if i < len(b) {
+				b = append(b[:i], b[i+1:]...)
+			}
+		}
+	}
+	return b
+}
+
+func TestFastPathDifferential(t *testing.T) {
+	r := rand.New(rand.NewSource(SEED))
+	locs := fastPathLocations(t)
+	for _, fp := range fastProcessors() {
+		for i := 0; i < fastPathMutations; i++ {
+			loc := locs[r.Intn(len(locs))]
+			ts := time.Unix(r.Int63n(4102444800), r.Int63n(1e9)).In(loc)
+			var b []byte
+			if r.Intn(2) == 0 {
+				b = append(b, randStringBuff[:r.Intn(16)]...)
+			}
+			b = append(b, fastPathSample(fp, ts)...)
+			if r.Intn(2) == 0 {
+				b = append(b, randStringBuff[:r.Intn(16)]...)
+			}
+			if i%4 != 0 {
+				b = mutate(r, b)
+			}
+			checkFastPath(t, fp, b, loc)
+		}
+	}
+}
+
+func TestFastPathAllocs(t *testing.T) {
+	for _, fp := range fastProcessors() {
+		d := []byte(`some text ` + fastPathSample(fp, baseTime.Add(123456789*time.Nanosecond).In(time.FixedZone(``, -5*60*60))) + ` more text`)
+		if _, ok, _ := fp.Extract(d, time.UTC); !ok {
+			t.Fatalf("%s failed to extract %q", fp.Name(), d)
+		}
+		allocs := testing.AllocsPerRun(100, func() {
+			fp.Extract(d, time.UTC)
+		})
+		if allocs != 0 {
+			t.Fatalf("%s allocated %v times per extraction", fp.Name(), allocs)
+		}
+	}
+}
+
+func FuzzFastPath(f *testing.F) {
+	for _, fp := range fastProcessors() {
+		f.Add([]byte(fastPathSample(fp, baseTime)))
+	}
+	f.Add([]byte(`12/Jan/2024:10:11:12 -0700`))
+	f.Add([]byte(`Feb 29 23:59:59 host sshd[12]`))
+	f.Add([]byte(`2024-02-30T01:02:03,123456789012Z`))
+	fps := fastProcessors()
+	locs := fastPathLocations(f)
+	f.Fuzz(func(t *testing.T, d []byte) {
+		for _, fp := range fps {
+			for _, loc := range locs {
+				checkFastPath(t, fp, d, loc)
+			}
+		}
+	})
+}
+
+func BenchmarkFastPath(b *testing.B) {
+	for _, fp := range fastProcessors() {
+		d := []byte(`host=web01 level=info ` + fastPathSample(fp, baseTime.Add(123456789*time.Nanosecond)) + ` GET /index.html 200`)
+		b.Run(fp.Name()+`/fast`, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, ok, _ := fp.Extract(d, time.UTC); !ok {
+					b.Fatal("missed extraction")
+				}
+			}
+		})
+		b.Run(fp.Name()+`/regex`, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, ok, _ := fp.processor.Extract(d, time.UTC); !ok {
+					b.Fatal("missed extraction")
+				}
+			}
+		})
+	}
+}
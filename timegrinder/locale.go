@@ -0,0 +1,406 @@
+/*************************************************************************
+ * Copyright 2024 Gravwell, Inc. All rights reserved.
+ * Contact: <legal@gravwell.io>
+ *
+ * This software may be modified and distributed under the terms of the
+ * BSD 2-clause license. See the LICENSE file for details.
+ **************************************************************************/
+
+package timegrinder
+
+import (
+	"errors"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	// englishMonthRegex is the month name pattern used by the built in regular expressions
+	englishMonthRegex = `[JFMASOND][anebriyunlgpctov]+`
+	// bindMonthRegex is the month name pattern used by the Bind regular expression
+	bindMonthRegex = `(Jan|Feb|Mar|Apr|May|Jun|Jul|Aug|Sep|Sept|Oct|Nov|Dec)`
+)
+
+var (
+	ErrUnknownLocale = errors.New("Unknown timestamp locale")
+
+	locales = map[string]*Locale{}
+)
+
+// Locale holds the month and weekday names for a language.  Names are matched case insensitively,
+// abbreviations that are written with a trailing period should include it.
+type Locale struct {
+	Name     string
+	Months   [12][]string // January first, full name first followed by abbreviations
+	Weekdays [7][]string  // Sunday first, full name first followed by abbreviations
+
+	months  map[string]time.Month
+	days    map[string]time.Weekday
+	monthRx string
+}
+
+type nameKind int
+
+const (
+	nameUnknown nameKind = iota
+	nameMonthShort
+	nameMonthLong
+	nameDayShort
+	nameDayLong
+)
+
+func init() {
+	for _, l := range []*Locale{&localeDE, &localeFR, &localeES, &localeIT, &localePT, &localeNL} {
+		l.compile()
+		locales[l.Name] = l
+	}
+}
+
+// LookupLocale returns the locale for a language code such as "de" or "fr".  English is
+// handled by the default processors, so "en" and an empty name return a nil locale.
+func LookupLocale(name string) (*Locale, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if name == `` || name == `en` {
+		return nil, nil
+	}
+	if l, ok := locales[name]; ok {
+		return l, nil
+	}
+	return nil, ErrUnknownLocale
+}
+
+// Locales returns the names of the available locales.
+func Locales() (r []string) {
+	for k := range locales {
+		r = append(r, k)
+	}
+	sort.Strings(r)
+	return
+}
+
+func (l *Locale) compile() {
+	l.months = make(map[string]time.Month, 64)
+	l.days = make(map[string]time.Weekday, 64)
+	var rxs []string
+	for i, names := range l.Months {
+		m := time.Month(i + 1)
+		for _, n := range names {
+			n = strings.ToLower(n)
+			l.months[n] = m
+			rxs = append(rxs, regexp.QuoteMeta(n))
+		}
+		//english names go in the tables so they still take up a name slot when translating
+		l.months[strings.ToLower(m.String())] = m
+		l.months[strings.ToLower(m.String()[:3])] = m
+	}
+	for i, names := range l.Weekdays {
+		d := time.Weekday(i)
+		for _, n := range names {
+			l.days[strings.ToLower(n)] = d
+		}
+		l.days[strings.ToLower(d.String())] = d
+		l.days[strings.ToLower(d.String()[:3])] = d
+	}
+	//longest first so full names win over their abbreviations
+	sort.Slice(rxs, func(i, j int) bool {
+		if len(rxs[i]) != len(rxs[j]) {
+			return len(rxs[i]) > len(rxs[j])
+		}
+		return rxs[i] < rxs[j]
+	})
+	l.monthRx = `(?i:` + strings.Join(rxs, `|`) + `)`
+}
+
+// localizeRegex swaps the english month name patterns for ones that also accept the locale names
+func (l *Locale) localizeRegex(rx string) (string, bool) {
+	if strings.Contains(rx, englishMonthRegex) {
+		return strings.Replace(rx, englishMonthRegex, `(?:`+l.monthRx+`|`+englishMonthRegex+`)`, -1), true
+	} else if strings.Contains(rx, bindMonthRegex) {
+		return strings.Replace(rx, bindMonthRegex, `(?:`+l.monthRx+`|`+bindMonthRegex+`)`, -1), true
+	}
+	return rx, false
+}
+
+// localize renders english month and weekday names in a formatted time with the locale names
+func (l *Locale) localize(v string) string {
+	var sb strings.Builder
+	for i := 0; i < len(v); {
+		j := i
+		for j < len(v) && isLetter(v[j]) {
+			j++
+		}
+		if j == i {
+			sb.WriteByte(v[i])
+			i++
+			continue
+		}
+		sb.WriteString(l.localName(v[i:j]))
+		i = j
+	}
+	return sb.String()
+}
+
+// localName returns the locale name for an english month or weekday name, abbreviations map to the first locale abbreviation
+func (l *Locale) localName(v string) string {
+	pick := func(names []string, short bool) string {
+		if short && len(names) > 1 {
+			return names[1]
+		}
+		return names[0]
+	}
+	for m := time.January; m <= time.December; m++ {
+		if v == m.String() {
+			return pick(l.Months[m-1], false)
+		} else if v == m.String()[:3] {
+			return pick(l.Months[m-1], true)
+		}
+	}
+	for d := time.Sunday; d <= time.Saturday; d++ {
+		if v == d.String() {
+			return pick(l.Weekdays[d], false)
+		} else if v == d.String()[:3] {
+			return pick(l.Weekdays[d], true)
+		}
+	}
+	return v
+}
+
+// layoutNames lists the month and weekday names a time layout expects, in order
+func layoutNames(layout string) (kinds []nameKind) {
+	for i := 0; i < len(layout); {
+		switch v := layout[i:]; {
+		case strings.HasPrefix(v, `January`):
+			kinds, i = append(kinds, nameMonthLong), i+7
+		case strings.HasPrefix(v, `Jan`):
+			kinds, i = append(kinds, nameMonthShort), i+3
+		case strings.HasPrefix(v, `Monday`):
+			kinds, i = append(kinds, nameDayLong), i+6
+		case strings.HasPrefix(v, `Mon`):
+			kinds, i = append(kinds, nameDayShort), i+3
+		default:
+			i++
+		}
+	}
+	return
+}
+
+// translate rewrites locale month and weekday names to the english names the layout expects.
+// Names that are both a month and a weekday (the spanish "mar") are resolved by their position in the layout.
+func (l *Locale) translate(b []byte, kinds []nameKind) []byte {
+	var slot int
+	out := make([]byte, 0, len(b)+8)
+	for i := 0; i < len(b); {
+		r, sz := utf8.DecodeRune(b[i:])
+		if !unicode.IsLetter(r) {
+			out = append(out, b[i:i+sz]...)
+			i += sz
+			continue
+		}
+		j := i + sz
+		for j < len(b) {
+			if r, sz = utf8.DecodeRune(b[j:]); !unicode.IsLetter(r) {
+				break
+			}
+			j += sz
+		}
+		tok := strings.ToLower(string(b[i:j]))
+		if j < len(b) && b[j] == '.' && l.known(tok+`.`) {
+			tok, j = tok+`.`, j+1
+		}
+		var kind nameKind
+		if slot < len(kinds) {
+			kind = kinds[slot]
+		}
+		if name, ok := l.english(tok, kind); ok {
+			out = append(out, name...)
+			slot++
+		} else {
+			out = append(out, b[i:j]...)
+		}
+		i = j
+	}
+	return out
+}
+
+func (l *Locale) known(tok string) bool {
+	_, mok := l.months[tok]
+	_, dok := l.days[tok]
+	return mok || dok
+}
+
+func (l *Locale) english(tok string, kind nameKind) (string, bool) {
+	m, mok := l.months[tok]
+	d, dok := l.days[tok]
+	switch {
+	case mok && kind == nameMonthLong:
+		return m.String(), true
+	case dok && kind == nameDayLong:
+		return d.String(), true
+	case dok && kind == nameDayShort:
+		return d.String()[:3], true
+	case mok:
+		return m.String()[:3], true
+	case dok:
+		return d.String()[:3], true
+	}
+	return ``, false
+}
+
+// localeProcessor is a regular expression processor that accepts month names from a locale
+type localeProcessor struct {
+	processor
+	locale      *Locale
+	kinds       []nameKind
+	yearMissing bool
+}
+
+// NewLocaleProcessor wraps a month name based processor so that it also accepts the month names
+// of a locale, ok is false if the processor does not use month names.
+func NewLocaleProcessor(p Processor, l *Locale) (lp Processor, ok bool) {
+	var base *processor
+	switch v := p.(type) {
+	case *processor:
+		base = v
+	case *fastProcessor:
+		base = &v.processor
+	case *syslogProcessor:
+		base = &v.fastProcessor.processor
+	default:
+		return p, false
+	}
+	if l == nil {
+		return p, false
+	}
+	rxs, ok := l.localizeRegex(base.rxstr)
+	if !ok {
+		return p, false
+	}
+	np := &localeProcessor{
+		processor: *base,
+		locale:    l,
+		kinds:     layoutNames(base.format),
+	}
+	np.rxstr = rxs
+	np.rxp = regexp.MustCompile(rxs)
+	np.min = 0 //locale names can be shorter than the english ones
+	if t, err := time.Parse(base.format, time.Now().Format(base.format)); err == nil && t.Year() == 0 {
+		np.yearMissing = true
+	}
+	return np, true
+}
+
+func (lp *localeProcessor) yearless() bool {
+	return lp.yearMissing
+}
+
+func (lp *localeProcessor) Extract(d []byte, loc *time.Location) (t time.Time, ok bool, offset int) {
+	if t, ok, offset = extractLocale(lp.rxp, lp.trxpEx, d, lp.format, loc, lp.locale, lp.kinds); ok && t.Year() == 0 {
+		t = tweakYear(t)
+	}
+	return
+}
+
+func (lp *localeProcessor) ToString(t time.Time) string {
+	return lp.locale.localize(t.Format(lp.format))
+}
+
+// extractLocale is extract with locale names translated before parsing
+func extractLocale(rx, rxt *regexp.Regexp, d []byte, format string, loc *time.Location, l *Locale, kinds []nameKind) (t time.Time, ok bool, off int) {
+	var err error
+	off = -1
+	idxs := rx.FindIndex(d)
+	if len(idxs) != 2 {
+		return
+	}
+	if rxt != nil {
+		if x := d[idxs[1]:]; len(x) > 0 && rxt.Match(x) {
+			//exclusion match hit, bail
+			return
+		}
+	}
+	if t, err = time.ParseInLocation(format, string(l.translate(d[idxs[0]:idxs[1]], kinds)), loc); err != nil {
+		return
+	}
+	ok = true
+	off = idxs[0]
+	return
+}
+
+var (
+	localeDE = Locale{
+		Name: `de`,
+		Months: [12][]string{
+			{`Januar`, `Jan`, `Jän`, `Jänner`}, {`Februar`, `Feb`}, {`März`, `Mär`, `Mrz`, `Maerz`}, {`April`, `Apr`},
+			{`Mai`}, {`Juni`, `Jun`}, {`Juli`, `Jul`}, {`August`, `Aug`},
+			{`September`, `Sep`, `Sept`}, {`Oktober`, `Okt`}, {`November`, `Nov`}, {`Dezember`, `Dez`},
+		},
+		Weekdays: [7][]string{
+			{`Sonntag`, `So`}, {`Montag`, `Mo`}, {`Dienstag`, `Di`}, {`Mittwoch`, `Mi`},
+			{`Donnerstag`, `Do`}, {`Freitag`, `Fr`}, {`Samstag`, `Sa`},
+		},
+	}
+	localeFR = Locale{
+		Name: `fr`,
+		Months: [12][]string{
+			{`janvier`, `janv.`, `janv`}, {`février`, `févr.`, `févr`, `fév`, `fevrier`, `fevr.`, `fevr`}, {`mars`}, {`avril`, `avr.`, `avr`},
+			{`mai`}, {`juin`}, {`juillet`, `juil.`, `juil`}, {`août`, `aout`},
+			{`septembre`, `sept.`, `sept`}, {`octobre`, `oct.`}, {`novembre`, `nov.`}, {`décembre`, `déc.`, `déc`, `decembre`, `dec.`},
+		},
+		Weekdays: [7][]string{
+			{`dimanche`, `dim.`, `dim`}, {`lundi`, `lun.`, `lun`}, {`mardi`, `mar.`, `mar`}, {`mercredi`, `mer.`, `mer`},
+			{`jeudi`, `jeu.`, `jeu`}, {`vendredi`, `ven.`, `ven`}, {`samedi`, `sam.`, `sam`},
+		},
+	}
+	localeES = Locale{
+		Name: `es`,
+		Months: [12][]string{
+			{`enero`, `ene`, `ene.`}, {`febrero`, `feb`, `feb.`}, {`marzo`, `mar`, `mar.`}, {`abril`, `abr`, `abr.`},
+			{`mayo`, `may`}, {`junio`, `jun`, `jun.`}, {`julio`, `jul`, `jul.`}, {`agosto`, `ago`, `ago.`},
+			{`septiembre`, `sept`, `sep`, `setiembre`, `set`}, {`octubre`, `oct`, `oct.`}, {`noviembre`, `nov`, `nov.`}, {`diciembre`, `dic`, `dic.`},
+		},
+		Weekdays: [7][]string{
+			{`domingo`, `dom`}, {`lunes`, `lun`}, {`martes`, `mar`}, {`miércoles`, `mié`, `miercoles`, `mie`},
+			{`jueves`, `jue`}, {`viernes`, `vie`}, {`sábado`, `sáb`, `sabado`, `sab`},
+		},
+	}
+	localeIT = Locale{
+		Name: `it`,
+		Months: [12][]string{
+			{`gennaio`, `gen`}, {`febbraio`, `feb`}, {`marzo`, `mar`}, {`aprile`, `apr`},
+			{`maggio`, `mag`}, {`giugno`, `giu`}, {`luglio`, `lug`}, {`agosto`, `ago`},
+			{`settembre`, `set`}, {`ottobre`, `ott`}, {`novembre`, `nov`}, {`dicembre`, `dic`},
+		},
+		Weekdays: [7][]string{
+			{`domenica`, `dom`}, {`lunedì`, `lun`, `lunedi`}, {`martedì`, `mar`, `martedi`}, {`mercoledì`, `mer`, `mercoledi`},
+			{`giovedì`, `gio`, `giovedi`}, {`venerdì`, `ven`, `venerdi`}, {`sabato`, `sab`},
+		},
+	}
+	localePT = Locale{
+		Name: `pt`,
+		Months: [12][]string{
+			{`janeiro`, `jan`}, {`fevereiro`, `fev`}, {`março`, `mar`, `marco`}, {`abril`, `abr`},
+			{`maio`, `mai`}, {`junho`, `jun`}, {`julho`, `jul`}, {`agosto`, `ago`},
+			{`setembro`, `set`}, {`outubro`, `out`}, {`novembro`, `nov`}, {`dezembro`, `dez`},
+		},
+		Weekdays: [7][]string{
+			{`domingo`, `dom`}, {`segunda`, `seg`}, {`terça`, `ter`, `terca`}, {`quarta`, `qua`},
+			{`quinta`, `qui`}, {`sexta`, `sex`}, {`sábado`, `sáb`, `sabado`, `sab`},
+		},
+	}
+	localeNL = Locale{
+		Name: `nl`,
+		Months: [12][]string{
+			{`januari`, `jan`}, {`februari`, `feb`}, {`maart`, `mrt`}, {`april`, `apr`},
+			{`mei`}, {`juni`, `jun`}, {`juli`, `jul`}, {`augustus`, `aug`},
+			{`september`, `sep`, `sept`}, {`oktober`, `okt`}, {`november`, `nov`}, {`december`, `dec`},
+		},
+		Weekdays: [7][]string{
+			{`zondag`, `zo`}, {`maandag`, `ma`}, {`dinsdag`, `di`}, {`woensdag`, `wo`},
+			{`donderdag`, `do`}, {`vrijdag`, `vr`}, {`zaterdag`, `za`},
+		},
+	}
+)
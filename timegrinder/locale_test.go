@@ -0,0 +1,110 @@
+/*************************************************************************
+ * Copyright 2024 Gravwell, Inc. All rights reserved.
+ * Contact: <legal@gravwell.io>
+ *
+ * This software may be modified and distributed under the terms of the
+ * BSD 2-clause license. See the LICENSE file for details.
+ **************************************************************************/
+
+package timegrinder
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLocaleLookup(t *testing.T) {
+	for _, name := range []string{`de`, `FR`, ` es `, `it`, `pt`, `nl`} {
+		if l, err := LookupLocale(name); err != nil || l == nil {
+			t.Fatalf("failed to find locale %q: %v", name, err)
+		}
+	}
+	if l, err := LookupLocale(`en`); err != nil || l != nil {
+		t.Fatalf("english should not need a locale: %v %v", l, err)
+	}
+	if _, err := LookupLocale(`tlh`); err != ErrUnknownLocale {
+		t.Fatalf("unknown locale did not fail: %v", err)
+	}
+	if _, err := New(Config{Locale: `tlh`}); err != ErrUnknownLocale {
+		t.Fatalf("unknown locale did not fail: %v", err)
+	}
+}
+
+func TestLocaleBuiltins(t *testing.T) {
+	tests := []struct {
+		locale string
+		line   string
+		want   time.Time
+	}{
+		{`de`, `15.03.2024 - 10/März/2024:11:12:13 +0100 GET /`, time.Date(2024, 3, 10, 11, 12, 13, 0, time.FixedZone(``, 3600))},
+		{`de`, `<13>10 Dez 2023 11:12:13 +0100 firewall`, time.Date(2023, 12, 10, 11, 12, 13, 0, time.FixedZone(``, 3600))},
+		{`fr`, `appliance 02 févr. 2024 08:09:10 +0100 login`, time.Date(2024, 2, 2, 8, 9, 10, 0, time.FixedZone(``, 3600))},
+		{`fr`, `appliance 21 AOÛT 2024 08:09:10 +0200 login`, time.Date(2024, 8, 21, 8, 9, 10, 0, time.FixedZone(``, 7200))},
+		{`es`, `evento 05-ene-2024 01:02:03.456 cliente`, time.Date(2024, 1, 5, 1, 2, 3, 456000000, time.UTC)},
+		{`nl`, `12/mrt/2024:01:02:03 +0000`, time.Date(2024, 3, 12, 1, 2, 3, 0, time.UTC)},
+		//english keeps working with a locale set
+		{`de`, `10/Mar/2024:11:12:13 +0100`, time.Date(2024, 3, 10, 11, 12, 13, 0, time.FixedZone(``, 3600))},
+	}
+	for _, tt := range tests {
+		tg, err := New(Config{Locale: tt.locale})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ts, ok, err := tg.Extract([]byte(tt.line))
+		if err != nil || !ok {
+			t.Fatalf("%s failed to extract %q: %v", tt.locale, tt.line, err)
+		} else if !ts.Equal(tt.want) {
+			t.Fatalf("%s bad extraction on %q: %v != %v", tt.locale, tt.line, ts, tt.want)
+		}
+	}
+
+	//year-less syslog timestamps still get a year
+	tg, err := New(Config{Locale: `de`})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ts, ok, _ := tg.Extract([]byte(`Mai  3 01:02:03 host sshd[12]: hi`)); !ok || ts.Year() < 2024 || ts.Month() != time.May {
+		t.Fatalf("bad syslog extraction %v %v", ts, ok)
+	}
+	//without a locale nothing matches
+	if tg, err = New(Config{}); err != nil {
+		t.Fatal(err)
+	} else if _, ok, _ := tg.Extract([]byte(`10/März/2024:11:12:13 +0100`)); ok {
+		t.Fatal("english timegrinder extracted a german month")
+	}
+}
+
+func TestLocaleCustomFormat(t *testing.T) {
+	//spanish "mar" is both martes and marzo, the layout decides
+	cf := CustomFormat{
+		Name:   `es`,
+		Regex:  `\pL+\.?\s\d{1,2}\s\pL+\.?\s\d{4}\s\d{2}:\d{2}`,
+		Format: `Mon 2 Jan 2006 15:04`,
+		Locale: `es`,
+	}
+	p, err := NewCustomProcessor(cf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts, ok, _ := p.Extract([]byte(`[mar 12 mar 2024 10:11] acceso`), time.UTC)
+	if !ok || !ts.Equal(time.Date(2024, 3, 12, 10, 11, 0, 0, time.UTC)) {
+		t.Fatalf("bad custom extraction %v %v", ts, ok)
+	}
+
+	cf = CustomFormat{
+		Name:   `fr`,
+		Regex:  `\d{1,2}\s\pL+\s\d{4}`,
+		Format: `2 January 2006`,
+		Locale: `fr`,
+	}
+	if p, err = NewCustomProcessor(cf); err != nil {
+		t.Fatal(err)
+	} else if ts, ok, _ = p.Extract([]byte(`le 14 juillet 1789`), time.UTC); !ok || !ts.Equal(time.Date(1789, 7, 14, 0, 0, 0, 0, time.UTC)) {
+		t.Fatalf("bad custom extraction %v %v", ts, ok)
+	}
+
+	cf.Locale = `tlh`
+	if err = cf.Validate(); err != ErrUnknownLocale {
+		t.Fatalf("unknown locale did not fail: %v", err)
+	}
+}
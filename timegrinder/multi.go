@@ -0,0 +1,111 @@
+/*************************************************************************
+ * Copyright 2024 Gravwell, Inc. All rights reserved.
+ * Contact: <legal@gravwell.io>
+ *
+ * This software may be modified and distributed under the terms of the
+ * BSD 2-clause license. See the LICENSE file for details.
+ **************************************************************************/
+
+package timegrinder
+
+import (
+	"bytes"
+	"time"
+)
+
+// TimestampMatch describes a single timestamp located within a block of data.
+type TimestampMatch struct {
+	TS    time.Time
+	Start int    // offset of the first byte of the timestamp
+	End   int    // offset just past the last byte of the timestamp
+	Name  string // name of the processor that matched
+	Skew  Skew   // bound violated by the timestamp, the SkewPolicy is not applied
+}
+
+// ExtractAll returns every timestamp found in data in the order they appear.
+// At each position the leftmost match across all processors wins, ties go to the longest match
+// and then to the format override.  Scanning resumes after the end of each match.
+func (tg *TimeGrinder) ExtractAll(data []byte) (ms []TimestampMatch) {
+	for pos := 0; pos < len(data); {
+		m, ok := tg.next(data, pos)
+		if !ok {
+			break
+		}
+		ms = append(ms, m)
+		if pos = m.End; m.End <= m.Start {
+			pos = m.Start + 1
+		}
+	}
+	return
+}
+
+// ExtractNth returns the nth timestamp (starting at zero) found in data, negative values
+// count back from the last timestamp so -1 is the last timestamp in the data.
+func (tg *TimeGrinder) ExtractNth(data []byte, n int) (t time.Time, ok bool, err error) {
+	var m TimestampMatch
+	if n < 0 {
+		ms := tg.ExtractAll(data)
+		if n += len(ms); n < 0 {
+			return
+		}
+		m = ms[n]
+	} else {
+		pos := 0
+		for ; n >= 0; n-- {
+			if m, ok = tg.next(data, pos); !ok {
+				return
+			}
+			if pos = m.End; m.End <= m.Start {
+				pos = m.Start + 1
+			}
+		}
+	}
+	t, ok = tg.applySkew(m.TS, m.Skew)
+	return
+}
+
+// ExtractAfterKey returns the first timestamp following the first occurrence of key,
+// for example the end time in "start=... end=...".
+func (tg *TimeGrinder) ExtractAfterKey(data, key []byte) (t time.Time, ok bool, err error) {
+	var m TimestampMatch
+	idx := bytes.Index(data, key)
+	if idx < 0 {
+		return
+	}
+	if m, ok = tg.next(data, idx+len(key)); ok {
+		t, ok = tg.applySkew(m.TS, m.Skew)
+	}
+	return
+}
+
+// next finds the leftmost timestamp at or after pos
+func (tg *TimeGrinder) next(data []byte, pos int) (m TimestampMatch, ok bool) {
+	var hp Processor
+	d := data[pos:]
+	try := func(p Processor) {
+		start, end, hit := p.Match(d)
+		if !hit {
+			return
+		} else if ok && (start > m.Start || (start == m.Start && end <= m.End)) {
+			return
+		}
+		t, eok, _ := p.Extract(d, tg.loc)
+		if !eok {
+			return
+		}
+		m = TimestampMatch{TS: t, Start: start, End: end, Name: p.Name()}
+		hp, ok = p, true
+	}
+	if tg.override != nil {
+		try(tg.override)
+	}
+	for _, p := range tg.procs {
+		try(p)
+	}
+	if ok {
+		m.Start += pos
+		m.End += pos
+		m.TS, m.Skew = tg.checkSkew(m.TS, hp)
+	}
+	return
+}
@@ -0,0 +1,94 @@
+/*************************************************************************
+ * Copyright 2024 Gravwell, Inc. All rights reserved.
+ * Contact: <legal@gravwell.io>
+ *
+ * This software may be modified and distributed under the terms of the
+ * BSD 2-clause license. See the LICENSE file for details.
+ **************************************************************************/
+
+package timegrinder
+
+import (
+	"testing"
+	"time"
+)
+
+const multiLine = `Jun 15 12:00:01 collector start=2024-06-15T11:58:00Z end=2024-06-15 11:59:30 msg="done at 15/Jun/2024:11:59:31 +0000"`
+
+func TestExtractAll(t *testing.T) {
+	tg, err := New(Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ms := tg.ExtractAll([]byte(multiLine))
+	names := []string{`Syslog`, `RFC3339`, `DPKG`, `Apache`}
+	if len(ms) != len(names) {
+		t.Fatalf("bad match count %d: %+v", len(ms), ms)
+	}
+	for i, m := range ms {
+		if m.Name != names[i] {
+			t.Fatalf("match %d is %s not %s", i, m.Name, names[i])
+		} else if x := multiLine[m.Start:m.End]; x != m.TS.Format(testProcessor(t, tg, m.Name).Format()) {
+			t.Fatalf("match %d offsets %d:%d do not cover the timestamp: %q", i, m.Start, m.End, x)
+		}
+	}
+	if !ms[1].TS.Equal(time.Date(2024, 6, 15, 11, 58, 0, 0, time.UTC)) {
+		t.Fatalf("bad start time %v", ms[1].TS)
+	}
+	if ms = tg.ExtractAll([]byte(`nothing to see here`)); len(ms) != 0 {
+		t.Fatalf("found timestamps in junk: %+v", ms)
+	}
+}
+
+func testProcessor(t *testing.T, tg *TimeGrinder, name string) Processor {
+	t.Helper()
+	p, ok := tg.GetProcessor(name)
+	if !ok {
+		t.Fatalf("missing processor %s", name)
+	}
+	return p
+}
+
+func TestExtractNth(t *testing.T) {
+	tg, err := New(Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := time.Date(2024, 6, 15, 11, 59, 30, 0, time.UTC)
+	if ts, ok, err := tg.ExtractNth([]byte(multiLine), 2); err != nil || !ok || !ts.Equal(want) {
+		t.Fatalf("bad 2nd timestamp %v %v %v", ts, ok, err)
+	}
+	want = want.Add(time.Second)
+	if ts, ok, _ := tg.ExtractNth([]byte(multiLine), -1); !ok || !ts.Equal(want) {
+		t.Fatalf("bad last timestamp %v %v", ts, ok)
+	}
+	if _, ok, _ := tg.ExtractNth([]byte(multiLine), 4); ok {
+		t.Fatal("got a timestamp past the end")
+	} else if _, ok, _ = tg.ExtractNth([]byte(multiLine), -5); ok {
+		t.Fatal("got a timestamp before the start")
+	}
+}
+
+func TestExtractAfterKey(t *testing.T) {
+	tg, err := New(Config{MaxPastAge: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tg.now = func() time.Time { return time.Date(2024, 6, 15, 12, 30, 0, 0, time.UTC) }
+	want := time.Date(2024, 6, 15, 11, 59, 30, 0, time.UTC)
+	if ts, ok, err := tg.ExtractAfterKey([]byte(multiLine), []byte(`end=`)); err != nil || !ok || !ts.Equal(want) {
+		t.Fatalf("bad end timestamp %v %v %v", ts, ok, err)
+	}
+	if _, ok, _ := tg.ExtractAfterKey([]byte(multiLine), []byte(`stop=`)); ok {
+		t.Fatal("got a timestamp for a missing key")
+	}
+	//the skew policy still applies to the selected timestamp
+	tg.now = func() time.Time { return time.Date(2024, 7, 1, 0, 0, 0, 0, time.UTC) }
+	if _, ok, _ := tg.ExtractAfterKey([]byte(multiLine), []byte(`end=`)); ok {
+		t.Fatal("old timestamp was not rejected")
+	}
+	ms := tg.ExtractAll([]byte(multiLine))
+	if len(ms) != 4 || ms[2].Skew != SkewPast {
+		t.Fatalf("bad skew on matches: %+v", ms)
+	}
+}
@@ -347,7 +347,7 @@ func NewRFC1123ZProcessor() *processor {
 	}
 }
 
-func NewRFC3339Processor() *processor {
+func newRFC3339RegexProcessor() *processor {
 	return &processor{
 		rxp:    regexp.MustCompile(RFC3339Regex),
 		rxstr:  RFC3339Regex,
@@ -357,7 +357,7 @@ func NewRFC3339Processor() *processor {
 	}
 }
 
-func NewRFC3339NanoProcessor() *processor {
+func newRFC3339NanoRegexProcessor() *processor {
 	return &processor{
 		rxp:    regexp.MustCompile(RFC3339NanoRegex),
 		rxstr:  RFC3339NanoRegex,
@@ -367,7 +367,7 @@ func NewRFC3339NanoProcessor() *processor {
 	}
 }
 
-func NewApacheProcessor() *processor {
+func newApacheRegexProcessor() *processor {
 	return &processor{
 		rxp:    regexp.MustCompile(ApacheRegex),
 		rxstr:  ApacheRegex,
@@ -377,7 +377,7 @@ func NewApacheProcessor() *processor {
 	}
 }
 
-func NewApacheNoTZProcessor() *processor {
+func newApacheNoTZRegexProcessor() *processor {
 	return &processor{
 		rxp:    regexp.MustCompile(ApacheNoTzRegex),
 		trxpEx: regexp.MustCompile(`^\s?[-+]{1}\d{4}`),
@@ -388,7 +388,7 @@ func NewApacheNoTZProcessor() *processor {
 	}
 }
 
-func NewSyslogFileProcessor() *processor {
+func newSyslogFileRegexProcessor() *processor {
 	return &processor{
 		rxp:    regexp.MustCompile(SyslogFileRegex),
 		rxstr:  SyslogFileRegex,
@@ -398,7 +398,7 @@ func NewSyslogFileProcessor() *processor {
 	}
 }
 
-func NewSyslogFileProcessorTZ2() *processor {
+func newSyslogFileTZ2RegexProcessor() *processor {
 	return &processor{
 		rxp:    regexp.MustCompile(SyslogFileTZRegex),
 		rxstr:  SyslogFileTZRegex,
@@ -408,7 +408,7 @@ func NewSyslogFileProcessorTZ2() *processor {
 	}
 }
 
-func NewDPKGProcessor() *processor {
+func newDPKGRegexProcessor() *processor {
 	return &processor{
 		rxp:    regexp.MustCompile(DPKGRegex),
 		rxstr:  DPKGRegex,
@@ -418,7 +418,7 @@ func NewDPKGProcessor() *processor {
 	}
 }
 
-func NewNGINXProcessor() *processor {
+func newNGINXRegexProcessor() *processor {
 	return &processor{
 		rxp:    regexp.MustCompile(NGINXRegex),
 		rxstr:  NGINXRegex,
@@ -428,7 +428,7 @@ func NewNGINXProcessor() *processor {
 	}
 }
 
-func NewZonelessRFC3339() *processor {
+func newZonelessRFC3339RegexProcessor() *processor {
 	return &processor{
 		rxp:    regexp.MustCompile(ZonelessRFC3339Regex),
 		trxpEx: regexp.MustCompile(tzRegexMatch),
@@ -21,18 +21,12 @@ import (
 //model and may be a little more expensive to actually process
 
 type syslogProcessor struct {
-	processor
+	fastProcessor
 }
 
 func NewSyslogProcessor() *syslogProcessor {
 	return &syslogProcessor{
-		processor: processor{
-			rxp:    regexp.MustCompile(SyslogRegex),
-			rxstr:  SyslogRegex,
-			format: SyslogFormat,
-			name:   Syslog.String(),
-			min:    len(SyslogFormat),
-		},
+		fastProcessor: *newSyslogFastProcessor(),
 	}
 }
 
@@ -106,11 +100,15 @@ func NewUserProcessor(name, rxps, fmts string) (*processor, error) {
 	}, nil
 }
 
+func (sp syslogProcessor) yearless() bool {
+	return true
+}
+
 func (sp syslogProcessor) Extract(d []byte, loc *time.Location) (time.Time, bool, int) {
 	if len(d) < sp.min {
 		return time.Time{}, false, -1
 	}
-	t, ok, offset := sp.processor.Extract(d, loc)
+	t, ok, offset := sp.fastProcessor.Extract(d, loc)
 	if !ok {
 		return time.Time{}, false, -1
 	}
@@ -498,12 +496,5 @@ func tweakYear(t time.Time) time.Time {
 	if t.Year() != 0 {
 		return t
 	}
-	now := time.Now()
-	year := now.Year()
-	// If setting the current year puts us too far in the future,
-	// more than 25 hours, we'll set the previous year instead.
-	if t.AddDate(year, 0, 0).Sub(now) > (25 * time.Hour) {
-		return t.AddDate(year-1, 0, 0)
-	}
-	return t.AddDate(year, 0, 0)
+	return inferYear(t, time.Now(), defaultYearRolloverWindow)
 }
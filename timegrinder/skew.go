@@ -0,0 +1,154 @@
+/*************************************************************************
+ * Copyright 2024 Gravwell, Inc. All rights reserved.
+ * Contact: <legal@gravwell.io>
+ *
+ * This software may be modified and distributed under the terms of the
+ * BSD 2-clause license. See the LICENSE file for details.
+ **************************************************************************/
+
+package timegrinder
+
+import (
+	"errors"
+	"strings"
+	"time"
+)
+
+const (
+	// SkewPolicyIngest reports out of bounds timestamps as a failed extraction so the caller
+	// falls back to the ingest time.
+	SkewPolicyIngest SkewPolicy = `ingest`
+	// SkewPolicyClamp replaces out of bounds timestamps with the current time.
+	SkewPolicyClamp SkewPolicy = `clamp`
+	// SkewPolicyFlag returns out of bounds timestamps untouched, the caller is expected to flag the entry.
+	SkewPolicyFlag SkewPolicy = `flag`
+
+	// SkewFlagName is the enumerated value name used when flagging skewed entries.
+	SkewFlagName = `timestamp_skew`
+
+	defaultYearRolloverWindow = 25 * time.Hour
+)
+
+const (
+	SkewNone Skew = iota
+	SkewFuture
+	SkewPast
+)
+
+var (
+	ErrInvalidSkewPolicy = errors.New("Invalid timestamp skew policy")
+	ErrNegativeSkewBound = errors.New("Timestamp skew bounds cannot be negative")
+)
+
+// SkewPolicy controls how a TimeGrinder handles timestamps outside of the configured bounds.
+type SkewPolicy string
+
+// Skew indicates which bound, if any, an extracted timestamp violated.
+type Skew int
+
+// ParseSkewPolicy resolves a case insensitive policy name, an empty name is the ingest policy.
+func ParseSkewPolicy(v string) (p SkewPolicy, err error) {
+	switch p = SkewPolicy(strings.ToLower(strings.TrimSpace(v))); p {
+	case ``:
+		p = SkewPolicyIngest
+	case SkewPolicyIngest, SkewPolicyClamp, SkewPolicyFlag:
+	default:
+		err = ErrInvalidSkewPolicy
+	}
+	return
+}
+
+func (s Skew) String() string {
+	switch s {
+	case SkewFuture:
+		return `future`
+	case SkewPast:
+		return `past`
+	}
+	return ``
+}
+
+func (c *Config) validateSkew() (err error) {
+	if c.MaxFutureSkew < 0 || c.MaxPastAge < 0 || c.YearRolloverWindow < 0 {
+		return ErrNegativeSkewBound
+	}
+	c.SkewPolicy, err = ParseSkewPolicy(string(c.SkewPolicy))
+	return
+}
+
+// bounded indicates that extracted timestamps need to be compared against the current time
+func (c *Config) bounded() bool {
+	return c.MaxFutureSkew > 0 || c.MaxPastAge > 0
+}
+
+// ExtractSkew behaves like Extract but also reports whether the timestamp violated the
+// MaxFutureSkew or MaxPastAge bounds.  Under the flag policy the timestamp is returned
+// untouched alongside the skew; under the clamp policy the current time is returned;
+// under the ingest policy ok is false.
+func (tg *TimeGrinder) ExtractSkew(data []byte) (t time.Time, ok bool, skew Skew, err error) {
+	var p Processor
+	if t, ok, p = tg.extract(data); !ok {
+		return
+	}
+	t, skew = tg.checkSkew(t, p)
+	t, ok = tg.applySkew(t, skew)
+	return
+}
+
+// checkSkew fixes up the year for year-less processors and classifies the timestamp against the bounds
+func (tg *TimeGrinder) checkSkew(t time.Time, p Processor) (time.Time, Skew) {
+	if tg.YearRolloverWindow == 0 && !tg.bounded() {
+		return t, SkewNone
+	}
+	now := tg.now()
+	if yp, isyp := p.(yearless); isyp && yp.yearless() {
+		//processors already guessed with the default window, redo it against our clock and window
+		window := tg.YearRolloverWindow
+		if window == 0 {
+			window = defaultYearRolloverWindow
+		}
+		t = inferYear(t, now, window)
+	}
+	if tg.MaxFutureSkew > 0 && t.Sub(now) > tg.MaxFutureSkew {
+		return t, SkewFuture
+	} else if tg.MaxPastAge > 0 && now.Sub(t) > tg.MaxPastAge {
+		return t, SkewPast
+	}
+	return t, SkewNone
+}
+
+// applySkew enforces the SkewPolicy on a classified timestamp
+func (tg *TimeGrinder) applySkew(t time.Time, skew Skew) (time.Time, bool) {
+	if skew == SkewNone {
+		return t, true
+	}
+	switch tg.SkewPolicy {
+	case SkewPolicyClamp:
+		return tg.now().In(t.Location()), true
+	case SkewPolicyFlag:
+		return t, true
+	}
+	return time.Time{}, false
+}
+
+// yearless is implemented by processors whose formats do not carry a year.
+type yearless interface {
+	yearless() bool
+}
+
+// inferYear places a timestamp in the year nearest to now, preferring the next year
+// (a January timestamp seen on New Years Eve) then the current year then the previous year
+// (a December timestamp seen in January).  A candidate is accepted when it is no more than
+// window ahead of now.
+func inferYear(t, now time.Time, window time.Duration) time.Time {
+	for year := now.Year() + 1; year > now.Year()-1; year-- {
+		if c := withYear(t, year); c.Sub(now) <= window {
+			return c
+		}
+	}
+	return withYear(t, now.Year()-1)
+}
+
+func withYear(t time.Time, year int) time.Time {
+	return time.Date(year, t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), t.Location())
+}
@@ -0,0 +1,122 @@
+/*************************************************************************
+ * Copyright 2024 Gravwell, Inc. All rights reserved.
+ * Contact: <legal@gravwell.io>
+ *
+ * This software may be modified and distributed under the terms of the
+ * BSD 2-clause license. See the LICENSE file for details.
+ **************************************************************************/
+
+package timegrinder
+
+import (
+	"testing"
+	"time"
+)
+
+func newSkewGrinder(t *testing.T, c Config, now time.Time) *TimeGrinder {
+	t.Helper()
+	tg, err := New(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tg.now = func() time.Time { return now }
+	return tg
+}
+
+func TestSkewConfig(t *testing.T) {
+	tg, err := New(Config{SkewPolicy: `CLAMP`})
+	if err != nil {
+		t.Fatal(err)
+	} else if tg.SkewPolicy != SkewPolicyClamp {
+		t.Fatalf("bad policy %q", tg.SkewPolicy)
+	}
+	if tg, err = New(Config{}); err != nil {
+		t.Fatal(err)
+	} else if tg.SkewPolicy != SkewPolicyIngest {
+		t.Fatalf("bad default policy %q", tg.SkewPolicy)
+	}
+	if _, err = New(Config{SkewPolicy: `ignore`}); err != ErrInvalidSkewPolicy {
+		t.Fatalf("bad policy did not fail: %v", err)
+	}
+	if _, err = New(Config{MaxPastAge: -time.Hour}); err != ErrNegativeSkewBound {
+		t.Fatalf("negative bound did not fail: %v", err)
+	}
+}
+
+func TestSkewPolicies(t *testing.T) {
+	now := time.Date(2024, 6, 15, 12, 0, 0, 0, time.UTC)
+	future := []byte(`2024-06-15T14:00:00Z device with a fast clock`)
+	past := []byte(`2019-06-15T12:00:00Z device with a dead battery`)
+	good := []byte(`2024-06-15T11:59:00Z normal line`)
+	c := Config{MaxFutureSkew: time.Hour, MaxPastAge: 30 * 24 * time.Hour}
+
+	tg := newSkewGrinder(t, c, now)
+	if _, ok, skew, err := tg.ExtractSkew(future); err != nil || ok || skew != SkewFuture {
+		t.Fatalf("ingest policy: %v %v %v", ok, skew, err)
+	}
+	if _, ok, _ := tg.Extract(past); ok {
+		t.Fatal("ingest policy accepted an old timestamp")
+	}
+	if ts, ok, skew, _ := tg.ExtractSkew(good); !ok || skew != SkewNone || !ts.Equal(now.Add(-time.Minute)) {
+		t.Fatalf("in bounds timestamp: %v %v %v", ts, ok, skew)
+	}
+
+	c.SkewPolicy = SkewPolicyClamp
+	tg = newSkewGrinder(t, c, now)
+	for _, d := range [][]byte{future, past} {
+		if ts, ok, skew, _ := tg.ExtractSkew(d); !ok || skew == SkewNone || !ts.Equal(now) {
+			t.Fatalf("clamp policy on %q: %v %v %v", d, ts, ok, skew)
+		}
+	}
+
+	c.SkewPolicy = SkewPolicyFlag
+	tg = newSkewGrinder(t, c, now)
+	if ts, ok, skew, _ := tg.ExtractSkew(past); !ok || skew != SkewPast || ts.Year() != 2019 {
+		t.Fatalf("flag policy: %v %v %v", ts, ok, skew)
+	} else if skew.String() != `past` {
+		t.Fatalf("bad skew name %q", skew)
+	}
+}
+
+func TestYearRollover(t *testing.T) {
+	tests := []struct {
+		now  time.Time
+		line string
+		year int
+	}{
+		//January lines seen on New Years Eve belong to the next year
+		{time.Date(2023, 12, 31, 23, 50, 0, 0, time.UTC), `Jan  1 00:05:00 host sshd[1]: hi`, 2024},
+		//December lines seen after midnight belong to the previous year
+		{time.Date(2024, 1, 1, 0, 10, 0, 0, time.UTC), `Dec 31 23:55:00 host sshd[1]: hi`, 2023},
+		{time.Date(2024, 1, 1, 0, 10, 0, 0, time.UTC), `Jan  1 00:09:00 host sshd[1]: hi`, 2024},
+		{time.Date(2024, 6, 15, 12, 0, 0, 0, time.UTC), `Jun 16 12:30:00 host sshd[1]: hi`, 2023},
+		{time.Date(2024, 6, 15, 12, 0, 0, 0, time.UTC), `Jun 15 12:30:00 host sshd[1]: hi`, 2024},
+	}
+	for _, tt := range tests {
+		tg := newSkewGrinder(t, Config{YearRolloverWindow: time.Hour}, tt.now)
+		if ts, ok, err := tg.Extract([]byte(tt.line)); err != nil || !ok {
+			t.Fatalf("failed to extract %q: %v", tt.line, err)
+		} else if ts.Year() != tt.year {
+			t.Fatalf("%q at %v got %v", tt.line, tt.now, ts)
+		}
+	}
+
+	//years inferred by custom formats follow the same rules
+	proc, err := NewCustomProcessor(CustomFormat{
+		Name:   `custom`,
+		Regex:  `\d{2}/\d{2}\s\d{2}:\d{2}:\d{2}`,
+		Format: `01/02 15:04:05`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tg := newSkewGrinder(t, Config{YearRolloverWindow: time.Hour}, time.Date(2023, 12, 31, 23, 30, 0, 0, time.UTC))
+	if _, err = tg.AddProcessor(proc); err != nil {
+		t.Fatal(err)
+	} else if err = tg.SetFormatOverride(`custom`); err != nil {
+		t.Fatal(err)
+	}
+	if ts, ok, _ := tg.Extract([]byte(`01/01 00:15:00 event`)); !ok || ts.Year() != 2024 {
+		t.Fatalf("bad custom rollover: %v %v", ts, ok)
+	}
+}
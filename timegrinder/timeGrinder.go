@@ -47,6 +47,7 @@ type TimeGrinder struct {
 	seed     bool
 	override Processor
 	loc      *time.Location
+	now      func() time.Time
 }
 
 // Config defines a few configuration options when instantiating a new TimeGrinder.
@@ -57,6 +58,17 @@ type Config struct {
 	EnableLeftMostSeed bool
 	// FormatOverride sets a format (e.g. "AnsiC") which should be tried first during parsing.
 	FormatOverride string
+	// MaxFutureSkew is how far past now a timestamp may be, zero disables the check.
+	MaxFutureSkew time.Duration
+	// MaxPastAge is how far before now a timestamp may be, zero disables the check.
+	MaxPastAge time.Duration
+	// SkewPolicy decides what happens to timestamps outside the bounds, defaults to SkewPolicyIngest.
+	SkewPolicy SkewPolicy
+	// Locale is a language code (e.g. "de") whose month names the built in formats also accept, see Locales.
+	Locale string
+	// YearRolloverWindow is how far into the future a timestamp from a format without a year
+	// may land before the previous year is assumed, defaults to 25 hours.
+	YearRolloverWindow time.Duration
 }
 
 func Extract(b []byte) (t time.Time, ok bool, err error) {
@@ -185,11 +197,25 @@ func New(c Config) (tg *TimeGrinder, err error) {
 	// DirectAdmin format
 	procs = append(procs, NewDirectAdmin())
 
+	if err = c.validateSkew(); err != nil {
+		return
+	}
+	if c.Locale != `` {
+		var l *Locale
+		if l, err = LookupLocale(c.Locale); err != nil {
+			return
+		}
+		for i := range procs {
+			procs[i], _ = NewLocaleProcessor(procs[i], l)
+		}
+	}
 	tg = &TimeGrinder{
-		procs: procs,
-		count: len(procs),
-		loc:   time.UTC,
-		seed:  c.EnableLeftMostSeed,
+		Config: c,
+		procs:  procs,
+		count:  len(procs),
+		loc:    time.UTC,
+		seed:   c.EnableLeftMostSeed,
+		now:    time.Now,
 	}
 	if c.FormatOverride != `` {
 		err = tg.SetFormatOverride(c.FormatOverride)
@@ -301,12 +327,20 @@ func (tg *TimeGrinder) setSeed(data []byte) (hit bool) {
 
 // Extract returns time and error.  If no time can be extracted time is the zero
 // value and bool is false.  Error indicates a catastrophic failure.
+// Timestamps outside the configured bounds are handled according to the SkewPolicy.
 func (tg *TimeGrinder) Extract(data []byte) (t time.Time, ok bool, err error) {
+	t, ok, _, err = tg.ExtractSkew(data)
+	return
+}
+
+// extract runs the processors and returns the one that hit
+func (tg *TimeGrinder) extract(data []byte) (t time.Time, ok bool, p Processor) {
 	var i int
 	var c int
 
 	if tg.override != nil {
 		if t, ok, _ = tg.override.Extract(data, tg.loc); ok {
+			p = tg.override
 			return
 		}
 	}
@@ -322,6 +356,7 @@ func (tg *TimeGrinder) Extract(data []byte) (t time.Time, ok bool, err error) {
 		t, ok, _ = tg.procs[i].Extract(data, tg.loc)
 		if ok {
 			tg.curr = i
+			p = tg.procs[i]
 			return
 		}
 		//move the current forward
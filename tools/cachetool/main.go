@@ -0,0 +1,413 @@
+/*************************************************************************
+ * Copyright 2024 Gravwell, Inc. All rights reserved.
+ * Contact: <legal@gravwell.io>
+ *
+ * This software may be modified and distributed under the terms of the
+ * BSD 2-clause license. See the LICENSE file for details.
+ **************************************************************************/
+
+// cachetool inspects, exports, truncates, and re-injects ingester cache directories
+// while the ingester is stopped.
+package main
+
+import (
+	"bufio"
+	"encoding/gob"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/gravwell/gravwell/v3/chancacher"
+	"github.com/gravwell/gravwell/v3/ingest/entry"
+)
+
+var (
+	codecName = flag.String("codec", "gob", "Cache encoding, gob for ingester caches, entry for native entry caches, or columnar for columnar block caches")
+	output    = flag.String("o", "", "Output file for export, defaults to stdout")
+	format    = flag.String("format", "json", "Export file format, json for one canonical JSON entry per line or columnar for compressed columnar blocks")
+	before    = flag.String("before", "", "Truncate only entries with timestamps before this RFC3339 time")
+	rate      = flag.Float64("rate", 0, "Expected replay rate in entries per second, used to estimate replay time")
+)
+
+func main() {
+	flag.Usage = showHelp
+	flag.Parse()
+	if flag.NArg() < 2 {
+		showHelp()
+		os.Exit(-1)
+	}
+	codec, err := getCodec(*codecName)
+	if err == nil && *format != `json` && *format != `columnar` {
+		err = fmt.Errorf("unknown export format %q", *format)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(-1)
+	}
+	dirs := cacheDirs(flag.Arg(1))
+	switch flag.Arg(0) {
+	case `inspect`:
+		err = inspect(flag.Arg(1), dirs, codec)
+	case `export`:
+		err = export(dirs, codec)
+	case `truncate`:
+		err = truncate(dirs, codec)
+	case `inject`:
+		if flag.NArg() != 3 {
+			err = errors.New("inject requires a cache directory and an export file")
+		} else {
+			err = inject(dirs[0], flag.Arg(2), codec)
+		}
+	default:
+		err = fmt.Errorf("invalid action %q", flag.Arg(0))
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s failed - %v\n", flag.Arg(0), err)
+		os.Exit(-1)
+	}
+}
+
+func showHelp() {
+	app := filepath.Base(os.Args[0])
+	fmt.Printf("%s [options] <action> <cache directory> [export file]\n", app)
+	fmt.Printf("\nActions:\n")
+	fmt.Printf("\tinspect\tshow item counts, size, and the oldest and newest entries\n")
+	fmt.Printf("\texport\twrite every cached entry as a line of canonical JSON, or as columnar blocks with -format columnar\n")
+	fmt.Printf("\ttruncate\tdrop cached entries, optionally only those older than -before\n")
+	fmt.Printf("\tinject\tappend entries from an export file to the cache\n")
+	fmt.Printf("\nThe cache directory may be an ingester Ingest-Cache-Path or a single cache.\n")
+	fmt.Printf("The ingester must be stopped, caches in use are locked.\n\n")
+	flag.PrintDefaults()
+	fmt.Printf("\nExample: %s -rate 50000 inspect /opt/gravwell/cache/simple_relay\n", app)
+}
+
+// entryCodec adapts the native entry codec to the interface values used for ingester caches
+type entryCodec struct{}
+
+type entryEncoder struct {
+	enc chancacher.Encoder[*entry.Entry]
+}
+
+type entryDecoder struct {
+	dec chancacher.Decoder[*entry.Entry]
+}
+
+func (entryCodec) NewEncoder(w io.Writer) chancacher.Encoder[interface{}] {
+	return entryEncoder{enc: chancacher.EntryCodec{}.NewEncoder(w)}
+}
+
+func (entryCodec) NewDecoder(r io.Reader) chancacher.Decoder[interface{}] {
+	return entryDecoder{dec: chancacher.EntryCodec{}.NewDecoder(r)}
+}
+
+func (e entryEncoder) Encode(v interface{}) error {
+	ent, ok := v.(*entry.Entry)
+	if !ok {
+		return fmt.Errorf("cannot encode %T with the entry codec", v)
+	}
+	return e.enc.Encode(ent)
+}
+
+func (d entryDecoder) Decode() (interface{}, error) {
+	return d.dec.Decode()
+}
+
+// columnarCodec adapts the columnar block codec to the interface values used for ingester caches
+type columnarCodec struct{}
+
+type columnarEncoder struct {
+	enc chancacher.Encoder[[]*entry.Entry]
+}
+
+type columnarDecoder struct {
+	dec chancacher.Decoder[[]*entry.Entry]
+}
+
+func (columnarCodec) NewEncoder(w io.Writer) chancacher.Encoder[interface{}] {
+	return columnarEncoder{enc: chancacher.ColumnarCodec{}.NewEncoder(w)}
+}
+
+func (columnarCodec) NewDecoder(r io.Reader) chancacher.Decoder[interface{}] {
+	return columnarDecoder{dec: chancacher.ColumnarCodec{}.NewDecoder(r)}
+}
+
+func (e columnarEncoder) Encode(v interface{}) error {
+	ents := entries(v)
+	if ents == nil {
+		return fmt.Errorf("cannot encode %T with the columnar codec", v)
+	}
+	return e.enc.Encode(ents)
+}
+
+func (d columnarDecoder) Decode() (interface{}, error) {
+	return d.dec.Decode()
+}
+
+func getCodec(name string) (chancacher.Codec[interface{}], error) {
+	switch name {
+	case `gob`:
+		return chancacher.GobCodec[interface{}]{}, nil
+	case `entry`:
+		return entryCodec{}, nil
+	case `columnar`:
+		return columnarCodec{}, nil
+	}
+	return nil, fmt.Errorf("unknown codec %q", name)
+}
+
+// cacheDirs expands an ingester cache path into its entry and block caches
+func cacheDirs(p string) []string {
+	e, b := filepath.Join(p, "e"), filepath.Join(p, "b")
+	if fi, err := os.Stat(e); err == nil && fi.IsDir() {
+		if fi, err = os.Stat(b); err == nil && fi.IsDir() {
+			return []string{e, b}
+		}
+	}
+	return []string{p}
+}
+
+// entries returns the entries held in a cached value
+func entries(v interface{}) []*entry.Entry {
+	switch x := v.(type) {
+	case *entry.Entry:
+		return []*entry.Entry{x}
+	case []*entry.Entry:
+		return x
+	}
+	return nil
+}
+
+// readTagNames loads the tag names an ingester saved alongside its cache
+func readTagNames(p string) (names map[entry.EntryTag]string) {
+	names = map[entry.EntryTag]string{}
+	f, err := os.Open(filepath.Join(p, "tagcache"))
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	var tags map[string]entry.EntryTag
+	if err = gob.NewDecoder(f).Decode(&tags); err == nil {
+		for k, v := range tags {
+			names[v] = k
+		}
+	}
+	return
+}
+
+func inspect(root string, dirs []string, codec chancacher.Codec[interface{}]) (err error) {
+	var total int
+	tags := map[entry.EntryTag]int{}
+	for _, d := range dirs {
+		var items, ents int
+		var oldest, newest *entry.Entry
+		ci, err := chancacher.Inspect(d, codec, nil)
+		if err != nil {
+			return fmt.Errorf("failed to inspect %q %w", d, err)
+		}
+		if err = chancacher.Walk(d, codec, func(v interface{}) error {
+			items++
+			for _, ent := range entries(v) {
+				ents++
+				tags[ent.Tag]++
+				if oldest == nil || ent.TS.Before(oldest.TS) {
+					oldest = ent
+				}
+				if newest == nil || newest.TS.Before(ent.TS) {
+					newest = ent
+				}
+			}
+			return nil
+		}); err != nil {
+			return fmt.Errorf("failed to read %q %w", d, err)
+		}
+		total += ents
+		fmt.Printf("%s: %d items, %d entries, %d bytes\n", d, items, ents, ci.Bytes)
+		if oldest != nil {
+			fmt.Printf("\toldest %s\n\tnewest %s\n", oldest.TS.Format(time.RFC3339Nano), newest.TS.Format(time.RFC3339Nano))
+		}
+	}
+	names := readTagNames(root)
+	ids := make([]entry.EntryTag, 0, len(tags))
+	for k := range tags {
+		ids = append(ids, k)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	for _, id := range ids {
+		name, ok := names[id]
+		if !ok {
+			name = `unknown`
+		}
+		fmt.Printf("tag %d (%s): %d entries\n", id, name, tags[id])
+	}
+	if *rate > 0 {
+		est := time.Duration(float64(total) / *rate * float64(time.Second))
+		fmt.Printf("estimated replay time at %.0f entries/s: %v\n", *rate, est.Round(time.Second))
+	}
+	return
+}
+
+func export(dirs []string, codec chancacher.Codec[interface{}]) (err error) {
+	out := os.Stdout
+	if *output != `` {
+		if out, err = os.Create(*output); err != nil {
+			return
+		}
+		defer out.Close()
+	}
+	ew := newExportWriter(out, *format)
+	for _, d := range dirs {
+		if err = chancacher.Walk(d, codec, func(v interface{}) error {
+			for _, ent := range entries(v) {
+				if err := ew.write(ent); err != nil {
+					return err
+				}
+			}
+			return nil
+		}); err != nil {
+			return fmt.Errorf("failed to export %q %w", d, err)
+		}
+	}
+	return ew.flush()
+}
+
+// columnarExportBlock is the number of entries written in each exported columnar block
+const columnarExportBlock = 4096
+
+// exportWriter writes entries as canonical JSON lines or batches them into columnar blocks
+type exportWriter struct {
+	w   *bufio.Writer
+	cw  *entry.ColumnarWriter
+	blk []*entry.Entry
+}
+
+func newExportWriter(w io.Writer, format string) *exportWriter {
+	if format == `columnar` {
+		return &exportWriter{cw: entry.NewColumnarWriter(w)}
+	}
+	return &exportWriter{w: bufio.NewWriter(w)}
+}
+
+func (ew *exportWriter) write(ent *entry.Entry) error {
+	if ew.cw == nil {
+		b, err := ent.MarshalCanonicalJSON()
+		if err == nil {
+			_, err = ew.w.Write(append(b, '\n'))
+		}
+		return err
+	}
+	if ew.blk = append(ew.blk, ent); len(ew.blk) < columnarExportBlock {
+		return nil
+	}
+	err := ew.cw.Write(ew.blk)
+	ew.blk = ew.blk[:0]
+	return err
+}
+
+func (ew *exportWriter) flush() error {
+	if ew.cw == nil {
+		return ew.w.Flush()
+	}
+	if len(ew.blk) > 0 {
+		if err := ew.cw.Write(ew.blk); err != nil {
+			return err
+		}
+		ew.blk = nil
+	}
+	return ew.cw.Flush()
+}
+
+// readExport loads the entries from an export file
+func readExport(r io.Reader, format string) (add []interface{}, err error) {
+	if format == `columnar` {
+		cr := entry.NewColumnarReader(r)
+		for {
+			var ents []*entry.Entry
+			if ents, err = cr.Read(); err == io.EOF {
+				return add, nil
+			} else if err != nil {
+				return nil, err
+			}
+			for _, ent := range ents {
+				add = append(add, ent)
+			}
+		}
+	}
+	sc := bufio.NewScanner(r)
+	sc.Buffer(nil, int(entry.MaxDataSize)*2)
+	for ln := 1; sc.Scan(); ln++ {
+		if len(sc.Bytes()) == 0 {
+			continue
+		}
+		ent := new(entry.Entry)
+		if err = ent.UnmarshalCanonicalJSON(sc.Bytes()); err != nil {
+			return nil, fmt.Errorf("invalid entry on line %d %w", ln, err)
+		}
+		add = append(add, ent)
+	}
+	err = sc.Err()
+	return
+}
+
+func truncate(dirs []string, codec chancacher.Codec[interface{}]) (err error) {
+	if *before == `` {
+		for _, d := range dirs {
+			if err = chancacher.Truncate(d); err != nil {
+				return fmt.Errorf("failed to truncate %q %w", d, err)
+			}
+		}
+		return
+	}
+	cutoff, err := time.Parse(time.RFC3339Nano, *before)
+	if err != nil {
+		return fmt.Errorf("invalid -before time %q %w", *before, err)
+	}
+	ts := entry.FromStandard(cutoff)
+	var dropped int
+	for _, d := range dirs {
+		if _, _, err = chancacher.Rewrite(d, codec, func(v interface{}) (interface{}, bool) {
+			switch x := v.(type) {
+			case *entry.Entry:
+				if x.TS.Before(ts) {
+					dropped++
+					return nil, false
+				}
+			case []*entry.Entry:
+				keep := x[:0]
+				for _, ent := range x {
+					if ent.TS.Before(ts) {
+						dropped++
+					} else {
+						keep = append(keep, ent)
+					}
+				}
+				return keep, len(keep) > 0
+			}
+			return v, true
+		}, nil); err != nil {
+			return fmt.Errorf("failed to truncate %q %w", d, err)
+		}
+	}
+	fmt.Printf("dropped %d entries\n", dropped)
+	return
+}
+
+func inject(dir, p string, codec chancacher.Codec[interface{}]) (err error) {
+	var fin *os.File
+	var add []interface{}
+	if fin, err = os.Open(p); err != nil {
+		return
+	}
+	defer fin.Close()
+	if add, err = readExport(fin, *format); err != nil {
+		return
+	}
+	if _, _, err = chancacher.Rewrite(dir, codec, nil, add); err == nil {
+		fmt.Printf("injected %d entries\n", len(add))
+	}
+	return
+}
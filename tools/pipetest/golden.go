@@ -0,0 +1,52 @@
+/*************************************************************************
+ * Copyright 2024 Gravwell, Inc. All rights reserved.
+ * Contact: <legal@gravwell.io>
+ *
+ * This software may be modified and distributed under the terms of the
+ * BSD 2-clause license. See the LICENSE file for details.
+ **************************************************************************/
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+var (
+	errGoldenMismatch = errors.New("report does not match golden file")
+)
+
+// checkGolden compares the report against the golden file and writes the first
+// differing lines to w when they do not match
+func checkGolden(pth string, report []byte, w io.Writer) (err error) {
+	var golden []byte
+	if golden, err = os.ReadFile(pth); err != nil {
+		return
+	} else if bytes.Equal(golden, report) {
+		return
+	}
+	gl := bytes.Split(golden, []byte("\n"))
+	rl := bytes.Split(report, []byte("\n"))
+	var shown int
+	for i := 0; (i < len(gl) || i < len(rl)) && shown < maxGoldenDiffLines; i++ {
+		var g, r []byte
+		if i < len(gl) {
+			g = gl[i]
+		}
+		if i < len(rl) {
+			r = rl[i]
+		}
+		if bytes.Equal(g, r) {
+			continue
+		}
+		fmt.Fprintf(w, "line %d:\n  golden: %s\n  actual: %s\n", i+1, g, r)
+		shown++
+	}
+	return errGoldenMismatch
+}
+
+const maxGoldenDiffLines = 16
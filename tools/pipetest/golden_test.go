@@ -0,0 +1,70 @@
+/*************************************************************************
+ * Copyright 2024 Gravwell, Inc. All rights reserved.
+ * Contact: <legal@gravwell.io>
+ *
+ * This software may be modified and distributed under the terms of the
+ * BSD 2-clause license. See the LICENSE file for details.
+ **************************************************************************/
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCheckGolden(t *testing.T) {
+	pth := filepath.Join(t.TempDir(), `golden`)
+	golden := []byte("line one\nline two\nline three\n")
+	if err := os.WriteFile(pth, golden, 0640); err != nil {
+		t.Fatal(err)
+	}
+
+	//exact match writes nothing
+	var out bytes.Buffer
+	if err := checkGolden(pth, golden, &out); err != nil {
+		t.Fatal(err)
+	} else if out.Len() != 0 {
+		t.Fatalf("matching report produced output: %q", out.String())
+	}
+
+	//a changed line and an extra line are both reported with line numbers
+	out.Reset()
+	err := checkGolden(pth, []byte("line one\nline 2\nline three\nline four\n"), &out)
+	if !errors.Is(err, errGoldenMismatch) {
+		t.Fatalf("expected mismatch, got %v", err)
+	}
+	exp := "line 2:\n  golden: line two\n  actual: line 2\nline 4:\n  golden: \n  actual: line four\n"
+	if out.String() != exp {
+		t.Fatalf("bad mismatch output:\n%s\nexpected:\n%s", out.String(), exp)
+	}
+
+	//a missing golden file is an error, not a mismatch
+	if err = checkGolden(pth+`.missing`, golden, &out); err == nil || errors.Is(err, errGoldenMismatch) {
+		t.Fatalf("missing golden file returned %v", err)
+	}
+}
+
+func TestCheckGoldenLimit(t *testing.T) {
+	pth := filepath.Join(t.TempDir(), `golden`)
+	var golden, report []string
+	for i := 0; i < maxGoldenDiffLines*2; i++ {
+		golden = append(golden, fmt.Sprintf("golden %d", i))
+		report = append(report, fmt.Sprintf("report %d", i))
+	}
+	if err := os.WriteFile(pth, []byte(strings.Join(golden, "\n")), 0640); err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	if err := checkGolden(pth, []byte(strings.Join(report, "\n")), &out); !errors.Is(err, errGoldenMismatch) {
+		t.Fatalf("expected mismatch, got %v", err)
+	}
+	if n := strings.Count(out.String(), "  golden: "); n != maxGoldenDiffLines {
+		t.Fatalf("reported %d differing lines, expected %d", n, maxGoldenDiffLines)
+	}
+}
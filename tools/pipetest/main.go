@@ -0,0 +1,298 @@
+/*************************************************************************
+ * Copyright 2024 Gravwell, Inc. All rights reserved.
+ * Contact: <legal@gravwell.io>
+ *
+ * This software may be modified and distributed under the terms of the
+ * BSD 2-clause license. See the LICENSE file for details.
+ **************************************************************************/
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gravwell/gcfg"
+	"github.com/gravwell/gravwell/v3/ingest"
+	"github.com/gravwell/gravwell/v3/ingest/config"
+	"github.com/gravwell/gravwell/v3/ingest/entry"
+	"github.com/gravwell/gravwell/v3/ingest/processors"
+	"github.com/gravwell/gravwell/v3/ingesters/utils"
+	"github.com/gravwell/gravwell/v3/timegrinder"
+)
+
+const (
+	lineFormat string = `line`
+
+	initBuffSize = 4 * 1024 * 1024
+	maxBuffSize  = 128 * 1024 * 1024
+)
+
+var (
+	configPath   = flag.String("config-path", "", "Path to an ingester configuration containing Preprocessor sections")
+	overlayPath  = flag.String("config-overlays", "", "Optional path to a directory of configuration overlays")
+	chain        = flag.String("preprocessors", "", "Comma separated list of preprocessors to chain, in order")
+	dataPath     = flag.String("data-path", "", "Path to sample data")
+	fmtF         = flag.String("import-format", "", "Set the data format manually (json, csv, or line)")
+	defTag       = flag.String("tag", "default", "Tag applied to line delimited sample data")
+	defSrc       = flag.String("source", "", "Source applied to line delimited sample data")
+	batchSize    = flag.Int("batch-size", 1, "Number of entries handed to the pipeline at a time")
+	goldenPath   = flag.String("golden", "", "Compare the report against a golden file")
+	updateGolden = flag.Bool("update-golden", false, "Write the report to the golden file instead of comparing")
+	quiet        = flag.Bool("quiet", false, "Do not print the per-stage report")
+)
+
+func main() {
+	flag.Parse()
+	var err error
+	var pc processors.ProcessorConfig
+	var names []string
+	var rdr utils.ReimportReader
+	th := &testTagHandler{}
+
+	if *configPath == `` {
+		fmt.Println("missing config-path")
+		os.Exit(1)
+	} else if *dataPath == `` {
+		fmt.Println("missing data-path")
+		os.Exit(1)
+	} else if *batchSize <= 0 {
+		fmt.Println("batch-size must be greater than zero")
+		os.Exit(1)
+	}
+
+	if pc, err = loadPreprocessors(*configPath, *overlayPath); err != nil {
+		fmt.Printf("Failed to load preprocessors from %q: %v\n", *configPath, err)
+		os.Exit(1)
+	} else if names, err = chainNames(pc, *chain); err != nil {
+		fmt.Printf("Invalid preprocessor chain: %v\n", err)
+		os.Exit(1)
+	}
+
+	p, err := newPipeline(pc, names, th)
+	if err != nil {
+		fmt.Printf("Failed to build preprocessor chain: %v\n", err)
+		os.Exit(1)
+	}
+
+	fin, err := os.Open(*dataPath)
+	if err != nil {
+		fmt.Printf("Failed to open data file %s: %v\n", *dataPath, err)
+		os.Exit(1)
+	}
+	defer fin.Close()
+	if rdr, err = getReader(*fmtF, *dataPath, fin, th); err != nil {
+		fmt.Printf("%v, please set -import-format\n", err)
+		os.Exit(1)
+	}
+
+	report := bytes.NewBuffer(nil)
+	start := time.Now()
+	var input int
+	for {
+		ents, err := readBatch(rdr, *batchSize)
+		if len(ents) > 0 {
+			input += len(ents)
+			if lerr := p.process(ents, report); lerr != nil {
+				fmt.Printf("preprocessor chain returned error: %v\n", lerr)
+				os.Exit(1)
+			}
+		}
+		if err != nil {
+			if err != io.EOF {
+				fmt.Printf("data file contains invalid data: %v\n", err)
+				os.Exit(1)
+			}
+			break
+		}
+	}
+	if err = p.close(report); err != nil {
+		fmt.Printf("Failed to close preprocessor chain: %v\n", err)
+		os.Exit(1)
+	}
+	p.summary(report)
+	dur := time.Since(start)
+
+	if !*quiet {
+		os.Stdout.Write(report.Bytes())
+	}
+	fmt.Printf("INPUT: %d\n", input)
+	fmt.Printf("OUTPUT: %d\n", p.output())
+	fmt.Println("PROCESSING TIME:", dur)
+	fmt.Println("PROCESSING RATE:", ingest.HumanEntryRate(uint64(input), dur))
+
+	if *goldenPath != `` {
+		if *updateGolden {
+			if err = os.WriteFile(*goldenPath, report.Bytes(), 0640); err != nil {
+				fmt.Printf("Failed to write golden file %q: %v\n", *goldenPath, err)
+				os.Exit(1)
+			}
+			fmt.Printf("updated golden file %q\n", *goldenPath)
+		} else if err = checkGolden(*goldenPath, report.Bytes(), os.Stdout); err != nil {
+			fmt.Printf("golden file check failed: %v\n", err)
+			os.Exit(1)
+		}
+	}
+}
+
+// loadPreprocessors pulls only the Preprocessor sections out of an ingester config
+// and its overlays, every other section is ignored
+func loadPreprocessors(pth, overlays string) (pc processors.ProcessorConfig, err error) {
+	var cfg testConfig
+	if err = gcfg.FatalOnly(config.LoadConfigFile(&cfg, pth)); err != nil {
+		return
+	} else if err = loadOverlays(&cfg, overlays); err != nil {
+		return
+	}
+	pc = cfg.Preprocessor
+	if len(pc) == 0 {
+		err = fmt.Errorf("no preprocessors defined")
+	} else if err = pc.Validate(); err != nil {
+		pc = nil
+	}
+	return
+}
+
+func loadOverlays(cfg *testConfig, pth string) (err error) {
+	if pth == `` {
+		return
+	}
+	var dents []os.DirEntry
+	if dents, err = os.ReadDir(pth); err != nil {
+		return
+	}
+	for _, dent := range dents {
+		if !dent.Type().IsRegular() || !strings.HasSuffix(dent.Name(), `.conf`) {
+			continue
+		}
+		p := filepath.Join(pth, dent.Name())
+		if err = gcfg.FatalOnly(config.LoadConfigFile(cfg, p)); err != nil {
+			err = fmt.Errorf("failed to load %q %w", p, err)
+			return
+		}
+	}
+	return
+}
+
+// chainNames resolves the list of preprocessors to chain, if the config only defines
+// a single preprocessor the chain may be omitted
+func chainNames(pc processors.ProcessorConfig, v string) (names []string, err error) {
+	for _, n := range strings.Split(v, ",") {
+		if n = strings.TrimSpace(n); n != `` {
+			names = append(names, n)
+		}
+	}
+	if len(names) == 0 {
+		if len(pc) != 1 {
+			err = fmt.Errorf("config defines %d preprocessors, specify the chain with -preprocessors", len(pc))
+			return
+		}
+		for k := range pc {
+			names = append(names, k)
+		}
+	}
+	err = pc.CheckProcessors(names)
+	return
+}
+
+func getReader(override, pth string, fin io.ReadCloser, th *testTagHandler) (rdr utils.ReimportReader, err error) {
+	var format string
+	if strings.ToLower(strings.TrimSpace(override)) == lineFormat {
+		format = lineFormat
+	} else if format, err = utils.GetImportFormat(override, pth); err != nil {
+		if override != `` {
+			return
+		}
+		//no override and an unknown extension, treat it as line delimited
+		format, err = lineFormat, nil
+	}
+	if format == lineFormat {
+		rdr, err = newLineReader(fin, th, *defTag, *defSrc)
+	} else {
+		rdr, err = utils.GetImportReader(format, fin, th)
+	}
+	return
+}
+
+func readBatch(rdr utils.ReimportReader, cnt int) (ents []*entry.Entry, err error) {
+	for i := 0; i < cnt; i++ {
+		var ent *entry.Entry
+		if ent, err = rdr.ReadEntry(); err != nil {
+			return
+		}
+		ents = append(ents, ent)
+	}
+	return
+}
+
+type testConfig struct {
+	Preprocessor processors.ProcessorConfig
+}
+
+// lineReader hands out one entry per line, timestamps are extracted using the default
+// timegrinder and fall back to the unix epoch so that reports are repeatable
+type lineReader struct {
+	th  *testTagHandler
+	scn *bufio.Scanner
+	tg  *timegrinder.TimeGrinder
+	tag entry.EntryTag
+	src []byte
+}
+
+func newLineReader(rdr io.Reader, th *testTagHandler, tag, src string) (lr *lineReader, err error) {
+	lr = &lineReader{
+		th:  th,
+		scn: bufio.NewScanner(rdr),
+	}
+	lr.scn.Buffer(make([]byte, initBuffSize), maxBuffSize)
+	if lr.tag, err = th.NegotiateTag(tag); err != nil {
+		return
+	}
+	if src != `` {
+		var ip []byte
+		if ip, err = config.ParseSource(src); err != nil {
+			return
+		}
+		lr.src = ip
+	}
+	lr.tg, err = timegrinder.New(timegrinder.Config{})
+	return
+}
+
+func (lr *lineReader) ReadEntry() (ent *entry.Entry, err error) {
+	var ln []byte
+	for len(ln) == 0 {
+		if !lr.scn.Scan() {
+			if err = lr.scn.Err(); err == nil {
+				err = io.EOF
+			}
+			return
+		}
+		ln = bytes.TrimRight(lr.scn.Bytes(), "\r")
+	}
+	ln = bytes.Clone(ln) // copy due to the scanner
+	ts := time.Unix(0, 0).UTC()
+	if t, ok, lerr := lr.tg.Extract(ln); lerr == nil && ok {
+		ts = t
+	}
+	ent = &entry.Entry{
+		TS:   entry.FromStandard(ts),
+		Tag:  lr.tag,
+		SRC:  lr.src,
+		Data: ln,
+	}
+	return
+}
+
+func (lr *lineReader) OverrideTags(tg entry.EntryTag) {
+	lr.tag = tg
+}
+
+func (lr *lineReader) DisableEVs() {} //does nothing, lines don't carry EVs
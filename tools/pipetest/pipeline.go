@@ -0,0 +1,261 @@
+/*************************************************************************
+ * Copyright 2024 Gravwell, Inc. All rights reserved.
+ * Contact: <legal@gravwell.io>
+ *
+ * This software may be modified and distributed under the terms of the
+ * BSD 2-clause license. See the LICENSE file for details.
+ **************************************************************************/
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/gravwell/gravwell/v3/ingest/entry"
+	"github.com/gravwell/gravwell/v3/ingest/processors"
+)
+
+// pipeline wraps each named preprocessor in its own single element ProcessorSet so that
+// we can capture the output of every stage and diff it against the stage input.
+type pipeline struct {
+	th     *testTagHandler
+	stages []*stage
+	batch  int
+}
+
+type stage struct {
+	name  string
+	ptype string
+	ps    *processors.ProcessorSet
+	col   *collector
+	in    int
+	out   int
+}
+
+func newPipeline(pc processors.ProcessorConfig, names []string, th *testTagHandler) (p *pipeline, err error) {
+	p = &pipeline{
+		th: th,
+	}
+	for _, n := range names {
+		s := &stage{
+			name: n,
+			col:  &collector{testTagHandler: th},
+		}
+		if s.ptype, err = pc[n].GetString(`type`); err != nil {
+			err = fmt.Errorf("%s %v", n, err)
+			return
+		} else if s.ps, err = pc.ProcessorSet(s.col, []string{n}); err != nil {
+			return
+		}
+		s.ptype = strings.ToLower(strings.TrimSpace(s.ptype))
+		p.stages = append(p.stages, s)
+	}
+	return
+}
+
+// process pushes a batch of entries through every stage, writing the per-stage diff to w
+func (p *pipeline) process(ents []*entry.Entry, w io.Writer) error {
+	p.batch++
+	fmt.Fprintf(w, "### batch %d\n", p.batch)
+	return p.run(0, ents, w)
+}
+
+// close closes each stage in order, flushed entries are pushed through the remaining stages
+func (p *pipeline) close(w io.Writer) (err error) {
+	fmt.Fprintf(w, "### flush\n")
+	for i, s := range p.stages {
+		s.col.reset()
+		if err = s.ps.Close(); err != nil {
+			err = fmt.Errorf("%s %w", s.name, err)
+			return
+		}
+		out := s.col.reset()
+		if len(out) == 0 {
+			continue
+		}
+		s.out += len(out)
+		fmt.Fprintf(w, "== stage %d %s (%s) flushed %d\n", i+1, s.name, s.ptype, len(out))
+		for _, ent := range out {
+			fmt.Fprintf(w, "  + %s\n", p.render(ent).String())
+		}
+		if err = p.run(i+1, out, w); err != nil {
+			return
+		}
+	}
+	return
+}
+
+func (p *pipeline) run(start int, ents []*entry.Entry, w io.Writer) (err error) {
+	for i := start; i < len(p.stages) && len(ents) > 0; i++ {
+		s := p.stages[i]
+		//render before processing, processors are free to modify entries in place
+		before := p.renderSet(ents)
+		s.col.reset()
+		if err = s.ps.ProcessBatch(ents); err != nil {
+			err = fmt.Errorf("%s %w", s.name, err)
+			return
+		}
+		ents = s.col.reset()
+		s.in += len(before)
+		s.out += len(ents)
+		writeStageDiff(w, i+1, s, before, p.renderSet(ents))
+	}
+	return
+}
+
+// output is the number of entries that made it out of the last stage
+func (p *pipeline) output() (r int) {
+	if len(p.stages) > 0 {
+		r = p.stages[len(p.stages)-1].out
+	}
+	return
+}
+
+func (p *pipeline) summary(w io.Writer) {
+	fmt.Fprintf(w, "### summary\n")
+	for i, s := range p.stages {
+		fmt.Fprintf(w, "stage %d %s (%s) in=%d out=%d\n", i+1, s.name, s.ptype, s.in, s.out)
+	}
+}
+
+func (p *pipeline) renderSet(ents []*entry.Entry) (r []renderedEntry) {
+	r = make([]renderedEntry, 0, len(ents))
+	for _, ent := range ents {
+		r = append(r, p.render(ent))
+	}
+	return
+}
+
+type renderedEntry struct {
+	tag  string
+	ts   string
+	src  string
+	data string
+	evs  []string
+}
+
+func (p *pipeline) render(ent *entry.Entry) (re renderedEntry) {
+	var ok bool
+	if re.tag, ok = p.th.LookupTag(ent.Tag); !ok {
+		re.tag = fmt.Sprintf("<unknown %d>", ent.Tag)
+	}
+	re.ts = ent.TS.StandardTime().UTC().Format(time.RFC3339Nano)
+	if len(ent.SRC) > 0 {
+		re.src = ent.SRC.String()
+	}
+	re.data = fmt.Sprintf("%q", ent.Data)
+	for _, ev := range ent.EnumeratedValues() {
+		re.evs = append(re.evs, fmt.Sprintf("%s(%s)=%q", ev.Name, ev.Value.TypeName(), ev.Value.String()))
+	}
+	return
+}
+
+func (re renderedEntry) String() string {
+	s := fmt.Sprintf("tag=%s ts=%s src=%s data=%s", re.tag, re.ts, re.src, re.data)
+	if len(re.evs) > 0 {
+		s += " evs=[" + strings.Join(re.evs, " ") + "]"
+	}
+	return s
+}
+
+// writeStageDiff prints the changes a stage made, if the stage emitted the same number of
+// entries as it consumed entries are compared positionally field by field, otherwise
+// entries are matched up wholesale and we print what was dropped and what was produced.
+func writeStageDiff(w io.Writer, idx int, s *stage, before, after []renderedEntry) {
+	fmt.Fprintf(w, "== stage %d %s (%s) in=%d out=%d\n", idx, s.name, s.ptype, len(before), len(after))
+	if len(before) == len(after) {
+		for i := range before {
+			writeEntryDiff(w, i, before[i], after[i])
+		}
+		return
+	}
+	remaining := map[string]int{}
+	for _, v := range after {
+		remaining[v.String()]++
+	}
+	for _, v := range before {
+		k := v.String()
+		if remaining[k] > 0 {
+			remaining[k]--
+		} else {
+			fmt.Fprintf(w, "  - %s\n", k)
+		}
+	}
+	for _, v := range after {
+		k := v.String()
+		if remaining[k] > 0 {
+			remaining[k]--
+			fmt.Fprintf(w, "  + %s\n", k)
+		}
+	}
+}
+
+func writeEntryDiff(w io.Writer, idx int, a, b renderedEntry) {
+	var lines []string
+	fieldDiff := func(name, av, bv string) {
+		if av != bv {
+			lines = append(lines, fmt.Sprintf("    %s: - %s", name, av), fmt.Sprintf("    %s: + %s", name, bv))
+		}
+	}
+	fieldDiff(`tag`, a.tag, b.tag)
+	fieldDiff(`ts`, a.ts, b.ts)
+	fieldDiff(`src`, a.src, b.src)
+	fieldDiff(`data`, a.data, b.data)
+	existing := map[string]bool{}
+	for _, v := range a.evs {
+		existing[v] = true
+	}
+	for _, v := range b.evs {
+		if existing[v] {
+			delete(existing, v)
+		} else {
+			lines = append(lines, fmt.Sprintf("    ev: + %s", v))
+		}
+	}
+	for _, v := range a.evs {
+		if existing[v] {
+			lines = append(lines, fmt.Sprintf("    ev: - %s", v))
+		}
+	}
+	if len(lines) == 0 {
+		return
+	}
+	fmt.Fprintf(w, "  entry %d\n", idx)
+	for _, l := range lines {
+		fmt.Fprintln(w, l)
+	}
+}
+
+// collector is the entry writer at the tail of each stage, it just holds onto entries
+type collector struct {
+	*testTagHandler
+	ents []*entry.Entry
+}
+
+func (c *collector) reset() (r []*entry.Entry) {
+	r = c.ents
+	c.ents = nil
+	return
+}
+
+func (c *collector) WriteEntry(ent *entry.Entry) error {
+	c.ents = append(c.ents, ent)
+	return nil
+}
+
+func (c *collector) WriteEntryContext(ctx context.Context, ent *entry.Entry) error {
+	return c.WriteEntry(ent)
+}
+
+func (c *collector) WriteBatch(ents []*entry.Entry) error {
+	c.ents = append(c.ents, ents...)
+	return nil
+}
+
+func (c *collector) WriteBatchContext(ctx context.Context, ents []*entry.Entry) error {
+	return c.WriteBatch(ents)
+}
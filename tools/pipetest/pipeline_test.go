@@ -0,0 +1,152 @@
+/*************************************************************************
+ * Copyright 2024 Gravwell, Inc. All rights reserved.
+ * Contact: <legal@gravwell.io>
+ *
+ * This software may be modified and distributed under the terms of the
+ * BSD 2-clause license. See the LICENSE file for details.
+ **************************************************************************/
+
+package main
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testPipelineConfig = `
+[Preprocessor "rx"]
+	Type = regexextract
+	Regex = "(?P<user>\\w+) logged in"
+	Template = "user=${user}"
+	Drop-Misses = true
+
+[Preprocessor "dropper"]
+	Type = drop
+`
+
+func TestWriteStageDiffPositional(t *testing.T) {
+	s := &stage{name: `test`, ptype: `regexextract`}
+	before := []renderedEntry{
+		{tag: `default`, ts: `ts`, data: `"a"`, evs: []string{`keep(string)="x"`, `gone(string)="y"`}},
+		{tag: `default`, ts: `ts`, data: `"b"`},
+	}
+	after := []renderedEntry{
+		{tag: `other`, ts: `ts`, data: `"a2"`, evs: []string{`keep(string)="x"`, `new(int64)="1"`}},
+		{tag: `default`, ts: `ts`, data: `"b"`},
+	}
+	var out bytes.Buffer
+	writeStageDiff(&out, 1, s, before, after)
+	exp := `== stage 1 test (regexextract) in=2 out=2
+  entry 0
+    tag: - default
+    tag: + other
+    data: - "a"
+    data: + "a2"
+    ev: + new(int64)="1"
+    ev: - gone(string)="y"
+`
+	if out.String() != exp {
+		t.Fatalf("bad diff:\n%s\nexpected:\n%s", out.String(), exp)
+	}
+}
+
+func TestWriteStageDiffWholesale(t *testing.T) {
+	s := &stage{name: `test`, ptype: `jsonarraysplit`}
+	before := []renderedEntry{
+		{tag: `default`, ts: `ts`, data: `"[1,2]"`},
+		{tag: `default`, ts: `ts`, data: `"same"`},
+	}
+	after := []renderedEntry{
+		{tag: `default`, ts: `ts`, data: `"same"`},
+		{tag: `default`, ts: `ts`, data: `"1"`},
+		{tag: `default`, ts: `ts`, data: `"2"`},
+	}
+	var out bytes.Buffer
+	writeStageDiff(&out, 2, s, before, after)
+	exp := `== stage 2 test (jsonarraysplit) in=2 out=3
+  - tag=default ts=ts src= data="[1,2]"
+  + tag=default ts=ts src= data="1"
+  + tag=default ts=ts src= data="2"
+`
+	if out.String() != exp {
+		t.Fatalf("bad diff:\n%s\nexpected:\n%s", out.String(), exp)
+	}
+}
+
+func TestPipeline(t *testing.T) {
+	pth := filepath.Join(t.TempDir(), `test.conf`)
+	if err := os.WriteFile(pth, []byte(testPipelineConfig), 0640); err != nil {
+		t.Fatal(err)
+	}
+	pc, err := loadPreprocessors(pth, ``)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = chainNames(pc, ``); err == nil {
+		t.Fatal("chain must be specified when there are multiple preprocessors")
+	}
+	names, err := chainNames(pc, `rx, dropper`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	th := &testTagHandler{}
+	p, err := newPipeline(pc, names, th)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rdr, err := newLineReader(strings.NewReader("alice logged in\nnoise\n"), th, `default`, ``)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ents, err := readBatch(rdr, 8)
+	if err != io.EOF || len(ents) != 2 {
+		t.Fatalf("bad batch read %d %v", len(ents), err)
+	}
+	var report bytes.Buffer
+	if err = p.process(ents, &report); err != nil {
+		t.Fatal(err)
+	} else if err = p.close(&report); err != nil {
+		t.Fatal(err)
+	}
+	p.summary(&report)
+	if p.output() != 0 {
+		t.Fatalf("drop stage emitted %d entries", p.output())
+	}
+	for _, v := range []string{
+		`== stage 1 rx (regexextract) in=2 out=1`,
+		`  - tag=default ts=1970-01-01T00:00:00Z src= data="alice logged in"`,
+		`  - tag=default ts=1970-01-01T00:00:00Z src= data="noise"`,
+		`  + tag=default ts=1970-01-01T00:00:00Z src= data="user=alice"`,
+		`== stage 2 dropper (drop) in=1 out=0`,
+		`stage 1 rx (regexextract) in=2 out=1`,
+		`stage 2 dropper (drop) in=1 out=0`,
+	} {
+		if !strings.Contains(report.String(), v+"\n") {
+			t.Errorf("report is missing %q:\n%s", v, report.String())
+		}
+	}
+}
+
+func TestTagOverride(t *testing.T) {
+	th := &testTagHandler{}
+	def, err := th.NegotiateTag(`default`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	forced, err := th.NegotiateTag(`forced`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	th.OverrideTags(forced)
+	if tg, err := th.GetTag(`default`); err != nil || tg != forced {
+		t.Fatalf("override not honored: %v %v", tg, err)
+	}
+	//preprocessors negotiating tags are not subject to the override
+	if tg, err := th.NegotiateTag(`default`); err != nil || tg != def {
+		t.Fatalf("override applied to negotiated tag: %v %v", tg, err)
+	}
+}
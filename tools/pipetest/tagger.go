@@ -0,0 +1,70 @@
+/*************************************************************************
+ * Copyright 2024 Gravwell, Inc. All rights reserved.
+ * Contact: <legal@gravwell.io>
+ *
+ * This software may be modified and distributed under the terms of the
+ * BSD 2-clause license. See the LICENSE file for details.
+ **************************************************************************/
+
+package main
+
+import (
+	"github.com/gravwell/gravwell/v3/ingest"
+	"github.com/gravwell/gravwell/v3/ingest/entry"
+)
+
+// testTagHandler is an in memory tagger, tags are handed out in the order they are negotiated.
+// Like the ingest tag handler, an override applies to tags requested by the sample data readers,
+// preprocessors negotiating tags still get their own.
+type testTagHandler struct {
+	overrideTag bool
+	override    entry.EntryTag
+	mp          map[string]entry.EntryTag
+}
+
+func (tth *testTagHandler) OverrideTags(v entry.EntryTag) {
+	tth.overrideTag = true
+	tth.override = v
+}
+
+func (tth *testTagHandler) NegotiateTag(v string) (r entry.EntryTag, err error) {
+	if err = ingest.CheckTag(v); err != nil {
+		return
+	}
+	var ok bool
+	if r, ok = tth.mp[v]; !ok {
+		r = entry.EntryTag(len(tth.mp))
+		if tth.mp == nil {
+			tth.mp = map[string]entry.EntryTag{}
+		}
+		tth.mp[v] = r
+	}
+	return
+}
+
+func (tth *testTagHandler) GetTag(v string) (r entry.EntryTag, err error) {
+	if tth.overrideTag {
+		return tth.override, nil
+	}
+	return tth.NegotiateTag(v)
+}
+
+func (tth *testTagHandler) LookupTag(tag entry.EntryTag) (r string, ok bool) {
+	for k, v := range tth.mp {
+		if v == tag {
+			r, ok = k, true
+			break
+		}
+	}
+	return
+}
+
+func (tth *testTagHandler) KnownTags() (r []string) {
+	if len(tth.mp) > 0 {
+		r = make([]string, 0, len(tth.mp))
+		for k := range tth.mp {
+			r = append(r, k)
+		}
+	}
+	return
+}
@@ -0,0 +1,393 @@
+/*************************************************************************
+ * Copyright 2024 Gravwell, Inc. All rights reserved.
+ * Contact: <legal@gravwell.io>
+ *
+ * This software may be modified and distributed under the terms of the
+ * BSD 2-clause license. See the LICENSE file for details.
+ **************************************************************************/
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gravwell/gravwell/v3/timegrinder"
+)
+
+const (
+	discoveredFormatName = `discovered`
+	overrideThreshold    = 0.9 //fraction of matched lines a format must win before we suggest an override
+	maxLineSize          = 1024 * 1024
+)
+
+var (
+	// numericDateRx picks apart numeric dates so we can reason about field order
+	numericDateRx = regexp.MustCompile(`(\d{1,4})([/\-.])(\d{1,2})([/\-.])(\d{2,4})(?:([ T])(\d{1,2}):(\d{2}):(\d{2})(?:([.,])(\d{1,9}))?)?`)
+	// refDay is formatted with a processor layout to learn where the day lands
+	refDay = time.Date(2006, time.November, 13, 10, 11, 12, 0, time.UTC)
+)
+
+type dateOrder int
+
+const (
+	orderUnknown dateOrder = iota
+	orderDayFirst
+	orderMonthFirst
+	orderYearFirst
+)
+
+func (o dateOrder) String() string {
+	switch o {
+	case orderDayFirst:
+		return `DD/MM`
+	case orderMonthFirst:
+		return `MM/DD`
+	case orderYearFirst:
+		return `YYYY/MM/DD`
+	}
+	return `unknown`
+}
+
+// orderStats tracks the largest leading and middle fields seen in numeric dates
+type orderStats struct {
+	count     int
+	maxFirst  int
+	maxSecond int
+}
+
+func (s *orderStats) add(m []string) {
+	s.count++
+	if len(m[1]) == 4 {
+		return
+	}
+	if v := atoi(m[1]); v > s.maxFirst {
+		s.maxFirst = v
+	}
+	if v := atoi(m[3]); v > s.maxSecond {
+		s.maxSecond = v
+	}
+}
+
+// order returns the field order the data proves, ambiguous is true when no value settles it
+func (s *orderStats) order() (o dateOrder, ambiguous bool) {
+	switch {
+	case s.count == 0:
+	case s.maxFirst == 0 && s.maxSecond == 0:
+		o = orderYearFirst
+	case s.maxFirst > 12 && s.maxSecond > 12:
+		//neither order parses every line
+	case s.maxFirst > 12:
+		o = orderDayFirst
+	case s.maxSecond > 12:
+		o = orderMonthFirst
+	default:
+		ambiguous = true
+	}
+	return
+}
+
+type procStats struct {
+	name    string
+	lines   int         //lines with at least one match
+	first   int         //lines where this was the first timestamp
+	offsets map[int]int //start offset of the first timestamp
+	order   dateOrder   //day/month order the format assumes
+	dates   orderStats
+}
+
+type discovery struct {
+	tg        *timegrinder.TimeGrinder
+	lines     int
+	matched   int
+	multi     int
+	procs     map[string]*procStats
+	misses    []string
+	missLines []int
+	missDates orderStats
+	layouts   map[string]int //candidate custom layouts built from unmatched lines
+}
+
+func newDiscovery(tg *timegrinder.TimeGrinder) *discovery {
+	return &discovery{
+		tg:      tg,
+		procs:   map[string]*procStats{},
+		layouts: map[string]int{},
+	}
+}
+
+func runDiscovery(tg *timegrinder.TimeGrinder, pth string, maxLines, examples int) error {
+	fin, err := os.Open(pth)
+	if err != nil {
+		return err
+	}
+	defer fin.Close()
+	d := newDiscovery(tg)
+	if err = d.scan(fin, maxLines); err != nil {
+		return err
+	}
+	d.report(os.Stdout, examples)
+	return nil
+}
+
+func (d *discovery) scan(r io.Reader, maxLines int) error {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 0, 64*1024), maxLineSize)
+	for sc.Scan() && (maxLines <= 0 || d.lines < maxLines) {
+		ln := sc.Text()
+		if strings.TrimSpace(ln) == `` {
+			continue
+		}
+		d.lines++
+		d.add(ln)
+	}
+	return sc.Err()
+}
+
+func (d *discovery) add(ln string) {
+	ms := d.tg.ExtractAll([]byte(ln))
+	if len(ms) == 0 {
+		d.misses = append(d.misses, ln)
+		d.missLines = append(d.missLines, d.lines)
+		if m := numericDateRx.FindStringSubmatch(ln); m != nil {
+			d.missDates.add(m)
+		}
+		return
+	}
+	d.matched++
+	if len(ms) > 1 {
+		d.multi++
+	}
+	seen := map[string]bool{}
+	for i, m := range ms {
+		ps := d.proc(m.Name)
+		if !seen[m.Name] {
+			seen[m.Name] = true
+			ps.lines++
+		}
+		if i == 0 {
+			ps.first++
+			ps.offsets[m.Start]++
+		}
+		if nd := numericDateRx.FindStringSubmatch(ln[m.Start:m.End]); nd != nil {
+			ps.dates.add(nd)
+		}
+	}
+}
+
+func (d *discovery) proc(name string) *procStats {
+	if ps, ok := d.procs[name]; ok {
+		return ps
+	}
+	ps := &procStats{name: name, offsets: map[int]int{}}
+	if p, ok := d.tg.GetProcessor(name); ok {
+		ps.order = layoutOrder(p.Format())
+	}
+	d.procs[name] = ps
+	return ps
+}
+
+// layoutOrder formats a day above 12 with the layout to see which numeric field holds the day
+func layoutOrder(layout string) dateOrder {
+	m := numericDateRx.FindStringSubmatch(refDay.Format(layout))
+	if m == nil {
+		return orderUnknown
+	} else if len(m[1]) == 4 {
+		return orderYearFirst
+	} else if m[1] == `13` {
+		return orderDayFirst
+	} else if m[3] == `13` {
+		return orderMonthFirst
+	}
+	return orderUnknown
+}
+
+func (d *discovery) sorted() (r []*procStats) {
+	for _, ps := range d.procs {
+		r = append(r, ps)
+	}
+	sort.Slice(r, func(i, j int) bool {
+		if r[i].first != r[j].first {
+			return r[i].first > r[j].first
+		}
+		return r[i].name < r[j].name
+	})
+	return
+}
+
+func (d *discovery) report(w io.Writer, examples int) {
+	fmt.Fprintf(w, "Scanned %d lines, %d matched, %d had no timestamp, %d had more than one timestamp\n\n",
+		d.lines, d.matched, len(d.misses), d.multi)
+
+	procs := d.sorted()
+	if len(procs) > 0 {
+		fmt.Fprintf(w, "%-24s %8s %8s  %s\n", `Format`, `Lines`, `First`, `Common offsets`)
+		for _, ps := range procs {
+			fmt.Fprintf(w, "%-24s %8d %8d  %s\n", ps.name, ps.lines, ps.first, topOffsets(ps.offsets, 3))
+		}
+		fmt.Fprintln(w)
+	}
+
+	//ambiguity and conflicts between the data and the formats that matched it
+	for _, ps := range procs {
+		o, ambiguous := ps.dates.order()
+		if ambiguous && ps.order != orderYearFirst {
+			fmt.Fprintf(w, "%sAmbiguous%s %s: no date in %d matches has a day above 12, %s parses them as %v\n",
+				Yellow, Reset, ps.name, ps.dates.count, ps.name, ps.order)
+		} else if o != orderUnknown && ps.order != orderUnknown && o != ps.order {
+			fmt.Fprintf(w, "%sConflict%s %s: data looks like %v but the format is %v\n", Red, Reset, ps.name, o, ps.order)
+		}
+	}
+
+	if len(d.misses) > 0 {
+		fmt.Fprintf(w, "%sLines with no timestamp%s\n", Red, Reset)
+		for i := 0; i < len(d.misses) && i < examples; i++ {
+			fmt.Fprintf(w, "\t%d: %s\n", d.missLines[i], d.misses[i])
+		}
+		fmt.Fprintln(w)
+	}
+	d.suggest(w, procs)
+}
+
+// suggest proposes an override when one format dominates and a custom format for lines nothing matched
+func (d *discovery) suggest(w io.Writer, procs []*procStats) {
+	fmt.Fprintln(w, "Suggested configuration:")
+	var suggested bool
+	if len(procs) > 0 && d.matched > 0 && float64(procs[0].first)/float64(d.matched) >= overrideThreshold {
+		fmt.Fprintf(w, "\tTimestamp-Format-Override=%s\n", procs[0].name)
+		suggested = true
+	}
+	if cf, hits, ok := d.customFormat(); ok {
+		o, ambiguous := d.missDates.order()
+		if ambiguous {
+			fmt.Fprintf(w, "\t#day and month order could not be determined, %v was assumed\n", orderMonthFirst)
+		} else if o != orderUnknown {
+			fmt.Fprintf(w, "\t#dates are %v\n", o)
+		}
+		fmt.Fprintf(w, "\t#matches %d of %d unmatched lines\n", hits, len(d.misses))
+		fmt.Fprintf(w, "\t[TimeFormat %q]\n\t\tFormat=%q\n\t\tRegex=`%s`\n", cf.Name, cf.Format, cf.Regex)
+		if !suggested {
+			fmt.Fprintf(w, "\tTimestamp-Format-Override=%s\n", cf.Name)
+		}
+		suggested = true
+	}
+	if !suggested {
+		fmt.Fprintln(w, "\tnone, the default formats handle this data")
+	}
+}
+
+// customFormat builds a custom format from numeric dates in unmatched lines and checks it against them
+func (d *discovery) customFormat() (cf timegrinder.CustomFormat, hits int, ok bool) {
+	o, ambiguous := d.missDates.order()
+	if o == orderUnknown && !ambiguous {
+		return
+	} else if ambiguous {
+		o = orderMonthFirst
+	}
+	for _, ln := range d.misses {
+		if m := numericDateRx.FindStringSubmatch(ln); m != nil {
+			if layout, rx := numericLayout(m, o); layout != `` {
+				d.layouts[layout+"\x00"+rx]++
+			}
+		}
+	}
+	var best string
+	for k, v := range d.layouts {
+		if v > d.layouts[best] || (v == d.layouts[best] && k < best) {
+			best = k
+		}
+	}
+	if best == `` {
+		return
+	}
+	bits := strings.SplitN(best, "\x00", 2)
+	cf = timegrinder.CustomFormat{
+		Name:   discoveredFormatName,
+		Format: bits[0],
+		Regex:  bits[1],
+	}
+	if err := cf.Validate(); err != nil {
+		return
+	}
+	p, err := timegrinder.NewCustomProcessor(cf)
+	if err != nil {
+		return
+	}
+	for _, ln := range d.misses {
+		if _, pok, _ := p.Extract([]byte(ln), time.UTC); pok {
+			hits++
+		}
+	}
+	ok = hits > 0
+	return
+}
+
+// numericLayout turns a numeric date match into a time layout and extraction regex
+func numericLayout(m []string, o dateOrder) (layout, rx string) {
+	year := `2006`
+	if len(m[5]) == 2 {
+		year = `06`
+	}
+	sep1, sep2 := m[2], m[4]
+	switch o {
+	case orderYearFirst:
+		if len(m[1]) != 4 || len(m[5]) > 2 {
+			return
+		}
+		layout = `2006` + sep1 + `1` + sep2 + `2`
+		rx = `\d{4}` + regexp.QuoteMeta(sep1) + `\d{1,2}` + regexp.QuoteMeta(sep2) + `\d{1,2}`
+	case orderDayFirst, orderMonthFirst:
+		if len(m[1]) > 2 {
+			return
+		}
+		if o == orderDayFirst {
+			layout = `2` + sep1 + `1` + sep2 + year
+		} else {
+			layout = `1` + sep1 + `2` + sep2 + year
+		}
+		rx = `\d{1,2}` + regexp.QuoteMeta(sep1) + `\d{1,2}` + regexp.QuoteMeta(sep2) + fmt.Sprintf(`\d{%d}`, len(year))
+	default:
+		return
+	}
+	if m[6] != `` {
+		layout += m[6] + `15:04:05`
+		rx += m[6] + `\d{1,2}:\d{2}:\d{2}`
+		if m[10] != `` {
+			layout += m[10] + `999999999`
+			rx += regexp.QuoteMeta(m[10]) + `\d+`
+		}
+	}
+	return
+}
+
+func topOffsets(offsets map[int]int, n int) string {
+	type oc struct{ off, cnt int }
+	var ocs []oc
+	for k, v := range offsets {
+		ocs = append(ocs, oc{k, v})
+	}
+	sort.Slice(ocs, func(i, j int) bool {
+		if ocs[i].cnt != ocs[j].cnt {
+			return ocs[i].cnt > ocs[j].cnt
+		}
+		return ocs[i].off < ocs[j].off
+	})
+	var parts []string
+	for i := 0; i < len(ocs) && i < n; i++ {
+		parts = append(parts, fmt.Sprintf("%d(%d)", ocs[i].off, ocs[i].cnt))
+	}
+	return strings.Join(parts, ` `)
+}
+
+func atoi(s string) (v int) {
+	for _, c := range s {
+		v = v*10 + int(c-'0')
+	}
+	return
+}
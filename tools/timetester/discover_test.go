@@ -0,0 +1,192 @@
+/*************************************************************************
+ * Copyright 2024 Gravwell, Inc. All rights reserved.
+ * Contact: <legal@gravwell.io>
+ *
+ * This software may be modified and distributed under the terms of the
+ * BSD 2-clause license. See the LICENSE file for details.
+ **************************************************************************/
+
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gravwell/gravwell/v3/ingest/config"
+	"github.com/gravwell/gravwell/v3/timegrinder"
+)
+
+func discoverLines(t *testing.T, lines ...string) (*discovery, string) {
+	t.Helper()
+	tg, err := timegrinder.New(timegrinder.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := newDiscovery(tg)
+	if err = d.scan(strings.NewReader(strings.Join(lines, "\n")), 0); err != nil {
+		t.Fatal(err)
+	}
+	var bb bytes.Buffer
+	d.report(&bb, 5)
+	return d, bb.String()
+}
+
+// loadSuggested pulls the [TimeFormat] block out of a report and loads it the way an ingester would
+func loadSuggested(t *testing.T, out string) config.CustomTimeFormat {
+	t.Helper()
+	idx := strings.Index(out, `[TimeFormat`)
+	if idx == -1 {
+		t.Fatalf("no custom format suggested:\n%s", out)
+	}
+	var block []string
+	for _, ln := range strings.Split(out[idx:], "\n") {
+		if ln = strings.TrimSpace(ln); strings.HasPrefix(ln, `Timestamp-Format-Override`) || ln == `` {
+			break
+		}
+		block = append(block, ln)
+	}
+	var cf customFormats
+	if err := config.LoadConfigBytes(&cf, []byte(strings.Join(block, "\n"))); err != nil {
+		t.Fatalf("suggested block does not load: %v\n%s", err, strings.Join(block, "\n"))
+	} else if err = cf.TimeFormat.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	return cf.TimeFormat
+}
+
+func TestOrderStats(t *testing.T) {
+	tests := []struct {
+		dates     []string
+		order     dateOrder
+		ambiguous bool
+	}{
+		{nil, orderUnknown, false},
+		{[]string{`2024/01/02`, `2024-11-30`}, orderYearFirst, false},
+		{[]string{`01/02/2024`, `12/11/2024`}, orderUnknown, true},
+		{[]string{`01/02/2024`, `13/02/2024`}, orderDayFirst, false},
+		{[]string{`01/02/2024`, `02/13/2024`}, orderMonthFirst, false},
+		{[]string{`13/02/2024`, `02/13/2024`}, orderUnknown, false},
+	}
+	for i, tt := range tests {
+		var s orderStats
+		for _, v := range tt.dates {
+			s.add(numericDateRx.FindStringSubmatch(v))
+		}
+		if o, amb := s.order(); o != tt.order || amb != tt.ambiguous {
+			t.Errorf("%d: got %v %v, expected %v %v", i, o, amb, tt.order, tt.ambiguous)
+		}
+	}
+}
+
+func TestNumericLayout(t *testing.T) {
+	tests := []struct {
+		date   string
+		order  dateOrder
+		layout string
+		rx     string
+	}{
+		{`01/02/2024`, orderMonthFirst, `1/2/2006`, `\d{1,2}/\d{1,2}/\d{4}`},
+		{`01/02/2024`, orderDayFirst, `2/1/2006`, `\d{1,2}/\d{1,2}/\d{4}`},
+		{`01.02.24 10:11:12`, orderDayFirst, `2.1.06 15:04:05`, `\d{1,2}\.\d{1,2}\.\d{2} \d{1,2}:\d{2}:\d{2}`},
+		{`2024-01-02T10:11:12,123`, orderYearFirst, `2006-1-2T15:04:05,999999999`, `\d{4}-\d{1,2}-\d{1,2}T\d{1,2}:\d{2}:\d{2},\d+`},
+		{`2024.01.02 10:11:12.5`, orderYearFirst, `2006.1.2 15:04:05.999999999`, `\d{4}\.\d{1,2}\.\d{1,2} \d{1,2}:\d{2}:\d{2}\.\d+`},
+		//the order must match the shape of the date
+		{`2024/01/02`, orderMonthFirst, ``, ``},
+		{`01/02/2024`, orderYearFirst, ``, ``},
+		{`01/02/2024`, orderUnknown, ``, ``},
+	}
+	for _, tt := range tests {
+		m := numericDateRx.FindStringSubmatch(tt.date)
+		if m == nil {
+			t.Fatalf("%q did not match", tt.date)
+		}
+		if layout, rx := numericLayout(m, tt.order); layout != tt.layout || rx != tt.rx {
+			t.Errorf("%q %v: got %q %q, expected %q %q", tt.date, tt.order, layout, rx, tt.layout, tt.rx)
+		}
+	}
+}
+
+func TestDiscoverAmbiguous(t *testing.T) {
+	//every day is 12 or less, nothing in the data settles the order
+	d, out := discoverLines(t,
+		`a 01/02/2024 10:11:12 login`,
+		`a 03/04/2024 10:11:13 logout`,
+		`a 12/11/2024 10:11:14 login`,
+	)
+	if !strings.Contains(out, `could not be determined`) {
+		t.Fatalf("ambiguous dates were not flagged:\n%s", out)
+	}
+	cf, hits, ok := d.customFormat()
+	if !ok || hits != 3 || cf.Format != `1/2/2006 15:04:05` {
+		t.Fatalf("bad custom format %+v %d %v", cf, hits, ok)
+	}
+
+	//a format that matched ambiguous dates is flagged as well
+	if _, out = discoverLines(t, `a 01-02-2024 10:11:12 b`, `a 03-04-2024 10:11:12 b`); !strings.Contains(out, `Ambiguous`) {
+		t.Fatalf("ambiguous format match was not flagged:\n%s", out)
+	}
+}
+
+func TestDiscoverDayFirst(t *testing.T) {
+	//a single day above 12 settles the order for every line
+	d, out := discoverLines(t,
+		`a 01.02.2024 10:11:12 login`,
+		`a 25.02.2024 10:11:13 logout`,
+		`a 03.04.2024 10:11:14 login`,
+	)
+	if strings.Contains(out, `could not be determined`) {
+		t.Fatalf("day above 12 did not settle the order:\n%s", out)
+	} else if o, amb := d.missDates.order(); o != orderDayFirst || amb {
+		t.Fatalf("got order %v %v", o, amb)
+	}
+
+	ctf := loadSuggested(t, out)
+	tf, ok := ctf[discoveredFormatName]
+	if !ok || tf.Format != `2.1.2006 15:04:05` {
+		t.Fatalf("bad suggested format %+v", ctf)
+	}
+	tg, err := timegrinder.New(timegrinder.Config{})
+	if err != nil {
+		t.Fatal(err)
+	} else if err = ctf.LoadFormats(tg); err != nil {
+		t.Fatal(err)
+	} else if err = tg.SetFormatOverride(discoveredFormatName); err != nil {
+		t.Fatal(err)
+	}
+	ts, ok, err := tg.Extract([]byte(`a 25.02.2024 10:11:13 logout`))
+	if err != nil || !ok {
+		t.Fatalf("suggested format did not extract: %v %v", ok, err)
+	} else if !ts.Equal(time.Date(2024, time.February, 25, 10, 11, 13, 0, time.UTC)) {
+		t.Fatalf("bad timestamp %v", ts)
+	}
+}
+
+func TestDiscoverYearFirst(t *testing.T) {
+	_, out := discoverLines(t, `x 2024.01.02 10:11:12.250 y`, `x 2024.01.03 10:11:12.500 y`)
+	ctf := loadSuggested(t, out)
+	if tf := ctf[discoveredFormatName]; tf == nil || tf.Format != `2006.1.2 15:04:05.999999999` {
+		t.Fatalf("bad suggested format %+v", tf)
+	}
+	tg, err := timegrinder.New(timegrinder.Config{})
+	if err != nil {
+		t.Fatal(err)
+	} else if err = ctf.LoadFormats(tg); err != nil {
+		t.Fatal(err)
+	}
+	if ts, ok, err := tg.Extract([]byte(`x 2024.01.03 10:11:12.500 y`)); err != nil || !ok {
+		t.Fatalf("suggested format did not extract: %v %v", ok, err)
+	} else if !ts.Equal(time.Date(2024, time.January, 3, 10, 11, 12, 500000000, time.UTC)) {
+		t.Fatalf("bad timestamp %v", ts)
+	}
+}
+
+func TestDiscoverNoSuggestion(t *testing.T) {
+	d, out := discoverLines(t, `no timestamps here`, `or here`)
+	if _, _, ok := d.customFormat(); ok {
+		t.Fatal("custom format built without dates")
+	} else if !strings.Contains(out, `none, the default formats handle this data`) {
+		t.Fatalf("unexpected suggestion:\n%s", out)
+	}
+}
@@ -22,7 +22,11 @@ var (
 	custFormatPath = flag.String("custom", "", "Path to custom time format configuration file")
 	lms            = flag.Bool("enable-left-most-seed", false, "Activate EnableLeftMostSeed config option")
 	fo             = flag.String("format-override", "", "Enable FormatOverride config option")
+	locale         = flag.String("locale", "", "Enable Locale config option for non-English month names")
 	metrics        = flag.Bool("metrics", false, "Output metrics about captures")
+	discover       = flag.String("discover", "", "Path to a sample log file to scan for timestamp formats")
+	maxLines       = flag.Int("max-lines", 10000, "Maximum number of lines to scan in discovery mode, zero scans everything")
+	examples       = flag.Int("examples", 5, "Number of unmatched lines to show in discovery mode")
 )
 
 type customFormats struct {
@@ -34,6 +38,7 @@ func main() {
 
 	cfg := timegrinder.Config{
 		EnableLeftMostSeed: *lms,
+		Locale:             *locale,
 	}
 	tg, err := timegrinder.New(cfg)
 	if err != nil {
@@ -49,9 +54,11 @@ func main() {
 				continue
 			}
 			cf := timegrinder.CustomFormat{
-				Name:   k,
-				Regex:  v.Regex,
-				Format: v.Format,
+				Name:             k,
+				Regex:            v.Regex,
+				Format:           v.Format,
+				Extraction_Regex: v.Extraction_Regex,
+				Locale:           v.Locale,
 			}
 			if cp, err := timegrinder.NewCustomProcessor(cf); err != nil {
 				log.Fatalf("Invalid custom format %q: %v\n", k, err)
@@ -65,6 +72,12 @@ func main() {
 			log.Fatalf("Failed to set timestamp format override to %q: %v\n", *fo, err)
 		}
 	}
+	if *discover != `` {
+		if err := runDiscovery(tg, *discover, *maxLines, *examples); err != nil {
+			log.Fatalf("Failed to scan %q: %v\n", *discover, err)
+		}
+		return
+	}
 	for _, arg := range flag.Args() {
 		if ts, name, start, end, ok := tg.DebugMatch([]byte(arg)); !ok {
 			outputNoMatch(arg)